@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+)
+
+const activationRequiredCode = "activation_required"
+
+var errAccountNotActivated = errors.New("account is not activated")
+
+// errAccountDisabled rejects suspended, deactivated and deleted users whose
+// cached entry or token outlived the change.
+var errAccountDisabled = errors.New("account is disabled")
+
+// activationAllowed lists the routes a user who has not activated their
+// account yet may call: enough to see who they are and to fix a mistyped
+// address. Keys are "METHOD /path" without the version prefix.
+var activationAllowed = map[string]bool{
+	"GET /authentication/me": true,
+	"GET /users/me/email":    true,
+	"POST /users/me/email":   true,
+	"DELETE /users/me/email": true,
+}
+
+// activationGate answers 403 with code activation_required when a pending
+// user calls a route outside activationAllowed. A cached user may be stale
+// after activation, so it is reloaded before being rejected.
+func (app *application) activationGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		if !user.PendingActivation() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if app.config.redisCfg.enabled {
+			fresh, err := app.store.Users.GetByID(r.Context(), user.ID)
+			if err != nil {
+				app.unauthorizedErrorResponse(w, r, err)
+				return
+			}
+			if !fresh.PendingActivation() {
+				app.cacheStorage.Users.Delete(r.Context(), user.ID)
+				app.forgetProfile(user.ID)
+				next.ServeHTTP(w, r.WithContext(reqctx.WithUser(r.Context(), fresh)))
+				return
+			}
+		}
+
+		if app.config.auth.strictActivation {
+			app.unauthorizedErrorResponse(w, r, errAccountNotActivated)
+			return
+		}
+
+		if activationAllowed[r.Method+" "+strings.TrimRight(unversionedPath(r.URL.Path), "/")] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.logger.Warnw("activation required", "method", r.Method, "path", r.URL.Path, "user_id", user.ID)
+		writeJSONErrorCode(w, http.StatusForbidden, activationRequiredCode, "activate your account using the link sent to your email")
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+)
+
+// Activation links can open a mobile app instead of the web frontend.
+// ACTIVATION_LINKS maps clients to URL templates separated by ";", e.g.
+//
+//	ACTIVATION_LINKS="ios=valar://activate/{token};android=https://app.example.com/confirm/{token}"
+//
+// and registrations pass ?client=ios to get that link in their email.
+// Templates must contain {token} and use http, https or a scheme listed in
+// ACTIVATION_LINK_SCHEMES, so a typo cannot mail users a javascript: link.
+// The web client, also used without ?client, defaults to FRONTEND_URL.
+const (
+	activationClientWeb = "web"
+	activationTokenVar  = "{token}"
+)
+
+var activationClientName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// parseActivationLinks parses ACTIVATION_LINKS into templates by client.
+func parseActivationLinks(value, schemes string) (map[string]string, error) {
+	allowed := []string{"http", "https"}
+	for _, scheme := range strings.Split(schemes, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			allowed = append(allowed, scheme)
+		}
+	}
+
+	links := make(map[string]string)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		client, template, ok := strings.Cut(entry, "=")
+		client, template = strings.TrimSpace(client), strings.TrimSpace(template)
+		if !ok || !activationClientName.MatchString(client) {
+			return nil, fmt.Errorf("invalid ACTIVATION_LINKS entry %q", entry)
+		}
+		if _, dup := links[client]; dup {
+			return nil, fmt.Errorf("ACTIVATION_LINKS lists client %q twice", client)
+		}
+		if !strings.Contains(template, activationTokenVar) {
+			return nil, fmt.Errorf("ACTIVATION_LINKS template for %q has no %s", client, activationTokenVar)
+		}
+		u, err := url.Parse(strings.ReplaceAll(template, activationTokenVar, "token"))
+		if err != nil || u.Scheme == "" {
+			return nil, fmt.Errorf("ACTIVATION_LINKS template for %q is not a URL", client)
+		}
+		if !slices.Contains(allowed, strings.ToLower(u.Scheme)) {
+			return nil, fmt.Errorf("ACTIVATION_LINKS template for %q uses scheme %q, add it to ACTIVATION_LINK_SCHEMES", client, u.Scheme)
+		}
+
+		links[client] = template
+	}
+	return links, nil
+}
+
+// activationClient returns the client named by the ?client parameter of a
+// registration, or web without one.
+func (app *application) activationClient(r *http.Request) (string, error) {
+	client := r.URL.Query().Get("client")
+	if client == "" || client == activationClientWeb {
+		return activationClientWeb, nil
+	}
+	if _, ok := app.activationLinks()[client]; !ok {
+		return "", fmt.Errorf("unknown client %q", client)
+	}
+	return client, nil
+}
+
+// activationURL is the link mailed to activate an account from client.
+func (app *application) activationURL(client, token string) string {
+	if template, ok := app.activationLinks()[client]; ok {
+		return strings.ReplaceAll(template, activationTokenVar, url.PathEscape(token))
+	}
+	return service.ActivationURL(app.config.frontendURL, app.config.env, token)
+}
+
+// activationLinks was validated at startup; an error here leaves every
+// client on the web link.
+func (app *application) activationLinks() map[string]string {
+	links, err := parseActivationLinks(app.config.auth.activationLinks, app.config.auth.activationSchemes)
+	if err != nil {
+		app.logger.Errorw("invalid ACTIVATION_LINKS", "error", err)
+		return nil
+	}
+	return links
+}
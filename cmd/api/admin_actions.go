@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/pagination"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 )
 
@@ -22,29 +23,20 @@ import (
 //	@Security		ApiKeyAuth
 //	@Router			/admin/logs [get]
 func (app *application) adminListLogsHandler(w http.ResponseWriter, r *http.Request) {
-	fq := store.PaginatedQuery{
-		Limit:  20,
-		Offset: 0,
-	}
-
-	fq, err := fq.Parse(r)
+	params, err := pagination.Parse(r, listPage)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if err := Validate.Struct(fq); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
-
-	logs, err := app.store.AdminActions.List(r.Context(), fq)
+	logs, err := app.store.AdminActions.List(r.Context(), storeQuery(params))
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, logs); err != nil {
+	page := newPage(params, logs)
+	if err := app.jsonPageResponse(w, r, http.StatusOK, page.items, page.page); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/alert"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+)
+
+const alertTimeout = 5 * time.Second
+
+// newAlertManager routes alerts to the channels configured in cfg. Slack and
+// email are notified as soon as a condition is seen; PagerDuty only after it
+// has lasted escalateAfter. It returns nil when no channel is configured.
+func (app *application) newAlertManager(cfg alertConfig) *alert.Manager {
+	var routes []alert.Route
+	if cfg.slackWebhookURL != "" {
+		routes = append(routes, alert.Route{Notifier: alert.NewSlackNotifier(cfg.slackWebhookURL, alertTimeout)})
+	}
+	if cfg.email != "" {
+		routes = append(routes, alert.Route{Notifier: alert.NotifierFunc(app.sendAlertEmail)})
+	}
+	if cfg.pagerDutyRoutingKey != "" {
+		routes = append(routes, alert.Route{
+			Notifier: alert.NewPagerDutyNotifier(cfg.pagerDutyRoutingKey, app.config.apiURL, alertTimeout),
+			After:    cfg.escalateAfter,
+		})
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+	return alert.NewManager(routes, cfg.repeat)
+}
+
+// sendAlertEmail mails ALERT_EMAIL directly rather than through the outbox,
+// which lives in the database the alert may be about.
+func (app *application) sendAlertEmail(ctx context.Context, a alert.Alert, resolved bool) error {
+	status := "firing"
+	if resolved {
+		status = "resolved"
+	}
+	data := map[string]any{
+		"Username": "operator",
+		"Status":   status,
+		"Summary":  a.Summary,
+		"Details":  a.Details,
+	}
+
+	_, err := app.mailer.Send(ctx, mailer.OperatorAlertTemplate, "operator", app.config.alert.email, data, app.config.env != "production")
+	return err
+}
+
+// runAlertChecks evaluates the alert conditions every interval until ctx is
+// cancelled.
+func (app *application) runAlertChecks(ctx context.Context, conn *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// abandoned is the dead letter count at the previous check, -1
+	// until the first successful count
+	abandoned := -1
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			abandoned = app.checkAlerts(ctx, conn, abandoned)
+		}
+	}
+}
+
+// checkAlerts fires or resolves each alert condition once and returns the
+// current abandoned email count for the next check.
+func (app *application) checkAlerts(ctx context.Context, conn *sql.DB, abandoned int) int {
+	cfg := app.config.alert
+
+	pingCtx, cancel := context.WithTimeout(ctx, alertTimeout)
+	err := conn.PingContext(pingCtx)
+	cancel()
+	dbAlert := alert.Alert{Key: "database_unreachable", Summary: "Database unreachable"}
+	if err != nil {
+		dbAlert.Details = err.Error()
+	}
+	app.setAlert(ctx, err != nil, dbAlert)
+
+	// Consecutive send failures stand in for an open mailer circuit.
+	if cfg.mailFailures > 0 {
+		failures := app.mailFailures.Load()
+		app.setAlert(ctx, failures >= int64(cfg.mailFailures), alert.Alert{
+			Key:     "mail_sending_failing",
+			Summary: "Emails are failing to send",
+			Details: fmt.Sprintf("%d consecutive outbox sends failed", failures),
+		})
+	}
+
+	// Emails the relay gave up on land in the dead letters.
+	if cfg.abandonedEmails > 0 && err == nil {
+		count, err := app.store.DeadLetters.Count(ctx)
+		if err != nil {
+			app.logger.Errorw("could not count dead-lettered emails", "error", err)
+			return abandoned
+		}
+		if abandoned >= 0 {
+			app.setAlert(ctx, count-abandoned >= cfg.abandonedEmails, alert.Alert{
+				Key:     "outbox_abandoned_growing",
+				Summary: "Outbox emails are being abandoned",
+				Details: fmt.Sprintf("%d emails abandoned since the last check, %d in total", count-abandoned, count),
+			})
+		}
+		return count
+	}
+	return abandoned
+}
+
+func (app *application) setAlert(ctx context.Context, firing bool, a alert.Alert) {
+	var err error
+	if firing {
+		err = app.alerts.Fire(ctx, a)
+	} else {
+		err = app.alerts.Resolve(ctx, a)
+	}
+	if err != nil {
+		app.logger.Errorw("could not send alert", "key", a.Key, "error", err)
+	}
+}
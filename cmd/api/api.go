@@ -2,28 +2,37 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"expvar"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 	"go.uber.org/zap"
 
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/docs" // This is required to generate swagger docs
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/alert"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/auth"
-	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/env"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/contentfilter"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/email"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/errreport"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
 	filestorage "github.com/Lelouchlamperougexd/Valar_Morghulis/internal/storage"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/wordfilter"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
@@ -34,8 +43,73 @@ type application struct {
 	logger        *zap.SugaredLogger
 	mailer        mailer.Client
 	authenticator auth.Authenticator
-	rateLimiter   ratelimiter.Limiter
-	uploader      filestorage.Uploader
+	// tokens issues the tokens of emailed links, see link_tokens.go
+	tokens      *tokens.Issuer
+	rateLimiter ratelimiter.Limiter
+	uploader    filestorage.Uploader
+	// breachChecker is nil unless PASSWORD_BREACH_CHECK is enabled
+	breachChecker auth.BreachChecker
+	// emails normalizes and checks addresses; nil leaves them as typed
+	emails *email.Service
+	// botCheck is nil unless BOT_CHECK_PROVIDER is set
+	botCheck *botCheck
+	// contentFilter is nil unless CONTENT_FILTER_ENABLED is set
+	contentFilter contentfilter.Filter
+	// sesVerifier is nil unless MAIL_WEBHOOK_SES_TOPIC_ARN is set
+	sesVerifier *mailer.SNSVerifier
+	// traceExporter is nil unless OTEL_EXPORTER_OTLP_ENDPOINT is set
+	traceExporter *tracing.Exporter
+	// errorReporter is nil unless SENTRY_DSN is set outside development
+	errorReporter errreport.Reporter
+	// dbStats reports the connection pool, nil in tests
+	dbStats func() sql.DBStats
+	// replicas is nil unless DB_REPLICA_ADDRS is set
+	replicas *store.QueryerChooser
+	// smtpServers is nil unless SMTP_FAILOVER_HOSTS is set
+	smtpServers *mailer.SMTPFailover
+
+	// schemaIncompatible is set by the schema watcher when the database
+	// was migrated outside the range this binary supports.
+	schemaIncompatible atomic.Bool
+	// readOnly is toggled by operators (READ_ONLY or the admin endpoint)
+	// during maintenance windows and database failovers.
+	readOnly atomic.Bool
+	// maintenance is toggled by MAINTENANCE_MODE or the admin endpoint,
+	// maintenanceFile by watchMaintenanceFile
+	maintenance     atomic.Bool
+	maintenanceFile atomic.Bool
+	// alerts is nil unless an ALERT_* channel is configured
+	alerts *alert.Manager
+	// mailFailures counts consecutive failed outbox sends for alerting
+	mailFailures atomic.Int64
+	// permissions caches role_permissions for requirePermission
+	permissions permissionCache
+	// trending caches the trending listings, see trending.go
+	trending trendingCache
+	// hot is nil unless HTTP_CACHE_LRU_SIZE is set, see http_cache.go
+	hot *hotCache
+	// jobs runs the background jobs queued in the database, see jobs.go
+	jobs *jobs.Pool
+	// webhookClient delivers webhooks, see newWebhookClient
+	webhookClient *http.Client
+	// linkPreviewClient fetches link previews, see newLinkPreviewClient
+	linkPreviewClient *http.Client
+	// bus carries domain events to webhooks and eventPublisher
+	bus *events.Bus
+	// eventPublisher is nil unless EVENTS_NATS_URL is set
+	eventPublisher *events.NATSPublisher
+	// tenants caches tenant IDs by slug, see tenancy.go
+	tenants tenantCache
+	// federation is nil unless ACTIVITYPUB_BASE_URL is set
+	federation *federation
+	// pusher is nil unless a PUSH_* platform is configured
+	pusher *pusher
+	// indexer queues listings for the search index, see search_indexer.go
+	indexer *searchIndexer
+	// stream carries notifications to GET /v1/events, see event_stream.go
+	stream eventStream
+	// words is the word filter, nil until loaded, see word_filter.go
+	words atomic.Pointer[wordfilter.Filter]
 }
 
 type config struct {
@@ -50,6 +124,61 @@ type config struct {
 	rateLimiter ratelimiter.Config
 	cryptoKey   string
 	storage     storageConfig
+	readOnly    bool
+	alert       alertConfig
+	compress    compressConfig
+	tracing     tracingConfig
+	errorReport errorReportConfig
+	log         logConfig
+	webhooks    webhookConfig
+	events      eventsConfig
+	loadTest    loadTestConfig
+	listings    listingsConfig
+	linkPreview linkPreviewConfig
+	maintenance maintenanceConfig
+	pagination  paginationConfig
+	tenancy     tenancyConfig
+	federation  federationConfig
+	push        pushConfig
+	eventStream eventStreamConfig
+	wordFilter  wordFilterConfig
+	limits      contentLimitsConfig
+	linkTokens  linkTokensConfig
+	httpCache   httpCacheConfig
+	jobs        jobsConfig
+
+	contentFilter contentFilterConfig
+
+	// routeMiddleware overrides group middleware stacks, see routes.go
+	routeMiddleware string
+	// rateLimitPolicies limits routes and roles, see rate_limit_policies.go
+	rateLimitPolicies string
+	// requestTimeout is the deadline of requests without a routeTimeouts
+	// entry, 0 for none; routeTimeouts sets it per route, see timeouts.go
+	requestTimeout time.Duration
+	routeTimeouts  string
+	// requestQuota caps the authenticated requests a user makes per UTC
+	// day, counted in Redis; 0 disables it and admins have none
+	requestQuota int64
+	// geoIPCountryHeader is the proxy header carrying the client's country
+	geoIPCountryHeader string
+}
+
+type alertConfig struct {
+	// checkInterval is how often the alert conditions are checked
+	checkInterval time.Duration
+	// repeat re-sends a firing alert to a channel at most this often
+	repeat time.Duration
+	// escalateAfter is how long a condition lasts before PagerDuty is paged
+	escalateAfter       time.Duration
+	slackWebhookURL     string
+	pagerDutyRoutingKey string
+	email               string
+	// mailFailures consecutive failed sends raise an alert, 0 disables it
+	mailFailures int
+	// abandonedEmails given up on between two checks raise an alert, 0
+	// disables it
+	abandonedEmails int
 }
 
 type storageConfig struct {
@@ -59,24 +188,141 @@ type storageConfig struct {
 	endpoint  string
 	keyID     string
 	secretKey string
+	// mediaQuotaBytes caps the media a user may upload; 0 disables it.
+	mediaQuotaBytes int64
+	// downloadTTL is how long signed download links work, see downloads.go
+	downloadTTL time.Duration
 }
 
 type redisConfig struct {
-	addr    string
-	pw      string
-	db      int
-	enabled bool
+	// mode is standalone, sentinel or cluster
+	mode string
+	// addr is a comma-separated list for sentinel and cluster modes
+	addr       string
+	pw         string
+	db         int
+	masterName string
+	sentinelPw string
+	enabled    bool
+
+	// viewFlushInterval is how often the profile and listing views counted
+	// in Redis are added to the database; 0 leaves them buffered.
+	viewFlushInterval time.Duration
+}
+
+func (c redisConfig) options() cache.RedisConfig {
+	var addrs []string
+	for _, addr := range strings.Split(c.addr, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return cache.RedisConfig{
+		Mode:             c.mode,
+		Addrs:            addrs,
+		Password:         c.pw,
+		DB:               c.db,
+		MasterName:       c.masterName,
+		SentinelPassword: c.sentinelPw,
+	}
 }
 
 type authConfig struct {
-	basic basicConfig
-	token tokenConfig
+	basic       basicConfig
+	token       tokenConfig
+	password    auth.PasswordPolicy
+	breachCheck breachCheckConfig
+	emailCheck  emailCheckConfig
+	// strictActivation rejects logins from accounts that have not followed
+	// the activation link instead of letting them into activationAllowed.
+	strictActivation bool
+	// requireActivation false creates users already active and sends the
+	// welcome email after the response, for private deployments
+	requireActivation bool
+	// hideExistingAccounts answers registrations for a taken email or phone
+	// like new ones, so the endpoint cannot tell which addresses have accounts
+	hideExistingAccounts bool
+	invites              inviteCodeConfig
+	botCheck             botCheckConfig
+	// loginAlerts emails users about logins from a new country or device
+	loginAlerts bool
+	// activationLinks maps clients to activation URL templates; see
+	// parseActivationLinks
+	activationLinks   string
+	activationSchemes string
+	// impersonationTTL is how long impersonation tokens last
+	impersonationTTL time.Duration
+}
+
+// botCheckConfig configures the CAPTCHA or proof-of-work check on
+// registration; an empty provider turns it off.
+type botCheckConfig struct {
+	provider string
+	// secret is the CAPTCHA secret key, or the key proof-of-work
+	// challenges are signed with
+	secret  string
+	siteKey string
+	// minScore applies to reCAPTCHA v3
+	minScore float64
+	// freeAttempts registrations per IP and window need no token
+	freeAttempts int
+	window       time.Duration
+	// exemptNets lists networks that are never challenged
+	exemptNets    string
+	powDifficulty int
+	powTTL        time.Duration
+	failOpen      bool
+	timeout       time.Duration
+}
+
+// inviteCodeConfig configures invite-only registration.
+type inviteCodeConfig struct {
+	// required makes registration take a code from an admin or a user
+	required bool
+	// perUser is how many codes each user can make for friends
+	perUser int
+	// ttl is how long a user's code stays valid
+	ttl time.Duration
+}
+
+type breachCheckConfig struct {
+	enabled bool
+	// warnOnly accepts breached passwords and flags the response instead of rejecting them
+	warnOnly bool
+	// failOpen accepts the password when the breach service is unreachable
+	failOpen bool
+	timeout  time.Duration
+}
+
+// emailCheckConfig configures the email service used for registration and
+// email changes; normalization of the domain always applies.
+type emailCheckConfig struct {
+	stripPlusTags   bool
+	blockDisposable bool
+	checkMX         bool
+	mxCacheTTL      time.Duration
+	// timeout bounds the DNS lookups of one check
+	timeout time.Duration
 }
 
 type tokenConfig struct {
 	secret string
 	exp    time.Duration
 	iss    string
+	// audience is a comma-separated list, empty for just iss; see
+	// token_claims.go for it and the claims below
+	audience string
+	// leeway tolerates clock skew between the API and token issuers
+	leeway time.Duration
+	// roleClaim names the claim carrying the user's role, empty for none
+	roleClaim string
+	// claims are fixed name=value claims added to every token
+	claims string
+	// format is jwt, signed with secret, or paseto, encrypted with the
+	// base64 32-byte pasetoKey
+	format    string
+	pasetoKey string
 }
 
 type basicConfig struct {
@@ -89,7 +335,85 @@ type mailConfig struct {
 	mailTrap  mailTrapConfig
 	smtp      smtpConfig
 	fromEmail string
-	exp       time.Duration
+	// fromName, replyTo and returnPath complete the sender; fromOverrides
+	// holds per-template senders as parsed by mailer.ParseSenderOverrides
+	fromName      string
+	replyTo       string
+	returnPath    string
+	fromOverrides string
+
+	// outboxInterval is how often the relay polls for queued emails
+	outboxInterval time.Duration
+	// broadcastBatch users get an announcement every broadcastInterval
+	broadcastBatch    int
+	broadcastInterval time.Duration
+	// templateDir replaces the embedded templates when set; changes are
+	// picked up every templateReload
+	templateDir    string
+	templateReload time.Duration
+	webhooks       mailWebhookConfig
+	// lint checks each email for deliverability problems before sending
+	lint bool
+	// unsubscribeURL is the public address of GET /v1/unsubscribe, used to
+	// build the links in non-transactional emails
+	unsubscribeURL string
+	// tracking rewrites the links of notification emails to count opens
+	// and clicks through trackingURL, the public address of /v1/track
+	tracking    bool
+	trackingURL string
+}
+
+func (c mailConfig) smtpConfig() (mailer.SMTPConfig, error) {
+	if _, ok := mailer.SMTPPreset(c.smtp.preset); !ok {
+		return mailer.SMTPConfig{}, fmt.Errorf("invalid SMTP_PRESET %q", c.smtp.preset)
+	}
+
+	overrides, err := mailer.ParseSenderOverrides(c.fromOverrides)
+	if err != nil {
+		return mailer.SMTPConfig{}, err
+	}
+	pins, err := mailer.ParseTLSPins(c.smtp.tlsPins)
+	if err != nil {
+		return mailer.SMTPConfig{}, err
+	}
+
+	return mailer.SMTPConfig{
+		Host:               c.smtp.host,
+		Port:               c.smtp.port,
+		Username:           c.smtp.username,
+		Password:           c.smtp.password,
+		AuthMethod:         c.smtp.authMethod,
+		Encryption:         c.smtp.encryption,
+		TLSPins:            pins,
+		CAFile:             c.smtp.caFile,
+		FromEmail:          c.fromEmail,
+		UseTLS:             c.smtp.tls,
+		InsecureSkipVerify: c.smtp.insecureSkipVerify,
+		DialTimeout:        c.smtp.dialTimeout,
+		SendTimeout:        c.smtp.sendTimeout,
+		FromName:           c.fromName,
+		ReplyTo:            c.replyTo,
+		ReturnPath:         c.returnPath,
+		FromOverrides:      overrides,
+	}, nil
+}
+
+// smtpFailover builds the client sending through SMTP_HOST and then each of
+// SMTP_FAILOVER_HOSTS.
+func (c mailConfig) smtpFailover(primary mailer.SMTPConfig) (*mailer.SMTPFailover, error) {
+	backups, err := mailer.ParseSMTPServers(c.smtp.failoverHosts, primary)
+	if err != nil {
+		return nil, err
+	}
+	return mailer.NewSMTPFailover(append([]mailer.SMTPConfig{primary}, backups...), c.smtp.failoverCooldown)
+}
+
+// mailWebhookConfig enables POST /v1/webhooks/mail/{provider} for each
+// provider whose verification key is set.
+type mailWebhookConfig struct {
+	sendGridPublicKey string
+	mailgunSigningKey string
+	sesTopicARN       string
 }
 
 type mailTrapConfig struct {
@@ -97,12 +421,26 @@ type mailTrapConfig struct {
 }
 
 type smtpConfig struct {
+	// preset names a local capture server, see mailer.SMTPPreset
+	preset             string
 	host               string
 	port               int
 	username           string
 	password           string
+	authMethod         string
+	encryption         string
 	tls                bool
 	insecureSkipVerify bool
+	dialTimeout        time.Duration
+	sendTimeout        time.Duration
+	// tlsPins is a comma separated list, see mailer.ParseTLSPins
+	tlsPins string
+	caFile  string
+	// failoverHosts are host:port pairs tried in order after host, with
+	// the same credentials and TLS settings; a failed one is skipped for
+	// failoverCooldown
+	failoverHosts    string
+	failoverCooldown time.Duration
 }
 
 type sendGridConfig struct {
@@ -110,63 +448,102 @@ type sendGridConfig struct {
 }
 
 type dbConfig struct {
+	// backend is postgres, or memory to keep every table in process; see
+	// store.NewMemoryStorage
+	backend      string
 	addr         string
 	maxOpenConns int
 	maxIdleConns int
 	maxIdleTime  string
+	// maxLifetime closes connections after this long, so they are spread
+	// again after a failover or when a load balancer sits in front
+	maxLifetime string
+	// queryTimeout bounds every store query, so a slow query gives its
+	// connection back instead of holding it while clients pile up
+	queryTimeout time.Duration
+	// replicaAddrs lists read replicas, comma-separated; empty reads
+	// everything from addr
+	replicaAddrs string
+	// replicaMaxLag takes a replica out of rotation while it is further
+	// behind the primary
+	replicaMaxLag        time.Duration
+	replicaCheckInterval time.Duration
+
+	queryStats queryStatsConfig
+
+	schemaCheckInterval time.Duration
 }
 
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5173")},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300, // Maximum value not ignored by any of major browsers
-	}))
-
-	if app.config.rateLimiter.Enabled {
-		r.Use(app.RateLimiterMiddleware)
+	registry := app.middlewareRegistry()
+	global, err := resolveMiddleware(registry, globalMiddleware)
+	if err != nil {
+		panic(err)
+	}
+	r.Use(global...)
+
+	r.With(app.requireFederation).Get("/.well-known/webfinger", app.webfingerHandler)
+
+	for _, version := range apiVersions {
+		r.Route("/"+version.name, func(r chi.Router) {
+			r.Use(version.middleware)
+			app.mountVersion(r, registry, version)
+		})
 	}
 
-	// Set a timeout value on the request context (ctx), that will signal
-	// through ctx.Done() that the request has timed out and further
-	// processing should be stopped.
-	r.Use(middleware.Timeout(60 * time.Second))
+	return r
+}
 
-	// Stricter rate limiter for auth endpoints (5 req / 60s)
-	authLimiter := ratelimiter.NewFixedWindowLimiter(5, time.Minute)
-	authLimiterMiddleware := app.buildRateLimiterMiddleware(authLimiter)
+// mountVersion registers the routes of one API version under r.
+func (app *application) mountVersion(r chi.Router, registry map[string]func(http.Handler) http.Handler, version apiVersion) {
+	// Operations
+	r.Get("/health", app.healthCheckHandler)
+	r.Get("/changelog", handle(app, http.StatusOK, app.changelogHandler))
+	r.Get("/version", handle(app, http.StatusOK, app.versionHandler))
+	r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
+	r.With(app.BasicAuthMiddleware()).Get("/debug/metrics", app.metricsHandler)
 
-	r.Route("/v1", func(r chi.Router) {
-		// Operations
-		r.Get("/health", app.healthCheckHandler)
-		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
+	docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
+	r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 
-		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
-		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
+	// Public invite validation
+	r.Get("/invites/{token}", app.getInviteHandler)
 
-		r.Route("/users", func(r chi.Router) {
+	app.mountGroups(r, registry, app.routeGroups(registry, version))
+}
+
+// routeGroups declares every route group of version. Their stacks are in
+// groupMiddleware; groups that mix public and protected routes attach
+// middleware per route.
+func (app *application) routeGroups(registry map[string]func(http.Handler) http.Handler, version apiVersion) []routeGroup {
+	auth := registry[mwAuth]
+	optionalAuth := registry[mwOptionalAuth]
+	authLimiter := registry[mwAuthRateLimit]
+	etag := registry[mwETag]
+	writeListings := app.requirePermission(store.PermissionListingsWrite)
+	replicaReads := registry[mwReplicaReads]
+
+	return []routeGroup{
+		{"/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/email-change/{token}", handle(app, http.StatusOK, app.confirmEmailChangeHandler))
+			r.Get("/username-available", handle(app, http.StatusOK, app.usernameAvailableHandler))
+			r.Get("/username-suggestions", handle(app, http.StatusOK, app.usernameSuggestionsHandler))
 
-			r.With(app.AuthTokenMiddleware).Get("/", app.getUserByEmailHandler)
+			r.With(auth).Get("/", app.getUserByEmailHandler)
+			r.With(auth).Post("/batch", handle(app, http.StatusOK, app.batchUsersHandler))
 
 			r.Route("/{userID}", func(r chi.Router) {
-				r.Use(app.AuthTokenMiddleware)
+				r.Use(auth)
 
-				r.Get("/", app.getUserHandler)
+				r.With(replicaReads, etag).Get("/", app.getUserHandler)
+				r.Put("/block", handle(app, http.StatusOK, app.blockUserHandler))
+				r.Delete("/block", handle(app, http.StatusOK, app.unblockUserHandler))
 			})
-		})
-
-		r.Route("/projects", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+		}},
+		{"/projects", func(r chi.Router) {
 			r.Post("/", app.createProjectHandler)
 			r.Get("/", app.listProjectsHandler)
 			r.Route("/{projectID}", func(r chi.Router) {
@@ -174,76 +551,192 @@ func (app *application) mount() http.Handler {
 				r.Patch("/", app.updateProjectHandler)
 				r.Delete("/", app.deleteProjectHandler)
 			})
-		})
-
-		r.Route("/listings", func(r chi.Router) {
-			r.Get("/", app.listListingsHandler)
-			r.Get("/{listingID}", app.getListingHandler)
-			r.With(app.AuthTokenMiddleware).Post("/", app.createListingHandler)
-			r.With(app.AuthTokenMiddleware).Patch("/{listingID}", app.updateListingHandler)
-			r.With(app.AuthTokenMiddleware).Delete("/{listingID}", app.deleteListingHandler)
-			r.With(app.AuthTokenMiddleware).Post("/{listingID}/media", app.uploadListingMediaHandler)
-			r.With(app.AuthTokenMiddleware).Delete("/{listingID}/media/{mediaID}", app.deleteListingMediaHandler)
-			r.With(app.AuthTokenMiddleware).Post("/{listingID}/applications", app.createApplicationHandler)
-		})
-
-		r.Route("/dashboard", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+		}},
+		{"/listings", func(r chi.Router) {
+			r.With(optionalAuth, replicaReads, etag).Get("/", app.listListingsHandler)
+			r.With(optionalAuth, replicaReads, etag).Get("/trending", handle(app, http.StatusOK, app.trendingListingsHandler))
+			r.With(replicaReads, etag).Get("/trending.rss", app.feedHandler(feedFormatRSS, app.trendingListingsFeed))
+			r.With(replicaReads, etag).Get("/trending.atom", app.feedHandler(feedFormatAtom, app.trendingListingsFeed))
+			r.With(optionalAuth, replicaReads, etag).Get("/{listingID}", app.getListingHandler)
+			r.With(optionalAuth, replicaReads, etag).Get("/{listingID}/history", handle(app, http.StatusOK, app.getListingHistoryHandler))
+			r.With(auth, writeListings).Post("/", app.createListingHandler)
+			r.With(auth, writeListings).Patch("/{listingID}", app.updateListingHandler)
+			r.With(auth, writeListings).Delete("/{listingID}", app.deleteListingHandler)
+			r.With(auth, writeListings).Post("/{listingID}/restore", handle(app, http.StatusOK, app.restoreListingHandler))
+			r.With(auth, writeListings).Post("/{listingID}/submit", app.submitListingHandler)
+			r.With(auth, writeListings).Put("/{listingID}/pin", handle(app, http.StatusOK, app.pinListingHandler))
+			r.With(auth, writeListings).Delete("/{listingID}/pin", handle(app, http.StatusOK, app.unpinListingHandler))
+			r.With(auth, writeListings).Post("/{listingID}/media", app.uploadListingMediaHandler)
+			r.With(auth, writeListings).Delete("/{listingID}/media/{mediaID}", app.deleteListingMediaHandler)
+			r.With(auth).Post("/{listingID}/applications", app.createApplicationHandler)
+			r.With(auth).Post("/{listingID}/report", handle(app, http.StatusCreated, app.reportListingHandler))
+			r.With(optionalAuth).Get("/{listingID}/events", handle(app, http.StatusOK, app.listListingEventsHandler))
+			r.With(auth, writeListings).Post("/{listingID}/events", handle(app, http.StatusCreated, app.createListingEventHandler))
+			r.With(auth, writeListings).Put("/{listingID}/events/{eventID}", handle(app, http.StatusOK, app.updateListingEventHandler))
+			r.With(auth, writeListings).Delete("/{listingID}/events/{eventID}", app.deleteListingEventHandler)
+		}},
+		{"/companies", func(r chi.Router) {
+			r.With(optionalAuth, replicaReads, etag).Get("/{companyID}/listings", handle(app, http.StatusOK, app.listCompanyListingsHandler))
+			r.With(replicaReads, etag).Get("/{companyID}/listings.rss", app.feedHandler(feedFormatRSS, app.companyListingsFeed))
+			r.With(replicaReads, etag).Get("/{companyID}/listings.atom", app.feedHandler(feedFormatAtom, app.companyListingsFeed))
+			r.With(replicaReads, etag).Get("/{companyID}/events.ics", app.companyCalendarHandler)
+		}},
+		{"/tags", func(r chi.Router) {
+			r.With(replicaReads).Get("/trending", handle(app, http.StatusOK, app.trendingTagsHandler))
+			r.With(optionalAuth, replicaReads, etag).Get("/{tag}/listings", app.listListingsHandler)
+		}},
+		{"/team", func(r chi.Router) {
+			r.Get("/members", handle(app, http.StatusOK, app.listTeamMembersHandler))
+			r.Patch("/members/{userID}", handle(app, http.StatusOK, app.updateTeamMemberHandler))
+			r.Delete("/members/{userID}", handle(app, http.StatusOK, app.removeTeamMemberHandler))
+			r.Post("/invites", handle(app, http.StatusCreated, app.inviteTeamMemberHandler))
+			r.Post("/join", handle(app, http.StatusOK, app.joinTeamHandler))
+			r.Get("/listings", handle(app, http.StatusOK, app.listTeamListingsHandler))
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Get("/", handle(app, http.StatusOK, app.listTeamWebhooksHandler))
+				r.Post("/", handle(app, http.StatusCreated, app.createTeamWebhookHandler))
+				r.Delete("/{webhookID}", handle(app, http.StatusOK, app.deleteTeamWebhookHandler))
+				r.Get("/{webhookID}/deliveries", handle(app, http.StatusOK, app.listTeamWebhookDeliveriesHandler))
+			})
+		}},
+		{"/dashboard", func(r chi.Router) {
 			r.Get("/overview", app.dashboardOverviewHandler)
-		})
-
-		r.Route("/favorites", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+			r.Get("/views", handle(app, http.StatusOK, app.dashboardViewsHandler))
+		}},
+		{"/favorites", func(r chi.Router) {
 			r.Get("/", app.listFavoritesHandler)
+			r.Get("/export", app.exportFavoritesHandler)
+			r.Get("/export/link", handle(app, http.StatusOK, app.favoritesExportLinkHandler))
 			r.Post("/{listingID}", app.addFavoriteHandler)
+			r.Put("/{listingID}", app.putFavoriteHandler)
 			r.Delete("/{listingID}", app.removeFavoriteHandler)
-		})
-
-		r.Route("/chats", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+		}},
+		{"/chats", func(r chi.Router) {
 			r.Get("/", app.listChatsHandler)
-		})
-
-		r.Route("/complaints", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+		}},
+		{"/conversations", func(r chi.Router) {
+			r.Get("/", handle(app, http.StatusOK, app.listConversationsHandler))
+			r.Post("/", handle(app, http.StatusOK, app.startConversationHandler))
+			r.Get("/unread", handle(app, http.StatusOK, app.unreadMessagesHandler))
+			r.Get("/{conversationID}/messages", handle(app, http.StatusOK, app.listDirectMessagesHandler))
+			r.Post("/{conversationID}/messages", handle(app, http.StatusCreated, app.createDirectMessageHandler))
+		}},
+		{"/events", func(r chi.Router) {
+			r.Get("/", app.eventStreamHandler)
+		}},
+		{"/complaints", func(r chi.Router) {
 			r.Post("/", app.createComplaintHandler)
-		})
-
-		r.Route("/users/me", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+		}},
+		{"/users/me", func(r chi.Router) {
 			r.Patch("/", app.updateProfileHandler)
-			r.Put("/password", app.changePasswordHandler)
-		})
-
-		r.Route("/applications", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
+			r.With(app.denyImpersonation).Put("/password", app.changePasswordHandler)
+
+			r.Get("/email", handle(app, http.StatusOK, app.getEmailChangeHandler))
+			r.With(app.denyImpersonation).Post("/email", handle(app, http.StatusAccepted, app.requestEmailChangeHandler))
+			r.With(app.denyImpersonation).Delete("/email", handle(app, http.StatusOK, app.cancelEmailChangeHandler))
+
+			r.Get("/usage", handle(app, http.StatusOK, app.getUsageHandler))
+			r.Get("/calendar", handle(app, http.StatusOK, app.calendarLinkHandler))
+
+			r.Get("/mentions", handle(app, http.StatusOK, app.listMentionsHandler))
+
+			r.Get("/email-window", handle(app, http.StatusOK, app.getDeliveryWindowHandler))
+			r.Put("/email-window", handle(app, http.StatusOK, app.setDeliveryWindowHandler))
+			r.Delete("/email-window", handle(app, http.StatusOK, app.deleteDeliveryWindowHandler))
+			r.Get("/email-tracking", handle(app, http.StatusOK, app.getEmailTrackingHandler))
+			r.Put("/email-tracking", handle(app, http.StatusOK, app.setEmailTrackingHandler))
+			r.Post("/contacts/match", handle(app, http.StatusOK, app.matchContactsHandler))
+			r.Post("/import", app.createContactImportHandler)
+			r.Get("/import/{importID}", handle(app, http.StatusOK, app.getContactImportHandler))
+
+			r.Get("/blocks", handle(app, http.StatusOK, app.listBlockedUsersHandler))
+
+			r.Get("/devices", handle(app, http.StatusOK, app.listPushDevicesHandler))
+			r.Post("/devices", handle(app, http.StatusCreated, app.registerPushDeviceHandler))
+			r.Get("/devices/config", handle(app, http.StatusOK, app.pushConfigHandler))
+			r.Delete("/devices/{deviceID}", app.deletePushDeviceHandler)
+
+			r.Get("/sessions", handle(app, http.StatusOK, app.listSessionsHandler))
+
+			r.Get("/invite-codes", handle(app, http.StatusOK, app.listUserInviteCodesHandler))
+			r.Post("/invite-codes", handle(app, http.StatusCreated, app.createUserInviteCodeHandler))
+		}},
+		{"/ap", func(r chi.Router) {
+			r.Use(app.requireFederation)
+
+			r.Get("/companies/{companyID}", app.companyActorHandler)
+			r.Post("/companies/{companyID}/inbox", app.companyInboxHandler)
+			r.Get("/companies/{companyID}/outbox", app.companyOutboxHandler)
+			r.Get("/companies/{companyID}/followers", app.companyFollowersHandler)
+			r.Get("/listings/{listingID}", app.listingNoteHandler)
+		}},
+		{"/applications", func(r chi.Router) {
 			r.Get("/", app.listApplicationsHandler)
 			r.Route("/{applicationID}", func(r chi.Router) {
 				r.Patch("/status", app.updateApplicationStatusHandler)
 				r.Get("/messages", app.listApplicationMessagesHandler)
 				r.Post("/messages", app.createApplicationMessageHandler)
 			})
-		})
-
+		}},
+		// Signed callbacks from mail providers
+		{"/webhooks", func(r chi.Router) {
+			r.Post("/mail/{provider}", app.mailWebhookHandler)
+		}},
+		// Links from notification emails
+		{"/unsubscribe", func(r chi.Router) {
+			r.Get("/{token}", handle(app, http.StatusOK, app.unsubscribeHandler))
+			r.Post("/{token}", handle(app, http.StatusOK, app.unsubscribeHandler))
+		}},
+		{"/meta", func(r chi.Router) {
+			r.Get("/countries", handle(app, http.StatusOK, app.countriesHandler))
+			r.Get("/limits", handle(app, http.StatusOK, app.contentLimitsHandler))
+		}},
+		{"/track", func(r chi.Router) {
+			r.Get("/open/{token}", app.trackOpenHandler)
+			r.Get("/click/{token}", app.trackClickHandler)
+		}},
+		{"/downloads", func(r chi.Router) {
+			r.Use(app.signedDownloadMiddleware)
+			r.Get("/favorites/{userID}", app.downloadFavoritesHandler)
+			r.Get("/calendars/{userID}.ics", app.downloadCalendarHandler)
+		}},
 		// Public routes
-		r.Route("/authentication", func(r chi.Router) {
-			r.With(authLimiterMiddleware).Post("/user", app.registerUserHandler)
-			r.With(authLimiterMiddleware).Post("/company", app.registerCompanyHandler)
-			r.With(authLimiterMiddleware).Post("/token", app.createTokenHandler)
-			r.With(authLimiterMiddleware).Post("/admin/token", app.createAdminTokenHandler)
+		{"/authentication", func(r chi.Router) {
+			r.With(authLimiter).Post("/user", app.registerUserHandler)
+			r.With(authLimiter).Post("/company", app.registerCompanyHandler)
+			r.With(authLimiter).Post("/token", app.createTokenHandler)
+			r.With(authLimiter).Post("/admin/token", app.createAdminTokenHandler)
+			r.With(authLimiter).Post("/magic-link", handle(app, http.StatusAccepted, app.requestMagicLinkHandler))
+			r.With(authLimiter).Get("/magic-link/{token}", handle(app, http.StatusOK, app.consumeMagicLinkHandler))
+			r.Get("/password-policy", handle(app, http.StatusOK, app.getPasswordPolicyHandler))
+			r.Get("/challenge", handle(app, http.StatusOK, app.botChallengeHandler))
+			r.With(app.BasicAuthMiddleware()).Post("/introspect", app.introspectTokenHandler)
 
 			// Protected auth routes
-			r.With(app.AuthTokenMiddleware).Get("/me", app.getCurrentUserHandler)
-		})
-
-		// Public invite validation
-		r.Get("/invites/{token}", app.getInviteHandler)
-
+			r.With(auth, etag).Get("/me", app.getCurrentUserHandler)
+			r.With(auth).Post("/revoke", app.revokeTokenHandler)
+		}},
+		// Moderation queue (admins and moderators)
+		{"/moderation", func(r chi.Router) {
+			review := app.requirePermission(store.PermissionComplaintsReview)
+			resolve := app.requirePermission(store.PermissionComplaintsResolve)
+			r.Route("/complaints", func(r chi.Router) {
+				r.With(review).Get("/", app.adminListComplaintsHandler)
+				r.With(review).Get("/{complaintID}", app.adminGetComplaintHandler)
+				r.With(resolve).Post("/{complaintID}/dismiss", app.dismissComplaintHandler)
+				r.With(resolve).Post("/{complaintID}/remove", app.removeReportedContentHandler)
+			})
+			r.With(review).Get("/listings/{listingID}/history", handle(app, http.StatusOK, app.moderationListingHistoryHandler))
+			r.With(review).Get("/flags", handle(app, http.StatusOK, app.listContentFlagsHandler))
+			r.With(resolve).Post("/flags/{flagID}/approve", handle(app, http.StatusOK, app.approveContentFlagHandler))
+			r.With(resolve).Post("/flags/{flagID}/remove", handle(app, http.StatusOK, app.removeContentFlagHandler))
+
+			mute := app.requirePermission(store.PermissionUsersMute)
+			r.With(mute).Put("/users/{userID}/mute", app.muteUserHandler)
+			r.With(mute).Delete("/users/{userID}/mute", app.unmuteUserHandler)
+		}},
 		// Admin routes
-		r.Route("/admin", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
-			r.Use(app.adminOnlyMiddleware)
-
+		{"/admin", func(r chi.Router) {
 			r.Route("/companies", func(r chi.Router) {
 				r.Get("/", app.listCompaniesHandler)
 				r.Route("/{companyID}", func(r chi.Router) {
@@ -260,13 +753,20 @@ func (app *application) mount() http.Handler {
 			r.Route("/complaints", func(r chi.Router) {
 				r.Get("/", app.adminListComplaintsHandler)
 				r.Get("/{complaintID}", app.adminGetComplaintHandler)
-				r.Patch("/{complaintID}/status", app.adminUpdateComplaintStatusHandler)
+				if version.name == "v1" {
+					r.With(deprecations.middleware("PATCH /v1/admin/complaints/{complaintID}/status")).Patch("/{complaintID}/status", app.adminUpdateComplaintStatusHandler)
+				}
 			})
 
 			r.Route("/users", func(r chi.Router) {
 				r.Get("/", app.adminListUsersHandler)
-				r.Patch("/{userID}/status", app.adminUpdateUserStatusHandler)
+				if version.name == "v1" {
+					r.With(deprecations.middleware("PATCH /v1/admin/users/{userID}/status")).Patch("/{userID}/status", app.adminUpdateUserStatusHandler)
+				}
+				r.Patch("/{userID}/state", handle(app, http.StatusOK, app.adminUpdateUserStateHandler))
+				r.Get("/{userID}/state-events", handle(app, http.StatusOK, app.adminUserStateHistoryHandler))
 				r.Patch("/{userID}/role", app.adminUpdateUserRoleHandler)
+				r.Post("/{userID}/impersonate", handle(app, http.StatusCreated, app.adminImpersonateUserHandler))
 			})
 
 			r.Route("/stats", func(r chi.Router) {
@@ -274,13 +774,94 @@ func (app *application) mount() http.Handler {
 				r.Get("/activity", app.adminStatsActivityHandler)
 			})
 
-			r.Get("/logs", app.adminListLogsHandler)
+			r.Route("/broadcasts", func(r chi.Router) {
+				r.Get("/", handle(app, http.StatusOK, app.adminListBroadcastsHandler))
+				r.Post("/", handle(app, http.StatusCreated, app.adminCreateBroadcastHandler))
+				r.Get("/{broadcastID}", handle(app, http.StatusOK, app.adminGetBroadcastHandler))
+				r.Post("/{broadcastID}/pause", handle(app, http.StatusOK, app.adminPauseBroadcastHandler))
+				r.Post("/{broadcastID}/resume", handle(app, http.StatusOK, app.adminResumeBroadcastHandler))
+			})
+
+			// deployment-wide settings, queues and logs are left to the
+			// operators in the default tenant
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireDefaultTenantMiddleware)
 
-			r.Post("/invites", app.createInviteHandler)
-		})
-	})
+				r.Route("/jobs", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.adminListJobsHandler))
+					r.Get("/{jobID}", handle(app, http.StatusOK, app.adminGetJobHandler))
+					r.Post("/{jobID}/retry", handle(app, http.StatusOK, app.adminRetryJobHandler))
+				})
 
-	return r
+				r.Route("/moderation-jobs", func(r chi.Router) {
+					r.Post("/", handle(app, http.StatusAccepted, app.adminCreateModerationJobHandler))
+					r.Get("/{jobID}", handle(app, http.StatusOK, app.adminGetModerationJobHandler))
+				})
+
+				r.Get("/logs", app.adminListLogsHandler)
+				r.Get("/errors/{errorID}", handle(app, http.StatusOK, app.getServerErrorHandler))
+				r.Route("/debug-captures", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.adminListDebugCapturesHandler))
+					r.Delete("/", app.adminClearDebugCapturesHandler)
+					r.Post("/token", handle(app, http.StatusCreated, app.adminCreateDebugCaptureTokenHandler))
+					r.Post("/users/{userID}", handle(app, http.StatusOK, app.adminWatchUserHandler))
+					r.Delete("/users/{userID}", app.adminUnwatchUserHandler)
+				})
+
+				r.Route("/banned-words", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.adminListBannedWordsHandler))
+					r.Post("/", handle(app, http.StatusCreated, app.adminAddBannedWordHandler))
+					r.Delete("/{wordID}", handle(app, http.StatusOK, app.adminDeleteBannedWordHandler))
+				})
+
+				r.Route("/email-suppressions", func(r chi.Router) {
+					r.Get("/", app.adminListEmailSuppressionsHandler)
+					r.Post("/", handle(app, http.StatusCreated, app.adminCreateEmailSuppressionHandler))
+					r.Delete("/{email}", app.adminDeleteEmailSuppressionHandler)
+				})
+				r.Get("/sent-emails", app.adminListSentEmailsHandler)
+				r.Route("/dead-letters", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.adminListDeadLettersHandler))
+					r.Get("/{deadLetterID}", handle(app, http.StatusOK, app.adminGetDeadLetterHandler))
+					r.Post("/{deadLetterID}/retry", handle(app, http.StatusOK, app.adminRetryDeadLetterHandler))
+					r.Delete("/{deadLetterID}", handle(app, http.StatusOK, app.adminDiscardDeadLetterHandler))
+				})
+				r.Get("/email-tracking", handle(app, http.StatusOK, app.adminEmailTrackingStatsHandler))
+				r.Get("/deprecations", handle(app, http.StatusOK, app.deprecationReportHandler))
+				r.Get("/read-only", handle(app, http.StatusOK, app.getReadOnlyHandler))
+				r.Put("/read-only", handle(app, http.StatusOK, app.setReadOnlyHandler))
+				r.Get("/maintenance", handle(app, http.StatusOK, app.getMaintenanceHandler))
+				r.Put("/maintenance", handle(app, http.StatusOK, app.setMaintenanceHandler))
+
+				r.Post("/invites", app.createInviteHandler)
+
+				r.Get("/permissions", handle(app, http.StatusOK, app.listPermissionsHandler))
+				r.Route("/roles", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.listRolesHandler))
+					r.Post("/", handle(app, http.StatusCreated, app.createRoleHandler))
+					r.Put("/{roleID}/permissions", handle(app, http.StatusOK, app.setRolePermissionsHandler))
+				})
+
+				r.Route("/webhooks", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.adminListWebhooksHandler))
+					r.Post("/", handle(app, http.StatusCreated, app.adminCreateWebhookHandler))
+					r.Delete("/{webhookID}", handle(app, http.StatusOK, app.adminDeleteWebhookHandler))
+					r.Get("/{webhookID}/deliveries", handle(app, http.StatusOK, app.adminListWebhookDeliveriesHandler))
+				})
+
+				r.Route("/invite-codes", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.adminListInviteCodesHandler))
+					r.Post("/", handle(app, http.StatusCreated, app.adminCreateInviteCodeHandler))
+					r.Delete("/{code}", handle(app, http.StatusOK, app.adminRevokeInviteCodeHandler))
+				})
+
+				r.Route("/tenants", func(r chi.Router) {
+					r.Get("/", handle(app, http.StatusOK, app.adminListTenantsHandler))
+					r.Post("/", handle(app, http.StatusCreated, app.adminCreateTenantHandler))
+				})
+			})
+		}},
+	}
 }
 
 func (app *application) run(mux http.Handler) error {
@@ -292,7 +873,7 @@ func (app *application) run(mux http.Handler) error {
 	srv := &http.Server{
 		Addr:         app.config.addr,
 		Handler:      mux,
-		WriteTimeout: time.Second * 30,
+		WriteTimeout: app.writeTimeout(),
 		ReadTimeout:  time.Second * 10,
 		IdleTimeout:  time.Minute,
 	}
@@ -310,7 +891,23 @@ func (app *application) run(mux http.Handler) error {
 
 		app.logger.Infow("signal caught", "signal", s.String())
 
-		shutdown <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+		if app.traceExporter != nil {
+			if traceErr := app.traceExporter.Shutdown(ctx); traceErr != nil {
+				app.logger.Warnw("spans not exported", "error", traceErr)
+			}
+		}
+		if app.eventPublisher != nil {
+			if eventErr := app.eventPublisher.Shutdown(ctx); eventErr != nil {
+				app.logger.Warnw("events not published", "error", eventErr)
+			}
+		}
+		if app.jobs != nil {
+			if jobErr := app.jobs.Shutdown(ctx); jobErr != nil {
+				app.logger.Warnw("jobs still running at shutdown are taken over after their lease", "error", jobErr)
+			}
+		}
+		shutdown <- err
 	}()
 
 	app.logger.Infow("server has started", "addr", app.config.addr, "env", app.config.env)
@@ -329,4 +926,3 @@ func (app *application) run(mux http.Handler) error {
 
 	return nil
 }
-
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,3 +56,128 @@ func TestRateLimiterMiddleware(t *testing.T) {
 	}
 }
 
+func TestHealthCheckReportsPool(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.dbStats = func() sql.DBStats {
+		return sql.DBStats{MaxOpenConnections: 30, OpenConnections: 4, InUse: 3, Idle: 1, WaitCount: 2, WaitDuration: 1500 * time.Millisecond}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+	rr := executeRequest(req, app.mount())
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var body struct {
+		Data struct {
+			Database dbPoolStats `json:"database"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	want := dbPoolStats{MaxOpen: 30, Open: 4, InUse: 3, Idle: 1, WaitCount: 2, WaitDurationMs: 1500}
+	if body.Data.Database != want {
+		t.Errorf("got %+v, want %+v", body.Data.Database, want)
+	}
+}
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{addr: ":8080"})
+	mux := app.mount()
+
+	app.readOnly.Store(true)
+
+	t.Run("should serve reads", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should reject writes", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/user", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	t.Run("should let admins sign in", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/admin/token", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		if rr.Code == http.StatusServiceUnavailable {
+			t.Errorf("the admin token endpoint answered %d", rr.Code)
+		}
+	})
+}
+
+func TestParseRouteMiddleware(t *testing.T) {
+	overrides, err := parseRouteMiddleware("/admin=auth, admin,timeout=120s; /listings=timeout=5s,body_limit=8MB")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := overrides["/admin"]; len(got) != 3 || got[2] != "timeout=120s" {
+		t.Errorf("unexpected /admin stack %v", got)
+	}
+
+	for _, value := range []string{"/admin=auth,superuser", "/admin=timeout=soon", "admin=auth", "/listings=body_limit=lots",
+		"/admin=timeout=120s", "/admin=auth", "/admin=admin,auth", "/moderation=auth,moderator"} {
+		if _, err := parseRouteMiddleware(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+
+	// a guard may be added, to a group without one too
+	if _, err := parseRouteMiddleware("/listings=auth;/moderation=auth,staff,admin"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRouteMiddlewareKeepsAdminProtected(t *testing.T) {
+	app := newTestApplication(t, config{routeMiddleware: "/admin=timeout=120s"})
+	mux := app.mount()
+
+	rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/admin/maintenance", nil), mux)
+
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{maintenance: maintenanceConfig{retryAfter: 2 * time.Minute}})
+	mux := app.mount()
+
+	app.maintenance.Store(true)
+
+	t.Run("should serve health checks", func(t *testing.T) {
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/health", nil), mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should reject other routes", func(t *testing.T) {
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/listings", nil), mux)
+
+		checkResponseCode(t, http.StatusServiceUnavailable, rr.Code)
+		if got := rr.Header().Get("Retry-After"); got != "120" {
+			t.Errorf("got Retry-After %q, want 120", got)
+		}
+	})
+
+	t.Run("should let admin routes through", func(t *testing.T) {
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/admin/maintenance", nil), mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+}
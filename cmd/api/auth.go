@@ -1,30 +1,40 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
-	"net/url"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/country"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 )
 
 type RegisterUserPayload struct {
+	// Username is generated from the name when omitted
+	Username             string `json:"username,omitempty" validate:"omitempty,username"`
 	FirstName            string `json:"first_name" validate:"required,max=100,name"`
 	LastName             string `json:"last_name" validate:"required,max=100,name"`
 	Email                string `json:"email" validate:"required,max=255,email_regex"`
 	Phone                string `json:"phone" validate:"required,max=20"`
-	Password             string `json:"password" validate:"required,min=8,max=72,password"`
+	Password             string `json:"password" validate:"required,max=72,password"`
 	PasswordConfirmation string `json:"password_confirmation" validate:"required,eqfield=Password"`
+	// Country is an ISO 3166-1 alpha-2 code or country name, stored as the
+	// code; GeoIP fills it in when omitted
+	Country string `json:"country,omitempty" validate:"omitempty,max=100,country"`
+	// InviteCode is required while AUTH_INVITE_ONLY is on and ignored otherwise
+	InviteCode string `json:"invite_code,omitempty" validate:"omitempty,max=40"`
+	// ChallengeToken answers GET /authentication/challenge when BOT_CHECK_PROVIDER is set
+	ChallengeToken string `json:"challenge_token,omitempty" validate:"omitempty,max=4096"`
 }
 
 type RegisterCompanyPayload struct {
@@ -32,6 +42,7 @@ type RegisterCompanyPayload struct {
 	CompanyName        string `json:"company_name" validate:"required,max=255"`
 	RegistrationNumber string `json:"registration_number" validate:"required,max=50"`
 	City               string `json:"city" validate:"required,max=100"`
+	Country            string `json:"country,omitempty" validate:"omitempty,max=100,country"`
 	CompanyEmail       string `json:"company_email" validate:"required,max=255,email_regex"`
 	CompanyPhone       string `json:"company_phone" validate:"required,max=20"`
 	CompanyType        string `json:"company_type" validate:"required,oneof=agency developer"`
@@ -42,7 +53,7 @@ type RegisterCompanyPayload struct {
 	JobTitle  string `json:"job_title" validate:"required,max=100"`
 
 	// Security
-	Password             string `json:"password" validate:"required,min=8,max=72,password"`
+	Password             string `json:"password" validate:"required,max=72,password"`
 	PasswordConfirmation string `json:"password_confirmation" validate:"required,eqfield=Password"`
 
 	// Optional invite token
@@ -51,19 +62,22 @@ type RegisterCompanyPayload struct {
 
 type UserWithToken struct {
 	*store.User
-	Token string `json:"token"`
+	// Token is the activation token; empty when activation is turned off
+	Token string `json:"token,omitempty"`
 }
 
 // registerUserHandler godoc
 //
 //	@Summary		Registers a user
-//	@Description	Registers a user
+//	@Description	Registers a user. With AUTH_HIDE_EXISTING_ACCOUNTS every registration answers 201 with a message only, and the owner of a taken email is notified instead.
 //	@Tags			authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		RegisterUserPayload	true	"User credentials"
+//	@Param			client	query		string				false	"Client the activation link opens, from ACTIVATION_LINKS; web by default"
 //	@Success		201		{object}	UserWithToken		"User registered"
 //	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/authentication/user [post]
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -72,133 +86,219 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	payload.Username = service.NormalizeUsername(payload.Username)
 
 	if err := Validate.Struct(payload); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	payload.Country, _ = country.Normalize(payload.Country)
 
-	username := generateUsername(payload.FirstName, payload.LastName, payload.Email)
-
-	user := &store.User{
-		Username:  username,
-		FirstName: payload.FirstName,
-		LastName:  payload.LastName,
-		Email:     payload.Email,
-		Phone:     payload.Phone,
-		Role: store.Role{
-			Name: store.RoleUser,
-		},
+	client, err := app.activationClient(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
-	// hash the user password
-	if err := user.Password.Set(payload.Password); err != nil {
-		app.internalServerError(w, r, err)
+	if !app.checkBot(w, r, payload.ChallengeToken) {
 		return
 	}
 
-	ctx := r.Context()
+	address, err := app.checkEmail(r.Context(), payload.Email)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	payload.Email = address
 
-	plainToken := uuid.New().String()
+	if !app.checkPasswordBreach(w, r, payload.Password) {
+		return
+	}
 
-	// hash the token for storage but keep the plain token for email
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
+	invite, err := app.reserveInviteCode(r.Context(), payload.InviteCode)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
 
-	// retry a few times if we generated a username that collides
-	for attempt := 0; attempt < 5; attempt++ {
-		err := app.store.Users.CreateAndInvite(ctx, user, hashToken, app.config.mail.exp)
-		if err == nil {
-			break
-		}
+	in := service.NewUser{
+		Username:  payload.Username,
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Email:     payload.Email,
+		Phone:     payload.Phone,
+		Country:   payload.Country,
+		Password:  payload.Password,
+	}
+	if in.Country == "" {
+		in.Country = geoIPCountry(r)
+	}
+	in = withCountryDefaults(in)
 
-		switch err {
-		case store.ErrDuplicateEmail:
-			app.badRequestResponse(w, r, err)
-			return
-		case store.ErrDuplicateUsername:
-			user.Username = generateUsername(payload.FirstName, payload.LastName, payload.Email)
-			continue
-		default:
-			app.internalServerError(w, r, err)
+	ctx := r.Context()
+	registration, err := app.authService(client, requestLocale(r)).RegisterUser(ctx, in)
+	if err != nil {
+		app.settleInviteCode(invite, nil)
+		if app.hideExistingAccount(w, r, in.Email, err) {
 			return
 		}
+		app.registrationError(w, r, err)
+		return
+	}
+	user := registration.User
+	app.settleInviteCode(invite, user)
+	app.publishUserRegistered(ctx, user)
+	if registration.Token == "" {
+		// created active, so there is no activation email queued with the
+		// user; send the account ready one instead
+		go app.queueAccountReadyEmail(*user, requestLocale(r))
 	}
 
-	// If we exhausted retries, CreateAndInvite would have returned ErrDuplicateUsername
-	// on the final attempt and we'd have continued, so we need an explicit check here.
-	// The simplest signal: user.ID is set only on success.
-	if user.ID == 0 {
-		app.badRequestResponse(w, r, store.ErrDuplicateUsername)
+	if app.config.auth.hideExistingAccounts {
+		app.registrationAccepted(w, r)
 		return
 	}
 
-	userWithToken := UserWithToken{
-		User:  user,
-		Token: plainToken,
+	if err := app.jsonResponse(w, http.StatusCreated, UserWithToken{User: user, Token: registration.Token}); err != nil {
+		app.internalServerError(w, r, err)
 	}
-	activationURL := app.buildActivationURL(plainToken)
+}
 
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
+// registrationError answers a registration the store refused.
+func (app *application) registrationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrDuplicateEmail), errors.Is(err, store.ErrDuplicatePhone),
+		errors.Is(err, store.ErrDuplicateCompanyEmail), errors.Is(err, store.ErrDuplicateRegistrationNumber),
+		errors.Is(err, service.ErrUsernameInvalid), errors.Is(err, service.ErrUsernameReserved), errors.Is(err, service.ErrUsernameBanned):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, store.ErrDuplicateUsername):
+		app.conflictResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
 	}
+}
 
-	// send mail
-	status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
+// registrationAccepted is the answer to every registration while
+// AUTH_HIDE_EXISTING_ACCOUNTS is on, so a taken email or phone cannot be
+// told apart from a new account.
+func (app *application) registrationAccepted(w http.ResponseWriter, r *http.Request) {
+	response := map[string]string{"message": "check your email to continue"}
+	if err := app.jsonResponse(w, http.StatusCreated, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
 
-		if !isProdEnv {
-			app.logger.Warnw("email delivery failed in non-production; registration continues", "user_id", user.ID, "email", user.Email)
-			if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
-				app.internalServerError(w, r, err)
-			}
-			return
-		}
+// hideExistingAccount answers a registration that failed on a taken email
+// or phone like a successful one, and emails the owner of the address about
+// the attempt instead. It reports whether it wrote the response.
+func (app *application) hideExistingAccount(w http.ResponseWriter, r *http.Request, address string, err error) bool {
+	if !app.config.auth.hideExistingAccounts || (!errors.Is(err, store.ErrDuplicateEmail) && !errors.Is(err, store.ErrDuplicatePhone)) {
+		return false
+	}
 
-		// rollback user creation if email fails (SAGA pattern)
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
+	go app.queueRegistrationAttemptEmail(address)
+	app.registrationAccepted(w, r)
+	return true
+}
 
-		app.internalServerError(w, r, err)
+// queueRegistrationAttemptEmail tells the owner of address, if there is
+// one, that someone tried to register with it. A registration that only
+// reused a phone number mails no one.
+func (app *application) queueRegistrationAttemptEmail(address string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := app.store.Users.GetByEmail(ctx, address)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			app.logger.Errorw("could not look up registration attempt owner", "error", err)
+		}
 		return
 	}
 
-	app.logger.Infow("Email sent", "status code", status)
+	data, err := json.Marshal(struct {
+		Username string
+		LoginURL string
+	}{
+		Username: user.Username,
+		LoginURL: strings.TrimRight(app.config.frontendURL, "/") + "/login",
+	})
+	if err != nil {
+		app.logger.Errorw("could not build registration attempt email", "user_id", user.ID, "error", err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
-		app.internalServerError(w, r, err)
+	err = app.store.Outbox.Enqueue(ctx, &store.OutboxEmail{
+		Template:    localizedTemplate(mailer.RegistrationAttemptTemplate, userLocale(user)),
+		Username:    user.Username,
+		Email:       user.Email,
+		Data:        data,
+		TriggeredBy: selfService(user.ID),
+	})
+	if err != nil {
+		app.logger.Errorw("could not queue registration attempt email", "user_id", user.ID, "error", err)
 	}
 }
 
-var usernameNonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
-
-func generateUsername(firstName, lastName, email string) string {
-	base := strings.TrimSpace(strings.ToLower(firstName + "." + lastName))
-	base = usernameNonAlnum.ReplaceAllString(base, "")
-	if base == "" {
-		base = strings.ToLower(strings.Split(email, "@")[0])
-		base = usernameNonAlnum.ReplaceAllString(base, "")
+func (app *application) queueAccountReadyEmail(user store.User, locale string) {
+	data, err := json.Marshal(struct {
+		Username string
+		LoginURL string
+	}{
+		Username: user.Username,
+		LoginURL: strings.TrimRight(app.config.frontendURL, "/") + "/login",
+	})
+	if err != nil {
+		app.logger.Errorw("could not build welcome email", "user_id", user.ID, "error", err)
+		return
 	}
 
-	if base == "" {
-		return uuid.New().String()[:12]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = app.store.Outbox.Enqueue(ctx, &store.OutboxEmail{
+		Template:    localizedTemplate(mailer.AccountReadyTemplate, locale),
+		Username:    user.Username,
+		Email:       user.Email,
+		Data:        data,
+		TriggeredBy: selfService(user.ID),
+	})
+	if err != nil {
+		app.logger.Errorw("could not queue welcome email", "user_id", user.ID, "error", err)
 	}
+}
+
+// welcomeEmail builds the activation email queued alongside a new user,
+// with the link for client, in locale.
+func (app *application) welcomeEmail(client, locale string) func(*store.User, string) (*store.OutboxEmail, error) {
+	return func(user *store.User, plainToken string) (*store.OutboxEmail, error) {
+		vars := struct {
+			Username      string
+			ActivationURL string
+		}{
+			Username:      user.Username,
+			ActivationURL: app.activationURL(client, plainToken),
+		}
 
-	// keep it reasonably short
-	if len(base) > 20 {
-		base = base[:20]
+		data, err := json.Marshal(vars)
+		if err != nil {
+			return nil, err
+		}
+
+		return &store.OutboxEmail{
+			Template:    localizedTemplate(mailer.UserWelcomeTemplate, locale),
+			Username:    user.Username,
+			Email:       user.Email,
+			Data:        data,
+			TriggeredBy: selfService(user.ID),
+		}, nil
 	}
+}
 
-	// add a small suffix to reduce collisions
-	suffix := uuid.New().String()[:6]
-	return base + suffix
+// selfService attributes an email sent on an anonymous request, such as
+// registration, to the account it was sent for.
+func selfService(userID int64) store.Principal {
+	return store.Principal{Kind: store.PrincipalUser, ID: userID}
 }
 
 // LoginResponse is returned on successful login
@@ -207,15 +307,65 @@ type LoginResponse struct {
 	User  *store.User `json:"user"`
 }
 
+// CreateUserTokenPayload takes the login in identifier, either a username or
+// an email. email is still accepted for clients that predate identifier.
 type CreateUserTokenPayload struct {
-	Email    string `json:"email" validate:"required,max=255,email_regex"`
-	Password string `json:"password" validate:"required,min=3,max=72"`
+	Identifier string `json:"identifier" validate:"required_without=Email,max=255"`
+	Email      string `json:"email" validate:"required_without=Identifier,omitempty,max=255,email_regex"`
+	Password   string `json:"password" validate:"required,min=3,max=72"`
+}
+
+func (p *CreateUserTokenPayload) login() string {
+	if identifier := strings.TrimSpace(p.Identifier); identifier != "" {
+		return identifier
+	}
+	return p.Email
+}
+
+var (
+	dummyPasswordOnce sync.Once
+	dummyPasswordUser store.User
+)
+
+// compareDummyPassword spends the same bcrypt work as a real comparison so
+// that unknown identifiers cannot be told apart by response time.
+func compareDummyPassword(text string) {
+	dummyPasswordOnce.Do(func() {
+		_ = dummyPasswordUser.Password.Set(uuid.New().String())
+	})
+	_ = dummyPasswordUser.Password.Compare(text)
+}
+
+// authenticateLogin looks the user up by username or email and checks the
+// password, logging the attempt. Unknown users and wrong passwords both
+// return store.ErrNotFound.
+func (app *application) authenticateLogin(r *http.Request, payload *CreateUserTokenPayload) (*store.User, error) {
+	login := payload.login()
+
+	user, err := app.getUserByLogin(r.Context(), login)
+	if err != nil {
+		compareDummyPassword(payload.Password)
+		_ = app.logLoginEvent(r, nil, login, false)
+		return nil, err
+	}
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		_ = app.logLoginEvent(r, &user.ID, user.Email, false)
+		return nil, store.ErrNotFound
+	}
+
+	if user.PendingActivation() && app.config.auth.strictActivation {
+		_ = app.logLoginEvent(r, &user.ID, user.Email, false)
+		return nil, store.ErrNotFound
+	}
+
+	return user, nil
 }
 
 // createTokenHandler godoc
 //
 //	@Summary		User login
-//	@Description	Authenticates a user (any role) and returns a JWT token with user info
+//	@Description	Authenticates a user (any role) by username or email and returns a JWT token with user info
 //	@Tags			authentication
 //	@Accept			json
 //	@Produce		json
@@ -237,28 +387,20 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	user, err := app.authenticateLogin(r, &payload)
 	if err != nil {
-		switch err {
-		case store.ErrNotFound:
-			_ = app.logLoginEvent(r, nil, payload.Email, false)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
 			app.unauthorizedErrorResponse(w, r, err)
 		default:
-			_ = app.logLoginEvent(r, nil, payload.Email, false)
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
 
-	if err := user.Password.Compare(payload.Password); err != nil {
-		_ = app.logLoginEvent(r, &user.ID, payload.Email, false)
-		app.unauthorizedErrorResponse(w, r, err)
-		return
-	}
+	app.logSuccessfulLogin(r, user)
 
-	_ = app.logLoginEvent(r, &user.ID, payload.Email, true)
-
-	token, err := app.generateToken(user.ID)
+	token, err := app.generateToken(user)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -300,35 +442,28 @@ func (app *application) createAdminTokenHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
+	user, err := app.authenticateLogin(r, &payload)
 	if err != nil {
-		switch err {
-		case store.ErrNotFound:
-			_ = app.logLoginEvent(r, nil, payload.Email, false)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
 			app.unauthorizedErrorResponse(w, r, err)
 		default:
-			_ = app.logLoginEvent(r, nil, payload.Email, false)
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
 
-	// Only admin and moderator roles are allowed
+	// Only admin and moderator roles are allowed. Checked after the password
+	// so the 403 does not reveal which accounts are staff.
 	if user.Role.Name != store.RoleAdmin && user.Role.Name != store.RoleModerator {
-		_ = app.logLoginEvent(r, &user.ID, payload.Email, false)
+		_ = app.logLoginEvent(r, &user.ID, user.Email, false)
 		app.forbiddenResponse(w, r)
 		return
 	}
 
-	if err := user.Password.Compare(payload.Password); err != nil {
-		_ = app.logLoginEvent(r, &user.ID, payload.Email, false)
-		app.unauthorizedErrorResponse(w, r, err)
-		return
-	}
-
-	_ = app.logLoginEvent(r, &user.ID, payload.Email, true)
+	app.logSuccessfulLogin(r, user)
 
-	token, err := app.generateToken(user.ID)
+	token, err := app.generateToken(user)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -361,17 +496,8 @@ func (app *application) getCurrentUserHandler(w http.ResponseWriter, r *http.Req
 	}
 }
 
-func (app *application) generateToken(userID int64) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": app.config.auth.token.iss,
-		"aud": app.config.auth.token.iss,
-	}
-
-	return app.authenticator.GenerateToken(claims)
+func (app *application) generateToken(user *store.User) (string, error) {
+	return app.authenticator.GenerateToken(app.config.auth.token.tokenClaims(user, time.Now()))
 }
 
 // registerCompanyHandler godoc
@@ -382,8 +508,10 @@ func (app *application) generateToken(userID int64) (string, error) {
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		RegisterCompanyPayload	true	"Company and contact person credentials"
+//	@Param			client	query		string					false	"Client the activation link opens, from ACTIVATION_LINKS; web by default"
 //	@Success		201		{object}	UserWithToken			"Company and user registered"
 //	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
 //	@Router			/authentication/company [post]
 func (app *application) registerCompanyHandler(w http.ResponseWriter, r *http.Request) {
@@ -397,6 +525,24 @@ func (app *application) registerCompanyHandler(w http.ResponseWriter, r *http.Re
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	payload.Country, _ = country.Normalize(payload.Country)
+
+	client, err := app.activationClient(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	address, err := app.checkEmail(r.Context(), payload.CompanyEmail)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	payload.CompanyEmail = address
+
+	if !app.checkPasswordBreach(w, r, payload.Password) {
+		return
+	}
 
 	ctx := r.Context()
 
@@ -406,8 +552,8 @@ func (app *application) registerCompanyHandler(w http.ResponseWriter, r *http.Re
 		var err error
 		invite, err = app.store.Invites.GetByToken(ctx, payload.InviteToken)
 		if err != nil {
-			switch err {
-			case store.ErrInviteNotFound:
+			switch {
+			case errors.Is(err, store.ErrInviteNotFound):
 				app.notFoundResponse(w, r, err)
 			default:
 				app.internalServerError(w, r, err)
@@ -425,6 +571,11 @@ func (app *application) registerCompanyHandler(w http.ResponseWriter, r *http.Re
 			return
 		}
 
+		if invite.CompanyID != nil {
+			app.badRequestResponse(w, r, errors.New("this invite is for joining a team, accept it with POST /v1/team/join"))
+			return
+		}
+
 		if invite.CompanyType != payload.CompanyType {
 			app.badRequestResponse(w, r, fmt.Errorf("company_type mismatch: token is for %q", invite.CompanyType))
 			return
@@ -435,63 +586,29 @@ func (app *application) registerCompanyHandler(w http.ResponseWriter, r *http.Re
 		Name:               payload.CompanyName,
 		RegistrationNumber: payload.RegistrationNumber,
 		City:               payload.City,
+		Country:            payload.Country,
 		Email:              payload.CompanyEmail,
 		Phone:              payload.CompanyPhone,
 		Type:               payload.CompanyType,
 	}
+	if company.Country == "" {
+		company.Country = geoIPCountry(r)
+	}
 
-	username := generateUsername(payload.FirstName, payload.LastName, payload.CompanyEmail)
-
-	user := &store.User{
-		Username:  username,
+	registration, err := app.authService(client, requestLocale(r)).RegisterCompany(ctx, company, withCountryDefaults(service.NewUser{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.CompanyEmail,
 		Phone:     payload.CompanyPhone,
+		Country:   company.Country,
 		JobTitle:  payload.JobTitle,
-		Role: store.Role{
-			Name: payload.CompanyType, // "agency" or "developer"
-		},
-	}
-
-	if err := user.Password.Set(payload.Password); err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
-
-	plainToken := uuid.New().String()
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-
-	for attempt := 0; attempt < 5; attempt++ {
-		err := app.store.Users.CreateCompanyAndUser(ctx, company, user, hashToken, app.config.mail.exp)
-		if err == nil {
-			break
-		}
-
-		switch err {
-		case store.ErrDuplicateEmail:
-			app.badRequestResponse(w, r, err)
-			return
-		case store.ErrDuplicateCompanyEmail:
-			app.badRequestResponse(w, r, err)
-			return
-		case store.ErrDuplicateRegistrationNumber:
-			app.badRequestResponse(w, r, err)
-			return
-		case store.ErrDuplicateUsername:
-			user.Username = generateUsername(payload.FirstName, payload.LastName, payload.CompanyEmail)
-			continue
-		default:
-			app.internalServerError(w, r, err)
-			return
-		}
-	}
-
-	if user.ID == 0 {
-		app.badRequestResponse(w, r, store.ErrDuplicateUsername)
+		Password:  payload.Password,
+	}))
+	if err != nil {
+		app.registrationError(w, r, err)
 		return
 	}
+	user := registration.User
 
 	// Mark invite token as used if it was provided
 	if invite != nil {
@@ -500,76 +617,41 @@ func (app *application) registerCompanyHandler(w http.ResponseWriter, r *http.Re
 			return
 		}
 	}
+	app.publishUserRegistered(ctx, user)
 
-	userWithToken := UserWithToken{
-		User:  user,
-		Token: plainToken,
-	}
-	activationURL := app.buildActivationURL(plainToken)
-
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
-	status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
-
-		if !isProdEnv {
-			app.logger.Warnw("email delivery failed in non-production; registration continues", "user_id", user.ID, "email", user.Email, "company_id", company.ID)
-			if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
-				app.internalServerError(w, r, err)
-			}
-			return
-		}
-
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
-
+	if err := app.jsonResponse(w, http.StatusCreated, UserWithToken{User: user, Token: registration.Token}); err != nil {
 		app.internalServerError(w, r, err)
-		return
 	}
+}
+
+func (app *application) logLoginEvent(r *http.Request, userID *int64, email string, success bool) error {
+	return app.store.LoginEvents.Create(r.Context(), newLoginEvent(r, userID, email, success))
+}
 
-	app.logger.Infow("Email sent", "status code", status)
+// logSuccessfulLogin records a login that issues a token, first alerting
+// the user when it comes from a new country or device.
+func (app *application) logSuccessfulLogin(r *http.Request, user *store.User) {
+	event := newLoginEvent(r, &user.ID, user.Email, true)
+	app.alertNewSignIn(r.Context(), user, event)
 
-	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
-		app.internalServerError(w, r, err)
+	if err := app.store.LoginEvents.Create(r.Context(), event); err != nil {
+		app.logger.Errorw("could not record login", "user_id", user.ID, "error", err)
 	}
 }
 
-func (app *application) logLoginEvent(r *http.Request, userID *int64, email string, success bool) error {
+func newLoginEvent(r *http.Request, userID *int64, email string, success bool) *store.LoginEvent {
 	ip := r.RemoteAddr
 	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
 		ip = host
 	}
 
-	event := &store.LoginEvent{
+	return &store.LoginEvent{
 		UserID:    userID,
 		EmailHash: crypto.HashEmail(email),
 		IP:        ip,
 		UserAgent: r.UserAgent(),
+		Country:   geoIPCountry(r),
+		Device:    deviceName(r.UserAgent()),
 		Success:   success,
 	}
-
-	return app.store.LoginEvents.Create(r.Context(), event)
-}
-
-func (app *application) buildActivationURL(token string) string {
-	base := strings.TrimRight(app.config.frontendURL, "/")
-	escapedToken := url.QueryEscape(token)
-
-	// In development we prefer query token, because static servers often do not
-	// support SPA deep links like /confirm/{token} without extra rewrite config.
-	if app.config.env != "production" {
-		return fmt.Sprintf("%s/?token=%s", base, escapedToken)
-	}
-
-	return fmt.Sprintf("%s/confirm/%s", base, escapedToken)
 }
-
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// The benchmarks run the feed and sign-in through the router against the
+// in-memory store, so they measure handlers and middleware, not Postgres:
+//
+//	go test ./cmd/api -run '^$' -bench . -benchmem
+
+func BenchmarkListListings(b *testing.B) {
+	app, _ := newMemoryTestApplication(b, config{})
+	mux := app.mount()
+	ctx := context.Background()
+
+	cities := []string{"Almaty", "Astana", "Shymkent"}
+	for i := 0; i < 500; i++ {
+		listing := &store.Listing{
+			Title: fmt.Sprintf("Flat %d #parking", i), PropertyType: "apartment", DealType: "sale",
+			Price: int64(20_000_000 + i*10_000), City: cities[i%len(cities)], Status: store.ListingStatusActive,
+		}
+		if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/v1/listings?city=Almaty&deal_type=sale&limit=20", nil)
+		if rr := executeRequest(req, mux); rr.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", rr.Code, rr.Body)
+		}
+	}
+}
+
+// BenchmarkCreateToken is dominated by bcrypt, as sign-in is in production.
+func BenchmarkCreateToken(b *testing.B) {
+	app, _ := newMemoryTestApplication(b, config{loadTest: loadTestConfig{enabled: true}})
+	mux := app.mount()
+
+	user := &store.User{Username: "jo", Email: "jo@example.com", Role: store.Role{Name: store.RoleUser}}
+	user.Password.Set("Abcdefg1!x")
+	if err := app.store.Users.CreateActive(context.Background(), user); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/authentication/token", strings.NewReader(`{"identifier":"jo","password":"Abcdefg1!x"}`))
+		if rr := executeRequest(req, mux); rr.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", rr.Code, rr.Body)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type BlockStatus struct {
+	UserID  int64 `json:"user_id"`
+	Blocked bool  `json:"blocked"`
+}
+
+// blockTarget returns the {userID} of the request, refusing the current
+// user's own id.
+func blockTarget(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, newHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+	if id == getUserFromContext(r).ID {
+		return 0, newHTTPError(http.StatusBadRequest, "cannot block yourself")
+	}
+	return id, nil
+}
+
+// blockUserHandler godoc
+//
+//	@Summary		Block a user
+//	@Description	The blocked user no longer finds the current user's profile, and neither can message the other or see their conversation. Blocking twice is not an error.
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	BlockStatus
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [put]
+func (app *application) blockUserHandler(r *http.Request, _ *noBody) (*BlockStatus, error) {
+	userID, err := blockTarget(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.Blocks.Block(r.Context(), getUserFromContext(r).ID, userID); err != nil {
+		return nil, err
+	}
+	return &BlockStatus{UserID: userID, Blocked: true}, nil
+}
+
+// unblockUserHandler godoc
+//
+//	@Summary		Unblock a user
+//	@Description	Lifts a block. Conversations reappear with their history. Unblocking a user who is not blocked is not an error.
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	BlockStatus
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [delete]
+func (app *application) unblockUserHandler(r *http.Request, _ *noBody) (*BlockStatus, error) {
+	userID, err := blockTarget(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.Blocks.Unblock(r.Context(), getUserFromContext(r).ID, userID); err != nil {
+		return nil, err
+	}
+	return &BlockStatus{UserID: userID}, nil
+}
+
+// listBlockedUsersHandler godoc
+//
+//	@Summary		List blocked users
+//	@Description	Users the current user has blocked, most recent first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.BlockedUser
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks [get]
+func (app *application) listBlockedUsersHandler(r *http.Request, _ *noBody) (paged[store.BlockedUser], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.BlockedUser]{}, err
+	}
+
+	blocked, err := app.store.Blocks.List(r.Context(), getUserFromContext(r).ID, storeQuery(params))
+	return newPage(params, blocked), err
+}
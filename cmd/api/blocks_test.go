@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBlockUser(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	alice := &store.User{Username: "alice", Email: "alice@example.com", IsActive: true}
+	bob := &store.User{Username: "bob", Email: "bob@example.com", IsActive: true}
+	for _, u := range []*store.User{alice, bob} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conversation, err := app.store.Conversations.Open(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/users/{userID}", app.getUserHandler)
+	mux.Put("/v1/users/{userID}/block", handle(app, http.StatusOK, app.blockUserHandler))
+	mux.Delete("/v1/users/{userID}/block", handle(app, http.StatusOK, app.unblockUserHandler))
+	mux.Post("/v1/conversations", handle(app, http.StatusOK, app.startConversationHandler))
+	mux.Get("/v1/conversations", handle(app, http.StatusOK, app.listConversationsHandler))
+
+	do := func(user *store.User, method, path string, body any, wantStatus int) *http.Response {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		resp := executeRequest(req, mux).Result()
+		checkResponseCode(t, wantStatus, resp.StatusCode)
+		return resp
+	}
+	conversations := func(user *store.User) int {
+		t.Helper()
+		var list struct {
+			Data []store.Conversation `json:"data"`
+		}
+		if err := json.NewDecoder(do(user, http.MethodGet, "/v1/conversations", nil, http.StatusOK).Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		return len(list.Data)
+	}
+	aliceID := strconv.FormatInt(alice.ID, 10)
+	bobID := strconv.FormatInt(bob.ID, 10)
+
+	do(alice, http.MethodPut, "/v1/users/"+aliceID+"/block", nil, http.StatusBadRequest)
+	do(alice, http.MethodPut, "/v1/users/"+bobID+"/block", nil, http.StatusOK)
+	do(alice, http.MethodPut, "/v1/users/"+bobID+"/block", nil, http.StatusOK)
+
+	do(bob, http.MethodGet, "/v1/users/"+aliceID, nil, http.StatusNotFound)
+	do(alice, http.MethodGet, "/v1/users/"+bobID, nil, http.StatusOK)
+	do(bob, http.MethodPost, "/v1/conversations", map[string]int64{"user_id": alice.ID}, http.StatusNotFound)
+	do(alice, http.MethodPost, "/v1/conversations", map[string]int64{"user_id": bob.ID}, http.StatusNotFound)
+	if n := conversations(bob); n != 0 {
+		t.Errorf("bob still sees %d conversations with alice", n)
+	}
+	if _, err := app.store.Conversations.Get(ctx, conversation.ID, alice.ID); err != store.ErrNotFound {
+		t.Errorf("blocked conversation should not be found, got %v", err)
+	}
+
+	do(alice, http.MethodDelete, "/v1/users/"+bobID+"/block", nil, http.StatusOK)
+	do(bob, http.MethodGet, "/v1/users/"+aliceID, nil, http.StatusOK)
+	if n := conversations(bob); n != 1 {
+		t.Errorf("unblocking should bring the conversation back, got %d", n)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/botcheck"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
+)
+
+const challengeRequiredCode = "challenge_required"
+
+// botCheck holds what checkBot needs; app.botCheck is nil unless
+// BOT_CHECK_PROVIDER is set.
+type botCheck struct {
+	provider string
+	siteKey  string
+	verifier botcheck.Verifier
+	// pow hands out challenges, nil for the CAPTCHA providers
+	pow *botcheck.ProofOfWork
+	// attempts lets BOT_CHECK_FREE_ATTEMPTS registrations per IP through
+	// without a token; nil challenges every registration
+	attempts ratelimiter.Limiter
+	exempt   []*net.IPNet
+}
+
+// BotChallenge tells clients what to send as challenge_token.
+type BotChallenge struct {
+	Provider string `json:"provider"`
+	// SiteKey is the public key for the CAPTCHA widget
+	SiteKey string `json:"site_key,omitempty"`
+	*botcheck.Challenge
+}
+
+func newBotCheck(cfg botCheckConfig) (*botCheck, error) {
+	exempt, err := parseCIDRs(cfg.exemptNets)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &botCheck{provider: cfg.provider, siteKey: cfg.siteKey, exempt: exempt}
+	if cfg.provider == botcheck.ProviderProofOfWork {
+		check.pow, err = botcheck.NewProofOfWork([]byte(cfg.secret), cfg.powDifficulty, cfg.powTTL)
+		check.verifier = check.pow
+	} else {
+		check.verifier, err = botcheck.NewSiteVerifier(cfg.provider, cfg.secret, cfg.minScore, cfg.timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.freeAttempts > 0 {
+		check.attempts = ratelimiter.NewFixedWindowLimiter(cfg.freeAttempts, cfg.window)
+	}
+	return check, nil
+}
+
+// parseCIDRs parses a comma separated list of networks; single addresses
+// are taken as /32 or /128.
+func parseCIDRs(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// clientIP is the address RealIP left in RemoteAddr, without the port.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// required reports whether a registration from ip needs a token, counting
+// it against the free attempts.
+func (c *botCheck) required(ip string) bool {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		for _, network := range c.exempt {
+			if network.Contains(parsed) {
+				return false
+			}
+		}
+	}
+	if c.attempts == nil {
+		return true
+	}
+	allowed, _ := c.attempts.Allow(ip)
+	return !allowed
+}
+
+// checkBot verifies token when the client's IP needs one. Like the breach
+// check it writes the response and returns false when registration must
+// stop.
+func (app *application) checkBot(w http.ResponseWriter, r *http.Request, token string) bool {
+	check := app.botCheck
+	if check == nil {
+		return true
+	}
+
+	ip := clientIP(r)
+	if !check.required(ip) {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.config.auth.botCheck.timeout)
+	defer cancel()
+
+	err := check.verifier.Verify(ctx, strings.TrimSpace(token), ip)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, botcheck.ErrFailed):
+		message := "challenge failed, please try again"
+		if token == "" {
+			message = "challenge_token is required"
+		}
+		app.logger.Warnw("bot check failed", "method", r.Method, "path", r.URL.Path, "ip", ip, "provider", check.provider)
+		writeJSONErrorCode(w, http.StatusBadRequest, challengeRequiredCode, message)
+		return false
+	case app.config.auth.botCheck.failOpen:
+		app.logger.Warnw("bot check unavailable, allowing registration", "provider", check.provider, "error", err)
+		return true
+	default:
+		app.logger.Errorw("bot check unavailable", "provider", check.provider, "error", err)
+		app.serviceUnavailableResponse(w, r, "could not verify the challenge, please try again later")
+		return false
+	}
+}
+
+// botChallengeHandler godoc
+//
+//	@Summary		Get a registration challenge
+//	@Description	Says which bot check registration uses. For pow it includes a challenge: find a nonce such that SHA-256 of challenge + ":" + nonce starts with difficulty zero bits and send challenge + ":" + nonce as challenge_token. For CAPTCHA providers send the widget's token. 404 when no bot check is configured.
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	BotChallenge
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/authentication/challenge [get]
+func (app *application) botChallengeHandler(r *http.Request, _ *noBody) (*BotChallenge, error) {
+	check := app.botCheck
+	if check == nil {
+		return nil, newHTTPError(http.StatusNotFound, "registration has no bot check")
+	}
+
+	response := &BotChallenge{Provider: check.provider, SiteKey: check.siteKey}
+	if check.pow != nil {
+		challenge, err := check.pow.NewChallenge()
+		if err != nil {
+			return nil, err
+		}
+		response.Challenge = challenge
+	}
+	return response, nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/country"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// broadcastLease is how long an instance holds a broadcast while sending a
+// batch. A batch the provider refused is retried once it runs out.
+const broadcastLease = 5 * time.Minute
+
+type BroadcastSegmentPayload struct {
+	// Countries are ISO 3166-1 alpha-2 codes or country names
+	Countries      []string   `json:"countries" validate:"max=250"`
+	SignedUpAfter  *time.Time `json:"signed_up_after"`
+	SignedUpBefore *time.Time `json:"signed_up_before"`
+}
+
+type CreateBroadcastPayload struct {
+	Subject string                  `json:"subject" validate:"required,max=200"`
+	Body    string                  `json:"body" validate:"required,max=20000"`
+	Segment BroadcastSegmentPayload `json:"segment"`
+}
+
+// broadcastParagraphs splits a plain text body on blank lines.
+func broadcastParagraphs(body string) []string {
+	var paragraphs []string
+	for _, p := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	return paragraphs
+}
+
+// runBroadcastSender sends one batch of a running broadcast per interval
+// until ctx is cancelled, so BROADCAST_BATCH_SIZE and BROADCAST_INTERVAL
+// bound the sending rate.
+func (app *application) runBroadcastSender(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sendBroadcastBatch(ctx)
+		}
+	}
+}
+
+// sendBroadcastBatch mails the next users of the oldest running broadcast
+// and records how far it got. A crash before that resends the batch once
+// the lease runs out.
+func (app *application) sendBroadcastBatch(ctx context.Context) {
+	b, err := app.store.Broadcasts.Claim(ctx, broadcastLease)
+	if errors.Is(err, store.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		app.logger.Errorw("could not claim broadcast", "error", err)
+		return
+	}
+
+	batchSize := app.config.mail.broadcastBatch
+	recipients, err := app.store.Broadcasts.Recipients(ctx, b, batchSize)
+	if err != nil {
+		app.logger.Errorw("could not load broadcast recipients", "id", b.ID, "error", err)
+		return
+	}
+	if len(recipients) == 0 {
+		if err := app.store.Broadcasts.Advance(ctx, b.ID, b.LastUserID, 0, 0, 0, true); err != nil {
+			app.logger.Errorw("could not complete broadcast", "id", b.ID, "error", err)
+			return
+		}
+		app.logger.Infow("broadcast completed", "id", b.ID, "sent", b.Sent, "failed", b.Failed, "skipped", b.Skipped)
+		return
+	}
+
+	paragraphs := broadcastParagraphs(b.Body)
+	batch := make([]mailer.Recipient, len(recipients))
+	for i, r := range recipients {
+		batch[i] = mailer.Recipient{Username: r.Username, Email: r.Email, Data: map[string]any{
+			"Username":       r.Username,
+			"Subject":        b.Subject,
+			"Paragraphs":     paragraphs,
+			"UnsubscribeURL": app.unsubscribeURL(r.Email),
+		}}
+	}
+
+	results, err := app.mailer.SendBatch(ctx, mailer.AnnouncementTemplate, batch, app.config.env != "production")
+	if err != nil {
+		app.logger.Warnw("broadcast batch failed, will retry", "id", b.ID, "after_user_id", b.LastUserID, "error", err)
+		return
+	}
+
+	var sent, failed, skipped int
+	for _, result := range results {
+		switch {
+		case errors.Is(result.Err, mailer.ErrSuppressed):
+			skipped++
+		case result.Err != nil || result.Status < 0:
+			failed++
+		default:
+			sent++
+		}
+	}
+
+	done := len(recipients) < batchSize
+	if err := app.store.Broadcasts.Advance(ctx, b.ID, recipients[len(recipients)-1].UserID, sent, failed, skipped, done); err != nil {
+		app.logger.Errorw("could not record broadcast progress", "id", b.ID, "error", err)
+		return
+	}
+	if done {
+		app.logger.Infow("broadcast completed", "id", b.ID, "sent", b.Sent+sent, "failed", b.Failed+failed, "skipped", b.Skipped+skipped)
+	}
+}
+
+// broadcastParam returns the {broadcastID} of the request.
+func broadcastParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "broadcastID"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, newHTTPError(http.StatusBadRequest, "invalid broadcast id")
+	}
+	return id, nil
+}
+
+// adminCreateBroadcastHandler godoc
+//
+//	@Summary		Broadcast an announcement
+//	@Description	Mails the announcement to every active user of the segment, in batches, starting right away. The body is plain text; blank lines separate paragraphs. Users who unsubscribed from notifications are skipped. total is the size of the segment now.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateBroadcastPayload	true	"Announcement and segment"
+//	@Success		201		{object}	store.Broadcast
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/broadcasts [post]
+func (app *application) adminCreateBroadcastHandler(r *http.Request, payload *CreateBroadcastPayload) (*store.Broadcast, error) {
+	segment := store.BroadcastSegment{SignedUpAfter: payload.Segment.SignedUpAfter, SignedUpBefore: payload.Segment.SignedUpBefore}
+	for _, c := range payload.Segment.Countries {
+		code, ok := country.Normalize(c)
+		if !ok {
+			return nil, newHTTPError(http.StatusBadRequest, "unknown country "+strconv.Quote(c))
+		}
+		segment.Countries = append(segment.Countries, code)
+	}
+	if segment.SignedUpAfter != nil && segment.SignedUpBefore != nil && !segment.SignedUpAfter.Before(*segment.SignedUpBefore) {
+		return nil, newHTTPError(http.StatusBadRequest, "signed_up_after must be before signed_up_before")
+	}
+	if len(broadcastParagraphs(payload.Body)) == 0 {
+		return nil, newHTTPError(http.StatusBadRequest, "body is empty")
+	}
+
+	user := getUserFromContext(r)
+	b := &store.Broadcast{Subject: strings.TrimSpace(payload.Subject), Body: payload.Body, Segment: segment, CreatedBy: &user.ID}
+	if err := app.store.Broadcasts.Create(r.Context(), b); err != nil {
+		return nil, err
+	}
+
+	app.logAdminAction(user, "create_broadcast", "broadcast", b.ID, b.Subject)
+	return b, nil
+}
+
+// adminListBroadcastsHandler godoc
+//
+//	@Summary		Lists broadcasts
+//	@Description	Returns the broadcasts newest first, with their progress
+//	@Tags			admin
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.Broadcast
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/broadcasts [get]
+func (app *application) adminListBroadcastsHandler(r *http.Request, _ *noBody) (paged[store.Broadcast], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.Broadcast]{}, err
+	}
+
+	broadcasts, err := app.store.Broadcasts.List(r.Context(), storeQuery(params))
+	return newPage(params, broadcasts), err
+}
+
+// adminGetBroadcastHandler godoc
+//
+//	@Summary		Get a broadcast
+//	@Description	Returns the broadcast and its progress
+//	@Tags			admin
+//	@Produce		json
+//	@Param			broadcastID	path		int	true	"Broadcast ID"
+//	@Success		200			{object}	store.Broadcast
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/broadcasts/{broadcastID} [get]
+func (app *application) adminGetBroadcastHandler(r *http.Request, _ *noBody) (*store.Broadcast, error) {
+	id, err := broadcastParam(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.store.Broadcasts.GetByID(r.Context(), id)
+}
+
+// adminPauseBroadcastHandler godoc
+//
+//	@Summary		Pause a broadcast
+//	@Description	Stops sending after the batch in flight; resuming continues with the next user
+//	@Tags			admin
+//	@Produce		json
+//	@Param			broadcastID	path		int	true	"Broadcast ID"
+//	@Success		200			{object}	store.Broadcast
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/broadcasts/{broadcastID}/pause [post]
+func (app *application) adminPauseBroadcastHandler(r *http.Request, _ *noBody) (*store.Broadcast, error) {
+	return app.setBroadcastStatus(r, store.BroadcastRunning, store.BroadcastPaused, "pause_broadcast")
+}
+
+// adminResumeBroadcastHandler godoc
+//
+//	@Summary		Resume a broadcast
+//	@Description	Continues a paused broadcast with the users it has not reached yet
+//	@Tags			admin
+//	@Produce		json
+//	@Param			broadcastID	path		int	true	"Broadcast ID"
+//	@Success		200			{object}	store.Broadcast
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/broadcasts/{broadcastID}/resume [post]
+func (app *application) adminResumeBroadcastHandler(r *http.Request, _ *noBody) (*store.Broadcast, error) {
+	return app.setBroadcastStatus(r, store.BroadcastPaused, store.BroadcastRunning, "resume_broadcast")
+}
+
+func (app *application) setBroadcastStatus(r *http.Request, from, to, action string) (*store.Broadcast, error) {
+	id, err := broadcastParam(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.Broadcasts.SetStatus(r.Context(), id, from, to); err != nil {
+		return nil, err
+	}
+
+	app.logAdminAction(getUserFromContext(r), action, "broadcast", id, "")
+	return app.store.Broadcasts.GetByID(r.Context(), id)
+}
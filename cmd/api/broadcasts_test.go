@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBroadcast(t *testing.T) {
+	app, mail := newMemoryTestApplication(t, config{
+		mail: mailConfig{broadcastBatch: 2, unsubscribeURL: "https://api.example.com/v1/unsubscribe"},
+	})
+	app.mailer = mailer.WithSuppression(mail, app.store.Suppressions)
+	ctx := context.Background()
+
+	admin := &store.User{Username: "root", Email: "root@example.com", IsActive: true, Role: store.Role{Name: store.RoleAdmin}}
+	users := []*store.User{
+		admin,
+		{Username: "aida", Email: "aida@example.com", Country: "KZ", IsActive: true},
+		{Username: "bek", Email: "bek@example.com", Country: "KZ", IsActive: true},
+		{Username: "dana", Email: "dana@example.com", Country: "KZ", IsActive: true},
+		{Username: "sam", Email: "sam@example.com", Country: "US", IsActive: true},
+		{Username: "pending", Email: "pending@example.com", Country: "KZ"},
+	}
+	for _, u := range users {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.store.Suppressions.Add(ctx, &store.EmailSuppression{Email: "bek@example.com", Reason: store.SuppressionUnsubscribe}); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/broadcasts", handle(app, http.StatusCreated, app.adminCreateBroadcastHandler))
+	mux.Post("/broadcasts/{broadcastID}/pause", handle(app, http.StatusOK, app.adminPauseBroadcastHandler))
+	mux.Post("/broadcasts/{broadcastID}/resume", handle(app, http.StatusOK, app.adminResumeBroadcastHandler))
+	do := func(method, path, body string) (int, store.Broadcast) {
+		t.Helper()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		rr := executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), mux)
+		var resp struct{ Data store.Broadcast }
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp.Data
+	}
+
+	code, _ := do(http.MethodPost, "/broadcasts", `{"subject":"Hi","body":"News","segment":{"countries":["XX"]}}`)
+	checkResponseCode(t, http.StatusBadRequest, code)
+
+	code, b := do(http.MethodPost, "/broadcasts", `{"subject":"New filters","body":"Filter by floor.\n\nHave a look.","segment":{"countries":["kz"]}}`)
+	checkResponseCode(t, http.StatusCreated, code)
+	if b.Total != 3 || b.Status != store.BroadcastRunning {
+		t.Fatalf("created %+v", b)
+	}
+
+	app.sendBroadcastBatch(ctx)
+	code, _ = do(http.MethodPost, "/broadcasts/1/pause", "")
+	checkResponseCode(t, http.StatusOK, code)
+	app.sendBroadcastBatch(ctx)
+
+	got, err := app.store.Broadcasts.GetByID(ctx, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Sent != 1 || got.Skipped != 1 || got.Status != store.BroadcastPaused || len(mail.Sent()) != 1 {
+		t.Fatalf("after the first batch and a pause: %+v, %d sent", got, len(mail.Sent()))
+	}
+
+	code, _ = do(http.MethodPost, "/broadcasts/1/pause", "")
+	checkResponseCode(t, http.StatusConflict, code)
+	code, _ = do(http.MethodPost, "/broadcasts/1/resume", "")
+	checkResponseCode(t, http.StatusOK, code)
+
+	app.sendBroadcastBatch(ctx)
+	got, err = app.store.Broadcasts.GetByID(ctx, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Sent != 2 || got.Skipped != 1 || got.Status != store.BroadcastCompleted || got.CompletedAt == nil {
+		t.Fatalf("after the last batch: %+v", got)
+	}
+
+	var to []string
+	for _, sent := range mail.Sent() {
+		to = append(to, sent.Email)
+	}
+	if strings.Join(to, ",") != "aida@example.com,dana@example.com" {
+		t.Errorf("mailed %v", to)
+	}
+	data := mail.Sent()[0].Data.(map[string]any)
+	if paragraphs := data["Paragraphs"].([]string); len(paragraphs) != 2 || paragraphs[1] != "Have a look." {
+		t.Errorf("paragraphs %q", paragraphs)
+	}
+	if !strings.HasPrefix(data["UnsubscribeURL"].(string), "https://api.example.com/v1/unsubscribe/") {
+		t.Errorf("unsubscribe link %v", data["UnsubscribeURL"])
+	}
+
+	// a provider outage leaves the batch to be sent again once the lease
+	// runs out
+	code, b = do(http.MethodPost, "/broadcasts", `{"subject":"Again","body":"News"}`)
+	checkResponseCode(t, http.StatusCreated, code)
+	mail.Fail(errors.New("provider down"))
+	app.sendBroadcastBatch(ctx)
+	if got, _ := app.store.Broadcasts.GetByID(ctx, b.ID); got.Sent+got.Failed+got.Skipped != 0 || got.Status != store.BroadcastRunning {
+		t.Errorf("after a failed batch: %+v", got)
+	}
+}
+
+func TestBroadcastTenants(t *testing.T) {
+	app, mail := newMemoryTestApplication(t, config{mail: mailConfig{broadcastBatch: 10}})
+	ctx := context.Background()
+
+	acme := &store.Tenant{Slug: "acme", Name: "Acme"}
+	if err := app.store.Tenants.Create(ctx, acme); err != nil {
+		t.Fatal(err)
+	}
+	admin := &store.User{Username: "root", Email: "root@example.com", IsActive: true, Role: store.Role{Name: store.RoleAdmin}}
+	if err := app.store.Users.Create(store.WithTenant(ctx, acme.ID), nil, admin); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*store.User{
+		{Username: "aida", Email: "aida@example.com", IsActive: true},
+		{Username: "bek", Email: "bek@example.com", IsActive: true},
+	} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/broadcasts", handle(app, http.StatusCreated, app.adminCreateBroadcastHandler))
+	mux.Get("/broadcasts/{broadcastID}", handle(app, http.StatusOK, app.adminGetBroadcastHandler))
+	serve := func(method, path, body string, tenantID int64) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		return executeRequest(req.WithContext(reqctx.WithTenant(reqctx.WithUser(req.Context(), admin), tenantID)), mux)
+	}
+
+	// acme's admin reaches acme's users only
+	rr := serve(http.MethodPost, "/broadcasts", `{"subject":"Hi","body":"News"}`, acme.ID)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var resp struct{ Data store.Broadcast }
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Total != 1 || resp.Data.TenantID != acme.ID {
+		t.Fatalf("created %+v", resp.Data)
+	}
+
+	app.sendBroadcastBatch(ctx)
+	if sent := mail.Sent(); len(sent) != 1 || sent[0].Email != "root@example.com" {
+		t.Errorf("mailed %+v", sent)
+	}
+
+	path := "/broadcasts/" + strconv.FormatInt(resp.Data.ID, 10)
+	checkResponseCode(t, http.StatusNotFound, serve(http.MethodGet, path, "", store.DefaultTenantID).Code)
+	checkResponseCode(t, http.StatusOK, serve(http.MethodGet, path, "", acme.ID).Code)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Admins clean up after spam waves with bulk moderation jobs instead of one
+// call per item: deleting listings, suspending users, or purging users,
+// which also mutes them and hides every message they sent. The job runs on
+// the job pool and is polled for progress; a target that cannot be handled
+// is recorded with the reason and the job carries on. A job taken over
+// after its worker died resumes from the last saved progress.
+//
+// moderationProgressEvery is how many targets are handled between saves of
+// the job's progress.
+const moderationProgressEvery = 50
+
+var errStaffTarget = errors.New("staff accounts cannot be banned in bulk")
+
+type CreateModerationJobPayload struct {
+	Action string  `json:"action" validate:"required,oneof=delete_listings ban_users purge_users"`
+	IDs    []int64 `json:"ids" validate:"required,min=1,max=1000,dive,min=1"`
+	// Reason is recorded with every change, such as a ticket or the spam
+	// wave
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// adminCreateModerationJobHandler godoc
+//
+//	@Summary		Start a bulk moderation job
+//	@Description	Acts on up to 1000 listings or users in the background: delete_listings deletes listings, ban_users suspends users and purge_users suspends and mutes users and hides every message they sent. Staff accounts are never banned. Poll the returned job for progress and the targets that failed.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateModerationJobPayload	true	"Action and targets"
+//	@Success		202		{object}	store.ModerationJob
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/moderation-jobs [post]
+func (app *application) adminCreateModerationJobHandler(r *http.Request, payload *CreateModerationJobPayload) (*store.ModerationJob, error) {
+	admin := getUserFromContext(r)
+
+	seen := make(map[int64]bool, len(payload.IDs))
+	targets := make([]int64, 0, len(payload.IDs))
+	for _, id := range payload.IDs {
+		if !seen[id] {
+			seen[id] = true
+			targets = append(targets, id)
+		}
+	}
+
+	job := &store.ModerationJob{AdminID: admin.ID, Action: payload.Action, TargetIDs: targets, Reason: payload.Reason}
+	if err := app.store.ModerationJobs.Create(r.Context(), job); err != nil {
+		return nil, err
+	}
+
+	// the tenant of the request still applies when the job runs
+	run := moderationRun{ModerationJobID: job.ID}
+	if tenantID, ok := reqctx.Tenant(r.Context()); ok {
+		run.TenantID = &tenantID
+	}
+	if _, err := app.jobs.Enqueue(r.Context(), jobModeration, run); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// moderationRun is the payload of the pool job that runs a moderation job.
+type moderationRun struct {
+	ModerationJobID int64  `json:"moderation_job_id"`
+	TenantID        *int64 `json:"tenant_id,omitempty"`
+}
+
+// moderationJob runs the moderation job named by the payload of job on the
+// pool.
+func (app *application) moderationJob(ctx context.Context, job jobs.Job) error {
+	var run moderationRun
+	if err := json.Unmarshal(job.Payload, &run); err != nil {
+		return jobs.Permanent(err)
+	}
+	if run.TenantID != nil {
+		ctx = reqctx.WithTenant(ctx, *run.TenantID)
+	}
+
+	moderation, err := app.store.ModerationJobs.GetByID(ctx, run.ModerationJobID)
+	if err != nil {
+		return err
+	}
+	if moderation.Status == store.ModerationJobCompleted {
+		return nil
+	}
+	admin, err := app.store.Users.GetByID(ctx, moderation.AdminID)
+	if err != nil {
+		// the admin was suspended or deleted since
+		return jobs.Permanent(fmt.Errorf("admin %d: %w", moderation.AdminID, err))
+	}
+
+	app.runModerationJob(ctx, *admin, *moderation)
+	return nil
+}
+
+// adminGetModerationJobHandler godoc
+//
+//	@Summary		Progress of a bulk moderation job
+//	@Description	Status of the job, how many targets were handled and which ones failed and why.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			jobID	path		int	true	"Job ID"
+//	@Success		200		{object}	store.ModerationJob
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/moderation-jobs/{jobID} [get]
+func (app *application) adminGetModerationJobHandler(r *http.Request, _ *noBody) (*store.ModerationJob, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid job id")
+	}
+	return app.store.ModerationJobs.GetByID(r.Context(), id)
+}
+
+// runModerationJob handles the targets of job in order, starting after
+// those handled already, saving progress every moderationProgressEvery
+// targets and once it is done.
+func (app *application) runModerationJob(ctx context.Context, admin store.User, job store.ModerationJob) {
+	job.Status = store.ModerationJobRunning
+	app.saveModerationJob(ctx, &job)
+
+	for i := job.Done + job.Failed; i < len(job.TargetIDs); i++ {
+		id := job.TargetIDs[i]
+		if err := app.moderate(ctx, &admin, job, id); err != nil {
+			job.Failed++
+			job.Failures = append(job.Failures, store.ModerationFailure{TargetID: id, Error: app.moderationFailure(job, id, err)})
+		} else {
+			job.Done++
+		}
+		if (i+1)%moderationProgressEvery == 0 && i+1 < len(job.TargetIDs) {
+			app.saveModerationJob(ctx, &job)
+		}
+	}
+
+	if job.Action == store.ModerationDeleteListings && job.Done > 0 {
+		app.invalidateFeed(ctx)
+	}
+	job.Status = store.ModerationJobCompleted
+	app.saveModerationJob(ctx, &job)
+	app.logger.Infow("moderation job completed", "job_id", job.ID, "action", job.Action, "done", job.Done, "failed", job.Failed)
+}
+
+func (app *application) saveModerationJob(ctx context.Context, job *store.ModerationJob) {
+	if err := app.store.ModerationJobs.Progress(ctx, job); err != nil {
+		app.logger.Errorw("could not save moderation job progress", "job_id", job.ID, "error", err)
+	}
+}
+
+// moderate applies the action of job to one target.
+func (app *application) moderate(ctx context.Context, admin *store.User, job store.ModerationJob, id int64) error {
+	switch job.Action {
+	case store.ModerationDeleteListings:
+		listing, err := app.store.Listings.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := app.store.Listings.Delete(ctx, id); err != nil {
+			return err
+		}
+		app.forgetListings(id)
+		app.publish(ctx, events.ListingDeleted, &listing.CompanyID, listingDeletedEvent{ID: id})
+		app.logAdminAction(admin, "delete_listing", "listing", id, job.Reason)
+		return nil
+	case store.ModerationBanUsers:
+		return app.banUser(ctx, admin, id, job.Reason)
+	case store.ModerationPurgeUsers:
+		if err := app.banUser(ctx, admin, id, job.Reason); err != nil {
+			return err
+		}
+		if err := app.store.Users.SetMuted(ctx, id, true); err != nil {
+			return err
+		}
+		hidden, err := app.store.Users.HideMessages(ctx, id)
+		if err != nil {
+			return err
+		}
+		app.logAdminAction(admin, "purge_user", "user", id, fmt.Sprintf("%d messages hidden. %s", hidden, job.Reason))
+		return nil
+	}
+	return fmt.Errorf("unknown moderation action %q", job.Action)
+}
+
+// banUser suspends a user who is not staff; suspended users are left as
+// they are.
+func (app *application) banUser(ctx context.Context, admin *store.User, userID int64, reason string) error {
+	user, err := app.store.Users.GetByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		// GetByID only finds users who can sign in
+		history, herr := app.store.Users.StateHistory(ctx, userID)
+		if herr == nil && len(history) > 0 && history[0].ToState == store.UserStateSuspended {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if user.Role.Name == store.RoleAdmin || user.Role.Name == store.RoleModerator {
+		return errStaffTarget
+	}
+	return app.transitionUser(ctx, admin, userID, store.UserStateSuspended, reason)
+}
+
+// moderationFailure is the reason recorded for a target; unexpected errors
+// are logged and not shown.
+func (app *application) moderationFailure(job store.ModerationJob, id int64, err error) string {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return "not found"
+	case errors.Is(err, errStaffTarget), errors.Is(err, store.ErrInvalidTransition):
+		return err.Error()
+	}
+	app.logger.Errorw("moderation job target failed", "job_id", job.ID, "target_id", id, "error", err)
+	return "internal error"
+}
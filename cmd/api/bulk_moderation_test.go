@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestBulkModeration(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Realty", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	var listingIDs []int64
+	for i := 0; i < 2; i++ {
+		listing := &store.Listing{CompanyID: company.ID, Title: "Spam", DealType: "rent", Status: store.ListingStatusActive}
+		if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		listingIDs = append(listingIDs, listing.ID)
+	}
+	spammer := &store.User{Username: "spammer", Email: "spammer@example.com", IsActive: true}
+	agent := &store.User{Username: "agent", Email: "agent@example.com", IsActive: true, CompanyID: &company.ID, Role: store.Role{Name: store.RoleAgency}}
+	moderator := &store.User{Username: "mod", Email: "mod@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	admin := &store.User{Username: "admin", Email: "admin@example.com", IsActive: true, Role: store.Role{Name: store.RoleAdmin}}
+	for _, u := range []*store.User{spammer, agent, moderator, admin} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	application := &store.Application{ListingID: listingIDs[0], UserID: spammer.ID, FullName: "S", Email: spammer.Email, Status: "new", DealType: "rent"}
+	if err := app.store.Applications.Create(ctx, application); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Messages.Create(ctx, &store.ApplicationMessage{ApplicationID: application.ID, SenderUserID: &spammer.ID, Body: "buy now"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/admin/moderation-jobs", handle(app, http.StatusAccepted, app.adminCreateModerationJobHandler))
+	mux.Get("/v1/admin/moderation-jobs/{jobID}", handle(app, http.StatusOK, app.adminGetModerationJobHandler))
+	run := func(payload CreateModerationJobPayload) store.ModerationJob {
+		t.Helper()
+		b, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(http.MethodPost, "/v1/admin/moderation-jobs", bytes.NewReader(b))
+		rr := executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), mux)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("creating the job answered %d: %s", rr.Code, rr.Body)
+		}
+		var created struct{ Data store.ModerationJob }
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			req, _ := http.NewRequest(http.MethodGet, "/v1/admin/moderation-jobs/"+strconv.FormatInt(created.Data.ID, 10), nil)
+			rr := executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), mux)
+			checkResponseCode(t, http.StatusOK, rr.Code)
+			var job struct{ Data store.ModerationJob }
+			if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Data.Status == store.ModerationJobCompleted {
+				return job.Data
+			}
+		}
+		t.Fatal("the job did not complete")
+		return store.ModerationJob{}
+	}
+
+	// duplicates are handled once and a missing listing is a failure
+	job := run(CreateModerationJobPayload{Action: store.ModerationDeleteListings, IDs: []int64{listingIDs[0], listingIDs[1], listingIDs[0], 999}})
+	if job.Done != 2 || job.Failed != 1 || job.Failures[0] != (store.ModerationFailure{TargetID: 999, Error: "not found"}) {
+		t.Errorf("delete job = %+v", job)
+	}
+	for _, id := range listingIDs {
+		if _, err := app.store.Listings.GetByID(ctx, id); err != store.ErrNotFound {
+			t.Errorf("listing %d was not deleted: %v", id, err)
+		}
+	}
+
+	job = run(CreateModerationJobPayload{Action: store.ModerationPurgeUsers, IDs: []int64{spammer.ID, moderator.ID}, Reason: "spam wave"})
+	if job.Done != 1 || job.Failed != 1 || job.Failures[0].TargetID != moderator.ID {
+		t.Errorf("purge job = %+v", job)
+	}
+	if _, err := app.store.Users.GetByID(ctx, spammer.ID); err != store.ErrNotFound {
+		t.Errorf("the spammer can still sign in: %v", err)
+	}
+	if _, err := app.store.Users.GetByID(ctx, moderator.ID); err != nil {
+		t.Errorf("the moderator was banned: %v", err)
+	}
+	if msgs, _ := app.store.Messages.List(ctx, application.ID, agent.ID, 10, 0); len(msgs) != 0 {
+		t.Errorf("the spammer's messages are still shown: %+v", msgs)
+	}
+
+	// banning again leaves suspended users as they are
+	if job := run(CreateModerationJobPayload{Action: store.ModerationBanUsers, IDs: []int64{spammer.ID}}); job.Done != 1 || job.Failed != 0 {
+		t.Errorf("ban job = %+v", job)
+	}
+}
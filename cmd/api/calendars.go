@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ical"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Listing events are published as iCalendar feeds that calendar apps
+// subscribe to: a public one per company, and a personal one per user with
+// the events at their favorites and, for company staff, at the company's
+// listings. Calendar apps cannot send a token, so the personal feed is
+// served from /downloads through a long-lived signed link.
+const (
+	defaultCalendarLinkTTL = 365 * 24 * time.Hour
+	// calendarRefresh is how often subscribers are asked to reload a feed.
+	calendarRefresh = time.Hour
+	// calendarHistory keeps past events in the feeds for a while, so they
+	// do not vanish from calendars the moment they end.
+	calendarHistory   = 30 * 24 * time.Hour
+	maxCalendarEvents = 500
+	calendarProductID = "-//Real Estate//Listing events//EN"
+)
+
+// CalendarLink is the personal calendar feed of a user.
+type CalendarLink struct {
+	// URL is relative to the API host, like a DownloadLink's
+	URL string `json:"url"`
+	// WebcalURL opens the subscription dialog of calendar apps
+	WebcalURL string    `json:"webcal_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// calendar builds a feed of events that link to the frontend.
+func (app *application) calendar(name, description string, events []store.ListingEvent) *ical.Calendar {
+	base := strings.TrimRight(app.config.frontendURL, "/")
+	domain := "real-estate"
+	if u, err := url.Parse(base); err == nil && u.Hostname() != "" {
+		domain = u.Hostname()
+	}
+
+	c := &ical.Calendar{
+		ProductID:       calendarProductID,
+		Name:            name,
+		Description:     description,
+		RefreshInterval: calendarRefresh,
+		Events:          make([]ical.Event, 0, len(events)),
+	}
+	for _, e := range events {
+		link := fmt.Sprintf("%s/listings/%d", base, e.ListingID)
+		details := e.ListingTitle + "\n" + link
+		if e.Description != "" {
+			details = e.Description + "\n\n" + details
+		}
+		c.Events = append(c.Events, ical.Event{
+			UID:          fmt.Sprintf("listing-event-%d@%s", e.ID, domain),
+			Sequence:     e.Sequence,
+			Start:        parseFeedTime(e.StartsAt),
+			End:          parseFeedTime(e.EndsAt),
+			Created:      parseFeedTime(e.CreatedAt),
+			LastModified: parseFeedTime(e.UpdatedAt),
+			Summary:      e.Title,
+			Description:  details,
+			Location:     e.Location,
+			URL:          link,
+		})
+	}
+	return c
+}
+
+func (app *application) writeCalendar(w http.ResponseWriter, c *ical.Calendar, public bool) {
+	w.Header().Set("Content-Type", ical.ContentType)
+	if public {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(feedMaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(c.Marshal(time.Now()))
+}
+
+// companyCalendarHandler godoc
+//
+//	@Summary		A company's events as a calendar
+//	@Description	iCalendar feed of the events at the company's active listings, from the last 30 days on, for calendar apps to subscribe to. Cacheable for five minutes.
+//	@Tags			listings
+//	@Produce		text/calendar
+//	@Param			companyID	path		int		true	"Company ID"
+//	@Success		200			{string}	string	"iCalendar feed"
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Router			/companies/{companyID}/events.ics [get]
+func (app *application) companyCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		app.errorResponse(w, r, newHTTPError(http.StatusBadRequest, "invalid company id"))
+		return
+	}
+	company, err := app.store.Companies.GetByID(r.Context(), companyID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	events, err := app.store.ListingEvents.List(r.Context(), store.ListingEventFilter{
+		CompanyID:  company.ID,
+		ActiveOnly: true,
+		EndsAfter:  time.Now().Add(-calendarHistory),
+		Limit:      maxCalendarEvents,
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeCalendar(w, app.calendar(company.Name, "Open houses and viewings at "+company.Name, events), true)
+}
+
+// calendarLinkHandler godoc
+//
+//	@Summary		Link to the personal calendar
+//	@Description	Returns a signed link to the user's calendar feed, with the events at their favorite listings and, for company staff, at all of the company's listings. The link works without a token until it expires (CALENDAR_LINK_TTL, default a year); webcal_url subscribes from calendar apps.
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	CalendarLink
+//	@Failure		401	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/calendar [get]
+func (app *application) calendarLinkHandler(r *http.Request, _ *noBody) (CalendarLink, error) {
+	user := getUserFromContext(r)
+	ttl := app.config.listings.calendarLinkTTL
+	if ttl <= 0 {
+		ttl = defaultCalendarLinkTTL
+	}
+
+	link := app.signedDownloadLink(r, "/calendars/"+strconv.FormatInt(user.ID, 10)+".ics", ttl)
+	return CalendarLink{
+		URL:       link.URL,
+		WebcalURL: "webcal://" + r.Host + link.URL,
+		ExpiresAt: link.ExpiresAt,
+	}, nil
+}
+
+// downloadCalendarHandler godoc
+//
+//	@Summary		A user's calendar
+//	@Description	iCalendar feed of the user's events. Only works through a link from /users/me/calendar; an expired link answers 410.
+//	@Tags			users
+//	@Produce		text/calendar
+//	@Param			userID		path		int		true	"User ID"
+//	@Param			expires		query		int		true	"Expiry, Unix seconds"
+//	@Param			signature	query		string	true	"Signature"
+//	@Success		200			{string}	string	"iCalendar feed"
+//	@Failure		404			{object}	error
+//	@Failure		410			{object}	error
+//	@Router			/downloads/calendars/{userID}.ics [get]
+func (app *application) downloadCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.errorResponse(w, r, errInvalidDownloadLink)
+		return
+	}
+	// links of users deleted or suspended since stop working
+	user, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	since := time.Now().Add(-calendarHistory)
+	events, err := app.store.ListingEvents.List(r.Context(), store.ListingEventFilter{
+		FavoritedBy: user.ID,
+		ActiveOnly:  true,
+		EndsAfter:   since,
+		Limit:       maxCalendarEvents,
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if user.CompanyID != nil {
+		own, err := app.store.ListingEvents.List(r.Context(), store.ListingEventFilter{
+			CompanyID: *user.CompanyID,
+			EndsAfter: since,
+			Limit:     maxCalendarEvents,
+		})
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		events = mergeListingEvents(events, own)
+	}
+
+	app.writeCalendar(w, app.calendar("Real Estate events", "Events at your favorite listings", events), false)
+}
+
+// mergeListingEvents returns the events of both lists once, by start time.
+func mergeListingEvents(a, b []store.ListingEvent) []store.ListingEvent {
+	seen := make(map[int64]bool, len(a))
+	for _, e := range a {
+		seen[e.ID] = true
+	}
+	for _, e := range b {
+		if !seen[e.ID] {
+			a = append(a, e)
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool { return a[i].StartsAt < a[j].StartsAt })
+	return a
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+//go:embed changelog.json
+var changelogJSON []byte
+
+type ChangelogChange struct {
+	Type        string `json:"type"` // added, changed, deprecated, removed
+	Endpoint    string `json:"endpoint"`
+	Description string `json:"description"`
+}
+
+type ChangelogEntry struct {
+	Version string            `json:"version"`
+	Date    string            `json:"date"`
+	Changes []ChangelogChange `json:"changes"`
+}
+
+// changelog is parsed once at startup; a malformed changelog.json panics.
+var changelog = func() []ChangelogEntry {
+	var entries []ChangelogEntry
+	if err := json.Unmarshal(changelogJSON, &entries); err != nil {
+		panic(fmt.Sprintf("invalid changelog.json: %v", err))
+	}
+	return entries
+}()
+
+// changelogHandler godoc
+//
+//	@Summary		API changelog
+//	@Description	Lists API changes per release, newest first
+//	@Tags			ops
+//	@Produce		json
+//	@Success		200	{array}	ChangelogEntry
+//	@Router			/changelog [get]
+func (app *application) changelogHandler(r *http.Request, _ *noBody) ([]ChangelogEntry, error) {
+	return changelog, nil
+}
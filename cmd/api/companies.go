@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -76,8 +77,8 @@ func (app *application) getCompanyHandler(w http.ResponseWriter, r *http.Request
 
 	company, err := app.store.Companies.GetByID(r.Context(), companyID)
 	if err != nil {
-		switch err {
-		case store.ErrNotFound:
+		switch {
+		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
@@ -124,8 +125,8 @@ func (app *application) verifyCompanyHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := app.store.Companies.UpdateVerificationStatus(r.Context(), companyID, payload.Status); err != nil {
-		switch err {
-		case store.ErrNotFound:
+		switch {
+		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -52,7 +53,7 @@ func (app *application) createComplaintHandler(w http.ResponseWriter, r *http.Re
 	// Verify target exists
 	if payload.TargetType == "listing" {
 		if _, err := app.store.Listings.GetByID(r.Context(), payload.TargetID); err != nil {
-			if err == store.ErrNotFound {
+			if errors.Is(err, store.ErrNotFound) {
 				app.notFoundResponse(w, r, fmt.Errorf("listing not found"))
 				return
 			}
@@ -61,7 +62,7 @@ func (app *application) createComplaintHandler(w http.ResponseWriter, r *http.Re
 		}
 	} else if payload.TargetType == "company" {
 		if _, err := app.store.Companies.GetByID(r.Context(), payload.TargetID); err != nil {
-			if err == store.ErrNotFound {
+			if errors.Is(err, store.ErrNotFound) {
 				app.notFoundResponse(w, r, fmt.Errorf("company not found"))
 				return
 			}
@@ -152,7 +153,7 @@ func (app *application) adminGetComplaintHandler(w http.ResponseWriter, r *http.
 
 	complaint, err := app.store.Complaints.GetByID(r.Context(), complaintID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -179,6 +180,7 @@ func (app *application) adminGetComplaintHandler(w http.ResponseWriter, r *http.
 //	@Failure		404			{object}	error
 //	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
+//	@Deprecated
 //	@Router			/admin/complaints/{complaintID}/status [patch]
 func (app *application) adminUpdateComplaintStatusHandler(w http.ResponseWriter, r *http.Request) {
 	complaintID, err := strconv.ParseInt(chi.URLParam(r, "complaintID"), 10, 64)
@@ -199,7 +201,7 @@ func (app *application) adminUpdateComplaintStatusHandler(w http.ResponseWriter,
 	}
 
 	if err := app.store.Complaints.UpdateStatus(r.Context(), complaintID, payload.Status); err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
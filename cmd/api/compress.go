@@ -0,0 +1,179 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type compressConfig struct {
+	// level is the gzip level, 1 to 9; 0 turns compression off
+	level int
+	// minBytes is the smallest body worth compressing
+	minBytes int
+}
+
+// compressibleTypes are the content types gzip pays off for. Media are
+// already compressed and are served from storage anyway.
+var compressibleTypes = map[string]bool{
+	"application/json": true,
+	"text/csv":         true,
+	"text/html":        true,
+	"text/plain":       true,
+}
+
+// compressMiddleware gzips responses of compressibleTypes once they reach
+// minBytes, for clients that accept gzip. Brotli is not offered: the
+// standard library has no encoder.
+func (app *application) compressMiddleware(next http.Handler) http.Handler {
+	cfg := app.config.compress
+	if cfg.level < gzip.BestSpeed || cfg.level > gzip.BestCompression {
+		return next
+	}
+	pool := &sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(nil, cfg.level)
+		return gz
+	}}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Not deferred: after a panic the recoverer should write its 500 to
+		// a response that has not started yet.
+		cw := &compressWriter{ResponseWriter: w, minBytes: cfg.minBytes, pool: pool}
+		next.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding value allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !found {
+			return true
+		}
+		if v, err := strconv.ParseFloat(q, 64); err == nil && v > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds the body back until it reaches minBytes or the
+// handler is done, then decides whether to gzip it.
+type compressWriter struct {
+	http.ResponseWriter
+	minBytes int
+	pool     *sync.Pool
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.decided {
+		if cw.gz != nil {
+			return cw.gz.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minBytes {
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide sends the headers and the held back body, compressed if the
+// response qualifies.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if compressibleTypes[mediaType] {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	compress := compressibleTypes[mediaType] &&
+		h.Get("Content-Encoding") == "" &&
+		len(cw.buf) >= cw.minBytes &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified
+	if !compress {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+		return err
+	}
+
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	// The compressed bytes differ from what a strong ETag promises.
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.gz = cw.pool.Get().(*gzip.Writer)
+	cw.gz.Reset(cw.ResponseWriter)
+	_, err := cw.gz.Write(cw.buf)
+	cw.buf = nil
+	return err
+}
+
+// Flush lets streaming handlers push what they have written so far.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// Nothing was written; let net/http send its default response.
+			return
+		}
+		cw.decide()
+	}
+	if cw.gz != nil {
+		cw.gz.Close()
+		cw.pool.Put(cw.gz)
+		cw.gz = nil
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{compress: compressConfig{level: 5, minBytes: 100}})
+	large := `{"data":"` + strings.Repeat("a", 500) + `"}`
+
+	h := app.compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := large
+		if r.URL.Query().Has("small") {
+			body = `{"data":1}`
+		}
+		contentType := "application/json"
+		if r.URL.Query().Has("image") {
+			contentType = "image/png"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(body))
+	}))
+
+	do := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("/", "br, gzip")
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("large JSON should be gzipped, headers %v", rr.Header())
+	}
+	if got := rr.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("compressed ETag should be weak, got %q", got)
+	}
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if string(body) != large {
+		t.Errorf("body did not survive compression")
+	}
+
+	for _, tt := range []struct{ path, acceptEncoding string }{
+		{"/?small", "gzip"},
+		{"/?image", "gzip"},
+		{"/", ""},
+		{"/", "gzip;q=0"},
+	} {
+		rr := do(tt.path, tt.acceptEncoding)
+		if rr.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s with %q should not be compressed", tt.path, tt.acceptEncoding)
+		}
+		if rr.Header().Get("ETag") != `"abc"` {
+			t.Errorf("%s with %q should keep its strong ETag", tt.path, tt.acceptEncoding)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Imports match the accounts in an export from another platform against
+// registered users, like contact matching does for address books. The API
+// has no followers, so nothing is followed: the matched users are reported
+// for the client to suggest, message or favorite the listings of.
+const (
+	importSourceCSV         = "csv"
+	importSourceActivityPub = "activitypub"
+	// maxImportEntries is as many as contact matching takes per request
+	maxImportEntries = 1000
+)
+
+var (
+	errImportFormat = newHTTPError(http.StatusUnsupportedMediaType,
+		"send a CSV file as text/csv or an ActivityPub collection as application/activity+json")
+	errImportTooLarge = newHTTPError(http.StatusBadRequest, "an import can have at most 1000 entries")
+)
+
+// importSource tells the format of the body from its content type.
+func importSource(r *http.Request) (string, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return importSourceCSV, true
+	case "application/activity+json", "application/ld+json", "application/json":
+		return importSourceActivityPub, true
+	}
+	return "", false
+}
+
+// parseImportCSV returns the first column of every row, skipping a header
+// such as the "Account address" of Mastodon's follow export.
+func parseImportCSV(body []byte) ([]string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var entries []string
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, newHTTPError(http.StatusBadRequest, "the CSV file could not be read")
+		}
+		entry := strings.TrimSpace(record[0])
+		if entry == "" || row == 0 && isImportHeader(entry) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func isImportHeader(entry string) bool {
+	switch strings.ToLower(entry) {
+	case "account address", "address", "email", "username", "handle", "account":
+		return true
+	}
+	return false
+}
+
+// activityPubCollection is the part of an outbox, following or followers
+// collection that names accounts. Items are actor IDs or activities.
+type activityPubCollection struct {
+	Items        []json.RawMessage `json:"items"`
+	OrderedItems []json.RawMessage `json:"orderedItems"`
+}
+
+type activityPubObject struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// parseImportActivityPub returns the actors of a collection: plain actor
+// IDs, actors, and the objects of the Follow activities in an outbox.
+// Other activities, such as posts, are skipped.
+func parseImportActivityPub(body []byte) ([]string, error) {
+	var collection activityPubCollection
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "the ActivityPub collection could not be read")
+	}
+
+	var entries []string
+	for _, item := range append(collection.OrderedItems, collection.Items...) {
+		if actor, ok := activityPubID(item); ok {
+			entries = append(entries, actor)
+			continue
+		}
+		var object activityPubObject
+		if json.Unmarshal(item, &object) != nil {
+			continue
+		}
+		switch object.Type {
+		case "Follow":
+			if actor, ok := activityPubID(object.Object); ok {
+				entries = append(entries, actor)
+			} else if json.Unmarshal(object.Object, &object) == nil && object.ID != "" {
+				entries = append(entries, object.ID)
+			}
+		case "Person", "Organization", "Service":
+			if object.ID != "" {
+				entries = append(entries, object.ID)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func activityPubID(raw json.RawMessage) (string, bool) {
+	var id string
+	if json.Unmarshal(raw, &id) != nil || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// importAccount reads an entry as an email address, a handle such as
+// @name@host or an actor URL such as https://host/users/name. Handles and
+// URLs are matched by the name only; an address is tried as both.
+func importAccount(entry string) (email, username string, ok bool) {
+	entry = strings.TrimPrefix(strings.TrimSpace(entry), "acct:")
+
+	if u, err := url.Parse(entry); err == nil && (u.Scheme == "https" || u.Scheme == "http") {
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		username = strings.TrimPrefix(segments[len(segments)-1], "@")
+	} else {
+		entry = strings.TrimPrefix(entry, "@")
+		username = entry
+		if local, domain, found := strings.Cut(entry, "@"); found {
+			username = local
+			if local != "" && strings.Contains(domain, ".") {
+				email = strings.ToLower(entry)
+			}
+		}
+	}
+
+	username = service.NormalizeUsername(username)
+	if service.CheckUsername(username) != nil {
+		username = ""
+	}
+	return email, username, email != "" || username != ""
+}
+
+// createContactImportHandler godoc
+//
+//	@Summary		Import accounts from another platform
+//	@Description	Accepts a CSV file (text/csv, first column: emails or handles, as in Mastodon's follow export) or an ActivityPub following, followers or outbox collection (application/activity+json) with at most 1000 accounts. Matching runs in the background; poll the returned import for the summary. The uploaded entries are not stored.
+//	@Tags			users
+//	@Accept			text/csv
+//	@Accept			json
+//	@Produce		json
+//	@Success		202	{object}	store.ContactImport
+//	@Failure		400	{object}	error
+//	@Failure		413	{object}	error
+//	@Failure		415	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/import [post]
+func (app *application) createContactImportHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	source, ok := importSource(r)
+	if !ok {
+		app.errorResponse(w, r, errImportFormat)
+		return
+	}
+
+	maxBytes, ok := reqctx.BodyLimit(r.Context())
+	if !ok {
+		maxBytes = defaultMaxBodyBytes
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var entries []string
+	if source == importSourceCSV {
+		entries, err = parseImportCSV(body)
+	} else {
+		entries, err = parseImportActivityPub(body)
+	}
+	if err == nil && len(entries) > maxImportEntries {
+		err = errImportTooLarge
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	imp := &store.ContactImport{UserID: user.ID, Source: source, UserIDs: []int64{}}
+	if err := app.store.ContactImports.Create(r.Context(), imp); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	// the tenant of the request still applies after it returns
+	ctx := context.WithoutCancel(r.Context())
+	go app.runContactImport(ctx, *imp, entries)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, imp); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// runContactImport matches the entries of imp and saves the summary.
+func (app *application) runContactImport(ctx context.Context, imp store.ContactImport, entries []string) {
+	imp.Status = store.ImportCompleted
+	if err := app.matchImport(ctx, &imp, entries); err != nil {
+		app.logger.Errorw("contact import failed", "import_id", imp.ID, "error", err)
+		imp.Status, imp.Error = store.ImportFailed, "the import could not be matched, try again later"
+		imp.Invalid, imp.Unmatched, imp.UserIDs = 0, 0, []int64{}
+	}
+	if err := app.store.ContactImports.Complete(ctx, &imp); err != nil {
+		app.logger.Errorw("contact import not saved", "import_id", imp.ID, "error", err)
+	}
+}
+
+func (app *application) matchImport(ctx context.Context, imp *store.ContactImport, entries []string) error {
+	imp.Total = len(entries)
+
+	// every entry becomes an email hash, a username or both
+	type account struct{ hash, username string }
+	accounts := make([]account, 0, len(entries))
+	var hashes, usernames []string
+	for _, entry := range entries {
+		email, username, ok := importAccount(entry)
+		if !ok {
+			imp.Invalid++
+			continue
+		}
+		a := account{username: username}
+		if email != "" {
+			a.hash = crypto.HashEmail(email)
+			hashes = append(hashes, a.hash)
+		}
+		if username != "" {
+			usernames = append(usernames, username)
+		}
+		accounts = append(accounts, a)
+	}
+
+	byHash := map[string]int64{}
+	byUsername := map[string]int64{}
+	if len(hashes) > 0 {
+		matches, err := app.store.Users.MatchEmailHashes(ctx, hashes, imp.UserID)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			byHash[m.Hash] = m.UserID
+		}
+	}
+	if len(usernames) > 0 {
+		matches, err := app.store.Users.MatchUsernames(ctx, usernames, imp.UserID)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			byUsername[m.Username] = m.UserID
+		}
+	}
+
+	seen := map[int64]bool{}
+	imp.UserIDs = []int64{}
+	for _, a := range accounts {
+		// an address belonging to someone beats a handle that happens to
+		// share its name
+		userID, ok := byHash[a.hash]
+		if !ok {
+			userID, ok = byUsername[a.username]
+		}
+		if !ok {
+			imp.Unmatched++
+			continue
+		}
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		// users on either side of a block are not suggested
+		blocked, err := app.store.Blocks.Between(ctx, imp.UserID, userID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			imp.Unmatched++
+			continue
+		}
+		imp.UserIDs = append(imp.UserIDs, userID)
+	}
+	return nil
+}
+
+// getContactImportHandler godoc
+//
+//	@Summary		Summary of an import
+//	@Description	Status of an import and, once completed, how many entries were read, could not be understood or matched no one, and the IDs of the users found. Blocked users and private profiles are never reported.
+//	@Tags			users
+//	@Produce		json
+//	@Param			importID	path		int	true	"Import ID"
+//	@Success		200			{object}	store.ContactImport
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/import/{importID} [get]
+func (app *application) getContactImportHandler(r *http.Request, _ *noBody) (*store.ContactImport, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "importID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid import id")
+	}
+	return app.store.ContactImports.GetByID(r.Context(), id, getUserFromContext(r).ID)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestContactImport(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	users := map[string]*store.User{}
+	for _, name := range []string{"me", "agent", "alice", "hidden", "blocker"} {
+		user := &store.User{Username: name, Email: name + "@example.com", IsActive: true, Private: name == "hidden", Role: store.Role{Name: store.RoleUser}}
+		if err := app.store.Users.Create(ctx, nil, user); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = user
+	}
+	me := users["me"]
+	if err := app.store.Blocks.Block(ctx, users["blocker"].ID, me.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/users/me/import", app.createContactImportHandler)
+	mux.Get("/v1/users/me/import/{importID}", handle(app, http.StatusOK, app.getContactImportHandler))
+	send := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), me)), mux)
+	}
+	summary := func(id int64) store.ContactImport {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			rr := send(http.MethodGet, "/v1/users/me/import/"+strconv.FormatInt(id, 10), "", "")
+			checkResponseCode(t, http.StatusOK, rr.Code)
+			var resp struct {
+				Data store.ContactImport `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data.Status != store.ImportPending || time.Now().After(deadline) {
+				return resp.Data
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	start := func(contentType, body string) int64 {
+		t.Helper()
+		rr := send(http.MethodPost, "/v1/users/me/import", contentType, body)
+		checkResponseCode(t, http.StatusAccepted, rr.Code)
+		var resp struct {
+			Data store.ContactImport `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data.ID
+	}
+
+	csv := "Account address,Show boosts\n@agent@mastodon.social,true\nALICE@example.com,true\nhidden@example.com,true\nblocker,true\nnobody@example.com,true\n!!,true\n"
+	got := summary(start("text/csv", csv))
+	if got.Status != store.ImportCompleted || got.Total != 6 || got.Invalid != 1 || got.Unmatched != 3 ||
+		len(got.UserIDs) != 2 || got.UserIDs[0] != users["agent"].ID || got.UserIDs[1] != users["alice"].ID {
+		t.Errorf("csv import: got %+v", got)
+	}
+
+	outbox := `{"type": "OrderedCollection", "orderedItems": [
+		{"type": "Follow", "object": "https://social.example/users/agent"},
+		{"type": "Create", "object": {"type": "Note", "content": "hi"}},
+		{"type": "Follow", "object": {"type": "Person", "id": "https://other.example/@alice"}}
+	]}`
+	got = summary(start("application/activity+json", outbox))
+	if got.Source != "activitypub" || got.Total != 2 || len(got.UserIDs) != 2 {
+		t.Errorf("outbox import: got %+v", got)
+	}
+
+	checkResponseCode(t, http.StatusUnsupportedMediaType, send(http.MethodPost, "/v1/users/me/import", "text/plain", "agent").Code)
+	checkResponseCode(t, http.StatusBadRequest, send(http.MethodPost, "/v1/users/me/import", "text/csv", strings.Repeat("a\n", maxImportEntries+1)).Code)
+
+	// imports of other users are not found
+	other := httptest.NewRequest(http.MethodGet, "/v1/users/me/import/1", nil)
+	rr := executeRequest(other.WithContext(reqctx.WithUser(other.Context(), users["agent"])), mux)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// MatchContactsPayload carries the SHA-256 hex digests of the contacts'
+// email addresses, each trimmed and lowercased before hashing. Plain
+// addresses are never sent. Larger address books are sent in batches of
+// up to 1000.
+type MatchContactsPayload struct {
+	Hashes []string `json:"hashes" validate:"required,min=1,max=1000,dive,len=64,hexadecimal"`
+}
+
+// matchContactsHandler godoc
+//
+//	@Summary		Find contacts who use the service
+//	@Description	Matches hashed contact emails against registered users and returns them as suggestions, e.g. agents the user already knows. Hashes are compared in memory and never stored; unmatched hashes are discarded.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MatchContactsPayload	true	"Hashed contact emails"
+//	@Success		200		{array}		store.ContactMatch
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/contacts/match [post]
+func (app *application) matchContactsHandler(r *http.Request, req *MatchContactsPayload) ([]store.ContactMatch, error) {
+	user := getUserFromContext(r)
+
+	hashes := make([]string, len(req.Hashes))
+	for i, hash := range req.Hashes {
+		hashes[i] = strings.ToLower(hash)
+	}
+
+	matches, err := app.store.Users.MatchEmailHashes(r.Context(), hashes, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users on either side of a block are not suggested.
+	visible := []store.ContactMatch{}
+	for _, match := range matches {
+		blocked, err := app.store.Blocks.Between(r.Context(), user.ID, match.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !blocked {
+			visible = append(visible, match)
+		}
+	}
+
+	return visible, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestMatchContacts(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	var users []*store.User
+	for _, email := range []string{"me@example.com", "agent@example.com", "pending@example.com"} {
+		user := &store.User{Username: strings.Split(email, "@")[0], Email: email, IsActive: email != "pending@example.com", Role: store.Role{Name: store.RoleUser}}
+		if err := app.store.Users.Create(ctx, nil, user); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	me := users[0]
+
+	match := func(hashes ...string) (int, []store.ContactMatch) {
+		t.Helper()
+		body, _ := json.Marshal(MatchContactsPayload{Hashes: hashes})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/users/me/contacts/match", strings.NewReader(string(body)))
+		req = req.WithContext(reqctx.WithUser(req.Context(), me))
+		rr := executeRequest(req, handle(app, http.StatusOK, app.matchContactsHandler))
+
+		var resp struct {
+			Data []store.ContactMatch `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp.Data
+	}
+
+	code, matches := match(
+		crypto.HashEmail(" Agent@Example.com"),
+		crypto.HashEmail("me@example.com"),
+		crypto.HashEmail("pending@example.com"),
+		crypto.HashEmail("stranger@example.com"),
+	)
+	checkResponseCode(t, http.StatusOK, code)
+	if len(matches) != 1 || matches[0].Username != "agent" || matches[0].Hash != crypto.HashEmail("agent@example.com") {
+		t.Errorf("expected only the active agent to match, got %+v", matches)
+	}
+
+	if code, _ := match("agent@example.com"); code != http.StatusBadRequest {
+		t.Errorf("plain addresses should be rejected, got %d", code)
+	}
+
+	tooMany := make([]string, 1001)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%064x", i)
+	}
+	if code, _ := match(tooMany...); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for more than 1000 hashes, got %d", code)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/contentfilter"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// contentFlagExcerptLength is how much of flagged content moderators see in
+// the queue.
+const contentFlagExcerptLength = 500
+
+type contentFilterConfig struct {
+	enabled bool
+	// maxLinks flags content with more links, 0 allows any number
+	maxLinks int
+	// bannedWords is a comma separated list of words that flag content
+	bannedWords string
+	// duplicateLimit is how often an author may post the same text within
+	// duplicateWindow, 0 turns duplicate detection off
+	duplicateLimit  int
+	duplicateWindow time.Duration
+	// apiURL enables the external moderation API, see contentfilter.API
+	apiURL     string
+	apiKey     string
+	apiTimeout time.Duration
+}
+
+// newContentFilter returns the filter app.contentFilter screens listings
+// and messages with, nil when it is disabled.
+func newContentFilter(cfg contentFilterConfig) (contentfilter.Filter, error) {
+	if !cfg.enabled {
+		return nil, nil
+	}
+
+	filters := []contentfilter.Filter{contentfilter.NewHeuristic(contentfilter.HeuristicOptions{
+		MaxLinks:        cfg.maxLinks,
+		BannedWords:     strings.Split(cfg.bannedWords, ","),
+		DuplicateLimit:  cfg.duplicateLimit,
+		DuplicateWindow: cfg.duplicateWindow,
+	})}
+	if cfg.apiURL != "" {
+		api, err := contentfilter.NewAPI(cfg.apiURL, cfg.apiKey, cfg.apiTimeout)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, api)
+	}
+	return contentfilter.Chain(filters...), nil
+}
+
+// screenContent returns why the content filter holds c, nil when it passes.
+// A filter that cannot be reached is logged and lets content through, so an
+// outage of the moderation API does not stop posting.
+func (app *application) screenContent(ctx context.Context, c contentfilter.Content) []string {
+	if app.contentFilter == nil {
+		return nil
+	}
+	verdict, err := app.contentFilter.Check(ctx, c)
+	if err != nil {
+		app.logger.Warnw("content filter failed", "kind", c.Kind, "author_id", c.AuthorID, "error", err)
+	}
+	return verdict.Reasons
+}
+
+// flagContent puts held content in the moderation queue. A failure is
+// logged; the content stays held either way.
+func (app *application) flagContent(ctx context.Context, targetType string, targetID, authorID int64, reasons []string, text string) {
+	excerpt := strings.TrimSpace(text)
+	if utf8.RuneCountInString(excerpt) > contentFlagExcerptLength {
+		excerpt = string([]rune(excerpt)[:contentFlagExcerptLength]) + "…"
+	}
+
+	flag := &store.ContentFlag{
+		TargetType: targetType,
+		TargetID:   targetID,
+		AuthorID:   &authorID,
+		Reasons:    reasons,
+		Excerpt:    excerpt,
+	}
+	if err := app.store.ContentFlags.Create(ctx, flag); err != nil {
+		app.logger.Errorw("could not flag content", "target_type", targetType, "target_id", targetID, "error", err)
+		return
+	}
+	app.logger.Infow("content held for moderation", "flag_id", flag.ID, "target_type", targetType, "target_id", targetID, "reasons", reasons)
+}
+
+// screenListing runs the filter over a created or edited listing. A flagged
+// listing that is live goes back to moderation; new listings are there
+// already.
+func (app *application) screenListing(ctx context.Context, author *store.User, listing *store.Listing) {
+	text := listing.Title + "\n" + listing.Description
+	reasons := app.screenContent(ctx, contentfilter.Content{Kind: contentfilter.KindListing, AuthorID: author.ID, Text: text})
+	if len(reasons) == 0 {
+		return
+	}
+
+	if listing.Status == store.ListingStatusActive || listing.Status == store.ListingStatusScheduled {
+		if err := app.store.Listings.UpdateStatus(ctx, listing.ID, store.ListingStatusModeration); err != nil {
+			app.logger.Errorw("could not send flagged listing to moderation", "listing_id", listing.ID, "error", err)
+			return
+		}
+		listing.Status = store.ListingStatusModeration
+		app.forgetListings(listing.ID)
+		app.invalidateFeed(ctx)
+	}
+	app.flagContent(ctx, contentfilter.KindListing, listing.ID, author.ID, reasons, text)
+}
+
+// listContentFlagsHandler godoc
+//
+//	@Summary		List content held by the filter
+//	@Description	Listings and application messages the content filter flagged, newest first. status is pending (default), approved, removed or all.
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			status	query		string	false	"pending|approved|removed|all"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		store.ContentFlag
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/flags [get]
+func (app *application) listContentFlagsHandler(r *http.Request, _ *noBody) (paged[store.ContentFlag], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.ContentFlag]{}, err
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = store.ContentFlagPending
+	case "all":
+		status = ""
+	case store.ContentFlagPending, store.ContentFlagApproved, store.ContentFlagRemoved:
+	default:
+		return paged[store.ContentFlag]{}, newHTTPError(http.StatusBadRequest, "status must be pending, approved, removed or all")
+	}
+
+	flags, err := app.store.ContentFlags.List(r.Context(), status, storeQuery(params))
+	return newPage(params, flags), err
+}
+
+// approveContentFlagHandler godoc
+//
+//	@Summary		Approve held content
+//	@Description	Closes the flag and publishes a held message. An approved listing still goes through the listing approval queue.
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			flagID	path		int	true	"Flag ID"
+//	@Success		200		{object}	store.ContentFlag
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"Flag already resolved"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/flags/{flagID}/approve [post]
+func (app *application) approveContentFlagHandler(r *http.Request, _ *noBody) (*store.ContentFlag, error) {
+	return app.resolveContentFlag(r, store.ContentFlagApproved)
+}
+
+// removeContentFlagHandler godoc
+//
+//	@Summary		Remove held content
+//	@Description	Closes the flag and rejects a held listing; a held message stays hidden.
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			flagID	path		int	true	"Flag ID"
+//	@Success		200		{object}	store.ContentFlag
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"Flag already resolved"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/flags/{flagID}/remove [post]
+func (app *application) removeContentFlagHandler(r *http.Request, _ *noBody) (*store.ContentFlag, error) {
+	return app.resolveContentFlag(r, store.ContentFlagRemoved)
+}
+
+func (app *application) resolveContentFlag(r *http.Request, status string) (*store.ContentFlag, error) {
+	moderator := getUserFromContext(r)
+	ctx := r.Context()
+
+	flagID, err := strconv.ParseInt(chi.URLParam(r, "flagID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid flag id")
+	}
+
+	flag, err := app.store.ContentFlags.GetByID(ctx, flagID)
+	if err != nil {
+		return nil, err
+	}
+	if flag.Status != store.ContentFlagPending {
+		return nil, newHTTPError(http.StatusConflict, "flag is already resolved")
+	}
+
+	switch {
+	case status == store.ContentFlagApproved && flag.TargetType == contentfilter.KindMessage:
+		err = app.store.Messages.Release(ctx, flag.TargetID)
+	case status == store.ContentFlagRemoved && flag.TargetType == contentfilter.KindListing:
+		if err = app.store.Listings.UpdateStatus(ctx, flag.TargetID, store.ListingStatusRejected); err == nil {
+			app.forgetListings(flag.TargetID)
+			app.invalidateFeed(ctx)
+		}
+	}
+	// the content may have been deleted since it was flagged
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if err := app.store.ContentFlags.Resolve(ctx, flagID, status, moderator.ID); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, newHTTPError(http.StatusConflict, "flag is already resolved")
+		}
+		return nil, err
+	}
+
+	app.logAdminAction(moderator, status+"_content_flag", "content_flag", flagID, flag.TargetType)
+	return app.store.ContentFlags.GetByID(ctx, flagID)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestContentFilterHoldsContent(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	var err error
+	if app.contentFilter, err = newContentFilter(contentFilterConfig{enabled: true, bannedWords: "scam"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Realty", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	applicant := &store.User{Username: "applicant", Email: "applicant@example.com", IsActive: true}
+	agent := &store.User{Username: "agent", Email: "agent@example.com", IsActive: true, CompanyID: &company.ID, Role: store.Role{Name: store.RoleAgency}}
+	for _, u := range []*store.User{applicant, agent} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	moderator := &store.User{ID: 99, Role: store.Role{Name: store.RoleModerator}}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Flat", DealType: "rent", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	application := &store.Application{ListingID: listing.ID, UserID: applicant.ID, FullName: "A", Email: applicant.Email, Status: "new", DealType: "rent"}
+	if err := app.store.Applications.Create(ctx, application); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Patch("/v1/listings/{listingID}", app.updateListingHandler)
+	mux.Post("/v1/applications/{applicationID}/messages", app.createApplicationMessageHandler)
+	mux.Post("/v1/moderation/flags/{flagID}/approve", handle(app, http.StatusOK, app.approveContentFlagHandler))
+	mux.Post("/v1/moderation/flags/{flagID}/remove", handle(app, http.StatusOK, app.removeContentFlagHandler))
+	send := func(method, path string, user *store.User, body any) int {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewReader(b))
+		req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		return executeRequest(req, mux).Code
+	}
+
+	// an edit with a banned word takes the listing off the feed
+	checkResponseCode(t, http.StatusOK, send(http.MethodPatch, "/v1/listings/1", agent, map[string]string{"description": "No scam, I promise"}))
+	if l, _ := app.store.Listings.GetByID(ctx, listing.ID); l.Status != store.ListingStatusModeration {
+		t.Fatalf("flagged listing is %s", l.Status)
+	}
+
+	// a held message is only visible to its sender until approved
+	checkResponseCode(t, http.StatusCreated, send(http.MethodPost, "/v1/applications/1/messages", applicant, map[string]string{"body": "This is a scam"}))
+	visible := func(viewer int64) int {
+		msgs, _ := app.store.Messages.List(ctx, application.ID, viewer, 0, 0)
+		return len(msgs)
+	}
+	if visible(agent.ID) != 0 || visible(applicant.ID) != 1 {
+		t.Fatal("held message is visible to the agent")
+	}
+
+	flags, _ := app.store.ContentFlags.List(ctx, store.ContentFlagPending, store.PaginatedQuery{Limit: 10})
+	if len(flags) != 2 || flags[0].TargetType != "message" || flags[1].TargetType != "listing" || flags[1].Reasons[0] != "banned_word" {
+		t.Fatalf("flags %+v", flags)
+	}
+
+	checkResponseCode(t, http.StatusOK, send(http.MethodPost, "/v1/moderation/flags/2/approve", moderator, nil))
+	if visible(agent.ID) != 1 {
+		t.Error("approved message is still hidden")
+	}
+	checkResponseCode(t, http.StatusOK, send(http.MethodPost, "/v1/moderation/flags/1/remove", moderator, nil))
+	if l, _ := app.store.Listings.GetByID(ctx, listing.ID); l.Status != store.ListingStatusRejected {
+		t.Errorf("removed listing is %s", l.Status)
+	}
+	checkResponseCode(t, http.StatusConflict, send(http.MethodPost, "/v1/moderation/flags/1/approve", moderator, nil))
+}
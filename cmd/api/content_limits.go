@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-playground/validator/v10"
+)
+
+// User-written text has a length limit per kind, store.Limits. Requests
+// over a refusing limit fail validation with the field named; the stores
+// enforce the same limits for text that arrives any other way, and shorten
+// the kinds listed in CONTENT_TRUNCATE instead of refusing them.
+// GET /meta/limits publishes them so clients can check before submitting.
+// Users and companies have no bio to limit.
+type contentLimitsConfig struct {
+	listingTitle       int
+	listingDescription int
+	applicationComment int
+	message            int
+	// truncate is a comma separated list of kinds, such as
+	// listing_description, shortened rather than refused
+	truncate string
+}
+
+// limits returns the configured store.ContentLimits.
+func (c contentLimitsConfig) limits() (store.ContentLimits, error) {
+	limits := store.ContentLimits{
+		store.LimitListingTitle:       {Max: c.listingTitle},
+		store.LimitListingDescription: {Max: c.listingDescription},
+		store.LimitApplicationComment: {Max: c.applicationComment},
+		store.LimitMessage:            {Max: c.message},
+	}
+	for kind, limit := range limits {
+		if limit.Max <= 0 {
+			return nil, fmt.Errorf("CONTENT_MAX_%s must be positive", strings.ToUpper(kind))
+		}
+	}
+
+	for _, kind := range strings.Split(c.truncate, ",") {
+		if kind = strings.TrimSpace(kind); kind == "" {
+			continue
+		}
+		limit, ok := limits[kind]
+		if !ok {
+			return nil, fmt.Errorf("CONTENT_TRUNCATE: unknown kind %q", kind)
+		}
+		limit.Truncate = true
+		limits[kind] = limit
+	}
+	return limits, nil
+}
+
+func (c contentLimitsConfig) validate() error {
+	_, err := c.limits()
+	return err
+}
+
+// validateLimit is the limit=<kind> tag: text within store.Limits, or any
+// text for a kind the stores truncate.
+func validateLimit(fl validator.FieldLevel) bool {
+	value, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+	limit, ok := store.Limits[fl.Param()]
+	return !ok || limit.Truncate || utf8.RuneCountInString(value) <= limit.Max
+}
+
+// contentLimitsHandler godoc
+//
+//	@Summary		Lists content length limits
+//	@Description	The longest text, in characters, accepted per kind: listing_title, listing_description, application_comment and message (application and direct messages). Longer text is refused with 400, or shortened with an ellipsis where truncate is true.
+//	@Tags			meta
+//	@Produce		json
+//	@Success		200	{object}	store.ContentLimits
+//	@Router			/meta/limits [get]
+func (app *application) contentLimitsHandler(r *http.Request, _ *noBody) (store.ContentLimits, error) {
+	return store.Limits, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestContentLimits(t *testing.T) {
+	cfg := contentLimitsConfig{listingTitle: 10, listingDescription: 100, applicationComment: 50, message: 20, truncate: "listing_description"}
+	limits, err := cfg.limits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !limits[store.LimitListingDescription].Truncate || limits[store.LimitMessage].Truncate || limits[store.LimitMessage].Max != 20 {
+		t.Errorf("limits %+v", limits)
+	}
+	for _, bad := range []contentLimitsConfig{{listingTitle: 10, listingDescription: 100, applicationComment: 50}, {listingTitle: 10, listingDescription: 100, applicationComment: 50, message: 20, truncate: "bio"}} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+
+	previous := store.Limits
+	store.Limits = limits
+	t.Cleanup(func() { store.Limits = previous })
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	fields, ok := translateValidationErrors(r, Validate.Struct(CreateDirectMessagePayload{Body: strings.Repeat("a", 21)}))
+	if !ok || fields["body"] != "body must be at most 20 characters long" {
+		t.Errorf("validation %v", fields)
+	}
+	if err := Validate.Struct(CreateDirectMessagePayload{Body: strings.Repeat("я", 20)}); err != nil {
+		t.Errorf("limits count characters: %v", err)
+	}
+	description := strings.Repeat("a", 500)
+	if err := Validate.Struct(UpdateListingPayload{Description: &description}); err != nil {
+		t.Errorf("truncated kinds pass validation: %v", err)
+	}
+
+	app := newTestApplication(t, config{})
+	rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/meta/limits", nil), app.mount())
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var resp struct {
+		Data store.ContentLimits `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data[store.LimitListingTitle].Max != 10 || !resp.Data[store.LimitListingDescription].Truncate {
+		t.Errorf("GET /meta/limits = %+v", resp.Data)
+	}
+}
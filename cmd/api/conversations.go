@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/pagination"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/push"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+var directMessagePage = pagination.Options{DefaultLimit: 50, MaxLimit: 100, Cursor: true}
+
+type StartConversationPayload struct {
+	UserID int64 `json:"user_id" validate:"required,min=1"`
+}
+
+type CreateDirectMessagePayload struct {
+	Body string `json:"body" validate:"required,limit=message"`
+}
+
+type UnreadMessages struct {
+	Unread int `json:"unread"`
+}
+
+// canMessage reports why sender may not send direct messages to recipient,
+// or nil if they may. Inactive users, users on either side of a block and
+// private users who have not talked to sender before look like missing
+// ones.
+func (app *application) canMessage(ctx context.Context, sender, recipient *store.User) error {
+	switch {
+	case recipient.ID == sender.ID:
+		return newHTTPError(http.StatusBadRequest, "cannot message yourself")
+	case !recipient.IsActive:
+		return store.ErrNotFound
+	}
+
+	blocked, err := app.store.Blocks.Between(ctx, sender.ID, recipient.ID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return store.ErrNotFound
+	}
+
+	if recipient.Private {
+		known, err := app.store.Conversations.Exists(ctx, sender.ID, recipient.ID)
+		if err != nil {
+			return err
+		}
+		if !known {
+			return store.ErrNotFound
+		}
+	}
+	return nil
+}
+
+// conversationFromRequest loads the {conversationID} conversation as seen by
+// the current user. Conversations of other users are not found.
+func (app *application) conversationFromRequest(r *http.Request) (*store.Conversation, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid conversation id")
+	}
+	return app.store.Conversations.Get(r.Context(), id, getUserFromContext(r).ID)
+}
+
+// startConversationHandler godoc
+//
+//	@Summary		Start a conversation
+//	@Description	Returns the direct message conversation with user_id, starting it if there is none
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		StartConversationPayload	true	"Other user"
+//	@Success		200		{object}	store.Conversation
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [post]
+func (app *application) startConversationHandler(r *http.Request, payload *StartConversationPayload) (*store.Conversation, error) {
+	user := getUserFromContext(r)
+
+	recipient, err := app.store.Users.GetByID(r.Context(), payload.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.canMessage(r.Context(), user, recipient); err != nil {
+		return nil, err
+	}
+
+	return app.store.Conversations.Open(r.Context(), user.ID, recipient.ID)
+}
+
+// listConversationsHandler godoc
+//
+//	@Summary		List conversations
+//	@Description	The current user's direct message conversations with unread counts, most recently active first
+//	@Tags			conversations
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.Conversation
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [get]
+func (app *application) listConversationsHandler(r *http.Request, _ *noBody) (paged[store.Conversation], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.Conversation]{}, err
+	}
+
+	conversations, err := app.store.Conversations.List(r.Context(), getUserFromContext(r).ID, storeQuery(params))
+	return newPage(params, conversations), err
+}
+
+// unreadMessagesHandler godoc
+//
+//	@Summary		Unread direct messages
+//	@Description	Number of unread direct messages across all conversations
+//	@Tags			conversations
+//	@Produce		json
+//	@Success		200	{object}	UnreadMessages
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/unread [get]
+func (app *application) unreadMessagesHandler(r *http.Request, _ *noBody) (UnreadMessages, error) {
+	count, err := app.store.Conversations.UnreadCount(r.Context(), getUserFromContext(r).ID)
+	return UnreadMessages{Unread: count}, err
+}
+
+// listDirectMessagesHandler godoc
+//
+//	@Summary		List direct messages
+//	@Description	Messages of a conversation, newest first. Pass meta.next_cursor as cursor for older ones. Reading the first page marks the conversation read.
+//	@Tags			conversations
+//	@Produce		json
+//	@Param			conversationID	path		int		true	"Conversation ID"
+//	@Param			cursor			query		string	false	"next_cursor of the previous page"
+//	@Param			limit			query		int		false	"Limit (default 50, max 100)"
+//	@Success		200				{array}		store.DirectMessage
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [get]
+func (app *application) listDirectMessagesHandler(r *http.Request, _ *noBody) (paged[store.DirectMessage], error) {
+	var page paged[store.DirectMessage]
+
+	conversation, err := app.conversationFromRequest(r)
+	if err != nil {
+		return page, err
+	}
+	user := getUserFromContext(r)
+
+	params, err := parsePage(r, directMessagePage)
+	if err != nil {
+		return page, err
+	}
+	scope := "messages:" + strconv.FormatInt(conversation.ID, 10)
+	var before int64
+	if params.Cursor != "" {
+		keys, err := app.cursorKeys(scope, params.Cursor)
+		if err != nil {
+			return page, err
+		}
+		if len(keys) != 1 {
+			return page, newHTTPError(http.StatusBadRequest, "invalid cursor")
+		}
+		if before, err = strconv.ParseInt(keys[0], 10, 64); err != nil || before < 1 {
+			return page, newHTTPError(http.StatusBadRequest, "invalid cursor")
+		}
+	}
+
+	// One extra message tells whether there is an older page.
+	messages, err := app.store.Conversations.ListMessages(r.Context(), conversation.ID, user.ID, before, params.Limit+1)
+	if err != nil {
+		return page, err
+	}
+
+	page = newPage(params, messages)
+	if len(messages) > params.Limit {
+		page.items = messages[:params.Limit]
+		page.page.Count = params.Limit
+		page.page.NextCursor = app.signCursor(scope, strconv.FormatInt(page.items[params.Limit-1].ID, 10))
+	}
+
+	if before == 0 && len(page.items) > 0 {
+		if err := app.store.Conversations.MarkRead(r.Context(), conversation.ID, user.ID, page.items[0].ID); err != nil {
+			app.logger.Warnw("could not mark conversation read", "conversation_id", conversation.ID, "error", err)
+		}
+	}
+
+	return page, nil
+}
+
+// createDirectMessageHandler godoc
+//
+//	@Summary		Send a direct message
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int							true	"Conversation ID"
+//	@Param			payload			body		CreateDirectMessagePayload	true	"Message"
+//	@Success		201				{object}	store.DirectMessage
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [post]
+func (app *application) createDirectMessageHandler(r *http.Request, payload *CreateDirectMessagePayload) (*store.DirectMessage, error) {
+	conversation, err := app.conversationFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	user := getUserFromContext(r)
+
+	recipient, err := app.store.Users.GetByID(r.Context(), conversation.UserID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if recipient == nil || app.canMessage(r.Context(), user, recipient) != nil {
+		return nil, newHTTPError(http.StatusForbidden, "this user cannot receive messages")
+	}
+	if err := app.filterWords(&payload.Body); err != nil {
+		return nil, err
+	}
+
+	msg := &store.DirectMessage{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Body:           payload.Body,
+	}
+	if err := app.store.Conversations.CreateMessage(r.Context(), msg); err != nil {
+		return nil, err
+	}
+	if !msg.Hidden {
+		app.notify(r.Context(), recipient.ID, push.Notification{
+			Title: "New message from " + user.Username,
+			Body:  messageExcerpt(msg.Body),
+			URL:   fmt.Sprintf("%s/conversations/%d", strings.TrimRight(app.config.frontendURL, "/"), conversation.ID),
+		})
+	}
+	return msg, nil
+}
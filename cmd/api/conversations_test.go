@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/pagination"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDirectMessages(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	alice := &store.User{Username: "alice", Email: "alice@example.com", IsActive: true}
+	bob := &store.User{Username: "bob", Email: "bob@example.com", IsActive: true}
+	eve := &store.User{Username: "eve", Email: "eve@example.com", IsActive: true}
+	for _, u := range []*store.User{alice, bob, eve} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/conversations", handle(app, http.StatusOK, app.startConversationHandler))
+	mux.Get("/v1/conversations/unread", handle(app, http.StatusOK, app.unreadMessagesHandler))
+	mux.Get("/v1/conversations/{conversationID}/messages", handle(app, http.StatusOK, app.listDirectMessagesHandler))
+	mux.Post("/v1/conversations/{conversationID}/messages", handle(app, http.StatusCreated, app.createDirectMessageHandler))
+
+	var meta pagination.Meta
+	do := func(user *store.User, method, path string, body any, wantStatus int, out any) {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		resp := executeRequest(req, mux).Result()
+		checkResponseCode(t, wantStatus, resp.StatusCode)
+		if out != nil {
+			meta = pagination.Meta{}
+			envelope := struct {
+				Data any              `json:"data"`
+				Meta *pagination.Meta `json:"meta"`
+			}{Data: out, Meta: &meta}
+			if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	do(alice, http.MethodPost, "/v1/conversations", map[string]int64{"user_id": alice.ID}, http.StatusBadRequest, nil)
+
+	var conversation store.Conversation
+	do(alice, http.MethodPost, "/v1/conversations", map[string]int64{"user_id": bob.ID}, http.StatusOK, &conversation)
+	if conversation.Username != "bob" {
+		t.Fatalf("unexpected conversation %+v", conversation)
+	}
+	path := "/v1/conversations/" + strconv.FormatInt(conversation.ID, 10) + "/messages"
+
+	for _, body := range []string{"one", "two", "three"} {
+		do(alice, http.MethodPost, path, map[string]string{"body": body}, http.StatusCreated, nil)
+	}
+	do(eve, http.MethodGet, path, nil, http.StatusNotFound, nil)
+	do(eve, http.MethodPost, path, map[string]string{"body": "hi"}, http.StatusNotFound, nil)
+
+	var unread UnreadMessages
+	do(bob, http.MethodGet, "/v1/conversations/unread", nil, http.StatusOK, &unread)
+	if unread.Unread != 3 {
+		t.Errorf("bob has %d unread messages, want 3", unread.Unread)
+	}
+
+	var page []store.DirectMessage
+	do(bob, http.MethodGet, path+"?limit=2", nil, http.StatusOK, &page)
+	if len(page) != 2 || page[0].Body != "three" || meta.NextCursor == "" {
+		t.Fatalf("unexpected first page %+v %+v", page, meta)
+	}
+	do(bob, http.MethodGet, path+"?limit=2&cursor="+meta.NextCursor+"x", nil, http.StatusBadRequest, nil)
+	var older []store.DirectMessage
+	do(bob, http.MethodGet, path+"?limit=2&cursor="+meta.NextCursor, nil, http.StatusOK, &older)
+	if len(older) != 1 || older[0].Body != "one" || meta.NextCursor != "" {
+		t.Errorf("unexpected last page %+v %+v", older, meta)
+	}
+
+	unread = UnreadMessages{}
+	do(bob, http.MethodGet, "/v1/conversations/unread", nil, http.StatusOK, &unread)
+	if unread.Unread != 0 {
+		t.Errorf("reading the first page should clear unread, got %d", unread.Unread)
+	}
+}
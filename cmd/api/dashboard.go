@@ -1,11 +1,16 @@
 package main
 
 import (
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 )
 
@@ -59,6 +64,67 @@ func (app *application) listFavoritesHandler(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// exportFavoritesHandler godoc
+//
+//	@Summary		Export favorites as CSV
+//	@Description	Streams the current user's favorite listings as a CSV download
+//	@Tags			favorites
+//	@Produce		text/csv
+//	@Success		200	{string}	string	"CSV file"
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/favorites/export [get]
+func (app *application) exportFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeFavoritesCSV(w, r, getUserFromContext(r).ID)
+}
+
+// writeFavoritesCSV streams the favorites of userID as a CSV attachment.
+func (app *application) writeFavoritesCSV(w http.ResponseWriter, r *http.Request, userID int64) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="favorites.csv"`)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"listing_id", "title", "city", "price", "area", "cover_url", "favorited_at"}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	err := app.store.Favorites.Each(r.Context(), userID, func(f store.FavoriteListing) error {
+		area := ""
+		if f.Area != nil {
+			area = strconv.FormatFloat(*f.Area, 'f', -1, 64)
+		}
+
+		return cw.Write([]string{
+			strconv.FormatInt(f.ListingID, 10),
+			csvSafe(f.Title),
+			csvSafe(f.City),
+			strconv.FormatInt(f.Price, 10),
+			area,
+			csvSafe(f.CoverURL),
+			f.CreatedAt,
+		})
+	})
+	cw.Flush()
+
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		// headers are already sent, so the client only sees a truncated file
+		app.logger.Errorw("favorites export failed", "user_id", userID, "error", err)
+	}
+}
+
+// csvSafe neutralises values a spreadsheet would evaluate as a formula.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
 // addFavoriteHandler godoc
 //
 //	@Summary		Add to favorites
@@ -86,7 +152,7 @@ func (app *application) addFavoriteHandler(w http.ResponseWriter, r *http.Reques
 	// Verify listing exists
 	_, err = app.store.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -95,7 +161,7 @@ func (app *application) addFavoriteHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	if err := app.store.Favorites.Add(r.Context(), user.ID, listingID); err != nil {
-		if err == store.ErrConflict {
+		if errors.Is(err, store.ErrConflict) {
 			app.conflictResponse(w, r, fmt.Errorf("listing already in favorites"))
 			return
 		}
@@ -108,6 +174,85 @@ func (app *application) addFavoriteHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// putFavoriteHandler godoc
+//
+//	@Summary		Save a listing
+//	@Description	Adds a listing to the current user's favorites. Unlike POST it succeeds when the listing is already saved.
+//	@Tags			favorites
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{object}	object{listing_id=int,favorites_count=int}
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/favorites/{listingID} [put]
+func (app *application) putFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	listingID, err := strconv.ParseInt(chi.URLParam(r, "listingID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.store.Favorites.Add(r.Context(), user.ID, listingID)
+	if err != nil && !errors.Is(err, store.ErrConflict) {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	stats, err := app.store.Favorites.Stats(r.Context(), user.ID, []int64{listingID})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	resp := map[string]int64{"listing_id": listingID, "favorites_count": int64(stats[listingID].Count)}
+	if err := app.jsonResponse(w, http.StatusOK, resp); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// setFavoriteStats fills in the favorite count of each listing and, for an
+// authenticated caller, whether they saved it.
+func (app *application) setFavoriteStats(r *http.Request, listings []store.Listing) error {
+	if len(listings) == 0 {
+		return nil
+	}
+
+	var userID int64
+	user := getUserFromContext(r)
+	if user != nil {
+		userID = user.ID
+	}
+
+	ids := make([]int64, len(listings))
+	for i, l := range listings {
+		ids[i] = l.ID
+	}
+
+	stats, err := app.store.Favorites.Stats(r.Context(), userID, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range listings {
+		st := stats[listings[i].ID]
+		listings[i].FavoritesCount = st.Count
+		if user != nil {
+			byMe := st.ByUser
+			listings[i].FavoritedByMe = &byMe
+		}
+	}
+	return nil
+}
+
 // removeFavoriteHandler godoc
 //
 //	@Summary		Remove from favorites
@@ -132,7 +277,7 @@ func (app *application) removeFavoriteHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	if err := app.store.Favorites.Remove(r.Context(), user.ID, listingID); err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -171,15 +316,24 @@ func (app *application) listChatsHandler(w http.ResponseWriter, r *http.Request)
 }
 
 type UpdateProfilePayload struct {
+	Username  string `json:"username" validate:"omitempty,username"`
 	FirstName string `json:"first_name" validate:"omitempty,max=100"`
 	LastName  string `json:"last_name" validate:"omitempty,max=100"`
 	Phone     string `json:"phone" validate:"omitempty,max=20"`
+	// Locale, Region and Timezone override the defaults taken from the
+	// registration country; an empty string clears the override.
+	Locale   *string `json:"locale,omitempty"`
+	Region   *string `json:"region,omitempty"`
+	Timezone *string `json:"timezone,omitempty" validate:"omitempty,max=64"`
+	// Private hides the profile from users who have no conversation with
+	// the owner.
+	Private *bool `json:"private,omitempty"`
 }
 
 // updateProfileHandler godoc
 //
 //	@Summary		Update profile
-//	@Description	Partially updates the current user's profile (first_name, last_name, phone). Only non-empty fields are updated.
+//	@Description	Partially updates the current user's profile (username, first_name, last_name, phone). Only non-empty fields are updated. Usernames are lowercased and must be free in any case. locale (en or ru), region (country code) and timezone (IANA name, used to schedule emails) override the defaults taken from the registration country; send "" to clear them. private hides the profile from users the owner has no conversation with.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
@@ -187,6 +341,7 @@ type UpdateProfilePayload struct {
 //	@Success		200		{object}	store.User
 //	@Failure		400		{object}	error
 //	@Failure		401		{object}	error
+//	@Failure		409		{object}	error	"Username or phone number belongs to another user"
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/me [patch]
@@ -198,22 +353,80 @@ func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Requ
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	payload.Username = service.NormalizeUsername(payload.Username)
 
 	if err := Validate.Struct(payload); err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if payload.FirstName == "" && payload.LastName == "" && payload.Phone == "" {
+	if payload.Username == "" && payload.FirstName == "" && payload.LastName == "" && payload.Phone == "" && payload.Locale == nil && payload.Region == nil && payload.Timezone == nil && payload.Private == nil {
 		app.badRequestResponse(w, r, fmt.Errorf("at least one field must be provided"))
 		return
 	}
 
+	if payload.Locale != nil && *payload.Locale != "" {
+		locale := strings.ToLower(*payload.Locale)
+		if _, found := universalTranslator.GetTranslator(locale); !found {
+			app.badRequestResponse(w, r, fmt.Errorf("unsupported locale %q", *payload.Locale))
+			return
+		}
+		payload.Locale = &locale
+	}
+	if payload.Region != nil && *payload.Region != "" {
+		region := normalizeCountry(*payload.Region)
+		if region == "" {
+			app.badRequestResponse(w, r, fmt.Errorf("region must be a two-letter country code"))
+			return
+		}
+		payload.Region = &region
+	}
+	if payload.Timezone != nil && *payload.Timezone != "" {
+		loc, err := time.LoadLocation(*payload.Timezone)
+		if err != nil || *payload.Timezone == "Local" {
+			app.badRequestResponse(w, r, fmt.Errorf("unknown timezone %q", *payload.Timezone))
+			return
+		}
+		timezone := loc.String()
+		payload.Timezone = &timezone
+	}
+
 	if err := app.store.Users.UpdateProfile(r.Context(), user.ID, payload.FirstName, payload.LastName, payload.Phone); err != nil {
+		if errors.Is(err, store.ErrDuplicatePhone) {
+			app.conflictResponse(w, r, err)
+			return
+		}
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if payload.Username != "" && payload.Username != user.Username {
+		if err := app.store.Users.UpdateUsername(r.Context(), user.ID, payload.Username); err != nil {
+			if errors.Is(err, store.ErrDuplicateUsername) {
+				app.conflictResponse(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if payload.Locale != nil || payload.Region != nil || payload.Timezone != nil {
+		if err := app.store.Users.UpdateLocalization(r.Context(), user.ID, payload.Locale, payload.Region, payload.Timezone); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if payload.Private != nil {
+		if err := app.store.Users.SetPrivate(r.Context(), user.ID, *payload.Private); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	if app.config.redisCfg.enabled && (payload.Username != "" || payload.Locale != nil || payload.Region != nil || payload.Timezone != nil || payload.Private != nil) {
+		app.cacheStorage.Users.Delete(r.Context(), user.ID)
+	}
+	app.forgetProfile(user.ID)
+
 	// Return updated user
 	updatedUser, err := app.store.Users.GetByID(r.Context(), user.ID)
 	if err != nil {
@@ -228,7 +441,7 @@ func (app *application) updateProfileHandler(w http.ResponseWriter, r *http.Requ
 
 type ChangePasswordPayload struct {
 	OldPassword             string `json:"old_password" validate:"required,min=3,max=72"`
-	NewPassword             string `json:"new_password" validate:"required,min=8,max=72"`
+	NewPassword             string `json:"new_password" validate:"required,max=72,password"`
 	NewPasswordConfirmation string `json:"new_password_confirmation" validate:"required,eqfield=NewPassword"`
 }
 
@@ -266,6 +479,10 @@ func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if !app.checkPasswordBreach(w, r, payload.NewPassword) {
+		return
+	}
+
 	// Set new password (hashes internally)
 	if err := user.Password.Set(payload.NewPassword); err != nil {
 		app.internalServerError(w, r, err)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func deadLetterParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "deadLetterID"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, newHTTPError(http.StatusBadRequest, "invalid dead letter id")
+	}
+	return id, nil
+}
+
+// adminListDeadLettersHandler godoc
+//
+//	@Summary		Lists dead-lettered emails
+//	@Description	Returns the emails the outbox relay gave up on after the maximum attempts, newest first, with the last error. Recipients, data and the rendered message are only returned by GET /admin/dead-letters/{deadLetterID}.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.DeadLetter
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/dead-letters [get]
+func (app *application) adminListDeadLettersHandler(r *http.Request, _ *noBody) (paged[store.DeadLetter], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.DeadLetter]{}, err
+	}
+
+	letters, err := app.store.DeadLetters.List(r.Context(), storeQuery(params))
+	return newPage(params, letters), err
+}
+
+// adminGetDeadLetterHandler godoc
+//
+//	@Summary		Get a dead-lettered email
+//	@Description	Returns the email with its recipient, template data and the subject and body it would have been sent with
+//	@Tags			admin
+//	@Produce		json
+//	@Param			deadLetterID	path		int	true	"Dead letter ID"
+//	@Success		200				{object}	store.DeadLetter
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/dead-letters/{deadLetterID} [get]
+func (app *application) adminGetDeadLetterHandler(r *http.Request, _ *noBody) (*store.DeadLetter, error) {
+	id, err := deadLetterParam(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.store.DeadLetters.GetByID(r.Context(), id)
+}
+
+// adminRetryDeadLetterHandler godoc
+//
+//	@Summary		Retry a dead-lettered email
+//	@Description	Queues the email again with a fresh set of attempts, for after the cause of the failures was fixed, and removes the dead letter. Returns the new outbox email.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			deadLetterID	path		int	true	"Dead letter ID"
+//	@Success		200				{object}	store.OutboxEmail
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/dead-letters/{deadLetterID}/retry [post]
+func (app *application) adminRetryDeadLetterHandler(r *http.Request, _ *noBody) (*store.OutboxEmail, error) {
+	id, err := deadLetterParam(r)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := app.store.DeadLetters.Retry(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	app.logAdminAction(getUserFromContext(r), "retry_dead_letter", "dead_letter", id, email.Template)
+	return email, nil
+}
+
+// adminDiscardDeadLetterHandler godoc
+//
+//	@Summary		Discard a dead-lettered email
+//	@Description	Deletes the dead letter without sending it
+//	@Tags			admin
+//	@Produce		json
+//	@Param			deadLetterID	path		int	true	"Dead letter ID"
+//	@Success		200				{object}	map[string]string
+//	@Failure		400				{object}	error
+//	@Failure		404				{object}	error
+//	@Failure		500				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/dead-letters/{deadLetterID} [delete]
+func (app *application) adminDiscardDeadLetterHandler(r *http.Request, _ *noBody) (map[string]string, error) {
+	id, err := deadLetterParam(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.DeadLetters.Discard(r.Context(), id); err != nil {
+		return nil, err
+	}
+
+	app.logAdminAction(getUserFromContext(r), "discard_dead_letter", "dead_letter", id, "")
+	return map[string]string{"message": "dead letter discarded"}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDeadLetters(t *testing.T) {
+	app, mail := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	email := &store.OutboxEmail{
+		Template: mailer.UserWelcomeTemplate,
+		Username: "ali",
+		Email:    "ali@example.com",
+		Data:     json.RawMessage(`{"Username":"ali","ActivationURL":"https://example.com/confirm/abc"}`),
+	}
+	if err := app.store.Outbox.Enqueue(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	for i := 0; i < outboxMaxAttempts-1; i++ {
+		if err := app.store.Outbox.MarkFailed(ctx, email.ID, "timeout", &past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the last attempt moves the email to the dead letters
+	mail.Fail(errors.New("mailbox unavailable"))
+	app.relayOutbox(ctx)
+	mail.Fail(nil)
+
+	if claimed, _ := app.store.Outbox.ClaimPending(ctx, 10, time.Minute); len(claimed) != 0 {
+		t.Fatalf("email still in the outbox: %+v", claimed)
+	}
+
+	admin := &store.User{ID: 1, Role: store.Role{Name: store.RoleAdmin}}
+	mux := chi.NewRouter()
+	mux.Get("/v1/admin/dead-letters", handle(app, http.StatusOK, app.adminListDeadLettersHandler))
+	mux.Get("/v1/admin/dead-letters/{deadLetterID}", handle(app, http.StatusOK, app.adminGetDeadLetterHandler))
+	mux.Post("/v1/admin/dead-letters/{deadLetterID}/retry", handle(app, http.StatusOK, app.adminRetryDeadLetterHandler))
+	mux.Delete("/v1/admin/dead-letters/{deadLetterID}", handle(app, http.StatusOK, app.adminDiscardDeadLetterHandler))
+	do := func(method, path string) *http.Response {
+		req, _ := http.NewRequest(method, path, nil)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), mux).Result()
+	}
+
+	resp := do(http.MethodGet, "/v1/admin/dead-letters")
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+	var list struct {
+		Data []store.DeadLetter `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 {
+		t.Fatalf("got %+v", list.Data)
+	}
+	letter := list.Data[0]
+	if letter.OutboxID != email.ID || letter.Attempts != outboxMaxAttempts || letter.LastError != "mailbox unavailable" {
+		t.Errorf("got %+v", letter)
+	}
+	if letter.Email != "" || letter.Body != "" {
+		t.Error("list returned the recipient or message")
+	}
+
+	path := "/v1/admin/dead-letters/" + strconv.FormatInt(letter.ID, 10)
+	resp = do(http.MethodGet, path)
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+	var one struct {
+		Data store.DeadLetter `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&one); err != nil {
+		t.Fatal(err)
+	}
+	got := one.Data
+	if got.Email != "ali@example.com" || !strings.Contains(got.Subject, "Finish Registration") ||
+		!strings.Contains(got.Body, "https://example.com/confirm/abc") {
+		t.Errorf("got %+v", got)
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		resp := do(http.MethodPost, path+"/retry")
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(http.MethodPost, path+"/retry").StatusCode)
+
+		claimed, err := app.store.Outbox.ClaimPending(ctx, 10, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claimed) != 1 || claimed[0].Email != "ali@example.com" || claimed[0].Attempts != 0 {
+			t.Errorf("retried email not queued with fresh attempts: %+v", claimed)
+		}
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		other := &store.OutboxEmail{Template: mailer.UserWelcomeTemplate, Username: "bo", Email: "bo@example.com", Data: json.RawMessage(`{}`)}
+		if err := app.store.Outbox.Enqueue(ctx, other); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.store.Outbox.DeadLetter(ctx, other.ID, "rejected", "", ""); err != nil {
+			t.Fatal(err)
+		}
+		count, err := app.store.DeadLetters.Count(ctx)
+		if err != nil || count != 1 {
+			t.Fatalf("count %d, %v", count, err)
+		}
+
+		letters, err := app.store.DeadLetters.List(ctx, store.PaginatedQuery{Limit: 10})
+		if err != nil || len(letters) != 1 {
+			t.Fatalf("got %+v, %v", letters, err)
+		}
+		path := "/v1/admin/dead-letters/" + strconv.FormatInt(letters[0].ID, 10)
+		checkResponseCode(t, http.StatusOK, do(http.MethodDelete, path).StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(http.MethodDelete, path).StatusCode)
+		checkResponseCode(t, http.StatusNotFound, do(http.MethodGet, path).StatusCode)
+	})
+}
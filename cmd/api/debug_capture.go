@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Debug capture records the request and response bodies of selected
+// requests so an admin can see what a client integration actually sends,
+// without raising the log level for everyone. A request is captured when it
+// carries a valid X-Debug-Capture header, minted by an admin, or when it is
+// made by a user an admin turned capture on for. Bodies are sanitized like
+// the logs and kept in memory on the instance that served the request.
+const (
+	debugCaptureHeader = "X-Debug-Capture"
+	// debugCapturePath is what capture headers sign; it is not a route.
+	debugCapturePath = "/debug-capture"
+
+	maxDebugCaptures      = 200
+	maxDebugCaptureBody   = 64 << 10
+	maxDebugCaptureWindow = time.Hour
+)
+
+// DebugCapture is one captured request. Trigger is "header" or "user".
+type DebugCapture struct {
+	ID                string            `json:"id"`
+	Time              time.Time         `json:"time"`
+	Trigger           string            `json:"trigger"`
+	Method            string            `json:"method"`
+	Path              string            `json:"path"`
+	RequestID         string            `json:"request_id,omitempty"`
+	UserID            int64             `json:"user_id,omitempty"`
+	Status            int               `json:"status"`
+	DurationMS        int64             `json:"duration_ms"`
+	RequestHeaders    map[string]string `json:"request_headers"`
+	RequestBody       string            `json:"request_body,omitempty"`
+	ResponseType      string            `json:"response_type,omitempty"`
+	ResponseBody      string            `json:"response_body,omitempty"`
+	RequestTruncated  bool              `json:"request_truncated,omitempty"`
+	ResponseTruncated bool              `json:"response_truncated,omitempty"`
+}
+
+var debugCaptures = newDebugCaptureLog(maxDebugCaptures)
+
+// debugCaptureLog keeps the most recent captures and the users whose
+// requests are being captured. Like serverErrorLog it is per instance and
+// lost on restart.
+type debugCaptureLog struct {
+	mu      sync.Mutex
+	limit   int
+	entries []DebugCapture
+	users   map[int64]time.Time
+	redact  *redactor
+}
+
+func newDebugCaptureLog(limit int) *debugCaptureLog {
+	return &debugCaptureLog{
+		limit:  limit,
+		users:  make(map[int64]time.Time),
+		redact: newRedactor(),
+	}
+}
+
+func (l *debugCaptureLog) add(entry DebugCapture) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.limit {
+		l.entries = l.entries[1:]
+	}
+}
+
+// list returns the captures newest first, only userID's when it is not 0.
+func (l *debugCaptureLog) list(userID int64) []DebugCapture {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := []DebugCapture{}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if userID == 0 || l.entries[i].UserID == userID {
+			out = append(out, l.entries[i])
+		}
+	}
+	return out
+}
+
+func (l *debugCaptureLog) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = nil
+}
+
+func (l *debugCaptureLog) watch(userID int64, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.users[userID] = until
+}
+
+func (l *debugCaptureLog) unwatch(userID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.users, userID)
+}
+
+// watching reports whether userID's requests are captured at now. userID 0
+// asks whether anyone's are, which is all the middleware can know before
+// the request is authenticated.
+func (l *debugCaptureLog) watching(userID int64, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for id, until := range l.users {
+		if now.After(until) {
+			delete(l.users, id)
+			continue
+		}
+		if userID == 0 || id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// headers returns the request headers with credentials hidden.
+func (l *debugCaptureLog) headers(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		if isSecretKey(name) || name == debugCaptureHeader {
+			value = redacted
+		}
+		out[name] = l.redact.string(value)
+	}
+	return out
+}
+
+// body sanitizes a captured body: JSON loses secret keys at any depth, form
+// fields the same, other text goes through the log redactor and anything
+// else is only described.
+func (l *debugCaptureLog) body(contentType string, b *captureBuffer) string {
+	if b.total == 0 {
+		return ""
+	}
+	raw := b.buf.Bytes()
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if b.truncated() {
+			// a partial document cannot be parsed to find its secrets
+			return fmt.Sprintf("[%d bytes of %s]", b.total, mediaType)
+		}
+		var decoded any
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return l.redact.string(string(raw))
+		}
+		clean, _ := l.redact.value(decoded)
+		out, _ := json.Marshal(clean)
+		return string(out)
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return l.redact.string(string(raw))
+		}
+		for key := range form {
+			if isSecretKey(key) {
+				form[key] = []string{redacted}
+			}
+		}
+		return l.redact.string(form.Encode())
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "" && utf8.Valid(raw):
+		return l.redact.string(string(raw))
+	}
+	return fmt.Sprintf("[%d bytes of %s]", b.total, mediaType)
+}
+
+// captureBuffer keeps the first maxDebugCaptureBody bytes written to it and
+// counts the rest.
+type captureBuffer struct {
+	buf   bytes.Buffer
+	total int
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if room := maxDebugCaptureBody - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+func (b *captureBuffer) truncated() bool { return b.total > b.buf.Len() }
+
+// debugCaptureUser is where AuthTokenMiddleware leaves the user of a
+// request that may be captured.
+type debugCaptureUser struct {
+	id int64
+}
+
+type debugCaptureKey struct{}
+
+func noteDebugCaptureUser(r *http.Request, userID int64) {
+	if u, ok := r.Context().Value(debugCaptureKey{}).(*debugCaptureUser); ok {
+		u.id = userID
+	}
+}
+
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// debugCaptureMiddleware records the request when it carries a valid
+// capture header or, once authenticated, turns out to be made by a watched
+// user. Requests are only wrapped while there is a reason to.
+func (app *application) debugCaptureMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		byHeader := app.validDebugCaptureHeader(r, start)
+		if !byHeader && !debugCaptures.watching(0, start) ||
+			strings.HasPrefix(unversionedPath(r.URL.Path), "/admin/debug-captures") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestBody := &captureBuffer{}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = teeBody{Reader: io.TeeReader(r.Body, requestBody), Closer: r.Body}
+		}
+		responseBody := &captureBuffer{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(responseBody)
+		user := &debugCaptureUser{}
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), debugCaptureKey{}, user)))
+
+		trigger := "header"
+		if !byHeader {
+			if user.id == 0 || !debugCaptures.watching(user.id, time.Now()) {
+				return
+			}
+			trigger = "user"
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		debugCaptures.add(DebugCapture{
+			ID:                newErrorID(),
+			Time:              start.UTC(),
+			Trigger:           trigger,
+			Method:            r.Method,
+			Path:              debugCaptures.redact.string(r.URL.RequestURI()),
+			RequestID:         middleware.GetReqID(r.Context()),
+			UserID:            user.id,
+			Status:            status,
+			DurationMS:        time.Since(start).Milliseconds(),
+			RequestHeaders:    debugCaptures.headers(r.Header),
+			RequestBody:       debugCaptures.body(r.Header.Get("Content-Type"), requestBody),
+			ResponseType:      ww.Header().Get("Content-Type"),
+			ResponseBody:      debugCaptures.body(ww.Header().Get("Content-Type"), responseBody),
+			RequestTruncated:  requestBody.truncated(),
+			ResponseTruncated: responseBody.truncated(),
+		})
+	})
+}
+
+func (app *application) validDebugCaptureHeader(r *http.Request, now time.Time) bool {
+	value := r.Header.Get(debugCaptureHeader)
+	if value == "" {
+		return false
+	}
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return false
+	}
+	return app.signer().Verify(debugCapturePath, query, now) == nil
+}
+
+// DebugCaptureWindowPayload sets how long to capture for.
+type DebugCaptureWindowPayload struct {
+	Minutes int `json:"minutes" validate:"required,min=1,max=60"`
+}
+
+// DebugCaptureWatch is a user whose requests are being captured.
+type DebugCaptureWatch struct {
+	UserID int64     `json:"user_id"`
+	Until  time.Time `json:"until"`
+}
+
+// DebugCaptureToken is a header that has its requests captured until
+// ExpiresAt.
+type DebugCaptureToken struct {
+	Header    string    `json:"header"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// adminWatchUserHandler godoc
+//
+//	@Summary		Capture a user's requests
+//	@Description	Records the sanitized request and response bodies of every authenticated request the user makes for the given number of minutes, at most 60. Only the instance that handles the call captures; behind a load balancer, repeat it on each or use a capture header.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int							true	"User ID"
+//	@Param			payload	body		DebugCaptureWindowPayload	true	"Capture window"
+//	@Success		200		{object}	DebugCaptureWatch
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/debug-captures/users/{userID} [post]
+func (app *application) adminWatchUserHandler(r *http.Request, payload *DebugCaptureWindowPayload) (*DebugCaptureWatch, error) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil || userID <= 0 {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	until := time.Now().Add(min(time.Duration(payload.Minutes)*time.Minute, maxDebugCaptureWindow)).UTC()
+	debugCaptures.watch(userID, until)
+	app.logAdminAction(getUserFromContext(r), "debug_capture_user", "user", userID, until.Format(time.RFC3339))
+	return &DebugCaptureWatch{UserID: userID, Until: until}, nil
+}
+
+// adminUnwatchUserHandler godoc
+//
+//	@Summary		Stop capturing a user's requests
+//	@Tags			admin
+//	@Param			userID	path	int	true	"User ID"
+//	@Success		204
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/debug-captures/users/{userID} [delete]
+func (app *application) adminUnwatchUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	debugCaptures.unwatch(userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminCreateDebugCaptureTokenHandler godoc
+//
+//	@Summary		Create a capture header
+//	@Description	Returns a signed X-Debug-Capture header value, valid for the given number of minutes, at most 60. Requests sent with it are captured on whichever instance serves them, signed in or not.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DebugCaptureWindowPayload	true	"Capture window"
+//	@Success		201		{object}	DebugCaptureToken
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/debug-captures/token [post]
+func (app *application) adminCreateDebugCaptureTokenHandler(r *http.Request, payload *DebugCaptureWindowPayload) (*DebugCaptureToken, error) {
+	expires := time.Now().Add(min(time.Duration(payload.Minutes)*time.Minute, maxDebugCaptureWindow)).Truncate(time.Second).UTC()
+	_, query, _ := strings.Cut(app.signer().Sign(debugCapturePath, expires), "?")
+
+	app.logAdminAction(getUserFromContext(r), "debug_capture_token", "debug_capture", 0, expires.Format(time.RFC3339))
+	return &DebugCaptureToken{Header: debugCaptureHeader, Value: query, ExpiresAt: expires}, nil
+}
+
+// adminListDebugCapturesHandler godoc
+//
+//	@Summary		List captured requests
+//	@Description	Returns the requests captured by this instance, newest first. Only the latest 200 are kept.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			user_id	query		int	false	"Only this user's requests"
+//	@Success		200		{array}		DebugCapture
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/debug-captures [get]
+func (app *application) adminListDebugCapturesHandler(r *http.Request, _ *noBody) ([]DebugCapture, error) {
+	var userID int64
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, newHTTPError(http.StatusBadRequest, "invalid user id")
+		}
+		userID = id
+	}
+	return debugCaptures.list(userID), nil
+}
+
+// adminClearDebugCapturesHandler godoc
+//
+//	@Summary		Delete captured requests
+//	@Tags			admin
+//	@Success		204
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/debug-captures [delete]
+func (app *application) adminClearDebugCapturesHandler(w http.ResponseWriter, r *http.Request) {
+	debugCaptures.clear()
+	w.WriteHeader(http.StatusNoContent)
+}
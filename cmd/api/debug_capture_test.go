@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/signing"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDebugCapture(t *testing.T) {
+	app := newTestApplication(t, config{auth: authConfig{token: tokenConfig{secret: "test-secret"}}})
+	debugCaptures = newDebugCaptureLog(maxDebugCaptures)
+	t.Cleanup(func() { debugCaptures = newDebugCaptureLog(maxDebugCaptures) })
+
+	mux := chi.NewRouter()
+	mux.Use(app.debugCaptureMiddleware)
+	mux.Post("/v1/echo", func(w http.ResponseWriter, r *http.Request) {
+		// stands in for AuthTokenMiddleware
+		if id, err := strconv.ParseInt(r.Header.Get("X-User"), 10, 64); err == nil {
+			noteDebugCaptureUser(r, id)
+		}
+		var payload map[string]any
+		if err := readJSON(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		app.jsonResponse(w, http.StatusCreated, map[string]any{"name": payload["name"], "token": "issued"})
+	})
+
+	send := func(user, header string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/echo", strings.NewReader(`{"name":"jo","password":"hunter22"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer abc.def.ghi")
+		req.Header.Set("X-User", user)
+		if header != "" {
+			req.Header.Set(debugCaptureHeader, header)
+		}
+		checkResponseCode(t, http.StatusCreated, executeRequest(req, mux).Code)
+	}
+
+	send("7", "")
+	if got := debugCaptures.list(0); len(got) != 0 {
+		t.Fatalf("captured without a reason: %+v", got)
+	}
+
+	token, err := app.adminCreateDebugCaptureTokenHandler(httptest.NewRequest(http.MethodPost, "/", nil), &DebugCaptureWindowPayload{Minutes: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send("", token.Value)
+	forged := signing.New("guess").Sign(debugCapturePath, time.Now().Add(time.Minute))
+	send("", forged[strings.Index(forged, "?")+1:])
+
+	got := debugCaptures.list(0)
+	if len(got) != 1 {
+		t.Fatalf("got %d captures, want 1", len(got))
+	}
+	c := got[0]
+	if c.Trigger != "header" || c.Status != http.StatusCreated || c.RequestHeaders["Authorization"] != redacted || c.RequestHeaders[debugCaptureHeader] != redacted {
+		t.Errorf("got %+v", c)
+	}
+	if c.RequestBody != `{"name":"jo","password":"[REDACTED]"}` {
+		t.Errorf("request body %s", c.RequestBody)
+	}
+	if c.ResponseBody != `{"data":{"name":"jo","token":"[REDACTED]"}}` {
+		t.Errorf("response body %s", c.ResponseBody)
+	}
+
+	debugCaptures.watch(7, time.Now().Add(time.Minute))
+	send("7", "")
+	send("8", "")
+	if got := debugCaptures.list(7); len(got) != 1 || got[0].Trigger != "user" || got[0].UserID != 7 {
+		t.Errorf("watched user: %+v", got)
+	}
+	if got := debugCaptures.list(0); len(got) != 2 {
+		t.Errorf("got %d captures, want 2", len(got))
+	}
+
+	debugCaptures.watch(7, time.Now().Add(-time.Second))
+	send("7", "")
+	if debugCaptures.watching(0, time.Now()) || len(debugCaptures.list(7)) != 1 {
+		t.Error("captured after the window closed")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Deleting a listing only hides it: it stays out of every list, count and
+// feed, and its company can restore it for LISTING_DELETED_RETENTION. The
+// purger then removes it for good, with its favorites, applications and
+// versions.
+const defaultDeletedListingRetention = 30 * 24 * time.Hour
+
+// restoreListingHandler godoc
+//
+//	@Summary		Restore a deleted listing (agency/developer)
+//	@Description	Undoes the deletion of a listing of the current company within LISTING_DELETED_RETENTION. The listing comes back with its status, favorites and applications; it is not pinned again.
+//	@Tags			listings
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{object}	store.Listing
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error	"Not deleted, purged or of another company"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/restore [post]
+func (app *application) restoreListingHandler(r *http.Request, _ *noBody) (*store.Listing, error) {
+	user := getUserFromContext(r)
+	if user.CompanyID == nil || (user.Role.Name != store.RoleAgency && user.Role.Name != store.RoleDeveloper) {
+		return nil, newHTTPError(http.StatusForbidden, "only agencies and developers can restore listings")
+	}
+
+	listingID, err := strconv.ParseInt(chi.URLParam(r, "listingID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid listing id")
+	}
+
+	since := time.Now().Add(-app.config.listings.deletedRetention)
+	if err := app.store.Listings.Restore(r.Context(), listingID, *user.CompanyID, since); err != nil {
+		return nil, err
+	}
+
+	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
+	if err != nil {
+		return nil, err
+	}
+	app.forgetListings(listingID)
+	app.invalidateFeed(r.Context())
+	app.publish(r.Context(), events.ListingUpdated, &listing.CompanyID, listing)
+	return listing, nil
+}
+
+// runListingPurger removes the listings deleted longer than retention ago
+// every interval, until ctx is cancelled.
+func (app *application) runListingPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.purgeDeletedListings(ctx, retention)
+		}
+	}
+}
+
+func (app *application) purgeDeletedListings(ctx context.Context, retention time.Duration) {
+	purged, err := app.store.Listings.PurgeDeleted(ctx, time.Now().Add(-retention))
+	if err != nil {
+		app.logger.Errorw("could not purge deleted listings", "error", err)
+		return
+	}
+	if purged > 0 {
+		app.logger.Infow("purged deleted listings", "count", purged)
+	}
+}
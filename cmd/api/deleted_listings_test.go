@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDeletedListings(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{listings: listingsConfig{deletedRetention: time.Hour}})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Acme", Type: "agency"}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Flat", DealType: "sale", PropertyType: "apartment", City: "Almaty", Price: 100, Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	agent := &store.User{ID: 1, CompanyID: &company.ID, Role: store.Role{Name: store.RoleAgency}}
+	if err := app.store.Favorites.Add(ctx, agent.ID, listing.ID); err != nil {
+		t.Fatal(err)
+	}
+	otherCompany := company.ID + 1
+	stranger := &store.User{ID: 2, CompanyID: &otherCompany, Role: store.Role{Name: store.RoleAgency}}
+
+	mux := chi.NewRouter()
+	mux.Delete("/v1/listings/{listingID}", app.deleteListingHandler)
+	mux.Post("/v1/listings/{listingID}/restore", handle(app, http.StatusOK, app.restoreListingHandler))
+	do := func(method, path string, user *store.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), user)), mux)
+	}
+	path := "/v1/listings/" + strconv.FormatInt(listing.ID, 10)
+
+	checkResponseCode(t, http.StatusNoContent, do(http.MethodDelete, path, agent).Code)
+	if _, err := app.store.Listings.GetByID(ctx, listing.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleted listing still found: %v", err)
+	}
+	if n, err := app.store.Favorites.Count(ctx, agent.ID); err != nil || n != 0 {
+		t.Errorf("favorites count = %d, %v", n, err)
+	}
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodDelete, path, agent).Code)
+
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodPost, path+"/restore", stranger).Code)
+	checkResponseCode(t, http.StatusOK, do(http.MethodPost, path+"/restore", agent).Code)
+	if n, err := app.store.Favorites.Count(ctx, agent.ID); err != nil || n != 1 {
+		t.Errorf("favorites count after restore = %d, %v", n, err)
+	}
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodPost, path+"/restore", agent).Code)
+
+	// past the retention the listing can no longer be restored and is purged
+	checkResponseCode(t, http.StatusNoContent, do(http.MethodDelete, path, agent).Code)
+	app.config.listings.deletedRetention = -time.Minute
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodPost, path+"/restore", agent).Code)
+	app.purgeDeletedListings(ctx, app.config.listings.deletedRetention)
+	if purged, err := app.store.Listings.PurgeDeleted(ctx, time.Now().Add(time.Hour)); err != nil || purged != 0 {
+		t.Errorf("purged again: %d, %v", purged, err)
+	}
+}
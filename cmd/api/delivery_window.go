@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+	// the runtime image is built from scratch and has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+type SetDeliveryWindowPayload struct {
+	// Timezone defaults to the user's, see userTimezone
+	Timezone  string `json:"timezone" validate:"max=64"`
+	StartHour *int   `json:"start_hour" validate:"required,min=0,max=23"`
+}
+
+// getDeliveryWindowHandler godoc
+//
+//	@Summary		Get the email delivery window
+//	@Description	The local hour in which notification emails are delivered. 404 means they are sent right away.
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.DeliveryWindow
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email-window [get]
+func (app *application) getDeliveryWindowHandler(r *http.Request, _ *noBody) (*store.DeliveryWindow, error) {
+	return app.store.DeliveryWindows.Get(r.Context(), getUserFromContext(r).ID)
+}
+
+// setDeliveryWindowHandler godoc
+//
+//	@Summary		Set the email delivery window
+//	@Description	Notification emails are held until start_hour in the given IANA timezone, by default the user's profile timezone, which registration takes from the country. Transactional emails, such as activation and sign-in links, are always sent right away.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		SetDeliveryWindowPayload	true	"Timezone and local start hour"
+//	@Success		200		{object}	store.DeliveryWindow
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email-window [put]
+func (app *application) setDeliveryWindowHandler(r *http.Request, payload *SetDeliveryWindowPayload) (*store.DeliveryWindow, error) {
+	if payload.Timezone == "" {
+		payload.Timezone = userTimezone(getUserFromContext(r))
+	}
+	if payload.Timezone == "" {
+		return nil, newHTTPError(http.StatusBadRequest, "timezone is required when the profile has none")
+	}
+	loc, err := time.LoadLocation(payload.Timezone)
+	if err != nil || payload.Timezone == "Local" {
+		return nil, newHTTPError(http.StatusBadRequest, "unknown timezone "+strconv.Quote(payload.Timezone))
+	}
+
+	window := &store.DeliveryWindow{Timezone: loc.String(), StartHour: *payload.StartHour}
+	if err := app.store.DeliveryWindows.Set(r.Context(), getUserFromContext(r).ID, window); err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+// deleteDeliveryWindowHandler godoc
+//
+//	@Summary		Remove the email delivery window
+//	@Description	Notification emails are sent right away again
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	map[string]string
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email-window [delete]
+func (app *application) deleteDeliveryWindowHandler(r *http.Request, _ *noBody) (map[string]string, error) {
+	if err := app.store.DeliveryWindows.Delete(r.Context(), getUserFromContext(r).ID); err != nil {
+		return nil, err
+	}
+	return map[string]string{"message": "delivery window removed"}, nil
+}
+
+// scheduleEmail holds a notification email for userID until their delivery
+// window. Transactional emails and users without a window are not delayed,
+// and a window that cannot be read is logged and ignored.
+func (app *application) scheduleEmail(ctx context.Context, userID int64, email *store.OutboxEmail) {
+	if mailer.IsTransactional(email.Template) {
+		return
+	}
+
+	window, err := app.store.DeliveryWindows.Get(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			app.logger.Warnw("could not load delivery window", "user_id", userID, "error", err)
+		}
+		return
+	}
+
+	sendAt, err := nextDeliveryTime(time.Now(), *window, userID)
+	if err != nil {
+		app.logger.Warnw("invalid delivery window", "user_id", userID, "error", err)
+		return
+	}
+	email.SendAfter = &sendAt
+}
+
+// nextDeliveryTime returns when an email for userID should be sent. Each user
+// gets a fixed offset into the window hour so a popular hour is spread over
+// the whole hour instead of being sent at once. Inside the window, after the
+// user's offset, the email goes out right away.
+func nextDeliveryTime(now time.Time, window store.DeliveryWindow, userID int64) (time.Time, error) {
+	loc, err := time.LoadLocation(window.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatInt(userID, 10)))
+	offset := time.Duration(h.Sum32()%3600) * time.Second
+
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), window.StartHour, 0, 0, 0, loc)
+	switch {
+	case now.Before(start.Add(offset)):
+		return start.Add(offset), nil
+	case now.Before(start.Add(time.Hour)):
+		return now, nil
+	}
+	start = time.Date(local.Year(), local.Month(), local.Day()+1, window.StartHour, 0, 0, 0, loc)
+	return start.Add(offset), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestNextDeliveryTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := store.DeliveryWindow{Timezone: "America/New_York", StartHour: 8}
+	day := func(d, h, m int) time.Time { return time.Date(2026, 10, d, h, m, 0, 0, loc) }
+
+	first, err := nextDeliveryTime(day(16, 3, 0), window, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Before(day(16, 8, 0)) || !first.Before(day(16, 9, 0)) {
+		t.Fatalf("expected a time in the 8am hour, got %v", first.In(loc))
+	}
+
+	offset := first.Sub(day(16, 8, 0))
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"inside the window", first.Add(time.Minute), first.Add(time.Minute)},
+		{"after the window", day(16, 9, 0), day(17, 8, 0).Add(offset)},
+		{"late evening", day(16, 23, 0), day(17, 8, 0).Add(offset)},
+	}
+	for _, tt := range tests {
+		got, err := nextDeliveryTime(tt.now, window, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got.In(loc), tt.want.In(loc))
+		}
+	}
+
+	spread := map[time.Time]bool{}
+	for id := int64(1); id <= 20; id++ {
+		at, _ := nextDeliveryTime(day(16, 3, 0), window, id)
+		spread[at] = true
+	}
+	if len(spread) < 10 {
+		t.Errorf("expected sends spread across the hour, got %d distinct times for 20 users", len(spread))
+	}
+}
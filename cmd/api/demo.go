@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/email"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
+	filestorage "github.com/Lelouchlamperougexd/Valar_Morghulis/internal/storage"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+	"go.uber.org/zap"
+)
+
+const (
+	// demoPassword is shared by every seeded account
+	demoPassword = "Demo-pass-2024!"
+	// demoMailLimit is how many captured emails /demo/mail keeps
+	demoMailLimit = 100
+)
+
+// runDemo serves the API from an in-memory store, seeded with sample data
+// when seed is set. No database, Redis or mail provider is needed: emails
+// are captured and listed at GET /demo/mail. Everything is lost when the
+// process exits.
+func runDemo(cfg config, logger *zap.SugaredLogger, seed bool) error {
+	cfg.env = "demo"
+	cfg.redisCfg.enabled = false
+	if cfg.mail.outboxInterval <= 0 {
+		cfg.mail.outboxInterval = time.Second
+	}
+
+	if _, err := parseRouteMiddleware(cfg.routeMiddleware); err != nil {
+		return err
+	}
+	if _, err := parseRateLimitPolicies(cfg.rateLimitPolicies); err != nil {
+		return err
+	}
+	if _, err := parseRouteTimeouts(cfg.routeTimeouts); err != nil {
+		return err
+	}
+	if err := cfg.tenancy.validate(); err != nil {
+		return err
+	}
+	if err := cfg.auth.token.validate(); err != nil {
+		return err
+	}
+	if _, err := parseActivationLinks(cfg.auth.activationLinks, cfg.auth.activationSchemes); err != nil {
+		return err
+	}
+
+	uploader, err := filestorage.NewLocalUploader("./uploads")
+	if err != nil {
+		return err
+	}
+	authenticator, err := newAuthenticator(cfg.auth.token)
+	if err != nil {
+		return err
+	}
+
+	if err := mailer.PreloadTemplates(); err != nil {
+		return err
+	}
+	mailCapture := mailer.NewCaptureClient(demoMailLimit)
+	storage := store.NewMemoryStorage()
+	linkTokens, err := cfg.linkTokens.issuer()
+	if err != nil {
+		return err
+	}
+
+	app := &application{
+		config:        cfg,
+		store:         storage,
+		cacheStorage:  cache.NewMockStore(),
+		logger:        logger,
+		mailer:        mailer.WithSuppression(mailCapture, storage.Suppressions),
+		authenticator: authenticator,
+		tokens:        linkTokens,
+		hot:           cfg.httpCache.hotCache(),
+		rateLimiter: ratelimiter.NewFixedWindowLimiter(
+			cfg.rateLimiter.RequestsPerTimeFrame,
+			cfg.rateLimiter.TimeFrame,
+		),
+		uploader: uploader,
+		// no MX lookups, demo mode runs offline
+		emails: email.NewService(email.Options{
+			StripPlusTags:   cfg.auth.emailCheck.stripPlusTags,
+			BlockDisposable: cfg.auth.emailCheck.blockDisposable,
+		}),
+		webhookClient: newWebhookClient(cfg.webhooks),
+	}
+
+	app.bus = app.newEventBus()
+	if app.jobs, err = app.newJobPool(cfg.jobs); err != nil {
+		return err
+	}
+
+	if seed {
+		if err := seedDemo(context.Background(), app.store); err != nil {
+			return err
+		}
+		logger.Infow("demo data seeded", "shared_password", demoPassword,
+			"accounts", []string{"admin@demo.local", "moderator@demo.local", "agent@demo.local", "buyer@demo.local"})
+	}
+
+	app.jobs.Start()
+	go app.runOutboxRelay(context.Background(), cfg.mail.outboxInterval)
+	if cfg.mail.broadcastInterval > 0 && cfg.mail.broadcastBatch > 0 {
+		go app.runBroadcastSender(context.Background(), cfg.mail.broadcastInterval)
+	}
+	if cfg.webhooks.interval > 0 {
+		go app.runWebhookRelay(context.Background(), cfg.webhooks.interval)
+	}
+	if cfg.listings.trendingInterval > 0 {
+		go app.runTrendingRefresher(context.Background(), cfg.listings.trendingInterval)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /demo/mail", func(w http.ResponseWriter, r *http.Request) {
+		if err := app.jsonResponse(w, http.StatusOK, mailCapture.Messages()); err != nil {
+			app.internalServerError(w, r, err)
+		}
+	})
+	mux.Handle("/", app.mount())
+
+	return app.run(mux)
+}
+
+// seedDemo creates a small, consistent data set: staff accounts, a verified
+// agency with an agent and a few listings, and a buyer who has applied to
+// one of them.
+func seedDemo(ctx context.Context, s store.Storage) error {
+	newUser := func(username, email, firstName, lastName, role string, companyID *int64) (*store.User, error) {
+		user := &store.User{
+			Username:  username,
+			Email:     email,
+			FirstName: firstName,
+			LastName:  lastName,
+			Role:      store.Role{Name: role},
+			CompanyID: companyID,
+		}
+		if err := user.Password.Set(demoPassword); err != nil {
+			return nil, err
+		}
+		if err := s.Users.Create(ctx, nil, user); err != nil {
+			return nil, err
+		}
+		return user, s.Users.Transition(ctx, user.ID, store.UserStateActive, nil, "demo data")
+	}
+
+	if _, err := newUser("admin", "admin@demo.local", "Ada", "Admin", store.RoleAdmin, nil); err != nil {
+		return err
+	}
+	if _, err := newUser("moderator", "moderator@demo.local", "Mona", "Moder", store.RoleModerator, nil); err != nil {
+		return err
+	}
+
+	company := &store.Company{
+		Name:               "Demo Realty",
+		RegistrationNumber: "DEMO-0001",
+		City:               "Almaty",
+		Email:              "office@demo.local",
+		Phone:              "+77000000000",
+		Type:               store.RoleAgency,
+		VerificationStatus: store.VerificationVerified,
+	}
+	if err := s.Companies.Create(ctx, nil, company); err != nil {
+		return err
+	}
+	if _, err := newUser("agent", "agent@demo.local", "Aidan", "Agent", store.RoleAgency, &company.ID); err != nil {
+		return err
+	}
+
+	buyer, err := newUser("buyer", "buyer@demo.local", "Bella", "Buyer", store.RoleUser, nil)
+	if err != nil {
+		return err
+	}
+
+	rooms := func(n int) *int { return &n }
+	area := func(a float64) *float64 { return &a }
+
+	listings := []struct {
+		listing store.Listing
+		rent    *store.RentConstraints
+	}{
+		{listing: store.Listing{
+			Title: "Bright two-room flat near the park", Description: "Renovated flat with a balcony and a view of the park.",
+			PropertyType: "apartment", DealType: "sale", Price: 52000000, City: "Almaty", Address: "Abay Ave 10",
+			Rooms: rooms(2), Area: area(64.5),
+		}},
+		{listing: store.Listing{
+			Title: "Studio for long-term rent", Description: "Furnished studio five minutes from the metro.",
+			PropertyType: "apartment", DealType: "rent", Price: 250000, City: "Almaty", Address: "Satpayev St 22",
+			Rooms: rooms(1), Area: area(32),
+		}, rent: &store.RentConstraints{AllowStudents: true, MaxOccupants: 2, MinTermMonths: 6}},
+		{listing: store.Listing{
+			Title: "Family house with a garden", Description: "Two-storey house with a garage and a large garden.",
+			PropertyType: "house", DealType: "sale", Price: 140000000, City: "Astana", Address: "Kabanbay Batyr 5",
+			Rooms: rooms(5), Area: area(210),
+		}},
+	}
+
+	var firstListing *store.Listing
+	for i := range listings {
+		listing := &listings[i].listing
+		listing.CompanyID = company.ID
+		listing.Status = store.ListingStatusActive
+		if err := s.Listings.Create(ctx, listing, nil, listings[i].rent); err != nil {
+			return err
+		}
+		if firstListing == nil {
+			firstListing = listing
+		}
+	}
+
+	application := &store.Application{
+		ListingID: firstListing.ID,
+		UserID:    buyer.ID,
+		FullName:  "Bella Buyer",
+		Phone:     "+77010000000",
+		Email:     buyer.Email,
+		DealType:  firstListing.DealType,
+	}
+	if err := s.Applications.Create(ctx, application); err != nil {
+		return err
+	}
+	if err := s.Favorites.Add(ctx, buyer.ID, firstListing.ID); err != nil {
+		return err
+	}
+
+	return s.Messages.Create(ctx, &store.ApplicationMessage{
+		ApplicationID: application.ID,
+		SenderUserID:  &buyer.ID,
+		Body:          "Hello! Is the flat still available for a viewing this week?",
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+)
+
+// maxDeprecationClients caps the clients tracked per route so that anonymous
+// traffic from many addresses cannot grow the registry without bound.
+const maxDeprecationClients = 1000
+
+// deprecation describes a route that still works but will be removed.
+type deprecation struct {
+	since  time.Time
+	sunset time.Time
+	// link points to migration notes
+	link string
+}
+
+// deprecatedRoutes is the single place where routes are marked deprecated.
+// Keys are "METHOD /path" with the full chi pattern and are passed to
+// deprecations.middleware when mounting the route; "/vN/*" covers a whole
+// version, see apiVersions.
+var deprecatedRoutes = map[string]deprecation{
+	"/v1/*": {
+		since: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		link:  "/v2/changelog",
+	},
+	"PATCH /v1/admin/complaints/{complaintID}/status": {
+		since:  time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		sunset: time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC),
+		link:   "/v1/changelog",
+	},
+	"PATCH /v1/admin/users/{userID}/status": {
+		since:  time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		sunset: time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC),
+		link:   "/v1/changelog",
+	},
+}
+
+var deprecations = newDeprecationRegistry(deprecatedRoutes)
+
+type DeprecatedClientUsage struct {
+	Client   string    `json:"client"`
+	Calls    int64     `json:"calls"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type DeprecatedRouteReport struct {
+	Route   string                  `json:"route"`
+	Since   time.Time               `json:"since"`
+	Sunset  *time.Time              `json:"sunset,omitempty"`
+	Link    string                  `json:"link,omitempty"`
+	Calls   int64                   `json:"calls"`
+	Clients []DeprecatedClientUsage `json:"clients"`
+}
+
+// deprecationRegistry counts calls to deprecated routes per client. Counts
+// are kept in memory and reset on restart; they are also published through
+// expvar as deprecated_calls.
+type deprecationRegistry struct {
+	routes map[string]deprecation
+
+	mu    sync.Mutex
+	calls map[string]int64
+	usage map[string]map[string]*DeprecatedClientUsage
+}
+
+func newDeprecationRegistry(routes map[string]deprecation) *deprecationRegistry {
+	return &deprecationRegistry{
+		routes: routes,
+		calls:  make(map[string]int64, len(routes)),
+		usage:  make(map[string]map[string]*DeprecatedClientUsage, len(routes)),
+	}
+}
+
+// middleware sets the Deprecation (RFC 9745) and Sunset (RFC 8594) headers
+// plus a Link to migration notes and records the call. It panics when route
+// is not registered so that a typo fails at startup.
+func (d *deprecationRegistry) middleware(route string) func(http.Handler) http.Handler {
+	dep, ok := d.routes[route]
+	if !ok {
+		panic(fmt.Sprintf("route %q is not in deprecatedRoutes", route))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", dep.since.Unix()))
+			if !dep.sunset.IsZero() {
+				w.Header().Set("Sunset", dep.sunset.UTC().Format(http.TimeFormat))
+			}
+			if dep.link != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, dep.link))
+			}
+
+			d.record(route, deprecationClient(r))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (d *deprecationRegistry) record(route, client string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls[route]++
+
+	clients, ok := d.usage[route]
+	if !ok {
+		clients = make(map[string]*DeprecatedClientUsage)
+		d.usage[route] = clients
+	}
+
+	usage, ok := clients[client]
+	if !ok {
+		if len(clients) >= maxDeprecationClients {
+			return
+		}
+		usage = &DeprecatedClientUsage{Client: client}
+		clients[client] = usage
+	}
+
+	usage.Calls++
+	usage.LastSeen = time.Now()
+}
+
+// totals returns the call count per deprecated route for expvar.
+func (d *deprecationRegistry) totals() any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	totals := make(map[string]int64, len(d.calls))
+	for route, calls := range d.calls {
+		totals[route] = calls
+	}
+	return totals
+}
+
+// report lists every deprecated route with the clients still calling it,
+// busiest first.
+func (d *deprecationRegistry) report() []DeprecatedRouteReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	reports := make([]DeprecatedRouteReport, 0, len(d.routes))
+	for route, dep := range d.routes {
+		report := DeprecatedRouteReport{
+			Route:   route,
+			Since:   dep.since,
+			Link:    dep.link,
+			Calls:   d.calls[route],
+			Clients: make([]DeprecatedClientUsage, 0, len(d.usage[route])),
+		}
+		if !dep.sunset.IsZero() {
+			sunset := dep.sunset
+			report.Sunset = &sunset
+		}
+
+		for _, usage := range d.usage[route] {
+			report.Clients = append(report.Clients, *usage)
+		}
+		sort.Slice(report.Clients, func(i, j int) bool {
+			return report.Clients[i].Calls > report.Clients[j].Calls
+		})
+
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Route < reports[j].Route })
+
+	return reports
+}
+
+// deprecationClient identifies the caller by user ID when authenticated and
+// by remote address otherwise.
+func deprecationClient(r *http.Request) string {
+	if user := reqctx.User(r.Context()); user != nil {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// deprecationReportHandler godoc
+//
+//	@Summary		Deprecated endpoint usage
+//	@Description	Lists deprecated routes with their sunset dates and the clients still calling them since the last restart
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		DeprecatedRouteReport
+//	@Failure		403	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/deprecations [get]
+func (app *application) deprecationReportHandler(r *http.Request, _ *noBody) ([]DeprecatedRouteReport, error) {
+	return deprecations.report(), nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/signing"
+	"github.com/go-chi/chi/v5"
+)
+
+// Files that must not be publicly guessable are downloaded from
+// /v1/downloads through links that carry their expiry and a signature over
+// the path, so a link works without the user's token, e.g. in a browser tab,
+// until it expires.
+
+// defaultDownloadTTL is how long a download link works when
+// SIGNED_URL_TTL is not set.
+const defaultDownloadTTL = 15 * time.Minute
+
+var (
+	errInvalidDownloadLink = newHTTPError(http.StatusNotFound, "invalid download link")
+	errExpiredDownloadLink = newHTTPError(http.StatusGone, "the download link has expired")
+)
+
+type DownloadLink struct {
+	// URL is relative to the API host and needs no Authorization header
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// signer signs download links with the auth token secret, like the
+// unsubscribe and tracking links.
+func (app *application) signer() *signing.Signer {
+	return signing.New(app.config.auth.token.secret)
+}
+
+// downloadLink signs path, relative to /downloads, under the API version r
+// was sent to. The signature leaves the version out, so the link keeps
+// working on the others.
+func (app *application) downloadLink(r *http.Request, path string) DownloadLink {
+	ttl := app.config.storage.downloadTTL
+	if ttl <= 0 {
+		ttl = defaultDownloadTTL
+	}
+	return app.signedDownloadLink(r, path, ttl)
+}
+
+// signedDownloadLink is downloadLink for links that work for ttl.
+func (app *application) signedDownloadLink(r *http.Request, path string, ttl time.Duration) DownloadLink {
+	expires := time.Now().Add(ttl).Truncate(time.Second).UTC()
+	return DownloadLink{
+		URL:       strings.TrimSuffix(r.URL.Path, unversionedPath(r.URL.Path)) + app.signer().Sign("/downloads"+path, expires),
+		ExpiresAt: expires,
+	}
+}
+
+// signedDownloadMiddleware lets a request through only with a valid,
+// unexpired signature for its path.
+func (app *application) signedDownloadMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the link is a credential, so keep it out of caches and Referer
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+
+		err := app.signer().Verify(unversionedPath(r.URL.Path), r.URL.Query(), time.Now())
+		switch {
+		case errors.Is(err, signing.ErrExpired):
+			app.errorResponse(w, r, errExpiredDownloadLink)
+			return
+		case err != nil:
+			app.errorResponse(w, r, errInvalidDownloadLink)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// favoritesExportLinkHandler godoc
+//
+//	@Summary		Link to the favorites export
+//	@Description	Returns a signed, time-limited link to the CSV export of the current user's favorites, for downloading it without the Authorization header
+//	@Tags			favorites
+//	@Produce		json
+//	@Success		200	{object}	DownloadLink
+//	@Failure		401	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/favorites/export/link [get]
+func (app *application) favoritesExportLinkHandler(r *http.Request, _ *noBody) (DownloadLink, error) {
+	user := getUserFromContext(r)
+	return app.downloadLink(r, "/favorites/"+strconv.FormatInt(user.ID, 10)), nil
+}
+
+// downloadFavoritesHandler godoc
+//
+//	@Summary		Download a favorites export
+//	@Description	Streams the favorites of a user as CSV. Only works through a link from /favorites/export/link; an expired link answers 410.
+//	@Tags			favorites
+//	@Produce		text/csv
+//	@Param			userID		path		int		true	"User ID"
+//	@Param			expires		query		int		true	"Expiry, Unix seconds"
+//	@Param			signature	query		string	true	"Signature"
+//	@Success		200			{string}	string	"CSV file"
+//	@Failure		404			{object}	error
+//	@Failure		410			{object}	error
+//	@Router			/downloads/favorites/{userID} [get]
+func (app *application) downloadFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.errorResponse(w, r, errInvalidDownloadLink)
+		return
+	}
+
+	// links of users deleted or suspended since stop working
+	if _, err := app.store.Users.GetByID(r.Context(), userID); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeFavoritesCSV(w, r, userID)
+}
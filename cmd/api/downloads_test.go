@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/signing"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestSignedFavoritesDownload(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	mux := app.mount()
+	ctx := context.Background()
+
+	user := &store.User{Username: "jo", Email: "jo@example.com", IsActive: true}
+	if err := app.store.Users.Create(ctx, nil, user); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: 1, Title: "Flat", DealType: "sale", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Favorites.Add(ctx, user.ID, listing.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/favorites/export/link", nil)
+	link, err := app.favoritesExportLinkHandler(req.WithContext(reqctx.WithUser(req.Context(), user)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link.URL, "/v2/downloads/favorites/") || time.Until(link.ExpiresAt) > defaultDownloadTTL {
+		t.Fatalf("got %+v", link)
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		return executeRequest(httptest.NewRequest(http.MethodGet, target, nil), mux)
+	}
+
+	rr := get(link.URL)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if !strings.Contains(rr.Body.String(), "Flat") || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("got %q, headers %v", rr.Body.String(), rr.Header())
+	}
+	// the signature does not cover the version
+	checkResponseCode(t, http.StatusOK, get(strings.Replace(link.URL, "/v2/", "/v1/", 1)).Code)
+
+	u, _ := url.Parse(link.URL)
+	checkResponseCode(t, http.StatusNotFound, get(strings.Replace(u.Path, "/favorites/", "/favorites/9", 1)+"?"+u.RawQuery).Code)
+	checkResponseCode(t, http.StatusNotFound, get(u.Path).Code)
+
+	expired := app.signer().Sign("/downloads/favorites/1", time.Now().Add(-time.Minute))
+	checkResponseCode(t, http.StatusGone, get("/v1"+expired).Code)
+
+	forged := signing.New("guess").Sign("/downloads/favorites/1", time.Now().Add(time.Minute))
+	checkResponseCode(t, http.StatusNotFound, get("/v1"+forged).Code)
+}
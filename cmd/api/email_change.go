@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+	"github.com/go-chi/chi/v5"
+)
+
+type ChangeEmailPayload struct {
+	NewEmail string `json:"new_email" validate:"required,max=255,email_regex"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// requestEmailChangeHandler godoc
+//
+//	@Summary		Request an email change
+//	@Description	Sends confirmation links to both the current and the new address. The email changes only after both are confirmed.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangeEmailPayload	true	"New email and current password"
+//	@Success		202		{object}	store.EmailChange
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [post]
+func (app *application) requestEmailChangeHandler(r *http.Request, payload *ChangeEmailPayload) (*store.EmailChange, error) {
+	user := getUserFromContext(r)
+
+	if err := user.Password.Compare(payload.Password); err != nil {
+		return nil, newHTTPError(http.StatusUnauthorized, "incorrect password")
+	}
+
+	newEmail, err := app.checkEmail(r.Context(), payload.NewEmail)
+	if err != nil {
+		return nil, err
+	}
+	payload.NewEmail = newEmail
+
+	if strings.EqualFold(payload.NewEmail, user.Email) {
+		return nil, newHTTPError(http.StatusBadRequest, "new email must differ from the current one")
+	}
+
+	oldToken, err := app.tokens.Issue(tokens.EmailChange)
+	if err != nil {
+		return nil, err
+	}
+	newToken, err := app.tokens.Issue(tokens.EmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := make([]*store.OutboxEmail, 0, 2)
+	for _, recipient := range []struct {
+		email   string
+		token   string
+		current bool
+	}{
+		{user.Email, oldToken.Plain, true},
+		{payload.NewEmail, newToken.Plain, false},
+	} {
+		data, err := json.Marshal(struct {
+			Username       string
+			NewEmail       string
+			ConfirmURL     string
+			CurrentAddress bool
+		}{
+			Username:       user.Username,
+			NewEmail:       payload.NewEmail,
+			ConfirmURL:     app.buildEmailChangeURL(recipient.token),
+			CurrentAddress: recipient.current,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, &store.OutboxEmail{
+			Template: localizedTemplate(mailer.EmailChangeTemplate, userLocale(user)),
+			Username: user.Username,
+			Email:    recipient.email,
+			Data:     data,
+		})
+	}
+
+	change := &store.EmailChange{
+		UserID:   user.ID,
+		NewEmail: payload.NewEmail,
+		Expiry:   oldToken.ExpiresAt,
+	}
+
+	if err := app.store.EmailChanges.Create(r.Context(), change, oldToken.Hash, newToken.Hash, notifications); err != nil {
+		if errors.Is(err, store.ErrDuplicateEmail) {
+			return nil, newHTTPError(http.StatusConflict, err.Error())
+		}
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// getEmailChangeHandler godoc
+//
+//	@Summary		Pending email change
+//	@Description	Returns the pending email change and which addresses have confirmed it
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.EmailChange
+//	@Failure		404	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [get]
+func (app *application) getEmailChangeHandler(r *http.Request, _ *noBody) (*store.EmailChange, error) {
+	return app.store.EmailChanges.GetByUserID(r.Context(), getUserFromContext(r).ID)
+}
+
+// cancelEmailChangeHandler godoc
+//
+//	@Summary		Cancel an email change
+//	@Description	Discards the pending email change; links already sent stop working
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	map[string]string
+//	@Failure		404	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [delete]
+func (app *application) cancelEmailChangeHandler(r *http.Request, _ *noBody) (map[string]string, error) {
+	if err := app.store.EmailChanges.Delete(r.Context(), getUserFromContext(r).ID); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"message": "email change cancelled"}, nil
+}
+
+// confirmEmailChangeHandler godoc
+//
+//	@Summary		Confirm an email change
+//	@Description	Confirms the change from one of the two addresses. The email is updated once both have confirmed.
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Confirmation token"
+//	@Success		200		{object}	store.EmailChange
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Router			/users/email-change/{token} [put]
+func (app *application) confirmEmailChangeHandler(r *http.Request, _ *noBody) (*store.EmailChange, error) {
+	change, err := app.store.EmailChanges.Confirm(r.Context(), tokens.Lookup(tokens.EmailChange, chi.URLParam(r, "token")))
+	if err != nil {
+		if errors.Is(err, store.ErrDuplicateEmail) {
+			return nil, newHTTPError(http.StatusConflict, err.Error())
+		}
+		return nil, err
+	}
+
+	if change.Completed && app.config.redisCfg.enabled {
+		app.cacheStorage.Users.Delete(r.Context(), change.UserID)
+	}
+	app.forgetProfile(change.UserID)
+
+	return change, nil
+}
+
+func (app *application) buildEmailChangeURL(token string) string {
+	base := strings.TrimRight(app.config.frontendURL, "/")
+	return fmt.Sprintf("%s/confirm-email/%s", base, url.PathEscape(token))
+}
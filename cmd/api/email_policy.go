@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/email"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// checkEmail returns address in the form it is stored and mailed in, and
+// rejects it with a 400 when EMAIL_BLOCK_DISPOSABLE or EMAIL_CHECK_MX say
+// so. Without an email service the address is returned as is.
+func (app *application) checkEmail(ctx context.Context, address string) (string, error) {
+	if app.emails == nil {
+		return address, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, app.config.auth.emailCheck.timeout)
+	defer cancel()
+
+	normalized, err := app.emails.Check(ctx, address)
+	switch {
+	case errors.Is(err, email.ErrInvalid), errors.Is(err, email.ErrDisposable), errors.Is(err, email.ErrNoMailServer):
+		return "", newHTTPError(http.StatusBadRequest, err.Error())
+	case err != nil:
+		return "", err
+	}
+	return normalized, nil
+}
+
+// getUserByLogin looks a user up by username or email. Emails are tried as
+// typed first, so accounts created before a normalization option was turned
+// on keep working, and then normalized like at registration.
+func (app *application) getUserByLogin(ctx context.Context, login string) (*store.User, error) {
+	user, err := app.store.Users.GetByIdentifier(ctx, login)
+	if !errors.Is(err, store.ErrNotFound) || app.emails == nil || !strings.Contains(login, "@") {
+		return user, err
+	}
+
+	normalized, nerr := app.emails.Normalize(login)
+	if nerr != nil || normalized == login {
+		return nil, err
+	}
+	return app.store.Users.GetByIdentifier(ctx, normalized)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateEmailSuppressionPayload struct {
+	Email  string `json:"email" validate:"required,email,max=255"`
+	Reason string `json:"reason" validate:"omitempty,oneof=bounce complaint unsubscribe manual"`
+	Detail string `json:"detail" validate:"max=500"`
+}
+
+// adminListEmailSuppressionsHandler godoc
+//
+//	@Summary		Lists suppressed email addresses
+//	@Description	Returns addresses that are never emailed, newest first
+//	@Tags			admin
+//	@Produce		json
+//	@Param			reason	query		string	false	"bounce, complaint, unsubscribe or manual"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		store.EmailSuppression
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/email-suppressions [get]
+func (app *application) adminListEmailSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	fq.Search = r.URL.Query().Get("reason")
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	suppressions, err := app.store.Suppressions.List(r.Context(), fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suppressions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// adminCreateEmailSuppressionHandler godoc
+//
+//	@Summary		Suppresses an email address
+//	@Description	Stops all email to the address. The reason defaults to manual; an address that is already suppressed keeps its original entry.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateEmailSuppressionPayload	true	"Address to suppress"
+//	@Success		201		{object}	store.EmailSuppression
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/email-suppressions [post]
+func (app *application) adminCreateEmailSuppressionHandler(r *http.Request, payload *CreateEmailSuppressionPayload) (*store.EmailSuppression, error) {
+	suppression := &store.EmailSuppression{
+		Email:  strings.TrimSpace(payload.Email),
+		Reason: payload.Reason,
+		Source: "admin",
+		Detail: payload.Detail,
+	}
+	if suppression.Reason == "" {
+		suppression.Reason = store.SuppressionManual
+	}
+
+	if err := app.store.Suppressions.Add(r.Context(), suppression); err != nil {
+		return nil, err
+	}
+
+	app.logAdminAction(getUserFromContext(r), "suppress_email", "email", 0, suppression.Reason)
+	return suppression, nil
+}
+
+// adminDeleteEmailSuppressionHandler godoc
+//
+//	@Summary		Removes an email address from the suppression list
+//	@Description	Allows email to the address again
+//	@Tags			admin
+//	@Param			email	path	string	true	"Email address"
+//	@Success		204
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/email-suppressions/{email} [delete]
+func (app *application) adminDeleteEmailSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	email, err := url.PathUnescape(chi.URLParam(r, "email"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Suppressions.Delete(r.Context(), email); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logAdminAction(getUserFromContext(r), "unsuppress_email", "email", 0, "")
+
+	if err := app.jsonResponse(w, http.StatusNoContent, ""); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// With MAIL_TRACKING on, notification emails count their opens and clicks:
+// links go through GET /v1/track/click/{token}, which redirects to them,
+// and a pixel loads GET /v1/track/open/{token}. Transactional emails are
+// never tracked, so activation and sign-in links stay direct, and users can
+// opt out under /users/me/email-tracking.
+
+// trackingPixel is a transparent 1x1 GIF.
+var trackingPixel = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+// trackingClaims is what a tracking token carries: the outbox email, its
+// template for the stats and, for clicks, the link to redirect to.
+type trackingClaims struct {
+	OutboxID int64  `json:"e"`
+	Template string `json:"t"`
+	URL      string `json:"u,omitempty"`
+}
+
+type EmailTrackingSettings struct {
+	Enabled bool `json:"enabled"`
+}
+
+type SetEmailTrackingPayload struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+// trackingToken signs claims with the auth token secret, like the
+// unsubscribe links, so the redirect cannot be pointed anywhere else.
+func (app *application) trackingToken(kind string, claims trackingClaims) string {
+	payload, _ := json.Marshal(claims)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(app.trackingMAC(kind, payload))
+}
+
+// parseTrackingToken returns the claims of a valid token of kind.
+func (app *application) parseTrackingToken(kind, token string) (trackingClaims, bool) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return trackingClaims{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return trackingClaims{}, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, app.trackingMAC(kind, payload)) {
+		return trackingClaims{}, false
+	}
+
+	var claims trackingClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return trackingClaims{}, false
+	}
+	return claims, true
+}
+
+func (app *application) trackingMAC(kind string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(app.config.auth.token.secret))
+	mac.Write([]byte("track-" + kind + ":"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// trackEmail returns the context to send email with, set up for tracking
+// when it should be tracked.
+func (app *application) trackEmail(ctx context.Context, email store.OutboxEmail) (context.Context, bool) {
+	if !app.config.mail.tracking || mailer.IsTransactional(email.Template) {
+		return ctx, false
+	}
+
+	optedOut, err := app.store.EmailTracking.OptedOut(ctx, email.Email)
+	if err != nil {
+		app.logger.Errorw("could not check email tracking opt-out, sending untracked", "id", email.ID, "error", err)
+		return ctx, false
+	}
+	if optedOut {
+		return ctx, false
+	}
+
+	base := strings.TrimRight(app.config.mail.trackingURL, "/")
+	claims := trackingClaims{OutboxID: email.ID, Template: email.Template}
+	return mailer.WithTracking(ctx, mailer.Tracking{
+		OpenURL: base + "/open/" + app.trackingToken(store.TrackingEventOpen, claims),
+		ClickURL: func(link string) string {
+			claims := claims
+			claims.URL = link
+			return base + "/click/" + app.trackingToken(store.TrackingEventClick, claims)
+		},
+	}), true
+}
+
+// recordTrackingEvent stores an event. Tracking is best effort, so a
+// failure is only logged.
+func (app *application) recordTrackingEvent(ctx context.Context, kind string, claims trackingClaims) {
+	err := app.store.EmailTracking.Record(ctx, &store.TrackingEvent{
+		OutboxID: claims.OutboxID,
+		Template: claims.Template,
+		Kind:     kind,
+		URL:      claims.URL,
+	})
+	if err != nil {
+		app.logger.Errorw("could not record email tracking event", "id", claims.OutboxID, "kind", kind, "error", err)
+	}
+}
+
+// trackOpenHandler godoc
+//
+//	@Summary		Tracking pixel of a notification email
+//	@Description	Records that the email was opened and returns a transparent 1x1 GIF
+//	@Tags			email
+//	@Produce		image/gif
+//	@Param			token	path	string	true	"Tracking token"
+//	@Success		200
+//	@Failure		404	{object}	error
+//	@Router			/track/open/{token} [get]
+func (app *application) trackOpenHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := app.parseTrackingToken(store.TrackingEventOpen, chi.URLParam(r, "token"))
+	if !ok {
+		app.notFoundResponse(w, r, errors.New("invalid tracking link"))
+		return
+	}
+	app.recordTrackingEvent(r.Context(), store.TrackingEventOpen, claims)
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(trackingPixel)
+}
+
+// trackClickHandler godoc
+//
+//	@Summary		Tracked link of a notification email
+//	@Description	Records the click and redirects to the link from the email
+//	@Tags			email
+//	@Param			token	path	string	true	"Tracking token"
+//	@Success		302
+//	@Failure		404	{object}	error
+//	@Router			/track/click/{token} [get]
+func (app *application) trackClickHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := app.parseTrackingToken(store.TrackingEventClick, chi.URLParam(r, "token"))
+	if !ok || claims.URL == "" {
+		app.notFoundResponse(w, r, errors.New("invalid tracking link"))
+		return
+	}
+	app.recordTrackingEvent(r.Context(), store.TrackingEventClick, claims)
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, claims.URL, http.StatusFound)
+}
+
+// getEmailTrackingHandler godoc
+//
+//	@Summary		Get the email tracking setting
+//	@Description	Whether opens and clicks of the notification emails sent to the user are tracked
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	EmailTrackingSettings
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email-tracking [get]
+func (app *application) getEmailTrackingHandler(r *http.Request, _ *noBody) (*EmailTrackingSettings, error) {
+	optedOut, err := app.store.EmailTracking.OptedOut(r.Context(), getUserFromContext(r).Email)
+	if err != nil {
+		return nil, err
+	}
+	return &EmailTrackingSettings{Enabled: !optedOut}, nil
+}
+
+// setEmailTrackingHandler godoc
+//
+//	@Summary		Opt in or out of email tracking
+//	@Description	With enabled false, notification emails are sent without tracked links or pixel
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		SetEmailTrackingPayload	true	"Tracking setting"
+//	@Success		200		{object}	EmailTrackingSettings
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email-tracking [put]
+func (app *application) setEmailTrackingHandler(r *http.Request, payload *SetEmailTrackingPayload) (*EmailTrackingSettings, error) {
+	if err := app.store.EmailTracking.SetOptOut(r.Context(), getUserFromContext(r).ID, !*payload.Enabled); err != nil {
+		return nil, err
+	}
+	return &EmailTrackingSettings{Enabled: *payload.Enabled}, nil
+}
+
+// adminEmailTrackingStatsHandler godoc
+//
+//	@Summary		Get email tracking stats
+//	@Description	Returns the tracked emails sent, opened and clicked per template over the last days
+//	@Tags			admin
+//	@Produce		json
+//	@Param			days	query		int	false	"Number of days to look back (default 30)"
+//	@Success		200		{array}		store.TrackingStats
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/email-tracking [get]
+func (app *application) adminEmailTrackingStatsHandler(r *http.Request, _ *noBody) ([]store.TrackingStats, error) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			return nil, newHTTPError(http.StatusBadRequest, "days must be a positive number")
+		}
+		days = parsed
+	}
+
+	return app.store.EmailTracking.Stats(r.Context(), time.Now().AddDate(0, 0, -days))
+}
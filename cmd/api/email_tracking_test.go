@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestEmailTracking(t *testing.T) {
+	app := newTestApplication(t, config{
+		auth: authConfig{token: tokenConfig{secret: "test-secret"}},
+		mail: mailConfig{tracking: true, trackingURL: "https://api.example.com/v1/track"},
+	})
+	app.store = store.NewMemoryStorage()
+	capture := mailer.NewCaptureClient(10)
+	app.mailer = capture
+	mux := app.mount()
+	ctx := context.Background()
+
+	user := &store.User{Username: "jo", Email: "jo@example.com", Role: store.Role{Name: store.RoleUser}}
+	if err := app.store.Users.Create(ctx, nil, user); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func() mailer.CapturedMessage {
+		t.Helper()
+		data, _ := json.Marshal(map[string]string{
+			"Username":       "jo",
+			"SenderName":     "Al",
+			"Excerpt":        "@jo have a look",
+			"MessageURL":     "https://example.com/applications/7?tab=chat&x=1",
+			"UnsubscribeURL": "https://api.example.com/v1/unsubscribe/abc",
+		})
+		email := &store.OutboxEmail{Template: mailer.MentionTemplate, Username: "jo", Email: "jo@example.com", Data: data}
+		if err := app.store.Outbox.Enqueue(ctx, email); err != nil {
+			t.Fatal(err)
+		}
+		app.deliverOutboxEmail(ctx, *email)
+		return capture.Messages()[0]
+	}
+
+	msg := send()
+	links := regexp.MustCompile(`href="([^"]+)"`).FindAllStringSubmatch(msg.Body, -1)
+	if len(links) != 2 || !strings.HasPrefix(links[0][1], "https://api.example.com/v1/track/click/") {
+		t.Fatalf("links %q", links)
+	}
+	if links[1][1] != "https://api.example.com/v1/unsubscribe/abc" {
+		t.Errorf("the unsubscribe link was rewritten: %q", links[1][1])
+	}
+	pixel := regexp.MustCompile(`<img src="(https://api\.example\.com/v1/track/open/[^"]+)"`).FindStringSubmatch(msg.Body)
+	if pixel == nil {
+		t.Fatalf("no tracking pixel in %s", msg.Body)
+	}
+
+	click := strings.TrimPrefix(html.UnescapeString(links[0][1]), "https://api.example.com")
+	req, _ := http.NewRequest(http.MethodGet, click, nil)
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusFound, rr.Code)
+	if got := rr.Header().Get("Location"); got != "https://example.com/applications/7?tab=chat&x=1" {
+		t.Errorf("redirected to %q", got)
+	}
+
+	open := strings.TrimPrefix(pixel[1], "https://api.example.com")
+	for range 2 {
+		req, _ = http.NewRequest(http.MethodGet, open, nil)
+		rr = executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if rr.Header().Get("Content-Type") != "image/gif" {
+			t.Errorf("pixel served as %q", rr.Header().Get("Content-Type"))
+		}
+	}
+
+	// an open token does not work as a click token
+	req, _ = http.NewRequest(http.MethodGet, strings.Replace(open, "/open/", "/click/", 1), nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+
+	stats, err := app.store.EmailTracking.Stats(ctx, msg.SentAt.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := store.TrackingStats{Template: mailer.MentionTemplate, Sent: 1, Opened: 1, Clicked: 1, Opens: 2, Clicks: 1}
+	if len(stats) != 1 || stats[0] != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+
+	if err := app.store.EmailTracking.SetOptOut(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	msg = send()
+	if strings.Contains(msg.Body, "/v1/track/") {
+		t.Errorf("opted out user got a tracked email: %s", msg.Body)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/errreport"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const errorReportTimeout = 5 * time.Second
+
+type errorReportConfig struct {
+	// sentryDSN enables reporting outside development
+	sentryDSN string
+	// environment tags events, e.g. staging; defaults to ENV
+	environment string
+}
+
+// newErrorReporter returns the configured reporter, or nil when reporting
+// is off. Development never reports, so local mistakes do not page anyone.
+func (app *application) newErrorReporter(cfg errorReportConfig) (errreport.Reporter, error) {
+	if cfg.sentryDSN == "" || app.config.env == "development" {
+		return nil, nil
+	}
+
+	sentry, err := errreport.NewSentry(cfg.sentryDSN, cfg.environment, version, errorReportTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return errreport.Async(sentry, errorReportTimeout, func(err error) {
+		app.logger.Warnw("could not report error", "error", err)
+	}), nil
+}
+
+// reportError sends a server error with its stack and request to the error
+// tracker. The message has the same secrets removed as the logs.
+func (app *application) reportError(r *http.Request, errorID string, err error, stack []errreport.Frame, panicked bool) {
+	if app.errorReporter == nil {
+		return
+	}
+
+	event := errreport.Event{
+		ID:        errorID,
+		Time:      time.Now(),
+		Message:   serverErrors.redact.string(err.Error()),
+		Stack:     stack,
+		Panic:     panicked,
+		Method:    r.Method,
+		Path:      serverErrors.redact.string(r.URL.Path),
+		RequestID: middleware.GetReqID(r.Context()),
+		UserAgent: r.UserAgent(),
+	}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		event.Route = rctx.RoutePattern()
+	}
+	if sc := tracing.SpanContextFromContext(r.Context()); sc.IsValid() {
+		event.TraceID = sc.TraceID.String()
+	}
+	if user := getUserFromContext(r); user != nil {
+		event.UserID = user.ID
+	}
+
+	app.errorReporter.Report(r.Context(), event)
+}
+
+// recoverMiddleware turns a panic into the usual 500 response with an
+// error_id and reports it with the stack of the panic. Like chi's
+// Recoverer it lets http.ErrAbortHandler through.
+func (app *application) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			err := fmt.Errorf("panic: %v", rvr)
+			app.logger.Errorw("panic", "method", r.Method, "path", r.URL.Path, "error", err.Error(), "stack", string(debug.Stack()))
+			app.serverError(w, r, err, errreport.PanicStack(), true)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
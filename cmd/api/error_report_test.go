@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/errreport"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestErrorReporting(t *testing.T) {
+	app := newTestApplication(t, config{})
+	var events []errreport.Event
+	app.errorReporter = errreport.ReporterFunc(func(ctx context.Context, e errreport.Event) error {
+		events = append(events, e)
+		return nil
+	})
+
+	mux := chi.NewRouter()
+	mux.Use(app.recoverMiddleware)
+	mux.Get("/v1/listings/{listingID}", handle(app, http.StatusOK, func(r *http.Request, _ *noBody) (any, error) {
+		return nil, errors.New("upstream rejected Bearer hunter2")
+	}))
+	mux.Get("/v1/panics", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/listings/7", nil)
+	req = req.WithContext(reqctx.WithUser(req.Context(), &store.User{ID: 42}))
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusInternalServerError, rr.Code)
+	var body struct {
+		ErrorID string `json:"error_id"`
+	}
+	json.NewDecoder(rr.Body).Decode(&body)
+
+	if len(events) != 1 {
+		t.Fatalf("reported %d events, want 1", len(events))
+	}
+	e := events[0]
+	if e.ID != body.ErrorID || e.UserID != 42 || e.Route != "/v1/listings/{listingID}" || e.Panic {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if strings.Contains(e.Message, "hunter2") {
+		t.Errorf("message not redacted: %s", e.Message)
+	}
+	if !stackHas(e.Stack, "(*application).errorResponse") || stackHas(e.Stack, "internalServerError") {
+		t.Errorf("stack should start at the caller of internalServerError, got %+v", e.Stack)
+	}
+
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, "/v1/panics", nil), mux)
+	checkResponseCode(t, http.StatusInternalServerError, rr.Code)
+	if len(events) != 2 {
+		t.Fatalf("reported %d events, want 2", len(events))
+	}
+	e = events[1]
+	if !e.Panic || !strings.Contains(e.Message, "nil map") || !stackHas(e.Stack, "TestErrorReporting.func") || stackHas(e.Stack, "gopanic") {
+		t.Errorf("unexpected panic event %+v", e)
+	}
+}
+
+// stackHas reports whether one of the top frames is in function.
+func stackHas(stack []errreport.Frame, function string) bool {
+	for _, f := range stack[:min(len(stack), 3)] {
+		if strings.Contains(f.Function, function) {
+			return true
+		}
+	}
+	return false
+}
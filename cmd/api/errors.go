@@ -1,13 +1,49 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/errreport"
 )
 
+// internalServerError answers with an error ID that support can look up
+// through GET /v1/admin/errors/{errorID}.
+// Errors from a request whose deadline passed answer 504 instead.
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	if errors.Is(err, context.DeadlineExceeded) && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		app.gatewayTimeoutResponse(w, r)
+		return
+	}
+	app.serverError(w, r, err, errreport.Stack(1), false)
+}
+
+// gatewayTimeoutResponse answers a request that ran past its deadline, see
+// timeouts.go.
+func (app *application) gatewayTimeoutResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnw("request timed out", "method", r.Method, "path", r.URL.Path)
+
+	writeJSONError(w, http.StatusGatewayTimeout, "the request took too long")
+}
+
+// serverError records, logs and reports err, stack being where it surfaced.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error, stack []errreport.Frame, panicked bool) {
+	errorID := serverErrors.record(r, err)
+	app.logger.Errorw("internal error", "method", r.Method, "path", r.URL.Path, "error_id", errorID, "error", err.Error())
+	app.reportError(r, errorID, err, stack, panicked)
+
+	type envelope struct {
+		Error   string `json:"error"`
+		ErrorID string `json:"error_id"`
+	}
 
-	writeJSONError(w, http.StatusInternalServerError, "the server encountered a problem")
+	writeJSON(w, http.StatusInternalServerError, &envelope{Error: "the server encountered a problem", ErrorID: errorID})
 }
 
 func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
@@ -17,11 +53,44 @@ func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		app.payloadTooLargeResponse(w, r, maxBytesErr.Limit)
+		return
+	}
+
 	app.logger.Warnf("bad request", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
+	if fields, ok := translateValidationErrors(r, err); ok {
+		messages := make([]string, 0, len(fields))
+		for _, message := range fields {
+			messages = append(messages, message)
+		}
+		sort.Strings(messages)
+
+		writeJSONValidationError(w, http.StatusBadRequest, strings.Join(messages, "; "), fields)
+		return
+	}
+
 	writeJSONError(w, http.StatusBadRequest, err.Error())
 }
 
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, limitBytes int64) {
+	app.logger.Warnw("payload too large", "method", r.Method, "path", r.URL.Path, "limit_bytes", limitBytes)
+
+	type envelope struct {
+		Error      string `json:"error"`
+		Code       string `json:"code"`
+		LimitBytes int64  `json:"limit_bytes"`
+	}
+
+	writeJSON(w, http.StatusRequestEntityTooLarge, &envelope{
+		Error:      fmt.Sprintf("request body must not be larger than %d bytes", limitBytes),
+		Code:       "payload_too_large",
+		LimitBytes: limitBytes,
+	})
+}
+
 func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Errorf("conflict response", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
@@ -55,3 +124,43 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 
 	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
 }
+
+// quotaExceededResponse answers a user over the daily request quota until
+// it resets.
+func (app *application) quotaExceededResponse(w http.ResponseWriter, r *http.Request, userID int64, reset time.Time) {
+	app.logger.Warnw("daily request quota exceeded", "method", r.Method, "path", r.URL.Path, "user_id", userID)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+
+	writeJSONError(w, http.StatusTooManyRequests, "daily request quota exceeded, it resets at "+reset.Format(time.RFC3339))
+}
+
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request, message string) {
+	app.logger.Warnw("service unavailable", "method", r.Method, "path", r.URL.Path, "reason", message)
+
+	writeJSONError(w, http.StatusServiceUnavailable, message)
+}
+
+func (app *application) mediaQuotaExceededResponse(w http.ResponseWriter, r *http.Request, usedBytes, limitBytes int64) {
+	app.logger.Warnw("media quota exceeded", "method", r.Method, "path", r.URL.Path, "used_bytes", usedBytes, "limit_bytes", limitBytes)
+
+	type envelope struct {
+		Error      string `json:"error"`
+		Code       string `json:"code"`
+		UsedBytes  int64  `json:"used_bytes"`
+		LimitBytes int64  `json:"limit_bytes"`
+	}
+
+	writeJSON(w, http.StatusRequestEntityTooLarge, &envelope{
+		Error:      fmt.Sprintf("media quota exceeded: %d of %d bytes used", usedBytes, limitBytes),
+		Code:       "media_quota_exceeded",
+		UsedBytes:  usedBytes,
+		LimitBytes: limitBytes,
+	})
+}
+
+func (app *application) unprocessableEntityResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("unprocessable entity", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagMiddleware gives successful GET responses a strong ETag, the hash of
+// the body, and answers 304 without a body when If-None-Match matches it.
+// The handler still runs, so polling clients save bandwidth, not server work.
+// Bodies differ per viewer, so the response varies by Authorization.
+func (app *application) etagMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedResponse{ResponseWriter: w}
+		next.ServeHTTP(buf, r)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+
+		if buf.status == http.StatusOK {
+			sum := sha256.Sum256(buf.body.Bytes())
+			etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+			w.Header().Add("Vary", "Authorization")
+
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.Header().Del("Content-Type")
+				w.Header().Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+// etagMatches reports whether the If-None-Match header value matches etag.
+// If-None-Match uses weak comparison, so W/ prefixes are ignored.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponse holds the status and body back so that headers can still
+// be changed once the handler is done.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
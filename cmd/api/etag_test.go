@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{})
+	body := `{"data":{"id":1}}`
+	h := app.etagMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+
+	do := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := do(http.MethodGet, "")
+	checkResponseCode(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Body.String() != body {
+		t.Fatalf("expected the body with an ETag, got %q %q", etag, first.Body.String())
+	}
+
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		rr := do(http.MethodGet, header)
+		checkResponseCode(t, http.StatusNotModified, rr.Code)
+		if rr.Body.Len() != 0 {
+			t.Errorf("304 for %q should have no body", header)
+		}
+	}
+
+	checkResponseCode(t, http.StatusOK, do(http.MethodGet, `"other"`).Code)
+
+	post := do(http.MethodPost, etag)
+	checkResponseCode(t, http.StatusCreated, post.Code)
+	if post.Header().Get("ETag") != "" {
+		t.Error("only GET responses should get an ETag")
+	}
+}
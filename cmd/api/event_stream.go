@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/push"
+)
+
+// GET /v1/events streams the notifications that go to push devices as
+// Server-Sent Events, for clients that cannot keep a push registration or
+// sit behind proxies that break long-lived upgrades. Each user's latest
+// events are kept in process so a client reconnecting with Last-Event-ID
+// gets what it missed. When they are gone, after a restart or because the
+// backlog overflowed, the stream starts with a resync event and the client
+// reloads through the REST endpoints instead.
+//
+// Streams live on the instance that serves them: with several instances a
+// notification reaches the streams of the instance that created it.
+const (
+	eventStreamBuffer = 16
+	// eventStreamRetention is how long the backlog of a user without an
+	// open stream is kept
+	eventStreamRetention = time.Hour
+)
+
+var errTooManyStreams = newHTTPError(http.StatusTooManyRequests, "too many open event streams")
+
+type eventStreamConfig struct {
+	// heartbeat is how often an idle stream sends a comment, so proxies do
+	// not close it
+	heartbeat time.Duration
+	// backlog is how many events per user are kept for Last-Event-ID
+	backlog int
+	// maxPerUser caps the streams a user has open at once, 0 for no cap
+	maxPerUser int
+}
+
+// streamEvent is one notification on the stream.
+type streamEvent struct {
+	id   int64
+	data []byte
+}
+
+type userStream struct {
+	// backlog is oldest first
+	backlog []streamEvent
+	// dropped is the newest event pushed out of the backlog
+	dropped     int64
+	updated     time.Time
+	subscribers map[chan streamEvent]struct{}
+}
+
+// eventStream fans notifications out to the open streams. Event IDs grow
+// across users and, being seeded from the clock, across restarts.
+type eventStream struct {
+	mu    sync.Mutex
+	users map[int64]*userStream
+	// first is the first ID this process handed out; earlier IDs are from
+	// before a restart
+	first  int64
+	lastID int64
+	// forgotten is the newest event of the users whose backlog expired
+	forgotten int64
+	pruned    time.Time
+}
+
+// publish adds an event for userID and passes it to the user's streams. A
+// stream that has fallen behind is closed so its client reconnects and
+// resumes from the backlog.
+func (s *eventStream) publish(userID int64, data []byte, backlog int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+
+	s.lastID = max(s.lastID+1, time.Now().UnixMicro())
+	event := streamEvent{id: s.lastID, data: data}
+
+	u := s.user(userID)
+	u.updated = time.Now()
+	u.backlog = append(u.backlog, event)
+	if n := len(u.backlog) - max(backlog, 1); n > 0 {
+		u.dropped = u.backlog[n-1].id
+		u.backlog = append([]streamEvent(nil), u.backlog[n:]...)
+	}
+
+	for ch := range u.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(u.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	s.prune()
+}
+
+// subscribe opens a stream for userID. It returns the events after
+// lastID, and whether some of them are no longer known.
+func (s *eventStream) subscribe(userID, lastID int64, maxPerUser int) (chan streamEvent, []streamEvent, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+
+	u := s.users[userID]
+	if u != nil && maxPerUser > 0 && len(u.subscribers) >= maxPerUser {
+		return nil, nil, false, errTooManyStreams
+	}
+
+	var missed []streamEvent
+	resync := lastID > 0 && lastID < s.first-1
+	if u != nil {
+		for _, event := range u.backlog {
+			if event.id > lastID {
+				missed = append(missed, event)
+			}
+		}
+		resync = resync || lastID > 0 && lastID < u.dropped
+	} else {
+		resync = resync || lastID > 0 && lastID < s.forgotten
+		u = s.user(userID)
+	}
+
+	ch := make(chan streamEvent, eventStreamBuffer)
+	u.subscribers[ch] = struct{}{}
+	return ch, missed, resync, nil
+}
+
+func (s *eventStream) unsubscribe(userID int64, ch chan streamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u := s.users[userID]; u != nil {
+		if _, ok := u.subscribers[ch]; ok {
+			delete(u.subscribers, ch)
+			close(ch)
+		}
+		u.updated = time.Now()
+	}
+}
+
+func (s *eventStream) init() {
+	if s.users == nil {
+		s.users = map[int64]*userStream{}
+		s.first = time.Now().UnixMicro()
+		s.lastID = s.first - 1
+		s.pruned = time.Now()
+	}
+}
+
+func (s *eventStream) user(userID int64) *userStream {
+	u := s.users[userID]
+	if u == nil {
+		u = &userStream{updated: time.Now(), subscribers: map[chan streamEvent]struct{}{}}
+		s.users[userID] = u
+	}
+	return u
+}
+
+// prune forgets the users that have had no stream and no event for
+// eventStreamRetention. It runs at most once a minute.
+func (s *eventStream) prune() {
+	if time.Since(s.pruned) < time.Minute {
+		return
+	}
+	s.pruned = time.Now()
+
+	for id, u := range s.users {
+		if len(u.subscribers) > 0 || time.Since(u.updated) < eventStreamRetention {
+			continue
+		}
+		if n := len(u.backlog); n > 0 {
+			s.forgotten = max(s.forgotten, u.backlog[n-1].id)
+		}
+		delete(s.users, id)
+	}
+}
+
+// notify sends n to the user's devices and open event streams.
+func (app *application) notify(ctx context.Context, userID int64, n push.Notification) {
+	app.queuePush(ctx, userID, n)
+
+	data, err := json.Marshal(n)
+	if err != nil {
+		app.logger.Errorw("could not encode notification event", "user_id", userID, "error", err)
+		return
+	}
+	app.stream.publish(userID, data, app.config.eventStream.backlog)
+}
+
+// eventStreamHandler godoc
+//
+//	@Summary		Stream notifications
+//	@Description	Server-Sent Events with the notifications that also go to push devices. Send the last event ID as Last-Event-ID to resume; a resync event means some were lost and state should be reloaded.
+//	@Tags			users
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received"
+//	@Success		200				{object}	push.Notification
+//	@Failure		400				{object}	error
+//	@Failure		429				{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/events [get]
+func (app *application) eventStreamHandler(w http.ResponseWriter, r *http.Request) {
+	var lastID int64
+	if header := strings.TrimSpace(r.Header.Get("Last-Event-ID")); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid Last-Event-ID %q", header))
+			return
+		}
+		lastID = id
+	}
+
+	cfg := app.config.eventStream
+	user := getUserFromContext(r)
+	ch, missed, resync, err := app.stream.subscribe(user.ID, lastID, cfg.maxPerUser)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	defer app.stream.unsubscribe(user.ID, ch)
+
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	// nginx buffers responses unless told not to
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", time.Second.Milliseconds())
+	if resync {
+		fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+	}
+	for _, event := range missed {
+		writeStreamEvent(w, event)
+	}
+	if err := rc.Flush(); err != nil {
+		app.logger.Warnw("event stream cannot be flushed", "error", err)
+		return
+	}
+
+	heartbeat := cfg.heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 25 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// the request deadline ends the stream; EventSource reconnects
+			// with Last-Event-ID
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeStreamEvent(w, event)
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, event streamEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", event.id, event.data)
+}
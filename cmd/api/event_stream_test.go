@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/push"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestEventStreamResume(t *testing.T) {
+	var s eventStream
+
+	for i := 0; i < 3; i++ {
+		s.publish(1, []byte(strconv.Itoa(i)), 2)
+	}
+	s.publish(2, []byte("other"), 2)
+
+	// the first event was pushed out of the backlog
+	ch, missed, resync, err := s.subscribe(1, 0, 0)
+	if err != nil || resync || len(missed) != 2 || string(missed[0].data) != "1" {
+		t.Fatalf("new stream: %d missed, resync %v, err %v", len(missed), resync, err)
+	}
+	s.unsubscribe(1, ch)
+
+	ch, missed, resync, _ = s.subscribe(1, missed[0].id, 0)
+	if resync || len(missed) != 1 || string(missed[0].data) != "2" {
+		t.Errorf("resume after the second: %d missed, resync %v", len(missed), resync)
+	}
+	s.unsubscribe(1, ch)
+
+	ch, _, resync, _ = s.subscribe(1, s.first-1, 0)
+	if !resync {
+		t.Error("resuming before the backlog should resync")
+	}
+	s.unsubscribe(1, ch)
+
+	ch, missed, resync, _ = s.subscribe(3, s.first-10, 0)
+	if !resync || len(missed) != 0 {
+		t.Errorf("ID from before a restart: %d missed, resync %v", len(missed), resync)
+	}
+	s.unsubscribe(3, ch)
+
+	if _, _, _, err := s.subscribe(1, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.subscribe(1, 0, 1); err != errTooManyStreams {
+		t.Errorf("second stream: err = %v, want errTooManyStreams", err)
+	}
+}
+
+func TestEventStreamSlowSubscriber(t *testing.T) {
+	var s eventStream
+	ch, _, _, _ := s.subscribe(1, 0, 0)
+
+	for i := 0; i <= eventStreamBuffer; i++ {
+		s.publish(1, []byte("{}"), 100)
+	}
+	for range ch {
+	}
+	// closed by publish; unsubscribing must not close it again
+	s.unsubscribe(1, ch)
+}
+
+func TestEventStreamHandler(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.config.eventStream = eventStreamConfig{heartbeat: time.Hour, backlog: 10}
+	user := &store.User{ID: 7, Username: "alice"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.eventStreamHandler(w, r.WithContext(reqctx.WithUser(r.Context(), user)))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	app.notify(ctx, user.ID, push.Notification{Title: "first"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), "data: ") {
+				return strings.TrimPrefix(lines.Text(), "data: ")
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return ""
+	}
+
+	if data := next(); !strings.Contains(data, `"title":"first"`) {
+		t.Errorf("backlog event = %s", data)
+	}
+	app.notify(ctx, user.ID, push.Notification{Title: "second"})
+	if data := next(); !strings.Contains(data, `"title":"second"`) {
+		t.Errorf("live event = %s", data)
+	}
+
+	rr := httptest.NewRecorder()
+	bad := httptest.NewRequest(http.MethodGet, "/v1/events", nil)
+	bad.Header.Set("Last-Event-ID", "abc")
+	app.eventStreamHandler(rr, bad.WithContext(reqctx.WithUser(bad.Context(), user)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID: status %d", rr.Code)
+	}
+}
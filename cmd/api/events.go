@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+type eventsConfig struct {
+	// natsURL also publishes every event to NATS; empty keeps them in
+	// process
+	natsURL string
+	// subject is put in front of the event type in NATS subjects
+	subject string
+}
+
+// userRegisteredEvent is the user.registered payload; it leaves out the
+// contact details consumers have no need for.
+type userRegisteredEvent struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	CompanyID *int64 `json:"company_id,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// emailSentEvent is the email.sent payload. The address stays out of it.
+type emailSentEvent struct {
+	ID          int64  `json:"id"`
+	Template    string `json:"template"`
+	TriggeredBy string `json:"triggered_by"`
+}
+
+// newEventBus returns the bus handlers publish to, with webhooks subscribed
+// to the events they can receive, federation to new listings and the search
+// indexer to every listing change.
+func (app *application) newEventBus() *events.Bus {
+	bus := events.NewBus()
+	for _, event := range store.WebhookEvents {
+		bus.Subscribe(event, app.enqueueWebhooks)
+	}
+	bus.Subscribe(events.ListingPublished, app.federateListing)
+
+	app.indexer = newSearchIndexer()
+	for _, event := range []string{events.ListingCreated, events.ListingUpdated, events.ListingDeleted} {
+		bus.Subscribe(event, app.queueIndex)
+	}
+	return bus
+}
+
+// publishNATS subscribes a NATS publisher to every event on the bus.
+func (app *application) publishNATS(cfg eventsConfig) error {
+	publisher, err := events.NewNATSPublisher(events.NATSConfig{
+		URL:     cfg.natsURL,
+		Subject: cfg.subject,
+		Name:    "valar-morghulis-api",
+	})
+	if err != nil {
+		return err
+	}
+	publisher.OnError = func(err error) {
+		app.logger.Warnw("could not publish event to NATS", "error", err)
+	}
+
+	app.eventPublisher = publisher
+	app.bus.Subscribe(events.All, publisher.Handle)
+	return nil
+}
+
+// publish sends an event to the bus. Failing handlers are logged and never
+// fail the request that caused the event.
+func (app *application) publish(ctx context.Context, eventType string, companyID *int64, data any) {
+	if err := app.bus.Publish(ctx, events.New(eventType, companyID, data)); err != nil {
+		app.logger.Errorw("could not publish event", "event", eventType, "error", err)
+	}
+}
+
+func (app *application) publishUserRegistered(ctx context.Context, user *store.User) {
+	app.publish(ctx, events.UserRegistered, user.CompanyID, userRegisteredEvent{
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      user.Role.Name,
+		CompanyID: user.CompanyID,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+// publishApplicationMessage tags the message with the company whose listing
+// the application is for.
+func (app *application) publishApplicationMessage(ctx context.Context, msg *store.ApplicationMessage) {
+	var companyID *int64
+	if application, err := app.store.Applications.GetByID(ctx, msg.ApplicationID); err == nil {
+		if listing, err := app.store.Listings.GetByID(ctx, application.ListingID); err == nil {
+			companyID = &listing.CompanyID
+		}
+	}
+	app.publish(ctx, events.ApplicationMessageCreated, companyID, msg)
+}
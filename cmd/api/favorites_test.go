@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestListingFavoriteStats(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	alice := &store.User{Username: "alice", Email: "alice@example.com", IsActive: true}
+	bob := &store.User{Username: "bob", Email: "bob@example.com", IsActive: true}
+	for _, u := range []*store.User{alice, bob} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listing := &store.Listing{CompanyID: 1, Title: "Flat", DealType: "sale", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings/{listingID}", app.getListingHandler)
+	mux.Put("/v1/favorites/{listingID}", app.putFavoriteHandler)
+
+	do := func(method string, user *store.User) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, "/v1/favorites/1", nil)
+		if method == http.MethodGet {
+			req, _ = http.NewRequest(method, "/v1/listings/1", nil)
+		}
+		if user != nil {
+			req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	// saving twice succeeds and counts once
+	for i := 0; i < 2; i++ {
+		checkResponseCode(t, http.StatusOK, do(http.MethodPut, alice).StatusCode)
+	}
+
+	get := func(user *store.User) store.Listing {
+		t.Helper()
+		resp := do(http.MethodGet, user)
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		var body struct {
+			Data store.Listing `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Data
+	}
+
+	if got := get(nil); got.FavoritesCount != 1 || got.FavoritedByMe != nil {
+		t.Errorf("anonymous: count %d, favorited_by_me %v", got.FavoritesCount, got.FavoritedByMe)
+	}
+	if got := get(alice); got.FavoritedByMe == nil || !*got.FavoritedByMe {
+		t.Errorf("alice: expected favorited_by_me true")
+	}
+	if got := get(bob); got.FavoritedByMe == nil || *got.FavoritedByMe {
+		t.Errorf("bob: expected favorited_by_me false")
+	}
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/activitypub"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Companies federate with the fediverse as ActivityPub actors: accounts on
+// Mastodon and other servers follow them, and their listings are delivered
+// to the followers as posts when they go live. Only Follow and Undo are
+// read from inboxes; replies, likes and boosts are ignored.
+const (
+	// maxActivityBytes bounds inbox bodies and fetched actor documents
+	maxActivityBytes = 1 << 20
+	// federationUserAgent is sent with every request to other servers
+	federationUserAgent = "Valar-Morghulis-ActivityPub/1"
+)
+
+var (
+	errFederationDisabled = errors.New("federation is not enabled")
+	errUnknownActor       = newHTTPError(http.StatusNotFound, "no such actor")
+)
+
+type federationConfig struct {
+	// baseURL is the public URL of the API that actor IDs are built on,
+	// e.g. https://api.example.com; empty turns federation off
+	baseURL string
+	// privateKey signs deliveries, an RSA key in PEM; env files may
+	// write its line breaks as \n
+	privateKey string
+}
+
+func (c federationConfig) key() (*rsa.PrivateKey, error) {
+	return activitypub.ParsePrivateKey(strings.ReplaceAll(c.privateKey, `\n`, "\n"))
+}
+
+func (c federationConfig) validate() error {
+	if c.baseURL == "" {
+		return nil
+	}
+	if u, err := url.Parse(c.baseURL); err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" || u.Path != "" && u.Path != "/" {
+		return errors.New("ACTIVITYPUB_BASE_URL must be an http or https URL without a path")
+	}
+	if _, err := c.key(); err != nil {
+		return fmt.Errorf("ACTIVITYPUB_PRIVATE_KEY must be an RSA key in PEM: %w", err)
+	}
+	return nil
+}
+
+// federation is what app.federation holds while federation is on.
+type federation struct {
+	baseURL   string
+	domain    string
+	key       *rsa.PrivateKey
+	publicKey string
+}
+
+// newFederation returns nil when ACTIVITYPUB_BASE_URL is not set.
+func newFederation(cfg federationConfig) (*federation, error) {
+	if cfg.baseURL == "" {
+		return nil, nil
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	key, _ := cfg.key()
+	publicKey, err := activitypub.PublicKeyPEM(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(cfg.baseURL)
+	return &federation{
+		baseURL:   strings.TrimRight(cfg.baseURL, "/"),
+		domain:    u.Host,
+		key:       key,
+		publicKey: publicKey,
+	}, nil
+}
+
+func (f *federation) actorID(companyID int64) string {
+	return fmt.Sprintf("%s/v1/ap/companies/%d", f.baseURL, companyID)
+}
+
+func (f *federation) noteID(listingID int64) string {
+	return fmt.Sprintf("%s/v1/ap/listings/%d", f.baseURL, listingID)
+}
+
+// companyHandle is the preferred username of a company's actor; companies
+// have no username of their own.
+func companyHandle(companyID int64) string {
+	return "company" + strconv.FormatInt(companyID, 10)
+}
+
+// requireFederation answers 404 for the ActivityPub routes while
+// federation is off.
+func (app *application) requireFederation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.federation == nil {
+			app.notFoundResponse(w, r, errFederationDisabled)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeActivityJSON(w http.ResponseWriter, contentType string, data any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(data)
+}
+
+// companyFromURL loads the company in the URL.
+func (app *application) companyFromURL(r *http.Request) (*store.Company, error) {
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		return nil, errUnknownActor
+	}
+	return app.store.Companies.GetByID(r.Context(), companyID)
+}
+
+// webfingerHandler godoc
+//
+//	@Summary		Find a company's actor
+//	@Description	WebFinger (RFC 7033) lookup of acct:company{id}@host, served at /.well-known/webfinger outside the API versions. 404 unless ACTIVITYPUB_BASE_URL is set.
+//	@Tags			federation
+//	@Produce		json
+//	@Param			resource	query		string	true	"acct:company{id}@host or the actor ID"
+//	@Success		200			{object}	activitypub.WebFinger
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Router			/.well-known/webfinger [get]
+func (app *application) webfingerHandler(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	if resource == "" {
+		app.errorResponse(w, r, newHTTPError(http.StatusBadRequest, "resource is required"))
+		return
+	}
+
+	f := app.federation
+	var handle string
+	if account, ok := strings.CutPrefix(resource, "acct:"); ok {
+		name, domain, _ := strings.Cut(account, "@")
+		if !strings.EqualFold(domain, f.domain) {
+			app.errorResponse(w, r, errUnknownActor)
+			return
+		}
+		handle = name
+	} else if id, ok := strings.CutPrefix(resource, f.baseURL+"/v1/ap/companies/"); ok {
+		handle = "company" + id
+	}
+
+	id, ok := strings.CutPrefix(handle, "company")
+	companyID, err := strconv.ParseInt(id, 10, 64)
+	if !ok || err != nil {
+		app.errorResponse(w, r, errUnknownActor)
+		return
+	}
+	company, err := app.store.Companies.GetByID(r.Context(), companyID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	actor := f.actorID(company.ID)
+	writeActivityJSON(w, activitypub.JRDContentType, activitypub.WebFinger{
+		Subject: "acct:" + companyHandle(company.ID) + "@" + f.domain,
+		Aliases: []string{actor},
+		Links: []activitypub.WebFingerLink{
+			{Rel: "self", Type: activitypub.ContentType, Href: actor},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: app.companyPage(company.ID)},
+		},
+	})
+}
+
+func companySummary(c *store.Company) string {
+	if c.City == "" {
+		return c.Type
+	}
+	return c.Type + " in " + c.City
+}
+
+func (app *application) companyPage(companyID int64) string {
+	return fmt.Sprintf("%s/companies/%d", strings.TrimRight(app.config.frontendURL, "/"), companyID)
+}
+
+// companyActorHandler godoc
+//
+//	@Summary		A company as an ActivityPub actor
+//	@Description	The Organization actor other servers follow, with its inbox, outbox, followers and the key its deliveries are signed with
+//	@Tags			federation
+//	@Produce		application/activity+json
+//	@Param			companyID	path		int	true	"Company ID"
+//	@Success		200			{object}	activitypub.Actor
+//	@Failure		404			{object}	error
+//	@Router			/ap/companies/{companyID} [get]
+func (app *application) companyActorHandler(w http.ResponseWriter, r *http.Request) {
+	company, err := app.companyFromURL(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	f := app.federation
+	id := f.actorID(company.ID)
+	writeActivityJSON(w, activitypub.ContentType, activitypub.Actor{
+		Context:           []string{activitypub.ActivityStreams, activitypub.Security},
+		ID:                id,
+		Type:              "Organization",
+		PreferredUsername: companyHandle(company.ID),
+		Name:              company.Name,
+		Summary:           html.EscapeString(companySummary(company)),
+		URL:               app.companyPage(company.ID),
+		Inbox:             id + "/inbox",
+		Outbox:            id + "/outbox",
+		Followers:         id + "/followers",
+		PublicKey: activitypub.PublicKey{
+			ID:           id + "#main-key",
+			Owner:        id,
+			PublicKeyPEM: f.publicKey,
+		},
+	})
+}
+
+// listingNote is a listing as a public post of its company.
+func (app *application) listingNote(l store.Listing) activitypub.Note {
+	f := app.federation
+	link := fmt.Sprintf("%s/listings/%d", strings.TrimRight(app.config.frontendURL, "/"), l.ID)
+	content := fmt.Sprintf(`<p><a href="%s">%s</a></p><p>%s</p>`,
+		html.EscapeString(link), html.EscapeString(l.Title),
+		strings.ReplaceAll(html.EscapeString(listingSummary(l)), "\n", "<br>"))
+
+	published := l.CreatedAt
+	if l.PublishedAt != nil {
+		published = *l.PublishedAt
+	}
+	return activitypub.Note{
+		ID:           f.noteID(l.ID),
+		Type:         "Note",
+		AttributedTo: f.actorID(l.CompanyID),
+		Name:         l.Title,
+		Content:      content,
+		URL:          link,
+		Published:    published,
+		To:           []string{activitypub.Public},
+		Cc:           []string{f.actorID(l.CompanyID) + "/followers"},
+	}
+}
+
+// createActivity wraps the note of l in the Create activity it is
+// delivered and listed in the outbox as.
+func (app *application) createActivity(l store.Listing) activitypub.Activity {
+	note := app.listingNote(l)
+	return activitypub.Activity{
+		ID:        note.ID + "/activity",
+		Type:      "Create",
+		Actor:     note.AttributedTo,
+		Object:    note,
+		Published: note.Published,
+		To:        note.To,
+		Cc:        note.Cc,
+	}
+}
+
+// companyOutboxHandler godoc
+//
+//	@Summary		A company's outbox
+//	@Description	Create activities of the company's 20 newest active listings
+//	@Tags			federation
+//	@Produce		application/activity+json
+//	@Param			companyID	path		int	true	"Company ID"
+//	@Success		200			{object}	activitypub.OrderedCollection
+//	@Failure		404			{object}	error
+//	@Router			/ap/companies/{companyID}/outbox [get]
+func (app *application) companyOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	company, err := app.companyFromURL(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	listings, err := app.store.Listings.List(r.Context(), store.ListingFilter{
+		Limit:     feedItems,
+		Status:    store.ListingStatusActive,
+		CompanyID: &company.ID,
+	})
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	items := make([]any, 0, len(listings))
+	for _, l := range listings {
+		items = append(items, app.createActivity(l))
+	}
+	writeActivityJSON(w, activitypub.ContentType, activitypub.OrderedCollection{
+		Context:      activitypub.ActivityStreams,
+		ID:           app.federation.actorID(company.ID) + "/outbox",
+		Type:         "OrderedCollection",
+		TotalItems:   len(items),
+		OrderedItems: items,
+	})
+}
+
+// companyFollowersHandler godoc
+//
+//	@Summary		A company's remote followers
+//	@Description	How many accounts on other servers follow the company; who they are is not listed
+//	@Tags			federation
+//	@Produce		application/activity+json
+//	@Param			companyID	path		int	true	"Company ID"
+//	@Success		200			{object}	activitypub.OrderedCollection
+//	@Failure		404			{object}	error
+//	@Router			/ap/companies/{companyID}/followers [get]
+func (app *application) companyFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	company, err := app.companyFromURL(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	n, err := app.store.RemoteFollowers.Count(r.Context(), company.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	writeActivityJSON(w, activitypub.ContentType, activitypub.OrderedCollection{
+		Context:    activitypub.ActivityStreams,
+		ID:         app.federation.actorID(company.ID) + "/followers",
+		Type:       "OrderedCollection",
+		TotalItems: n,
+	})
+}
+
+// listingNoteHandler godoc
+//
+//	@Summary		A listing as an ActivityPub note
+//	@Description	The post delivered to followers for an active listing, so servers can fetch it by its ID
+//	@Tags			federation
+//	@Produce		application/activity+json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{object}	activitypub.Note
+//	@Failure		404			{object}	error
+//	@Router			/ap/listings/{listingID} [get]
+func (app *application) listingNoteHandler(w http.ResponseWriter, r *http.Request) {
+	listing, err := app.listingFromURL(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if listing.Status != store.ListingStatusActive {
+		app.errorResponse(w, r, store.ErrNotFound)
+		return
+	}
+	note := app.listingNote(*listing)
+	writeActivityJSON(w, activitypub.ContentType, struct {
+		Context string `json:"@context"`
+		activitypub.Note
+	}{activitypub.ActivityStreams, note})
+}
+
+// companyInboxHandler godoc
+//
+//	@Summary		A company's inbox
+//	@Description	Takes activities from other servers, signed with HTTP Signatures. Follow adds the sender to the company's followers and is answered with an Accept; Undo of a Follow removes them. Other activities are accepted and ignored.
+//	@Tags			federation
+//	@Accept			application/activity+json
+//	@Param			companyID	path	int	true	"Company ID"
+//	@Success		202
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error
+//	@Failure		404	{object}	error
+//	@Router			/ap/companies/{companyID}/inbox [post]
+func (app *application) companyInboxHandler(w http.ResponseWriter, r *http.Request) {
+	company, err := app.companyFromURL(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxActivityBytes))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	sender, err := app.verifyActivity(r, body)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+	var activity activitypub.IncomingActivity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if activity.Actor != sender.ID {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("activity of %s signed by %s", activity.Actor, sender.ID))
+		return
+	}
+
+	actor := app.federation.actorID(company.ID)
+	switch activity.Type {
+	case "Follow":
+		if activitypub.ObjectID(activity.Object) != actor {
+			app.errorResponse(w, r, newHTTPError(http.StatusBadRequest, "Follow is not for this actor"))
+			return
+		}
+		if !isHTTPURL(sender.Inbox) {
+			app.errorResponse(w, r, newHTTPError(http.StatusBadRequest, "the follower has no inbox"))
+			return
+		}
+		follower := &store.RemoteFollower{CompanyID: company.ID, ActorID: sender.ID, Inbox: sender.Inbox}
+		if isHTTPURL(sender.Endpoints.SharedInbox) {
+			follower.SharedInbox = sender.Endpoints.SharedInbox
+		}
+		if err := app.store.RemoteFollowers.Add(r.Context(), follower); err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		var follow any
+		if json.Unmarshal(body, &follow) != nil {
+			follow = activity.ID
+		}
+		accept := activitypub.Activity{
+			Context: activitypub.ActivityStreams,
+			ID:      fmt.Sprintf("%s#accepts/%d", actor, time.Now().UnixNano()),
+			Type:    "Accept",
+			Actor:   actor,
+			Object:  follow,
+		}
+		go app.deliverActivity(context.WithoutCancel(r.Context()), company.ID, sender.Inbox, accept)
+
+	case "Undo":
+		var undone activitypub.IncomingActivity
+		if json.Unmarshal(activity.Object, &undone) == nil && undone.Type == "Follow" && undone.Actor == sender.ID {
+			if err := app.store.RemoteFollowers.Remove(r.Context(), company.ID, sender.ID); err != nil {
+				app.errorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// verifyActivity fetches the actor whose key signed r and checks the
+// signature with it.
+func (app *application) verifyActivity(r *http.Request, body []byte) (*activitypub.RemoteActor, error) {
+	keyID, err := activitypub.KeyID(r)
+	if err != nil {
+		return nil, err
+	}
+	actorURL, _, _ := strings.Cut(keyID, "#")
+	actor, err := app.fetchActor(r.Context(), actorURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", actorURL, err)
+	}
+	if actor.PublicKey.ID != keyID || actor.PublicKey.Owner != actor.ID {
+		return nil, fmt.Errorf("key %s does not belong to %s", keyID, actor.ID)
+	}
+	key, err := activitypub.ParsePublicKey(actor.PublicKey.PublicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := activitypub.Verify(r, body, key, time.Now()); err != nil {
+		return nil, err
+	}
+	return actor, nil
+}
+
+// fetchActor loads an actor from its server, through the webhook client so
+// that only public addresses are reached.
+func (app *application) fetchActor(ctx context.Context, actorURL string) (*activitypub.RemoteActor, error) {
+	if !isHTTPURL(actorURL) {
+		return nil, errors.New("not an http URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, actorURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", activitypub.ContentType)
+	req.Header.Set("User-Agent", federationUserAgent)
+
+	resp, err := app.webhookClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server answered %d", resp.StatusCode)
+	}
+
+	var actor activitypub.RemoteActor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxActivityBytes)).Decode(&actor); err != nil {
+		return nil, err
+	}
+	if actor.ID != actorURL {
+		return nil, fmt.Errorf("document is of %s", actor.ID)
+	}
+	return &actor, nil
+}
+
+// federateListing delivers a listing that went live to the inboxes of its
+// company's followers. It is subscribed to listing.published; deliveries
+// run in the background and are tried once.
+func (app *application) federateListing(ctx context.Context, e events.Event) error {
+	listing, ok := e.Data.(*store.Listing)
+	if app.federation == nil || !ok {
+		return nil
+	}
+	inboxes, err := app.store.RemoteFollowers.Inboxes(ctx, listing.CompanyID)
+	if err != nil || len(inboxes) == 0 {
+		return err
+	}
+
+	activity := app.createActivity(*listing)
+	activity.Context = activitypub.ActivityStreams
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for _, inbox := range inboxes {
+			app.deliverActivity(ctx, listing.CompanyID, inbox, activity)
+		}
+	}()
+	return nil
+}
+
+// deliverActivity POSTs activity to inbox, signed as the company's actor.
+// Failures are logged.
+func (app *application) deliverActivity(ctx context.Context, companyID int64, inbox string, activity activitypub.Activity) {
+	if err := app.postActivity(ctx, companyID, inbox, activity); err != nil {
+		app.logger.Warnw("activity not delivered", "type", activity.Type, "inbox", inbox, "error", err)
+	}
+}
+
+func (app *application) postActivity(ctx context.Context, companyID int64, inbox string, activity activitypub.Activity) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", activitypub.ContentType)
+	req.Header.Set("User-Agent", federationUserAgent)
+	f := app.federation
+	if err := activitypub.Sign(req, body, f.actorID(companyID)+"#main-key", f.key, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := app.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookErrorBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("inbox answered %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/activitypub"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestFederation(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{frontendURL: "https://homes.example.com"})
+	ctx := context.Background()
+
+	ours, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var err error
+	app.federation, err = newFederation(federationConfig{
+		baseURL:    "https://api.example.com",
+		privateKey: strings.ReplaceAll(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(ours)})), "\n", `\n`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.webhookClient = newWebhookClient(webhookConfig{timeout: 5 * time.Second, allowPrivate: true})
+
+	// a remote server with one user, anna, whose inbox records what it gets
+	theirs, _ := rsa.GenerateKey(rand.Reader, 2048)
+	theirPEM, _ := activitypub.PublicKeyPEM(&theirs.PublicKey)
+	received := make(chan activitypub.IncomingActivity, 4)
+	var remote *httptest.Server
+	remote = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anna := remote.URL + "/users/anna"
+		switch r.URL.Path {
+		case "/users/anna":
+			json.NewEncoder(w).Encode(map[string]any{
+				"id": anna, "type": "Person", "inbox": anna + "/inbox",
+				"publicKey": map[string]string{"id": anna + "#main-key", "owner": anna, "publicKeyPem": theirPEM},
+			})
+		case "/users/anna/inbox":
+			body, _ := io.ReadAll(r.Body)
+			if err := activitypub.Verify(r, body, &ours.PublicKey, time.Now()); err != nil {
+				t.Errorf("delivery not signed: %v", err)
+			}
+			var activity activitypub.IncomingActivity
+			json.Unmarshal(body, &activity)
+			received <- activity
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer remote.Close()
+	anna := remote.URL + "/users/anna"
+	wait := func(want string) activitypub.IncomingActivity {
+		t.Helper()
+		select {
+		case activity := <-received:
+			if activity.Type != want {
+				t.Errorf("expected %s, got %+v", want, activity)
+			}
+			return activity
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s delivered", want)
+			return activitypub.IncomingActivity{}
+		}
+	}
+
+	company := &store.Company{Name: "Realty", RegistrationNumber: "1", Email: "realty@example.com", City: "Almaty", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	api := app.mount()
+
+	rr := executeRequest(httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct:company1@api.example.com", nil), api)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if !strings.Contains(rr.Body.String(), `"href":"https://api.example.com/v1/ap/companies/1"`) {
+		t.Errorf("webfinger: %s", rr.Body.String())
+	}
+
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, "/v1/ap/companies/1", nil), api)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var actor activitypub.Actor
+	json.NewDecoder(rr.Body).Decode(&actor)
+	if actor.Inbox != "https://api.example.com/v1/ap/companies/1/inbox" || !strings.Contains(actor.PublicKey.PublicKeyPEM, "PUBLIC KEY") {
+		t.Errorf("actor: %+v", actor)
+	}
+
+	deliver := func(activity map[string]any, sign bool) int {
+		t.Helper()
+		body, _ := json.Marshal(activity)
+		req := httptest.NewRequest(http.MethodPost, "https://api.example.com/v1/ap/companies/1/inbox", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", activitypub.ContentType)
+		if sign {
+			if err := activitypub.Sign(req, body, anna+"#main-key", theirs, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return executeRequest(req, api).Code
+	}
+	follow := map[string]any{"id": anna + "#follows/1", "type": "Follow", "actor": anna, "object": actor.ID}
+
+	checkResponseCode(t, http.StatusUnauthorized, deliver(follow, false))
+	checkResponseCode(t, http.StatusAccepted, deliver(follow, true))
+	accept := wait("Accept")
+	if activitypub.ObjectID(accept.Object) != anna+"#follows/1" {
+		t.Errorf("accepted %s", accept.Object)
+	}
+	if n, _ := app.store.RemoteFollowers.Count(ctx, company.ID); n != 1 {
+		t.Errorf("expected 1 follower, got %d", n)
+	}
+
+	listing := &store.Listing{CompanyID: company.ID, Title: "Flat <3 rooms>", City: "Almaty", DealType: "sale", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	app.publishListingPublished(ctx, listing)
+	create := wait("Create")
+	var note activitypub.Note
+	json.Unmarshal(create.Object, &note)
+	if note.ID != "https://api.example.com/v1/ap/listings/1" || !strings.Contains(note.Content, "Flat &lt;3 rooms&gt;") || note.URL != "https://homes.example.com/listings/1" {
+		t.Errorf("note: %+v", note)
+	}
+
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, "/v1/ap/companies/1/outbox", nil), api)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if !strings.Contains(rr.Body.String(), `"totalItems":1`) {
+		t.Errorf("outbox: %s", rr.Body.String())
+	}
+
+	checkResponseCode(t, http.StatusAccepted, deliver(map[string]any{"type": "Undo", "actor": anna, "object": follow}, true))
+	if n, _ := app.store.RemoteFollowers.Count(ctx, company.ID); n != 0 {
+		t.Errorf("expected no followers after Undo, got %d", n)
+	}
+
+	app.federation = nil
+	checkResponseCode(t, http.StatusNotFound, executeRequest(httptest.NewRequest(http.MethodGet, "/v1/ap/companies/1", nil), api).Code)
+}
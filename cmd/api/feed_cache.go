@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// feedCachedPages is how many pages from the start of a listing feed are
+// cached; deeper pages are read rarely enough to go to the database.
+const feedCachedPages = 3
+
+// feedCacheStats counts feed cache hits, misses and invalidations;
+// published through expvar when Redis is enabled.
+var feedCacheStats = new(expvar.Map)
+
+// listFeed is Listings.List through the feed cache, for the first pages of
+// the public feed. Pages are shared by everyone with the same filter, except
+// ranked ones, which depend on the viewer. Per-viewer fields such as
+// favorited_by_me are set after, so they are never cached.
+func (app *application) listFeed(ctx context.Context, filter store.ListingFilter) ([]store.Listing, error) {
+	if !app.config.redisCfg.enabled || !feedCacheable(filter) {
+		return app.store.Listings.List(ctx, filter)
+	}
+
+	key := feedKey(filter)
+	listings, generation, err := app.cacheStorage.Feed.Get(ctx, key)
+	if err != nil {
+		cacheErrors.Add(1)
+		app.logger.Warnw("feed cache unavailable, using the database", "error", err)
+		return app.store.Listings.List(ctx, filter)
+	}
+	if listings != nil {
+		feedCacheStats.Add("hits", 1)
+		return listings, nil
+	}
+	feedCacheStats.Add("misses", 1)
+
+	listings, err = app.store.Listings.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.cacheStorage.Feed.Set(ctx, key, generation, listings); err != nil {
+		cacheErrors.Add(1)
+		app.logger.Warnw("could not cache feed page", "error", err)
+	}
+	return listings, nil
+}
+
+// invalidateFeed drops the cached feed pages after a listing is created,
+// edited, deleted or changes status.
+func (app *application) invalidateFeed(ctx context.Context) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+	if err := app.cacheStorage.Feed.Invalidate(ctx); err != nil {
+		cacheErrors.Add(1)
+		app.logger.Warnw("could not invalidate the feed cache, pages stay until they expire", "error", err)
+		return
+	}
+	feedCacheStats.Add("invalidations", 1)
+}
+
+func feedCacheable(filter store.ListingFilter) bool {
+	limit := feedPageLimit(filter.Limit)
+	return filter.CompanyID == nil && filter.Offset >= 0 && filter.Offset < feedCachedPages*limit
+}
+
+// feedPageLimit is the page size ListingStore.List gives for limit.
+func feedPageLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return 20
+	case limit > 50:
+		return 50
+	}
+	return limit
+}
+
+// feedKey identifies the page filter asks for. It lists every field
+// listListingsHandler sets, so two filters share a key only if they give
+// the same page.
+func feedKey(filter store.ListingFilter) string {
+	var viewerID int64
+	if filter.Sort == store.ListingSortRanked {
+		viewerID = filter.ViewerID
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%d|%d|%d|%g|%g|%s|%s|%s|%d|%d|%d",
+		filter.Status, filter.DealType, filter.City, filter.PropertyType,
+		filter.PriceMin, filter.PriceMax, filter.RoomsMin, filter.RoomsMax, filter.AreaMin, filter.AreaMax,
+		filter.Tag, filter.Region, filter.Sort, viewerID, filter.Limit, filter.Offset)
+}
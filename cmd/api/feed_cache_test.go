@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// fakeFeedCache keeps pages in a map, with the generation in the key like
+// the Redis store.
+type fakeFeedCache struct {
+	generation int64
+	pages      map[string][]store.Listing
+}
+
+func (f *fakeFeedCache) Get(ctx context.Context, key string) ([]store.Listing, int64, error) {
+	return f.pages[feedPageKey(f.generation, key)], f.generation, nil
+}
+
+func (f *fakeFeedCache) Set(ctx context.Context, key string, generation int64, listings []store.Listing) error {
+	f.pages[feedPageKey(generation, key)] = listings
+	return nil
+}
+
+func (f *fakeFeedCache) Invalidate(ctx context.Context) error {
+	f.generation++
+	return nil
+}
+
+func feedPageKey(generation int64, key string) string {
+	return fmt.Sprintf("%d-%s", generation, key)
+}
+
+func TestListingFeedCache(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{redisCfg: redisConfig{enabled: true}})
+	app.cacheStorage.Feed = &fakeFeedCache{pages: make(map[string][]store.Listing)}
+	ctx := context.Background()
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings", app.listListingsHandler)
+
+	count := func() int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/listings", nil)
+		resp := executeRequest(req, mux).Result()
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		var body struct {
+			Data []store.Listing `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return len(body.Data)
+	}
+	create := func() {
+		t.Helper()
+		l := &store.Listing{CompanyID: 1, Title: "Flat", DealType: "sale", Status: store.ListingStatusActive}
+		if err := app.store.Listings.Create(ctx, l, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	create()
+	if got := count(); got != 1 {
+		t.Fatalf("expected 1 listing, got %d", got)
+	}
+
+	// Written around the API, so the cached page is served.
+	create()
+	if got := count(); got != 1 {
+		t.Errorf("expected the cached page with 1 listing, got %d", got)
+	}
+
+	app.invalidateFeed(ctx)
+	if got := count(); got != 2 {
+		t.Errorf("expected 2 listings after invalidation, got %d", got)
+	}
+}
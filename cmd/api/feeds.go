@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Public listings are also published as RSS 2.0 and Atom feeds, so feed
+// readers and integrations can subscribe without a token: a company's
+// listings and the trending ones. Feeds are anonymous and the same for
+// everyone, so shared caches may keep them.
+const (
+	feedFormatRSS  = "rss"
+	feedFormatAtom = "atom"
+
+	feedItems = 20
+	// feedMaxAge is how long caches may keep a company feed; the trending
+	// feed follows LISTING_TRENDING_INTERVAL.
+	feedMaxAge = 5 * time.Minute
+)
+
+var feedContentTypes = map[string]string{
+	feedFormatRSS:  "application/rss+xml; charset=utf-8",
+	feedFormatAtom: "application/atom+xml; charset=utf-8",
+}
+
+// feed is what both formats are rendered from.
+type feed struct {
+	title       string
+	description string
+	link        string
+	self        string
+	updated     time.Time
+	maxAge      time.Duration
+	items       []feedItem
+}
+
+type feedItem struct {
+	title     string
+	link      string
+	summary   string
+	category  string
+	published time.Time
+	updated   time.Time
+}
+
+// feedHandler serves the feed load builds in format. Last-Modified is the
+// newest item's update, so If-Modified-Since gets 304; the route's etag
+// middleware adds the ETag.
+func (app *application) feedHandler(format string, load func(r *http.Request) (*feed, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := load(r)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		f.self = requestURL(r)
+
+		var body []byte
+		if format == feedFormatAtom {
+			body, err = f.atom()
+		} else {
+			body, err = f.rss()
+		}
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", feedContentTypes[format])
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(f.maxAge.Seconds())))
+		http.ServeContent(w, r, "", f.updated, bytes.NewReader(append([]byte(xml.Header), body...)))
+	}
+}
+
+// companyListingsFeed godoc
+//
+//	@Summary		A company's listings as a feed
+//	@Description	The company's 20 newest active listings as RSS 2.0 (listings.rss) or Atom (listings.atom). Cacheable for five minutes; supports If-None-Match and If-Modified-Since.
+//	@Tags			listings
+//	@Produce		application/rss+xml
+//	@Produce		application/atom+xml
+//	@Param			companyID	path	int	true	"Company ID"
+//	@Success		200
+//	@Success		304
+//	@Failure		400	{object}	error
+//	@Failure		404	{object}	error
+//	@Router			/companies/{companyID}/listings.rss [get]
+func (app *application) companyListingsFeed(r *http.Request) (*feed, error) {
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid company id")
+	}
+	company, err := app.store.Companies.GetByID(r.Context(), companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	listings, err := app.store.Listings.List(r.Context(), store.ListingFilter{
+		Limit:     feedItems,
+		Status:    store.ListingStatusActive,
+		CompanyID: &companyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return app.listingsFeed(
+		company.Name+" listings",
+		"Active listings of "+company.Name,
+		fmt.Sprintf("/companies/%d", company.ID),
+		feedMaxAge,
+		listings,
+	), nil
+}
+
+// trendingListingsFeed godoc
+//
+//	@Summary		Trending listings as a feed
+//	@Description	The 20 trending listings of the last day as RSS 2.0 (trending.rss) or Atom (trending.atom); ?window= takes hour, day or week. Cacheable until the next refresh, LISTING_TRENDING_INTERVAL; supports If-None-Match and If-Modified-Since.
+//	@Tags			listings
+//	@Produce		application/rss+xml
+//	@Produce		application/atom+xml
+//	@Param			window	query	string	false	"hour, day or week"
+//	@Success		200
+//	@Success		304
+//	@Failure		400	{object}	error
+//	@Router			/listings/trending.rss [get]
+func (app *application) trendingListingsFeed(r *http.Request) (*feed, error) {
+	window := defaultTrendingWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		if _, ok := trendingWindows[v]; !ok {
+			return nil, newHTTPError(http.StatusBadRequest, "window must be hour, day or week")
+		}
+		window = v
+	}
+
+	listings, err := app.trendingListings(r.Context(), window)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAge := app.config.listings.trendingInterval
+	if maxAge <= 0 {
+		maxAge = feedMaxAge
+	}
+	return app.listingsFeed(
+		"Trending listings",
+		"The most popular listings of the last "+window,
+		"/listings/trending",
+		maxAge,
+		listings[:min(feedItems, len(listings))],
+	), nil
+}
+
+// listingsFeed links the feed and its items to the frontend at path and
+// /listings/{id}.
+func (app *application) listingsFeed(title, description, path string, maxAge time.Duration, listings []store.Listing) *feed {
+	base := strings.TrimRight(app.config.frontendURL, "/")
+	f := &feed{
+		title:       title,
+		description: description,
+		link:        base + path,
+		maxAge:      maxAge,
+		items:       make([]feedItem, 0, len(listings)),
+	}
+
+	for _, l := range listings {
+		item := feedItem{
+			title:     l.Title,
+			link:      fmt.Sprintf("%s/listings/%d", base, l.ID),
+			summary:   listingSummary(l),
+			category:  l.PropertyType,
+			published: parseFeedTime(l.CreatedAt),
+			updated:   parseFeedTime(l.UpdatedAt),
+		}
+		if l.PublishedAt != nil {
+			item.published = parseFeedTime(*l.PublishedAt)
+		}
+		if item.updated.Before(item.published) {
+			item.updated = item.published
+		}
+		if item.updated.After(f.updated) {
+			f.updated = item.updated
+		}
+		f.items = append(f.items, item)
+	}
+	return f
+}
+
+func listingSummary(l store.Listing) string {
+	parts := []string{l.DealType, l.PropertyType}
+	if l.City != "" {
+		parts = append(parts, l.City)
+	}
+	summary := strings.Join(parts, ", ") + fmt.Sprintf(": %d", l.Price)
+	if l.Description != "" {
+		summary += "\n\n" + l.Description
+	}
+	return summary
+}
+
+// parseFeedTime reads a timestamp as the store returns it; the zero time
+// if it cannot.
+func parseFeedTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+// requestURL is the absolute URL r was sent to, for a feed's self link.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	TTL           int       `xml:"ttl"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (f *feed) rss() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.title,
+		Link:        f.link,
+		Description: f.description,
+		Self:        rssSelf{Href: f.self, Rel: "self", Type: "application/rss+xml"},
+		TTL:         int(f.maxAge.Minutes()),
+		Items:       make([]rssItem, 0, len(f.items)),
+	}
+	if !f.updated.IsZero() {
+		channel.LastBuildDate = f.updated.Format(time.RFC1123Z)
+	}
+	for _, item := range f.items {
+		entry := rssItem{
+			Title:       item.title,
+			Link:        item.link,
+			Description: item.summary,
+			Category:    item.category,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.link},
+		}
+		if !item.published.IsZero() {
+			entry.PubDate = item.published.Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, entry)
+	}
+	return xml.MarshalIndent(rssFeed{Version: "2.0", AtomNS: "http://www.w3.org/2005/Atom", Channel: channel}, "", "  ")
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Link      atomLink      `xml:"link"`
+	Published string        `xml:"published,omitempty"`
+	Updated   string        `xml:"updated"`
+	Category  *atomCategory `xml:"category"`
+	Summary   string        `xml:"summary"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func (f *feed) atom() ([]byte, error) {
+	// Atom requires updated, also on an empty feed
+	updated := f.updated
+	if updated.IsZero() {
+		updated = time.Unix(0, 0).UTC()
+	}
+	out := atomFeed{
+		ID:       f.link,
+		Title:    f.title,
+		Subtitle: f.description,
+		Updated:  updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.link, Rel: "alternate", Type: "text/html"},
+			{Href: f.self, Rel: "self", Type: "application/atom+xml"},
+		},
+		Entries: make([]atomEntry, 0, len(f.items)),
+	}
+	for _, item := range f.items {
+		entry := atomEntry{
+			ID:      item.link,
+			Title:   item.title,
+			Link:    atomLink{Href: item.link, Rel: "alternate"},
+			Updated: item.updated.Format(time.RFC3339),
+			Summary: item.summary,
+		}
+		if !item.published.IsZero() {
+			entry.Published = item.published.Format(time.RFC3339)
+		}
+		if item.category != "" {
+			entry.Category = &atomCategory{Term: item.category}
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+	return xml.MarshalIndent(out, "", "  ")
+}
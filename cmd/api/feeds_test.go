@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestListingFeeds(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{frontendURL: "https://homes.example.com/"})
+	app.config.listings.trendingInterval = time.Minute
+	mux := app.mount()
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Acme & Sons", Type: "agency"}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Flat <3 rooms>", DealType: "sale", PropertyType: "apartment", City: "Almaty", Price: 100, Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string, edit func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if edit != nil {
+			edit(req)
+		}
+		return executeRequest(req, mux)
+	}
+	path := fmt.Sprintf("/v1/companies/%d/listings", company.ID)
+
+	rr := get(path+".rss", nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if rr.Header().Get("Content-Type") != feedContentTypes[feedFormatRSS] || rr.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("headers %v", rr.Header())
+	}
+	var rss rssFeed
+	if err := xml.Unmarshal(rr.Body.Bytes(), &rss); err != nil {
+		t.Fatal(err)
+	}
+	if rss.Channel.Title != "Acme & Sons listings" || len(rss.Channel.Items) != 1 || rss.Channel.Items[0].Title != listing.Title ||
+		rss.Channel.Items[0].Link != fmt.Sprintf("https://homes.example.com/listings/%d", listing.ID) {
+		t.Errorf("got %+v", rss.Channel)
+	}
+
+	// conditional requests
+	etag, lastModified := rr.Header().Get("ETag"), rr.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("headers %v", rr.Header())
+	}
+	checkResponseCode(t, http.StatusNotModified, get(path+".rss", func(r *http.Request) { r.Header.Set("If-None-Match", etag) }).Code)
+	checkResponseCode(t, http.StatusNotModified, get(path+".rss", func(r *http.Request) { r.Header.Set("If-Modified-Since", lastModified) }).Code)
+
+	rr = get(path+".atom", nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var atom atomFeed
+	if err := xml.Unmarshal(rr.Body.Bytes(), &atom); err != nil {
+		t.Fatal(err)
+	}
+	if len(atom.Entries) != 1 || atom.Entries[0].Category == nil || atom.Entries[0].Category.Term != "apartment" || !strings.Contains(atom.Entries[0].Summary, "Almaty") {
+		t.Errorf("got %+v", atom)
+	}
+
+	checkResponseCode(t, http.StatusNotFound, get("/v1/companies/999/listings.rss", nil).Code)
+
+	rr = get("/v2/listings/trending.atom?window=week", nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if !strings.Contains(rr.Body.String(), "Flat &lt;3 rooms&gt;") || rr.Header().Get("Cache-Control") != "public, max-age=60" {
+		t.Errorf("got %s, headers %v", rr.Body.String(), rr.Header())
+	}
+	checkResponseCode(t, http.StatusBadRequest, get("/v1/listings/trending.rss?window=year", nil).Code)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-playground/validator/v10"
+)
+
+// noBody is used as the request type for handlers that do not read a body.
+type noBody struct{}
+
+// httpError lets a typed handler pick the status code for an error that
+// errorResponse would otherwise map to 500.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func newHTTPError(status int, message string) error {
+	return &httpError{status: status, message: message}
+}
+
+// handle adapts a typed handler to http.HandlerFunc. It decodes and validates
+// the JSON body into Req, maps the returned error to a response and writes
+// the result wrapped in the usual data envelope with the given status. Paged
+// results also get a meta block and a Link header.
+func handle[Req, Resp any](app *application, status int, fn func(r *http.Request, req *Req) (Resp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+
+		if _, ok := any(&req).(*noBody); !ok {
+			if err := readJSON(w, r, &req); err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+
+			if err := Validate.Struct(req); err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+		}
+
+		resp, err := fn(r, &req)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		if page, ok := any(resp).(pagedResponse); ok {
+			err = app.jsonPageResponse(w, r, status, page.pageItems(), page.pageInfo())
+		} else {
+			err = app.jsonResponse(w, status, resp)
+		}
+		if err != nil {
+			app.internalServerError(w, r, err)
+		}
+	}
+}
+
+// errorResponse maps store and validation errors to the matching response.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var httpErr *httpError
+	var validationErrs validator.ValidationErrors
+
+	switch {
+	case errors.As(err, &httpErr):
+		switch httpErr.status {
+		case http.StatusForbidden:
+			app.forbiddenResponse(w, r)
+		case http.StatusUnauthorized:
+			app.unauthorizedErrorResponse(w, r, err)
+		case http.StatusNotFound:
+			app.notFoundResponse(w, r, err)
+		case http.StatusConflict:
+			app.conflictResponse(w, r, err)
+		case http.StatusBadRequest:
+			app.badRequestResponse(w, r, err)
+		default:
+			writeJSONError(w, httpErr.status, httpErr.message)
+		}
+	case errors.As(err, &validationErrs):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, service.ErrForbidden):
+		app.forbiddenResponse(w, r)
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrForeignKey):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, store.ErrConflict), errors.Is(err, store.ErrInvalidTransition):
+		app.conflictResponse(w, r, err)
+	case errors.Is(err, store.ErrCheckViolation):
+		app.badRequestResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHandle(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	type payload struct {
+		Name string `json:"name" validate:"required"`
+	}
+
+	echo := handle(app, http.StatusCreated, func(r *http.Request, req *payload) (string, error) {
+		return req.Name, nil
+	})
+
+	t.Run("decodes and validates the body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"bob"}`))
+		rr := executeRequest(req, echo)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+		if !strings.Contains(rr.Body.String(), `"data":"bob"`) {
+			t.Errorf("unexpected body %s", rr.Body.String())
+		}
+	})
+
+	t.Run("rejects an invalid body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":""}`))
+		rr := executeRequest(req, echo)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("maps store errors", func(t *testing.T) {
+		notFound := handle(app, http.StatusOK, func(r *http.Request, _ *noBody) (any, error) {
+			return nil, store.ErrNotFound
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := executeRequest(req, notFound)
+
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("returns an error ID for server errors", func(t *testing.T) {
+		failing := handle(app, http.StatusOK, func(r *http.Request, _ *noBody) (any, error) {
+			return nil, errors.New("upstream rejected Bearer hunter2")
+		})
+
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/listings", nil), failing)
+		checkResponseCode(t, http.StatusInternalServerError, rr.Code)
+
+		var body struct {
+			ErrorID string `json:"error_id"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body.ErrorID == "" {
+			t.Fatalf("expected an error_id, got %v", err)
+		}
+
+		mux := chi.NewRouter()
+		mux.Get("/v1/admin/errors/{errorID}", handle(app, http.StatusOK, app.getServerErrorHandler))
+		rr = executeRequest(httptest.NewRequest(http.MethodGet, "/v1/admin/errors/"+body.ErrorID, nil), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if !strings.Contains(rr.Body.String(), `"path":"/v1/listings"`) || strings.Contains(rr.Body.String(), "hunter2") {
+			t.Errorf("unexpected error record %s", rr.Body.String())
+		}
+
+		rr = executeRequest(httptest.NewRequest(http.MethodGet, "/v1/admin/errors/unknown", nil), mux)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestReadJSONLimits(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	type payload struct {
+		Name string `json:"name"`
+		Meta any    `json:"meta"`
+	}
+
+	echo := handle(app, http.StatusOK, func(r *http.Request, req *payload) (string, error) {
+		return req.Name, nil
+	})
+	limited := bodyLimitMiddleware(32)(echo)
+
+	t.Run("rejects bodies over the route limit with 413", func(t *testing.T) {
+		body := `{"name":"` + strings.Repeat("a", 64) + `"}`
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), limited)
+
+		checkResponseCode(t, http.StatusRequestEntityTooLarge, rr.Code)
+		if !strings.Contains(rr.Body.String(), `"limit_bytes":32`) {
+			t.Errorf("unexpected body %s", rr.Body.String())
+		}
+	})
+
+	t.Run("accepts bodies under the route limit", func(t *testing.T) {
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"bob"}`)), limited)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("rejects deeply nested bodies", func(t *testing.T) {
+		body := `{"meta":` + strings.Repeat("[", maxJSONDepth) + strings.Repeat("]", maxJSONDepth) + `}`
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), echo)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("ignores brackets in strings", func(t *testing.T) {
+		body := `{"name":"` + strings.Repeat("[", 2*maxJSONDepth) + `"}`
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), echo)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestReadJSONErrors(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	type payload struct {
+		Name  string `json:"name"`
+		Price int64  `json:"price"`
+	}
+
+	echo := handle(app, http.StatusOK, func(r *http.Request, req *payload) (string, error) {
+		return req.Name, nil
+	})
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{``, `body must not be empty`},
+		{`{"name":"bob",}`, `body contains badly-formed JSON (at byte 15)`},
+		{`{"name":"bob"`, `body contains badly-formed JSON`},
+		{`{"price":"12"}`, `body field \"price\" must be an integer, not string`},
+		{`["bob"]`, `body must be an object, not array (at byte 1)`},
+		{`{"nickname":"bob"}`, `body contains unknown field \"nickname\"`},
+		{`{"name":"bob"}{"name":"alice"}`, `body must only contain a single JSON value`},
+	}
+
+	for _, tt := range tests {
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)), echo)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		if !strings.Contains(rr.Body.String(), tt.want) {
+			t.Errorf("body %q: got %s, want %q", tt.body, rr.Body.String(), tt.want)
+		}
+	}
+}
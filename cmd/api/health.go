@@ -1,22 +1,63 @@
 package main
 
 import (
+	"database/sql"
 	"net/http"
+	"strconv"
 )
 
+// dbPoolStats is the part of sql.DBStats worth watching for pool
+// exhaustion: a growing wait_count means requests queue for a connection.
+type dbPoolStats struct {
+	MaxOpen           int   `json:"max_open"`
+	Open              int   `json:"open"`
+	InUse             int   `json:"in_use"`
+	Idle              int   `json:"idle"`
+	WaitCount         int64 `json:"wait_count"`
+	WaitDurationMs    int64 `json:"wait_duration_ms"`
+	MaxIdleClosed     int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+}
+
+func newDBPoolStats(s sql.DBStats) dbPoolStats {
+	return dbPoolStats{
+		MaxOpen:           s.MaxOpenConnections,
+		Open:              s.OpenConnections,
+		InUse:             s.InUse,
+		Idle:              s.Idle,
+		WaitCount:         s.WaitCount,
+		WaitDurationMs:    s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:     s.MaxIdleClosed,
+		MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+		MaxLifetimeClosed: s.MaxLifetimeClosed,
+	}
+}
+
 // healthcheckHandler godoc
 //
 //	@Summary		Healthcheck
-//	@Description	Healthcheck endpoint
+//	@Description	Healthcheck endpoint, with the database connection pool statistics, read replica lag and SMTP failover state
 //	@Tags			ops
 //	@Produce		json
 //	@Success		200	{object}	string	"ok"
 //	@Router			/health [get]
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	data := map[string]string{
-		"status":  "ok",
-		"env":     app.config.env,
-		"version": version,
+	data := map[string]any{
+		"status":      "ok",
+		"env":         app.config.env,
+		"version":     version,
+		"read_only":   strconv.FormatBool(app.readOnly.Load() || app.schemaIncompatible.Load()),
+		"maintenance": strconv.FormatBool(app.inMaintenance()),
+	}
+	if app.dbStats != nil {
+		data["database"] = newDBPoolStats(app.dbStats())
+	}
+	if app.replicas != nil {
+		data["replicas"] = app.replicas.Status()
+	}
+	if app.smtpServers != nil {
+		data["smtp"] = app.smtpServers.Status()
 	}
 
 	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/lru"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// Hot public resources are cached at two levels. Responses carry
+// Cache-Control and a Surrogate-Key header naming what they show, such as
+// "listing-12 company-3", so a CDN can keep anonymous responses for
+// HTTP_CACHE_MAX_AGE and purge them by key. Behind that, HTTP_CACHE_LRU_SIZE
+// keeps the most read listings and profiles in process for
+// HTTP_CACHE_LRU_TTL, so a traffic spike on one listing reads it from
+// Postgres once. Changes made on an instance drop its copies right away;
+// other instances see them within HTTP_CACHE_LRU_TTL. Per-viewer fields,
+// views and visibility checks are still worked out on every request.
+const surrogateKeyHeader = "Surrogate-Key"
+
+type httpCacheConfig struct {
+	// maxAge is how long shared caches may keep anonymous responses; 0
+	// makes them revalidate every time
+	maxAge time.Duration
+	// lruSize is how many listings and how many profiles are kept in
+	// process; 0 disables the in-process cache
+	lruSize int
+	lruTTL  time.Duration
+}
+
+func (c httpCacheConfig) validate() error {
+	switch {
+	case c.maxAge < 0:
+		return fmt.Errorf("HTTP_CACHE_MAX_AGE must not be negative, got %s", c.maxAge)
+	case c.lruSize < 0:
+		return fmt.Errorf("HTTP_CACHE_LRU_SIZE must not be negative, got %d", c.lruSize)
+	case c.lruSize > 0 && c.lruTTL <= 0:
+		return errors.New("HTTP_CACHE_LRU_TTL must be positive when HTTP_CACHE_LRU_SIZE is set")
+	}
+	return nil
+}
+
+// hotCache returns the in-process cache, nil when it is disabled.
+func (c httpCacheConfig) hotCache() *hotCache {
+	if c.lruSize == 0 {
+		return nil
+	}
+	return &hotCache{
+		listings: lru.New[hotKey, store.Listing](c.lruSize, c.lruTTL),
+		profiles: lru.New[hotKey, store.User](c.lruSize, c.lruTTL),
+		tenants:  map[int64]bool{},
+	}
+}
+
+// hotCache holds copies of what the store returned, before per-viewer
+// fields are set. Entries are kept per tenant, as the store only finds a
+// row in its own tenant, and are read from the primary so replication lag
+// is not cached. A nil *hotCache caches nothing.
+type hotCache struct {
+	listings *lru.Cache[hotKey, store.Listing]
+	profiles *lru.Cache[hotKey, store.User]
+
+	mu sync.Mutex
+	// tenants are the tenant scopes entries were added in, for forgetting
+	// an ID in all of them
+	tenants map[int64]bool
+}
+
+// hotKey is an ID in the tenant scope of the request, 0 for none.
+type hotKey struct {
+	tenant int64
+	id     int64
+}
+
+// key is the key of id for requests with ctx.
+func (h *hotCache) key(ctx context.Context, id int64) hotKey {
+	tenantID, _ := store.TenantFromContext(ctx)
+	h.mu.Lock()
+	h.tenants[tenantID] = true
+	h.mu.Unlock()
+	return hotKey{tenant: tenantID, id: id}
+}
+
+// keys are the keys id may be cached under.
+func (h *hotCache) keys(id int64) []hotKey {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]hotKey, 0, len(h.tenants))
+	for tenantID := range h.tenants {
+		keys = append(keys, hotKey{tenant: tenantID, id: id})
+	}
+	return keys
+}
+
+func (h *hotCache) stats() any {
+	if h == nil {
+		return nil
+	}
+	return map[string]lru.Stats{"listings": h.listings.Stats(), "profiles": h.profiles.Stats()}
+}
+
+// cachedListing is Listings.GetByID through the hot cache.
+func (app *application) cachedListing(ctx context.Context, listingID int64) (*store.Listing, error) {
+	if app.hot == nil {
+		return app.store.Listings.GetByID(ctx, listingID)
+	}
+	key := app.hot.key(ctx, listingID)
+	if listing, ok := app.hot.listings.Get(key); ok {
+		return &listing, nil
+	}
+
+	listing, err := app.store.Listings.GetByID(store.WithPrimaryReads(ctx), listingID)
+	if err != nil {
+		return nil, err
+	}
+	app.hot.listings.Add(key, *listing)
+	return listing, nil
+}
+
+// cachedProfile is the user service's Get through the hot cache, for
+// showing profiles; authentication reads users without it.
+func (app *application) cachedProfile(ctx context.Context, userID int64) (*store.User, error) {
+	if app.hot == nil {
+		return app.userService().Get(ctx, userID)
+	}
+	key := app.hot.key(ctx, userID)
+	if user, ok := app.hot.profiles.Get(key); ok {
+		return &user, nil
+	}
+
+	user, err := app.userService().Get(store.WithPrimaryReads(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	app.hot.profiles.Add(key, *user)
+	return user, nil
+}
+
+// forgetListings drops listings from the hot cache after they change.
+func (app *application) forgetListings(listingIDs ...int64) {
+	if app.hot == nil {
+		return
+	}
+	for _, id := range listingIDs {
+		for _, key := range app.hot.keys(id) {
+			app.hot.listings.Remove(key)
+		}
+	}
+}
+
+// forgetProfile drops a user from the hot cache after their profile changes.
+func (app *application) forgetProfile(userID int64) {
+	if app.hot == nil {
+		return
+	}
+	for _, key := range app.hot.keys(userID) {
+		app.hot.profiles.Remove(key)
+	}
+}
+
+// setCacheHeaders marks a response as showing the resources named by keys.
+// Anonymous responses are the same for everyone and may be kept by shared
+// caches; the others carry per-viewer fields and are private.
+func (app *application) setCacheHeaders(w http.ResponseWriter, r *http.Request, keys ...string) {
+	h := w.Header()
+	h.Set(surrogateKeyHeader, strings.Join(keys, " "))
+	if getUserFromContext(r) != nil {
+		h.Set("Cache-Control", "private, no-cache")
+		return
+	}
+	// the host is part of the cache key already, the tenant header is not
+	if tenancy := app.config.tenancy; tenancy.enabled && tenancy.header != "" {
+		h.Add("Vary", tenancy.header)
+	}
+	if maxAge := app.config.httpCache.maxAge; maxAge > 0 {
+		h.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	} else {
+		h.Set("Cache-Control", "public, no-cache")
+	}
+}
+
+func listingKey(listingID int64) string {
+	return "listing-" + strconv.FormatInt(listingID, 10)
+}
+
+func companyKey(companyID int64) string {
+	return "company-" + strconv.FormatInt(companyID, 10)
+}
+
+func userKey(userID int64) string {
+	return "user-" + strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHTTPCache(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{httpCache: httpCacheConfig{maxAge: time.Minute, lruSize: 10, lruTTL: time.Hour}})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Acme", Type: "agency"}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Flat", DealType: "sale", PropertyType: "apartment", City: "Almaty", Price: 100, Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	agent := &store.User{ID: 1, CompanyID: &company.ID, Role: store.Role{Name: store.RoleAgency}}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings/{listingID}", app.getListingHandler)
+	mux.Delete("/v1/listings/{listingID}", app.deleteListingHandler)
+	do := func(method, path string, user *store.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if user != nil {
+			req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		}
+		return executeRequest(req, mux)
+	}
+	path := "/v1/listings/" + strconv.FormatInt(listing.ID, 10)
+
+	rr := do(http.MethodGet, path, nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if got := rr.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("anonymous Cache-Control = %q", got)
+	}
+	if got, want := rr.Header().Get(surrogateKeyHeader), listingKey(listing.ID)+" "+companyKey(company.ID); got != want {
+		t.Errorf("%s = %q, want %q", surrogateKeyHeader, got, want)
+	}
+	if got := do(http.MethodGet, path, agent).Header().Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("signed-in Cache-Control = %q", got)
+	}
+
+	// changes that skip the hooks are served from the cache until it
+	// expires
+	if err := app.store.Listings.UpdateStatus(ctx, listing.ID, store.ListingStatusArchived); err != nil {
+		t.Fatal(err)
+	}
+	checkResponseCode(t, http.StatusOK, do(http.MethodGet, path, nil).Code)
+	if stats := app.hot.listings.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("listing cache stats %+v", stats)
+	}
+
+	checkResponseCode(t, http.StatusNoContent, do(http.MethodDelete, path, agent).Code)
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodGet, path, nil).Code)
+}
+
+func TestHTTPCacheTenants(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{
+		httpCache: httpCacheConfig{maxAge: time.Minute, lruSize: 10, lruTTL: time.Hour},
+		tenancy:   tenancyConfig{enabled: true, header: "X-Tenant"},
+	})
+	ctx := reqctx.WithTenant(context.Background(), 1)
+
+	company := &store.Company{Name: "Acme", Type: "agency"}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Flat", DealType: "sale", PropertyType: "apartment", City: "Almaty", Price: 100, Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings/{listingID}", app.getListingHandler)
+	get := func(tenantID int64) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/listings/"+strconv.FormatInt(listing.ID, 10), nil)
+		return executeRequest(req.WithContext(reqctx.WithTenant(req.Context(), tenantID)), mux).Code
+	}
+
+	checkResponseCode(t, http.StatusOK, get(1))
+	req := httptest.NewRequest(http.MethodGet, "/v1/listings/"+strconv.FormatInt(listing.ID, 10), nil)
+	rr := executeRequest(req.WithContext(reqctx.WithTenant(req.Context(), 1)), mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	// shared caches keep a copy per tenant
+	if got := rr.Header().Get("Vary"); got != "X-Tenant" {
+		t.Errorf("Vary = %q", got)
+	}
+	// the copy cached for one tenant is not shown to another
+	checkResponseCode(t, http.StatusNotFound, get(2))
+
+	app.forgetListings(listing.ID)
+	if app.hot.listings.Len() != 0 {
+		t.Errorf("%d listings still cached", app.hot.listings.Len())
+	}
+}
+
+func TestHTTPCacheConfig(t *testing.T) {
+	for _, cfg := range []httpCacheConfig{
+		{maxAge: -time.Second},
+		{lruSize: -1},
+		{lruSize: 100},
+	} {
+		if cfg.validate() == nil {
+			t.Errorf("%+v should be refused", cfg)
+		}
+	}
+	if (httpCacheConfig{}).hotCache() != nil {
+		t.Error("the in-process cache should be off by default")
+	}
+}
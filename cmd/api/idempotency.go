@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentBodyBytes    = 1 << 20
+)
+
+// idempotencyMiddleware lets clients safely retry POST and PATCH requests.
+// The first response for an Idempotency-Key is stored for
+// cache.IdempotencyExpTime and replayed for retries, so a registration that
+// timed out on the client does not create a second account. Keys are scoped
+// to the method, path and Authorization header. Requires Redis; without it
+// the header is ignored.
+//
+// Only JSON bodies of up to maxIdempotentBodyBytes are compared between
+// retries. Uploads and larger bodies are passed on as they are, without
+// replay, for the route's own limit to apply.
+func (app *application) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || !app.config.redisCfg.enabled || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			app.badRequestResponse(w, r, errors.New("idempotency key must be at most 255 characters"))
+			return
+		}
+
+		if !isJSONRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodyBytes+1))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if len(body) > maxIdempotentBodyBytes {
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// keys are per tenant, like the resources the requests create
+		ctx := r.Context()
+		tenantID, _ := store.TenantFromContext(ctx)
+		cacheKey := hashStrings(strconv.FormatInt(tenantID, 10), r.Method, r.URL.Path, r.Header.Get("Authorization"), key)
+		requestHash := hashStrings(string(body))
+
+		// If the cache is down the request runs without replay protection
+		// rather than failing.
+		stored, err := app.cacheStorage.Idempotency.Get(ctx, cacheKey)
+		if err != nil {
+			cacheErrors.Add(1)
+			app.logger.Warnw("idempotency cache unavailable", "path", r.URL.Path, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if stored == nil {
+			reserved, err := app.cacheStorage.Idempotency.Reserve(ctx, cacheKey, requestHash)
+			if err != nil {
+				cacheErrors.Add(1)
+				app.logger.Warnw("idempotency cache unavailable", "path", r.URL.Path, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if reserved {
+				app.serveIdempotent(w, r, next, cacheKey, requestHash)
+				return
+			}
+
+			// Lost the race to a concurrent request with the same key.
+			stored, err = app.cacheStorage.Idempotency.Get(ctx, cacheKey)
+			if err != nil {
+				cacheErrors.Add(1)
+				app.logger.Warnw("idempotency cache unavailable", "path", r.URL.Path, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if stored == nil {
+				app.conflictResponse(w, r, errors.New("a request with this idempotency key is still being processed"))
+				return
+			}
+		}
+
+		if stored.RequestHash != requestHash {
+			app.unprocessableEntityResponse(w, r, errors.New("idempotency key was already used with a different request body"))
+			return
+		}
+
+		if !stored.Completed {
+			app.conflictResponse(w, r, errors.New("a request with this idempotency key is still being processed"))
+			return
+		}
+
+		// headers set for this request by the middleware in front win
+		for name, values := range stored.Header {
+			if _, ok := w.Header()[name]; !ok {
+				w.Header()[name] = values
+			}
+		}
+		if len(stored.Header) == 0 {
+			// stored before headers were kept
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set(idempotencyReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	})
+}
+
+// serveIdempotent runs the request that reserved cacheKey and stores its
+// response. The reservation is released when there is nothing to store: a
+// server error, which the client may retry, or a panic.
+func (app *application) serveIdempotent(w http.ResponseWriter, r *http.Request, next http.Handler, cacheKey, requestHash string) {
+	// the request context may be over by the time the response is stored
+	ctx := context.WithoutCancel(r.Context())
+	stored := false
+	defer func() {
+		if !stored {
+			app.cacheStorage.Idempotency.Delete(ctx, cacheKey)
+		}
+	}()
+
+	rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(rec, r)
+
+	if rec.status >= http.StatusInternalServerError {
+		return
+	}
+
+	header := w.Header().Clone()
+	for _, name := range idempotencyUnstoredHeaders {
+		header.Del(name)
+	}
+	if err := app.cacheStorage.Idempotency.Set(ctx, cacheKey, &cache.IdempotentResponse{
+		RequestHash: requestHash,
+		Completed:   true,
+		Status:      rec.status,
+		Header:      header,
+		Body:        rec.body.Bytes(),
+	}); err != nil {
+		app.logger.Errorw("could not store idempotent response", "path", r.URL.Path, "error", err)
+		return
+	}
+	stored = true
+}
+
+// idempotencyUnstoredHeaders describe the original exchange rather than the
+// response and are not replayed.
+var idempotencyUnstoredHeaders = []string{"Content-Length", "Date", "Set-Cookie", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"}
+
+// isJSONRequest reports whether r has a JSON body or none at all.
+func isJSONRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// readCloser reads from a reader in front of the body it closes.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseRecorder passes the response through while keeping a copy of the
+// status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func hashStrings(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
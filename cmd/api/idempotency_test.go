@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+)
+
+// memIdempotencyStore keeps idempotent responses in a map, like Redis
+// without expiry.
+type memIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]cache.IdempotentResponse
+}
+
+func (s *memIdempotencyStore) Get(ctx context.Context, key string) (*cache.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+func (s *memIdempotencyStore) Reserve(ctx context.Context, key, requestHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.responses[key]; ok {
+		return false, nil
+	}
+	s.responses[key] = cache.IdempotentResponse{RequestHash: requestHash}
+	return true, nil
+}
+
+func (s *memIdempotencyStore) Set(ctx context.Context, key string, resp *cache.IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[key] = *resp
+	return nil
+}
+
+func (s *memIdempotencyStore) Delete(ctx context.Context, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, key)
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	app := newTestApplication(t, config{redisCfg: redisConfig{enabled: true}})
+	app.cacheStorage.Idempotency = &memIdempotencyStore{responses: map[string]cache.IdempotentResponse{}}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	var handler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		switch string(body) {
+		case `{"wait":true}`:
+			<-release
+		case `{"panic":true}`:
+			panic("boom")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/things/7")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data":{"id":7,"size":` + strconv.Itoa(len(body)) + `}}`))
+	}
+	mux := app.recoverMiddleware(app.idempotencyMiddleware(handler))
+
+	post := func(key, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/things", bytes.NewReader(body))
+		req.Header.Set(idempotencyKeyHeader, key)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should replay the response with its headers", func(t *testing.T) {
+		calls.Store(0)
+		first := post("replay", "application/json", []byte(`{"name":"a"}`))
+		checkResponseCode(t, http.StatusCreated, first.Code)
+
+		again := post("replay", "application/json", []byte(`{"name":"a"}`))
+		checkResponseCode(t, http.StatusCreated, again.Code)
+		if calls.Load() != 1 {
+			t.Errorf("the handler ran %d times", calls.Load())
+		}
+		if again.Body.String() != first.Body.String() || again.Header().Get("Location") != "/v1/things/7" ||
+			again.Header().Get(idempotencyReplayedHeader) != "true" {
+			t.Errorf("replayed %q with headers %v", again.Body, again.Header())
+		}
+	})
+
+	t.Run("should refuse another body for a key", func(t *testing.T) {
+		post("mismatch", "application/json", []byte(`{"name":"a"}`))
+		rr := post("mismatch", "application/json", []byte(`{"name":"b"}`))
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should refuse a key in use", func(t *testing.T) {
+		calls.Store(0)
+		done := make(chan int)
+		go func() { done <- post("concurrent", "application/json", []byte(`{"wait":true}`)).Code }()
+		// the first request holds the key once it reached the handler
+		for deadline := time.Now().Add(5 * time.Second); calls.Load() == 0; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("the first request never reached the handler")
+			}
+		}
+
+		rr := post("concurrent", "application/json", []byte(`{"wait":true}`))
+		close(release)
+		checkResponseCode(t, http.StatusConflict, rr.Code)
+		checkResponseCode(t, http.StatusCreated, <-done)
+	})
+
+	t.Run("should release the key after a panic", func(t *testing.T) {
+		calls.Store(0)
+		for i := 0; i < 2; i++ {
+			rr := post("panic", "application/json", []byte(`{"panic":true}`))
+			checkResponseCode(t, http.StatusInternalServerError, rr.Code)
+		}
+		if calls.Load() != 2 {
+			t.Errorf("the retry after a panic ran %d times in all", calls.Load())
+		}
+	})
+
+	t.Run("should keep keys apart per tenant", func(t *testing.T) {
+		calls.Store(0)
+		for _, tenantID := range []int64{1, 2} {
+			req := httptest.NewRequest(http.MethodPost, "/v1/things", strings.NewReader(`{"name":"a"}`))
+			req.Header.Set(idempotencyKeyHeader, "tenants")
+			req.Header.Set("Content-Type", "application/json")
+			rr := executeRequest(req.WithContext(reqctx.WithTenant(req.Context(), tenantID)), mux)
+			checkResponseCode(t, http.StatusCreated, rr.Code)
+		}
+		if calls.Load() != 2 {
+			t.Errorf("the handler ran %d times for two tenants", calls.Load())
+		}
+	})
+
+	t.Run("should pass uploads through", func(t *testing.T) {
+		upload := bytes.Repeat([]byte("x"), 2<<20)
+		rr := post("upload", "multipart/form-data; boundary=x", upload)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+		if !strings.Contains(rr.Body.String(), strconv.Itoa(len(upload))) {
+			t.Errorf("the handler did not get the whole upload: %s", rr.Body)
+		}
+
+		large := append([]byte(`{"name":"`), bytes.Repeat([]byte("x"), 2<<20)...)
+		rr = post("large", "application/json", append(large, '"', '}'))
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Support staff reproduce what a user sees with an impersonation token: a
+// short-lived access token for the user that also carries the admin in the
+// RFC 8693 act claim. Requests made with it run as the user, but changes
+// are attributed to the admin, every request is recorded in the admin
+// actions and responses carry impersonatedByHeader so clients can show a
+// banner. The token cannot change the user's password or email, and stops
+// working as soon as the admin loses the admin role or is disabled.
+const (
+	impersonationClaim   = "act"
+	impersonatedByHeader = "X-Impersonated-By"
+)
+
+var (
+	errImpersonationDenied = errors.New("the impersonating admin can no longer impersonate")
+	errImpersonating       = newHTTPError(http.StatusForbidden, "not allowed while impersonating a user")
+)
+
+type ImpersonatePayload struct {
+	// Reason is recorded in the admin actions, such as a support ticket
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type ImpersonationResponse struct {
+	Token     string      `json:"token"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	User      *store.User `json:"user"`
+}
+
+// adminImpersonateUserHandler godoc
+//
+//	@Summary		Impersonate a user
+//	@Description	Issues an access token acting as the user for AUTH_IMPERSONATION_TTL, for support staff to debug what the user sees. Its requests are recorded in the admin actions and answer with the X-Impersonated-By header. It cannot change the password or email. Admins and moderators cannot be impersonated.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int					true	"User ID"
+//	@Param			payload	body		ImpersonatePayload	true	"Reason"
+//	@Success		201		{object}	ImpersonationResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"The user cannot sign in"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/impersonate [post]
+func (app *application) adminImpersonateUserHandler(r *http.Request, payload *ImpersonatePayload) (*ImpersonationResponse, error) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+	admin := getUserFromContext(r)
+
+	user, err := app.userService().Get(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role.Name == store.RoleAdmin || user.Role.Name == store.RoleModerator {
+		return nil, newHTTPError(http.StatusForbidden, "staff accounts cannot be impersonated")
+	}
+	if !user.CanSignIn() {
+		return nil, newHTTPError(http.StatusConflict, "the user cannot sign in")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(app.config.auth.impersonationTTL)
+	claims := app.config.auth.token.tokenClaims(user, now)
+	claims["exp"] = expiresAt.Unix()
+	claims[impersonationClaim] = map[string]any{"sub": admin.ID}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	app.logAdminAction(admin, "impersonate_user", "user", user.ID, payload.Reason)
+	app.logger.Infow("impersonation token issued", "admin_id", admin.ID, "user_id", user.ID, "expires_at", expiresAt)
+	return &ImpersonationResponse{Token: token, ExpiresAt: expiresAt.UTC().Truncate(time.Second), User: user}, nil
+}
+
+// tokenImpersonator returns the admin an impersonation token acts for, nil
+// for other tokens. The admin is loaded on every request so that taking
+// the role away ends their impersonations.
+func (app *application) tokenImpersonator(ctx context.Context, claims jwt.MapClaims) (*store.User, error) {
+	act, ok := claims[impersonationClaim]
+	if !ok {
+		return nil, nil
+	}
+	actor, _ := act.(map[string]any)
+	adminID, err := strconv.ParseInt(fmt.Sprintf("%.f", actor["sub"]), 10, 64)
+	if err != nil {
+		return nil, errImpersonationDenied
+	}
+
+	admin, err := app.userService().Get(ctx, adminID)
+	if err != nil || admin.Role.Name != store.RoleAdmin || !admin.CanSignIn() {
+		return nil, errImpersonationDenied
+	}
+	return admin, nil
+}
+
+// impersonate marks an impersonated request: changes are attributed to
+// admin, the response gets the banner header and the request is recorded.
+func (app *application) impersonate(w http.ResponseWriter, r *http.Request, admin, user *store.User) context.Context {
+	w.Header().Set(impersonatedByHeader, admin.Username)
+	app.logAdminAction(admin, "impersonated_request", "user", user.ID, r.Method+" "+r.URL.Path)
+	return reqctx.WithImpersonator(r.Context(), admin)
+}
+
+// denyImpersonation guards the routes an impersonation token must not use.
+func (app *application) denyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reqctx.Impersonator(r.Context()) != nil {
+			app.errorResponse(w, r, errImpersonating)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
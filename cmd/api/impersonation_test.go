@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestImpersonation(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{
+		auth: authConfig{
+			basic:            basicConfig{user: "svc", pass: "pw"},
+			token:            tokenConfig{secret: "test-secret", iss: "real-estate", exp: time.Hour},
+			impersonationTTL: time.Minute,
+		},
+	})
+	authenticator, err := newAuthenticator(app.config.auth.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.authenticator = authenticator
+	users := app.cacheStorage.Users.(*cache.MockUserStore)
+	users.On("Get", mock.Anything).Return(nil, nil)
+	users.On("Set", mock.Anything).Return(nil)
+	mux := app.mount()
+	ctx := context.Background()
+
+	newUser := func(name, role string) (*store.User, string) {
+		t.Helper()
+		u := &store.User{Username: name, Email: name + "@example.com", IsActive: true, Role: store.Role{Name: role}}
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+		token, err := app.generateToken(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u, token
+	}
+	admin, adminToken := newUser("root", store.RoleAdmin)
+	alice, _ := newUser("alice", store.RoleUser)
+	moderator, _ := newUser("mod", store.RoleModerator)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		return executeRequest(req, mux)
+	}
+	impersonate := func(userID int64) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/v1/admin/users/"+strconv.FormatInt(userID, 10)+"/impersonate", adminToken, `{"reason": "ticket 42"}`)
+	}
+
+	rr := impersonate(alice.ID)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var issued struct {
+		Data ImpersonationResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&issued); err != nil {
+		t.Fatal(err)
+	}
+	if issued.Data.User.ID != alice.ID || time.Until(issued.Data.ExpiresAt) > time.Minute {
+		t.Errorf("issued %+v", issued.Data)
+	}
+	token := issued.Data.Token
+
+	rr = do(http.MethodGet, "/v1/authentication/me", token, "")
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if got := rr.Header().Get(impersonatedByHeader); got != "root" {
+		t.Errorf("%s = %q", impersonatedByHeader, got)
+	}
+	if !strings.Contains(rr.Body.String(), `"username":"alice"`) {
+		t.Errorf("acting as %s", rr.Body)
+	}
+
+	checkResponseCode(t, http.StatusForbidden, do(http.MethodPut, "/v1/users/me/password", token, `{"old_password": "x", "new_password": "y"}`).Code)
+	checkResponseCode(t, http.StatusForbidden, do(http.MethodPost, "/v1/users/me/email", token, `{"email": "new@example.com"}`).Code)
+	checkResponseCode(t, http.StatusForbidden, impersonate(moderator.ID).Code)
+	checkResponseCode(t, http.StatusForbidden, impersonate(admin.ID).Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/authentication/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("svc", "pw")
+	var introspected TokenIntrospection
+	if err := json.NewDecoder(executeRequest(req, mux).Body).Decode(&introspected); err != nil {
+		t.Fatal(err)
+	}
+	if !introspected.Active || introspected.Actor == nil || introspected.Actor.Subject != strconv.FormatInt(admin.ID, 10) {
+		t.Errorf("introspected %+v", introspected)
+	}
+
+	// the token stops working once the admin is no longer one
+	roles, err := app.store.Roles.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range roles {
+		if role.Name == store.RoleUser {
+			if err := app.store.Users.UpdateRole(ctx, admin.ID, role.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	checkResponseCode(t, http.StatusUnauthorized, do(http.MethodGet, "/v1/authentication/me", token, "").Code)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/cmd/migrate/migrations"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+)
+
+// BuildManifest holds the SHA-256 of every template and migration embedded
+// in the binary, keyed by file name. Generate one with --write-manifest at
+// build time and check a deployed binary against it with --verify-manifest.
+type BuildManifest struct {
+	Templates  map[string]string `json:"templates"`
+	Migrations map[string]string `json:"migrations"`
+}
+
+// embeddedManifest is computed once at startup; an unreadable embedded file
+// panics.
+var embeddedManifest = func() BuildManifest {
+	manifest, err := newBuildManifest(mailer.FS, "templates", migrations.FS, ".")
+	if err != nil {
+		panic(fmt.Sprintf("embedded files: %v", err))
+	}
+	return manifest
+}()
+
+func newBuildManifest(templatesFS fs.FS, templatesDir string, migrationsFS fs.FS, migrationsDir string) (BuildManifest, error) {
+	templates, err := checksumFiles(templatesFS, templatesDir, "*.tmpl")
+	if err != nil {
+		return BuildManifest{}, err
+	}
+	migrations, err := checksumFiles(migrationsFS, migrationsDir, "*.sql")
+	if err != nil {
+		return BuildManifest{}, err
+	}
+	return BuildManifest{Templates: templates, Migrations: migrations}, nil
+}
+
+func checksumFiles(fsys fs.FS, dir, pattern string) (map[string]string, error) {
+	files, err := fs.Glob(fsys, dir+"/"+pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		sums[strings.TrimPrefix(file, dir+"/")] = hex.EncodeToString(sum[:])
+	}
+	return sums, nil
+}
+
+// digest combines the checksums of a group into one value for logs and
+// quick comparison.
+func digest(sums map[string]string) string {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s %s\n", sums[name], name)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Diff lists every file that is missing, unexpected or different in m
+// compared to want.
+func (m BuildManifest) Diff(want BuildManifest) []string {
+	var problems []string
+	problems = append(problems, diffChecksums("template", m.Templates, want.Templates)...)
+	problems = append(problems, diffChecksums("migration", m.Migrations, want.Migrations)...)
+	return problems
+}
+
+func diffChecksums(kind string, got, want map[string]string) []string {
+	var problems []string
+	for name, sum := range want {
+		switch gotSum, ok := got[name]; {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s %s: missing from build", kind, name))
+		case gotSum != sum:
+			problems = append(problems, fmt.Sprintf("%s %s: checksum %s, manifest has %s", kind, name, gotSum, sum))
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			problems = append(problems, fmt.Sprintf("%s %s: not in manifest", kind, name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// writeManifest writes the embedded manifest to path, or stdout for "-".
+func writeManifest(path string) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(embeddedManifest)
+}
+
+// runVerifyManifest compares the embedded files against the manifest at
+// path, prints every mismatch and returns the process exit code.
+func runVerifyManifest(path string, out io.Writer) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(out, "read manifest:", err)
+		return 1
+	}
+
+	var want BuildManifest
+	if err := json.Unmarshal(data, &want); err != nil {
+		fmt.Fprintln(out, "parse manifest:", err)
+		return 1
+	}
+
+	problems := embeddedManifest.Diff(want)
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(out, "FAIL: %d mismatches\n", len(problems))
+		return 1
+	}
+
+	fmt.Fprintf(out, "OK: %d templates, %d migrations match\n", len(want.Templates), len(want.Migrations))
+	return 0
+}
+
+type VersionResponse struct {
+	Version string `json:"version"`
+	Schema  struct {
+		Min string `json:"min"`
+		Max string `json:"max"`
+	} `json:"schema"`
+	Checksums struct {
+		Templates  string `json:"templates"`
+		Migrations string `json:"migrations"`
+	} `json:"checksums"`
+	Files BuildManifest `json:"files"`
+}
+
+// versionHandler godoc
+//
+//	@Summary		Build information
+//	@Description	Version, supported schema range and checksums of the embedded templates and migrations
+//	@Tags			ops
+//	@Produce		json
+//	@Success		200	{object}	VersionResponse
+//	@Router			/version [get]
+func (app *application) versionHandler(r *http.Request, _ *noBody) (VersionResponse, error) {
+	var resp VersionResponse
+	resp.Version = version
+	resp.Schema.Min = schemaVersionMin
+	resp.Schema.Max = schemaVersionMax
+	resp.Checksums.Templates = digest(embeddedManifest.Templates)
+	resp.Checksums.Migrations = digest(embeddedManifest.Migrations)
+	resp.Files = embeddedManifest
+	return resp, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBuildManifestDiff(t *testing.T) {
+	want := BuildManifest{
+		Templates:  map[string]string{"a.tmpl": "1", "b.tmpl": "2"},
+		Migrations: map[string]string{"000001_x.up.sql": "3"},
+	}
+	got := BuildManifest{
+		Templates:  map[string]string{"a.tmpl": "1", "c.tmpl": "4"},
+		Migrations: map[string]string{"000001_x.up.sql": "5"},
+	}
+
+	if problems := want.Diff(want); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+	if problems := got.Diff(want); len(problems) != 3 {
+		t.Errorf("expected 3 problems, got %v", problems)
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/version", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var body struct {
+		Data VersionResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data.Files.Migrations) == 0 || len(body.Data.Files.Templates) == 0 {
+		t.Errorf("expected embedded files, got %+v", body.Data.Files)
+	}
+	if body.Data.Checksums.Migrations != digest(embeddedManifest.Migrations) {
+		t.Errorf("unexpected migrations digest %q", body.Data.Checksums.Migrations)
+	}
+}
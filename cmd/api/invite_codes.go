@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// inviteCodeAlphabet leaves out 0, O, 1 and I so codes read out loud or
+// copied from paper survive.
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteCodeLength = 12
+
+var errInvalidInviteCode = newHTTPError(http.StatusBadRequest, "invalid or expired invite code")
+
+type CreateInviteCodePayload struct {
+	// Code picks the code, e.g. BETA2026; a random one is made when empty
+	Code string `json:"code,omitempty" validate:"omitempty,alphanum,min=6,max=32"`
+	// MaxUses defaults to 1
+	MaxUses   int        `json:"max_uses,omitempty" validate:"omitempty,min=1,max=100000"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type UserInviteCodes struct {
+	Codes []store.InviteCode `json:"codes"`
+	// Remaining is how many more codes the user can make
+	Remaining int `json:"remaining"`
+}
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// normalizeInviteCode accepts codes in any case and with the dashes or
+// spaces people add when passing them on.
+func normalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// reserveInviteCode takes a use of code while AUTH_INVITE_ONLY is on. It
+// returns nil without a code lookup otherwise, so settleInviteCode can be
+// called unconditionally.
+func (app *application) reserveInviteCode(ctx context.Context, code string) (*store.InviteCode, error) {
+	if !app.config.auth.invites.required {
+		return nil, nil
+	}
+	if code = normalizeInviteCode(code); code == "" {
+		return nil, newHTTPError(http.StatusBadRequest, "registration requires an invite code")
+	}
+
+	invite, err := app.store.InviteCodes.Reserve(ctx, code)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, errInvalidInviteCode
+	}
+	return invite, err
+}
+
+// settleInviteCode records that user registered with invite, or gives the
+// use back when user is nil because the registration failed.
+func (app *application) settleInviteCode(invite *store.InviteCode, user *store.User) {
+	if invite == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if user == nil {
+		if err := app.store.InviteCodes.Release(ctx, invite.ID); err != nil {
+			app.logger.Errorw("could not release invite code", "invite_code_id", invite.ID, "error", err)
+		}
+		return
+	}
+	if err := app.store.InviteCodes.Redeem(ctx, invite.ID, user.ID); err != nil {
+		app.logger.Errorw("could not record invite code use", "invite_code_id", invite.ID, "user_id", user.ID, "error", err)
+	}
+}
+
+// adminCreateInviteCodeHandler godoc
+//
+//	@Summary		Create an invite code
+//	@Description	Mints a code for invite-only registration, usable max_uses times until expires_at. A code that is taken answers 409.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateInviteCodePayload	true	"Invite code"
+//	@Success		201		{object}	store.InviteCode
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/invite-codes [post]
+func (app *application) adminCreateInviteCodeHandler(r *http.Request, payload *CreateInviteCodePayload) (*store.InviteCode, error) {
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		return nil, newHTTPError(http.StatusBadRequest, "expires_at must be in the future")
+	}
+
+	code := normalizeInviteCode(payload.Code)
+	if code == "" {
+		var err error
+		if code, err = generateInviteCode(); err != nil {
+			return nil, err
+		}
+	}
+
+	admin := getUserFromContext(r).ID
+	invite := &store.InviteCode{
+		Code:      code,
+		CreatedBy: &admin,
+		MaxUses:   max(payload.MaxUses, 1),
+		ExpiresAt: payload.ExpiresAt,
+	}
+	if err := app.store.InviteCodes.Create(r.Context(), invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// adminListInviteCodesHandler godoc
+//
+//	@Summary		List invite codes
+//	@Description	Codes made by admins and users, newest first, with how often each was used
+//	@Tags			admin
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.InviteCode
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/invite-codes [get]
+func (app *application) adminListInviteCodesHandler(r *http.Request, _ *noBody) (paged[store.InviteCode], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.InviteCode]{}, err
+	}
+
+	codes, err := app.store.InviteCodes.List(r.Context(), storeQuery(params))
+	return newPage(params, codes), err
+}
+
+// adminRevokeInviteCodeHandler godoc
+//
+//	@Summary		Revoke an invite code
+//	@Description	Expires the code now; registrations that used it are kept
+//	@Tags			admin
+//	@Produce		json
+//	@Param			code	path		string	true	"Invite code"
+//	@Success		200		{object}	store.InviteCode
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/invite-codes/{code} [delete]
+func (app *application) adminRevokeInviteCodeHandler(r *http.Request, _ *noBody) (*store.InviteCode, error) {
+	return app.store.InviteCodes.Revoke(r.Context(), normalizeInviteCode(chi.URLParam(r, "code")))
+}
+
+// createUserInviteCodeHandler godoc
+//
+//	@Summary		Create an invite for a friend
+//	@Description	Makes a single-use invite code valid for AUTH_USER_INVITE_TTL. Each user can make AUTH_USER_INVITES codes; more answer 409.
+//	@Tags			users
+//	@Produce		json
+//	@Success		201	{object}	store.InviteCode
+//	@Failure		409	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/invite-codes [post]
+func (app *application) createUserInviteCodeHandler(r *http.Request, _ *noBody) (*store.InviteCode, error) {
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(app.config.auth.invites.ttl)
+	invite := &store.InviteCode{Code: code, ExpiresAt: &expiresAt}
+
+	err = app.store.InviteCodes.CreateForUser(r.Context(), getUserFromContext(r).ID, invite, app.config.auth.invites.perUser)
+	if errors.Is(err, store.ErrInviteQuota) {
+		return nil, newHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// listUserInviteCodesHandler godoc
+//
+//	@Summary		List my invite codes
+//	@Description	The codes the current user made for friends and how many more they can make
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	UserInviteCodes
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/invite-codes [get]
+func (app *application) listUserInviteCodesHandler(r *http.Request, _ *noBody) (*UserInviteCodes, error) {
+	codes, err := app.store.InviteCodes.ListByCreator(r.Context(), getUserFromContext(r).ID)
+	if err != nil {
+		return nil, err
+	}
+	return &UserInviteCodes{
+		Codes:     codes,
+		Remaining: max(app.config.auth.invites.perUser-len(codes), 0),
+	}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	cfg := config{auth: authConfig{
+		requireActivation: true,
+		invites:           inviteCodeConfig{required: true, perUser: 1, ttl: time.Hour},
+	}, linkTokens: linkTokensConfig{activationTTL: time.Hour}}
+	app, _ := newMemoryTestApplication(t, cfg)
+	mux := app.mount()
+	ctx := context.Background()
+
+	attempts := 0
+	registerWith := func(address, code string) int {
+		attempts++
+		body := strings.Replace(registrationBody, "jo@example.com", address, 1)
+		body = strings.Replace(body, `"+77001112233"`, `"+7700111`+address[:4]+`"`, 1)
+		body = strings.Replace(body, "}", `,"invite_code":"`+code+`"}`, 1)
+		req := httptest.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body))
+		// stay under the registration rate limit
+		req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", attempts)
+		return executeRequest(req, mux).Code
+	}
+
+	checkResponseCode(t, http.StatusBadRequest, register(mux).Code)
+
+	invite := &store.InviteCode{Code: "BETA2026", MaxUses: 1}
+	if err := app.store.InviteCodes.Create(ctx, invite); err != nil {
+		t.Fatal(err)
+	}
+	checkResponseCode(t, http.StatusBadRequest, registerWith("1111@example.com", "NOPE2026"))
+	checkResponseCode(t, http.StatusCreated, registerWith("1111@example.com", "beta-2026"))
+	checkResponseCode(t, http.StatusBadRequest, registerWith("2222@example.com", "BETA2026"))
+
+	// a failed registration gives the use back
+	friends := &store.InviteCode{Code: "FRIENDS1", MaxUses: 1}
+	if err := app.store.InviteCodes.Create(ctx, friends); err != nil {
+		t.Fatal(err)
+	}
+	checkResponseCode(t, http.StatusBadRequest, registerWith("1111@example.com", "FRIENDS1"))
+	checkResponseCode(t, http.StatusCreated, registerWith("3333@example.com", "FRIENDS1"))
+
+	// users make a limited number of single-use codes
+	user, err := app.store.Users.GetByEmail(ctx, "3333@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := chi.NewRouter()
+	users.Post("/", handle(app, http.StatusCreated, app.createUserInviteCodeHandler))
+	create := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), user)), users).Code
+	}
+	checkResponseCode(t, http.StatusCreated, create())
+	checkResponseCode(t, http.StatusConflict, create())
+
+	codes, err := app.store.InviteCodes.ListByCreator(ctx, user.ID)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("codes %+v, %v", codes, err)
+	}
+	checkResponseCode(t, http.StatusCreated, registerWith("4444@example.com", codes[0].Code))
+}
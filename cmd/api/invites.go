@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -25,6 +26,8 @@ type InviteResponse struct {
 type ValidateInviteResponse struct {
 	CompanyType string `json:"company_type"`
 	Valid       bool   `json:"valid"`
+	// CompanyID is set for invites to join that company's team
+	CompanyID *int64 `json:"company_id,omitempty"`
 }
 
 // createInviteHandler godoc
@@ -102,8 +105,8 @@ func (app *application) getInviteHandler(w http.ResponseWriter, r *http.Request)
 
 	invite, err := app.store.Invites.GetByToken(r.Context(), token)
 	if err != nil {
-		switch err {
-		case store.ErrInviteNotFound:
+		switch {
+		case errors.Is(err, store.ErrInviteNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
@@ -124,6 +127,7 @@ func (app *application) getInviteHandler(w http.ResponseWriter, r *http.Request)
 	response := ValidateInviteResponse{
 		CompanyType: invite.CompanyType,
 		Valid:       true,
+		CompanyID:   invite.CompanyID,
 	}
 
 	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
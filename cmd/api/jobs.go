@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Background work that has to survive a restart goes through the job pool
+// of internal/jobs: the queue lives in Postgres and every instance with
+// JOBS_WORKERS claims from it. Admins inspect the queue, and retry jobs
+// that failed for good, under /admin/jobs.
+const (
+	jobModeration = "moderation"
+	jobPrune      = "jobs.prune"
+)
+
+var jobStatuses = []string{jobs.StatusQueued, jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusFailed}
+
+type jobsConfig struct {
+	// workers is how many jobs an instance runs at once; with 0 it only
+	// enqueues
+	workers int
+	poll    time.Duration
+	// lease is how long a job may run before another instance takes it
+	// over
+	lease time.Duration
+	// retention is how long finished jobs are kept, pruned on
+	// pruneSchedule
+	retention     time.Duration
+	pruneSchedule string
+}
+
+func (c jobsConfig) validate() error {
+	switch {
+	case c.workers < 0:
+		return fmt.Errorf("JOBS_WORKERS must not be negative, got %d", c.workers)
+	case c.poll <= 0:
+		return fmt.Errorf("JOBS_POLL_INTERVAL must be positive, got %s", c.poll)
+	case c.lease < time.Minute:
+		return fmt.Errorf("JOBS_LEASE must be at least a minute, got %s", c.lease)
+	case c.retention <= 0:
+		return fmt.Errorf("JOBS_RETENTION must be positive, got %s", c.retention)
+	}
+	if _, err := jobs.ParseCron(c.pruneSchedule); err != nil {
+		return fmt.Errorf("JOBS_PRUNE_SCHEDULE: %w", err)
+	}
+	return nil
+}
+
+// newJobPool returns the pool with every kind of job registered; start it
+// with Start.
+func (app *application) newJobPool(cfg jobsConfig) (*jobs.Pool, error) {
+	pool := jobs.New(app.store.Jobs, jobs.Config{Workers: cfg.workers, Poll: cfg.poll, Lease: cfg.lease})
+	pool.OnError = func(err error) {
+		app.logger.Warnw("background job", "error", err)
+	}
+
+	pool.Register(jobModeration, jobs.Kind{Handler: app.moderationJob})
+	pool.Register(jobPrune, jobs.Kind{MaxAttempts: 1, Handler: func(ctx context.Context, _ jobs.Job) error {
+		pruned, err := app.store.Jobs.Prune(ctx, time.Now().Add(-cfg.retention))
+		if err == nil && pruned > 0 {
+			app.logger.Infow("pruned finished jobs", "count", pruned)
+		}
+		return err
+	}})
+	if err := pool.Schedule(cfg.pruneSchedule, jobPrune); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+func jobParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, newHTTPError(http.StatusBadRequest, "invalid job id")
+	}
+	return id, nil
+}
+
+// adminListJobsHandler godoc
+//
+//	@Summary		Lists background jobs
+//	@Description	Returns the jobs of the queue newest first, with their attempts and the error of the latest failed one. Finished jobs are kept for JOBS_RETENTION.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			status	query		string	false	"queued, running, succeeded or failed"
+//	@Param			kind	query		string	false	"Kind, such as moderation"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		jobs.Job
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/jobs [get]
+func (app *application) adminListJobsHandler(r *http.Request, _ *noBody) (paged[jobs.Job], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[jobs.Job]{}, err
+	}
+	filter := store.JobFilter{PaginatedQuery: storeQuery(params), Status: r.URL.Query().Get("status"), Kind: r.URL.Query().Get("kind")}
+	if filter.Status != "" && !slices.Contains(jobStatuses, filter.Status) {
+		return paged[jobs.Job]{}, newHTTPError(http.StatusBadRequest, "status must be one of queued, running, succeeded and failed")
+	}
+
+	list, err := app.store.Jobs.List(r.Context(), filter)
+	return newPage(params, list), err
+}
+
+// adminGetJobHandler godoc
+//
+//	@Summary		Get a background job
+//	@Description	Returns the job with its payload, attempts and the error of the latest failed attempt
+//	@Tags			admin
+//	@Produce		json
+//	@Param			jobID	path		int	true	"Job ID"
+//	@Success		200		{object}	jobs.Job
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/jobs/{jobID} [get]
+func (app *application) adminGetJobHandler(r *http.Request, _ *noBody) (*jobs.Job, error) {
+	id, err := jobParam(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.store.Jobs.GetByID(r.Context(), id)
+}
+
+// adminRetryJobHandler godoc
+//
+//	@Summary		Retry a failed background job
+//	@Description	Queues a job that failed for good again with a fresh set of attempts, for after the cause of the failures was fixed
+//	@Tags			admin
+//	@Produce		json
+//	@Param			jobID	path		int	true	"Job ID"
+//	@Success		200		{object}	jobs.Job
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"The job has not failed"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/jobs/{jobID}/retry [post]
+func (app *application) adminRetryJobHandler(r *http.Request, _ *noBody) (*jobs.Job, error) {
+	id, err := jobParam(r)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := app.store.Jobs.Retry(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	app.logAdminAction(getUserFromContext(r), "retry_job", "job", id, job.Kind)
+	return job, nil
+}
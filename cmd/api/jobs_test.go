@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAdminJobs(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+	admin := &store.User{ID: 1, Role: store.Role{Name: store.RoleAdmin}}
+
+	// a payload that does not decode fails without retries
+	job, err := app.jobs.Enqueue(ctx, jobModeration, "not a moderation run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if got, _ := app.store.Jobs.GetByID(ctx, job.ID); got.Status == jobs.StatusFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the job did not fail")
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/admin/jobs", handle(app, http.StatusOK, app.adminListJobsHandler))
+	mux.Get("/v1/admin/jobs/{jobID}", handle(app, http.StatusOK, app.adminGetJobHandler))
+	mux.Post("/v1/admin/jobs/{jobID}/retry", handle(app, http.StatusOK, app.adminRetryJobHandler))
+	do := func(method, path string) (int, []jobs.Job) {
+		t.Helper()
+		req, _ := http.NewRequest(method, path, nil)
+		rr := executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), mux)
+		var list struct{ Data []jobs.Job }
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		return rr.Code, list.Data
+	}
+	path := "/v1/admin/jobs/" + strconv.FormatInt(job.ID, 10)
+
+	code, failed := do(http.MethodGet, "/v1/admin/jobs?status=failed")
+	checkResponseCode(t, http.StatusOK, code)
+	if len(failed) != 1 || failed[0].ID != job.ID || failed[0].Attempts != 1 || failed[0].LastError == "" {
+		t.Errorf("failed jobs %+v", failed)
+	}
+	if code, _ := do(http.MethodGet, "/v1/admin/jobs?status=stuck"); code != http.StatusBadRequest {
+		t.Errorf("an unknown status answered %d", code)
+	}
+	if code, list := do(http.MethodGet, "/v1/admin/jobs?kind=other"); code != http.StatusOK || len(list) != 0 {
+		t.Errorf("jobs of another kind: %d %+v", code, list)
+	}
+	if code, _ := do(http.MethodGet, path); code != http.StatusOK {
+		t.Errorf("getting the job answered %d", code)
+	}
+
+	if code, _ := do(http.MethodPost, path+"/retry"); code != http.StatusOK {
+		t.Errorf("retrying the failed job answered %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/v1/admin/jobs/999/retry"); code != http.StatusNotFound {
+		t.Errorf("retrying a missing job answered %d", code)
+	}
+
+	queued, err := app.jobs.EnqueueAt(ctx, jobPrune, nil, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := do(http.MethodPost, "/v1/admin/jobs/"+strconv.FormatInt(queued.ID, 10)+"/retry"); code != http.StatusConflict {
+		t.Errorf("retrying a queued job answered %d", code)
+	}
+}
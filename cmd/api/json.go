@@ -1,21 +1,42 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
 	"regexp"
-	"unicode"
+	"strings"
 
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/auth"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/country"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/email"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
 	"github.com/go-playground/validator/v10"
 )
 
 var Validate *validator.Validate
 
+// passwordPolicy backs the "password" validation tag. main replaces the
+// default with the configured policy before serving requests.
+var passwordPolicy = auth.DefaultPasswordPolicy()
+
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
 	_ = Validate.RegisterValidation("email_regex", validateEmailRegex)
+	_ = Validate.RegisterValidation("country", validateCountry)
+	_ = Validate.RegisterValidation("username", validateUsername)
 	_ = Validate.RegisterValidation("name", validateName)
 	_ = Validate.RegisterValidation("password", validatePassword)
+	_ = Validate.RegisterValidation("limit", validateLimit)
+
+	if err := registerTranslations(Validate); err != nil {
+		panic(err)
+	}
 }
 
 var emailRegex = regexp.MustCompile(`^[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
@@ -27,9 +48,36 @@ func validateEmailRegex(fl validator.FieldLevel) bool {
 		return false
 	}
 
+	// internationalized domains are checked in their ASCII form
+	if normalized, err := email.Normalize(value); err == nil {
+		value = normalized
+	}
 	return emailRegex.MatchString(value)
 }
 
+// validateCountry accepts an ISO 3166-1 alpha-2 code or country name in any
+// case; handlers store it as the code from country.Normalize.
+func validateCountry(fl validator.FieldLevel) bool {
+	value, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+
+	_, ok = country.Normalize(value)
+	return ok
+}
+
+// validateUsername applies the username policy, reserved names included,
+// to a username normalized with service.NormalizeUsername.
+func validateUsername(fl validator.FieldLevel) bool {
+	value, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+
+	return service.CheckUsername(value) == nil
+}
+
 func validateName(fl validator.FieldLevel) bool {
 	value, ok := fl.Field().Interface().(string)
 	if !ok {
@@ -45,21 +93,7 @@ func validatePassword(fl validator.FieldLevel) bool {
 		return false
 	}
 
-	var hasLower, hasUpper, hasDigit, hasSpecial bool
-	for _, r := range value {
-		switch {
-		case unicode.IsLower(r):
-			hasLower = true
-		case unicode.IsUpper(r):
-			hasUpper = true
-		case unicode.IsDigit(r):
-			hasDigit = true
-		case unicode.IsPunct(r) || unicode.IsSymbol(r):
-			hasSpecial = true
-		}
-	}
-
-	return len(value) >= 8 && hasLower && hasUpper && hasDigit && hasSpecial
+	return passwordPolicy.Check(value) == ""
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -68,14 +102,124 @@ func writeJSON(w http.ResponseWriter, status int, data any) error {
 	return json.NewEncoder(w).Encode(data)
 }
 
+// defaultMaxBodyBytes applies to routes without a body_limit middleware.
+const defaultMaxBodyBytes = 1 << 20
+
+// maxJSONDepth bounds how deeply objects and arrays may nest in a request
+// body; no payload the API accepts comes close.
+const maxJSONDepth = 32
+
+var errJSONTooDeep = errors.New("body must not nest objects and arrays more than 32 levels deep")
+
+// readJSON decodes the request body into data. Decoder errors are replaced by
+// messages fit for clients, see decodeError. Bodies over the route's limit
+// fail with *http.MaxBytesError, which badRequestResponse answers with 413.
 func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
-	maxBytes := 1_048_578 // 1mb
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	maxBytes, ok := reqctx.BodyLimit(r.Context())
+	if !ok {
+		maxBytes = defaultMaxBodyBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if jsonDepth(body) > maxJSONDepth {
+		return errJSONTooDeep
+	}
 
-	decoder := json.NewDecoder(r.Body)
+	decoder := json.NewDecoder(bytes.NewReader(body))
 	decoder.DisallowUnknownFields()
 
-	return decoder.Decode(data)
+	if err := decoder.Decode(data); err != nil {
+		return decodeError(err)
+	}
+	if decoder.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// decodeError names the field, byte offset or expected type behind a
+// json.Decoder error instead of passing the decoder's wording to clients.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("body contains badly-formed JSON (at byte %d)", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("body contains badly-formed JSON")
+	case errors.Is(err, io.EOF):
+		return errors.New("body must not be empty")
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return fmt.Errorf("body field %q must be %s, not %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+		}
+		return fmt.Errorf("body must be %s, not %s (at byte %d)", jsonTypeName(typeErr.Type), typeErr.Value, typeErr.Offset)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// the decoder has no error type for unknown fields
+		return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+
+	return err
+}
+
+// jsonTypeName describes the JSON value a Go type decodes from.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+
+	return t.String()
+}
+
+// jsonDepth returns how deeply objects and arrays nest in data, without
+// decoding it. Brackets inside strings are skipped.
+func jsonDepth(data []byte) int {
+	depth, deepest := 0, 0
+	inString, escaped := false, false
+
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			deepest = max(deepest, depth)
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+
+	return deepest
 }
 
 func writeJSONError(w http.ResponseWriter, status int, message string) error {
@@ -86,7 +230,36 @@ func writeJSONError(w http.ResponseWriter, status int, message string) error {
 	return writeJSON(w, status, &envelope{Error: message})
 }
 
+// writeJSONErrorCode adds a machine-readable code for errors clients are
+// expected to handle specifically.
+func writeJSONErrorCode(w http.ResponseWriter, status int, code, message string) error {
+	type envelope struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+
+	return writeJSON(w, status, &envelope{Error: message, Code: code})
+}
+
+func writeJSONValidationError(w http.ResponseWriter, status int, message string, fields map[string]string) error {
+	type envelope struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+
+	return writeJSON(w, status, &envelope{Error: message, Fields: fields})
+}
+
 func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
+	if hasMetaEnvelope(w) {
+		type envelope struct {
+			Data any         `json:"data"`
+			Meta versionMeta `json:"meta"`
+		}
+
+		return writeJSON(w, status, &envelope{Data: data, Meta: versionMeta{APIVersion: w.Header().Get(apiVersionHeader)}})
+	}
+
 	type envelope struct {
 		Data any `json:"data"`
 	}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxLinkPreviews is how many links of a description get a preview
+	maxLinkPreviews        = 3
+	maxLinkPreviewURL      = 2048
+	linkPreviewBatchSize   = 10
+	linkPreviewLease       = 2 * time.Minute
+	linkPreviewMaxAttempts = 3
+	linkPreviewMaxRedirect = 3
+	// linkPreviewRefresh is how old a preview gets before saving a listing
+	// that links there fetches it again
+	linkPreviewRefresh = 7 * 24 * time.Hour
+	// linkPreviewMaxBody caps how much of a page is read looking for metadata
+	linkPreviewMaxBody     = 512 << 10
+	linkPreviewTitleLength = 200
+	linkPreviewTextLength  = 500
+	linkPreviewUserAgent   = "ValarMorghulisBot/1.0 (+link preview)"
+	linkPreviewAccept      = "text/html,application/xhtml+xml"
+)
+
+// errNoLinkPreview marks pages that will not give a preview on retry: they
+// are not HTML, answer 4xx or carry no title.
+var errNoLinkPreview = errors.New("no link preview")
+
+type linkPreviewConfig struct {
+	// interval is how often queued links are fetched, 0 stops it
+	interval time.Duration
+	// timeout bounds fetching one page, redirects included
+	timeout time.Duration
+	// allowPrivate lets previews reach loopback and private networks, for
+	// development only
+	allowPrivate bool
+}
+
+// linkPattern finds the http(s) URLs in a description; trailing punctuation
+// is trimmed by extractLinks.
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// extractLinks returns the distinct links in text that can be previewed, in
+// the order they first appear and at most maxLinkPreviews of them.
+func extractLinks(text string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, match := range linkPattern.FindAllString(text, -1) {
+		match = strings.TrimRight(match, ".,;:!?)]}'")
+		u, err := previewableURL(match)
+		if err != nil || seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		links = append(links, u.String())
+		if len(links) == maxLinkPreviews {
+			break
+		}
+	}
+	return links
+}
+
+// previewableURL parses raw and checks it is a link the fetcher may follow:
+// http or https, with a host and no credentials. Addresses and ports are
+// checked when connecting, see newLinkPreviewClient.
+func previewableURL(raw string) (*url.URL, error) {
+	if len(raw) > maxLinkPreviewURL {
+		return nil, fmt.Errorf("%w: url too long", errNoLinkPreview)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return nil, fmt.Errorf("%w: unsupported url", errNoLinkPreview)
+	}
+	u.Fragment = ""
+	return u, nil
+}
+
+// newLinkPreviewClient returns the client pages are fetched with. Unless
+// allowPrivate is set it only connects to ports 80 and 443 of public
+// addresses, see refusePrivateAddress, and every redirect is checked again.
+func newLinkPreviewClient(cfg linkPreviewConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.timeout}
+	if !cfg.allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			if _, port, err := net.SplitHostPort(address); err == nil && port != "80" && port != "443" {
+				return fmt.Errorf("%w: port %s", errPrivateAddress, port)
+			}
+			return refusePrivateAddress(network, address, c)
+		}
+	}
+
+	return &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, Proxy: nil},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > linkPreviewMaxRedirect {
+				return fmt.Errorf("%w: too many redirects", errNoLinkPreview)
+			}
+			_, err := previewableURL(req.URL.String())
+			return err
+		},
+	}
+}
+
+// queueLinkPreviews queues the links in the listing's description for the
+// fetcher. Failures are logged; the listing shows no previews until a later
+// save queues them.
+func (app *application) queueLinkPreviews(ctx context.Context, listing *store.Listing) {
+	if err := app.store.LinkPreviews.Queue(ctx, extractLinks(listing.Description), linkPreviewRefresh); err != nil {
+		app.logger.Warnw("could not queue link previews", "listing_id", listing.ID, "error", err)
+	}
+}
+
+// setLinkPreviews fills in the fetched previews of the links in each
+// listing's description. Previews are decoration, so a failure is logged
+// and the listings are returned without them.
+func (app *application) setLinkPreviews(r *http.Request, listings []store.Listing) {
+	links := make([][]string, len(listings))
+	var all []string
+	for i, l := range listings {
+		links[i] = extractLinks(l.Description)
+		all = append(all, links[i]...)
+	}
+	if len(all) == 0 {
+		return
+	}
+
+	previews, err := app.store.LinkPreviews.Get(r.Context(), all)
+	if err != nil {
+		app.logger.Warnw("could not load link previews", "error", err)
+		return
+	}
+	for i := range listings {
+		for _, link := range links[i] {
+			if p, ok := previews[link]; ok {
+				listings[i].LinkPreviews = append(listings[i].LinkPreviews, p)
+			}
+		}
+	}
+}
+
+// runLinkPreviewFetcher fetches queued link previews until ctx is cancelled.
+func (app *application) runLinkPreviewFetcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.fetchLinkPreviews(ctx)
+		}
+	}
+}
+
+func (app *application) fetchLinkPreviews(ctx context.Context) {
+	pending, err := app.store.LinkPreviews.ClaimPending(ctx, linkPreviewBatchSize, linkPreviewLease)
+	if err != nil {
+		app.logger.Errorw("could not claim link previews", "error", err)
+		return
+	}
+
+	for _, link := range pending {
+		app.fetchLinkPreview(ctx, link)
+	}
+}
+
+// fetchLinkPreview fetches one claimed link and records the preview, or the
+// failure with a retry like the webhook relay. Pages that cannot give a
+// preview are not retried.
+func (app *application) fetchLinkPreview(ctx context.Context, link store.PendingLinkPreview) {
+	ctx, span := tracing.Start(ctx, "link_preview.fetch", tracing.KindClient,
+		tracing.String("link_preview.url", link.URL),
+	)
+	defer span.End()
+
+	preview, err := app.getLinkPreview(ctx, link.URL)
+	span.RecordError(err)
+
+	if err == nil {
+		if err := app.store.LinkPreviews.Save(ctx, preview); err != nil {
+			app.logger.Errorw("could not save link preview", "url", link.URL, "error", err)
+		}
+		return
+	}
+
+	attempts := link.Attempts + 1
+	var retryAt *time.Time
+	if attempts < linkPreviewMaxAttempts && !errors.Is(err, errNoLinkPreview) && !errors.Is(err, errPrivateAddress) {
+		next := time.Now().Add(outboxBackoff(attempts))
+		retryAt = &next
+	}
+	app.logger.Infow("link preview failed", "url", link.URL, "attempts", attempts, "retry", retryAt != nil, "error", err)
+
+	if err := app.store.LinkPreviews.MarkFailed(ctx, link.URL, err.Error(), retryAt); err != nil {
+		app.logger.Errorw("could not mark link preview failed", "url", link.URL, "error", err)
+	}
+}
+
+// getLinkPreview GETs the page and reads its Open Graph metadata.
+func (app *application) getLinkPreview(ctx context.Context, link string) (*store.LinkPreview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", linkPreviewUserAgent)
+	req.Header.Set("Accept", linkPreviewAccept)
+
+	resp, err := app.linkPreviewClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return nil, fmt.Errorf("%w: status %d", errNoLinkPreview, resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%w: content type %q", errNoLinkPreview, mediaType)
+	}
+
+	preview := parseLinkPreview(io.LimitReader(resp.Body, linkPreviewMaxBody), resp.Request.URL)
+	if preview.Title == "" {
+		return nil, fmt.Errorf("%w: page has no title", errNoLinkPreview)
+	}
+	preview.URL = link
+	return preview, nil
+}
+
+// parseLinkPreview reads the og: meta tags of the page at base, falling back
+// to <title> and the description meta tag. Only the head is read.
+func parseLinkPreview(body io.Reader, base *url.URL) *store.LinkPreview {
+	var og, fallback store.LinkPreview
+	var image string
+
+	z := html.NewTokenizer(body)
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return finishLinkPreview(og, fallback, image, base)
+		case html.TextToken:
+			if inTitle {
+				fallback.Title += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return finishLinkPreview(og, fallback, image, base)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = fallback.Title == ""
+			case "body":
+				return finishLinkPreview(og, fallback, image, base)
+			case "meta":
+				var property, content string
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					switch string(key) {
+					case "property", "name":
+						property = strings.ToLower(string(val))
+					case "content":
+						content = string(val)
+					}
+				}
+				switch property {
+				case "og:title":
+					og.Title = content
+				case "og:description":
+					og.Description = content
+				case "og:site_name":
+					og.SiteName = content
+				case "og:image", "og:image:url":
+					if image == "" {
+						image = content
+					}
+				case "description":
+					fallback.Description = content
+				}
+			}
+		}
+	}
+}
+
+func finishLinkPreview(og, fallback store.LinkPreview, image string, base *url.URL) *store.LinkPreview {
+	preview := &store.LinkPreview{
+		Title:       cleanPreviewText(og.Title, linkPreviewTitleLength),
+		Description: cleanPreviewText(og.Description, linkPreviewTextLength),
+		SiteName:    cleanPreviewText(og.SiteName, linkPreviewTitleLength),
+	}
+	if preview.Title == "" {
+		preview.Title = cleanPreviewText(fallback.Title, linkPreviewTitleLength)
+	}
+	if preview.Description == "" {
+		preview.Description = cleanPreviewText(fallback.Description, linkPreviewTextLength)
+	}
+	// the image is loaded by the browser, so only absolute http(s) links
+	// are kept
+	if ref, err := url.Parse(strings.TrimSpace(image)); err == nil && image != "" {
+		if u := base.ResolveReference(ref); (u.Scheme == "http" || u.Scheme == "https") && len(u.String()) <= maxLinkPreviewURL {
+			preview.ImageURL = u.String()
+		}
+	}
+	return preview
+}
+
+// cleanPreviewText collapses whitespace and cuts s to max runes.
+func cleanPreviewText(s string, max int) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) > max {
+		s = strings.TrimSpace(string([]rune(s)[:max])) + "…"
+	}
+	return s
+}
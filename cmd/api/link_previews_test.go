@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestExtractLinks(t *testing.T) {
+	got := extractLinks(`See https://example.com/tour. Or (http://example.org/a?b=1#top), ` +
+		`https://example.com/tour again, ftp://example.net, https://user:pw@example.com/ and https://four.example/ https://five.example/`)
+	want := []string{"https://example.com/tour", "http://example.org/a?b=1", "https://four.example/"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestLinkPreviews(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tour":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<html><head><title>Fallback</title>
+				<meta property="og:title" content="Virtual  tour &amp; floor plan">
+				<meta name="description" content="Three rooms">
+				<meta property="og:image" content="/cover.jpg">
+				</head><body><meta property="og:title" content="ignored"></body></html>`)
+		case "/file":
+			w.Header().Set("Content-Type", "application/pdf")
+		}
+	}))
+	defer page.Close()
+
+	app, _ := newMemoryTestApplication(t, config{})
+	app.linkPreviewClient = newLinkPreviewClient(linkPreviewConfig{timeout: 5 * time.Second, allowPrivate: true})
+	ctx := context.Background()
+
+	listing := &store.Listing{CompanyID: 1, Title: "Flat", DealType: "sale", Status: store.ListingStatusActive,
+		Description: "Tour: " + page.URL + "/tour, brochure: " + page.URL + "/file"}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	app.queueLinkPreviews(ctx, listing)
+	app.fetchLinkPreviews(ctx)
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings/{listingID}", app.getListingHandler)
+	req, _ := http.NewRequest(http.MethodGet, "/v1/listings/1", nil)
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var body struct {
+		Data store.Listing `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	got := body.Data
+	want := store.LinkPreview{URL: page.URL + "/tour", Title: "Virtual tour & floor plan", Description: "Three rooms", ImageURL: page.URL + "/cover.jpg"}
+	if len(got.LinkPreviews) != 1 || got.LinkPreviews[0] != want {
+		t.Fatalf("previews %+v", got.LinkPreviews)
+	}
+
+	// the PDF is not retried
+	if pending, _ := app.store.LinkPreviews.ClaimPending(ctx, 10, time.Minute); len(pending) != 0 {
+		t.Fatalf("pending %+v", pending)
+	}
+
+	// by default previews cannot reach the local network
+	strict := newLinkPreviewClient(linkPreviewConfig{timeout: time.Second})
+	if _, err := strict.Get(page.URL + "/tour"); err == nil {
+		t.Fatal("loopback page was reached")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+)
+
+// Emailed links carry tokens from internal/tokens: account activation,
+// sign-in links and email change confirmations. Each purpose has its own
+// lifetime and format, TOKEN_<PURPOSE>_TTL and TOKEN_<PURPOSE>_FORMAT.
+type linkTokensConfig struct {
+	activationTTL     time.Duration
+	activationFormat  string
+	magicLinkTTL      time.Duration
+	magicLinkFormat   string
+	emailChangeTTL    time.Duration
+	emailChangeFormat string
+}
+
+// policies returns the configured tokens.Policies; unset fields keep the
+// tokens.DefaultPolicies.
+func (c linkTokensConfig) policies() tokens.Policies {
+	policies := tokens.Policies{}
+	for purpose, configured := range map[tokens.Purpose]tokens.Policy{
+		tokens.Activation:  {TTL: c.activationTTL, Format: c.activationFormat},
+		tokens.MagicLink:   {TTL: c.magicLinkTTL, Format: c.magicLinkFormat},
+		tokens.EmailChange: {TTL: c.emailChangeTTL, Format: c.emailChangeFormat},
+	} {
+		policy := tokens.DefaultPolicies[purpose]
+		if configured.TTL != 0 {
+			policy.TTL = configured.TTL
+		}
+		if configured.Format != "" {
+			policy.Format = configured.Format
+		}
+		policies[purpose] = policy
+	}
+	return policies
+}
+
+// issuer returns the tokens.Issuer for the configured policies.
+func (c linkTokensConfig) issuer() (*tokens.Issuer, error) {
+	return tokens.New(c.policies())
+}
+
+func (c linkTokensConfig) validate() error {
+	_, err := c.issuer()
+	return err
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxListingEventLength keeps events to what a viewing or open house takes,
+// so a typo in the end date does not fill a subscriber's calendar.
+const maxListingEventLength = 7 * 24 * time.Hour
+
+// ListingEventPayload is an event at a listing. Times are RFC 3339;
+// location defaults to the listing's address.
+type ListingEventPayload struct {
+	Title       string `json:"title" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=2000"`
+	Location    string `json:"location" validate:"max=500"`
+	StartsAt    string `json:"starts_at" validate:"required"`
+	EndsAt      string `json:"ends_at" validate:"required"`
+}
+
+// event checks the payload and returns it as an event at listing, with
+// times in UTC.
+func (p *ListingEventPayload) event(listing *store.Listing) (*store.ListingEvent, error) {
+	starts, err := time.Parse(time.RFC3339, p.StartsAt)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "starts_at must be an RFC 3339 time")
+	}
+	ends, err := time.Parse(time.RFC3339, p.EndsAt)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "ends_at must be an RFC 3339 time")
+	}
+	if !ends.After(starts) {
+		return nil, newHTTPError(http.StatusBadRequest, "ends_at must be after starts_at")
+	}
+	if ends.Sub(starts) > maxListingEventLength {
+		return nil, newHTTPError(http.StatusBadRequest, "events cannot last longer than 7 days")
+	}
+
+	location := strings.TrimSpace(p.Location)
+	if location == "" {
+		location = strings.Trim(listing.Address+", "+listing.City, ", ")
+	}
+	return &store.ListingEvent{
+		ListingID:    listing.ID,
+		CompanyID:    listing.CompanyID,
+		ListingTitle: listing.Title,
+		Title:        strings.TrimSpace(p.Title),
+		Description:  p.Description,
+		Location:     location,
+		StartsAt:     starts.UTC().Format(time.RFC3339),
+		EndsAt:       ends.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// ownListingEvent loads the event in the URL for staff of the company
+// whose listing it is at.
+func (app *application) ownListingEvent(r *http.Request) (*store.Listing, *store.ListingEvent, error) {
+	listing, err := app.ownListing(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	eventID, err := strconv.ParseInt(chi.URLParam(r, "eventID"), 10, 64)
+	if err != nil {
+		return nil, nil, newHTTPError(http.StatusBadRequest, "invalid event id")
+	}
+	event, err := app.store.ListingEvents.GetByID(r.Context(), eventID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if event.ListingID != listing.ID {
+		return nil, nil, store.ErrNotFound
+	}
+	return listing, event, nil
+}
+
+// listListingEventsHandler godoc
+//
+//	@Summary		Events at a listing
+//	@Description	Upcoming and ongoing events at the listing, such as open house viewings, soonest first, to whoever can see the listing
+//	@Tags			listings
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{array}		store.ListingEvent
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/listings/{listingID}/events [get]
+func (app *application) listListingEventsHandler(r *http.Request, _ *noBody) ([]store.ListingEvent, error) {
+	listing, err := app.listingFromURL(r)
+	if err != nil {
+		return nil, err
+	}
+	if !canViewListing(getUserFromContext(r), listing) {
+		return nil, store.ErrNotFound
+	}
+	return app.store.ListingEvents.List(r.Context(), store.ListingEventFilter{
+		ListingID: listing.ID,
+		EndsAfter: time.Now(),
+	})
+}
+
+// createListingEventHandler godoc
+//
+//	@Summary		Add an event to a listing
+//	@Description	Schedules an event such as an open house at one of the company's listings. It appears in the company's calendar feed and in those of users who favorited the listing while the listing is active.
+//	@Tags			listings
+//	@Accept			json
+//	@Produce		json
+//	@Param			listingID	path		int					true	"Listing ID"
+//	@Param			payload		body		ListingEventPayload	true	"Event"
+//	@Success		201			{object}	store.ListingEvent
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/events [post]
+func (app *application) createListingEventHandler(r *http.Request, payload *ListingEventPayload) (*store.ListingEvent, error) {
+	listing, err := app.ownListing(r)
+	if err != nil {
+		return nil, err
+	}
+	event, err := payload.event(listing)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.ListingEvents.Create(r.Context(), event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// updateListingEventHandler godoc
+//
+//	@Summary		Change a listing event
+//	@Description	Replaces the event's details and times. Its sequence grows, so subscribed calendars update the event rather than add another.
+//	@Tags			listings
+//	@Accept			json
+//	@Produce		json
+//	@Param			listingID	path		int					true	"Listing ID"
+//	@Param			eventID		path		int					true	"Event ID"
+//	@Param			payload		body		ListingEventPayload	true	"Event"
+//	@Success		200			{object}	store.ListingEvent
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/events/{eventID} [put]
+func (app *application) updateListingEventHandler(r *http.Request, payload *ListingEventPayload) (*store.ListingEvent, error) {
+	listing, existing, err := app.ownListingEvent(r)
+	if err != nil {
+		return nil, err
+	}
+	event, err := payload.event(listing)
+	if err != nil {
+		return nil, err
+	}
+	event.ID, event.CreatedAt = existing.ID, existing.CreatedAt
+	if err := app.store.ListingEvents.Update(r.Context(), event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// deleteListingEventHandler godoc
+//
+//	@Summary		Cancel a listing event
+//	@Description	Deletes the event; subscribed calendars drop it on their next refresh
+//	@Tags			listings
+//	@Param			listingID	path	int	true	"Listing ID"
+//	@Param			eventID		path	int	true	"Event ID"
+//	@Success		204
+//	@Failure		403	{object}	error
+//	@Failure		404	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/events/{eventID} [delete]
+func (app *application) deleteListingEventHandler(w http.ResponseWriter, r *http.Request) {
+	_, event, err := app.ownListingEvent(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if err := app.store.ListingEvents.Delete(r.Context(), event.ID); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestListingEventCalendars(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{frontendURL: "https://homes.example.com"})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Realty", RegistrationNumber: "1", Email: "realty@example.com", Type: store.RoleAgency}
+	other := &store.Company{Name: "Other", RegistrationNumber: "2", Email: "other@example.com", Type: store.RoleAgency}
+	for _, c := range []*store.Company{company, other} {
+		if err := app.store.Companies.Create(ctx, nil, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	agent := &store.User{ID: 10, Role: store.Role{Name: store.RoleAgency}, CompanyID: &company.ID}
+	rival := &store.User{ID: 11, Role: store.Role{Name: store.RoleAgency}, CompanyID: &other.ID}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Flat", Address: "Abay 1", City: "Almaty", DealType: "sale", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	buyer := &store.User{Username: "buyer", Email: "buyer@example.com", IsActive: true}
+	if err := app.store.Users.Create(ctx, nil, buyer); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Favorites.Add(ctx, buyer.ID, listing.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/listings/{listingID}/events", handle(app, http.StatusCreated, app.createListingEventHandler))
+	mux.Put("/v1/listings/{listingID}/events/{eventID}", handle(app, http.StatusOK, app.updateListingEventHandler))
+	mux.Delete("/v1/listings/{listingID}/events/{eventID}", app.deleteListingEventHandler)
+	send := func(method, path string, user *store.User, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), user)), mux)
+	}
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	payload := map[string]string{
+		"title":     "Open house",
+		"starts_at": start.Format(time.RFC3339),
+		"ends_at":   start.Add(2 * time.Hour).Format(time.RFC3339),
+	}
+	rr := send(http.MethodPost, "/v1/listings/1/events", agent, payload)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var created struct {
+		Data store.ListingEvent `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Data.Location != "Abay 1, Almaty" || created.Data.Sequence != 0 {
+		t.Errorf("got %+v", created.Data)
+	}
+
+	checkResponseCode(t, http.StatusForbidden, send(http.MethodPost, "/v1/listings/1/events", rival, payload).Code)
+	backwards := map[string]string{"title": "x", "starts_at": payload["ends_at"], "ends_at": payload["starts_at"]}
+	checkResponseCode(t, http.StatusBadRequest, send(http.MethodPost, "/v1/listings/1/events", agent, backwards).Code)
+
+	payload["title"] = "Open house, moved"
+	checkResponseCode(t, http.StatusOK, send(http.MethodPut, "/v1/listings/1/events/1", agent, payload).Code)
+	checkResponseCode(t, http.StatusNotFound, send(http.MethodPut, "/v1/listings/1/events/9", agent, payload).Code)
+
+	api := app.mount()
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, "/v1/companies/1/events.ics", nil), api)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	feed := rr.Body.String()
+	if rr.Header().Get("Content-Type") != "text/calendar; charset=utf-8" ||
+		!strings.Contains(feed, "SUMMARY:Open house\\, moved\r\n") ||
+		!strings.Contains(feed, "UID:listing-event-1@homes.example.com\r\n") ||
+		!strings.Contains(feed, "SEQUENCE:1\r\n") {
+		t.Errorf("got %s", feed)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/me/calendar", nil)
+	link, err := app.calendarLinkHandler(req.WithContext(reqctx.WithUser(req.Context(), buyer)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link.WebcalURL, "webcal://example.com/v1/downloads/calendars/") || time.Until(link.ExpiresAt) < 300*24*time.Hour {
+		t.Errorf("got %+v", link)
+	}
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, link.URL, nil), api)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if !strings.Contains(rr.Body.String(), "LOCATION:Abay 1\\, Almaty\r\n") {
+		t.Errorf("got %s", rr.Body.String())
+	}
+	checkResponseCode(t, http.StatusNotFound, executeRequest(httptest.NewRequest(http.MethodGet, "/v1/downloads/calendars/2.ics", nil), api).Code)
+
+	checkResponseCode(t, http.StatusNoContent, send(http.MethodDelete, "/v1/listings/1/events/1", agent, nil).Code)
+	rr = executeRequest(httptest.NewRequest(http.MethodGet, link.URL, nil), api)
+	if strings.Contains(rr.Body.String(), "BEGIN:VEVENT") {
+		t.Errorf("deleted event still listed: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// canViewListing reports whether user, nil when anonymous, may see listing.
+// Active listings are public. Drafts are the company's own until submitted;
+// admins see the rest.
+func canViewListing(user *store.User, listing *store.Listing) bool {
+	if listing.Status == store.ListingStatusActive {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	if user.CompanyID != nil && *user.CompanyID == listing.CompanyID {
+		return true
+	}
+	return user.Role.Name == store.RoleAdmin && listing.Status != store.ListingStatusDraft
+}
+
+// getListingHistoryHandler godoc
+//
+//	@Summary		Listing edit history
+//	@Description	Earlier versions of a listing, newest first, to whoever can see the listing. The listing itself carries the current version, edited and edited_at.
+//	@Tags			listings
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{array}		store.ListingVersion
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/listings/{listingID}/history [get]
+func (app *application) getListingHistoryHandler(r *http.Request, _ *noBody) ([]store.ListingVersion, error) {
+	listing, err := app.listingFromURL(r)
+	if err != nil {
+		return nil, err
+	}
+	if !canViewListing(getUserFromContext(r), listing) {
+		return nil, store.ErrNotFound
+	}
+	return app.store.Listings.Versions(r.Context(), listing.ID)
+}
+
+// moderationListingHistoryHandler godoc
+//
+//	@Summary		Listing edit history for moderators
+//	@Description	Earlier versions of a listing in any status, so moderators can see what reported content said before it was edited or removed
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{array}		store.ListingVersion
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/listings/{listingID}/history [get]
+func (app *application) moderationListingHistoryHandler(r *http.Request, _ *noBody) ([]store.ListingVersion, error) {
+	listing, err := app.listingFromURL(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.store.Listings.Versions(r.Context(), listing.ID)
+}
+
+func (app *application) listingFromURL(r *http.Request) (*store.Listing, error) {
+	listingID, err := strconv.ParseInt(chi.URLParam(r, "listingID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return app.store.Listings.GetByID(r.Context(), listingID)
+}
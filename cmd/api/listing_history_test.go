@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestListingEditHistory(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	companyID := int64(1)
+	agent := &store.User{ID: 10, Role: store.Role{Name: store.RoleAgency}, CompanyID: &companyID}
+	listing := &store.Listing{CompanyID: companyID, Title: "Flat", DealType: "sale", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Patch("/v1/listings/{listingID}", app.updateListingHandler)
+	mux.Get("/v1/listings/{listingID}/history", handle(app, http.StatusOK, app.getListingHistoryHandler))
+
+	req, _ := http.NewRequest(http.MethodPatch, "/v1/listings/1", strings.NewReader(`{"title":"Bright flat"}`))
+	req = req.WithContext(reqctx.WithUser(req.Context(), agent))
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var updated struct {
+		Data store.Listing `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Data.Version != 2 || !updated.Data.Edited || updated.Data.EditedAt == nil {
+		t.Errorf("expected version 2 marked edited, got version %d, edited %v", updated.Data.Version, updated.Data.Edited)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/listings/1/history", nil)
+	rr = executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var history struct {
+		Data []store.ListingVersion `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Data) != 1 || history.Data[0].Version != 1 || history.Data[0].Title != "Flat" {
+		t.Fatalf("expected version 1 titled Flat, got %+v", history.Data)
+	}
+
+	// An edit based on a version that is no longer current conflicts.
+	listing.Title = "Stale"
+	if err := app.store.Listings.Update(ctx, listing); err != store.ErrConflict {
+		t.Errorf("expected ErrConflict for a stale version, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -40,6 +41,7 @@ var listingMediaExtensions = map[string]string{
 //	@Failure		401			{object}	error
 //	@Failure		403			{object}	error
 //	@Failure		404			{object}	error
+//	@Failure		413			{object}	error	"Media quota exceeded"
 //	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/listings/{listingID}/media [post]
@@ -58,7 +60,7 @@ func (app *application) uploadListingMediaHandler(w http.ResponseWriter, r *http
 
 	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -104,6 +106,18 @@ func (app *application) uploadListingMediaHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	if quota := app.config.storage.mediaQuotaBytes; quota > 0 {
+		used, err := app.store.Usage.MediaBytes(r.Context(), user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if used+int64(len(blob)) > quota {
+			app.mediaQuotaExceededResponse(w, r, used, quota)
+			return
+		}
+	}
+
 	key := fmt.Sprintf("listings/%d/%s%s", listingID, uuid.New().String(), ext)
 	uploadedURL, err := app.uploader.Upload(r.Context(), key, bytes.NewReader(blob), contentType)
 	if err != nil {
@@ -111,12 +125,13 @@ func (app *application) uploadListingMediaHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	media := &store.ListingMedia{ListingID: listingID, URL: uploadedURL}
+	media := &store.ListingMedia{ListingID: listingID, URL: uploadedURL, SizeBytes: int64(len(blob)), UploadedBy: user.ID}
 	if err := app.store.Listings.CreateMedia(r.Context(), media); err != nil {
 		_ = app.uploader.Delete(r.Context(), key)
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.forgetListings(listingID)
 
 	if err := app.jsonResponse(w, http.StatusCreated, media); err != nil {
 		app.internalServerError(w, r, err)
@@ -160,7 +175,7 @@ func (app *application) deleteListingMediaHandler(w http.ResponseWriter, r *http
 
 	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -174,7 +189,7 @@ func (app *application) deleteListingMediaHandler(w http.ResponseWriter, r *http
 
 	media, err := app.store.Listings.GetMediaByID(r.Context(), listingID, mediaID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -194,13 +209,14 @@ func (app *application) deleteListingMediaHandler(w http.ResponseWriter, r *http
 	}
 
 	if err := app.store.Listings.DeleteMedia(r.Context(), listingID, mediaID); err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.forgetListings(listingID)
 
 	if err := app.jsonResponse(w, http.StatusNoContent, ""); err != nil {
 		app.internalServerError(w, r, err)
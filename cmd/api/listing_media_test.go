@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	filestorage "github.com/Lelouchlamperougexd/Valar_Morghulis/internal/storage"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestUploadListingMediaQuota(t *testing.T) {
+	app := newTestApplication(t, config{storage: storageConfig{mediaQuotaBytes: 100}})
+	app.store = store.NewMemoryStorage()
+	uploader, err := filestorage.NewLocalUploader(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.uploader = uploader
+	ctx := context.Background()
+
+	companyID := int64(1)
+	user := &store.User{Username: "agent", Email: "agent@example.com", IsActive: true, CompanyID: &companyID, Role: store.Role{Name: store.RoleAgency}}
+	if err := app.store.Users.Create(ctx, nil, user); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: companyID, Title: "Flat", DealType: "sale", Status: "draft"}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/listings/{listingID}/media", app.uploadListingMediaHandler)
+
+	upload := func() *http.Response {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile(listingMediaFieldName, "photo.png")
+		part.Write(append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 52)...))
+		form.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, "/v1/listings/1/media", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		return executeRequest(req, mux).Result()
+	}
+
+	checkResponseCode(t, http.StatusCreated, upload().StatusCode)
+
+	resp := upload()
+	checkResponseCode(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	var quotaErr struct {
+		Code       string `json:"code"`
+		UsedBytes  int64  `json:"used_bytes"`
+		LimitBytes int64  `json:"limit_bytes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&quotaErr); err != nil {
+		t.Fatal(err)
+	}
+	if quotaErr.Code != "media_quota_exceeded" || quotaErr.UsedBytes != 60 || quotaErr.LimitBytes != 100 {
+		t.Errorf("unexpected quota error %+v", quotaErr)
+	}
+
+	used, err := app.store.Usage.MediaBytes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 60 {
+		t.Errorf("expected 60 bytes used, got %d", used)
+	}
+}
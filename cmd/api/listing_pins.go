@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// pinListingHandler godoc
+//
+//	@Summary		Pin a listing to the company profile (agency/developer)
+//	@Description	Pinned listings come first in GET /companies/{companyID}/listings, the latest pin on top. A company pins at most 3 active listings; a listing that stops being active loses its pin.
+//	@Tags			listings
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{object}	store.Listing
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/pin [put]
+func (app *application) pinListingHandler(r *http.Request, _ *noBody) (*store.Listing, error) {
+	listing, err := app.ownListing(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch err := app.store.Listings.Pin(r.Context(), listing.ID); {
+	case errors.Is(err, store.ErrPinLimit):
+		return nil, newHTTPError(http.StatusConflict, fmt.Sprintf("a company can pin at most %d listings, unpin one first", store.MaxPinnedListings))
+	case errors.Is(err, store.ErrNotActive):
+		return nil, newHTTPError(http.StatusConflict, "only active listings can be pinned")
+	case err != nil:
+		return nil, err
+	}
+	app.forgetListings(listing.ID)
+	return app.store.Listings.GetByID(r.Context(), listing.ID)
+}
+
+// unpinListingHandler godoc
+//
+//	@Summary		Unpin a listing (agency/developer)
+//	@Tags			listings
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{object}	store.Listing
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/pin [delete]
+func (app *application) unpinListingHandler(r *http.Request, _ *noBody) (*store.Listing, error) {
+	listing, err := app.ownListing(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.Listings.Unpin(r.Context(), listing.ID); err != nil {
+		return nil, err
+	}
+	app.forgetListings(listing.ID)
+	return app.store.Listings.GetByID(r.Context(), listing.ID)
+}
+
+// listCompanyListingsHandler godoc
+//
+//	@Summary		A company's listings
+//	@Description	The company's active listings for its profile: pinned ones first, the latest pin on top, then newest first. With a token, each listing also has favorited_by_me.
+//	@Tags			listings
+//	@Produce		json
+//	@Param			companyID	path		int	true	"Company ID"
+//	@Param			limit		query		int	false	"Limit"
+//	@Param			offset		query		int	false	"Offset"
+//	@Success		200			{array}		store.Listing
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/companies/{companyID}/listings [get]
+func (app *application) listCompanyListingsHandler(r *http.Request, _ *noBody) (paged[store.Listing], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.Listing]{}, err
+	}
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		return paged[store.Listing]{}, newHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if _, err := app.store.Companies.GetByID(r.Context(), companyID); err != nil {
+		return paged[store.Listing]{}, err
+	}
+
+	listings, err := app.store.Listings.List(r.Context(), store.ListingFilter{
+		Limit:       params.Limit,
+		Offset:      params.Offset,
+		Status:      store.ListingStatusActive,
+		CompanyID:   &companyID,
+		PinnedFirst: true,
+	})
+	if err != nil {
+		return paged[store.Listing]{}, err
+	}
+	if err := app.setFavoriteStats(r, listings); err != nil {
+		return paged[store.Listing]{}, err
+	}
+	app.setLinkPreviews(r, listings)
+	return newPage(params, listings), nil
+}
+
+// ownListing loads the listing in the URL for staff of the company that
+// owns it, like updateListingHandler.
+func (app *application) ownListing(r *http.Request) (*store.Listing, error) {
+	user := getUserFromContext(r)
+	if user.CompanyID == nil || (user.Role.Name != store.RoleAgency && user.Role.Name != store.RoleDeveloper) {
+		return nil, newHTTPError(http.StatusForbidden, "only agencies and developers manage listings")
+	}
+	listing, err := app.listingFromURL(r)
+	if err != nil {
+		return nil, err
+	}
+	if listing.CompanyID != *user.CompanyID {
+		return nil, newHTTPError(http.StatusForbidden, "the listing belongs to another company")
+	}
+	return listing, nil
+}
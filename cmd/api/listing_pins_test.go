@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPinnedListings(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Realty", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	agent := &store.User{ID: 10, Role: store.Role{Name: store.RoleAgency}, CompanyID: &company.ID}
+	for i := 0; i < store.MaxPinnedListings+2; i++ {
+		l := &store.Listing{CompanyID: company.ID, Title: "Flat", DealType: "sale", Status: store.ListingStatusActive}
+		if err := app.store.Listings.Create(ctx, l, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Put("/v1/listings/{listingID}/pin", handle(app, http.StatusOK, app.pinListingHandler))
+	mux.Get("/v1/companies/{companyID}/listings", handle(app, http.StatusOK, app.listCompanyListingsHandler))
+
+	pin := func(path string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, path, nil)
+		req = req.WithContext(reqctx.WithUser(req.Context(), agent))
+		return executeRequest(req, mux).Code
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		checkResponseCode(t, http.StatusOK, pin("/v1/listings/"+id+"/pin"))
+	}
+	checkResponseCode(t, http.StatusOK, pin("/v1/listings/1/pin"))
+	checkResponseCode(t, http.StatusConflict, pin("/v1/listings/4/pin"))
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/companies/1/listings", nil)
+	rr := executeRequest(req, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var body struct {
+		Data []store.Listing `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	// Later pins come first; pins made within a second tie and fall back
+	// to newest first, which here is the same order.
+	var got []int64
+	for _, l := range body.Data {
+		got = append(got, l.ID)
+	}
+	want := []int64{3, 2, 1, 5, 4}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
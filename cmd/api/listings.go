@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/contentfilter"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/pagination"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 )
 
@@ -37,8 +42,8 @@ type RentConstraintsPayload struct {
 
 type CreateListingPayload struct {
 	ProjectID    *int64                  `json:"project_id" validate:"omitempty,gt=0"`
-	Title        string                  `json:"title" validate:"required,max=255"`
-	Description  string                  `json:"description" validate:"required"`
+	Title        string                  `json:"title" validate:"required,limit=listing_title"`
+	Description  string                  `json:"description" validate:"required,limit=listing_description"`
 	PropertyType string                  `json:"property_type" validate:"required,max=50"`
 	DealType     string                  `json:"deal_type" validate:"required,oneof=rent sale"`
 	Price        int64                   `json:"price" validate:"required,gt=0"`
@@ -52,12 +57,16 @@ type CreateListingPayload struct {
 	Rent         *RentConstraintsPayload `json:"rent_constraints"`
 	Latitude     *float64                `json:"latitude" validate:"omitempty,min=-90,max=90"`
 	Longitude    *float64                `json:"longitude" validate:"omitempty,min=-180,max=180"`
+	// Draft keeps the listing out of moderation until it is submitted.
+	Draft bool `json:"draft"`
+	// PublishAt schedules the listing to go live once approved, RFC 3339.
+	PublishAt *string `json:"publish_at"`
 }
 
 type UpdateListingPayload struct {
 	ProjectID    *int64   `json:"project_id" validate:"omitempty,gt=0"`
-	Title        *string  `json:"title" validate:"omitempty,max=255"`
-	Description  *string  `json:"description" validate:"omitempty"`
+	Title        *string  `json:"title" validate:"omitempty,limit=listing_title"`
+	Description  *string  `json:"description" validate:"omitempty,limit=listing_description"`
 	PropertyType *string  `json:"property_type" validate:"omitempty,max=50"`
 	Price        *int64   `json:"price" validate:"omitempty,gt=0"`
 	City         *string  `json:"city" validate:"omitempty,max=100"`
@@ -68,6 +77,8 @@ type UpdateListingPayload struct {
 	TotalFloors  *int     `json:"total_floors" validate:"omitempty,min=0,max=200"`
 	Latitude     *float64 `json:"latitude" validate:"omitempty,min=-90,max=90"`
 	Longitude    *float64 `json:"longitude" validate:"omitempty,min=-180,max=180"`
+	// PublishAt reschedules a listing that is not live yet; "" clears it.
+	PublishAt *string `json:"publish_at"`
 }
 
 type ListListingsQuery struct {
@@ -88,7 +99,7 @@ type CreateApplicationPayload struct {
 	FullName       string  `json:"full_name" validate:"required,max=255"`
 	Phone          string  `json:"phone" validate:"required,max=50"`
 	Email          string  `json:"email" validate:"required,max=255,email_regex"`
-	Comment        *string `json:"comment" validate:"omitempty,max=2000"`
+	Comment        *string `json:"comment" validate:"omitempty,limit=application_comment"`
 	OccupantCount  *int    `json:"occupant_count" validate:"omitempty,min=1,max=20"`
 	HasChildren    *bool   `json:"has_children"`
 	HasPets        *bool   `json:"has_pets"`
@@ -113,7 +124,7 @@ type ListApplicationsQuery struct {
 }
 
 type ApplicationMessagePayload struct {
-	Body string `json:"body" validate:"required,max=5000"`
+	Body string `json:"body" validate:"required,limit=message"`
 }
 
 // createProjectHandler godoc
@@ -239,7 +250,7 @@ func (app *application) getProjectHandler(w http.ResponseWriter, r *http.Request
 
 	project, err := app.store.Projects.GetByID(r.Context(), projectID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -289,7 +300,7 @@ func (app *application) updateProjectHandler(w http.ResponseWriter, r *http.Requ
 
 	project, err := app.store.Projects.GetByID(r.Context(), projectID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -327,7 +338,7 @@ func (app *application) updateProjectHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := app.store.Projects.Update(r.Context(), project); err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -370,7 +381,7 @@ func (app *application) deleteProjectHandler(w http.ResponseWriter, r *http.Requ
 
 	project, err := app.store.Projects.GetByID(r.Context(), projectID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -383,7 +394,7 @@ func (app *application) deleteProjectHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := app.store.Projects.Delete(r.Context(), projectID); err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -399,7 +410,7 @@ func (app *application) deleteProjectHandler(w http.ResponseWriter, r *http.Requ
 // createListingHandler godoc
 //
 //	@Summary		Create listing (agency/developer)
-//	@Description	Create listing; defaults to status=moderation
+//	@Description	Create listing; defaults to status=moderation, or draft with "draft": true. With publish_at, an approved listing stays scheduled until then.
 //	@Tags			listings
 //	@Accept			json
 //	@Produce		json
@@ -414,24 +425,6 @@ func (app *application) deleteProjectHandler(w http.ResponseWriter, r *http.Requ
 //	@Router			/listings [post]
 func (app *application) createListingHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
-	if user.Role.Name != store.RoleAgency && user.Role.Name != store.RoleDeveloper {
-		app.forbiddenResponse(w, r)
-		return
-	}
-	if user.CompanyID == nil {
-		app.forbiddenResponse(w, r)
-		return
-	}
-
-	company, err := app.store.Companies.GetByID(r.Context(), *user.CompanyID)
-	if err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
-	if company.VerificationStatus != store.VerificationVerified {
-		app.forbiddenResponse(w, r)
-		return
-	}
 
 	var payload CreateListingPayload
 	if err := readJSON(w, r, &payload); err != nil {
@@ -442,21 +435,10 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 		app.badRequestResponse(w, r, err)
 		return
 	}
-
-	if payload.ProjectID != nil {
-		project, err := app.store.Projects.GetByID(r.Context(), *payload.ProjectID)
-		if err != nil {
-			if err == store.ErrNotFound {
-				app.notFoundResponse(w, r, err)
-				return
-			}
-			app.internalServerError(w, r, err)
-			return
-		}
-		if project.CompanyID != *user.CompanyID {
-			app.forbiddenResponse(w, r)
-			return
-		}
+	publishAt, err := parsePublishAt(payload.PublishAt)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
 	media := make([]store.ListingMedia, 0, len(payload.Media))
@@ -465,7 +447,7 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	var rent *store.RentConstraints
-	if payload.DealType == "rent" && payload.Rent != nil {
+	if payload.Rent != nil {
 		rent = &store.RentConstraints{
 			AllowChildren: payload.Rent.AllowChildren,
 			AllowPets:     payload.Rent.AllowPets,
@@ -476,13 +458,11 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	listing := &store.Listing{
-		CompanyID:    *user.CompanyID,
 		ProjectID:    payload.ProjectID,
 		Title:        payload.Title,
 		Description:  payload.Description,
 		PropertyType: payload.PropertyType,
 		DealType:     payload.DealType,
-		Status:       store.ListingStatusModeration,
 		Price:        payload.Price,
 		City:         payload.City,
 		Address:      payload.Address,
@@ -492,12 +472,21 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 		TotalFloors:  payload.TotalFloors,
 		Latitude:     payload.Latitude,
 		Longitude:    payload.Longitude,
+		PublishAt:    publishAt,
+	}
+	if payload.Draft {
+		listing.Status = store.ListingStatusDraft
+	}
+	if err := app.filterWords(&listing.Title, &listing.Description); err != nil {
+		app.errorResponse(w, r, err)
+		return
 	}
 
-	if err := app.store.Listings.Create(r.Context(), listing, media, rent); err != nil {
-		app.internalServerError(w, r, err)
+	if err := app.listingService().Create(r.Context(), user, listing, media, rent); err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
+	app.screenListing(r.Context(), user, listing)
 
 	if err := app.jsonResponse(w, http.StatusCreated, listing); err != nil {
 		app.internalServerError(w, r, err)
@@ -507,9 +496,10 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 // listListingsHandler godoc
 //
 //	@Summary		Public catalog listings
-//	@Description	Returns active listings with filters
+//	@Description	Returns active listings with filters and favorite counts. With a token, each listing also has favorited_by_me. Listings from the caller's region (profile region, registration country or GeoIP) come first. sort=ranked orders the rest by a score of recency, favorites and applications and, with a token, the caller's own favorites and applications with the same company; the default is newest first. /tags/{tag}/listings returns the listings whose title or description has #tag.
 //	@Tags			listings
 //	@Produce		json
+//	@Param			tag				path		string	false	"Hashtag, without #"
 //	@Param			deal_type		query		string	false	"rent|sale"
 //	@Param			city			query		string	false	"City"
 //	@Param			property_type	query		string	false	"Property type"
@@ -519,12 +509,16 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 //	@Param			rooms_max		query		int		false	"Max rooms"
 //	@Param			area_min		query		number	false	"Min area"
 //	@Param			area_max		query		number	false	"Max area"
+//	@Param			region			query		string	false	"Country code to rank first, or all"
+//	@Param			sort			query		string	false	"newest|ranked"
 //	@Param			limit			query		int		false	"Limit"
-//	@Param			offset			query		int		false	"Offset"
+//	@Param			cursor			query		string	false	"next_cursor of the previous page"
+//	@Param			offset			query		int		false	"Offset, deprecated in favor of cursor"
 //	@Success		200				{array}		store.Listing
 //	@Failure		400				{object}	error
 //	@Failure		500				{object}	error
 //	@Router			/listings [get]
+//	@Router			/tags/{tag}/listings [get]
 func (app *application) listListingsHandler(w http.ResponseWriter, r *http.Request) {
 	qs := r.URL.Query()
 	filter := store.ListingFilter{}
@@ -534,6 +528,25 @@ func (app *application) listListingsHandler(w http.ResponseWriter, r *http.Reque
 	filter.PropertyType = qs.Get("property_type")
 	filter.Status = store.ListingStatusActive
 
+	if tag := chi.URLParam(r, "tag"); tag != "" {
+		if filter.Tag = service.NormalizeTag(tag); filter.Tag == "" {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid tag"))
+			return
+		}
+	}
+
+	region, err := rankingRegion(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	filter.Region = region
+
+	filter.Sort = qs.Get("sort")
+	if user := getUserFromContext(r); user != nil {
+		filter.ViewerID = user.ID
+	}
+
 	if v := qs.Get("price_min"); v != "" {
 		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
 			filter.PriceMin = parsed
@@ -570,14 +583,35 @@ func (app *application) listListingsHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 	if v := qs.Get("offset"); v != "" {
+		if !app.config.pagination.legacyParams {
+			app.badRequestResponse(w, r, fmt.Errorf("offset is no longer supported, pass meta.next_cursor as cursor"))
+			return
+		}
+		legacyPageParams.Add(1)
 		if parsed, err := strconv.Atoi(v); err == nil {
 			filter.Offset = parsed
 		}
 	}
+	// The ranked order has no stable sort key, so feed cursors carry the
+	// offset of the next page, bound to the sort it was made for.
+	scope := "listings:" + filter.Sort
+	if cursor := qs.Get("cursor"); cursor != "" {
+		keys, err := app.cursorKeys(scope, cursor)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		offset, err := strconv.Atoi(keys[0])
+		if err != nil || offset < 0 || len(keys) != 1 {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid cursor"))
+			return
+		}
+		filter.Offset = offset
+	}
 
-	listings, err := app.store.Listings.List(r.Context(), filter)
+	listings, err := app.listFeed(r.Context(), filter)
 	if err != nil {
-		if err == store.ErrInvalidFilter {
+		if errors.Is(err, store.ErrInvalidFilter) {
 			app.badRequestResponse(w, r, err)
 			return
 		}
@@ -585,7 +619,19 @@ func (app *application) listListingsHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, listings); err != nil {
+	if err := app.setFavoriteStats(r, listings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.setLinkPreviews(r, listings)
+
+	limit := feedPageLimit(filter.Limit)
+	page := pagination.Page{Params: pagination.CursorParams(limit, qs.Get("cursor")), Count: len(listings), Total: -1}
+	if len(listings) == limit {
+		page.NextCursor = app.signCursor(scope, strconv.Itoa(max(filter.Offset, 0)+limit))
+	}
+
+	if err := app.jsonPageResponse(w, r, http.StatusOK, listings, page); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -607,9 +653,9 @@ func (app *application) getListingHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
+	listing, err := app.cachedListing(r.Context(), listingID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -617,14 +663,26 @@ func (app *application) getListingHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	user := getUserFromContext(r)
-	if listing.Status != store.ListingStatusActive {
-		if user == nil || (user.Role.Name != store.RoleAdmin && (user.CompanyID == nil || *user.CompanyID != listing.CompanyID)) {
-			app.notFoundResponse(w, r, store.ErrNotFound)
-			return
-		}
+	viewer := getUserFromContext(r)
+	if !canViewListing(viewer, listing) {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
 	}
 
+	// the company's own staff do not count as views
+	if listing.Status == store.ListingStatusActive && (viewer == nil || viewer.CompanyID == nil || *viewer.CompanyID != listing.CompanyID) {
+		app.recordView(r, store.ViewListing, listing.ID)
+	}
+
+	listings := []store.Listing{*listing}
+	if err := app.setFavoriteStats(r, listings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.setLinkPreviews(r, listings)
+	listing = &listings[0]
+
+	app.setCacheHeaders(w, r, listingKey(listing.ID), companyKey(listing.CompanyID))
 	if err := app.jsonResponse(w, http.StatusOK, listing); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -633,7 +691,7 @@ func (app *application) getListingHandler(w http.ResponseWriter, r *http.Request
 // updateListingHandler godoc
 //
 //	@Summary		Update listing (agency/developer)
-//	@Description	Partially updates listing fields for current company owner
+//	@Description	Partially updates listing fields for current company owner. Each edit saves the previous content, see /listings/{listingID}/history, and returns 409 if someone else edited the listing meanwhile.
 //	@Tags			listings
 //	@Accept			json
 //	@Produce		json
@@ -644,6 +702,7 @@ func (app *application) getListingHandler(w http.ResponseWriter, r *http.Request
 //	@Failure		401			{object}	error
 //	@Failure		403			{object}	error
 //	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
 //	@Failure		500			{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/listings/{listingID} [patch]
@@ -662,7 +721,7 @@ func (app *application) updateListingHandler(w http.ResponseWriter, r *http.Requ
 
 	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -684,7 +743,7 @@ func (app *application) updateListingHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if payload.ProjectID == nil && payload.Title == nil && payload.Description == nil && payload.PropertyType == nil && payload.Price == nil && payload.City == nil && payload.Address == nil && payload.Rooms == nil && payload.Area == nil && payload.Floor == nil && payload.TotalFloors == nil && payload.Latitude == nil && payload.Longitude == nil {
+	if payload.ProjectID == nil && payload.Title == nil && payload.Description == nil && payload.PropertyType == nil && payload.Price == nil && payload.City == nil && payload.Address == nil && payload.Rooms == nil && payload.Area == nil && payload.Floor == nil && payload.TotalFloors == nil && payload.Latitude == nil && payload.Longitude == nil && payload.PublishAt == nil {
 		app.badRequestResponse(w, r, fmt.Errorf("at least one field must be provided"))
 		return
 	}
@@ -692,7 +751,7 @@ func (app *application) updateListingHandler(w http.ResponseWriter, r *http.Requ
 	if payload.ProjectID != nil {
 		project, err := app.store.Projects.GetByID(r.Context(), *payload.ProjectID)
 		if err != nil {
-			if err == store.ErrNotFound {
+			if errors.Is(err, store.ErrNotFound) {
 				app.notFoundResponse(w, r, err)
 				return
 			}
@@ -712,6 +771,12 @@ func (app *application) updateListingHandler(w http.ResponseWriter, r *http.Requ
 	if payload.Description != nil {
 		listing.Description = *payload.Description
 	}
+	if payload.Title != nil || payload.Description != nil {
+		if err := app.filterWords(&listing.Title, &listing.Description); err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
 	if payload.PropertyType != nil {
 		listing.PropertyType = *payload.PropertyType
 	}
@@ -742,25 +807,50 @@ func (app *application) updateListingHandler(w http.ResponseWriter, r *http.Requ
 	if payload.Longitude != nil {
 		listing.Longitude = payload.Longitude
 	}
+	if payload.PublishAt != nil {
+		switch listing.Status {
+		case store.ListingStatusDraft, store.ListingStatusModeration, store.ListingStatusScheduled:
+		default:
+			app.conflictResponse(w, r, fmt.Errorf("publish_at can only change before the listing is published"))
+			return
+		}
+		if *payload.PublishAt == "" {
+			listing.PublishAt = nil
+		} else if listing.PublishAt, err = parsePublishAt(payload.PublishAt); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
 
 	if err := app.store.Listings.Update(r.Context(), listing); err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
-		if err == store.ErrInvalidDealType || err == store.ErrInvalidStatus {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflictResponse(w, r, fmt.Errorf("the listing was edited by someone else, reload it and try again"))
+			return
+		}
+		if errors.Is(err, store.ErrInvalidDealType) || errors.Is(err, store.ErrInvalidStatus) || errors.Is(err, store.ErrCheckViolation) {
 			app.badRequestResponse(w, r, err)
 			return
 		}
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.forgetListings(listing.ID)
+	app.invalidateFeed(r.Context())
 
 	updated, err := app.store.Listings.GetByID(r.Context(), listing.ID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.queueLinkPreviews(r.Context(), updated)
+	app.publish(r.Context(), events.ListingUpdated, &updated.CompanyID, updated)
+	if payload.Title != nil || payload.Description != nil {
+		app.screenListing(r.Context(), user, updated)
+	}
 
 	if err := app.jsonResponse(w, http.StatusOK, updated); err != nil {
 		app.internalServerError(w, r, err)
@@ -770,7 +860,7 @@ func (app *application) updateListingHandler(w http.ResponseWriter, r *http.Requ
 // deleteListingHandler godoc
 //
 //	@Summary		Delete listing (agency/developer)
-//	@Description	Deletes listing owned by current company. Related favorites and applications are removed by cascade.
+//	@Description	Deletes listing owned by current company. It can be restored with POST /listings/{listingID}/restore for LISTING_DELETED_RETENTION, after which it is purged with its favorites and applications.
 //	@Tags			listings
 //	@Produce		json
 //	@Param			listingID	path		int	true	"Listing ID"
@@ -797,7 +887,7 @@ func (app *application) deleteListingHandler(w http.ResponseWriter, r *http.Requ
 
 	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -810,13 +900,16 @@ func (app *application) deleteListingHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := app.store.Listings.Delete(r.Context(), listingID); err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.forgetListings(listingID)
+	app.invalidateFeed(r.Context())
+	app.publish(r.Context(), events.ListingDeleted, &listing.CompanyID, listingDeletedEvent{ID: listingID})
 
 	if err := app.jsonResponse(w, http.StatusNoContent, ""); err != nil {
 		app.internalServerError(w, r, err)
@@ -851,7 +944,7 @@ func (app *application) createApplicationHandler(w http.ResponseWriter, r *http.
 
 	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -886,7 +979,7 @@ func (app *application) createApplicationHandler(w http.ResponseWriter, r *http.
 		app.conflictResponse(w, r, fmt.Errorf("Вы уже подали заявку на этот объект"))
 		return
 	}
-	if err != store.ErrNotFound {
+	if !errors.Is(err, store.ErrNotFound) {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -913,6 +1006,10 @@ func (app *application) createApplicationHandler(w http.ResponseWriter, r *http.
 	}
 
 	if err := app.store.Applications.Create(r.Context(), appModel); err != nil {
+		if errors.Is(err, store.ErrCheckViolation) {
+			app.badRequestResponse(w, r, err)
+			return
+		}
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -965,7 +1062,7 @@ func (app *application) listApplicationsHandler(w http.ResponseWriter, r *http.R
 
 	apps, err := app.store.Applications.List(r.Context(), filter)
 	if err != nil {
-		if err == store.ErrInvalidFilter {
+		if errors.Is(err, store.ErrInvalidFilter) {
 			app.badRequestResponse(w, r, err)
 			return
 		}
@@ -1009,7 +1106,7 @@ func (app *application) updateApplicationStatusHandler(w http.ResponseWriter, r
 
 	appModel, err := app.store.Applications.GetByID(r.Context(), applicationID)
 	if err != nil {
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
@@ -1038,7 +1135,7 @@ func (app *application) updateApplicationStatusHandler(w http.ResponseWriter, r
 	}
 
 	if err := app.store.Applications.UpdateStatus(r.Context(), appModel.ID, payload.Status); err != nil {
-		if err == store.ErrInvalidStatus {
+		if errors.Is(err, store.ErrInvalidStatus) {
 			app.badRequestResponse(w, r, err)
 			return
 		}
@@ -1085,7 +1182,7 @@ func (app *application) listApplicationMessagesHandler(w http.ResponseWriter, r
 	limit, _ := strconv.Atoi(qs.Get("limit"))
 	offset, _ := strconv.Atoi(qs.Get("offset"))
 
-	messages, err := app.store.Messages.List(r.Context(), applicationID, limit, offset)
+	messages, err := app.store.Messages.List(r.Context(), applicationID, user.ID, limit, offset)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -1099,6 +1196,7 @@ func (app *application) listApplicationMessagesHandler(w http.ResponseWriter, r
 // createApplicationMessageHandler godoc
 //
 //	@Summary	Send message in application chat
+//	@Description	Mentions (@username) of people who can read the chat are returned in mentions, listed under /users/me/mentions and emailed.
 //	@Tags		applications
 //	@Accept		json
 //	@Produce	json
@@ -1127,7 +1225,7 @@ func (app *application) createApplicationMessageHandler(w http.ResponseWriter, r
 	}
 
 	var payload struct {
-		Body string `json:"body" validate:"required,max=5000"`
+		Body string `json:"body" validate:"required,limit=message"`
 	}
 
 	if err := readJSON(w, r, &payload); err != nil {
@@ -1139,17 +1237,35 @@ func (app *application) createApplicationMessageHandler(w http.ResponseWriter, r
 		return
 	}
 
+	if err := app.filterWords(&payload.Body); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
 	senderID := user.ID
 	msg := &store.ApplicationMessage{
 		ApplicationID: applicationID,
 		SenderUserID:  &senderID,
 		Body:          payload.Body,
 	}
+	// held messages are stored hidden, like a muted sender's
+	reasons := app.screenContent(r.Context(), contentfilter.Content{Kind: contentfilter.KindMessage, AuthorID: user.ID, Text: msg.Body})
+	msg.Held = len(reasons) > 0
 
 	if err := app.store.Messages.Create(r.Context(), msg); err != nil {
+		if errors.Is(err, store.ErrCheckViolation) {
+			app.badRequestResponse(w, r, err)
+			return
+		}
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.notifyMentions(r.Context(), user, msg)
+	if msg.Held {
+		app.flagContent(r.Context(), contentfilter.KindMessage, msg.ID, user.ID, reasons, msg.Body)
+	} else {
+		app.publishApplicationMessage(r.Context(), msg)
+	}
 
 	if err := app.jsonResponse(w, http.StatusCreated, msg); err != nil {
 		app.internalServerError(w, r, err)
@@ -1161,7 +1277,7 @@ func (app *application) createApplicationMessageHandler(w http.ResponseWriter, r
 //	@Summary	List listings for moderation
 //	@Tags		admin
 //	@Produce	json
-//	@Param		status			query		string	false	"draft|moderation|active|rejected|archived"
+//	@Param		status			query		string	false	"moderation|scheduled|active|rejected|archived"
 //	@Param		deal_type		query		string	false	"rent|sale"
 //	@Param		city			query		string	false	"City"
 //	@Param		property_type	query		string	false	"Property type"
@@ -1181,6 +1297,11 @@ func (app *application) adminListListingsHandler(w http.ResponseWriter, r *http.
 	if filter.Status == "" {
 		filter.Status = store.ListingStatusModeration
 	}
+	// Drafts belong to their company until submitted.
+	if filter.Status == store.ListingStatusDraft {
+		app.badRequestResponse(w, r, fmt.Errorf("drafts are not listed to admins"))
+		return
+	}
 	filter.DealType = qs.Get("deal_type")
 	filter.City = qs.Get("city")
 	filter.PropertyType = qs.Get("property_type")
@@ -1198,7 +1319,7 @@ func (app *application) adminListListingsHandler(w http.ResponseWriter, r *http.
 
 	listings, err := app.store.Listings.List(r.Context(), filter)
 	if err != nil {
-		if err == store.ErrInvalidFilter {
+		if errors.Is(err, store.ErrInvalidFilter) {
 			app.badRequestResponse(w, r, err)
 			return
 		}
@@ -1245,17 +1366,19 @@ func (app *application) adminUpdateListingStatusHandler(w http.ResponseWriter, r
 	}
 
 	if err := app.store.Listings.UpdateStatus(r.Context(), listingID, payload.Status); err != nil {
-		if err == store.ErrInvalidStatus {
+		if errors.Is(err, store.ErrInvalidStatus) {
 			app.badRequestResponse(w, r, err)
 			return
 		}
-		if err == store.ErrNotFound {
+		if errors.Is(err, store.ErrNotFound) {
 			app.notFoundResponse(w, r, err)
 			return
 		}
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.forgetListings(listingID)
+	app.invalidateFeed(r.Context())
 
 	// Log action
 	adminUser := getUserFromContext(r)
@@ -1270,6 +1393,9 @@ func (app *application) adminUpdateListingStatusHandler(w http.ResponseWriter, r
 	}
 
 	listing, _ := app.store.Listings.GetByID(r.Context(), listingID)
+	if listing != nil && listing.Status == store.ListingStatusActive {
+		app.publishListingPublished(r.Context(), listing)
+	}
 
 	if err := app.jsonResponse(w, http.StatusOK, listing); err != nil {
 		app.internalServerError(w, r, err)
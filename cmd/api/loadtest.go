@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type loadTestConfig struct {
+	// enabled turns off every call out of the process so a load test
+	// measures the API, its database and Redis only. It also lifts the
+	// sign-in rate limit; RATE_LIMITER_ENABLED covers the global one.
+	enabled bool
+	// pprofAddr serves net/http/pprof while load testing, empty disables it
+	pprofAddr string
+}
+
+// withoutExternalCalls returns cfg with the mail provider, bot check,
+// breach and MX checks, webhooks, NATS, operator alerts, tracing and error
+// reporting turned off. Emails still go through the outbox to the no-op
+// mailer, so the request path is the one production takes.
+func (cfg config) withoutExternalCalls() config {
+	cfg.mail.mailTrap.apiKey = ""
+	cfg.mail.sendGrid.apiKey = ""
+	cfg.mail.smtp.host = ""
+	cfg.auth.botCheck.provider = ""
+	cfg.auth.breachCheck.enabled = false
+	cfg.auth.emailCheck.checkMX = false
+	cfg.webhooks.interval = 0
+	cfg.events.natsURL = ""
+	cfg.alert.slackWebhookURL = ""
+	cfg.alert.pagerDutyRoutingKey = ""
+	cfg.alert.email = ""
+	cfg.tracing.endpoint = ""
+	cfg.errorReport.sentryDSN = ""
+	return cfg
+}
+
+// servePprof serves the profiling endpoints on their own listener, away
+// from the API's routes and middleware.
+func servePprof(addr string, logger *zap.SugaredLogger) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	logger.Infow("serving pprof", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		logger.Errorw("pprof server stopped", "error", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"golang.org/x/text/language"
+)
+
+// Every request carries one negotiated locale, read with reqctx.Locale, for
+// whatever it answers or sends in a language: validation messages, emails
+// and, later, other localized responses. localeMiddleware sets it for
+// anonymous requests and the auth middleware again once the user is known.
+
+// supportedLocales are the locales with translations, the default first;
+// the matcher falls back to it.
+var supportedLocales = []language.Tag{language.English, language.Russian}
+
+var localeMatcher = language.NewMatcher(supportedLocales)
+
+// negotiateLocale picks the locale of r: the user's locale setting, then
+// the best supported match of Accept-Language, then the locale of the
+// request's region and then the default.
+func negotiateLocale(r *http.Request) string {
+	if user := getUserFromContext(r); user != nil && user.Locale != "" {
+		return user.Locale
+	}
+	if locale := acceptLanguage(r.Header.Get("Accept-Language")); locale != "" {
+		return locale
+	}
+	if locale := countryLocales[requestRegion(r)]; locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
+
+// acceptLanguage returns the supported locale that best matches an
+// Accept-Language header, honouring q-values, or "" when none does.
+func acceptLanguage(header string) string {
+	if header == "" {
+		return ""
+	}
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	_, index, confidence := localeMatcher.Match(tags...)
+	if confidence == language.No {
+		return ""
+	}
+	base, _ := supportedLocales[index].Base()
+	return base.String()
+}
+
+// requestLocale returns the locale negotiated for r, negotiating it when no
+// middleware did, as in handlers mounted on their own.
+func requestLocale(r *http.Request) string {
+	if locale := reqctx.Locale(r.Context()); locale != "" {
+		return locale
+	}
+	return negotiateLocale(r)
+}
+
+// localeMiddleware negotiates the request's locale.
+func localeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(reqctx.WithLocale(r.Context(), negotiateLocale(r))))
+	})
+}
+
+// userLocale returns the locale of emails to user outside their own
+// requests: their setting, then the locale of their region or registration
+// country.
+func userLocale(user *store.User) string {
+	if user.Locale != "" {
+		return user.Locale
+	}
+	region := user.Region
+	if region == "" {
+		region = user.Country
+	}
+	if locale := countryLocales[region]; locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
+
+// localizedTemplate returns the translation of templateFile for locale,
+// falling back to templateFile; see mailer.LocalizedTemplate.
+func localizedTemplate(templateFile, locale string) string {
+	if locale == defaultLocale {
+		return templateFile
+	}
+	return mailer.LocalizedTemplate(templateFile, locale)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestAcceptLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":                             "",
+		"ru":                           "ru",
+		"ru-KZ":                        "ru",
+		"en-GB,en;q=0.9":               "en",
+		"de;q=1.0, ru;q=0.5, en;q=0.4": "ru",
+		"en;q=0.2, ru;q=0.8":           "ru",
+		"de-DE":                        "",
+		"not a header;;":               "",
+	}
+	for header, want := range tests {
+		if got := acceptLanguage(header); got != want {
+			t.Errorf("acceptLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestLocaleMiddleware(t *testing.T) {
+	var got string
+	handler := localeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = reqctx.Locale(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "ru" {
+		t.Errorf("locale %q, want ru", got)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got != defaultLocale {
+		t.Errorf("locale %q, want the default", got)
+	}
+}
+
+func TestLocalizedTemplate(t *testing.T) {
+	if got := localizedTemplate(mailer.MagicLinkTemplate, "ru"); got != "magic_link.ru.tmpl" {
+		t.Errorf("ru magic link template %q", got)
+	}
+	if got := localizedTemplate(mailer.MentionTemplate, "ru"); got != mailer.MentionTemplate {
+		t.Errorf("untranslated template %q", got)
+	}
+	if got := localizedTemplate(mailer.MagicLinkTemplate, "en"); got != mailer.MagicLinkTemplate {
+		t.Errorf("en template %q", got)
+	}
+
+	if got := userLocale(&store.User{Country: "KZ"}); got != "ru" {
+		t.Errorf("userLocale by country = %q", got)
+	}
+	if got := userLocale(&store.User{Country: "KZ", Locale: "en"}); got != "en" {
+		t.Errorf("userLocale with setting = %q", got)
+	}
+
+	subject, _, err := mailer.Render(localizedTemplate(mailer.UserWelcomeTemplate, "ru"), map[string]string{"Username": "anna", "ActivationURL": "https://example.com/confirm/abc"})
+	if err != nil || subject != " Завершите регистрацию в Real Estate " {
+		t.Errorf("ru welcome subject %q, %v", subject, err)
+	}
+}
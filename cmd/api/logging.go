@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type logConfig struct {
+	// level is debug, info, warn or error
+	level string
+	// format is json for log collectors or console for humans
+	format string
+	// samplingInitial identical entries per second are logged before only
+	// every samplingThereafter-th one is; 0 turns sampling off
+	samplingInitial    int
+	samplingThereafter int
+}
+
+// build returns the zap configuration for cfg. Production defaults apply
+// otherwise, so JSON lines keep the fields collectors already parse.
+func (cfg logConfig) build() (zap.Config, error) {
+	zc := zap.NewProductionConfig()
+
+	level, err := zapcore.ParseLevel(cfg.level)
+	if err != nil {
+		return zc, fmt.Errorf("invalid LOG_LEVEL %q", cfg.level)
+	}
+	zc.Level = zap.NewAtomicLevelAt(level)
+
+	switch cfg.format {
+	case "json", "":
+	case "console":
+		zc.Encoding = "console"
+		zc.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+		zc.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.TimeOnly)
+	default:
+		return zc, fmt.Errorf("invalid LOG_FORMAT %q, want json or console", cfg.format)
+	}
+
+	zc.Sampling = nil
+	if cfg.samplingInitial > 0 {
+		zc.Sampling = &zap.SamplingConfig{Initial: cfg.samplingInitial, Thereafter: max(cfg.samplingThereafter, 1)}
+	}
+	return zc, nil
+}
+
+// newLogger builds the application logger. Every message and field passes
+// through r before it is encoded, see redact.go.
+func newLogger(cfg logConfig, r *redactor) (*zap.SugaredLogger, error) {
+	zc, err := cfg.build()
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := zc.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return newRedactingCore(core, r)
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return logger.Sugar(), nil
+}
+
+// mustLogger is newLogger for main, where there is no logger yet to report
+// a bad configuration with.
+func mustLogger(cfg logConfig, r *redactor) *zap.SugaredLogger {
+	logger, err := newLogger(cfg, r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return logger
+}
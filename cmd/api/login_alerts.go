@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// Session is a successful sign-in. Tokens are stateless, so this is the
+// sign-in history rather than a list of live tokens.
+type Session struct {
+	ID        int64  `json:"id"`
+	IP        string `json:"ip"`
+	Country   string `json:"country,omitempty"`
+	Device    string `json:"device,omitempty"`
+	UserAgent string `json:"user_agent"`
+	CreatedAt string `json:"created_at"`
+}
+
+// browsers are matched in order: Edge and Opera also send Chrome, and
+// Chrome also sends Safari.
+var browsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+var operatingSystems = []struct{ token, name string }{
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Windows", "Windows"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// deviceName reduces a User-Agent to browser and operating system, such as
+// "Firefox on Windows", so browser updates do not look like a new device.
+// Other clients are named by their first product token, like "okhttp".
+func deviceName(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+
+	browser, os := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, o := range operatingSystems {
+		if strings.Contains(userAgent, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	product, _, _ := strings.Cut(userAgent, "/")
+	product, _, _ = strings.Cut(product, " ")
+	return product
+}
+
+// alertNewSignIn emails the user when event, a successful login that is
+// not stored yet, comes from a country or device none of their earlier
+// logins came from. Unknown countries and devices never count as new, and
+// neither does the first login.
+func (app *application) alertNewSignIn(ctx context.Context, user *store.User, event *store.LoginEvent) {
+	if !app.config.auth.loginAlerts {
+		return
+	}
+
+	history, err := app.store.LoginEvents.History(ctx, user.ID, event.Country, event.Device)
+	if err != nil {
+		app.logger.Errorw("could not load login history", "user_id", user.ID, "error", err)
+		return
+	}
+	newCountry := event.Country != "" && !history.KnownCountry
+	newDevice := event.Device != "" && !history.KnownDevice
+	if history.Logins == 0 || (!newCountry && !newDevice) {
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		Username    string
+		Time        string
+		Device      string
+		Country     string
+		IP          string
+		NewCountry  bool
+		NewDevice   bool
+		SecurityURL string
+	}{
+		Username:    user.Username,
+		Time:        time.Now().UTC().Format("2 Jan 2006 15:04 MST"),
+		Device:      event.Device,
+		Country:     event.Country,
+		IP:          event.IP,
+		NewCountry:  newCountry,
+		NewDevice:   newDevice,
+		SecurityURL: strings.TrimRight(app.config.frontendURL, "/") + "/settings/security",
+	})
+	if err != nil {
+		app.logger.Errorw("could not build sign-in alert", "user_id", user.ID, "error", err)
+		return
+	}
+
+	err = app.store.Outbox.Enqueue(ctx, &store.OutboxEmail{
+		Template:    localizedTemplate(mailer.NewSignInTemplate, userLocale(user)),
+		Username:    user.Username,
+		Email:       user.Email,
+		Data:        data,
+		TriggeredBy: selfService(user.ID),
+	})
+	if err != nil {
+		app.logger.Errorw("could not queue sign-in alert", "user_id", user.ID, "error", err)
+	}
+}
+
+// listSessionsHandler godoc
+//
+//	@Summary		List my sign-ins
+//	@Description	Successful logins of the current user, newest first, with IP, country and device
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		Session
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/sessions [get]
+func (app *application) listSessionsHandler(r *http.Request, _ *noBody) (paged[Session], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[Session]{}, err
+	}
+
+	events, err := app.store.LoginEvents.ListSuccessful(r.Context(), getUserFromContext(r).ID, storeQuery(params))
+	if err != nil {
+		return paged[Session]{}, err
+	}
+
+	sessions := make([]Session, len(events))
+	for i, e := range events {
+		sessions[i] = Session{ID: e.ID, IP: e.IP, Country: e.Country, Device: e.Device, UserAgent: e.UserAgent, CreatedAt: e.CreatedAt}
+	}
+	return newPage(params, sessions), nil
+}
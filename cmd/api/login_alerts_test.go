@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestDeviceName(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36":           "Chrome on Windows",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0": "Edge on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0":                                                    "Firefox on Linux",
+		"okhttp/4.12.0": "okhttp",
+		"":              "",
+	}
+	for ua, want := range tests {
+		if got := deviceName(ua); got != want {
+			t.Errorf("deviceName(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestNewSignInAlert(t *testing.T) {
+	geoIPCountryHeader = "CF-IPCountry"
+	t.Cleanup(func() { geoIPCountryHeader = "" })
+
+	app, mail := newMemoryTestApplication(t, config{auth: authConfig{loginAlerts: true}})
+	mux := app.mount()
+	ctx := context.Background()
+
+	user := &store.User{Username: "jo", Email: "jo@example.com", Role: store.Role{Name: store.RoleUser}}
+	user.Password.Set("Abcdefg1!x")
+	if err := app.store.Users.CreateActive(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(country, userAgent string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/authentication/token", strings.NewReader(`{"identifier":"jo","password":"Abcdefg1!x"}`))
+		req.Header.Set("CF-IPCountry", country)
+		req.Header.Set("User-Agent", userAgent)
+		checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+	}
+	alerts := func() int {
+		app.relayOutbox(ctx)
+		n := 0
+		for _, m := range mail.Sent() {
+			if m.Template == mailer.NewSignInTemplate {
+				n++
+			}
+		}
+		return n
+	}
+
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0"
+	login("KZ", firefox)
+	login("KZ", firefox+" updated")
+	if n := alerts(); n != 0 {
+		t.Fatalf("%d alerts for the first and a familiar login", n)
+	}
+	login("DE", firefox)
+	if n := alerts(); n != 1 {
+		t.Fatalf("%d alerts after a login from a new country, want 1", n)
+	}
+
+	sessions, err := app.store.LoginEvents.ListSuccessful(ctx, user.ID, store.PaginatedQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 3 || sessions[0].Country != "DE" || sessions[0].Device != "Firefox on Linux" {
+		t.Errorf("unexpected sessions %+v", sessions)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+	"github.com/go-chi/chi/v5"
+)
+
+type MagicLinkPayload struct {
+	Identifier string `json:"identifier" validate:"required,max=255"`
+}
+
+// requestMagicLinkHandler godoc
+//
+//	@Summary		Request a sign-in link
+//	@Description	Emails a single-use sign-in link to an active account. Answers 202 with the same body whether or not the account exists; requests for existing accounts take longer, as the link is stored.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MagicLinkPayload	true	"Username or email"
+//	@Success		202		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/magic-link [post]
+func (app *application) requestMagicLinkHandler(r *http.Request, payload *MagicLinkPayload) (map[string]string, error) {
+	response := map[string]string{"message": "if the account exists, a sign-in link has been sent"}
+
+	user, err := app.getUserByLogin(r.Context(), strings.TrimSpace(payload.Identifier))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return response, nil
+		}
+		return nil, err
+	}
+
+	token, err := app.tokens.Issue(tokens.MagicLink)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(struct {
+		Username  string
+		LoginURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		LoginURL:  app.buildMagicLinkURL(token.Plain),
+		ExpiresIn: app.tokens.TTL(tokens.MagicLink).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	email := &store.OutboxEmail{
+		Template:    localizedTemplate(mailer.MagicLinkTemplate, userLocale(user)),
+		Username:    user.Username,
+		Email:       user.Email,
+		Data:        data,
+		TriggeredBy: selfService(user.ID),
+	}
+
+	if err := app.store.MagicLinks.Create(r.Context(), user.ID, token.Hash, token.ExpiresAt, email); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// consumeMagicLinkHandler godoc
+//
+//	@Summary		Sign in with a link
+//	@Description	Exchanges a sign-in link token for a JWT. Each link works once.
+//	@Tags			authentication
+//	@Produce		json
+//	@Param			token	path		string			true	"Sign-in token"
+//	@Success		200		{object}	LoginResponse	"Login successful"
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/magic-link/{token} [get]
+func (app *application) consumeMagicLinkHandler(r *http.Request, _ *noBody) (*LoginResponse, error) {
+	userID, err := app.store.MagicLinks.Consume(r.Context(), tokens.Lookup(tokens.MagicLink, chi.URLParam(r, "token")))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, newHTTPError(http.StatusUnauthorized, "invalid or expired sign-in link")
+		}
+		return nil, err
+	}
+
+	user, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// refused like a password login, since activationGate would refuse
+	// every request made with the token
+	if user.PendingActivation() && app.config.auth.strictActivation {
+		_ = app.logLoginEvent(r, &user.ID, user.Email, false)
+		return nil, newHTTPError(http.StatusUnauthorized, "unauthorized")
+	}
+
+	app.logSuccessfulLogin(r, user)
+
+	token, err := app.generateToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{Token: token, User: user}, nil
+}
+
+func (app *application) buildMagicLinkURL(token string) string {
+	base := strings.TrimRight(app.config.frontendURL, "/")
+	return fmt.Sprintf("%s/magic-link/%s", base, url.PathEscape(token))
+}
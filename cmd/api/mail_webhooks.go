@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// mailWebhookHandler godoc
+//
+//	@Summary		Mail provider delivery webhook
+//	@Description	Receives bounce and complaint events from SendGrid, Mailgun or Amazon SES (through SNS). The request must carry the provider's signature. Addresses that bounced permanently or complained are never emailed again.
+//	@Tags			webhooks
+//	@Accept			json
+//	@Param			provider	path	string	true	"sendgrid, mailgun or ses"
+//	@Success		204
+//	@Failure		401	{object}	error	"Invalid signature"
+//	@Failure		404	{object}	error	"Provider not configured"
+//	@Router			/webhooks/mail/{provider} [post]
+func (app *application) mailWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	hooks := app.config.mail.webhooks
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var events []mailer.DeliveryEvent
+	switch {
+	case provider == "sendgrid" && hooks.sendGridPublicKey != "":
+		events, err = mailer.ParseSendGridEvents(hooks.sendGridPublicKey, payload,
+			r.Header.Get("X-Twilio-Email-Event-Webhook-Signature"),
+			r.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp"))
+	case provider == "mailgun" && hooks.mailgunSigningKey != "":
+		events, err = mailer.ParseMailgunEvent(hooks.mailgunSigningKey, payload)
+	case provider == "ses" && app.sesVerifier != nil:
+		events, err = app.sesVerifier.ParseSESEvents(r.Context(), payload)
+	default:
+		app.notFoundResponse(w, r, errors.New("mail webhook not configured"))
+		return
+	}
+	if errors.Is(err, mailer.ErrInvalidSignature) {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	for _, event := range events {
+		if event.Email == "" {
+			continue
+		}
+
+		reason := store.SuppressionBounce
+		if event.Kind == mailer.DeliveryComplaint {
+			reason = store.SuppressionComplaint
+		}
+
+		err := app.store.Suppressions.Add(r.Context(), &store.EmailSuppression{
+			Email:  event.Email,
+			Reason: reason,
+			Source: provider,
+			Detail: event.Reason,
+		})
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.logger.Infow("email address suppressed", "provider", provider, "reason", reason)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestMailWebhook(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(t, config{mail: mailConfig{webhooks: mailWebhookConfig{
+		sendGridPublicKey: base64.StdEncoding.EncodeToString(der),
+		mailgunSigningKey: "mailgun-signing-key",
+	}}})
+	app.store = store.NewMemoryStorage()
+	mux := app.mount()
+
+	isSuppressed := func(email string) bool {
+		t.Helper()
+		suppressed, err := app.store.Suppressions.IsSuppressed(context.Background(), email, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return suppressed
+	}
+
+	t.Run("sendgrid", func(t *testing.T) {
+		const timestamp = "1700000000"
+		payload := `[{"email":"bounced@example.com","event":"bounce","type":"bounce","reason":"550 no such user"},` +
+			`{"email":"blocked@example.com","event":"bounce","type":"blocked"},` +
+			`{"email":"opened@example.com","event":"open"}]`
+		hash := sha256.Sum256([]byte(timestamp + payload))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/v1/webhooks/mail/sendgrid", strings.NewReader(payload))
+		req.Header.Set("X-Twilio-Email-Event-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(sig))
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+		if !isSuppressed("Bounced@example.com") {
+			t.Error("expected the hard bounce to be suppressed")
+		}
+		if isSuppressed("blocked@example.com") || isSuppressed("opened@example.com") {
+			t.Error("only hard bounces and complaints should be suppressed")
+		}
+	})
+
+	t.Run("mailgun", func(t *testing.T) {
+		sign := func(key string) string {
+			mac := hmac.New(sha256.New, []byte(key))
+			mac.Write([]byte("1700000000" + "token"))
+			return fmt.Sprintf(`{"signature":{"timestamp":"1700000000","token":"token","signature":"%s"},`+
+				`"event-data":{"event":"complained","recipient":"complainer@example.com"}}`, hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/v1/webhooks/mail/mailgun", strings.NewReader(sign("wrong-key")))
+		checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, mux).Code)
+		if isSuppressed("complainer@example.com") {
+			t.Fatal("unsigned event was applied")
+		}
+
+		req, _ = http.NewRequest(http.MethodPost, "/v1/webhooks/mail/mailgun", strings.NewReader(sign("mailgun-signing-key")))
+		checkResponseCode(t, http.StatusNoContent, executeRequest(req, mux).Code)
+		if !isSuppressed("complainer@example.com") {
+			t.Error("expected the complaint to be suppressed")
+		}
+	})
+
+	t.Run("unconfigured provider", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/webhooks/mail/ses", strings.NewReader("{}"))
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maintenanceConfig configures maintenance mode, in which every route but
+// health checks and the admin API returns 503. It is on while enabled is
+// set or toggled through the admin endpoint, or while file exists.
+type maintenanceConfig struct {
+	enabled bool
+	// file is checked every interval; empty disables the check
+	file     string
+	interval time.Duration
+	// retryAfter is sent to clients as Retry-After
+	retryAfter time.Duration
+}
+
+type MaintenancePayload struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+	// FileEnabled is set while MAINTENANCE_FILE exists; the admin endpoint
+	// cannot turn that off
+	FileEnabled       bool `json:"file_enabled"`
+	RetryAfterSeconds int  `json:"retry_after_seconds"`
+}
+
+// getMaintenanceHandler godoc
+//
+//	@Summary		Get maintenance mode
+//	@Description	Reports whether the API is currently answering non-admin requests with 503
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	MaintenanceStatus
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/maintenance [get]
+func (app *application) getMaintenanceHandler(r *http.Request, _ *noBody) (MaintenanceStatus, error) {
+	return app.maintenanceStatus(), nil
+}
+
+// setMaintenanceHandler godoc
+//
+//	@Summary		Toggle maintenance mode
+//	@Description	Enables or disables maintenance mode. While enabled every route except health checks, admin sign-in and the admin API returns 503 with Retry-After.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MaintenancePayload	true	"Maintenance flag"
+//	@Success		200		{object}	MaintenanceStatus
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/maintenance [put]
+func (app *application) setMaintenanceHandler(r *http.Request, payload *MaintenancePayload) (MaintenanceStatus, error) {
+	app.maintenance.Store(*payload.Enabled)
+
+	adminUser := getUserFromContext(r)
+	app.logger.Warnw("maintenance mode changed", "enabled", *payload.Enabled, "admin_id", adminUser.ID)
+	app.logAdminAction(adminUser, "set_maintenance", "system", 0, strconv.FormatBool(*payload.Enabled))
+
+	return app.maintenanceStatus(), nil
+}
+
+func (app *application) maintenanceStatus() MaintenanceStatus {
+	return MaintenanceStatus{
+		Enabled:           app.maintenance.Load(),
+		FileEnabled:       app.maintenanceFile.Load(),
+		RetryAfterSeconds: int(app.config.maintenance.retryAfter.Seconds()),
+	}
+}
+
+func (app *application) inMaintenance() bool {
+	return app.maintenance.Load() || app.maintenanceFile.Load()
+}
+
+// maintenanceMiddleware answers every request with 503 during maintenance,
+// except those to maintenanceExempt paths.
+func (app *application) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.inMaintenance() || maintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		retryAfter := int(app.config.maintenance.retryAfter.Seconds())
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		app.serviceUnavailableResponse(w, r, "the API is down for maintenance, please try again later")
+	})
+}
+
+// maintenanceExempt reports whether path keeps working during maintenance:
+// health checks for the load balancer and what admins need to sign in and
+// turn it off.
+func maintenanceExempt(path string) bool {
+	path = unversionedPath(path)
+	switch path {
+	case "/health", "/version", "/debug/vars", "/authentication/admin/token":
+		return true
+	}
+	return strings.HasPrefix(path, "/admin/")
+}
+
+// watchMaintenanceFile turns maintenance mode on while file exists, so a
+// deploy script can toggle it on every instance without an admin token.
+func (app *application) watchMaintenanceFile(ctx context.Context, file string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := os.Stat(file)
+		enabled := err == nil
+		if app.maintenanceFile.Swap(enabled) != enabled {
+			if enabled {
+				app.logger.Warnw("maintenance file found; rejecting non-admin requests", "file", file)
+			} else {
+				app.logger.Infow("maintenance file removed; accepting requests", "file", file)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
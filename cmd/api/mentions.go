@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/push"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+const (
+	maxMentionsPerMessage = 5
+	mentionExcerptLength  = 200
+)
+
+// mentionPattern matches @username where usernames are the lowercase letters,
+// digits and dashes produced by service.GenerateUsername. The @ must not follow a
+// word character, so email addresses are not mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@-])@([a-zA-Z0-9][a-zA-Z0-9-]*)`)
+
+// extractMentions returns the distinct usernames mentioned in body, in the
+// order they first appear and at most maxMentionsPerMessage of them.
+func extractMentions(body string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		username := strings.ToLower(m[1])
+		if seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentionsPerMessage {
+			break
+		}
+	}
+	return usernames
+}
+
+// notifyMentions records the users mentioned in msg and emails them. Only
+// active users who can read the application's messages and have no block
+// with the sender can be mentioned; other names stay plain text. The store records nobody for hidden messages
+// of muted senders, but msg.Mentions is filled either way so the sender
+// cannot tell. Failures are logged and do not fail the message.
+func (app *application) notifyMentions(ctx context.Context, sender *store.User, msg *store.ApplicationMessage) {
+	users := make(map[int64]*store.User)
+	var ids []int64
+	for _, username := range extractMentions(msg.Body) {
+		u, err := app.store.Users.GetByUsername(ctx, username)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				app.logger.Warnw("could not look up mentioned user", "message_id", msg.ID, "error", err)
+			}
+			continue
+		}
+		if u.ID == sender.ID || !u.IsActive || !app.canAccessApplication(ctx, u, msg.ApplicationID) {
+			continue
+		}
+		if blocked, err := app.store.Blocks.Between(ctx, sender.ID, u.ID); err != nil || blocked {
+			continue
+		}
+		users[u.ID] = u
+		ids = append(ids, u.ID)
+		msg.Mentions = append(msg.Mentions, u.Username)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	recorded, err := app.store.Mentions.Create(ctx, msg.ID, ids)
+	if err != nil {
+		app.logger.Errorw("could not record mentions", "message_id", msg.ID, "error", err)
+		return
+	}
+	for _, id := range recorded {
+		app.queueMentionNotifications(ctx, sender, users[id], msg)
+	}
+}
+
+// messageExcerpt shortens body to what notifications quote of it.
+func messageExcerpt(body string) string {
+	if utf8.RuneCountInString(body) > mentionExcerptLength {
+		return string([]rune(body)[:mentionExcerptLength]) + "…"
+	}
+	return body
+}
+
+// queueMentionNotifications queues the mention email and notifies the
+// recipient's devices and event streams.
+func (app *application) queueMentionNotifications(ctx context.Context, sender, recipient *store.User, msg *store.ApplicationMessage) {
+	senderName := strings.TrimSpace(sender.FirstName + " " + sender.LastName)
+	if senderName == "" {
+		senderName = sender.Username
+	}
+
+	excerpt := messageExcerpt(msg.Body)
+
+	messageURL := fmt.Sprintf("%s/applications/%d", strings.TrimRight(app.config.frontendURL, "/"), msg.ApplicationID)
+
+	app.notify(ctx, recipient.ID, push.Notification{
+		Title: senderName + " mentioned you",
+		Body:  excerpt,
+		URL:   messageURL,
+	})
+
+	data, err := json.Marshal(struct {
+		Username       string
+		SenderName     string
+		Excerpt        string
+		MessageURL     string
+		UnsubscribeURL string
+	}{
+		Username:       recipient.Username,
+		SenderName:     senderName,
+		Excerpt:        excerpt,
+		MessageURL:     messageURL,
+		UnsubscribeURL: app.unsubscribeURL(recipient.Email),
+	})
+	if err == nil {
+		email := &store.OutboxEmail{
+			Template: mailer.MentionTemplate,
+			Username: recipient.Username,
+			Email:    recipient.Email,
+			Data:     data,
+		}
+		app.scheduleEmail(ctx, recipient.ID, email)
+		err = app.store.Outbox.Enqueue(ctx, email)
+	}
+	if err != nil {
+		app.logger.Errorw("could not queue mention email", "message_id", msg.ID, "user_id", recipient.ID, "error", err)
+	}
+}
+
+// listMentionsHandler godoc
+//
+//	@Summary		Mentions of the current user
+//	@Description	Application messages that mention the current user, newest first
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{array}		store.Mention
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/mentions [get]
+func (app *application) listMentionsHandler(r *http.Request, _ *noBody) (paged[store.Mention], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.Mention]{}, err
+	}
+
+	mentions, err := app.store.Mentions.ListByUser(r.Context(), getUserFromContext(r).ID, storeQuery(params))
+	return newPage(params, mentions), err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"@Anna please check, cc @anna and @bob-2", []string{"anna", "bob-2"}},
+		{"write to anna@example.com", nil},
+		{"(@a) @b @c @d @e @f", []string{"a", "b", "c", "d", "e"}},
+	}
+
+	for _, tt := range tests {
+		if got := extractMentions(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("extractMentions(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplicationMessageMentions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	companyID, otherCompanyID := int64(1), int64(2)
+	applicant := &store.User{Username: "applicant", Email: "applicant@example.com", IsActive: true}
+	agent := &store.User{Username: "agent", Email: "agent@example.com", IsActive: true, CompanyID: &companyID}
+	outsider := &store.User{Username: "outsider", Email: "outsider@example.com", IsActive: true, CompanyID: &otherCompanyID}
+	for _, u := range []*store.User{applicant, agent, outsider} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listing := &store.Listing{CompanyID: companyID, Title: "Flat", DealType: "rent", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	application := &store.Application{ListingID: listing.ID, UserID: applicant.ID, FullName: "A", Email: applicant.Email, Status: "new", DealType: "rent"}
+	if err := app.store.Applications.Create(ctx, application); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/applications/{applicationID}/messages", app.createApplicationMessageHandler)
+	mux.Get("/v1/users/me/mentions", handle(app, http.StatusOK, app.listMentionsHandler))
+
+	body, _ := json.Marshal(map[string]string{"body": "Hi @agent, is it free? Also @outsider and @nobody"})
+	req, _ := http.NewRequest(http.MethodPost, "/v1/applications/1/messages", bytes.NewReader(body))
+	req = req.WithContext(reqctx.WithUser(req.Context(), applicant))
+	resp := executeRequest(req, mux).Result()
+	checkResponseCode(t, http.StatusCreated, resp.StatusCode)
+
+	var created struct {
+		Data store.ApplicationMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(created.Data.Mentions, []string{"agent"}) {
+		t.Errorf("mentions = %q, want only the agent who can read the chat", created.Data.Mentions)
+	}
+
+	emails, err := app.store.Outbox.ClaimPending(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 1 || emails[0].Template != mailer.MentionTemplate || emails[0].Email != agent.Email {
+		t.Errorf("expected one mention email to the agent, got %+v", emails)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/users/me/mentions", nil)
+	req = req.WithContext(reqctx.WithUser(req.Context(), agent))
+	resp = executeRequest(req, mux).Result()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+	var mentions struct {
+		Data []store.Mention `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&mentions); err != nil {
+		t.Fatal(err)
+	}
+	if len(mentions.Data) != 1 || mentions.Data[0].SenderUsername != "applicant" {
+		t.Errorf("unexpected mentions %+v", mentions.Data)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+)
+
+// outboxTemplateWindow is how far back the per-template mail metrics look.
+const outboxTemplateWindow = 24 * time.Hour
+
+// outboxDeliveries counts the relay's delivery attempts by result: sent,
+// retry, dead or suppressed. outboxLastRun is the Unix time of the relay's
+// last claim. Both are per instance and published through expvar too.
+var (
+	outboxDeliveries = new(expvar.Map)
+	outboxLastRun    = new(expvar.Int)
+)
+
+// openMetrics writes the OpenMetrics text format, one family at a time.
+type openMetrics struct {
+	buf bytes.Buffer
+}
+
+// family starts a metric family. Counter samples are named with _total.
+func (m *openMetrics) family(name, kind, help string) {
+	fmt.Fprintf(&m.buf, "# TYPE %s %s\n# HELP %s %s\n", name, kind, name, help)
+}
+
+// sample writes one sample of name; labels alternate names and values.
+func (m *openMetrics) sample(name string, value float64, labels ...string) {
+	m.buf.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+		}
+		m.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	m.buf.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+// histogram writes the samples of a histogram family with the buckets of
+// mailer.TimingBuckets; labels are added to every sample.
+func (m *openMetrics) histogram(name string, h mailer.Histogram, labels ...string) {
+	for i, bound := range mailer.TimingBuckets {
+		var count uint64
+		if i < len(h.Counts) {
+			count = h.Counts[i]
+		}
+		m.sample(name+"_bucket", float64(count), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+	}
+	m.sample(name+"_bucket", float64(h.Count), append(labels, "le", "+Inf")...)
+	m.sample(name+"_sum", h.Sum, labels...)
+	m.sample(name+"_count", float64(h.Count), labels...)
+}
+
+// metricsHandler serves the mail queue and relay health in the OpenMetrics
+// text format for Prometheus-compatible scrapers. Queue figures come from
+// the database and are the same on every instance; relay counters are per
+// instance.
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.store.Outbox.Stats(r.Context(), time.Now().Add(-outboxTemplateWindow))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var m openMetrics
+	m.family("mail_outbox_pending", "gauge", "Unsent emails the relay still tries, including those waiting for a retry or a delivery window.")
+	m.sample("mail_outbox_pending", float64(stats.Pending))
+	m.family("mail_outbox_retrying", "gauge", "Pending emails that failed at least once.")
+	m.sample("mail_outbox_retrying", float64(stats.Retrying))
+	m.family("mail_outbox_oldest_pending_age_seconds", "gauge", "Age of the oldest pending email.")
+	m.sample("mail_outbox_oldest_pending_age_seconds", stats.OldestPendingSeconds)
+	m.family("mail_outbox_dead_letters", "gauge", "Emails the relay gave up on after the maximum attempts.")
+	m.sample("mail_outbox_dead_letters", float64(stats.DeadLetters))
+
+	m.family("mail_outbox_template_emails", "gauge", "Emails queued in the last 24 hours, by template.")
+	for _, t := range stats.Templates {
+		m.sample("mail_outbox_template_emails", float64(t.Emails), "template", t.Template)
+	}
+	m.family("mail_outbox_template_dead_letters", "gauge", "Emails queued in the last 24 hours and given up on, by template.")
+	for _, t := range stats.Templates {
+		m.sample("mail_outbox_template_dead_letters", float64(t.DeadLetters), "template", t.Template)
+	}
+	m.family("mail_outbox_template_failure_ratio", "gauge", "Failed share of the send attempts for emails queued in the last 24 hours, by template.")
+	for _, t := range stats.Templates {
+		ratio := 0.0
+		if t.Attempts > 0 {
+			ratio = float64(t.FailedAttempts) / float64(t.Attempts)
+		}
+		m.sample("mail_outbox_template_failure_ratio", ratio, "template", t.Template)
+	}
+
+	m.family("mail_relay_deliveries", "counter", "Delivery attempts by this instance's relay, by result.")
+	var results []string
+	outboxDeliveries.Do(func(kv expvar.KeyValue) { results = append(results, kv.Key) })
+	sort.Strings(results)
+	for _, result := range results {
+		count, _ := strconv.ParseFloat(outboxDeliveries.Get(result).String(), 64)
+		m.sample("mail_relay_deliveries_total", count, "result", result)
+	}
+	m.family("mail_relay_consecutive_failures", "gauge", "Sends that failed in a row on this instance.")
+	m.sample("mail_relay_consecutive_failures", float64(app.mailFailures.Load()))
+	m.family("mail_relay_last_run_timestamp_seconds", "gauge", "When this instance's relay last claimed emails, 0 if it has not run.")
+	m.sample("mail_relay_last_run_timestamp_seconds", float64(outboxLastRun.Value()))
+
+	timings := mailer.Timings()
+	m.family("mail_render_duration_seconds", "histogram", "Time this instance spent parsing and executing mail templates, by template.")
+	for _, t := range timings {
+		m.histogram("mail_render_duration_seconds", t.Render, "template", t.Template)
+	}
+	m.family("mail_send_duration_seconds", "histogram", "Time this instance spent handing rendered emails to the mail provider, per attempt, by template.")
+	for _, t := range timings {
+		m.histogram("mail_send_duration_seconds", t.Send, "template", t.Template)
+	}
+	m.family("mail_render_errors", "counter", "Templates that failed to render on this instance, by template.")
+	for _, t := range timings {
+		m.sample("mail_render_errors_total", float64(t.RenderErrors), "template", t.Template)
+	}
+	m.family("mail_send_errors", "counter", "Send attempts the mail provider refused or that failed on this instance, by template.")
+	for _, t := range timings {
+		m.sample("mail_send_errors_total", float64(t.SendErrors), "template", t.Template)
+	}
+	m.buf.WriteString("# EOF\n")
+
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(m.buf.Bytes())
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMailQueueMetrics(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	enqueue := func(template string) *store.OutboxEmail {
+		t.Helper()
+		email := &store.OutboxEmail{Template: template, Username: "ali", Email: "ali@example.com", Data: json.RawMessage(`{}`)}
+		if err := app.store.Outbox.Enqueue(ctx, email); err != nil {
+			t.Fatal(err)
+		}
+		return email
+	}
+	sent := enqueue("welcome")
+	retrying := enqueue("welcome")
+	dead := enqueue("user_invitation")
+	enqueue("user_invitation")
+
+	if err := app.store.Outbox.MarkSent(ctx, sent.ID); err != nil {
+		t.Fatal(err)
+	}
+	retryAt := time.Now().Add(time.Minute)
+	if err := app.store.Outbox.MarkFailed(ctx, retrying.ID, "timeout", &retryAt); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < outboxMaxAttempts-1; i++ {
+		if err := app.store.Outbox.MarkFailed(ctx, dead.ID, "mailbox unavailable", &retryAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.store.Outbox.DeadLetter(ctx, dead.ID, "mailbox unavailable", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &store.User{ID: 1, Role: store.Role{Name: store.RoleAdmin}}
+	mux := chi.NewRouter()
+	mux.Get("/v1/debug/metrics", app.metricsHandler)
+	do := func(method, path string) *http.Response {
+		req, _ := http.NewRequest(method, path, nil)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), mux).Result()
+	}
+
+	t.Run("metrics", func(t *testing.T) {
+		resp := do(http.MethodGet, "/v1/debug/metrics")
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+			t.Errorf("content type %q", ct)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		for _, want := range []string{
+			"mail_outbox_pending 2\n",
+			"mail_outbox_retrying 1\n",
+			"mail_outbox_dead_letters 1\n",
+			`mail_outbox_template_emails{template="welcome"} 2` + "\n",
+			`mail_outbox_template_dead_letters{template="user_invitation"} 1` + "\n",
+			`mail_outbox_template_failure_ratio{template="welcome"} 0.5` + "\n",
+			`mail_outbox_template_failure_ratio{template="user_invitation"} 1` + "\n",
+			"# TYPE mail_relay_deliveries counter\n",
+			"# TYPE mail_render_duration_seconds histogram\n",
+			"# TYPE mail_send_errors counter\n",
+		} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("missing %q in\n%s", want, body)
+			}
+		}
+		if !strings.HasSuffix(string(body), "# EOF\n") {
+			t.Error("body does not end with # EOF")
+		}
+	})
+}
@@ -1,15 +1,14 @@
 package main
 
 import (
-	"context"
 	"encoding/base64"
+	"expvar"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 )
 
@@ -27,31 +26,58 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token := parts[1]
-		jwtToken, err := app.authenticator.ValidateToken(token)
+		ctx := r.Context()
+
+		claims, userID, err := app.accessTokenClaims(ctx, parts[1])
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
 		}
-
-		claims, _ := jwtToken.Claims.(jwt.MapClaims)
-
-		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+		impersonator, err := app.tokenImpersonator(ctx, claims)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
 		}
 
-		ctx := r.Context()
-
-		user, err := app.getUser(ctx, userID)
+		user, err := app.userService().Get(ctx, userID)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
 		}
+		if !user.CanSignIn() {
+			app.unauthorizedErrorResponse(w, r, errAccountDisabled)
+			return
+		}
+		if err := checkTenant(r, user); err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		if !app.recordUsage(w, r, user) {
+			return
+		}
+
+		noteDebugCaptureUser(r, user.ID)
+		ctx = reqctx.WithUser(ctx, user)
+		ctx = reqctx.WithLocale(ctx, negotiateLocale(r.WithContext(ctx)))
+		if impersonator != nil {
+			ctx = app.impersonate(w, r.WithContext(ctx), impersonator, user)
+		}
+		app.activationGate(next).ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		ctx = context.WithValue(ctx, userCtx, user)
-		next.ServeHTTP(w, r.WithContext(ctx))
+// optionalAuthMiddleware authenticates requests that carry a token, for
+// public routes that personalise their response. Requests without an
+// Authorization header pass through anonymously; a bad token is still 401.
+func (app *application) optionalAuthMiddleware(next http.Handler) http.Handler {
+	authenticated := app.AuthTokenMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
 	})
 }
 
@@ -94,29 +120,9 @@ func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
-func (app *application) getUser(ctx context.Context, userID int64) (*store.User, error) {
-	if !app.config.redisCfg.enabled {
-		return app.store.Users.GetByID(ctx, userID)
-	}
-
-	user, err := app.cacheStorage.Users.Get(ctx, userID)
-	if err != nil {
-		return nil, err
-	}
-
-	if user == nil {
-		user, err = app.store.Users.GetByID(ctx, userID)
-		if err != nil {
-			return nil, err
-		}
-
-		if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
-			return nil, err
-		}
-	}
-
-	return user, nil
-}
+// cacheErrors counts cache calls that failed and were served without the
+// cache; published through expvar when Redis is enabled.
+var cacheErrors = new(expvar.Int)
 
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -133,12 +139,30 @@ func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 
 func (app *application) adminOnlyMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := getUserFromContext(r)
-		if user.Role.Name != store.RoleAdmin {
+		if reqctx.Role(r.Context()) != store.RoleAdmin {
 			app.forbiddenResponse(w, r)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(reqctx.WithStaffAction(r.Context())))
+	})
+}
+
+func (app *application) moderatorOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := reqctx.Role(r.Context())
+		if role != store.RoleAdmin && role != store.RoleModerator {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(reqctx.WithStaffAction(r.Context())))
+	})
+}
+
+// staffActionMiddleware attributes changes to the admin principal. The
+// routes behind it check permissions with requirePermission.
+func (app *application) staffActionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(reqctx.WithStaffAction(r.Context())))
 	})
 }
 
@@ -154,3 +178,42 @@ func (app *application) buildRateLimiterMiddleware(limiter ratelimiter.Limiter)
 	}
 }
 
+// readOnlyMiddleware rejects mutating requests while the API is in read-only
+// mode or the database schema is outside the supported range; reads keep
+// working.
+func (app *application) readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) || readOnlyExemptPaths[unversionedPath(r.URL.Path)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if app.readOnly.Load() {
+			app.serviceUnavailableResponse(w, r, "the API is in read-only mode, please try again later")
+			return
+		}
+
+		if app.schemaIncompatible.Load() {
+			app.serviceUnavailableResponse(w, r, "database schema is incompatible, writes are temporarily disabled")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readOnlyExemptPaths stay writable in read-only mode so operators can sign
+// in and turn it off.
+var readOnlyExemptPaths = map[string]bool{
+	"/admin/read-only":            true,
+	"/authentication/admin/token": true,
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
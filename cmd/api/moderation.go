@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/push"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type ReportListingPayload struct {
+	Type        string `json:"type" validate:"required,oneof=incorrect_listing rule_violation fraud"`
+	Description string `json:"description" validate:"required,max=2000"`
+}
+
+// reportListingHandler godoc
+//
+//	@Summary		Report a listing
+//	@Description	Files a complaint against a listing for moderators to review
+//	@Tags			complaints
+//	@Accept			json
+//	@Produce		json
+//	@Param			listingID	path		int						true	"Listing ID"
+//	@Param			payload		body		ReportListingPayload	true	"Report data"
+//	@Success		201			{object}	store.Complaint
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/report [post]
+func (app *application) reportListingHandler(r *http.Request, payload *ReportListingPayload) (*store.Complaint, error) {
+	user := getUserFromContext(r)
+
+	listingID, err := strconv.ParseInt(chi.URLParam(r, "listingID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := app.store.Listings.GetByID(r.Context(), listingID); err != nil {
+		return nil, err
+	}
+
+	complaint := &store.Complaint{
+		Type:        payload.Type,
+		TargetType:  "listing",
+		TargetID:    listingID,
+		UserID:      user.ID,
+		Description: payload.Description,
+	}
+
+	if err := app.store.Complaints.Create(r.Context(), complaint); err != nil {
+		return nil, err
+	}
+
+	return complaint, nil
+}
+
+// dismissComplaintHandler godoc
+//
+//	@Summary		Dismiss a complaint
+//	@Description	Moderator closes a complaint without acting on the reported content and notifies the reporter
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			complaintID	path		int	true	"Complaint ID"
+//	@Success		200			{object}	store.Complaint
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/complaints/{complaintID}/dismiss [post]
+func (app *application) dismissComplaintHandler(w http.ResponseWriter, r *http.Request) {
+	app.resolveComplaint(w, r, store.ComplaintResolutionDismissed)
+}
+
+// removeReportedContentHandler godoc
+//
+//	@Summary		Remove reported content
+//	@Description	Moderator takes down the reported listing (archived) or company (rejected), closes the complaint and notifies the reporter
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			complaintID	path		int	true	"Complaint ID"
+//	@Success		200			{object}	store.Complaint
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/complaints/{complaintID}/remove [post]
+func (app *application) removeReportedContentHandler(w http.ResponseWriter, r *http.Request) {
+	app.resolveComplaint(w, r, store.ComplaintResolutionRemoved)
+}
+
+func (app *application) resolveComplaint(w http.ResponseWriter, r *http.Request, resolution string) {
+	moderator := getUserFromContext(r)
+
+	complaintID, err := strconv.ParseInt(chi.URLParam(r, "complaintID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// complaints about another tenant's content are not found, before
+	// anything is resolved
+	complaint, err := app.store.Complaints.GetByID(ctx, complaintID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// closing the complaint first settles which of concurrent moderators
+	// acts on the target; it is reopened if the target cannot be updated
+	if err := app.store.Complaints.Resolve(ctx, complaintID, resolution, moderator.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrComplaintClosed):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if resolution == store.ComplaintResolutionRemoved {
+		switch complaint.TargetType {
+		case "listing":
+			err = app.store.Listings.UpdateStatus(ctx, complaint.TargetID, store.ListingStatusArchived)
+		case "company":
+			err = app.store.Companies.UpdateVerificationStatus(ctx, complaint.TargetID, store.VerificationRejected)
+		}
+		// a target deleted meanwhile is already gone
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			if reopenErr := app.store.Complaints.Reopen(ctx, complaintID, complaint.Status); reopenErr != nil {
+				app.logger.Errorw("could not reopen complaint", "complaint_id", complaintID, "error", reopenErr)
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+		if complaint.TargetType == "listing" {
+			app.forgetListings(complaint.TargetID)
+			app.invalidateFeed(ctx)
+		}
+	}
+
+	app.logAdminAction(moderator, resolution+"_complaint", "complaint", complaintID, complaint.TargetType)
+
+	complaint, err = app.store.Complaints.GetByID(ctx, complaintID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.notifyComplaintResolved(r.Context(), *complaint)
+
+	if err := app.jsonResponse(w, http.StatusOK, complaint); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// notifyComplaintResolved queues an email to the reporter for their delivery
+// window. The moderator is recorded as the principal through ctx. A failure
+// is logged and does not fail the resolution.
+func (app *application) notifyComplaintResolved(ctx context.Context, complaint store.Complaint) {
+	reporter, err := app.store.Users.GetByID(ctx, complaint.UserID)
+	if err != nil {
+		app.logger.Warnw("could not load complaint reporter", "complaint_id", complaint.ID, "error", err)
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		Username       string
+		TargetName     string
+		Resolution     string
+		UnsubscribeURL string
+	}{
+		Username:       reporter.Username,
+		TargetName:     complaint.TargetName,
+		Resolution:     complaint.Resolution,
+		UnsubscribeURL: app.unsubscribeURL(reporter.Email),
+	})
+	if err == nil {
+		email := &store.OutboxEmail{
+			Template: mailer.ComplaintResolvedTemplate,
+			Username: reporter.Username,
+			Email:    reporter.Email,
+			Data:     data,
+		}
+		app.scheduleEmail(ctx, reporter.ID, email)
+		err = app.store.Outbox.Enqueue(ctx, email)
+	}
+	if err != nil {
+		app.logger.Errorw("could not queue complaint resolution email", "complaint_id", complaint.ID, "error", err)
+	}
+
+	app.notify(ctx, reporter.ID, push.Notification{
+		Title: "Your report was resolved",
+		Body:  "Your report about " + complaint.TargetName + " was resolved: " + complaint.Resolution,
+	})
+}
+
+// muteUserHandler godoc
+//
+//	@Summary		Shadow mute a user
+//	@Description	Messages the user sends from now on are only visible to themselves
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/users/{userID}/mute [put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserMuted(w, r, true)
+}
+
+// unmuteUserHandler godoc
+//
+//	@Summary		Lift a shadow mute
+//	@Description	New messages from the user become visible again; messages sent while muted stay hidden
+//	@Tags			moderation
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/users/{userID}/mute [delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.setUserMuted(w, r, false)
+}
+
+func (app *application) setUserMuted(w http.ResponseWriter, r *http.Request, muted bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// staff only mute those below them, like impersonation leaves staff
+	// accounts alone
+	moderator := getUserFromContext(r)
+	target, err := app.store.Users.GetByID(r.Context(), userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if target != nil && (target.Role.Name == store.RoleAdmin || target.Role.Name == store.RoleModerator) && target.Role.Level >= moderator.Role.Level {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Users.SetMuted(r.Context(), userID, muted); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	action := "mute_user"
+	message := "User muted successfully"
+	if !muted {
+		action = "unmute_user"
+		message = "User unmuted successfully"
+	}
+	app.logAdminAction(moderator, action, "user", userID, "")
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": message}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestReportAndResolveComplaint(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Realty", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Too good to be true", DealType: "rent", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	reporter := &store.User{Username: "reporter", Email: "reporter@example.com", IsActive: true}
+	moderator := &store.User{Username: "mod", Email: "mod@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	for _, u := range []*store.User{reporter, moderator} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/listings/{listingID}/report", handle(app, http.StatusCreated, app.reportListingHandler))
+	mux.Post("/v1/moderation/complaints/{complaintID}/remove", app.removeReportedContentHandler)
+	mux.Post("/v1/moderation/complaints/{complaintID}/dismiss", app.dismissComplaintHandler)
+
+	body, _ := json.Marshal(ReportListingPayload{Type: "fraud", Description: "asks for a deposit by wire"})
+	req, _ := http.NewRequest(http.MethodPost, "/v1/listings/"+strconv.FormatInt(listing.ID, 10)+"/report", bytes.NewReader(body))
+	rr := executeRequest(req.WithContext(reqctx.WithUser(req.Context(), reporter)), mux)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var complaint struct{ Data store.Complaint }
+	if err := json.Unmarshal(rr.Body.Bytes(), &complaint); err != nil {
+		t.Fatal(err)
+	}
+	path := "/v1/moderation/complaints/" + strconv.FormatInt(complaint.Data.ID, 10)
+
+	// two moderators act on the complaint at once; only one of them does
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPost, path+"/remove", nil)
+			codes[i] = executeRequest(req.WithContext(reqctx.WithUser(req.Context(), moderator)), mux).Code
+		}(i)
+	}
+	wg.Wait()
+	if !(codes[0] == http.StatusOK && codes[1] == http.StatusConflict) && !(codes[0] == http.StatusConflict && codes[1] == http.StatusOK) {
+		t.Errorf("concurrent resolutions answered %v", codes)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, path+"/dismiss", nil)
+	rr = executeRequest(req.WithContext(reqctx.WithUser(req.Context(), moderator)), mux)
+	checkResponseCode(t, http.StatusConflict, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/v1/moderation/complaints/999/dismiss", nil)
+	rr = executeRequest(req.WithContext(reqctx.WithUser(req.Context(), moderator)), mux)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	if got, _ := app.store.Complaints.GetByID(ctx, complaint.Data.ID); got.Status != store.ComplaintStatusClosed || got.Resolution != store.ComplaintResolutionRemoved {
+		t.Errorf("complaint = %+v", got)
+	}
+	if got, _ := app.store.Listings.GetByID(ctx, listing.ID); got == nil || got.Status != store.ListingStatusArchived {
+		t.Errorf("reported listing = %+v", got)
+	}
+	if emails, _ := app.store.Outbox.ClaimPending(ctx, 10, time.Minute); len(emails) != 1 {
+		t.Errorf("the reporter got %d emails", len(emails))
+	}
+}
+
+// failingListings fails every status change, like a database that went
+// away between closing a complaint and archiving its target.
+type failingListings struct {
+	store.MockListingStore
+}
+
+func (*failingListings) UpdateStatus(ctx context.Context, id int64, status string) error {
+	return errors.New("connection reset")
+}
+
+func TestResolveComplaintTargetFails(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Realty", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(ctx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{CompanyID: company.ID, Title: "Too good to be true", DealType: "rent", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	moderator := &store.User{Username: "mod", Email: "mod@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	if err := app.store.Users.Create(ctx, nil, moderator); err != nil {
+		t.Fatal(err)
+	}
+	complaint := &store.Complaint{Type: "fraud", TargetType: "listing", TargetID: listing.ID, UserID: moderator.ID}
+	if err := app.store.Complaints.Create(ctx, complaint); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Post("/v1/moderation/complaints/{complaintID}/remove", app.removeReportedContentHandler)
+	remove := func() int {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/moderation/complaints/"+strconv.FormatInt(complaint.ID, 10)+"/remove", nil)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), moderator)), mux).Code
+	}
+
+	listings := app.store.Listings
+	app.store.Listings = &failingListings{}
+	checkResponseCode(t, http.StatusInternalServerError, remove())
+	if got, _ := app.store.Complaints.GetByID(ctx, complaint.ID); got.Status != store.ComplaintStatusNew || got.Resolution != "" || got.ResolvedBy != nil {
+		t.Errorf("complaint after a failed removal = %+v", got)
+	}
+
+	app.store.Listings = listings
+	checkResponseCode(t, http.StatusOK, remove())
+	if got, _ := app.store.Listings.GetByID(ctx, listing.ID); got == nil || got.Status != store.ListingStatusArchived {
+		t.Errorf("reported listing = %+v", got)
+	}
+}
+
+func TestComplaintTenants(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	acme := &store.Tenant{Slug: "acme", Name: "Acme"}
+	if err := app.store.Tenants.Create(ctx, acme); err != nil {
+		t.Fatal(err)
+	}
+	listing := &store.Listing{Title: "Loft", DealType: "rent", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(store.WithTenant(ctx, acme.ID), listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	moderator := &store.User{Username: "mod", Email: "mod@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	if err := app.store.Users.Create(ctx, nil, moderator); err != nil {
+		t.Fatal(err)
+	}
+	complaint := &store.Complaint{Type: "fraud", TargetType: "listing", TargetID: listing.ID, UserID: moderator.ID}
+	if err := app.store.Complaints.Create(ctx, complaint); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/moderation/complaints", app.adminListComplaintsHandler)
+	mux.Post("/v1/moderation/complaints/{complaintID}/remove", app.removeReportedContentHandler)
+	serve := func(method, path string, tenantID int64) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		return executeRequest(req.WithContext(reqctx.WithTenant(reqctx.WithUser(req.Context(), moderator), tenantID)), mux)
+	}
+
+	// a moderator of the default tenant neither sees nor resolves it
+	rr := serve(http.MethodGet, "/v1/moderation/complaints", store.DefaultTenantID)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	if strings.Contains(rr.Body.String(), "Loft") {
+		t.Errorf("the default tenant lists %s", rr.Body)
+	}
+	path := "/v1/moderation/complaints/" + strconv.FormatInt(complaint.ID, 10) + "/remove"
+	checkResponseCode(t, http.StatusNotFound, serve(http.MethodPost, path, store.DefaultTenantID).Code)
+	if got, _ := app.store.Complaints.GetByID(ctx, complaint.ID); got.Status != store.ComplaintStatusNew {
+		t.Errorf("complaint = %+v", got)
+	}
+	if got, _ := app.store.Listings.GetByID(ctx, listing.ID); got.Status != store.ListingStatusActive {
+		t.Errorf("listing of another tenant = %+v", got)
+	}
+
+	rr = serve(http.MethodGet, "/v1/moderation/complaints", acme.ID)
+	if !strings.Contains(rr.Body.String(), "Loft") {
+		t.Errorf("acme lists %s", rr.Body)
+	}
+	checkResponseCode(t, http.StatusOK, serve(http.MethodPost, path, acme.ID).Code)
+}
+
+func TestMuteStaff(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	user := &store.User{Username: "user", Email: "user@example.com", IsActive: true}
+	moderator := &store.User{Username: "mod", Email: "mod@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	other := &store.User{Username: "mod2", Email: "mod2@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	admin := &store.User{Username: "admin", Email: "admin@example.com", IsActive: true, Role: store.Role{Name: store.RoleAdmin}}
+	for _, u := range []*store.User{user, moderator, other, admin} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Put("/v1/moderation/users/{userID}/mute", app.muteUserHandler)
+	mute := func(by, target *store.User) int {
+		req, _ := http.NewRequest(http.MethodPut, "/v1/moderation/users/"+strconv.FormatInt(target.ID, 10)+"/mute", nil)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), by)), mux).Code
+	}
+
+	checkResponseCode(t, http.StatusOK, mute(moderator, user))
+	checkResponseCode(t, http.StatusForbidden, mute(moderator, other))
+	checkResponseCode(t, http.StatusForbidden, mute(moderator, admin))
+	checkResponseCode(t, http.StatusOK, mute(admin, moderator))
+}
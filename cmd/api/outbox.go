@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxLease       = 5 * time.Minute
+	outboxMaxAttempts = 8
+)
+
+// runOutboxRelay delivers queued emails until ctx is cancelled. Failed sends
+// are retried with exponential backoff and abandoned after outboxMaxAttempts.
+func (app *application) runOutboxRelay(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.relayOutbox(ctx)
+		}
+	}
+}
+
+func (app *application) relayOutbox(ctx context.Context) {
+	emails, err := app.store.Outbox.ClaimPending(ctx, outboxBatchSize, outboxLease)
+	if err != nil {
+		app.logger.Errorw("could not claim outbox emails", "error", err)
+		return
+	}
+	outboxLastRun.Set(time.Now().Unix())
+
+	for _, email := range emails {
+		app.deliverOutboxEmail(ctx, email)
+	}
+}
+
+// deliverOutboxEmail sends one claimed email and records the outcome. Each
+// delivery is its own trace, so the queries and the send group together.
+func (app *application) deliverOutboxEmail(ctx context.Context, email store.OutboxEmail) {
+	ctx, span := tracing.Start(ctx, "outbox.deliver", tracing.KindInternal,
+		tracing.Int("outbox.id", int(email.ID)),
+		tracing.String("mail.template", email.Template),
+	)
+	defer span.End()
+
+	var data map[string]any
+	var result mailer.SendResult
+	err := json.Unmarshal(email.Data, &data)
+	if err == nil && app.config.mail.lint {
+		app.lintOutboxEmail(ctx, email, data)
+	}
+	tracked := false
+	if err == nil {
+		var sendCtx context.Context
+		sendCtx, tracked = app.trackEmail(ctx, email)
+		result, err = app.mailer.Send(sendCtx, email.Template, email.Username, email.Email, data, app.config.env != "production")
+	}
+	span.RecordError(err)
+
+	if err == nil {
+		app.mailFailures.Store(0)
+		outboxDeliveries.Add("sent", 1)
+		app.logger.Infow("outbox email sent", "id", email.ID, "template", email.Template, "triggered_by", email.TriggeredBy.String(),
+			"provider", result.Provider, "message_id", result.MessageID)
+		if err := app.store.Outbox.MarkSent(ctx, email.ID); err != nil {
+			app.logger.Errorw("could not mark outbox email sent", "id", email.ID, "error", err)
+		}
+		app.recordSentEmail(ctx, email, result)
+		if tracked {
+			app.recordTrackingEvent(ctx, store.TrackingEventSent, trackingClaims{OutboxID: email.ID, Template: email.Template})
+		}
+		app.publish(ctx, events.EmailSent, nil, emailSentEvent{ID: email.ID, Template: email.Template, TriggeredBy: email.TriggeredBy.String()})
+		return
+	}
+
+	if errors.Is(err, mailer.ErrSuppressed) {
+		outboxDeliveries.Add("suppressed", 1)
+		app.logger.Infow("outbox email suppressed", "id", email.ID, "template", email.Template, "triggered_by", email.TriggeredBy.String())
+		if err := app.store.Outbox.MarkFailed(ctx, email.ID, err.Error(), nil); err != nil {
+			app.logger.Errorw("could not mark outbox email failed", "id", email.ID, "error", err)
+		}
+		return
+	}
+
+	app.mailFailures.Add(1)
+	attempts := email.Attempts + 1
+	if attempts >= outboxMaxAttempts {
+		outboxDeliveries.Add("dead", 1)
+		app.logger.Errorw("outbox email failed, giving up", "id", email.ID, "triggered_by", email.TriggeredBy.String(), "attempts", attempts, "error", err)
+		app.deadLetterEmail(ctx, email, data, err)
+		return
+	}
+
+	next := time.Now().Add(outboxBackoff(attempts))
+	outboxDeliveries.Add("retry", 1)
+	app.logger.Warnw("outbox email failed, will retry", "id", email.ID, "triggered_by", email.TriggeredBy.String(), "attempts", attempts, "error", err)
+	if err := app.store.Outbox.MarkFailed(ctx, email.ID, err.Error(), &next); err != nil {
+		app.logger.Errorw("could not mark outbox email failed", "id", email.ID, "error", err)
+	}
+}
+
+// deadLetterEmail moves an email that failed every attempt to the dead
+// letters, with the message rendered as it would have been sent so admins
+// can see what the user missed. If the move fails the email is only marked
+// given up on, so it still stops being retried.
+func (app *application) deadLetterEmail(ctx context.Context, email store.OutboxEmail, data map[string]any, sendErr error) {
+	var subject, body string
+	if data != nil {
+		var err error
+		if subject, body, err = mailer.Render(email.Template, data); err != nil {
+			app.logger.Warnw("could not render dead-lettered email", "id", email.ID, "template", email.Template, "error", err)
+		}
+	}
+
+	if err := app.store.Outbox.DeadLetter(ctx, email.ID, sendErr.Error(), subject, body); err != nil {
+		app.logger.Errorw("could not dead-letter outbox email", "id", email.ID, "error", err)
+		if err := app.store.Outbox.MarkFailed(ctx, email.ID, sendErr.Error(), nil); err != nil {
+			app.logger.Errorw("could not mark outbox email failed", "id", email.ID, "error", err)
+		}
+	}
+}
+
+// recordSentEmail keeps the provider's answer for support. The email went
+// out either way, so a failure is only logged.
+func (app *application) recordSentEmail(ctx context.Context, email store.OutboxEmail, result mailer.SendResult) {
+	sent := &store.SentEmail{
+		OutboxID:  &email.ID,
+		Template:  email.Template,
+		Username:  email.Username,
+		Email:     email.Email,
+		Provider:  result.Provider,
+		MessageID: result.MessageID,
+		Accepted:  result.Accepted,
+	}
+	if err := app.store.SentEmails.Create(ctx, sent); err != nil {
+		app.logger.Errorw("could not record sent email", "outbox_id", email.ID, "message_id", result.MessageID, "error", err)
+	}
+}
+
+// lintOutboxEmail logs and records deliverability warnings for email. It
+// never stops the email from being sent.
+func (app *application) lintOutboxEmail(ctx context.Context, email store.OutboxEmail, data map[string]any) {
+	warnings, err := mailer.Lint(email.Template, data)
+	if err != nil || len(warnings) == 0 {
+		return
+	}
+
+	messages := make([]string, len(warnings))
+	for i, warning := range warnings {
+		messages[i] = warning.String()
+	}
+	app.logger.Warnw("outbox email lint", "id", email.ID, "template", email.Template, "warnings", messages)
+
+	if err := app.store.Outbox.SetLintWarnings(ctx, email.ID, messages); err != nil {
+		app.logger.Errorw("could not record outbox email lint", "id", email.ID, "error", err)
+	}
+}
+
+// outboxBackoff doubles from 30s per attempt, capped at an hour.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second << (attempts - 1)
+	if backoff > time.Hour || backoff <= 0 {
+		return time.Hour
+	}
+	return backoff
+}
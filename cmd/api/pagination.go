@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/pagination"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// listPage bounds the offset lists; it matches the old PaginatedQuery limits.
+var listPage = pagination.Options{DefaultLimit: 20, MaxLimit: 20}
+
+// paged is returned by typed handlers for list endpoints. handle writes the
+// items as data, adds the meta block and sets the Link header.
+type paged[T any] struct {
+	items []T
+	page  pagination.Page
+}
+
+func (p paged[T]) pageItems() any            { return p.items }
+func (p paged[T]) pageInfo() pagination.Page { return p.page }
+
+type pagedResponse interface {
+	pageItems() any
+	pageInfo() pagination.Page
+}
+
+// newPage wraps the items of a page whose total is unknown.
+func newPage[T any](params pagination.Params, items []T) paged[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return paged[T]{items: items, page: pagination.Page{Params: params, Count: len(items), Total: -1}}
+}
+
+// parsePage reads the page parameters and turns bad ones into a 400.
+func parsePage(r *http.Request, opts pagination.Options) (pagination.Params, error) {
+	params, err := pagination.Parse(r, opts)
+	var pageErr *pagination.Error
+	if errors.As(err, &pageErr) {
+		return params, newHTTPError(http.StatusBadRequest, pageErr.Error())
+	}
+	return params, err
+}
+
+// paginationConfig covers the move from raw offsets and IDs to signed
+// cursors.
+type paginationConfig struct {
+	// legacyParams still accepts offset on the listing feed and bare message
+	// IDs as cursors, until clients have moved to next_cursor
+	legacyParams bool
+}
+
+// legacyPageParams counts requests paged with offsets or unsigned cursors;
+// published through expvar as legacy_page_params.
+var legacyPageParams = new(expvar.Int)
+
+// signCursor returns next_cursor for the sort keys of a page's last item.
+// Cursors are signed with the auth token secret.
+func (app *application) signCursor(scope string, keys ...string) string {
+	return pagination.NewSigner([]byte(app.config.auth.token.secret)).Sign(scope, keys...)
+}
+
+// cursorKeys returns the sort keys of a cursor signCursor made for scope.
+// While legacy parameters are accepted a bare number passes as the only key.
+func (app *application) cursorKeys(scope, cursor string) ([]string, error) {
+	if app.config.pagination.legacyParams {
+		if _, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+			legacyPageParams.Add(1)
+			return []string{cursor}, nil
+		}
+	}
+
+	keys, err := pagination.NewSigner([]byte(app.config.auth.token.secret)).Verify(scope, cursor)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return keys, nil
+}
+
+// storeQuery converts offset page parameters for the store's list methods.
+func storeQuery(params pagination.Params) store.PaginatedQuery {
+	return store.PaginatedQuery{Limit: params.Limit, Offset: params.Offset}
+}
+
+// jsonPageResponse writes data with the page's meta block and Link header.
+func (app *application) jsonPageResponse(w http.ResponseWriter, r *http.Request, status int, data any, page pagination.Page) error {
+	type envelope struct {
+		Data any             `json:"data"`
+		Meta pagination.Meta `json:"meta"`
+	}
+
+	if links := page.Links(r.URL); links != "" {
+		// Add keeps the deprecation link of a v1 route
+		w.Header().Add("Link", links)
+	}
+
+	if hasMetaEnvelope(w) {
+		type envelope struct {
+			Data any         `json:"data"`
+			Meta versionMeta `json:"meta"`
+		}
+
+		meta := page.Meta()
+		return writeJSON(w, status, &envelope{Data: data, Meta: versionMeta{APIVersion: w.Header().Get(apiVersionHeader), Meta: &meta}})
+	}
+	return writeJSON(w, status, &envelope{Data: data, Meta: page.Meta()})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/auth"
+)
+
+const passwordBreachedHeader = "X-Password-Breached"
+
+var errPasswordBreached = errors.New("this password has appeared in a data breach, please choose a different one")
+
+// getPasswordPolicyHandler godoc
+//
+//	@Summary		Password policy
+//	@Description	Returns the rules new passwords must satisfy so clients can show them before submitting
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.PasswordPolicy
+//	@Router			/authentication/password-policy [get]
+func (app *application) getPasswordPolicyHandler(r *http.Request, _ *noBody) (auth.PasswordPolicy, error) {
+	return passwordPolicy, nil
+}
+
+// checkPasswordBreach looks the password up with the breach checker, if one is
+// configured. It writes the error response itself and returns false when the
+// request must stop. In warn-only mode a breached password is accepted and
+// flagged with the X-Password-Breached header.
+func (app *application) checkPasswordBreach(w http.ResponseWriter, r *http.Request, password string) bool {
+	if app.breachChecker == nil {
+		return true
+	}
+
+	cfg := app.config.auth.breachCheck
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.timeout)
+	defer cancel()
+
+	breached, err := app.breachChecker.IsBreached(ctx, password)
+	if err != nil {
+		if cfg.failOpen {
+			app.logger.Warnw("password breach check failed, allowing password", "error", err)
+			return true
+		}
+		app.logger.Errorw("password breach check failed", "error", err)
+		app.serviceUnavailableResponse(w, r, "could not verify password, please try again later")
+		return false
+	}
+
+	if !breached {
+		return true
+	}
+
+	if cfg.warnOnly {
+		w.Header().Set(passwordBreachedHeader, "true")
+		return true
+	}
+
+	app.badRequestResponse(w, r, errPasswordBreached)
+	return false
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/db"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+)
+
+const preflightTimeout = 10 * time.Second
+
+// errPreflightSkip marks a check that does not apply to the current configuration.
+var errPreflightSkip = errors.New("skipped")
+
+type preflightCheck struct {
+	name string
+	// local checks need no connection and run with --validate-config
+	local bool
+	run   func(ctx context.Context) error
+}
+
+type preflightOptions struct {
+	// offline runs only the local checks, for CI without the services
+	offline bool
+	// latestSchema fails unless every embedded migration was applied,
+	// rather than accepting any supported schema version
+	latestSchema bool
+}
+
+// runPreflight validates the configuration and every external dependency the
+// API needs, writes a pass/fail report to w and returns the process exit code.
+// --preflight, --check and --validate-config differ only in opts.
+func runPreflight(cfg config, w io.Writer, opts preflightOptions) int {
+	var conn *sql.DB
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	checks := []preflightCheck{
+		{"config", true, func(ctx context.Context) error {
+			return validateConfig(cfg)
+		}},
+		{"jwt", true, func(ctx context.Context) error {
+			return checkJWT(cfg)
+		}},
+		{"database", false, func(ctx context.Context) error {
+			if cfg.db.backend == "memory" {
+				return fmt.Errorf("%w: STORE_BACKEND=memory", errPreflightSkip)
+			}
+			var err error
+			conn, err = db.New(cfg.db.addr, cfg.db.maxOpenConns, cfg.db.maxIdleConns, cfg.db.maxIdleTime, cfg.db.maxLifetime)
+			return err
+		}},
+		{"replicas", false, func(ctx context.Context) error {
+			if len(cfg.db.replicas()) == 0 {
+				return fmt.Errorf("%w: DB_REPLICA_ADDRS not set", errPreflightSkip)
+			}
+			conns, err := openReplicas(cfg.db)
+			if err != nil {
+				return err
+			}
+			reads := store.NewQueryerChooser(nil, conns, cfg.db.replicaMaxLag)
+			reads.CheckLag(ctx)
+			for _, conn := range conns {
+				conn.Close()
+			}
+			for i, status := range reads.Status() {
+				if !status.Healthy {
+					return fmt.Errorf("replica %d unreachable or more than %s behind (lag %dms)", i+1, cfg.db.replicaMaxLag, status.LagMs)
+				}
+			}
+			return nil
+		}},
+		{"schema", false, func(ctx context.Context) error {
+			if conn == nil {
+				return fmt.Errorf("%w: database unavailable", errPreflightSkip)
+			}
+			version, err := checkSchemaVersion(ctx, conn)
+			if err != nil {
+				return err
+			}
+			_, latest, _ := supportedSchemaRange()
+			if pending := latest - version; pending > 0 {
+				if opts.latestSchema {
+					return fmt.Errorf("%d migrations pending: database at version %d, latest is %d", pending, version, latest)
+				}
+				fmt.Fprintf(w, "      schema version %d, %d migrations pending\n", version, pending)
+				return nil
+			}
+			fmt.Fprintf(w, "      schema version %d\n", version)
+			return nil
+		}},
+		{"redis", false, func(ctx context.Context) error {
+			if !cfg.redisCfg.enabled {
+				return fmt.Errorf("%w: REDIS_ENABLED=false", errPreflightSkip)
+			}
+			rdb, err := cache.NewRedisClient(cfg.redisCfg.options())
+			if err != nil {
+				return err
+			}
+			defer rdb.Close()
+			return rdb.Ping(ctx).Err()
+		}},
+		{"smtp", false, func(ctx context.Context) error {
+			if cfg.mail.smtp.host == "" {
+				return fmt.Errorf("%w: SMTP_HOST not set", errPreflightSkip)
+			}
+			smtpCfg, err := cfg.mail.smtpConfig()
+			if err != nil {
+				return err
+			}
+			if cfg.mail.smtp.failoverHosts != "" {
+				servers, err := cfg.mail.smtpFailover(smtpCfg)
+				if err != nil {
+					return err
+				}
+				return servers.Ping(ctx)
+			}
+			client, err := mailer.NewSMTPClient(smtpCfg)
+			if err != nil {
+				return err
+			}
+			return client.Ping(ctx)
+		}},
+		{"templates", true, func(ctx context.Context) error {
+			if cfg.mail.templateDir != "" {
+				return mailer.LoadTemplateDir(cfg.mail.templateDir)
+			}
+			return mailer.CheckTemplates()
+		}},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		if opts.offline && !check.local {
+			fmt.Fprintf(w, "SKIP  %s: offline\n", check.name)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		start := time.Now()
+		err := check.run(ctx)
+		took := time.Since(start).Round(time.Millisecond)
+		cancel()
+
+		switch {
+		case err == nil:
+			fmt.Fprintf(w, "PASS  %s (%s)\n", check.name, took)
+		case errors.Is(err, errPreflightSkip):
+			fmt.Fprintf(w, "SKIP  %s: %v\n", check.name, err)
+		default:
+			failed++
+			fmt.Fprintf(w, "FAIL  %s (%s): %v\n", check.name, took, err)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "\npreflight failed: %d of %d checks failed\n", failed, len(checks))
+		return 1
+	}
+
+	fmt.Fprintf(w, "\npreflight passed\n")
+	return 0
+}
+
+// validateConfig checks settings that would otherwise only fail at runtime.
+func validateConfig(cfg config) error {
+	var problems []string
+
+	if _, err := crypto.NewServiceFromBase64Key(cfg.cryptoKey); err != nil {
+		problems = append(problems, "ENCRYPTION_KEY must be a base64-encoded 32 byte key")
+	}
+
+	if _, err := time.ParseDuration(cfg.db.maxIdleTime); err != nil {
+		problems = append(problems, "DB_MAX_IDLE_TIME is not a valid duration")
+	}
+
+	if _, err := time.ParseDuration(cfg.db.maxLifetime); err != nil {
+		problems = append(problems, "DB_MAX_LIFETIME is not a valid duration")
+	}
+
+	if cfg.db.maxOpenConns > 0 && cfg.db.maxIdleConns > cfg.db.maxOpenConns {
+		problems = append(problems, "DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	}
+
+	if cfg.db.backend != "postgres" && cfg.db.backend != "memory" {
+		problems = append(problems, "STORE_BACKEND must be postgres or memory")
+	} else if cfg.db.backend == "memory" && cfg.env == "production" {
+		problems = append(problems, "STORE_BACKEND=memory cannot be used in production")
+	}
+
+	if cfg.db.queryTimeout <= 0 {
+		problems = append(problems, "DB_QUERY_TIMEOUT must be positive")
+	}
+
+	if len(cfg.db.replicas()) > 0 && (cfg.db.replicaMaxLag <= 0 || cfg.db.replicaCheckInterval <= 0) {
+		problems = append(problems, "DB_REPLICA_MAX_LAG and DB_REPLICA_CHECK_INTERVAL must be positive")
+	}
+
+	if cfg.auth.password.MinLength < 1 || cfg.auth.password.MinLength > 72 {
+		problems = append(problems, "PASSWORD_MIN_LENGTH must be between 1 and 72")
+	}
+
+	if _, err := parseRouteMiddleware(cfg.routeMiddleware); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := parseRateLimitPolicies(cfg.rateLimitPolicies); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := parseRouteTimeouts(cfg.routeTimeouts); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.tenancy.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.federation.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.push.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.wordFilter.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.limits.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.linkTokens.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.httpCache.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := cfg.jobs.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := parseActivationLinks(cfg.auth.activationLinks, cfg.auth.activationSchemes); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := cfg.log.build(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if cfg.redisCfg.enabled {
+		switch cfg.redisCfg.mode {
+		case cache.RedisModeStandalone, cache.RedisModeCluster:
+		case cache.RedisModeSentinel:
+			if cfg.redisCfg.masterName == "" {
+				problems = append(problems, "REDIS_MASTER_NAME is required for REDIS_MODE=sentinel")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("invalid REDIS_MODE %q", cfg.redisCfg.mode))
+		}
+	}
+
+	switch cfg.storage.provider {
+	case "", "local":
+	case "s3":
+		if cfg.storage.bucket == "" || cfg.storage.region == "" {
+			problems = append(problems, "STORAGE_BUCKET and STORAGE_REGION are required for s3")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("invalid STORAGE_PROVIDER %q", cfg.storage.provider))
+	}
+
+	if cfg.auth.botCheck.provider != "" {
+		if _, err := newBotCheck(cfg.auth.botCheck); err != nil {
+			problems = append(problems, "BOT_CHECK: "+err.Error())
+		}
+	}
+
+	if _, ok := mailer.SMTPPreset(cfg.mail.smtp.preset); !ok {
+		problems = append(problems, fmt.Sprintf("invalid SMTP_PRESET %q", cfg.mail.smtp.preset))
+	}
+
+	if cfg.env == "production" {
+		if cfg.mail.smtp.preset != "" {
+			problems = append(problems, "SMTP_PRESET is for local mail capture and must not be set in production")
+		}
+		if cfg.mail.mailTrap.apiKey == "" && cfg.mail.sendGrid.apiKey == "" && cfg.mail.smtp.host == "" {
+			problems = append(problems, "MAILTRAP_API_KEY, SENDGRID_API_KEY, or SMTP_HOST is required in production")
+		}
+		if cfg.mail.fromEmail == "" {
+			problems = append(problems, "FROM_EMAIL is required in production")
+		}
+		if cfg.auth.basic.user == "admin" && cfg.auth.basic.pass == "admin" {
+			problems = append(problems, "AUTH_BASIC_USER/AUTH_BASIC_PASS must not use the defaults in production")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// checkJWT makes sure the signing secret is usable and round-trips a token.
+func checkJWT(cfg config) error {
+	secret := cfg.auth.token.secret
+	if secret == "" {
+		return errors.New("AUTH_TOKEN_SECRET is empty")
+	}
+	if cfg.env == "production" && (secret == "example" || len(secret) < 32) {
+		return errors.New("AUTH_TOKEN_SECRET must be at least 32 characters and not the default in production")
+	}
+
+	if err := cfg.auth.token.validate(); err != nil {
+		return err
+	}
+
+	authenticator, err := newAuthenticator(cfg.auth.token)
+	if err != nil {
+		return err
+	}
+	token, err := authenticator.GenerateToken(cfg.auth.token.tokenClaims(&store.User{}, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	_, err = authenticator.ValidateToken(token)
+	return err
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreflightOffline(t *testing.T) {
+	var report strings.Builder
+	code := runPreflight(config{db: dbConfig{backend: "postgres", addr: "postgres://unreachable.invalid/db"}}, &report, preflightOptions{offline: true})
+	if code != 1 {
+		t.Errorf("exit code %d with an empty config", code)
+	}
+
+	out := report.String()
+	for _, want := range []string{"FAIL  config (", "ENCRYPTION_KEY", "FAIL  jwt (", "PASS  templates (", "SKIP  database: offline", "SKIP  smtp: offline", "preflight failed: 2 of 8 checks failed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report has no %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// hiddenBy reports whether owner's profile is hidden from the current user,
+// who then gets 404: owner has blocked them, or the profile is private and
+// they share no conversation. Owners and staff always see a private profile,
+// but not one whose owner blocked them.
+func (app *application) hiddenBy(r *http.Request, owner *store.User) (bool, error) {
+	viewer := getUserFromContext(r)
+	switch {
+	case viewer == nil:
+		return owner.Private, nil
+	case viewer.ID == owner.ID:
+		return false, nil
+	}
+
+	blocked, err := app.store.Blocks.Blocked(r.Context(), owner.ID, viewer.ID)
+	if err != nil || blocked || !owner.Private {
+		return blocked, err
+	}
+	if viewer.Role.Name == store.RoleAdmin || viewer.Role.Name == store.RoleModerator {
+		return false, nil
+	}
+
+	known, err := app.store.Conversations.Exists(r.Context(), owner.ID, viewer.ID)
+	return !known, err
+}
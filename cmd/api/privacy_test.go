@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPrivateProfile(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	owner := &store.User{Username: "carol", Email: "carol@example.com", IsActive: true}
+	stranger := &store.User{Username: "dave", Email: "dave@example.com", IsActive: true}
+	moderator := &store.User{Username: "mod", Email: "mod@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	for _, u := range []*store.User{owner, stranger, moderator} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.store.Users.SetPrivate(ctx, owner.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/users/{userID}", app.getUserHandler)
+	mux.Post("/v1/conversations", handle(app, http.StatusOK, app.startConversationHandler))
+	path := "/v1/users/" + strconv.FormatInt(owner.ID, 10)
+
+	get := func(viewer *store.User, want int) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(reqctx.WithUser(req.Context(), viewer))
+		checkResponseCode(t, want, executeRequest(req, mux).Code)
+	}
+
+	get(owner, http.StatusOK)
+	get(moderator, http.StatusOK)
+	get(stranger, http.StatusNotFound)
+
+	start := func(user, other *store.User, want int) {
+		t.Helper()
+		body := strings.NewReader(`{"user_id": ` + strconv.FormatInt(other.ID, 10) + `}`)
+		req, _ := http.NewRequest(http.MethodPost, "/v1/conversations", body)
+		req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		checkResponseCode(t, want, executeRequest(req, mux).Code)
+	}
+	start(stranger, owner, http.StatusNotFound)
+	start(owner, stranger, http.StatusOK)
+	get(stranger, http.StatusOK)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/push"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"github.com/go-chi/chi/v5"
+)
+
+// Users register the phones and browsers they want notifications on, and
+// mentions, new direct messages and resolved complaints are queued for each
+// of their devices next to the email. The relay sends them through FCM,
+// APNs or Web Push and retries like the webhook relay. A device the push
+// service no longer knows is dropped at once, and one whose deliveries keep
+// failing after pushMaxDeviceFailures.
+const (
+	pushBatchSize   = 50
+	pushLease       = 5 * time.Minute
+	pushMaxAttempts = outboxMaxAttempts
+	// pushMaxDeviceFailures is how many deliveries in a row a device may
+	// give up on before it is pruned
+	pushMaxDeviceFailures = 3
+)
+
+var errPushDisabled = newHTTPError(http.StatusNotFound, "push notifications are not enabled")
+
+type pushConfig struct {
+	// interval is how often the relay polls for queued deliveries, 0 stops it
+	interval time.Duration
+	// timeout bounds a single delivery attempt
+	timeout time.Duration
+	// allowPrivate lets Web Push endpoints be loopback and private
+	// addresses, for development only
+	allowPrivate bool
+	// fcmCredentials is the JSON key of a service account with the
+	// Firebase Messaging role; empty turns FCM off
+	fcmCredentials string
+	// apnsKey is the .p8 token key in PEM, with line breaks written as \n
+	// in env files; empty turns APNs off
+	apnsKey     string
+	apnsKeyID   string
+	apnsTeamID  string
+	apnsTopic   string
+	apnsSandbox bool
+	// vapidPrivateKey is the Web Push key in unpadded base64url; empty
+	// turns Web Push off
+	vapidPrivateKey string
+	vapidSubject    string
+}
+
+func (c pushConfig) validate() error {
+	_, err := newPusher(c, http.DefaultClient)
+	return err
+}
+
+// pusher is what app.pusher holds while at least one platform is
+// configured.
+type pusher struct {
+	*push.Dispatcher
+	// vapidKey is the Web Push applicationServerKey, empty without Web Push
+	vapidKey string
+}
+
+// newPusher returns nil when no platform is configured.
+func newPusher(cfg pushConfig, client *http.Client) (*pusher, error) {
+	p := &pusher{Dispatcher: push.NewDispatcher()}
+
+	if cfg.fcmCredentials != "" {
+		fcm, err := push.NewFCM(client, []byte(cfg.fcmCredentials))
+		if err != nil {
+			return nil, fmt.Errorf("PUSH_FCM_CREDENTIALS: %w", err)
+		}
+		p.Register(push.PlatformFCM, fcm)
+	}
+
+	if cfg.apnsKey != "" {
+		apns, err := push.NewAPNs(client, push.APNsConfig{
+			Key:     strings.ReplaceAll(cfg.apnsKey, `\n`, "\n"),
+			KeyID:   cfg.apnsKeyID,
+			TeamID:  cfg.apnsTeamID,
+			Topic:   cfg.apnsTopic,
+			Sandbox: cfg.apnsSandbox,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("PUSH_APNS_KEY: %w", err)
+		}
+		p.Register(push.PlatformAPNs, apns)
+	}
+
+	if cfg.vapidPrivateKey != "" {
+		webPush, err := push.NewWebPush(client, push.WebPushConfig{PrivateKey: cfg.vapidPrivateKey, Subject: cfg.vapidSubject})
+		if err != nil {
+			return nil, fmt.Errorf("PUSH_VAPID_PRIVATE_KEY: %w", err)
+		}
+		p.Register(push.PlatformWebPush, webPush)
+		p.vapidKey = webPush.PublicKey()
+	}
+
+	if p.Empty() {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// newPushClient returns the client notifications go through. APNs only
+// speaks HTTP/2, so unlike the webhook client it negotiates it. Web Push
+// endpoints come from users, so unless allowPrivate is set it only
+// connects to public addresses, see refusePrivateAddress.
+func newPushClient(cfg pushConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.timeout}
+	if !cfg.allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+
+	return &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, Proxy: nil, ForceAttemptHTTP2: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type RegisterPushDevicePayload struct {
+	Platform string `json:"platform" validate:"required,oneof=fcm apns webpush"`
+	// Token is the FCM or APNs token; Web Push sends the subscription's
+	// endpoint and keys instead, as PushSubscription.toJSON() has them
+	Token    string `json:"token" validate:"max=4096"`
+	Endpoint string `json:"endpoint" validate:"max=2048"`
+	Keys     struct {
+		P256dh string `json:"p256dh" validate:"max=128"`
+		Auth   string `json:"auth" validate:"max=64"`
+	} `json:"keys"`
+}
+
+type PushConfigResponse struct {
+	Platforms []string `json:"platforms"`
+	// VAPIDPublicKey is the applicationServerKey to subscribe browsers with
+	VAPIDPublicKey string `json:"vapid_public_key,omitempty"`
+}
+
+// pushConfigHandler godoc
+//
+//	@Summary		Push notification setup
+//	@Description	The platforms devices can register for, and the key browsers subscribe to Web Push with
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	PushConfigResponse
+//	@Failure		404	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/devices/config [get]
+func (app *application) pushConfigHandler(r *http.Request, _ *noBody) (*PushConfigResponse, error) {
+	if app.pusher == nil {
+		return nil, errPushDisabled
+	}
+	resp := &PushConfigResponse{Platforms: []string{}, VAPIDPublicKey: app.pusher.vapidKey}
+	for _, platform := range []string{push.PlatformFCM, push.PlatformAPNs, push.PlatformWebPush} {
+		if app.pusher.Enabled(platform) {
+			resp.Platforms = append(resp.Platforms, platform)
+		}
+	}
+	return resp, nil
+}
+
+// listPushDevicesHandler godoc
+//
+//	@Summary		List my push devices
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{array}		store.PushDevice
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/devices [get]
+func (app *application) listPushDevicesHandler(r *http.Request, _ *noBody) ([]store.PushDevice, error) {
+	return app.store.PushDevices.List(r.Context(), getUserFromContext(r).ID)
+}
+
+// registerPushDeviceHandler godoc
+//
+//	@Summary		Register a push device
+//	@Description	Registers an FCM or APNs token, or a Web Push subscription. Registering a token again refreshes it.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RegisterPushDevicePayload	true	"Device"
+//	@Success		201		{object}	store.PushDevice
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/devices [post]
+func (app *application) registerPushDeviceHandler(r *http.Request, payload *RegisterPushDevicePayload) (*store.PushDevice, error) {
+	if app.pusher == nil {
+		return nil, errPushDisabled
+	}
+	if !app.pusher.Enabled(payload.Platform) {
+		return nil, newHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is not enabled", payload.Platform))
+	}
+
+	device := &store.PushDevice{
+		UserID:   getUserFromContext(r).ID,
+		Platform: payload.Platform,
+		Token:    strings.TrimSpace(payload.Token),
+	}
+	if payload.Platform == push.PlatformWebPush {
+		u, err := url.Parse(payload.Endpoint)
+		if err != nil || u.Host == "" || u.Scheme != "https" && (app.config.env == "production" || u.Scheme != "http") {
+			return nil, newHTTPError(http.StatusBadRequest, "endpoint must be an https URL")
+		}
+		// encrypting a test message checks the keys before anything is sent
+		if _, err := push.Encrypt(nil, payload.Keys.P256dh, payload.Keys.Auth); err != nil {
+			return nil, newHTTPError(http.StatusBadRequest, "keys must be the subscription's p256dh and auth")
+		}
+		device.Token, device.P256dh, device.Auth = u.String(), payload.Keys.P256dh, payload.Keys.Auth
+	}
+	if device.Token == "" {
+		return nil, newHTTPError(http.StatusBadRequest, "token is required")
+	}
+
+	if err := app.store.PushDevices.Register(r.Context(), device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// deletePushDeviceHandler godoc
+//
+//	@Summary		Unregister a push device
+//	@Description	Stops notifications to the device, e.g. when signing out on it
+//	@Tags			users
+//	@Param			deviceID	path	int	true	"Device ID"
+//	@Success		204
+//	@Failure		404	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/devices/{deviceID} [delete]
+func (app *application) deletePushDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "deviceID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("invalid device ID"))
+		return
+	}
+	if err := app.store.PushDevices.Delete(r.Context(), id, getUserFromContext(r).ID); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queuePush queues n for every device of the user. Nothing is queued while
+// push is off.
+func (app *application) queuePush(ctx context.Context, userID int64, n push.Notification) {
+	if app.pusher == nil {
+		return
+	}
+	body, err := json.Marshal(n)
+	if err == nil {
+		err = app.store.PushDevices.Enqueue(ctx, userID, body)
+	}
+	if err != nil {
+		app.logger.Errorw("could not queue push notification", "user_id", userID, "error", err)
+	}
+}
+
+// runPushRelay sends queued push notifications until ctx is cancelled.
+func (app *application) runPushRelay(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.relayPush(ctx)
+		}
+	}
+}
+
+func (app *application) relayPush(ctx context.Context) {
+	deliveries, err := app.store.PushDevices.ClaimPending(ctx, pushBatchSize, pushLease)
+	if err != nil {
+		app.logger.Errorw("could not claim push deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		app.deliverPush(ctx, delivery)
+	}
+}
+
+// deliverPush sends one claimed delivery and records the outcome, pruning
+// the device when the service has forgotten it or it keeps failing.
+func (app *application) deliverPush(ctx context.Context, delivery store.PushDelivery) {
+	device := delivery.Device
+	ctx, span := tracing.Start(ctx, "push.deliver", tracing.KindClient,
+		tracing.Int("push.device", int(device.ID)),
+		tracing.String("push.platform", device.Platform),
+	)
+	defer span.End()
+
+	var n push.Notification
+	err := json.Unmarshal(delivery.Notification, &n)
+	if err == nil {
+		err = app.pusher.Send(ctx, push.Device{Platform: device.Platform, Token: device.Token, P256dh: device.P256dh, Auth: device.Auth}, n)
+	}
+	span.RecordError(err)
+
+	if err == nil {
+		if err := app.store.PushDevices.MarkDelivered(ctx, delivery.ID); err != nil {
+			app.logger.Errorw("could not mark push delivered", "id", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	if errors.Is(err, push.ErrUnregistered) {
+		app.logger.Infow("pruning unregistered push device", "device", device.ID, "platform", device.Platform)
+		app.prunePushDevice(ctx, device.ID)
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	var retryAt *time.Time
+	if attempts < pushMaxAttempts {
+		next := time.Now().Add(outboxBackoff(attempts))
+		retryAt = &next
+		app.logger.Warnw("push delivery failed, will retry", "id", delivery.ID, "device", device.ID, "attempts", attempts, "error", err)
+	} else {
+		app.logger.Errorw("push delivery failed, giving up", "id", delivery.ID, "device", device.ID, "attempts", attempts, "error", err)
+		if device.Failures+1 >= pushMaxDeviceFailures {
+			app.logger.Infow("pruning failing push device", "device", device.ID, "platform", device.Platform, "failures", device.Failures+1)
+			app.prunePushDevice(ctx, device.ID)
+			return
+		}
+	}
+
+	if err := app.store.PushDevices.MarkFailed(ctx, delivery.ID, err.Error(), retryAt); err != nil {
+		app.logger.Errorw("could not mark push failed", "id", delivery.ID, "error", err)
+	}
+}
+
+func (app *application) prunePushDevice(ctx context.Context, id int64) {
+	if err := app.store.PushDevices.Prune(ctx, id); err != nil {
+		app.logger.Errorw("could not prune push device", "device", id, "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPushNotifications(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	vapid, _ := ecdh.P256().GenerateKey(rand.Reader)
+	cfg := pushConfig{
+		timeout:         5 * time.Second,
+		allowPrivate:    true,
+		vapidPrivateKey: base64.RawURLEncoding.EncodeToString(vapid.Bytes()),
+		vapidSubject:    "mailto:ops@example.com",
+	}
+	var err error
+	if app.pusher, err = newPusher(cfg, newPushClient(cfg)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a push service that knows the /ok subscription and has forgotten /gone
+	var delivered atomic.Int32
+	var status atomic.Int32
+	status.Store(http.StatusCreated)
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "aes128gcm" {
+			t.Errorf("Content-Encoding = %q", r.Header.Get("Content-Encoding"))
+		}
+		delivered.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer service.Close()
+
+	alice := &store.User{Username: "alice", Email: "alice@example.com", IsActive: true}
+	bob := &store.User{Username: "bob", Email: "bob@example.com", IsActive: true}
+	for _, u := range []*store.User{alice, bob} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/users/me/devices", handle(app, http.StatusOK, app.listPushDevicesHandler))
+	mux.Post("/v1/users/me/devices", handle(app, http.StatusCreated, app.registerPushDeviceHandler))
+	mux.Get("/v1/users/me/devices/config", handle(app, http.StatusOK, app.pushConfigHandler))
+	mux.Delete("/v1/users/me/devices/{deviceID}", app.deletePushDeviceHandler)
+	mux.Post("/v1/conversations", handle(app, http.StatusOK, app.startConversationHandler))
+	mux.Post("/v1/conversations/{conversationID}/messages", handle(app, http.StatusCreated, app.createDirectMessageHandler))
+
+	do := func(user *store.User, method, path string, body any, wantStatus int, out any) {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, wantStatus, rr.Code)
+		if out != nil {
+			if err := json.NewDecoder(rr.Body).Decode(&struct {
+				Data any `json:"data"`
+			}{out}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var pushCfg PushConfigResponse
+	do(bob, http.MethodGet, "/v1/users/me/devices/config", nil, http.StatusOK, &pushCfg)
+	if pushCfg.VAPIDPublicKey == "" || len(pushCfg.Platforms) != 1 || pushCfg.Platforms[0] != "webpush" {
+		t.Errorf("config: %+v", pushCfg)
+	}
+
+	browser, _ := ecdh.P256().GenerateKey(rand.Reader)
+	secret := make([]byte, 16)
+	rand.Read(secret)
+	subscription := func(path string) map[string]any {
+		return map[string]any{
+			"platform": "webpush",
+			"endpoint": service.URL + path,
+			"keys": map[string]string{
+				"p256dh": base64.RawURLEncoding.EncodeToString(browser.PublicKey().Bytes()),
+				"auth":   base64.RawURLEncoding.EncodeToString(secret),
+			},
+		}
+	}
+
+	do(bob, http.MethodPost, "/v1/users/me/devices", map[string]string{"platform": "fcm", "token": "abc"}, http.StatusBadRequest, nil)
+	bad := subscription("/ok")
+	bad["keys"] = map[string]string{"p256dh": "nope", "auth": "nope"}
+	do(bob, http.MethodPost, "/v1/users/me/devices", bad, http.StatusBadRequest, nil)
+
+	var ok, gone store.PushDevice
+	do(bob, http.MethodPost, "/v1/users/me/devices", subscription("/ok"), http.StatusCreated, &ok)
+	do(bob, http.MethodPost, "/v1/users/me/devices", subscription("/gone"), http.StatusCreated, &gone)
+
+	var conversation store.Conversation
+	do(alice, http.MethodPost, "/v1/conversations", map[string]int64{"user_id": bob.ID}, http.StatusOK, &conversation)
+	messages := "/v1/conversations/" + strconv.FormatInt(conversation.ID, 10) + "/messages"
+	do(alice, http.MethodPost, messages, map[string]string{"body": "is the flat still available?"}, http.StatusCreated, nil)
+
+	app.relayPush(ctx)
+	if n := delivered.Load(); n != 1 {
+		t.Errorf("expected 1 delivery, got %d", n)
+	}
+	var devices []store.PushDevice
+	do(bob, http.MethodGet, "/v1/users/me/devices", nil, http.StatusOK, &devices)
+	if len(devices) != 1 || devices[0].ID != ok.ID || devices[0].LastUsedAt == nil {
+		t.Fatalf("expected only the live device to remain, got %+v", devices)
+	}
+
+	// a device that keeps failing is pruned once it gives up enough times
+	status.Store(http.StatusInternalServerError)
+	do(alice, http.MethodPost, messages, map[string]string{"body": "hello?"}, http.StatusCreated, nil)
+	claimed, err := app.store.PushDevices.ClaimPending(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("claimed %v, %v", claimed, err)
+	}
+	claimed[0].Attempts = pushMaxAttempts - 1
+	claimed[0].Device.Failures = pushMaxDeviceFailures - 1
+	app.deliverPush(ctx, claimed[0])
+	do(bob, http.MethodGet, "/v1/users/me/devices", nil, http.StatusOK, &devices)
+	if len(devices) != 0 {
+		t.Errorf("expected the failing device to be pruned, got %+v", devices)
+	}
+
+	do(bob, http.MethodDelete, "/v1/users/me/devices/"+strconv.FormatInt(ok.ID, 10), nil, http.StatusNotFound, nil)
+
+	app.pusher = nil
+	do(bob, http.MethodPost, "/v1/users/me/devices", subscription("/ok"), http.StatusNotFound, nil)
+}
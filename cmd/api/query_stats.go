@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+type queryStatsConfig struct {
+	// slowQuery logs statements that take at least this long, 0 disables
+	slowQuery time.Duration
+	// requestQueries logs requests that run more statements than this,
+	// which is usually an N+1; 0 disables
+	requestQueries int
+}
+
+// queryBuckets are the upper bounds of the latency histogram buckets.
+var queryBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 5 * time.Second,
+}
+
+type latencyHistogram struct {
+	count  int64
+	errors int64
+	total  time.Duration
+	// buckets has one more entry than queryBuckets for slower statements
+	buckets []int64
+}
+
+// QueryLatency is the expvar form of one repository's histogram. Buckets
+// are cumulative, keyed by upper bound in milliseconds, like Prometheus.
+type QueryLatency struct {
+	Count   int64            `json:"count"`
+	Errors  int64            `json:"errors"`
+	TotalMs float64          `json:"total_ms"`
+	Buckets map[string]int64 `json:"buckets"`
+}
+
+// queryStats keeps a latency histogram per repository. It is published
+// through expvar as store_queries and resets on restart.
+type queryStats struct {
+	mu    sync.Mutex
+	repos map[string]*latencyHistogram
+}
+
+var storeQueries = &queryStats{repos: make(map[string]*latencyHistogram)}
+
+func (s *queryStats) observe(repo string, d time.Duration, failed bool) {
+	bucket := sort.Search(len(queryBuckets), func(i int) bool { return d <= queryBuckets[i] })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.repos[repo]
+	if !ok {
+		h = &latencyHistogram{buckets: make([]int64, len(queryBuckets)+1)}
+		s.repos[repo] = h
+	}
+	h.count++
+	h.total += d
+	h.buckets[bucket]++
+	if failed {
+		h.errors++
+	}
+}
+
+func (s *queryStats) snapshot() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]QueryLatency, len(s.repos))
+	for repo, h := range s.repos {
+		l := QueryLatency{
+			Count:   h.count,
+			Errors:  h.errors,
+			TotalMs: float64(h.total.Microseconds()) / 1000,
+			Buckets: make(map[string]int64, len(h.buckets)),
+		}
+		var cumulative int64
+		for i, n := range h.buckets {
+			cumulative += n
+			le := "+Inf"
+			if i < len(queryBuckets) {
+				le = strconv.FormatInt(queryBuckets[i].Milliseconds(), 10)
+			}
+			l.Buckets[le] = cumulative
+		}
+		out[repo] = l
+	}
+	return out
+}
+
+type queryCountKey struct{}
+
+// instrumentQueries sends every statement on connections opened by db.New
+// to observeQuery.
+func (app *application) instrumentQueries() {
+	db.SetObserver(app.observeQuery)
+}
+
+// observeQuery records every statement in the histograms, counts it for the
+// request it ran in and logs it when it was slow.
+func (app *application) observeQuery(ctx context.Context, q db.Query) {
+	storeQueries.observe(q.Repository(), q.Duration, q.Err != nil)
+
+	if count, ok := ctx.Value(queryCountKey{}).(*atomic.Int64); ok {
+		count.Add(1)
+	}
+
+	threshold := app.config.db.queryStats.slowQuery
+	if threshold > 0 && q.Duration >= threshold {
+		app.logger.Warnw("slow query",
+			"operation", q.Operation,
+			"duration_ms", q.Duration.Milliseconds(),
+			"statement", q.Statement,
+			"args", queryArgs(q.Args),
+		)
+	}
+}
+
+// queryArgs keeps numbers, booleans and times, which are rarely sensitive
+// and often explain a slow plan, and hides everything else: strings can
+// hold emails, tokens or hashes.
+func queryArgs(args []any) []any {
+	out := make([]any, len(args))
+	for i, arg := range args {
+		switch arg.(type) {
+		case nil, int64, float64, bool, time.Time:
+			out[i] = arg
+		default:
+			out[i] = redacted
+		}
+	}
+	return out
+}
+
+// queryCountMiddleware logs requests that ran more statements than
+// DB_REQUEST_QUERY_WARN, with the route so the handler is easy to find.
+func (app *application) queryCountMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := app.config.db.queryStats.requestQueries
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		count := new(atomic.Int64)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), queryCountKey{}, count)))
+
+		if n := count.Load(); n > int64(limit) {
+			route := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			app.logger.Warnw("many queries in one request", "method", r.Method, "route", route, "queries", n)
+		}
+	})
+}
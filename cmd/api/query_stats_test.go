@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestQueryInstrumentation(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApplication(t, config{db: dbConfig{queryStats: queryStatsConfig{slowQuery: 100 * time.Millisecond, requestQueries: 3}}})
+	app.logger = newRedactedLogger(&buf)
+
+	mux := chi.NewRouter()
+	mux.Use(app.queryCountMiddleware)
+	mux.Get("/v1/listings/{listingID}", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			app.observeQuery(r.Context(), db.Query{Operation: "ListingStore.getMedia", Duration: time.Millisecond, Args: []any{int64(i)}})
+		}
+		app.observeQuery(r.Context(), db.Query{
+			Operation: "UserStore.GetByEmail",
+			Statement: "SELECT id FROM users WHERE email_hash = $1 AND id > $2",
+			Args:      []any{"5f2e7c4b9a10", int64(7)},
+			Duration:  150 * time.Millisecond,
+		})
+	})
+
+	rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/listings/1", nil), mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	logs := buf.String()
+	for _, want := range []string{
+		`"msg":"many queries in one request"`, `"route":"/v1/listings/{listingID}"`, `"queries":5`,
+		`"msg":"slow query"`, `"operation":"UserStore.GetByEmail"`, `"args":["` + redacted + `",7]`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected %s in logs:\n%s", want, logs)
+		}
+	}
+	assertNotLogged(t, logs, "5f2e7c4b9a10")
+
+	stats := storeQueries.snapshot().(map[string]QueryLatency)
+	if l := stats["ListingStore"]; l.Count < 4 || l.Buckets["1"] < 4 || l.Buckets["+Inf"] != l.Count {
+		t.Errorf("unexpected ListingStore latency %+v", l)
+	}
+	if l := stats["UserStore"]; l.Buckets["100"] >= l.Buckets["250"] {
+		t.Errorf("slow query not in the 250ms bucket: %+v", l)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
+)
+
+// Rate limit policies add limits to some routes on top of the global
+// limiter. RATE_LIMIT_POLICIES lists them separated by ";", e.g.
+//
+//	RATE_LIMIT_POLICIES="/*@admin=exempt;POST /v1/authentication/user=5/1h/ip;POST /v1/listings=30/1h/user"
+//
+// Each entry is "[METHOD ]PATH[@ROLE,...]=LIMIT/WINDOW[/ip|/user]" or
+// "...=exempt". PATH uses chi syntax: {name} matches one segment and a
+// trailing * the rest. ROLE is a role name or "anonymous" for requests
+// without a valid token. Requests are counted per user, or per IP when
+// anonymous or with /ip. The first policy that matches a request applies;
+// exempt skips the later ones.
+const rolePolicyAnonymous = "anonymous"
+
+type rateLimitPolicy struct {
+	routeTarget
+	spec    string
+	roles   []string
+	exempt  bool
+	byIP    bool
+	limiter ratelimiter.Limiter
+}
+
+// parseRateLimitPolicies parses RATE_LIMIT_POLICIES. Each policy gets its
+// own limiter.
+func parseRateLimitPolicies(value string) ([]*rateLimitPolicy, error) {
+	var policies []*rateLimitPolicy
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		target, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_POLICIES entry %q", entry)
+		}
+		policy := &rateLimitPolicy{spec: entry}
+
+		target, roles, _ := strings.Cut(strings.TrimSpace(target), "@")
+		for _, role := range strings.Split(roles, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				policy.roles = append(policy.roles, role)
+			}
+		}
+
+		var err error
+		if policy.routeTarget, err = parseRouteTarget(target); err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_POLICIES %q: %w", entry, err)
+		}
+
+		if limit = strings.TrimSpace(limit); limit == "exempt" {
+			policy.exempt = true
+			policies = append(policies, policy)
+			continue
+		}
+
+		parts := strings.Split(limit, "/")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("RATE_LIMIT_POLICIES %q: limit must be count/window[/ip|/user]", entry)
+		}
+		count, err := strconv.Atoi(parts[0])
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("RATE_LIMIT_POLICIES %q: invalid count %q", entry, parts[0])
+		}
+		window, err := time.ParseDuration(parts[1])
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("RATE_LIMIT_POLICIES %q: invalid window %q", entry, parts[1])
+		}
+		if len(parts) == 3 {
+			switch parts[2] {
+			case "ip":
+				policy.byIP = true
+			case "user":
+			default:
+				return nil, fmt.Errorf("RATE_LIMIT_POLICIES %q: count by ip or user, not %q", entry, parts[2])
+			}
+		}
+		policy.limiter = ratelimiter.NewFixedWindowLimiter(count, window)
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// rateLimitPolicyMiddleware enforces the policies. It runs before the
+// route's own authentication, so it reads the user from the bearer token
+// itself and only loads the user when a policy depends on the role.
+func (app *application) rateLimitPolicyMiddleware(policies []*rateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(policies) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.config.rateLimiter.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			segments := routeSegments(r.URL.Path)
+			userID, role, resolved := int64(0), "", false
+			for _, policy := range policies {
+				if !policy.matches(r.Method, segments) {
+					continue
+				}
+				if !resolved {
+					userID = app.tokenUserID(r)
+					resolved = true
+				}
+				if len(policy.roles) > 0 {
+					if role == "" {
+						role = app.policyRole(r, userID)
+					}
+					if !slices.Contains(policy.roles, role) {
+						continue
+					}
+				}
+
+				if policy.exempt {
+					break
+				}
+				key := r.RemoteAddr
+				if userID != 0 && !policy.byIP {
+					key = "user:" + strconv.FormatInt(userID, 10)
+				}
+				if allow, retryAfter := policy.limiter.Allow(key); !allow {
+					app.logger.Infow("rate limit policy exceeded", "policy", policy.spec, "key", key)
+					app.rateLimitExceededResponse(w, r, retryAfter.String())
+					return
+				}
+				break
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenUserID returns the user a valid bearer token was issued to, 0 for
+// anonymous requests. Routes still authenticate the request themselves.
+func (app *application) tokenUserID(r *http.Request) int64 {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return 0
+	}
+	_, userID, err := app.accessTokenClaims(r.Context(), token)
+	if err != nil {
+		return 0
+	}
+	return userID
+}
+
+// policyRole returns the role policies match userID against.
+func (app *application) policyRole(r *http.Request, userID int64) string {
+	if userID == 0 {
+		return rolePolicyAnonymous
+	}
+	user, err := app.userService().Get(r.Context(), userID)
+	if err != nil {
+		return rolePolicyAnonymous
+	}
+	return user.Role.Name
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
+)
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	policies, err := parseRateLimitPolicies("/*@admin, moderator=exempt; POST /v1/listings/{id}=30/1h/user;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("got %d policies, want 2", len(policies))
+	}
+	if p := policies[0]; !p.exempt || len(p.roles) != 2 || p.roles[1] != "moderator" {
+		t.Errorf("unexpected exempt policy %+v", p)
+	}
+	if p := policies[1]; p.method != http.MethodPost || p.byIP || p.limiter == nil {
+		t.Errorf("unexpected listings policy %+v", p)
+	}
+
+	if !policies[0].matches(http.MethodGet, routeSegments("/v1/admin/users")) {
+		t.Error("expected /* to match every path")
+	}
+	if !policies[1].matches(http.MethodPost, routeSegments("/v1/listings/7")) {
+		t.Error("expected {id} to match a segment")
+	}
+	if !policies[1].matches(http.MethodPost, routeSegments("/v2/listings/7")) {
+		t.Error("expected a /v1 policy to cover /v2")
+	}
+	if policies[1].matches(http.MethodGet, routeSegments("/v1/listings/7")) ||
+		policies[1].matches(http.MethodPost, routeSegments("/v1/listings/7/media")) {
+		t.Error("unexpected match")
+	}
+
+	for _, value := range []string{"/v1/listings", "v1/listings=5/1h", "/v1=0/1h", "/v1=5/soon", "/v1=5/1h/device"} {
+		if _, err := parseRateLimitPolicies(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestRateLimitPolicyMiddleware(t *testing.T) {
+	cfg := config{
+		rateLimiter: ratelimiter.Config{
+			RequestsPerTimeFrame: 100,
+			TimeFrame:            time.Second * 5,
+			Enabled:              true,
+		},
+	}
+
+	t.Run("should limit matching routes", func(t *testing.T) {
+		cfg := cfg
+		cfg.rateLimitPolicies = "GET /v1/health=2/1m/ip"
+		mux := newTestApplication(t, cfg).mount()
+
+		for i := 0; i < 3; i++ {
+			rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/health", nil), mux)
+			want := http.StatusOK
+			if i == 2 {
+				want = http.StatusTooManyRequests
+			}
+			checkResponseCode(t, want, rr.Code)
+		}
+	})
+
+	t.Run("should limit the route in every version", func(t *testing.T) {
+		cfg := cfg
+		cfg.rateLimitPolicies = "GET /v1/health=2/1m/ip"
+		mux := newTestApplication(t, cfg).mount()
+
+		for i, path := range []string{"/v1/health", "/v2/health", "/v2/health"} {
+			rr := executeRequest(httptest.NewRequest(http.MethodGet, path, nil), mux)
+			want := http.StatusOK
+			if i == 2 {
+				want = http.StatusTooManyRequests
+			}
+			checkResponseCode(t, want, rr.Code)
+		}
+	})
+
+	t.Run("should skip later policies when exempt", func(t *testing.T) {
+		cfg := cfg
+		cfg.rateLimitPolicies = "/*@anonymous=exempt;GET /v1/health=1/1m"
+		mux := newTestApplication(t, cfg).mount()
+
+		for i := 0; i < 3; i++ {
+			rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/health", nil), mux)
+			checkResponseCode(t, http.StatusOK, rr.Code)
+		}
+	})
+}
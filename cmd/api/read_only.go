@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+type ReadOnlyPayload struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+type ReadOnlyStatus struct {
+	Enabled            bool `json:"enabled"`
+	SchemaIncompatible bool `json:"schema_incompatible"`
+}
+
+// getReadOnlyHandler godoc
+//
+//	@Summary		Get read-only mode
+//	@Description	Reports whether the API is currently rejecting mutating requests
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	ReadOnlyStatus
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/read-only [get]
+func (app *application) getReadOnlyHandler(r *http.Request, _ *noBody) (ReadOnlyStatus, error) {
+	return app.readOnlyStatus(), nil
+}
+
+// setReadOnlyHandler godoc
+//
+//	@Summary		Toggle read-only mode
+//	@Description	Enables or disables read-only mode. While enabled every mutating request except this one returns 503.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ReadOnlyPayload	true	"Read-only flag"
+//	@Success		200		{object}	ReadOnlyStatus
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/read-only [put]
+func (app *application) setReadOnlyHandler(r *http.Request, payload *ReadOnlyPayload) (ReadOnlyStatus, error) {
+	app.readOnly.Store(*payload.Enabled)
+
+	adminUser := getUserFromContext(r)
+	app.logger.Warnw("read-only mode changed", "enabled", *payload.Enabled, "admin_id", adminUser.ID)
+	app.logAdminAction(adminUser, "set_read_only", "system", 0, strconv.FormatBool(*payload.Enabled))
+
+	return app.readOnlyStatus(), nil
+}
+
+func (app *application) readOnlyStatus() ReadOnlyStatus {
+	return ReadOnlyStatus{
+		Enabled:            app.readOnly.Load(),
+		SchemaIncompatible: app.schemaIncompatible.Load(),
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// minSecretLength keeps short configured values such as the default basic
+// auth password from blanking out ordinary words in every log line.
+const minSecretLength = 8
+
+// secretPatterns match credentials wherever they appear in a message or
+// field: JWTs, bearer headers, SendGrid keys, tokens in the URL paths that
+// carry them, token-like query parameters, UUIDs (activation, reset and
+// magic link tokens) and long hex strings (token hashes, invite tokens).
+var secretPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + redacted},
+	{regexp.MustCompile(`SG\.[A-Za-z0-9_-]{16,}\.[A-Za-z0-9_-]{16,}`), redacted},
+	{regexp.MustCompile(`/(activate|email-change|magic-link|invites|unsubscribe)/[^/?#\s"]+`), "/$1/" + redacted},
+	{regexp.MustCompile(`(?i)([?&](token|key|api_key|password|secret)=)[^&\s"]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), redacted},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{32,}\b`), redacted},
+}
+
+// secretKeyParts mark field names whose value is dropped whatever it looks
+// like, e.g. password, new_password, refreshToken or X-Api-Key. Keys are
+// compared lowercased with dashes as underscores.
+var secretKeyParts = []string{"password", "passwd", "token", "secret", "api_key", "apikey", "authorization", "cookie"}
+
+func isSecretKey(key string) bool {
+	key = strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor removes secrets from log output: the known patterns plus the
+// exact values of configured credentials.
+type redactor struct {
+	secrets []string
+}
+
+func newRedactor(secrets ...string) *redactor {
+	r := &redactor{}
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLength {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	return r
+}
+
+func (r *redactor) string(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+
+	for _, pattern := range secretPatterns {
+		s = pattern.re.ReplaceAllString(s, pattern.replacement)
+	}
+
+	return s
+}
+
+func (r *redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		out[i] = r.field(f)
+	}
+	return out
+}
+
+// field returns f with secrets removed. Values that are not strings are
+// only replaced when they actually contained one, so structured values keep
+// their shape otherwise.
+func (r *redactor) field(f zapcore.Field) zapcore.Field {
+	if isSecretKey(f.Key) {
+		return zap.String(f.Key, redacted)
+	}
+
+	var text string
+	switch f.Type {
+	case zapcore.StringType:
+		return zap.String(f.Key, r.string(f.String))
+	case zapcore.ByteStringType:
+		text = string(f.Interface.([]byte))
+	case zapcore.ErrorType:
+		text = f.Interface.(error).Error()
+	case zapcore.StringerType:
+		text = f.Interface.(fmt.Stringer).String()
+	case zapcore.ReflectType:
+		if clean, ok := r.payload(f.Interface); ok {
+			return zap.Any(f.Key, clean)
+		}
+		text = fmt.Sprint(f.Interface)
+	default:
+		return f
+	}
+
+	if clean := r.string(text); clean != text {
+		return zap.String(f.Key, clean)
+	}
+	return f
+}
+
+// payload redacts a logged struct, map or slice through its JSON form:
+// secret keys at any depth are dropped and strings are cleaned. ok is false
+// when nothing changed or v has no JSON form.
+func (r *redactor) payload(v any) (clean any, ok bool) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var decoded any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, false
+	}
+	clean, changed := r.value(decoded)
+	return clean, changed
+}
+
+func (r *redactor) value(v any) (any, bool) {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if isSecretKey(key) {
+				v[key] = redacted
+				changed = true
+				continue
+			}
+			if clean, ok := r.value(inner); ok {
+				v[key] = clean
+				changed = true
+			}
+		}
+		return v, changed
+	case []any:
+		for i, inner := range v {
+			if clean, ok := r.value(inner); ok {
+				v[i] = clean
+				changed = true
+			}
+		}
+		return v, changed
+	case string:
+		clean := r.string(v)
+		return clean, clean != v
+	}
+	return v, false
+}
+
+// redactingCore wraps a zapcore.Core and redacts every message and field
+// before it reaches the encoder.
+type redactingCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+func newRedactingCore(core zapcore.Core, r *redactor) zapcore.Core {
+	return &redactingCore{Core: core, r: r}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.r.fields(fields)), r: c.r}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.r.string(entry.Message)
+	return c.Core.Write(entry, c.r.fields(fields))
+}
+
+// configSecrets lists the credentials from cfg that must never be logged.
+func configSecrets(cfg config) []string {
+	secrets := []string{
+		cfg.auth.token.secret,
+		cfg.auth.token.pasetoKey,
+		cfg.auth.basic.pass,
+		cfg.cryptoKey,
+		cfg.mail.smtp.password,
+		cfg.mail.sendGrid.apiKey,
+		cfg.mail.mailTrap.apiKey,
+		cfg.mail.webhooks.mailgunSigningKey,
+		cfg.redisCfg.pw,
+		cfg.redisCfg.sentinelPw,
+		cfg.storage.secretKey,
+		cfg.errorReport.sentryDSN,
+	}
+	// NATS credentials are the user info of the URL
+	if u, err := url.Parse(cfg.events.natsURL); err == nil && u.User != nil {
+		pass, ok := u.User.Password()
+		if !ok {
+			pass = u.User.Username()
+		}
+		secrets = append(secrets, pass)
+	}
+	// collector credentials, e.g. "Authorization=Bearer ..."
+	for _, value := range tracing.ParseHeaders(cfg.tracing.headers) {
+		secrets = append(secrets, value)
+	}
+	return secrets
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/country"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// geoIPCountryHeader names the header in which the CDN or proxy in front of
+// the API passes the client's country, such as CF-IPCountry. main sets it
+// from GEOIP_COUNTRY_HEADER; empty disables the lookup, because clients can
+// send any header when nothing in front of the API overwrites it.
+var geoIPCountryHeader string
+
+// countryLocales maps countries to a supported locale other than the default.
+var countryLocales = map[string]string{
+	"RU": "ru",
+	"BY": "ru",
+	"KZ": "ru",
+	"KG": "ru",
+}
+
+// normalizeCountry returns code as an upper-case ISO 3166-1 alpha-2 code, or
+// "" when it is not an assigned one. The reserved codes CDNs use for unknown
+// or Tor clients (XX, T1) are thereby treated as unknown.
+func normalizeCountry(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !country.Valid(code) {
+		return ""
+	}
+	return code
+}
+
+// geoIPCountry returns the client's country as reported by the proxy, or ""
+// when it is unknown.
+func geoIPCountry(r *http.Request) string {
+	if geoIPCountryHeader == "" {
+		return ""
+	}
+	return normalizeCountry(r.Header.Get(geoIPCountryHeader))
+}
+
+// requestRegion returns the country content is ranked for: the user's region
+// override, then their registration country, then GeoIP for anonymous
+// requests. It returns "" when none is known.
+func requestRegion(r *http.Request) string {
+	if user := getUserFromContext(r); user != nil {
+		if user.Region != "" {
+			return user.Region
+		}
+		if user.Country != "" {
+			return user.Country
+		}
+	}
+	return geoIPCountry(r)
+}
+
+// userTimezone returns the IANA timezone user's mail is scheduled in: their
+// own, then the default of their region or registration country. It returns
+// "" when none is known.
+func userTimezone(user *store.User) string {
+	if user.Timezone != "" {
+		return user.Timezone
+	}
+	if user.Region != "" {
+		return country.Timezone(user.Region)
+	}
+	return country.Timezone(user.Country)
+}
+
+// withCountryDefaults fills in the locale and timezone of a new user from
+// their country, so they stay what they were at registration until the user
+// changes them. Users without a known country are left to the request.
+func withCountryDefaults(in service.NewUser) service.NewUser {
+	if in.Country == "" {
+		return in
+	}
+	in.Locale = countryLocales[in.Country]
+	if in.Locale == "" {
+		in.Locale = defaultLocale
+	}
+	in.Timezone = country.Timezone(in.Country)
+	return in
+}
+
+// rankingRegion is requestRegion unless the request names one with
+// ?region=; "all" turns regional ranking off.
+func rankingRegion(r *http.Request) (string, error) {
+	v := r.URL.Query().Get("region")
+	switch {
+	case v == "":
+		return requestRegion(r), nil
+	case strings.EqualFold(v, "all"):
+		return "", nil
+	}
+	if region := normalizeCountry(v); region != "" {
+		return region, nil
+	}
+	return "", newHTTPError(http.StatusBadRequest, "region must be a two-letter country code or all")
+}
+
+// countriesHandler godoc
+//
+//	@Summary		Lists countries
+//	@Description	ISO 3166-1 countries with their alpha-2 code and English name, ordered by code, for country pickers. Fields that take a country accept either.
+//	@Tags			meta
+//	@Produce		json
+//	@Success		200	{array}	country.Country
+//	@Router			/meta/countries [get]
+func (app *application) countriesHandler(r *http.Request, _ *noBody) ([]country.Country, error) {
+	return country.All(), nil
+}
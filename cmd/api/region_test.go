@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/country"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRegionalRanking(t *testing.T) {
+	geoIPCountryHeader = "CF-IPCountry"
+	t.Cleanup(func() { geoIPCountryHeader = "" })
+
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	companies := []*store.Company{
+		{Name: "Almaty Homes", RegistrationNumber: "1", Email: "kz@example.com", Country: "KZ"},
+		{Name: "Berlin Wohnen", RegistrationNumber: "2", Email: "de@example.com", Country: "DE"},
+	}
+	for _, c := range companies {
+		if err := app.store.Companies.Create(ctx, nil, c); err != nil {
+			t.Fatal(err)
+		}
+		listing := &store.Listing{CompanyID: c.ID, Title: "Flat #" + c.Country, Description: "#balcony", DealType: "sale", Status: store.ListingStatusActive}
+		if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		app.setListingTags(ctx, listing)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings", app.listListingsHandler)
+	mux.Get("/v1/tags/trending", handle(app, http.StatusOK, app.trendingTagsHandler))
+
+	firstCompany := func(req *http.Request) int64 {
+		t.Helper()
+		resp := executeRequest(req, mux).Result()
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		var listings struct {
+			Data []store.Listing `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&listings); err != nil {
+			t.Fatal(err)
+		}
+		if len(listings.Data) != 2 {
+			t.Fatalf("expected both listings, got %d", len(listings.Data))
+		}
+		return listings.Data[0].CompanyID
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/listings", nil)
+	if got := firstCompany(req); got != 2 {
+		t.Errorf("without a region the newest listing should come first, got company %d", got)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/listings", nil)
+	req.Header.Set("CF-IPCountry", "kz")
+	if got := firstCompany(req); got != 1 {
+		t.Errorf("GeoIP KZ should rank the Kazakh listing first, got company %d", got)
+	}
+
+	user := &store.User{ID: 7, Country: "KZ", Region: "DE"}
+	req, _ = http.NewRequest(http.MethodGet, "/v1/listings", nil)
+	req = req.WithContext(reqctx.WithUser(req.Context(), user))
+	if got := firstCompany(req); got != 2 {
+		t.Errorf("the region override should win over the country, got company %d", got)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/tags/trending?region=KZ", nil)
+	resp := executeRequest(req, mux).Result()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+	var trending struct {
+		Data []store.TagCount `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&trending); err != nil {
+		t.Fatal(err)
+	}
+	want := []store.TagCount{{Tag: "balcony", Listings: 1}, {Tag: "kz", Listings: 1}}
+	if !reflect.DeepEqual(trending.Data, want) {
+		t.Errorf("trending in KZ = %+v, want %+v", trending.Data, want)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/tags/trending?region=Kazakhstan", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+}
+
+func TestTranslatorForCountry(t *testing.T) {
+	tests := []struct {
+		name           string
+		user           *store.User
+		acceptLanguage string
+		want           string
+	}{
+		{"anonymous", nil, "", "en"},
+		{"country default", &store.User{Country: "KZ"}, "", "ru"},
+		{"browser beats country", &store.User{Country: "KZ"}, "en-US", "en"},
+		{"setting beats browser", &store.User{Country: "DE", Locale: "ru"}, "en-US", "ru"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		if tt.user != nil {
+			req = req.WithContext(reqctx.WithUser(req.Context(), tt.user))
+		}
+		req.Header.Set("Accept-Language", tt.acceptLanguage)
+		if got := translatorFor(req).Locale(); got != tt.want {
+			t.Errorf("%s: locale %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCountries(t *testing.T) {
+	app := newTestApplication(t, config{})
+	req, _ := http.NewRequest(http.MethodGet, "/v1/meta/countries", nil)
+	rr := executeRequest(req, app.mount())
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var resp struct {
+		Data []country.Country `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 249 || resp.Data[0] != (country.Country{Code: "AD", Name: "Andorra"}) {
+		t.Errorf("got %d countries starting with %+v", len(resp.Data), resp.Data[0])
+	}
+	if rr.Header().Get("ETag") == "" {
+		t.Error("countries are served without an ETag")
+	}
+}
+
+func TestCountryDefaults(t *testing.T) {
+	tests := []struct {
+		country, locale, timezone string
+	}{
+		{"KZ", "ru", "Asia/Almaty"},
+		{"US", "en", "America/New_York"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		in := withCountryDefaults(service.NewUser{Country: tt.country})
+		if in.Locale != tt.locale || in.Timezone != tt.timezone {
+			t.Errorf("%q: got %q, %q, want %q, %q", tt.country, in.Locale, in.Timezone, tt.locale, tt.timezone)
+		}
+	}
+
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+	in := withCountryDefaults(service.NewUser{Country: "KZ"})
+	user := &store.User{Username: "alice", Email: "alice@example.com", Country: in.Country, Locale: in.Locale, Timezone: in.Timezone, IsActive: true}
+	if err := app.store.Users.Create(ctx, nil, user); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Patch("/v1/users/me", app.updateProfileHandler)
+	mux.Put("/v1/users/me/email-window", handle(app, http.StatusOK, app.setDeliveryWindowHandler))
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		current, err := app.store.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), current)), mux).Result()
+	}
+	window := func() string {
+		t.Helper()
+		w, err := app.store.DeliveryWindows.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w.Timezone
+	}
+
+	checkResponseCode(t, http.StatusOK, do(http.MethodPut, "/v1/users/me/email-window", `{"start_hour": 8}`).StatusCode)
+	if got := window(); got != "Asia/Almaty" {
+		t.Errorf("window in %q, want the registration default", got)
+	}
+
+	checkResponseCode(t, http.StatusBadRequest, do(http.MethodPatch, "/v1/users/me", `{"timezone": "Mars/Olympus_Mons"}`).StatusCode)
+	checkResponseCode(t, http.StatusOK, do(http.MethodPatch, "/v1/users/me", `{"timezone": "Europe/Berlin"}`).StatusCode)
+	checkResponseCode(t, http.StatusOK, do(http.MethodPut, "/v1/users/me/email-window", `{"start_hour": 8}`).StatusCode)
+	if got := window(); got != "Europe/Berlin" {
+		t.Errorf("window in %q, want the profile timezone", got)
+	}
+
+	checkResponseCode(t, http.StatusOK, do(http.MethodPatch, "/v1/users/me", `{"timezone": "", "region": "DE"}`).StatusCode)
+	stored, err := app.store.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Timezone != "" || userTimezone(stored) != "Europe/Berlin" || userLocale(stored) != "ru" {
+		t.Errorf("after clearing: timezone %q, derived %q, locale %q", stored.Timezone, userTimezone(stored), userLocale(stored))
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/botcheck"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/email"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+const registrationBody = `{"first_name":"Jo","last_name":"Doe","email":"jo@example.com","phone":"+77001112233",` +
+	`"password":"Abcdefg1!x","password_confirmation":"Abcdefg1!x"}`
+
+func register(mux http.Handler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(registrationBody))
+	return executeRequest(req, mux)
+}
+
+// failingWelcomeUsers makes queueing the welcome email fail inside the
+// store's registration transaction.
+type failingWelcomeUsers struct {
+	store.MockUserStore
+	users interface {
+		CreateAndInvite(ctx context.Context, user *store.User, token string, exp time.Duration, welcome func(*store.User) (*store.OutboxEmail, error)) error
+	}
+}
+
+var errQueueWelcome = errors.New("outbox unavailable")
+
+func (s *failingWelcomeUsers) CreateAndInvite(ctx context.Context, user *store.User, token string, exp time.Duration, welcome func(*store.User) (*store.OutboxEmail, error)) error {
+	return s.users.CreateAndInvite(ctx, user, token, exp, func(*store.User) (*store.OutboxEmail, error) {
+		return nil, errQueueWelcome
+	})
+}
+
+func TestRegisterUser(t *testing.T) {
+	cfg := config{auth: authConfig{requireActivation: true}, linkTokens: linkTokensConfig{activationTTL: time.Hour}}
+
+	t.Run("queues the welcome email", func(t *testing.T) {
+		app, mail := newMemoryTestApplication(t, cfg)
+		rr := register(app.mount())
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		user, err := app.store.Users.GetByEmail(context.Background(), "jo@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.State != store.UserStatePending {
+			t.Errorf("state %q, want pending", user.State)
+		}
+		if len(mail.Sent()) != 0 {
+			t.Error("email sent before the outbox relay ran")
+		}
+
+		app.relayOutbox(context.Background())
+		sent := mail.Sent()
+		if len(sent) != 1 || sent[0].Template != mailer.UserWelcomeTemplate || sent[0].Email != "jo@example.com" {
+			t.Errorf("unexpected emails %+v", sent)
+		}
+
+		records, err := app.store.SentEmails.ListByEmail(context.Background(), "Jo@example.com", store.PaginatedQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0].MessageID != "mock-1" || records[0].Provider != "mock" || records[0].OutboxID == nil {
+			t.Errorf("sent emails %+v", records)
+		}
+	})
+
+	t.Run("delivery failure keeps the user and retries", func(t *testing.T) {
+		app, mail := newMemoryTestApplication(t, cfg)
+		mail.Fail(errors.New("smtp down"))
+		checkResponseCode(t, http.StatusCreated, register(app.mount()).Code)
+
+		app.relayOutbox(context.Background())
+		if app.mailFailures.Load() != 1 {
+			t.Errorf("mail failures %d, want 1", app.mailFailures.Load())
+		}
+		if _, err := app.store.Users.GetByEmail(context.Background(), "jo@example.com"); err != nil {
+			t.Errorf("user lost after a failed delivery: %v", err)
+		}
+		if abandoned, _ := app.store.Outbox.CountAbandoned(context.Background(), 1); abandoned != 0 {
+			t.Error("email given up after one failure")
+		}
+	})
+
+	t.Run("failing to queue the email rolls back", func(t *testing.T) {
+		app, mail := newMemoryTestApplication(t, cfg)
+		users := app.store.Users
+		app.store.Users = &failingWelcomeUsers{users: users}
+
+		rr := register(app.mount())
+		checkResponseCode(t, http.StatusInternalServerError, rr.Code)
+		if strings.Contains(rr.Body.String(), "token") {
+			t.Errorf("activation token in error response: %s", rr.Body.String())
+		}
+
+		if _, err := users.GetByEmail(context.Background(), "jo@example.com"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("user kept after the rollback: %v", err)
+		}
+		app.relayOutbox(context.Background())
+		if len(mail.Sent()) != 0 {
+			t.Errorf("email sent for a rolled back registration: %+v", mail.Sent())
+		}
+
+		// the address can register again once the outbox is back
+		app.store.Users = users
+		checkResponseCode(t, http.StatusCreated, register(app.mount()).Code)
+	})
+
+	t.Run("normalizes and screens the address", func(t *testing.T) {
+		app, _ := newMemoryTestApplication(t, cfg)
+		app.emails = email.NewService(email.Options{StripPlusTags: true, BlockDisposable: true})
+		mux := app.mount()
+
+		body := strings.Replace(registrationBody, "jo@example.com", "jo@mailinator.com", 1)
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body)), mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+		body = strings.Replace(registrationBody, "jo@example.com", "jo+news@Example.COM", 1)
+		rr = executeRequest(httptest.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body)), mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		user, err := app.getUserByLogin(context.Background(), "jo+news@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "jo@example.com" {
+			t.Errorf("stored %q, want jo@example.com", user.Email)
+		}
+	})
+
+	t.Run("stores the country as its code", func(t *testing.T) {
+		app, _ := newMemoryTestApplication(t, cfg)
+		mux := app.mount()
+
+		body := strings.Replace(registrationBody, "}", `,"country":"Narnia"}`, 1)
+		rr := executeRequest(httptest.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body)), mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+		body = strings.Replace(registrationBody, "}", `,"country":"kazakhstan"}`, 1)
+		rr = executeRequest(httptest.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body)), mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		user, err := app.store.Users.GetByEmail(context.Background(), "jo@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Country != "KZ" {
+			t.Errorf("stored %q, want KZ", user.Country)
+		}
+	})
+
+	t.Run("challenges after the free attempts", func(t *testing.T) {
+		app, _ := newMemoryTestApplication(t, cfg)
+		check, err := newBotCheck(botCheckConfig{provider: botcheck.ProviderProofOfWork, powDifficulty: 4, powTTL: time.Minute, freeAttempts: 1, window: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.botCheck = check
+		app.config.auth.botCheck.timeout = time.Second
+		mux := app.mount()
+
+		registerAs := func(address, token string) *httptest.ResponseRecorder {
+			body := strings.Replace(registrationBody, "jo@example.com", address, 1)
+			body = strings.Replace(body, "+77001112233", "+7700111"+address[:4], 1)
+			body = strings.Replace(body, "}", `,"challenge_token":"`+token+`"}`, 1)
+			return executeRequest(httptest.NewRequest(http.MethodPost, "/v1/authentication/user", strings.NewReader(body)), mux)
+		}
+
+		checkResponseCode(t, http.StatusCreated, registerAs("1111@example.com", "").Code)
+		rr := registerAs("2222@example.com", "")
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+		if !strings.Contains(rr.Body.String(), challengeRequiredCode) {
+			t.Errorf("missing error code: %s", rr.Body)
+		}
+
+		rr = executeRequest(httptest.NewRequest(http.MethodGet, "/v1/authentication/challenge", nil), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		var challenge struct {
+			Data botcheck.Challenge `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&challenge); err != nil {
+			t.Fatal(err)
+		}
+		token := botcheck.Solve(&challenge.Data)
+		checkResponseCode(t, http.StatusCreated, registerAs("2222@example.com", token).Code)
+		checkResponseCode(t, http.StatusBadRequest, registerAs("3333@example.com", token).Code)
+	})
+
+	t.Run("hides existing accounts", func(t *testing.T) {
+		hidden := cfg
+		hidden.auth.hideExistingAccounts = true
+		app, mail := newMemoryTestApplication(t, hidden)
+		mux := app.mount()
+
+		first := register(mux)
+		checkResponseCode(t, http.StatusCreated, first.Code)
+		second := register(mux)
+		checkResponseCode(t, http.StatusCreated, second.Code)
+		if first.Body.String() != second.Body.String() || strings.Contains(first.Body.String(), "token") {
+			t.Errorf("responses differ or leak the account: %s / %s", first.Body, second.Body)
+		}
+
+		// the notice is queued after the response
+		deadline := time.Now().Add(time.Second)
+		for len(mail.Sent()) < 2 && time.Now().Before(deadline) {
+			app.relayOutbox(context.Background())
+			time.Sleep(10 * time.Millisecond)
+		}
+		sent := mail.Sent()
+		if len(sent) != 2 || sent[0].Template != mailer.UserWelcomeTemplate || sent[1].Template != mailer.RegistrationAttemptTemplate {
+			t.Errorf("unexpected emails %+v", sent)
+		}
+	})
+}
+
+func TestActivateUser(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{auth: authConfig{requireActivation: true}, linkTokens: linkTokensConfig{activationTTL: time.Hour}})
+	mux := app.mount()
+
+	var registered struct {
+		Data UserWithToken `json:"data"`
+	}
+	rr := register(mux)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	if err := json.NewDecoder(rr.Body).Decode(&registered); err != nil || registered.Data.Token == "" {
+		t.Fatalf("no activation token: %v", err)
+	}
+
+	activate := httptest.NewRequest(http.MethodPut, "/v1/users/activate/"+registered.Data.Token, nil)
+	rr = executeRequest(activate, mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	var activated struct {
+		Data store.User `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&activated); err != nil {
+		t.Fatal(err)
+	}
+	if !activated.Data.IsActive || activated.Data.State != store.UserStateActive || activated.Data.Email != "jo@example.com" {
+		t.Errorf("unexpected user %+v", activated.Data)
+	}
+
+	// the invitation is gone once used
+	rr = executeRequest(httptest.NewRequest(http.MethodPut, "/v1/users/activate/"+registered.Data.Token, nil), mux)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
+
+func TestActivationLinks(t *testing.T) {
+	cfg := config{
+		frontendURL: "https://example.com",
+		env:         "production",
+		auth: authConfig{
+			requireActivation: true,
+			activationLinks:   "ios=valar://activate/{token}",
+			activationSchemes: "valar",
+		},
+		linkTokens: linkTokensConfig{activationTTL: time.Hour},
+	}
+
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{"", "https://example.com/confirm/"},
+		{"?client=web", "https://example.com/confirm/"},
+		{"?client=ios", "valar://activate/"},
+	} {
+		app, mail := newMemoryTestApplication(t, cfg)
+		req := httptest.NewRequest(http.MethodPost, "/v1/authentication/user"+tc.query, strings.NewReader(registrationBody))
+		rr := executeRequest(req, app.mount())
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var registered struct {
+			Data UserWithToken `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&registered); err != nil {
+			t.Fatal(err)
+		}
+		app.relayOutbox(context.Background())
+		sent := mail.Sent()
+		if len(sent) != 1 {
+			t.Fatalf("%q: sent %+v", tc.query, sent)
+		}
+		data, _ := sent[0].Data.(map[string]any)
+		if link := data["ActivationURL"]; link != tc.want+registered.Data.Token {
+			t.Errorf("%q: activation link %v, want %s%s", tc.query, link, tc.want, registered.Data.Token)
+		}
+	}
+
+	app, _ := newMemoryTestApplication(t, cfg)
+	req := httptest.NewRequest(http.MethodPost, "/v1/authentication/user?client=android", strings.NewReader(registrationBody))
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, app.mount()).Code)
+
+	for _, links := range []string{"ios=javascript:alert({token})", "ios=valar://activate", "IOS=valar://{token}", "ios=https://a/{token};ios=https://b/{token}"} {
+		if _, err := parseActivationLinks(links, "valar"); err == nil {
+			t.Errorf("%q: no error", links)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/db"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// replicas returns the configured read replica addresses.
+func (c dbConfig) replicas() []string {
+	var addrs []string
+	for _, addr := range strings.Split(c.replicaAddrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// openReplicas connects to every replica with the primary's pool settings.
+// On error the replicas opened so far are closed again.
+func openReplicas(cfg dbConfig) ([]*sql.DB, error) {
+	var conns []*sql.DB
+	for _, addr := range cfg.replicas() {
+		conn, err := db.New(addr, cfg.maxOpenConns, cfg.maxIdleConns, cfg.maxIdleTime, cfg.maxLifetime)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// replicaReadsMiddleware lets the store serve the request's listing search
+// and profile reads from a replica. It belongs on public GET routes only,
+// where a few seconds of lag is acceptable; authentication that runs before
+// it still reads from the primary.
+func replicaReadsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(store.WithReplicaReads(r.Context())))
+	})
+}
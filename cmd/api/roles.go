@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// permissionCacheTTL bounds how long other instances keep serving
+// permissions an admin changed; the instance that made the change reloads
+// at once.
+const permissionCacheTTL = 30 * time.Second
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+type CreateRolePayload struct {
+	Name        string `json:"name" validate:"required,min=3,max=32"`
+	Description string `json:"description" validate:"max=255"`
+	// Level orders roles in the admin UI; 3 is kept for admin
+	Level       int      `json:"level,omitempty" validate:"omitempty,min=1,max=2"`
+	Permissions []string `json:"permissions"`
+}
+
+type SetRolePermissionsPayload struct {
+	Permissions []string `json:"permissions"`
+}
+
+// permissionCache holds role_permissions by role name.
+type permissionCache struct {
+	mu     sync.Mutex
+	byRole map[string]map[string]bool
+	loaded time.Time
+}
+
+func (c *permissionCache) invalidate() {
+	c.mu.Lock()
+	c.loaded = time.Time{}
+	c.mu.Unlock()
+}
+
+// hasPermission reports whether role grants permission. The admin role
+// always does, so admins cannot lock themselves out.
+func (app *application) hasPermission(ctx context.Context, role, permission string) (bool, error) {
+	if role == store.RoleAdmin {
+		return true, nil
+	}
+
+	c := &app.permissions
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.loaded) > permissionCacheTTL {
+		byRole, err := app.store.Roles.PermissionsByRole(ctx)
+		switch {
+		case err == nil:
+			c.byRole = make(map[string]map[string]bool, len(byRole))
+			for name, permissions := range byRole {
+				c.byRole[name] = make(map[string]bool, len(permissions))
+				for _, p := range permissions {
+					c.byRole[name][p] = true
+				}
+			}
+			c.loaded = time.Now()
+		case c.byRole == nil:
+			return false, err
+		default:
+			// keep answering from the last good copy
+			app.logger.Errorw("could not reload role permissions", "error", err)
+		}
+	}
+
+	return c.byRole[role][permission], nil
+}
+
+// requirePermission lets the request through when the caller's role grants
+// permission. It runs after the auth middleware.
+func (app *application) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.hasPermission(r.Context(), reqctx.Role(r.Context()), permission)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func checkPermissions(permissions []string) error {
+	for _, p := range permissions {
+		if !store.IsPermission(p) {
+			return newHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown permission %q", p))
+		}
+	}
+	return nil
+}
+
+// listPermissionsHandler godoc
+//
+//	@Summary		List permissions
+//	@Description	Every permission a role can be granted
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		store.Permission
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/permissions [get]
+func (app *application) listPermissionsHandler(r *http.Request, _ *noBody) ([]store.Permission, error) {
+	return store.Permissions, nil
+}
+
+// listRolesHandler godoc
+//
+//	@Summary		List roles
+//	@Description	Every role with the permissions it grants. The admin role passes every check whatever it lists.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		store.Role
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [get]
+func (app *application) listRolesHandler(r *http.Request, _ *noBody) ([]store.Role, error) {
+	return app.store.Roles.List(r.Context())
+}
+
+// createRoleHandler godoc
+//
+//	@Summary		Create a role
+//	@Description	Adds a role granting permissions; assign it to users with PATCH /admin/users/{userID}/role. A name that is taken answers 409.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateRolePayload	true	"Role"
+//	@Success		201		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles [post]
+func (app *application) createRoleHandler(r *http.Request, payload *CreateRolePayload) (*store.Role, error) {
+	name := strings.ToLower(strings.TrimSpace(payload.Name))
+	if !roleNamePattern.MatchString(name) {
+		return nil, newHTTPError(http.StatusBadRequest, "name must be lowercase letters, digits and underscores")
+	}
+	if err := checkPermissions(payload.Permissions); err != nil {
+		return nil, err
+	}
+
+	role := &store.Role{
+		Name:        name,
+		Description: payload.Description,
+		Level:       max(payload.Level, 1),
+		Permissions: payload.Permissions,
+	}
+	if err := app.store.Roles.Create(r.Context(), role); err != nil {
+		return nil, err
+	}
+	app.permissions.invalidate()
+
+	app.logAdminAction(getUserFromContext(r), "create_role", "role", role.ID, strings.Join(role.Permissions, ","))
+	return role, nil
+}
+
+// setRolePermissionsHandler godoc
+//
+//	@Summary		Set a role's permissions
+//	@Description	Replaces the permissions the role grants. Other API instances pick the change up within 30 seconds. The admin role cannot be changed.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleID	path		int							true	"Role ID"
+//	@Param			payload	body		SetRolePermissionsPayload	true	"Permissions"
+//	@Success		200		{object}	store.Role
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/roles/{roleID}/permissions [put]
+func (app *application) setRolePermissionsHandler(r *http.Request, payload *SetRolePermissionsPayload) (*store.Role, error) {
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid role ID")
+	}
+	if err := checkPermissions(payload.Permissions); err != nil {
+		return nil, err
+	}
+
+	roles, err := app.store.Roles.List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	var role *store.Role
+	for i := range roles {
+		if roles[i].ID == roleID {
+			role = &roles[i]
+		}
+	}
+	if role == nil {
+		return nil, store.ErrNotFound
+	}
+	if role.Name == store.RoleAdmin {
+		return nil, newHTTPError(http.StatusBadRequest, "the admin role always has every permission")
+	}
+
+	if err := app.store.Roles.SetPermissions(r.Context(), roleID, payload.Permissions); err != nil {
+		return nil, err
+	}
+	app.permissions.invalidate()
+
+	role.Permissions = slices.Clone(payload.Permissions)
+	slices.Sort(role.Permissions)
+	role.Permissions = slices.Compact(role.Permissions)
+	app.logAdminAction(getUserFromContext(r), "set_role_permissions", "role", roleID, strings.Join(role.Permissions, ","))
+	return role, nil
+}
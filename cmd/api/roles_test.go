@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRolePermissions(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	admin := &store.User{Username: "root", Email: "root@example.com", IsActive: true, Role: store.Role{Name: store.RoleAdmin}}
+	moderator := &store.User{Username: "mod", Email: "mod@example.com", IsActive: true, Role: store.Role{Name: store.RoleModerator}}
+	regular := &store.User{Username: "erin", Email: "erin@example.com", IsActive: true}
+	for _, u := range []*store.User{admin, moderator, regular} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.With(app.requirePermission(store.PermissionComplaintsReview)).Get("/review", func(w http.ResponseWriter, r *http.Request) {})
+	mux.With(app.requirePermission(store.PermissionComplaintsResolve)).Post("/resolve", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Post("/roles", handle(app, http.StatusCreated, app.createRoleHandler))
+	mux.Put("/roles/{roleID}/permissions", handle(app, http.StatusOK, app.setRolePermissionsHandler))
+
+	do := func(user *store.User, method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		user, err := app.store.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), user)), mux).Code
+	}
+
+	checkResponseCode(t, http.StatusOK, do(moderator, http.MethodGet, "/review", ""))
+	checkResponseCode(t, http.StatusOK, do(admin, http.MethodPost, "/resolve", ""))
+	checkResponseCode(t, http.StatusForbidden, do(regular, http.MethodGet, "/review", ""))
+
+	checkResponseCode(t, http.StatusBadRequest, do(admin, http.MethodPost, "/roles", `{"name":"support","permissions":["posts.delete"]}`))
+	checkResponseCode(t, http.StatusCreated, do(admin, http.MethodPost, "/roles", `{"name":"support","permissions":["complaints.review"]}`))
+	checkResponseCode(t, http.StatusConflict, do(admin, http.MethodPost, "/roles", `{"name":"support"}`))
+
+	support, err := app.store.Roles.GetByName(ctx, "support")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Users.UpdateRole(ctx, regular.ID, support.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkResponseCode(t, http.StatusOK, do(regular, http.MethodGet, "/review", ""))
+	checkResponseCode(t, http.StatusForbidden, do(regular, http.MethodPost, "/resolve", ""))
+
+	path := "/roles/" + strconv.FormatInt(support.ID, 10) + "/permissions"
+	checkResponseCode(t, http.StatusOK, do(admin, http.MethodPut, path, `{"permissions":["complaints.resolve"]}`))
+	checkResponseCode(t, http.StatusOK, do(regular, http.MethodPost, "/resolve", ""))
+	checkResponseCode(t, http.StatusForbidden, do(regular, http.MethodGet, "/review", ""))
+
+	// admins keep every permission
+	adminRole, _ := app.store.Roles.GetByName(ctx, store.RoleAdmin)
+	checkResponseCode(t, http.StatusBadRequest, do(admin, http.MethodPut, "/roles/"+strconv.FormatInt(adminRole.ID, 10)+"/permissions", `{"permissions":[]}`))
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/env"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"go.uber.org/zap"
+)
+
+// Middleware stacks are declared by name so the order is visible in one place
+// and can be overridden per group from ROUTE_MIDDLEWARE, e.g.
+//
+//	ROUTE_MIDDLEWARE="/admin=auth,admin,timeout=120s;/listings=timeout=10s"
+//
+// Names are applied in the order listed. "timeout=<duration>" replaces the
+// request context deadline, see timeouts.go, and "body_limit=<size>" (bytes,
+// or with a KB or MB suffix) caps the JSON bodies readJSON accepts.
+const (
+	mwRequestID       = "request_id"
+	mwTracing         = "tracing"
+	mwRealIP          = "real_ip"
+	mwLogger          = "logger"
+	mwRecoverer       = "recoverer"
+	mwCORS            = "cors"
+	mwMaintenance     = "maintenance"
+	mwRateLimit       = "rate_limit"
+	mwRatePolicies    = "rate_limit_policies"
+	mwReadOnly        = "read_only"
+	mwIdempotency     = "idempotency"
+	mwAuth            = "auth"
+	mwOptionalAuth    = "optional_auth"
+	mwAdmin           = "admin"
+	mwModerator       = "moderator"
+	mwStaff           = "staff"
+	mwAuthRateLimit   = "auth_rate_limit"
+	mwETag            = "etag"
+	mwCompress        = "compress"
+	mwReplicaReads    = "replica_reads"
+	mwQueryCount      = "query_count"
+	mwTimeout         = "timeout"
+	mwTenant          = "tenant"
+	mwDebugCapture    = "debug_capture"
+	mwLocale          = "locale"
+	mwTimeoutPrefix   = "timeout="
+	mwBodyLimitPrefix = "body_limit="
+)
+
+// globalMiddleware runs for every request, outermost first.
+var globalMiddleware = []string{
+	mwRequestID,
+	mwTracing,
+	mwRealIP,
+	mwLogger,
+	mwQueryCount,
+	mwRecoverer,
+	mwCompress,
+	mwCORS,
+	mwMaintenance,
+	mwRateLimit,
+	mwRatePolicies,
+	mwReadOnly,
+	// Set a deadline on the request context (ctx), REQUEST_TIMEOUT or the
+	// route's from ROUTE_TIMEOUTS, that will signal through ctx.Done() that
+	// the request has timed out and further processing should be stopped.
+	mwTimeout,
+	// Negotiate the request's locale, see locale.go.
+	mwLocale,
+	// Scope the request to its tenant in multi-tenant mode, see tenancy.go.
+	mwTenant,
+	// Record bodies for admins when asked to, see debug_capture.go.
+	mwDebugCapture,
+	mwIdempotency,
+}
+
+// groupMiddleware is the stack of each route group, outermost first, and
+// what ROUTE_MIDDLEWARE replaces. Groups not listed attach middleware per
+// route.
+var groupMiddleware = map[string][]string{
+	"/projects":       {mwAuth},
+	"/listings":       {mwBodyLimitPrefix + "4MB"}, // descriptions, tags and media metadata
+	"/team":           {mwAuth},
+	"/dashboard":      {mwAuth},
+	"/favorites":      {mwAuth},
+	"/chats":          {mwAuth},
+	"/conversations":  {mwAuth},
+	"/events":         {mwAuth},
+	"/complaints":     {mwAuth},
+	"/users/me":       {mwAuth},
+	"/applications":   {mwAuth},
+	"/meta":           {mwETag},
+	"/authentication": {mwBodyLimitPrefix + "16KB"},
+	"/moderation":     {mwAuth, mwStaff},
+	"/admin":          {mwAuth, mwAdmin},
+}
+
+// guardMiddleware decides who may call a route. An override has to keep
+// the group's guards, in the same order, so it cannot open a protected
+// group up.
+var guardMiddleware = map[string]bool{mwAuth: true, mwAdmin: true, mwModerator: true, mwStaff: true}
+
+type routeGroup struct {
+	pattern string
+	routes  func(r chi.Router)
+}
+
+func (app *application) middlewareRegistry() map[string]func(http.Handler) http.Handler {
+	// Stricter rate limiter for auth endpoints (5 req / 60s)
+	authLimiter := ratelimiter.NewFixedWindowLimiter(5, time.Minute)
+	authRateLimit := app.buildRateLimiterMiddleware(authLimiter)
+	if app.config.loadTest.enabled {
+		// a load generator signs in from a handful of addresses
+		authRateLimit = func(next http.Handler) http.Handler { return next }
+	}
+
+	policies, err := parseRateLimitPolicies(app.config.rateLimitPolicies)
+	if err != nil {
+		// Validated at startup; fall back to the global limiter only.
+		app.logger.Errorw("ignoring RATE_LIMIT_POLICIES", "error", err)
+		policies = nil
+	}
+
+	timeouts, err := parseRouteTimeouts(app.config.routeTimeouts)
+	if err != nil {
+		// Validated at startup; fall back to REQUEST_TIMEOUT for every route.
+		app.logger.Errorw("ignoring ROUTE_TIMEOUTS", "error", err)
+		timeouts = nil
+	}
+
+	allowedHeaders := []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key", "If-None-Match", "Traceparent", debugCaptureHeader}
+	if app.config.tenancy.enabled && app.config.tenancy.header != "" {
+		allowedHeaders = append(allowedHeaders, app.config.tenancy.header)
+	}
+
+	return map[string]func(http.Handler) http.Handler{
+		mwRequestID: middleware.RequestID,
+		mwTracing:   tracingMiddleware,
+		mwRealIP:    middleware.RealIP,
+		// access logs go through the zap logger so secrets in URLs are redacted
+		mwLogger: middleware.RequestLogger(&middleware.DefaultLogFormatter{
+			Logger:  zap.NewStdLog(app.logger.Desugar()),
+			NoColor: true,
+		}),
+		mwRecoverer: app.recoverMiddleware,
+		mwCORS: cors.Handler(cors.Options{
+			AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5173")},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   allowedHeaders,
+			ExposedHeaders:   []string{"Link", "Idempotent-Replayed", "X-Password-Breached", "Deprecation", "Sunset", "ETag", apiVersionHeader, "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", impersonatedByHeader},
+			AllowCredentials: false,
+			MaxAge:           300, // Maximum value not ignored by any of major browsers
+		}),
+		mwMaintenance:   app.maintenanceMiddleware,
+		mwRateLimit:     app.RateLimiterMiddleware,
+		mwRatePolicies:  app.rateLimitPolicyMiddleware(policies),
+		mwReadOnly:      app.readOnlyMiddleware,
+		mwIdempotency:   app.idempotencyMiddleware,
+		mwAuth:          app.AuthTokenMiddleware,
+		mwOptionalAuth:  app.optionalAuthMiddleware,
+		mwAdmin:         app.adminOnlyMiddleware,
+		mwModerator:     app.moderatorOnlyMiddleware,
+		mwStaff:         app.staffActionMiddleware,
+		mwAuthRateLimit: authRateLimit,
+		mwETag:          app.etagMiddleware,
+		mwCompress:      app.compressMiddleware,
+		mwReplicaReads:  replicaReadsMiddleware,
+		mwQueryCount:    app.queryCountMiddleware,
+		mwTimeout:       app.requestTimeoutMiddleware(timeouts),
+		mwTenant:        app.tenantMiddleware,
+		mwDebugCapture:  app.debugCaptureMiddleware,
+		mwLocale:        localeMiddleware,
+	}
+}
+
+var middlewareNames = map[string]bool{
+	mwRequestID: true, mwRealIP: true, mwLogger: true, mwRecoverer: true,
+	mwCORS: true, mwMaintenance: true, mwRateLimit: true, mwRatePolicies: true, mwReadOnly: true, mwIdempotency: true,
+	mwAuth: true, mwOptionalAuth: true, mwAdmin: true, mwModerator: true, mwStaff: true, mwAuthRateLimit: true,
+	mwETag: true, mwCompress: true, mwTracing: true, mwReplicaReads: true, mwQueryCount: true, mwTimeout: true,
+	mwTenant: true, mwDebugCapture: true, mwLocale: true,
+}
+
+func checkMiddlewareName(name string) error {
+	if strings.HasPrefix(name, mwTimeoutPrefix) {
+		timeout, err := time.ParseDuration(strings.TrimPrefix(name, mwTimeoutPrefix))
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid middleware %q", name)
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(name, mwBodyLimitPrefix) {
+		if _, err := parseByteSize(strings.TrimPrefix(name, mwBodyLimitPrefix)); err != nil {
+			return fmt.Errorf("invalid middleware %q", name)
+		}
+		return nil
+	}
+
+	if !middlewareNames[name] {
+		return fmt.Errorf("unknown middleware %q", name)
+	}
+
+	return nil
+}
+
+// resolveMiddleware turns a stack of names into middleware in the same order.
+func resolveMiddleware(registry map[string]func(http.Handler) http.Handler, names []string) ([]func(http.Handler) http.Handler, error) {
+	stack := make([]func(http.Handler) http.Handler, 0, len(names))
+
+	for _, name := range names {
+		if err := checkMiddlewareName(name); err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(name, mwTimeoutPrefix) {
+			timeout, _ := time.ParseDuration(strings.TrimPrefix(name, mwTimeoutPrefix))
+			stack = append(stack, timeoutMiddleware(timeout))
+			continue
+		}
+
+		if strings.HasPrefix(name, mwBodyLimitPrefix) {
+			maxBytes, _ := parseByteSize(strings.TrimPrefix(name, mwBodyLimitPrefix))
+			stack = append(stack, bodyLimitMiddleware(maxBytes))
+			continue
+		}
+
+		stack = append(stack, registry[name])
+	}
+
+	return stack, nil
+}
+
+// routeTarget is the "[METHOD ]PATH" part of a per-route setting. PATH
+// uses chi syntax: {name} matches one segment and a trailing * the rest.
+// A version prefix is dropped, so "/v1/listings" covers the route in every
+// API version.
+type routeTarget struct {
+	method  string
+	pattern []string
+}
+
+func parseRouteTarget(target string) (routeTarget, error) {
+	var t routeTarget
+	path := strings.TrimSpace(target)
+	if method, rest, ok := strings.Cut(path, " "); ok {
+		t.method, path = strings.ToUpper(method), strings.TrimSpace(rest)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return routeTarget{}, errors.New("path must start with /")
+	}
+	t.pattern = routeSegments(path)
+	return t, nil
+}
+
+// routeSegments splits path, without its version prefix, for matches.
+func routeSegments(path string) []string {
+	return strings.Split(strings.Trim(unversionedPath(path), "/"), "/")
+}
+
+// matches reports whether the target's method and path cover the request.
+func (t routeTarget) matches(method string, segments []string) bool {
+	if t.method != "" && t.method != "*" && t.method != method {
+		return false
+	}
+	for i, part := range t.pattern {
+		if part == "*" && i == len(t.pattern)-1 {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if part != segments[i] && !(strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")) {
+			return false
+		}
+	}
+	return len(segments) == len(t.pattern)
+}
+
+// parseByteSize parses a positive size such as "16384", "16KB" or "4MB".
+func parseByteSize(value string) (int64, error) {
+	unit := int64(1)
+	upper := strings.ToUpper(value)
+	if number, ok := strings.CutSuffix(upper, "KB"); ok {
+		upper, unit = number, 1<<10
+	} else if number, ok := strings.CutSuffix(upper, "MB"); ok {
+		upper, unit = number, 1<<20
+	}
+
+	size, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return size * unit, nil
+}
+
+// bodyLimitMiddleware sets the largest JSON body readJSON accepts on the
+// routes below it.
+func bodyLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(reqctx.WithBodyLimit(r.Context(), maxBytes)))
+		})
+	}
+}
+
+// parseRouteMiddleware parses ROUTE_MIDDLEWARE into per-group stacks keyed by
+// group pattern.
+func parseRouteMiddleware(value string) (map[string][]string, error) {
+	overrides := map[string][]string{}
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, stack, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("invalid ROUTE_MIDDLEWARE entry %q", entry)
+		}
+
+		names := []string{}
+		for _, name := range strings.Split(stack, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+
+		for _, name := range names {
+			if err := checkMiddlewareName(name); err != nil {
+				return nil, fmt.Errorf("ROUTE_MIDDLEWARE %s: %w", pattern, err)
+			}
+		}
+
+		pattern = strings.TrimSpace(pattern)
+		if err := checkGuards(groupMiddleware[pattern], names); err != nil {
+			return nil, fmt.Errorf("ROUTE_MIDDLEWARE %s: %w", pattern, err)
+		}
+
+		overrides[pattern] = names
+	}
+
+	return overrides, nil
+}
+
+// checkGuards reports an error when override leaves out a guard of the
+// declared stack or reorders the guards.
+func checkGuards(declared, override []string) error {
+	var want, got []string
+	for _, name := range declared {
+		if guardMiddleware[name] {
+			want = append(want, name)
+		}
+	}
+	for _, name := range override {
+		if guardMiddleware[name] {
+			got = append(got, name)
+		}
+	}
+
+	// the override may add guards but must keep the declared ones in order
+	i := 0
+	for _, name := range got {
+		if i < len(want) && name == want[i] {
+			i++
+		}
+	}
+	if i < len(want) {
+		return fmt.Errorf("the stack must keep %s in that order", strings.Join(want, ","))
+	}
+	return nil
+}
+
+// mountGroups registers each group under r with its middleware stack, using
+// the override from config when one exists for the group's pattern.
+func (app *application) mountGroups(r chi.Router, registry map[string]func(http.Handler) http.Handler, groups []routeGroup) {
+	overrides, err := parseRouteMiddleware(app.config.routeMiddleware)
+	if err != nil {
+		// Validated at startup; fall back to the defaults rather than failing here.
+		app.logger.Errorw("ignoring ROUTE_MIDDLEWARE", "error", err)
+		overrides = nil
+	}
+
+	for _, group := range groups {
+		names := groupMiddleware[group.pattern]
+		if override, ok := overrides[group.pattern]; ok {
+			names = override
+		}
+
+		stack, err := resolveMiddleware(registry, names)
+		if err != nil {
+			panic(fmt.Sprintf("route group %s: %v", group.pattern, err))
+		}
+
+		routes := group.routes
+		r.Route(group.pattern, func(r chi.Router) {
+			r.Use(stack...)
+			routes(r)
+		})
+	}
+}
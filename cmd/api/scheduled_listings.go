@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type listingsConfig struct {
+	// publishInterval is how often scheduled listings whose publish_at has
+	// passed are made active, 0 stops it
+	publishInterval time.Duration
+	// trendingInterval is how often the trending listings are recomputed,
+	// 0 recomputes them on every request
+	trendingInterval time.Duration
+	// calendarLinkTTL is how long the links to personal calendar feeds
+	// work, see calendars.go
+	calendarLinkTTL time.Duration
+	// deletedRetention is how long a deleted listing can be restored
+	// before it is purged, see deleted_listings.go
+	deletedRetention time.Duration
+	// purgeInterval is how often listings past deletedRetention are
+	// purged, 0 stops it
+	purgeInterval time.Duration
+}
+
+// parsePublishAt checks a publish_at from a payload, which must be RFC 3339
+// and in the future, and returns it in UTC. nil and "" are no publish_at.
+func parsePublishAt(value *string) (*string, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	at, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil, fmt.Errorf("publish_at must be an RFC 3339 time")
+	}
+	if !at.After(time.Now()) {
+		return nil, fmt.Errorf("publish_at must be in the future")
+	}
+	utc := at.UTC().Format(time.RFC3339)
+	return &utc, nil
+}
+
+// submitListingHandler godoc
+//
+//	@Summary		Submit a draft listing (agency/developer)
+//	@Description	Sends the company's draft listing to moderation. Once approved it goes live, or at its publish_at if that is later.
+//	@Tags			listings
+//	@Produce		json
+//	@Param			listingID	path		int	true	"Listing ID"
+//	@Success		200			{object}	store.Listing
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/listings/{listingID}/submit [post]
+func (app *application) submitListingHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user.CompanyID == nil || (user.Role.Name != store.RoleAgency && user.Role.Name != store.RoleDeveloper) {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	listingID, err := strconv.ParseInt(chi.URLParam(r, "listingID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	listing, err := app.store.Listings.GetByID(r.Context(), listingID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	if listing.CompanyID != *user.CompanyID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+	if listing.Status != store.ListingStatusDraft {
+		app.conflictResponse(w, r, fmt.Errorf("only drafts can be submitted"))
+		return
+	}
+
+	if err := app.store.Listings.UpdateStatus(r.Context(), listingID, store.ListingStatusModeration); err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	listing.Status = store.ListingStatusModeration
+	app.forgetListings(listingID)
+
+	if err := app.jsonResponse(w, http.StatusOK, listing); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// runListingPublisher publishes scheduled listings as their publish_at
+// passes, until ctx is cancelled.
+func (app *application) runListingPublisher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.publishDueListings(ctx)
+		}
+	}
+}
+
+func (app *application) publishDueListings(ctx context.Context) {
+	ids, err := app.store.Listings.PublishDue(ctx)
+	if err != nil {
+		app.logger.Errorw("could not publish scheduled listings", "error", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	app.forgetListings(ids...)
+	app.invalidateFeed(ctx)
+	for _, id := range ids {
+		listing, err := app.store.Listings.GetByID(ctx, id)
+		if err != nil {
+			app.logger.Errorw("could not load published listing", "listing_id", id, "error", err)
+			continue
+		}
+		app.publishListingPublished(ctx, listing)
+	}
+	app.logger.Infow("published scheduled listings", "count", len(ids))
+}
+
+// publishListingPublished tells subscribers a listing went live, on
+// approval or at its publish_at.
+func (app *application) publishListingPublished(ctx context.Context, listing *store.Listing) {
+	app.publish(ctx, events.ListingPublished, &listing.CompanyID, listing)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDraftAndScheduledListings(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	companyID := int64(1)
+	agent := &store.User{ID: 10, Role: store.Role{Name: store.RoleAgency}, CompanyID: &companyID}
+	admin := &store.User{ID: 11, Role: store.Role{Name: store.RoleAdmin}}
+
+	inAnHour := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	listing := &store.Listing{CompanyID: companyID, Title: "Flat", DealType: "sale", Status: store.ListingStatusDraft, PublishAt: &inAnHour}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings/{listingID}", app.getListingHandler)
+	mux.Post("/v1/listings/{listingID}/submit", app.submitListingHandler)
+
+	do := func(method, path string, user *store.User) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, path, nil)
+		if user != nil {
+			req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	// A draft is the company's own.
+	checkResponseCode(t, http.StatusOK, do(http.MethodGet, "/v1/listings/1", agent))
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodGet, "/v1/listings/1", admin))
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodGet, "/v1/listings/1", nil))
+
+	checkResponseCode(t, http.StatusOK, do(http.MethodPost, "/v1/listings/1/submit", agent))
+	checkResponseCode(t, http.StatusConflict, do(http.MethodPost, "/v1/listings/1/submit", agent))
+	checkResponseCode(t, http.StatusOK, do(http.MethodGet, "/v1/listings/1", admin))
+
+	status := func() string {
+		t.Helper()
+		l, err := app.store.Listings.GetByID(ctx, listing.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l.Status
+	}
+
+	// Approved before publish_at, it waits.
+	if err := app.store.Listings.UpdateStatus(ctx, listing.ID, store.ListingStatusActive); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != store.ListingStatusScheduled {
+		t.Fatalf("expected scheduled after approval, got %q", got)
+	}
+	app.publishDueListings(ctx)
+	if got := status(); got != store.ListingStatusScheduled {
+		t.Fatalf("published before publish_at, status %q", got)
+	}
+
+	anHourAgo := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	listing.Status = store.ListingStatusScheduled
+	listing.PublishAt = &anHourAgo
+	if err := app.store.Listings.Update(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	app.publishDueListings(ctx)
+	if got := status(); got != store.ListingStatusActive {
+		t.Fatalf("expected active after publish_at, got %q", got)
+	}
+	checkResponseCode(t, http.StatusOK, do(http.MethodGet, "/v1/listings/1", nil))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Supported schema range. Override at build time with
+//
+//	-ldflags "-X main.schemaVersionMin=78 -X main.schemaVersionMax=79"
+//
+// so a binary deployed next to a newer or older database refuses to run.
+// The minimum is the oldest schema the code can query: raise it with every
+// migration the stores read or write.
+var (
+	schemaVersionMin = "78"
+	schemaVersionMax = "78"
+)
+
+var (
+	ErrSchemaDirty    = errors.New("database schema is dirty")
+	ErrSchemaTooOld   = errors.New("database schema is older than supported")
+	ErrSchemaTooNew   = errors.New("database schema is newer than supported")
+	ErrSchemaNotFound = errors.New("no migrations applied")
+)
+
+func supportedSchemaRange() (int, int, error) {
+	minVersion, err := strconv.Atoi(schemaVersionMin)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid schemaVersionMin %q", schemaVersionMin)
+	}
+
+	maxVersion, err := strconv.Atoi(schemaVersionMax)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid schemaVersionMax %q", schemaVersionMax)
+	}
+
+	return minVersion, maxVersion, nil
+}
+
+// checkSchemaVersion reads the golang-migrate bookkeeping table and verifies
+// the version falls within the range this binary was built for.
+func checkSchemaVersion(ctx context.Context, conn *sql.DB) (int, error) {
+	minVersion, maxVersion, err := supportedSchemaRange()
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	var dirty bool
+
+	err = conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrSchemaNotFound
+		}
+		return 0, err
+	}
+
+	switch {
+	case dirty:
+		return version, fmt.Errorf("%w: version %d", ErrSchemaDirty, version)
+	case version < minVersion:
+		return version, fmt.Errorf("%w: version %d, supported %d-%d", ErrSchemaTooOld, version, minVersion, maxVersion)
+	case version > maxVersion:
+		return version, fmt.Errorf("%w: version %d, supported %d-%d", ErrSchemaTooNew, version, minVersion, maxVersion)
+	}
+
+	return version, nil
+}
+
+// watchSchemaVersion re-checks the schema periodically. When the database is
+// migrated out from under a running instance (blue/green deploys) the API
+// stops accepting writes until the schema is compatible again.
+func (app *application) watchSchemaVersion(ctx context.Context, conn *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			version, err := checkSchemaVersion(checkCtx, conn)
+			cancel()
+
+			// a query that failed says nothing about the schema; keep the
+			// state of the last check that succeeded
+			if err != nil && !isSchemaMismatch(err) {
+				app.logger.Warnw("could not check schema version", "error", err)
+				continue
+			}
+
+			incompatible := err != nil
+			if app.schemaIncompatible.Swap(incompatible) != incompatible {
+				if incompatible {
+					app.logger.Errorw("schema incompatible; rejecting writes", "version", version, "error", err)
+				} else {
+					app.logger.Infow("schema compatible again; accepting writes", "version", version)
+				}
+			}
+		}
+	}
+}
+
+// isSchemaMismatch reports whether err from checkSchemaVersion is about the
+// schema itself rather than the query that read it.
+func isSchemaMismatch(err error) bool {
+	return errors.Is(err, ErrSchemaDirty) || errors.Is(err, ErrSchemaTooOld) ||
+		errors.Is(err, ErrSchemaTooNew) || errors.Is(err, ErrSchemaNotFound)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/cmd/migrate/migrations"
+)
+
+func TestSchemaVersionRange(t *testing.T) {
+	files, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newest := 0
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(file, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			t.Fatalf("migration %s: bad version", file)
+		}
+		newest = max(newest, version)
+	}
+
+	minVersion, maxVersion, err := supportedSchemaRange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxVersion != newest {
+		t.Errorf("schemaVersionMax is %d, the newest migration is %d", maxVersion, newest)
+	}
+	// every migration so far adds something the stores query, so a database
+	// behind the newest one fails requests instead of being refused at start
+	if minVersion < newest {
+		t.Errorf("schemaVersionMin is %d, the code queries migration %d", minVersion, newest)
+	}
+}
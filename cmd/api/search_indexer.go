@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// The listing hashtags are the API's search index. Handlers do not write
+// them: the indexer is subscribed to the listing events and a worker
+// re-extracts the tags of each listing in the background, so a slow or
+// failing index never holds up or fails a save. A listing that is queued
+// twice before the worker gets to it is indexed once. Deleted listings
+// lose their tags with the row, so the worker only skips them.
+//
+// Events are dropped when the queue is full; socialctl reindex catches the
+// index up.
+const searchIndexQueue = 1024
+
+type searchIndexer struct {
+	queue chan int64
+}
+
+func newSearchIndexer() *searchIndexer {
+	return &searchIndexer{queue: make(chan int64, searchIndexQueue)}
+}
+
+// listingEventID returns the listing an event is about.
+func listingEventID(e events.Event) (int64, bool) {
+	switch data := e.Data.(type) {
+	case *store.Listing:
+		return data.ID, true
+	case listingDeletedEvent:
+		return data.ID, true
+	}
+	return 0, false
+}
+
+// listingDeletedEvent is the listing.deleted payload.
+type listingDeletedEvent struct {
+	ID int64 `json:"id"`
+}
+
+// queueIndex is the bus handler of the listing events.
+func (app *application) queueIndex(_ context.Context, e events.Event) error {
+	id, ok := listingEventID(e)
+	if !ok {
+		return nil
+	}
+	select {
+	case app.indexer.queue <- id:
+	default:
+		app.logger.Warnw("search index queue is full, run socialctl reindex", "listing_id", id, "event", e.Type)
+	}
+	return nil
+}
+
+// runSearchIndexer indexes queued listings until ctx is cancelled.
+func (app *application) runSearchIndexer(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-app.indexer.queue:
+			app.indexListings(ctx, app.drainIndexQueue(id))
+		}
+	}
+}
+
+// drainIndexQueue takes what else is queued, so listings saved several
+// times in a burst are indexed once. It returns the distinct IDs, first
+// included.
+func (app *application) drainIndexQueue(first int64) []int64 {
+	seen := map[int64]bool{first: true}
+	ids := []int64{first}
+	for {
+		select {
+		case id := <-app.indexer.queue:
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		default:
+			return ids
+		}
+	}
+}
+
+func (app *application) indexListings(ctx context.Context, ids []int64) {
+	for _, id := range ids {
+		listing, err := app.store.Listings.GetByID(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			app.logger.Warnw("could not load listing to index", "listing_id", id, "error", err)
+			continue
+		}
+		app.setListingTags(ctx, listing)
+	}
+}
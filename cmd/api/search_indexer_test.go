@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestSearchIndexer(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	listing := &store.Listing{CompanyID: 1, Title: "Flat #parking", DealType: "sale", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	tagged := func(tag string) int {
+		t.Helper()
+		listings, err := app.store.Listings.List(ctx, store.ListingFilter{Status: store.ListingStatusActive, Tag: tag})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(listings)
+	}
+	index := func() {
+		t.Helper()
+		select {
+		case id := <-app.indexer.queue:
+			app.indexListings(ctx, app.drainIndexQueue(id))
+		default:
+			t.Fatal("nothing was queued")
+		}
+	}
+
+	app.publish(ctx, events.ListingCreated, &listing.CompanyID, listing)
+	if n := tagged("parking"); n != 0 {
+		t.Fatalf("tagged before the indexer ran: %d", n)
+	}
+	index()
+	if n := tagged("parking"); n != 1 {
+		t.Fatalf("listings tagged parking after create: %d", n)
+	}
+
+	// two edits in a row are indexed once, with the latest text
+	listing.Title = "Flat #pets"
+	if err := app.store.Listings.Update(ctx, listing); err != nil {
+		t.Fatal(err)
+	}
+	app.publish(ctx, events.ListingUpdated, &listing.CompanyID, listing)
+	app.publish(ctx, events.ListingUpdated, &listing.CompanyID, listing)
+	if ids := app.drainIndexQueue(<-app.indexer.queue); len(ids) != 1 {
+		t.Fatalf("queued %v, want the listing once", ids)
+	}
+	app.publish(ctx, events.ListingUpdated, &listing.CompanyID, listing)
+	index()
+	if tagged("parking") != 0 || tagged("pets") != 1 {
+		t.Errorf("after edit: parking %d, pets %d", tagged("parking"), tagged("pets"))
+	}
+
+	if err := app.store.Listings.Delete(ctx, listing.ID); err != nil {
+		t.Fatal(err)
+	}
+	app.publish(ctx, events.ListingDeleted, &listing.CompanyID, listingDeletedEvent{ID: listing.ID})
+	// the listing is gone, so there is nothing to index
+	index()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// adminListSentEmailsHandler godoc
+//
+//	@Summary		Lists the emails sent to an address
+//	@Description	Returns the emails the mail provider accepted for the address, newest first, with the provider's message ID to look them up in its logs
+//	@Tags			admin
+//	@Produce		json
+//	@Param			email	query		string	true	"Recipient address"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		store.SentEmail
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/sent-emails [get]
+func (app *application) adminListSentEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		app.badRequestResponse(w, r, errors.New("email is required"))
+		return
+	}
+
+	fq := store.PaginatedQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	sent, err := app.store.SentEmails.ListByEmail(r.Context(), email, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, sent); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxServerErrors is how many recent 500 responses can be looked up by ID.
+const maxServerErrors = 1000
+
+// ServerError is a 500 response as recorded for support. Error has the same
+// secrets removed as the logs.
+type ServerError struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	RequestID string    `json:"request_id,omitempty"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Error     string    `json:"error"`
+}
+
+var serverErrors = newServerErrorLog(maxServerErrors)
+
+// serverErrorLog keeps the most recent server errors in memory, so they are
+// only found on the instance that served the request and are lost on
+// restart. The log line carries the same error_id for older errors.
+type serverErrorLog struct {
+	mu     sync.Mutex
+	limit  int
+	order  []string
+	byID   map[string]ServerError
+	redact *redactor
+}
+
+func newServerErrorLog(limit int) *serverErrorLog {
+	return &serverErrorLog{
+		limit:  limit,
+		byID:   make(map[string]ServerError, limit),
+		redact: newRedactor(),
+	}
+}
+
+// record stores err under a new ID and returns it.
+func (l *serverErrorLog) record(r *http.Request, err error) string {
+	entry := ServerError{
+		ID:        newErrorID(),
+		Time:      time.Now().UTC(),
+		Method:    r.Method,
+		Path:      l.redact.string(r.URL.Path),
+		RequestID: middleware.GetReqID(r.Context()),
+		Error:     l.redact.string(err.Error()),
+	}
+	if user := getUserFromContext(r); user != nil {
+		entry.UserID = user.ID
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.byID[entry.ID] = entry
+	l.order = append(l.order, entry.ID)
+	if len(l.order) > l.limit {
+		delete(l.byID, l.order[0])
+		l.order = l.order[1:]
+	}
+	return entry.ID
+}
+
+func (l *serverErrorLog) get(id string) (ServerError, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.byID[id]
+	return entry, ok
+}
+
+// newErrorID returns a short random ID. It stays below the length of the
+// hex strings the log redactor hides, so it remains searchable in logs.
+func newErrorID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// getServerErrorHandler godoc
+//
+//	@Summary		Look up a server error
+//	@Description	Returns the request behind the error_id of a 500 response: time, route, request ID, user and the error. Only recent errors served by this instance are kept; search the logs for error_id otherwise.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			errorID	path		string	true	"Error ID"
+//	@Success		200		{object}	ServerError
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/errors/{errorID} [get]
+func (app *application) getServerErrorHandler(r *http.Request, _ *noBody) (*ServerError, error) {
+	entry, ok := serverErrors.get(chi.URLParam(r, "errorID"))
+	if !ok {
+		return nil, newHTTPError(http.StatusNotFound, "error not found")
+	}
+	return &entry, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// The services hold no state of their own, so they are built from the
+// application's store and config when used; tests swap both after the
+// application is constructed.
+
+// authService mails activation links for client, in locale; see
+// activationClient.
+func (app *application) authService(client, locale string) service.AuthService {
+	return service.NewAuth(service.AuthOptions{
+		Store:             app.store,
+		RequireActivation: app.config.auth.requireActivation,
+		Tokens:            app.tokens,
+		ActivationEmail:   app.welcomeEmail(client, locale),
+		BannedUsername:    app.bannedUsername,
+	})
+}
+
+func (app *application) userService() service.UserService {
+	opts := service.UsersOptions{
+		Store: app.store,
+		OnCacheError: func(userID int64, err error) {
+			cacheErrors.Add(1)
+			app.logger.Warnw("user cache unavailable, using the database", "user_id", userID, "error", err)
+		},
+	}
+	if app.config.redisCfg.enabled {
+		opts.Cache = app.cacheStorage.Users
+	}
+	return service.NewUsers(opts)
+}
+
+func (app *application) listingService() service.ListingService {
+	return service.NewListings(service.ListingsOptions{
+		Store: app.store,
+		Created: func(ctx context.Context, listing *store.Listing) {
+			app.queueLinkPreviews(ctx, listing)
+			app.invalidateFeed(ctx)
+			app.publish(ctx, events.ListingCreated, &listing.CompanyID, listing)
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+const (
+	defaultTrendDays  = 7
+	maxTrendDays      = 30
+	defaultTrendLimit = 10
+	maxTrendLimit     = 50
+)
+
+// setListingTags stores the hashtags of the listing's title and description.
+// Tags only help discovery, so a failure is logged and does not fail the
+// request that saved the listing.
+func (app *application) setListingTags(ctx context.Context, listing *store.Listing) {
+	tags := service.ListingTags(listing)
+	if err := app.store.Tags.Set(ctx, listing.ID, tags); err != nil {
+		app.logger.Warnw("could not save listing tags", "listing_id", listing.ID, "error", err)
+	}
+}
+
+// trendingTagsHandler godoc
+//
+//	@Summary		Trending hashtags
+//	@Description	Hashtags added to the most active listings over the last days (default 7, max 30), counted in the caller's region unless region is given
+//	@Tags			listings
+//	@Produce		json
+//	@Param			days	query		int	false	"Number of days"
+//	@Param			limit	query		int	false	"Number of tags (default 10, max 50)"
+//	@Param			region	query		string	false	"Country code, or all for every region"
+//	@Success		200		{array}		store.TagCount
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/tags/trending [get]
+func (app *application) trendingTagsHandler(r *http.Request, _ *noBody) ([]store.TagCount, error) {
+	days, limit := defaultTrendDays, defaultTrendLimit
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendDays {
+			return nil, newHTTPError(http.StatusBadRequest, "days must be between 1 and 30")
+		}
+		days = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendLimit {
+			return nil, newHTTPError(http.StatusBadRequest, "limit must be between 1 and 50")
+		}
+		limit = n
+	}
+
+	region, err := rankingRegion(r)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	return app.store.Tags.Trending(r.Context(), since, region, limit)
+}
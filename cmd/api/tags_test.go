@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTagBrowsing(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	for _, desc := range []string{"Near the sea #parking #pets", "Downtown #parking", "Draft #parking"} {
+		status := store.ListingStatusActive
+		if desc == "Draft #parking" {
+			status = "draft"
+		}
+		listing := &store.Listing{CompanyID: 1, Title: "Flat", Description: desc, DealType: "sale", Status: status}
+		if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		app.setListingTags(ctx, listing)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/tags/trending", handle(app, http.StatusOK, app.trendingTagsHandler))
+	mux.Get("/v1/tags/{tag}/listings", app.listListingsHandler)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/tags/Parking/listings", nil)
+	resp := executeRequest(req, mux).Result()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+	var listings struct {
+		Data []store.Listing `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listings); err != nil {
+		t.Fatal(err)
+	}
+	if len(listings.Data) != 2 {
+		t.Errorf("expected the 2 active listings tagged #parking, got %d", len(listings.Data))
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/tags/trending?days=1", nil)
+	resp = executeRequest(req, mux).Result()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+	var trending struct {
+		Data []store.TagCount `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&trending); err != nil {
+		t.Fatal(err)
+	}
+	want := []store.TagCount{{Tag: "parking", Listings: 2}, {Tag: "pets", Listings: 1}}
+	if !reflect.DeepEqual(trending.Data, want) {
+		t.Errorf("trending = %+v, want %+v", trending.Data, want)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/tags/trending?days=90", nil)
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+}
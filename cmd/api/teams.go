@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// teamInviteTTL matches the registration invites admins make.
+const teamInviteTTL = 7 * 24 * time.Hour
+
+var errNotTeamMember = newHTTPError(http.StatusForbidden, "you are not a member of a company")
+
+type TeamInvitePayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Role  string `json:"role" validate:"required,oneof=manager agent"`
+}
+
+type TeamInviteResponse struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type JoinTeamPayload struct {
+	Token string `json:"token" validate:"required,max=64"`
+}
+
+type UpdateTeamMemberPayload struct {
+	Role string `json:"role" validate:"required,oneof=owner manager agent"`
+}
+
+// Team is the company the caller belongs to and their role in it.
+type Team struct {
+	CompanyID int64  `json:"company_id"`
+	Role      string `json:"role"`
+}
+
+// team returns the caller's company and role in its team.
+func (app *application) team(r *http.Request) (*Team, error) {
+	user := getUserFromContext(r)
+	if user.CompanyID == nil {
+		return nil, errNotTeamMember
+	}
+
+	role, err := app.store.Teams.Role(r.Context(), *user.CompanyID, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, errNotTeamMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Team{CompanyID: *user.CompanyID, Role: role}, nil
+}
+
+func teamMemberID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		return 0, newHTTPError(http.StatusBadRequest, "invalid user ID")
+	}
+	return id, nil
+}
+
+// dropCachedUser makes a change to the user's company or role apply to their
+// next request.
+func (app *application) dropCachedUser(r *http.Request, userID int64) {
+	app.userService().Forget(r.Context(), userID)
+	app.forgetProfile(userID)
+}
+
+// listTeamMembersHandler godoc
+//
+//	@Summary		List my team
+//	@Description	Members of the caller's company with their team role, owners first
+//	@Tags			teams
+//	@Produce		json
+//	@Success		200	{array}		store.TeamMember
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/members [get]
+func (app *application) listTeamMembersHandler(r *http.Request, _ *noBody) ([]store.TeamMember, error) {
+	team, err := app.team(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.store.Teams.Members(r.Context(), team.CompanyID)
+}
+
+// inviteTeamMemberHandler godoc
+//
+//	@Summary		Invite someone to my team
+//	@Description	Emails a link to join the caller's company as manager or agent, valid for 7 days. Owners invite both; managers invite agents.
+//	@Tags			teams
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		TeamInvitePayload	true	"Invite"
+//	@Success		201		{object}	TeamInviteResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/invites [post]
+func (app *application) inviteTeamMemberHandler(r *http.Request, payload *TeamInvitePayload) (*TeamInviteResponse, error) {
+	team, err := app.team(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case team.Role == store.TeamRoleOwner:
+	case team.Role == store.TeamRoleManager && payload.Role == store.TeamRoleAgent:
+	default:
+		return nil, newHTTPError(http.StatusForbidden, "your team role cannot invite "+payload.Role+"s")
+	}
+
+	address, err := app.checkEmail(r.Context(), payload.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	company, err := app.store.Companies.GetByID(ctx, team.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	inviter := getUserFromContext(r)
+	invite := &store.RegistrationInvite{
+		Token:       token,
+		CompanyType: company.Type,
+		CompanyID:   &company.ID,
+		Email:       address,
+		TeamRole:    payload.Role,
+		CreatedBy:   inviter.ID,
+		ExpiresAt:   time.Now().Add(teamInviteTTL),
+	}
+
+	inviterName := strings.TrimSpace(inviter.FirstName + " " + inviter.LastName)
+	if inviterName == "" {
+		inviterName = inviter.Username
+	}
+	data, err := json.Marshal(struct {
+		InviterName string
+		CompanyName string
+		TeamRole    string
+		JoinURL     string
+		ExpiresIn   string
+	}{
+		InviterName: inviterName,
+		CompanyName: company.Name,
+		TeamRole:    payload.Role,
+		JoinURL:     fmt.Sprintf("%s/join/%s", strings.TrimRight(app.config.frontendURL, "/"), token),
+		ExpiresIn:   fmt.Sprintf("%d days", int(teamInviteTTL/(24*time.Hour))),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.store.Teams.Invite(ctx, invite, &store.OutboxEmail{
+		Template: mailer.TeamInvitationTemplate,
+		Username: address,
+		Email:    address,
+		Data:     data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TeamInviteResponse{ID: invite.ID, Email: invite.Email, Role: invite.TeamRole, ExpiresAt: invite.ExpiresAt}, nil
+}
+
+// joinTeamHandler godoc
+//
+//	@Summary		Accept a team invite
+//	@Description	Makes the caller a member of the inviting company with its company type as their role. The invite must be for the caller's email, and only users outside a company can join.
+//	@Tags			teams
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		JoinTeamPayload	true	"Invite token"
+//	@Success		200		{object}	Team
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		410		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/join [post]
+func (app *application) joinTeamHandler(r *http.Request, payload *JoinTeamPayload) (*Team, error) {
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	invite, err := app.store.Invites.GetByToken(ctx, payload.Token)
+	if errors.Is(err, store.ErrInviteNotFound) {
+		return nil, newHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Invites for other addresses look like unknown ones so tokens cannot
+	// be probed.
+	if invite.CompanyID == nil || !strings.EqualFold(invite.Email, user.Email) {
+		return nil, newHTTPError(http.StatusNotFound, store.ErrInviteNotFound.Error())
+	}
+	if invite.UsedAt != nil || time.Now().After(invite.ExpiresAt) {
+		return nil, newHTTPError(http.StatusGone, "the invite was used or has expired")
+	}
+
+	err = app.store.Teams.Join(ctx, invite, user.ID)
+	switch {
+	case errors.Is(err, store.ErrInviteAlreadyUsed):
+		return nil, newHTTPError(http.StatusGone, "the invite was used or has expired")
+	case errors.Is(err, store.ErrNotJoinable):
+		return nil, newHTTPError(http.StatusConflict, err.Error())
+	case err != nil:
+		return nil, err
+	}
+
+	app.dropCachedUser(r, user.ID)
+	return &Team{CompanyID: *invite.CompanyID, Role: invite.TeamRole}, nil
+}
+
+// updateTeamMemberHandler godoc
+//
+//	@Summary		Change a team member's role
+//	@Description	Owners make members owner, manager or agent. Owners cannot change their own role, so a team always keeps an owner.
+//	@Tags			teams
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int						true	"User ID"
+//	@Param			payload	body		UpdateTeamMemberPayload	true	"Role"
+//	@Success		200		{object}	Team
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/members/{userID} [patch]
+func (app *application) updateTeamMemberHandler(r *http.Request, payload *UpdateTeamMemberPayload) (*Team, error) {
+	userID, err := teamMemberID(r)
+	if err != nil {
+		return nil, err
+	}
+	team, err := app.team(r)
+	if err != nil {
+		return nil, err
+	}
+	if team.Role != store.TeamRoleOwner {
+		return nil, newHTTPError(http.StatusForbidden, "only owners change team roles")
+	}
+	if userID == getUserFromContext(r).ID {
+		return nil, newHTTPError(http.StatusBadRequest, "owners cannot change their own role")
+	}
+
+	if err := app.store.Teams.SetRole(r.Context(), team.CompanyID, userID, payload.Role); err != nil {
+		return nil, err
+	}
+	return &Team{CompanyID: team.CompanyID, Role: payload.Role}, nil
+}
+
+// removeTeamMemberHandler godoc
+//
+//	@Summary		Remove a team member
+//	@Description	Takes the user out of the company and back to a regular account. Owners remove managers and agents, managers remove agents and anyone but an owner can leave. Owners must be made manager or agent first.
+//	@Tags			teams
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	Team
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/members/{userID} [delete]
+func (app *application) removeTeamMemberHandler(r *http.Request, _ *noBody) (*Team, error) {
+	userID, err := teamMemberID(r)
+	if err != nil {
+		return nil, err
+	}
+	team, err := app.team(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	role, err := app.store.Teams.Role(ctx, team.CompanyID, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case role == store.TeamRoleOwner:
+		return nil, newHTTPError(http.StatusBadRequest, "owners must be made manager or agent before they leave")
+	case userID == getUserFromContext(r).ID:
+	case team.Role == store.TeamRoleOwner:
+	case team.Role == store.TeamRoleManager && role == store.TeamRoleAgent:
+	default:
+		return nil, newHTTPError(http.StatusForbidden, "your team role cannot remove "+role+"s")
+	}
+
+	if err := app.store.Teams.Remove(ctx, team.CompanyID, userID); err != nil {
+		return nil, err
+	}
+	app.dropCachedUser(r, userID)
+	return &Team{CompanyID: team.CompanyID, Role: role}, nil
+}
+
+// listTeamListingsHandler godoc
+//
+//	@Summary		List my team's listings
+//	@Description	The company's listings in any status, for its members. Defaults to active; pass status=draft, moderation or scheduled for work in progress.
+//	@Tags			teams
+//	@Produce		json
+//	@Param			status	query		string	false	"Listing status"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{array}		store.Listing
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/listings [get]
+func (app *application) listTeamListingsHandler(r *http.Request, _ *noBody) (paged[store.Listing], error) {
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.Listing]{}, err
+	}
+	team, err := app.team(r)
+	if err != nil {
+		return paged[store.Listing]{}, err
+	}
+
+	listings, err := app.store.Listings.List(r.Context(), store.ListingFilter{
+		Limit:     params.Limit,
+		Offset:    params.Offset,
+		Status:    r.URL.Query().Get("status"),
+		CompanyID: &team.CompanyID,
+	})
+	if errors.Is(err, store.ErrInvalidFilter) {
+		return paged[store.Listing]{}, newHTTPError(http.StatusBadRequest, "invalid status")
+	}
+	if err != nil {
+		return paged[store.Listing]{}, err
+	}
+	return newPage(params, listings), nil
+}
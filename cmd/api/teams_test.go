@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTeams(t *testing.T) {
+	app, mail := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	company := &store.Company{Name: "Acme Realty", RegistrationNumber: "42", Email: "office@acme.example", Type: store.RoleAgency}
+	owner := &store.User{Username: "olga", Email: "office@acme.example", Role: store.Role{Name: store.RoleAgency}}
+	if err := app.store.Users.CreateCompanyAndUser(ctx, company, owner, "token", time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	agent := &store.User{Username: "alex", Email: "alex@example.com", IsActive: true}
+	outsider := &store.User{Username: "otto", Email: "otto@example.com", IsActive: true}
+	for _, u := range []*store.User{agent, outsider} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/members", handle(app, http.StatusOK, app.listTeamMembersHandler))
+	mux.Post("/invites", handle(app, http.StatusCreated, app.inviteTeamMemberHandler))
+	mux.Post("/join", handle(app, http.StatusOK, app.joinTeamHandler))
+	mux.Delete("/members/{userID}", handle(app, http.StatusOK, app.removeTeamMemberHandler))
+
+	do := func(user *store.User, method, path, body string) int {
+		t.Helper()
+		user, err := app.store.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), user)), mux).Code
+	}
+
+	checkResponseCode(t, http.StatusForbidden, do(outsider, http.MethodGet, "/members", ""))
+	checkResponseCode(t, http.StatusCreated, do(owner, http.MethodPost, "/invites", `{"email":"alex@example.com","role":"agent"}`))
+
+	app.relayOutbox(ctx)
+	var token string
+	for _, m := range mail.Sent() {
+		if m.Template == mailer.TeamInvitationTemplate {
+			raw, _ := json.Marshal(m.Data)
+			var data struct{ JoinURL string }
+			if err := json.Unmarshal(raw, &data); err != nil {
+				t.Fatal(err)
+			}
+			token = data.JoinURL[strings.LastIndex(data.JoinURL, "/")+1:]
+		}
+	}
+	if token == "" {
+		t.Fatal("no team invitation sent")
+	}
+
+	// the invite only works for the address it was sent to, once
+	checkResponseCode(t, http.StatusNotFound, do(outsider, http.MethodPost, "/join", `{"token":"`+token+`"}`))
+	checkResponseCode(t, http.StatusOK, do(agent, http.MethodPost, "/join", `{"token":"`+token+`"}`))
+	checkResponseCode(t, http.StatusGone, do(agent, http.MethodPost, "/join", `{"token":"`+token+`"}`))
+
+	members, err := app.store.Teams.Members(ctx, company.ID)
+	if err != nil || len(members) != 2 || members[0].Role != store.TeamRoleOwner || members[1].Role != store.TeamRoleAgent {
+		t.Fatalf("members %+v, %v", members, err)
+	}
+	joined, _ := app.store.Users.GetByID(ctx, agent.ID)
+	if joined.CompanyID == nil || *joined.CompanyID != company.ID || joined.Role.Name != store.RoleAgency {
+		t.Fatalf("agent after joining: %+v", joined)
+	}
+
+	// agents cannot invite, and nobody removes the owner
+	checkResponseCode(t, http.StatusForbidden, do(agent, http.MethodPost, "/invites", `{"email":"otto@example.com","role":"agent"}`))
+	checkResponseCode(t, http.StatusBadRequest, do(agent, http.MethodDelete, "/members/"+strconv.FormatInt(owner.ID, 10), ""))
+
+	checkResponseCode(t, http.StatusOK, do(owner, http.MethodDelete, "/members/"+strconv.FormatInt(agent.ID, 10), ""))
+	left, _ := app.store.Users.GetByID(ctx, agent.ID)
+	if left.CompanyID != nil || left.Role.Name != store.RoleUser {
+		t.Fatalf("agent after removal: %+v", left)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// tenancyConfig configures multi-tenant mode, in which one deployment hosts
+// several communities whose users and listings do not see each other. Each
+// request is scoped to the tenant named by header or, failing that, by the
+// subdomain of baseDomain it was sent to, e.g. "acme" for
+// acme.homes.example.com.
+type tenancyConfig struct {
+	enabled bool
+	// header carries the tenant slug, e.g. X-Tenant; empty ignores it
+	header string
+	// baseDomain is the domain tenants are subdomains of; empty ignores
+	// the Host
+	baseDomain string
+	// defaultSlug is the tenant of requests that name none; empty rejects
+	// them with 400
+	defaultSlug string
+}
+
+// validate checks that an enabled tenancy config can name a tenant.
+func (c tenancyConfig) validate() error {
+	if !c.enabled {
+		return nil
+	}
+	if c.header == "" && c.baseDomain == "" && c.defaultSlug == "" {
+		return errors.New("TENANCY_ENABLED needs TENANCY_HEADER, TENANCY_BASE_DOMAIN or TENANCY_DEFAULT")
+	}
+	if c.defaultSlug != "" && !tenantSlug.MatchString(c.defaultSlug) {
+		return fmt.Errorf("invalid TENANCY_DEFAULT %q", c.defaultSlug)
+	}
+	return nil
+}
+
+var (
+	errTenantRequired = newHTTPError(http.StatusBadRequest, "the request does not name a tenant")
+	errTenantNotFound = newHTTPError(http.StatusNotFound, "tenant not found")
+	errWrongTenant    = errors.New("the token belongs to another tenant")
+)
+
+// tenantSlug is what a slug must look like to also work as a subdomain.
+var tenantSlug = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// tenantCache maps slugs to tenant IDs. Tenants are never removed, so a
+// slug once found stays valid.
+type tenantCache struct {
+	ids sync.Map
+}
+
+// tenantMiddleware scopes the request to its tenant while TENANCY_ENABLED
+// is set. Health checks and other tenantExempt paths are not scoped.
+func (app *application) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.tenancy.enabled || tenantExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slug := app.requestTenant(r)
+		if slug == "" {
+			app.errorResponse(w, r, errTenantRequired)
+			return
+		}
+		tenantID, err := app.tenantID(r, slug)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(reqctx.WithTenant(r.Context(), tenantID)))
+	})
+}
+
+// requestTenant returns the slug of the tenant the request names: the
+// tenant header, the subdomain of TENANCY_BASE_DOMAIN or the default, in
+// that order.
+func (app *application) requestTenant(r *http.Request) string {
+	cfg := app.config.tenancy
+	if cfg.header != "" {
+		if slug := strings.ToLower(strings.TrimSpace(r.Header.Get(cfg.header))); slug != "" {
+			return slug
+		}
+	}
+
+	if cfg.baseDomain != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if sub, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(cfg.baseDomain)); ok && !strings.Contains(sub, ".") {
+			return sub
+		}
+	}
+
+	return cfg.defaultSlug
+}
+
+func (app *application) tenantID(r *http.Request, slug string) (int64, error) {
+	if id, ok := app.tenants.ids.Load(slug); ok {
+		return id.(int64), nil
+	}
+	if !tenantSlug.MatchString(slug) {
+		return 0, errTenantNotFound
+	}
+
+	tenant, err := app.store.Tenants.GetBySlug(r.Context(), slug)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, errTenantNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	app.tenants.ids.Store(slug, tenant.ID)
+	return tenant.ID, nil
+}
+
+// tenantExempt reports whether path works the same for every tenant.
+func tenantExempt(path string) bool {
+	switch unversionedPath(path) {
+	case "/health", "/version", "/debug/vars":
+		return true
+	}
+	return false
+}
+
+// checkTenant rejects a user authenticated for one tenant on a request to
+// another. Users loaded from the database already are, but the user cache
+// is not scoped.
+func checkTenant(r *http.Request, user *store.User) error {
+	if tenantID, ok := reqctx.Tenant(r.Context()); ok && user.TenantID != tenantID {
+		return errWrongTenant
+	}
+	return nil
+}
+
+type CreateTenantPayload struct {
+	// Slug names the tenant in the tenant header and as a subdomain
+	Slug string `json:"slug" validate:"required,max=63"`
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+// adminCreateTenantHandler godoc
+//
+//	@Summary		Create a tenant
+//	@Description	Adds a community to a multi-tenant deployment. Only admins of the default tenant manage tenants. A slug that is taken answers 409.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateTenantPayload	true	"Tenant"
+//	@Success		201		{object}	store.Tenant
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/tenants [post]
+func (app *application) adminCreateTenantHandler(r *http.Request, payload *CreateTenantPayload) (*store.Tenant, error) {
+	if err := app.requireDefaultTenant(r); err != nil {
+		return nil, err
+	}
+
+	slug := strings.ToLower(payload.Slug)
+	if !tenantSlug.MatchString(slug) {
+		return nil, newHTTPError(http.StatusBadRequest, "slug must be lowercase letters, digits and dashes")
+	}
+
+	tenant := &store.Tenant{Slug: slug, Name: payload.Name}
+	if err := app.store.Tenants.Create(r.Context(), tenant); err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// adminListTenantsHandler godoc
+//
+//	@Summary		List tenants
+//	@Description	The communities hosted by the deployment, oldest first. Only admins of the default tenant manage tenants.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		store.Tenant
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/tenants [get]
+func (app *application) adminListTenantsHandler(r *http.Request, _ *noBody) ([]store.Tenant, error) {
+	if err := app.requireDefaultTenant(r); err != nil {
+		return nil, err
+	}
+	return app.store.Tenants.List(r.Context())
+}
+
+// requireDefaultTenant keeps tenant management, and the administration of
+// what every tenant shares, with the operators of the deployment rather
+// than the admins of each community.
+func (app *application) requireDefaultTenant(r *http.Request) error {
+	if app.config.tenancy.enabled && getUserFromContext(r).TenantID != store.DefaultTenantID {
+		return newHTTPError(http.StatusForbidden, "this is managed from the default tenant")
+	}
+	return nil
+}
+
+// requireDefaultTenantMiddleware applies requireDefaultTenant to every
+// route it wraps.
+func (app *application) requireDefaultTenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := app.requireDefaultTenant(r); err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{tenancy: tenancyConfig{
+		enabled:    true,
+		header:     "X-Tenant",
+		baseDomain: "homes.example.com",
+	}})
+	acme := &store.Tenant{Slug: "acme", Name: "Acme"}
+	if err := app.store.Tenants.Create(context.Background(), acme); err != nil {
+		t.Fatal(err)
+	}
+
+	var tenantID int64
+	var scoped bool
+	handler := app.tenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, scoped = reqctx.Tenant(r.Context())
+	}))
+	serve := func(host, header, path string) int {
+		tenantID, scoped = 0, false
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		if header != "" {
+			req.Header.Set("X-Tenant", header)
+		}
+		return executeRequest(req, handler).Code
+	}
+
+	if code := serve("acme.homes.example.com:8080", "", "/v1/listings"); code != http.StatusOK || tenantID != acme.ID {
+		t.Errorf("subdomain: got %d, tenant %d", code, tenantID)
+	}
+	if code := serve("api.example.com", "Default", "/v1/listings"); code != http.StatusOK || tenantID != store.DefaultTenantID {
+		t.Errorf("header: got %d, tenant %d", code, tenantID)
+	}
+	if code := serve("api.example.com", "", "/v1/listings"); code != http.StatusBadRequest {
+		t.Errorf("no tenant: got %d, want 400", code)
+	}
+	if code := serve("nope.homes.example.com", "", "/v1/listings"); code != http.StatusNotFound {
+		t.Errorf("unknown tenant: got %d, want 404", code)
+	}
+	if code := serve("api.example.com", "", "/v1/health"); code != http.StatusOK || scoped {
+		t.Errorf("health check: got %d, scoped %v", code, scoped)
+	}
+
+	app.config.tenancy.defaultSlug = "acme"
+	if code := serve("api.example.com", "", "/v1/listings"); code != http.StatusOK || tenantID != acme.ID {
+		t.Errorf("default: got %d, tenant %d", code, tenantID)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	users := app.store.Users
+	acme := &store.Tenant{Slug: "acme", Name: "Acme"}
+	if err := app.store.Tenants.Create(context.Background(), acme); err != nil {
+		t.Fatal(err)
+	}
+	defaultCtx := store.WithTenant(context.Background(), store.DefaultTenantID)
+	acmeCtx := store.WithTenant(context.Background(), acme.ID)
+
+	// the same email and username can register once per tenant
+	first := &store.User{Username: "ali", Email: "ali@example.com", IsActive: true}
+	if err := users.Create(defaultCtx, nil, first); err != nil {
+		t.Fatal(err)
+	}
+	second := &store.User{Username: "ali", Email: "ali@example.com", IsActive: true}
+	if err := users.Create(acmeCtx, nil, second); err != nil {
+		t.Fatalf("second tenant: %v", err)
+	}
+	if second.TenantID != acme.ID {
+		t.Errorf("created in tenant %d", second.TenantID)
+	}
+	err := users.Create(acmeCtx, nil, &store.User{Username: "ALI", Email: "other@example.com"})
+	if !errors.Is(err, store.ErrDuplicateUsername) {
+		t.Errorf("duplicate username in a tenant: got %v", err)
+	}
+
+	if u, err := users.GetByEmail(acmeCtx, "ali@example.com"); err != nil || u.ID != second.ID {
+		t.Errorf("got %+v, %v", u, err)
+	}
+	if _, err := users.GetByID(acmeCtx, first.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("user of another tenant: got %v", err)
+	}
+	if count, _ := users.Count(acmeCtx, store.PaginatedQuery{}); count != 1 {
+		t.Errorf("acme has %d users", count)
+	}
+	// background jobs see every tenant
+	if count, _ := users.Count(context.Background(), store.PaginatedQuery{}); count != 2 {
+		t.Errorf("unscoped count %d", count)
+	}
+
+	listing := &store.Listing{Title: "Loft", DealType: "rent", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(acmeCtx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.store.Listings.GetByID(defaultCtx, listing.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("listing of another tenant: got %v", err)
+	}
+	if listings, _ := app.store.Listings.List(defaultCtx, store.ListingFilter{}); len(listings) != 0 {
+		t.Errorf("default tenant sees %+v", listings)
+	}
+	if listings, _ := app.store.Listings.List(acmeCtx, store.ListingFilter{}); len(listings) != 1 {
+		t.Errorf("acme sees %+v", listings)
+	}
+
+	// companies and their registration numbers are per tenant too
+	company := &store.Company{Name: "Realty", RegistrationNumber: "123456789012", Email: "office@realty.example", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(defaultCtx, nil, company); err != nil {
+		t.Fatal(err)
+	}
+	twin := &store.Company{Name: "Realty", RegistrationNumber: "123456789012", Email: "office@realty.example", Type: store.RoleAgency}
+	if err := app.store.Companies.Create(acmeCtx, nil, twin); err != nil {
+		t.Fatalf("second tenant: %v", err)
+	}
+	err = app.store.Companies.Create(acmeCtx, nil, &store.Company{Name: "Copy", RegistrationNumber: "123456789012", Email: "copy@realty.example"})
+	if !errors.Is(err, store.ErrDuplicateRegistrationNumber) {
+		t.Errorf("duplicate registration number in a tenant: got %v", err)
+	}
+	if _, err := app.store.Companies.GetByID(acmeCtx, company.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("company of another tenant: got %v", err)
+	}
+	if c, err := app.store.Companies.GetByRegistrationNumber(acmeCtx, "123456789012"); err != nil || c.ID != twin.ID {
+		t.Errorf("got %+v, %v", c, err)
+	}
+	if companies, _ := app.store.Companies.List(acmeCtx, store.PaginatedFeedQuery{Limit: 10}); len(companies) != 1 {
+		t.Errorf("acme sees %+v", companies)
+	}
+	if stats, _ := app.store.AdminStats.GetOverview(acmeCtx); stats.TotalUsers != 1 || stats.TotalCompanies != 1 || stats.TotalListings != 1 {
+		t.Errorf("acme stats %+v", stats)
+	}
+
+	// a token of one tenant is refused on another's requests
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+	if err := checkTenant(req.WithContext(acmeCtx), first); !errors.Is(err, errWrongTenant) {
+		t.Errorf("got %v", err)
+	}
+	if err := checkTenant(req.WithContext(acmeCtx), second); err != nil {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestRequireDefaultTenant(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{tenancy: tenancyConfig{enabled: true, header: "X-Tenant"}})
+	handler := app.requireDefaultTenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(tenantID int64) int {
+		admin := &store.User{ID: 1, TenantID: tenantID, Role: store.Role{Name: store.RoleAdmin}}
+		req := httptest.NewRequest(http.MethodPost, "/v1/admin/roles", nil)
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), handler).Code
+	}
+
+	if code := serve(store.DefaultTenantID); code != http.StatusOK {
+		t.Errorf("an admin of the default tenant got %d", code)
+	}
+	if code := serve(2); code != http.StatusForbidden {
+		t.Errorf("an admin of another tenant got %d, want 403", code)
+	}
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/auth"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/ratelimiter"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
 	"go.uber.org/zap"
 )
 
-func newTestApplication(t *testing.T, cfg config) *application {
+func newTestApplication(t testing.TB, cfg config) *application {
 	t.Helper()
 
 	logger := zap.NewNop().Sugar()
@@ -23,20 +26,53 @@ func newTestApplication(t *testing.T, cfg config) *application {
 
 	testAuth := &auth.TestAuthenticator{}
 
+	linkTokens, err := cfg.linkTokens.issuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// Rate limiter
 	rateLimiter := ratelimiter.NewFixedWindowLimiter(
 		cfg.rateLimiter.RequestsPerTimeFrame,
 		cfg.rateLimiter.TimeFrame,
 	)
 
-	return &application{
+	app := &application{
 		logger:        logger,
 		store:         mockStore,
 		cacheStorage:  mockCacheStore,
+		mailer:        mailer.NewMockClient(),
 		authenticator: testAuth,
+		tokens:        linkTokens,
+		hot:           cfg.httpCache.hotCache(),
 		config:        cfg,
 		rateLimiter:   rateLimiter,
 	}
+	app.bus = app.newEventBus()
+	return app
+}
+
+// newMemoryTestApplication is newTestApplication backed by the in-memory
+// store, which behaves like Postgres, and a mailer that records what the
+// outbox relay sends.
+func newMemoryTestApplication(t testing.TB, cfg config) (*application, *mailer.MockClient) {
+	t.Helper()
+
+	app := newTestApplication(t, cfg)
+	app.store = store.NewMemoryStorage()
+	mail := mailer.NewMockClient()
+	app.mailer = mail
+
+	// jobs run right away, like with a worker free in production
+	cfg.jobs = jobsConfig{workers: 2, poll: 10 * time.Millisecond, lease: time.Minute, retention: time.Hour, pruneSchedule: "@daily"}
+	pool, err := app.newJobPool(cfg.jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.jobs = pool
+	pool.Start()
+	t.Cleanup(func() { pool.Shutdown(context.Background()) })
+	return app, mail
 }
 
 func executeRequest(req *http.Request, mux http.Handler) *httptest.ResponseRecorder {
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Every request gets a context deadline: REQUEST_TIMEOUT (default 60s, 0
+// sets none) or the first ROUTE_TIMEOUTS entry that matches it, e.g.
+//
+//	ROUTE_TIMEOUTS="POST /v1/listings/{listingID}/media=2m;GET /v1/admin/stats/*=2m;/v1/health=2s"
+//
+// Entries are "[METHOD ]PATH=DURATION" separated by ";", with PATH in the
+// syntax of RATE_LIMIT_POLICIES. The store and mailer work with the request
+// context, so a query or send still running at the deadline is abandoned
+// and the handler answers 504 instead of holding the connection.
+//
+// A later timeout replaces the deadline instead of only shortening it, so
+// "timeout=<duration>" in a ROUTE_MIDDLEWARE stack can give a group more
+// time than REQUEST_TIMEOUT. A ROUTE_TIMEOUTS entry is the most specific
+// and is kept.
+type routeTimeout struct {
+	routeTarget
+	timeout time.Duration
+}
+
+// parseRouteTimeouts parses ROUTE_TIMEOUTS.
+func parseRouteTimeouts(value string) ([]routeTimeout, error) {
+	var timeouts []routeTimeout
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		target, duration, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid ROUTE_TIMEOUTS entry %q", entry)
+		}
+		route, err := parseRouteTarget(target)
+		if err != nil {
+			return nil, fmt.Errorf("ROUTE_TIMEOUTS %q: %w", entry, err)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("ROUTE_TIMEOUTS %q: invalid timeout %q", entry, duration)
+		}
+		timeouts = append(timeouts, routeTimeout{routeTarget: route, timeout: timeout})
+	}
+
+	return timeouts, nil
+}
+
+// requestTimeoutMiddleware sets the deadline of the request's route, or
+// REQUEST_TIMEOUT.
+func (app *application) requestTimeoutMiddleware(timeouts []routeTimeout) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			segments := routeSegments(r.URL.Path)
+			for _, t := range timeouts {
+				if t.matches(r.Method, segments) {
+					serveWithDeadline(w, r, next, t.timeout, true)
+					return
+				}
+			}
+
+			if app.config.requestTimeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			serveWithDeadline(w, r, next, app.config.requestTimeout, false)
+		})
+	}
+}
+
+// timeoutMiddleware is "timeout=<duration>" in a middleware stack.
+func timeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveWithDeadline(w, r, next, timeout, false)
+		})
+	}
+}
+
+// requestDeadline is kept in the context of a request with a deadline, so
+// a later timeout can replace it.
+type requestDeadline struct {
+	// parent is the request context from before the first deadline
+	parent context.Context
+	// fromRoute marks a ROUTE_TIMEOUTS deadline, which stacks leave alone
+	fromRoute bool
+}
+
+type requestDeadlineKey struct{}
+
+// deadlineContext takes its deadline and cancellation from one context and
+// its values from another, so a replaced deadline keeps the values added
+// to the request since the first one was set.
+type deadlineContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c deadlineContext) Value(key any) any { return c.values.Value(key) }
+
+// serveWithDeadline runs next with a deadline timeout from now.
+func serveWithDeadline(w http.ResponseWriter, r *http.Request, next http.Handler, timeout time.Duration, fromRoute bool) {
+	parent := r.Context()
+	if d, ok := parent.Value(requestDeadlineKey{}).(requestDeadline); ok {
+		if d.fromRoute && !fromRoute {
+			next.ServeHTTP(w, r)
+			return
+		}
+		parent = d.parent
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	ctx = context.WithValue(deadlineContext{Context: ctx, values: r.Context()}, requestDeadlineKey{},
+		requestDeadline{parent: parent, fromRoute: fromRoute})
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// writeTimeout is the server's WriteTimeout, long enough for a response
+// written at the longest configured deadline.
+func (app *application) writeTimeout() time.Duration {
+	longest := app.config.requestTimeout
+
+	timeouts, _ := parseRouteTimeouts(app.config.routeTimeouts)
+	for _, t := range timeouts {
+		longest = max(longest, t.timeout)
+	}
+	overrides, _ := parseRouteMiddleware(app.config.routeMiddleware)
+	for _, names := range overrides {
+		for _, name := range names {
+			if value, ok := strings.CutPrefix(name, mwTimeoutPrefix); ok {
+				timeout, _ := time.ParseDuration(value)
+				longest = max(longest, timeout)
+			}
+		}
+	}
+
+	return max(30*time.Second, longest+5*time.Second)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestParseRouteTimeouts(t *testing.T) {
+	timeouts, err := parseRouteTimeouts("POST /v1/listings/{id}/media=2m; /v1/admin/*=30s;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(timeouts) != 2 || timeouts[0].method != http.MethodPost || timeouts[0].timeout != 2*time.Minute {
+		t.Fatalf("unexpected timeouts %+v", timeouts)
+	}
+	if !timeouts[1].matches(http.MethodGet, routeSegments("/v1/admin/users")) {
+		t.Error("expected /v1/admin/* to match")
+	}
+	if !timeouts[1].matches(http.MethodGet, routeSegments("/v2/admin/users")) {
+		t.Error("expected /v1/admin/* to cover /v2")
+	}
+
+	for _, value := range []string{"/v1/listings", "v1/listings=5s", "/v1=0s", "/v1=soon"} {
+		if _, err := parseRouteTimeouts(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+type timeoutTestKey struct{}
+
+func TestRequestTimeouts(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{requestTimeout: time.Hour})
+	timeouts, err := parseRouteTimeouts("GET /route=1m;GET /slow=10ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining time.Duration
+	var value any
+	record := func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ := r.Context().Deadline()
+		remaining = time.Until(deadline)
+		value = r.Context().Value(timeoutTestKey{})
+	}
+	withValue := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), timeoutTestKey{}, "kept")))
+		})
+	}
+
+	r := chi.NewRouter()
+	r.Use(app.requestTimeoutMiddleware(timeouts))
+	r.Get("/default", record)
+	r.With(withValue, timeoutMiddleware(2*time.Hour)).Get("/group", record)
+	r.With(timeoutMiddleware(2*time.Hour)).Get("/route", record)
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		app.internalServerError(w, r, r.Context().Err())
+	})
+
+	get := func(path string) int {
+		return executeRequest(httptest.NewRequest(http.MethodGet, path, nil), r).Code
+	}
+
+	get("/default")
+	if remaining < 59*time.Minute || remaining > time.Hour {
+		t.Errorf("default deadline in %v, want REQUEST_TIMEOUT", remaining)
+	}
+
+	// a longer stack timeout replaces the default and keeps the values
+	get("/group")
+	if remaining < 119*time.Minute {
+		t.Errorf("group deadline in %v, want 2h", remaining)
+	}
+	if value != "kept" {
+		t.Errorf("context value %v was lost", value)
+	}
+
+	get("/route")
+	if remaining > time.Minute {
+		t.Errorf("route deadline in %v, want the ROUTE_TIMEOUTS 1m", remaining)
+	}
+
+	if code := get("/slow"); code != http.StatusGatewayTimeout {
+		t.Errorf("got %d, want 504", code)
+	}
+}
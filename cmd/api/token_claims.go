@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/auth"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// registeredClaims are set by generateToken and cannot be configured.
+var registeredClaims = []string{"sub", "exp", "iat", "nbf", "iss", "aud", "jti"}
+
+// Access token formats, picked with AUTH_TOKEN_FORMAT.
+const (
+	tokenFormatJWT    = "jwt"
+	tokenFormatPASETO = "paseto"
+)
+
+// newAuthenticator returns the authenticator for the configured format.
+func newAuthenticator(c tokenConfig) (auth.Authenticator, error) {
+	cfg := auth.TokenConfig{
+		Secret:   c.secret,
+		Issuer:   c.iss,
+		Audience: c.audiences(),
+		Leeway:   c.leeway,
+	}
+
+	switch c.format {
+	case "", tokenFormatJWT:
+		return auth.NewJWTAuthenticator(cfg), nil
+	case tokenFormatPASETO:
+		key, err := base64.StdEncoding.DecodeString(c.pasetoKey)
+		if err != nil {
+			return nil, errors.New("AUTH_PASETO_KEY must be base64")
+		}
+		cfg.Key = key
+		return auth.NewPASETOAuthenticator(cfg)
+	default:
+		return nil, fmt.Errorf("AUTH_TOKEN_FORMAT must be %s or %s", tokenFormatJWT, tokenFormatPASETO)
+	}
+}
+
+// audiences splits AUTH_TOKEN_AUDIENCE, which defaults to the issuer.
+func (c tokenConfig) audiences() []string {
+	var audiences []string
+	for _, aud := range strings.Split(c.audience, ",") {
+		if aud = strings.TrimSpace(aud); aud != "" && !slices.Contains(audiences, aud) {
+			audiences = append(audiences, aud)
+		}
+	}
+	if len(audiences) == 0 {
+		return []string{c.iss}
+	}
+	return audiences
+}
+
+// validate checks the token settings main, demo and preflight read.
+func (c tokenConfig) validate() error {
+	if c.iss == "" {
+		return errors.New("AUTH_TOKEN_ISSUER is empty")
+	}
+	if c.leeway < 0 {
+		return errors.New("AUTH_TOKEN_LEEWAY must not be negative")
+	}
+	if slices.Contains(registeredClaims, c.roleClaim) {
+		return fmt.Errorf("AUTH_TOKEN_ROLE_CLAIM cannot be the registered claim %q", c.roleClaim)
+	}
+	claims, err := parseTokenClaims(c.claims)
+	if err != nil {
+		return err
+	}
+	if _, ok := claims[c.roleClaim]; ok && c.roleClaim != "" {
+		return fmt.Errorf("AUTH_TOKEN_CLAIMS sets %q, the AUTH_TOKEN_ROLE_CLAIM", c.roleClaim)
+	}
+	_, err = newAuthenticator(c)
+	return err
+}
+
+// parseTokenClaims parses AUTH_TOKEN_CLAIMS, fixed claims every token
+// carries, as comma-separated name=value pairs.
+func parseTokenClaims(value string) (map[string]string, error) {
+	claims := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, claim, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid AUTH_TOKEN_CLAIMS entry %q", entry)
+		}
+		if slices.Contains(registeredClaims, name) {
+			return nil, fmt.Errorf("AUTH_TOKEN_CLAIMS cannot set the registered claim %q", name)
+		}
+		claims[name] = strings.TrimSpace(claim)
+	}
+	return claims, nil
+}
+
+// tokenClaims are the claims of a token for user: the registered ones, the
+// fixed AUTH_TOKEN_CLAIMS and, with AUTH_TOKEN_ROLE_CLAIM set, the user's
+// role. Requests still load the user, so the role claim is for services
+// in front of the API; changing a role does not change tokens issued.
+func (c tokenConfig) tokenClaims(user *store.User, now time.Time) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"exp": now.Add(c.exp).Unix(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"iss": c.iss,
+		"aud": c.audiences(),
+		"jti": uuid.NewString(),
+	}
+
+	// validated at startup
+	fixed, _ := parseTokenClaims(c.claims)
+	for name, value := range fixed {
+		claims[name] = value
+	}
+	if c.roleClaim != "" {
+		claims[c.roleClaim] = user.Role.Name
+	}
+	return claims
+}
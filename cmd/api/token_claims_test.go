@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenClaims(t *testing.T) {
+	cfg := tokenConfig{
+		exp:       time.Hour,
+		iss:       "real-estate",
+		audience:  "api, admin,api",
+		roleClaim: "role",
+		claims:    "env=prod, region = eu",
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := cfg.tokenClaims(&store.User{ID: 7, Role: store.Role{Name: store.RoleAdmin}}, time.Unix(1000, 0))
+	aud, _ := claims["aud"].([]string)
+	if len(aud) != 2 || aud[0] != "api" || aud[1] != "admin" {
+		t.Errorf("aud %v", claims["aud"])
+	}
+	if claims["sub"] != int64(7) || claims["exp"] != int64(4600) || claims["role"] != store.RoleAdmin || claims["env"] != "prod" || claims["region"] != "eu" {
+		t.Errorf("got %v", claims)
+	}
+
+	if aud := (tokenConfig{iss: "real-estate"}).audiences(); len(aud) != 1 || aud[0] != "real-estate" {
+		t.Errorf("default audience %v", aud)
+	}
+
+	for _, bad := range []tokenConfig{
+		{},
+		{iss: "x", leeway: -time.Second},
+		{iss: "x", roleClaim: "sub"},
+		{iss: "x", claims: "exp=1"},
+		{iss: "x", claims: "novalue"},
+		{iss: "x", roleClaim: "role", claims: "role=admin"},
+		{iss: "x", format: "saml"},
+		{iss: "x", format: tokenFormatPASETO, pasetoKey: base64.StdEncoding.EncodeToString([]byte("short"))},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("%+v is valid", bad)
+		}
+	}
+}
+
+func TestPASETOTokens(t *testing.T) {
+	cfg := tokenConfig{
+		exp:       time.Hour,
+		iss:       "real-estate",
+		format:    tokenFormatPASETO,
+		pasetoKey: base64.StdEncoding.EncodeToString(make([]byte, 32)),
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := authenticator.GenerateToken(cfg.tokenClaims(&store.User{ID: 7}, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "v4.local.") {
+		t.Fatalf("token %s", token)
+	}
+	parsed, err := authenticator.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub := parsed.Claims.(jwt.MapClaims)["sub"]; sub != float64(7) {
+		t.Errorf("sub %v", sub)
+	}
+}
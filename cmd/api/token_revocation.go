@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Access tokens carry an ID (jti) so a compromised one can be revoked
+// before it expires: POST /authentication/revoke puts the ID on a denylist
+// in Redis until the token's expiry, and every authenticated request checks
+// it. POST /authentication/introspect lets other services ask whether a
+// token is still good, following RFC 7662.
+
+var (
+	errTokenRevoked       = errors.New("token has been revoked")
+	errRevocationDisabled = newHTTPError(http.StatusServiceUnavailable, "token revocation needs Redis")
+)
+
+// accessTokenClaims validates token and returns its claims and user ID.
+// With Redis it also rejects revoked tokens; if Redis is down the token is
+// accepted, so an outage does not sign everyone out.
+func (app *application) accessTokenClaims(ctx context.Context, token string) (jwt.MapClaims, int64, error) {
+	jwtToken, err := app.authenticator.ValidateToken(token)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if jti, _ := claims["jti"].(string); jti != "" && app.config.redisCfg.enabled {
+		revoked, err := app.cacheStorage.Revocations.Revoked(ctx, jti)
+		if err != nil {
+			cacheErrors.Add(1)
+			app.logger.Errorw("could not check token revocation", "user_id", userID, "error", err)
+		}
+		if revoked {
+			return nil, 0, errTokenRevoked
+		}
+	}
+
+	return claims, userID, nil
+}
+
+// TokenIntrospection is an RFC 7662 introspection response. Inactive
+// tokens only have Active set.
+type TokenIntrospection struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	// Actor is the admin an impersonation token acts for
+	Actor *TokenActor `json:"act,omitempty"`
+}
+
+type TokenActor struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username"`
+}
+
+// introspectTokenHandler godoc
+//
+//	@Summary		Introspect an access token
+//	@Description	RFC 7662 token introspection for other services, authenticated with the basic auth credentials. Takes the form field token and answers {"active": false} for tokens that are invalid, expired, revoked or whose user can no longer sign in. The response is not wrapped in data.
+//	@Tags			authentication
+//	@Accept			x-www-form-urlencoded
+//	@Produce		json
+//	@Param			token	formData	string	true	"Access token"
+//	@Success		200		{object}	TokenIntrospection
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Security		BasicAuth
+//	@Router			/authentication/introspect [post]
+func (app *application) introspectTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.PostFormValue("token")
+	if token == "" {
+		app.badRequestResponse(w, r, errors.New("token is required"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	result := TokenIntrospection{}
+	if claims, userID, err := app.accessTokenClaims(r.Context(), token); err == nil {
+		user, err := app.userService().Get(r.Context(), userID)
+		impersonator, actErr := app.tokenImpersonator(r.Context(), claims)
+		if err == nil && actErr == nil && user.CanSignIn() {
+			result = introspection(claims, user)
+			if impersonator != nil {
+				result.Actor = &TokenActor{Subject: strconv.FormatInt(impersonator.ID, 10), Username: impersonator.Username}
+			}
+		}
+	}
+
+	if err := writeJSON(w, http.StatusOK, result); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func introspection(claims jwt.MapClaims, user *store.User) TokenIntrospection {
+	result := TokenIntrospection{
+		Active:    true,
+		TokenType: "Bearer",
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Username:  user.Username,
+		Role:      user.Role.Name,
+	}
+	result.Issuer, _ = claims.GetIssuer()
+	result.Audience, _ = claims.GetAudience()
+	if exp, _ := claims.GetExpirationTime(); exp != nil {
+		result.ExpiresAt = exp.Unix()
+	}
+	if iat, _ := claims.GetIssuedAt(); iat != nil {
+		result.IssuedAt = iat.Unix()
+	}
+	if nbf, _ := claims.GetNotBefore(); nbf != nil {
+		result.NotBefore = nbf.Unix()
+	}
+	result.ID, _ = claims["jti"].(string)
+	return result
+}
+
+// revokeTokenHandler godoc
+//
+//	@Summary		Revoke an access token
+//	@Description	Revokes the access token in the form field token, or the one the request is made with when it is omitted, until it expires. Users revoke their own tokens and admins anyone's. As in RFC 7009, a token that is already invalid answers 200. Needs Redis.
+//	@Tags			authentication
+//	@Accept			x-www-form-urlencoded
+//	@Param			token	formData	string	false	"Access token, default the caller's"
+//	@Success		200
+//	@Failure		400	{object}	error
+//	@Failure		401	{object}	error
+//	@Failure		403	{object}	error
+//	@Failure		503	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/revoke [post]
+func (app *application) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.config.redisCfg.enabled {
+		app.errorResponse(w, r, errRevocationDisabled)
+		return
+	}
+
+	user := getUserFromContext(r)
+	token := r.PostFormValue("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	claims, userID, err := app.accessTokenClaims(r.Context(), token)
+	if err != nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if userID != user.ID && user.Role.Name != store.RoleAdmin {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		app.badRequestResponse(w, r, errors.New("the token has no ID and cannot be revoked; it expires on its own"))
+		return
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		app.badRequestResponse(w, r, errors.New("the token has no expiry"))
+		return
+	}
+
+	// tokens are accepted for the leeway after they expire
+	until := exp.Add(app.config.auth.token.leeway + time.Second)
+	if err := app.cacheStorage.Revocations.Revoke(r.Context(), jti, until); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Infow("access token revoked", "user_id", userID, "revoked_by", user.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeRevocations is a denylist in memory.
+type fakeRevocations map[string]time.Time
+
+func (f fakeRevocations) Revoke(ctx context.Context, jti string, until time.Time) error {
+	f[jti] = until
+	return nil
+}
+
+func (f fakeRevocations) Revoked(ctx context.Context, jti string) (bool, error) {
+	until, ok := f[jti]
+	return ok && time.Now().Before(until), nil
+}
+
+func TestTokenRevocation(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{
+		redisCfg: redisConfig{enabled: true},
+		auth: authConfig{
+			basic: basicConfig{user: "svc", pass: "pw"},
+			token: tokenConfig{secret: "test-secret", iss: "real-estate", exp: time.Hour},
+		},
+	})
+	authenticator, err := newAuthenticator(app.config.auth.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.authenticator = authenticator
+	revocations := fakeRevocations{}
+	app.cacheStorage.Revocations = revocations
+	users := app.cacheStorage.Users.(*cache.MockUserStore)
+	users.On("Get", mock.Anything).Return(nil, nil)
+	users.On("Set", mock.Anything).Return(nil)
+	mux := app.mount()
+
+	newUser := func(name, role string) (*store.User, string) {
+		t.Helper()
+		u := &store.User{Username: name, Email: name + "@example.com", IsActive: true, Role: store.Role{Name: role}}
+		if err := app.store.Users.Create(context.Background(), nil, u); err != nil {
+			t.Fatal(err)
+		}
+		token, err := app.generateToken(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u, token
+	}
+	alice, aliceToken := newUser("alice", store.RoleUser)
+	_, bobToken := newUser("bob", store.RoleUser)
+
+	form := func(path, token string, authorize func(*http.Request)) *httptest.ResponseRecorder {
+		body := ""
+		if token != "" {
+			body = url.Values{"token": {token}}.Encode()
+		}
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		authorize(req)
+		return executeRequest(req, mux)
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	service := func(r *http.Request) { r.SetBasicAuth("svc", "pw") }
+	introspect := func(token string) TokenIntrospection {
+		t.Helper()
+		rr := form("/v1/authentication/introspect", token, service)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		var result TokenIntrospection
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	got := introspect(aliceToken)
+	if !got.Active || got.Subject != strconv.FormatInt(alice.ID, 10) || got.Username != "alice" || got.ID == "" || got.Issuer != "real-estate" || got.ExpiresAt == 0 {
+		t.Errorf("active token: %+v", got)
+	}
+	if got := introspect("not-a-token"); got.Active || got.Subject != "" {
+		t.Errorf("invalid token: %+v", got)
+	}
+	checkResponseCode(t, http.StatusUnauthorized, form("/v1/authentication/introspect", aliceToken, bearer(aliceToken)).Code)
+
+	// users cannot revoke others' tokens
+	checkResponseCode(t, http.StatusForbidden, form("/v1/authentication/revoke", aliceToken, bearer(bobToken)).Code)
+
+	// without a token field the caller's own token is revoked
+	checkResponseCode(t, http.StatusOK, form("/v1/authentication/revoke", "", bearer(aliceToken)).Code)
+	if len(revocations) != 1 {
+		t.Fatalf("revoked %v", revocations)
+	}
+	if got := introspect(aliceToken); got.Active {
+		t.Errorf("revoked token: %+v", got)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/authentication/me", nil)
+	bearer(aliceToken)(req)
+	checkResponseCode(t, http.StatusUnauthorized, executeRequest(req, mux).Code)
+
+	// revoking an invalid token succeeds, as RFC 7009 asks
+	checkResponseCode(t, http.StatusOK, form("/v1/authentication/revoke", "not-a-token", bearer(bobToken)).Code)
+	if !introspect(bobToken).Active {
+		t.Error("bob's token was revoked")
+	}
+
+	app.config.redisCfg.enabled = false
+	checkResponseCode(t, http.StatusServiceUnavailable, form("/v1/authentication/revoke", "", bearer(bobToken)).Code)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type tracingConfig struct {
+	// endpoint is the OTLP/HTTP collector, e.g. http://localhost:4318;
+	// empty turns tracing off
+	endpoint string
+	// headers are comma-separated key=value pairs sent with each export
+	headers     string
+	serviceName string
+	// sampleRatio is the share of new traces recorded, 0 to 1. Requests
+	// carrying a traceparent follow the caller's decision.
+	sampleRatio float64
+}
+
+// newTracer installs a tracer exporting to cfg.endpoint and returns its
+// exporter, or nil when tracing is off.
+func newTracer(cfg tracingConfig, onError func(error)) *tracing.Exporter {
+	if cfg.endpoint == "" {
+		return nil
+	}
+
+	exporter := tracing.NewExporter(tracing.ExporterConfig{
+		Endpoint:    cfg.endpoint,
+		Headers:     tracing.ParseHeaders(cfg.headers),
+		ServiceName: cfg.serviceName,
+		Version:     version,
+	})
+	exporter.OnError = onError
+	tracing.SetTracer(tracing.NewTracer(exporter, cfg.sampleRatio))
+	return exporter
+}
+
+// tracingMiddleware starts a server span per request, continuing the trace
+// of an incoming traceparent header. The span is named after the matched
+// route so that requests to /users/1 and /users/2 group together.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tracing.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("request.id", middleware.GetReqID(r.Context())),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(tracing.String("http.route", rctx.RoutePattern()))
+		}
+		span.SetAttributes(tracing.Int("http.response.status_code", ww.Status()))
+		if ww.Status() >= http.StatusInternalServerError {
+			span.RecordError(errorStatus(ww.Status()))
+		}
+	})
+}
+
+type errorStatus int
+
+func (s errorStatus) Error() string {
+	return http.StatusText(int(s))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+const (
+	defaultTrendingWindow = "day"
+	defaultTrendingLimit  = 20
+	maxTrendingLimit      = 50
+)
+
+// trendingWindows are the periods GET /listings/trending counts engagement
+// over, by their ?window= name.
+var trendingWindows = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// trendingCache holds the most engaged listings of each window, refreshed
+// by runTrendingRefresher and on demand once older than the interval.
+type trendingCache struct {
+	mu       sync.Mutex
+	byWindow map[string][]store.Listing
+	loaded   map[string]time.Time
+}
+
+// trendingListings returns the top listings of the window, from the cache
+// while it is fresh.
+func (app *application) trendingListings(ctx context.Context, window string) ([]store.Listing, error) {
+	c := &app.trending
+	c.mu.Lock()
+	listings, loaded := c.byWindow[window], c.loaded[window]
+	c.mu.Unlock()
+
+	if !loaded.IsZero() && time.Since(loaded) < app.config.listings.trendingInterval {
+		return listings, nil
+	}
+	return app.loadTrending(ctx, window)
+}
+
+func (app *application) loadTrending(ctx context.Context, window string) ([]store.Listing, error) {
+	listings, err := app.store.Listings.List(ctx, store.ListingFilter{
+		Status:       store.ListingStatusActive,
+		Sort:         store.ListingSortTrending,
+		EngagedSince: time.Now().Add(-trendingWindows[window]),
+		Limit:        maxTrendingLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &app.trending
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byWindow == nil {
+		c.byWindow = make(map[string][]store.Listing)
+		c.loaded = make(map[string]time.Time)
+	}
+	c.byWindow[window], c.loaded[window] = listings, time.Now()
+	return listings, nil
+}
+
+// runTrendingRefresher recomputes every trending window each interval
+// until ctx is cancelled, so requests are served from the cache.
+func (app *application) runTrendingRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	app.refreshTrending(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.refreshTrending(ctx)
+		}
+	}
+}
+
+func (app *application) refreshTrending(ctx context.Context) {
+	for window := range trendingWindows {
+		if _, err := app.loadTrending(ctx, window); err != nil {
+			app.logger.Errorw("could not refresh trending listings", "window", window, "error", err)
+		}
+	}
+}
+
+// trendingListingsHandler godoc
+//
+//	@Summary		Trending listings
+//	@Description	Active listings with the most favorites, applications and views over the last hour, day (default) or week, newest first among equals. Listings without engagement fill the rest, so the list is never empty while anything is active. Refreshed every LISTING_TRENDING_INTERVAL.
+//	@Tags			listings
+//	@Produce		json
+//	@Param			window	query		string	false	"hour, day or week"
+//	@Param			limit	query		int		false	"Number of listings (default 20, max 50)"
+//	@Success		200		{array}		store.Listing
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/listings/trending [get]
+func (app *application) trendingListingsHandler(r *http.Request, _ *noBody) ([]store.Listing, error) {
+	window := defaultTrendingWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		if _, ok := trendingWindows[v]; !ok {
+			return nil, newHTTPError(http.StatusBadRequest, "window must be hour, day or week")
+		}
+		window = v
+	}
+	limit := defaultTrendingLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendingLimit {
+			return nil, newHTTPError(http.StatusBadRequest, "limit must be between 1 and 50")
+		}
+		limit = n
+	}
+
+	cached, err := app.trendingListings(r.Context(), window)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cached slice is shared, the per-viewer fields go on a copy
+	listings := slices.Clone(cached[:min(limit, len(cached))])
+	if listings == nil {
+		listings = []store.Listing{}
+	}
+	if err := app.setFavoriteStats(r, listings); err != nil {
+		return nil, err
+	}
+	app.setLinkPreviews(r, listings)
+	return listings, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestTrendingListings(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{listings: listingsConfig{trendingInterval: time.Hour}})
+	ctx := context.Background()
+
+	var listings []*store.Listing
+	for _, title := range []string{"Quiet", "Liked", "Popular"} {
+		l := &store.Listing{CompanyID: 1, Title: title, DealType: "sale", Status: store.ListingStatusActive}
+		if err := app.store.Listings.Create(ctx, l, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		listings = append(listings, l)
+	}
+	quiet, liked, popular := listings[0], listings[1], listings[2]
+
+	users := make([]*store.User, 3)
+	for i := range users {
+		users[i] = &store.User{Username: "user" + string(rune('a'+i)), Email: string(rune('a'+i)) + "@example.com", IsActive: true}
+		if err := app.store.Users.Create(ctx, nil, users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	favorite := func(user *store.User, listing *store.Listing) {
+		t.Helper()
+		if err := app.store.Favorites.Add(ctx, user.ID, listing.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	favorite(users[0], liked)
+	favorite(users[0], popular)
+	favorite(users[1], popular)
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/listings/trending", handle(app, http.StatusOK, app.trendingListingsHandler))
+
+	get := func(query string) []int64 {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/listings/trending"+query, nil)
+		resp := executeRequest(req, mux).Result()
+		checkResponseCode(t, http.StatusOK, resp.StatusCode)
+		var body struct {
+			Data []store.Listing `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, l := range body.Data {
+			ids = append(ids, l.ID)
+		}
+		return ids
+	}
+	equal := func(got []int64, want ...int64) bool { return slices.Equal(got, want) }
+
+	if got := get("?window=hour"); !equal(got, popular.ID, liked.ID, quiet.ID) {
+		t.Errorf("hour: got %v", got)
+	}
+	if got := get("?limit=1"); !equal(got, popular.ID) {
+		t.Errorf("limit 1: got %v", got)
+	}
+
+	// served from the cache until it is refreshed
+	favorite(users[0], quiet)
+	favorite(users[1], quiet)
+	favorite(users[2], quiet)
+	if got := get("?window=hour"); !equal(got, popular.ID, liked.ID, quiet.ID) {
+		t.Errorf("cached: got %v", got)
+	}
+	app.refreshTrending(ctx)
+	if got := get("?window=hour"); !equal(got, quiet.ID, popular.ID, liked.ID) {
+		t.Errorf("refreshed: got %v", got)
+	}
+
+	for _, query := range []string{"?window=month", "?limit=0", "?limit=51"} {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/listings/trending"+query, nil)
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	}
+
+	// the trending order needs a window
+	if _, err := app.store.Listings.List(ctx, store.ListingFilter{Sort: store.ListingSortTrending}); err != store.ErrInvalidFilter {
+		t.Errorf("trending without a window: got %v", err)
+	}
+}
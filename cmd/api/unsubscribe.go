@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type UnsubscribeResponse struct {
+	Unsubscribed bool `json:"unsubscribed"`
+}
+
+// unsubscribeToken returns a token for email that does not expire and is
+// only valid for that address. It is signed with the auth token secret.
+func (app *application) unsubscribeToken(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(email)) + "." + enc.EncodeToString(app.unsubscribeMAC(email))
+}
+
+// parseUnsubscribeToken returns the address a token was issued for, or ""
+// if the token is not valid.
+func (app *application) parseUnsubscribeToken(token string) string {
+	encodedEmail, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return ""
+	}
+
+	email, err := base64.RawURLEncoding.DecodeString(encodedEmail)
+	if err != nil {
+		return ""
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, app.unsubscribeMAC(string(email))) {
+		return ""
+	}
+	return string(email)
+}
+
+func (app *application) unsubscribeMAC(email string) []byte {
+	mac := hmac.New(sha256.New, []byte(app.config.auth.token.secret))
+	mac.Write([]byte("unsubscribe:" + email))
+	return mac.Sum(nil)
+}
+
+// unsubscribeURL is the link placed in non-transactional emails and their
+// List-Unsubscribe header.
+func (app *application) unsubscribeURL(email string) string {
+	return strings.TrimRight(app.config.mail.unsubscribeURL, "/") + "/" + app.unsubscribeToken(email)
+}
+
+// unsubscribeHandler godoc
+//
+//	@Summary		Unsubscribe from notification emails
+//	@Description	Opens the link from a notification email. The address stops receiving notifications; transactional mail such as sign-in links is still sent. Mail clients use POST for one-click unsubscribe (RFC 8058).
+//	@Tags			email
+//	@Produce		json
+//	@Param			token	path		string	true	"Unsubscribe token"
+//	@Success		200		{object}	UnsubscribeResponse
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/unsubscribe/{token} [get]
+//	@Router			/unsubscribe/{token} [post]
+func (app *application) unsubscribeHandler(r *http.Request, _ *noBody) (*UnsubscribeResponse, error) {
+	email := app.parseUnsubscribeToken(chi.URLParam(r, "token"))
+	if email == "" {
+		return nil, newHTTPError(http.StatusNotFound, "invalid unsubscribe link")
+	}
+
+	err := app.store.Suppressions.Add(r.Context(), &store.EmailSuppression{
+		Email:  email,
+		Reason: store.SuppressionUnsubscribe,
+		Source: "link",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	app.logger.Infow("email address unsubscribed", "method", r.Method)
+	return &UnsubscribeResponse{Unsubscribed: true}, nil
+}
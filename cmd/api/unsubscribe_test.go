@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestUnsubscribe(t *testing.T) {
+	app := newTestApplication(t, config{
+		auth: authConfig{token: tokenConfig{secret: "test-secret"}},
+		mail: mailConfig{unsubscribeURL: "https://api.example.com/v1/unsubscribe/"},
+	})
+	app.store = store.NewMemoryStorage()
+	mux := app.mount()
+	ctx := context.Background()
+
+	link := app.unsubscribeURL("Reporter@Example.com")
+	token := strings.TrimPrefix(link, "https://api.example.com/v1/unsubscribe/")
+	if token == link || strings.Contains(token, "/") {
+		t.Fatalf("unexpected unsubscribe link %q", link)
+	}
+
+	t.Run("rejects a tampered token", func(t *testing.T) {
+		other := app.unsubscribeToken("other@example.com")
+		_, mac, _ := strings.Cut(other, ".")
+		email, _, _ := strings.Cut(token, ".")
+
+		req, _ := http.NewRequest(http.MethodGet, "/v1/unsubscribe/"+email+"."+mac, nil)
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+
+	t.Run("one-click unsubscribe suppresses notifications only", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/v1/unsubscribe/"+token, strings.NewReader("List-Unsubscribe=One-Click"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+
+		notifications, err := app.store.Suppressions.IsSuppressed(ctx, "reporter@example.com", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactional, err := app.store.Suppressions.IsSuppressed(ctx, "reporter@example.com", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !notifications || transactional {
+			t.Errorf("got notifications=%v transactional=%v, want true and false", notifications, transactional)
+		}
+	})
+}
+
+func TestComplaintResolvedHasUnsubscribeLink(t *testing.T) {
+	if mailer.IsTransactional(mailer.ComplaintResolvedTemplate) {
+		t.Error("complaint notifications should not be transactional")
+	}
+	if !mailer.IsTransactional(mailer.MagicLinkTemplate) {
+		t.Error("sign-in links should be transactional")
+	}
+
+	capture := mailer.NewCaptureClient(1)
+	_, err := capture.Send(context.Background(), mailer.ComplaintResolvedTemplate, "jo", "jo@example.com", map[string]any{
+		"Username":       "jo",
+		"TargetName":     "Flat",
+		"Resolution":     "removed",
+		"UnsubscribeURL": "https://api.example.com/v1/unsubscribe/abc",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := capture.Messages()[0]
+	if msg.Unsubscribe != "https://api.example.com/v1/unsubscribe/abc" || !strings.Contains(msg.Body, "/v1/unsubscribe/abc") {
+		t.Errorf("missing unsubscribe link: %+v", msg)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+)
+
+const (
+	defaultUsageDays = 7
+	maxUsageDays     = 30
+)
+
+type UserUsage struct {
+	Days int `json:"days"`
+	// Requests is empty when Redis is disabled, as request counters are
+	// only kept there.
+	Requests []cache.DailyUsage `json:"requests"`
+	// DailyRequestQuota caps the requests per UTC day; 0 means unlimited.
+	// RequestsToday counts against it until QuotaResetsAt.
+	DailyRequestQuota int64  `json:"daily_request_quota"`
+	RequestsToday     int64  `json:"requests_today"`
+	QuotaResetsAt     string `json:"quota_resets_at"`
+	// MediaQuotaBytes is the limit on AccountUsage.MediaBytes; 0 means
+	// unlimited.
+	MediaQuotaBytes int64 `json:"media_quota_bytes"`
+	store.AccountUsage
+}
+
+// recordUsage counts an authenticated request under its endpoint category,
+// the first path segment after the version. Failures are logged and never block the
+// request.
+//
+// With a daily request quota it also sets the X-RateLimit-* headers and, once
+// the user is over the quota, answers 429 and reports false. Admins have no
+// quota.
+func (app *application) recordUsage(w http.ResponseWriter, r *http.Request, user *store.User) bool {
+	if !app.config.redisCfg.enabled {
+		return true
+	}
+
+	category := usageCategory(r.URL.Path)
+	count, err := app.cacheStorage.Usage.Incr(r.Context(), user.ID, category)
+	if err != nil {
+		app.logger.Warnw("could not record usage", "user_id", user.ID, "error", err)
+		return true
+	}
+
+	quota := app.config.requestQuota
+	if quota <= 0 || user.Role.Name == store.RoleAdmin {
+		return true
+	}
+
+	reset := quotaReset(time.Now())
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(quota, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(max(quota-count, 0), 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	if count > quota {
+		app.quotaExceededResponse(w, r, user.ID, reset)
+		return false
+	}
+	return true
+}
+
+// quotaReset is when the daily request quota counted at now starts over,
+// the next UTC midnight.
+func quotaReset(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+func usageCategory(path string) string {
+	path = unversionedPath(path)
+	category, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if category == "" {
+		return "other"
+	}
+	return category
+}
+
+// getUsageHandler godoc
+//
+//	@Summary		API usage of the current user
+//	@Description	Requests per day and endpoint category, the daily request quota, media stored and emails received over the last days (default 7, max 30)
+//	@Tags			users
+//	@Produce		json
+//	@Param			days	query		int	false	"Number of days"
+//	@Success		200		{object}	UserUsage
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/usage [get]
+func (app *application) getUsageHandler(r *http.Request, _ *noBody) (*UserUsage, error) {
+	days := defaultUsageDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUsageDays {
+			return nil, newHTTPError(http.StatusBadRequest, "days must be between 1 and 30")
+		}
+		days = n
+	}
+
+	user := getUserFromContext(r)
+	usage := &UserUsage{
+		Days:              days,
+		Requests:          []cache.DailyUsage{},
+		DailyRequestQuota: app.config.requestQuota,
+		QuotaResetsAt:     quotaReset(time.Now()).Format(time.RFC3339),
+		MediaQuotaBytes:   app.config.storage.mediaQuotaBytes,
+	}
+	if user.Role.Name == store.RoleAdmin {
+		usage.DailyRequestQuota = 0
+	}
+
+	if app.config.redisCfg.enabled {
+		requests, err := app.cacheStorage.Usage.Daily(r.Context(), user.ID, days)
+		if err != nil {
+			return nil, err
+		}
+		usage.Requests = requests
+		if len(requests) > 0 {
+			for _, count := range requests[len(requests)-1].Requests {
+				usage.RequestsToday += count
+			}
+		}
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days+1).Truncate(24 * time.Hour)
+	account, err := app.store.Usage.GetAccountUsage(r.Context(), user.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	usage.AccountUsage = *account
+
+	return usage, nil
+}
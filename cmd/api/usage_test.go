@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+)
+
+// fakeUsageCache counts today's requests per user and category in memory.
+type fakeUsageCache struct {
+	requests map[int64]map[string]int64
+}
+
+func (f *fakeUsageCache) Incr(ctx context.Context, userID int64, category string) (int64, error) {
+	if f.requests[userID] == nil {
+		f.requests[userID] = map[string]int64{}
+	}
+	f.requests[userID][category]++
+
+	var total int64
+	for _, count := range f.requests[userID] {
+		total += count
+	}
+	return total, nil
+}
+
+func (f *fakeUsageCache) Daily(ctx context.Context, userID int64, days int) ([]cache.DailyUsage, error) {
+	return []cache.DailyUsage{{Date: time.Now().UTC().Format(time.DateOnly), Requests: f.requests[userID]}}, nil
+}
+
+func TestDailyRequestQuota(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{redisCfg: redisConfig{enabled: true}, requestQuota: 2})
+	app.cacheStorage.Usage = &fakeUsageCache{requests: map[int64]map[string]int64{}}
+
+	user := &store.User{ID: 7, Role: store.Role{Name: "user"}}
+	admin := &store.User{ID: 8, Role: store.Role{Name: store.RoleAdmin}}
+	record := func(u *store.User, path string) (*httptest.ResponseRecorder, bool) {
+		rr := httptest.NewRecorder()
+		ok := app.recordUsage(rr, httptest.NewRequest(http.MethodGet, path, nil), u)
+		return rr, ok
+	}
+
+	rr, ok := record(user, "/v1/listings")
+	if !ok || rr.Header().Get("X-RateLimit-Limit") != "2" || rr.Header().Get("X-RateLimit-Remaining") != "1" {
+		t.Fatalf("first request: ok %v, headers %v", ok, rr.Header())
+	}
+	if reset := rr.Header().Get("X-RateLimit-Reset"); reset == "" {
+		t.Error("missing X-RateLimit-Reset")
+	}
+	if _, ok := record(user, "/v1/favorites"); !ok {
+		t.Fatal("second request was refused")
+	}
+
+	rr, ok = record(user, "/v1/listings")
+	if ok || rr.Code != http.StatusTooManyRequests || rr.Header().Get("X-RateLimit-Remaining") != "0" || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("over the quota: ok %v, code %d, headers %v", ok, rr.Code, rr.Header())
+	}
+
+	for i := 0; i < 3; i++ {
+		if rr, ok := record(admin, "/v1/admin/users"); !ok || rr.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("admin request %d limited", i)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/me/usage?days=1", nil)
+	rr = executeRequest(req.WithContext(reqctx.WithUser(req.Context(), user)), handle(app, http.StatusOK, app.getUsageHandler))
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var body struct {
+		Data UserUsage `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.DailyRequestQuota != 2 || body.Data.RequestsToday != 3 || body.Data.QuotaResetsAt == "" {
+		t.Errorf("got %+v", body.Data)
+	}
+}
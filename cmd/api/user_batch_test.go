@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestBatchUsers(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	users := map[string]*store.User{}
+	for _, name := range []string{"me", "agent", "private", "friend", "blocker"} {
+		user := &store.User{Username: name, Email: name + "@example.com", IsActive: true, Role: store.Role{Name: store.RoleUser}}
+		if err := app.store.Users.Create(ctx, nil, user); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = user
+	}
+	me := users["me"]
+	for _, name := range []string{"private", "friend"} {
+		if err := app.store.Users.SetPrivate(ctx, users[name].ID, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := app.store.Conversations.Open(ctx, me.ID, users["friend"].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.store.Blocks.Block(ctx, users["blocker"].ID, me.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := func(ids ...int64) (int, []store.PublicProfile) {
+		t.Helper()
+		body, _ := json.Marshal(BatchUsersPayload{IDs: ids})
+		req, _ := http.NewRequest(http.MethodPost, "/v1/users/batch", strings.NewReader(string(body)))
+		req = req.WithContext(reqctx.WithUser(req.Context(), me))
+		rr := executeRequest(req, handle(app, http.StatusOK, app.batchUsersHandler))
+
+		var resp struct {
+			Data []store.PublicProfile `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp.Data
+	}
+
+	code, profiles := batch(users["friend"].ID, users["agent"].ID, users["private"].ID, users["blocker"].ID, 9999, users["agent"].ID, me.ID)
+	checkResponseCode(t, http.StatusOK, code)
+	var got []string
+	for _, p := range profiles {
+		got = append(got, p.Username)
+	}
+	if fmt.Sprint(got) != "[friend agent me]" {
+		t.Errorf("profiles %v", got)
+	}
+	if raw, _ := json.Marshal(profiles); strings.Contains(string(raw), "@example.com") {
+		t.Errorf("profiles carry contact details: %s", raw)
+	}
+
+	if code, _ := batch(); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without ids, got %d", code)
+	}
+	tooMany := make([]int64, 101)
+	for i := range tooMany {
+		tooMany[i] = int64(i + 1)
+	}
+	if code, _ := batch(tooMany...); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for more than 100 ids, got %d", code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAdminUserStateTransitions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	app.store = store.NewMemoryStorage()
+	ctx := context.Background()
+
+	admin := &store.User{Username: "admin", Email: "admin@example.com", IsActive: true, Role: store.Role{Name: store.RoleAdmin}}
+	user := &store.User{Username: "bob", Email: "bob@example.com", IsActive: true}
+	for _, u := range []*store.User{admin, user} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Patch("/v1/admin/users/{userID}/state", handle(app, http.StatusOK, app.adminUpdateUserStateHandler))
+	mux.Get("/v1/admin/users/{userID}/state-events", handle(app, http.StatusOK, app.adminUserStateHistoryHandler))
+	path := "/v1/admin/users/" + strconv.FormatInt(user.ID, 10)
+
+	setState := func(state string, want int) {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"state": state, "reason": "test"})
+		req, _ := http.NewRequest(http.MethodPatch, path+"/state", bytes.NewReader(body))
+		req = req.WithContext(reqctx.WithUser(req.Context(), admin))
+		checkResponseCode(t, want, executeRequest(req, mux).Code)
+	}
+
+	setState(store.UserStateSuspended, http.StatusOK)
+	if _, err := app.store.Users.GetByID(ctx, user.ID); err != store.ErrNotFound {
+		t.Errorf("a suspended user should not be found, got %v", err)
+	}
+	setState(store.UserStatePending, http.StatusConflict)
+	setState("banned", http.StatusBadRequest)
+	setState(store.UserStateActive, http.StatusOK)
+	setState(store.UserStateDeleted, http.StatusOK)
+	setState(store.UserStateActive, http.StatusConflict)
+
+	req, _ := http.NewRequest(http.MethodGet, path+"/state-events", nil)
+	resp := executeRequest(req, mux).Result()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+	var history struct {
+		Data []store.UserStateEvent `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Data) != 3 {
+		t.Fatalf("expected 3 state changes, got %+v", history.Data)
+	}
+	last := history.Data[0]
+	if last.FromState != store.UserStateActive || last.ToState != store.UserStateDeleted || last.ActorID == nil || *last.ActorID != admin.ID {
+		t.Errorf("unexpected newest event %+v", last)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+)
+
+const (
+	usernameSuggestionCount = 5
+	// candidates generated per request; more than we return so that a few
+	// collisions still leave enough free ones
+	usernameCandidateCount = 10
+)
+
+type UsernameAvailability struct {
+	Username    string   `json:"username"`
+	Available   bool     `json:"available"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// usernameAvailableHandler godoc
+//
+//	@Summary		Check username availability
+//	@Description	Reports whether a username is free and suggests free variants when it is taken, reserved or has a banned word. Usernames are 3 to 32 lowercase letters, digits or underscores starting with a letter; the check ignores case.
+//	@Tags			users
+//	@Produce		json
+//	@Param			u	query		string	true	"Username"
+//	@Success		200	{object}	UsernameAvailability
+//	@Failure		400	{object}	error
+//	@Failure		500	{object}	error
+//	@Router			/users/username-available [get]
+func (app *application) usernameAvailableHandler(r *http.Request, _ *noBody) (*UsernameAvailability, error) {
+	username := service.NormalizeUsername(r.URL.Query().Get("u"))
+	if err := service.CheckUsername(username); errors.Is(err, service.ErrUsernameInvalid) {
+		return nil, newHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	taken, err := app.store.Users.TakenUsernames(r.Context(), []string{username})
+	if err != nil {
+		return nil, err
+	}
+
+	// reserved and banned names are reported as taken, with suggestions
+	result := &UsernameAvailability{Username: username, Available: !taken[username] && !service.UsernameReserved(username) && !app.bannedUsername(username)}
+	if result.Available {
+		return result, nil
+	}
+
+	base := username
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	if app.bannedUsername(base) {
+		base = "user"
+	}
+
+	result.Suggestions, err = app.freeUsernames(r, func() string { return service.WithUsernameSuffix(base) })
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// usernameSuggestionsHandler godoc
+//
+//	@Summary		Suggest usernames
+//	@Description	Returns free usernames generated from the name and email the same way registration does
+//	@Tags			users
+//	@Produce		json
+//	@Param			first_name	query		string	false	"First name"
+//	@Param			last_name	query		string	false	"Last name"
+//	@Param			email		query		string	false	"Email"
+//	@Success		200			{array}		string
+//	@Failure		400			{object}	error
+//	@Failure		500			{object}	error
+//	@Router			/users/username-suggestions [get]
+func (app *application) usernameSuggestionsHandler(r *http.Request, _ *noBody) ([]string, error) {
+	q := r.URL.Query()
+	firstName, lastName, email := q.Get("first_name"), q.Get("last_name"), q.Get("email")
+
+	if service.UsernameBase(firstName, lastName, email) == "" {
+		return nil, newHTTPError(http.StatusBadRequest, "first_name, last_name or email is required")
+	}
+
+	return app.freeUsernames(r, func() string { return service.GenerateUsername(firstName, lastName, email) })
+}
+
+// freeUsernames generates candidates and drops the ones already taken.
+func (app *application) freeUsernames(r *http.Request, generate func() string) ([]string, error) {
+	candidates := make([]string, 0, usernameCandidateCount)
+	seen := make(map[string]bool, usernameCandidateCount)
+	for len(candidates) < usernameCandidateCount {
+		candidate := generate()
+		if !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	taken, err := app.store.Users.TakenUsernames(r.Context(), candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	free := make([]string, 0, usernameSuggestionCount)
+	for _, candidate := range candidates {
+		if !taken[candidate] && len(free) < usernameSuggestionCount {
+			free = append(free, candidate)
+		}
+	}
+
+	return free, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestUsernamePolicy(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	ctx := context.Background()
+
+	jo := &store.User{Username: "jo", Email: "jo@example.com", IsActive: true}
+	al := &store.User{Username: "ali", Email: "al@example.com", IsActive: true}
+	for _, u := range []*store.User{jo, al} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/username-available", handle(app, http.StatusOK, app.usernameAvailableHandler))
+	mux.Patch("/me", app.updateProfileHandler)
+
+	available := func(username string) (int, UsernameAvailability) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "/username-available?u="+username, nil)
+		rr := executeRequest(req, mux)
+		var resp struct{ Data UsernameAvailability }
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp.Data
+	}
+
+	code, _ := available("1jo")
+	checkResponseCode(t, http.StatusBadRequest, code)
+	code, result := available("Admin")
+	checkResponseCode(t, http.StatusOK, code)
+	if result.Available || result.Username != "admin" || len(result.Suggestions) == 0 {
+		t.Errorf("reserved name: %+v", result)
+	}
+
+	rename := func(user *store.User, username string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPatch, "/me", strings.NewReader(`{"username":"`+username+`"}`))
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), user)), mux).Code
+	}
+
+	checkResponseCode(t, http.StatusBadRequest, rename(jo, "support"))
+	checkResponseCode(t, http.StatusConflict, rename(jo, "ALI"))
+	checkResponseCode(t, http.StatusOK, rename(jo, "Jo_Doe"))
+
+	got, err := app.store.Users.GetByID(ctx, jo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "jo_doe" {
+		t.Errorf("renamed to %q, want jo_doe", got.Username)
+	}
+}
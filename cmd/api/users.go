@@ -1,18 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
 )
 
-type userKey string
-
-const userCtx userKey = "user"
-
 // GetUser godoc
 //
 //	@Summary		Fetches a user profile
@@ -34,10 +33,10 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.getUser(r.Context(), userID)
+	user, err := app.cachedProfile(r.Context(), userID)
 	if err != nil {
-		switch err {
-		case store.ErrNotFound:
+		switch {
+		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 			return
 		default:
@@ -46,6 +45,19 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if hidden, err := app.hiddenBy(r, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	} else if hidden {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	if viewer := getUserFromContext(r); viewer == nil || viewer.ID != user.ID {
+		app.recordView(r, store.ViewProfile, user.ID)
+	}
+
+	app.setCacheHeaders(w, r, userKey(user.ID))
 	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -74,8 +86,8 @@ func (app *application) getUserByEmailHandler(w http.ResponseWriter, r *http.Req
 
 	user, err := app.store.Users.GetByEmail(r.Context(), email)
 	if err != nil {
-		switch err {
-		case store.ErrNotFound:
+		switch {
+		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
@@ -83,19 +95,69 @@ func (app *application) getUserByEmailHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if hidden, err := app.hiddenBy(r, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	} else if hidden {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+// BatchUsersPayload carries the users to look up, up to 100 per request.
+type BatchUsersPayload struct {
+	IDs []int64 `json:"ids" validate:"required,min=1,max=100,dive,min=1"`
+}
+
+// BatchUsers godoc
+//
+//	@Summary		Fetches user profiles
+//	@Description	Fetches the public profiles of up to 100 users in one call, such as the authors of a feed page, in the order of ids. Users that do not exist or that the viewer may not see, as for GET /users/{id}, are left out.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		BatchUsersPayload	true	"User IDs"
+//	@Success		200		{array}		store.PublicProfile
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/batch [post]
+func (app *application) batchUsersHandler(r *http.Request, payload *BatchUsersPayload) ([]store.PublicProfile, error) {
+	viewer := getUserFromContext(r)
+	staff := viewer.Role.Name == store.RoleAdmin || viewer.Role.Name == store.RoleModerator
+
+	found, err := app.store.Users.PublicProfiles(r.Context(), payload.IDs, viewer.ID, staff)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]store.PublicProfile, len(found))
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+	profiles := make([]store.PublicProfile, 0, len(found))
+	for _, id := range payload.IDs {
+		if p, ok := byID[id]; ok {
+			profiles = append(profiles, p)
+			// a repeated id is answered once
+			delete(byID, id)
+		}
+	}
+	return profiles, nil
+}
+
 // ActivateUser godoc
 //
 //	@Summary		Activates/Register a user
-//	@Description	Activates/Register a user by invitation token
+//	@Description	Activates/Register a user by invitation token and returns the activated user
 //	@Tags			users
 //	@Produce		json
 //	@Param			token	path		string	true	"Invitation token"
-//	@Success		204		{string}	string	"User activated"
+//	@Success		200		{object}	store.User
 //	@Failure		404		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
@@ -103,24 +165,27 @@ func (app *application) getUserByEmailHandler(w http.ResponseWriter, r *http.Req
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 
-	err := app.store.Users.Activate(r.Context(), token)
+	user, err := app.store.Users.Activate(r.Context(), tokens.Lookup(tokens.Activation, token))
 	if err != nil {
-		switch err {
-		case store.ErrNotFound:
+		switch {
+		case errors.Is(err, store.ErrNotFound):
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
+	if app.config.redisCfg.enabled {
+		app.cacheStorage.Users.Delete(r.Context(), user.ID)
+	}
+	app.forgetProfile(user.ID)
 
-	if err := app.jsonResponse(w, http.StatusNoContent, ""); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
 func getUserFromContext(r *http.Request) *store.User {
-	user, _ := r.Context().Value(userCtx).(*store.User)
-	return user
+	return reqctx.User(r.Context())
 }
 
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/pagination"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 )
 
@@ -25,37 +27,115 @@ import (
 //	@Security		ApiKeyAuth
 //	@Router			/admin/users [get]
 func (app *application) adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
-	fq := store.PaginatedQuery{
-		Limit:  20,
-		Offset: 0,
-	}
-
-	fq, err := fq.Parse(r)
+	params, err := pagination.Parse(r, listPage)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if err := Validate.Struct(fq); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
-	}
+	fq, _ := store.PaginatedQuery{}.Parse(r)
+	fq.Limit, fq.Offset = params.Limit, params.Offset
 
 	users, err := app.store.Users.List(r.Context(), fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	total, err := app.store.Users.Count(r.Context(), fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+	page := newPage(params, users)
+	page.page.Total = total
+	if err := app.jsonPageResponse(w, r, http.StatusOK, page.items, page.page); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+type UpdateUserStatePayload struct {
+	State  string `json:"state" validate:"required,oneof=pending active suspended deactivated deleted"`
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+type UserState struct {
+	UserID int64  `json:"user_id"`
+	State  string `json:"state"`
+}
+
+// setUserState moves the user to state, records who did it and drops the
+// cached user so that the new state applies to their next request.
+func (app *application) setUserState(r *http.Request, userID int64, state, reason string) error {
+	return app.transitionUser(r.Context(), getUserFromContext(r), userID, state, reason)
+}
+
+// transitionUser is setUserState for admin outside of a request.
+func (app *application) transitionUser(ctx context.Context, admin *store.User, userID int64, state, reason string) error {
+	if err := app.store.Users.Transition(ctx, userID, state, &admin.ID, reason); err != nil {
+		return err
+	}
+
+	if app.config.redisCfg.enabled {
+		app.cacheStorage.Users.Delete(ctx, userID)
+	}
+	app.forgetProfile(userID)
+	app.logAdminAction(admin, "set_user_state", "user", userID, state)
+	return nil
+}
+
+// adminUpdateUserStateHandler godoc
+//
+//	@Summary		Changes a user's state
+//	@Description	Moves the user to another lifecycle state. Allowed moves: pending to active, suspended or deleted; active to suspended, deactivated or deleted; suspended to active, deactivated or deleted; deactivated to active or deleted. Deleted is final.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int						true	"User ID"
+//	@Param			payload	body		UpdateUserStatePayload	true	"New state"
+//	@Success		200		{object}	UserState
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		409		{object}	error	"The current state does not allow the move"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/state [patch]
+func (app *application) adminUpdateUserStateHandler(r *http.Request, payload *UpdateUserStatePayload) (*UserState, error) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+
+	if err := app.setUserState(r, userID, payload.State, payload.Reason); err != nil {
+		return nil, err
+	}
+	return &UserState{UserID: userID, State: payload.State}, nil
+}
+
+// adminUserStateHistoryHandler godoc
+//
+//	@Summary		Lists a user's state changes
+//	@Description	Every state change of the user, newest first
+//	@Tags			admin
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{array}		store.UserStateEvent
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/state-events [get]
+func (app *application) adminUserStateHistoryHandler(r *http.Request, _ *noBody) ([]store.UserStateEvent, error) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+	return app.store.Users.StateHistory(r.Context(), userID)
+}
+
 // adminUpdateUserStatusHandler godoc
 //
 //	@Summary		Updates a user's status (block/unblock)
-//	@Description	Changes the is_active status of a user
+//	@Description	Deprecated: use PATCH /admin/users/{userID}/state. is_active false suspends the user and true makes them active again.
 //	@Tags			admin
 //	@Accept			json
 //	@Produce		json
@@ -66,8 +146,10 @@ func (app *application) adminListUsersHandler(w http.ResponseWriter, r *http.Req
 //	@Failure		401		{object}	error
 //	@Failure		403		{object}	error
 //	@Failure		404		{object}	error
+//	@Failure		409		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
+//	@Deprecated
 //	@Router			/admin/users/{userID}/status [patch]
 func (app *application) adminUpdateUserStatusHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
@@ -85,24 +167,13 @@ func (app *application) adminUpdateUserStatusHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	if err := app.store.Users.UpdateStatus(r.Context(), userID, payload.IsActive); err != nil {
-		switch {
-		case errors.Is(err, store.ErrNotFound):
-			app.notFoundResponse(w, r, err)
-		default:
-			app.internalServerError(w, r, err)
-		}
-		return
+	state := store.UserStateSuspended
+	if payload.IsActive {
+		state = store.UserStateActive
 	}
-
-	// Log action
-	adminUser := getUserFromContext(r)
-	if adminUser != nil {
-		action := "block_user"
-		if payload.IsActive {
-			action = "unblock_user"
-		}
-		app.logAdminAction(adminUser, action, "user", userID, "")
+	if err := app.setUserState(r, userID, state, ""); err != nil {
+		app.errorResponse(w, r, err)
+		return
 	}
 
 	if err := app.jsonResponse(w, http.StatusOK, map[string]string{"message": "User status updated successfully"}); err != nil {
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/auth"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	ru_translations "github.com/go-playground/validator/v10/translations/ru"
+)
+
+const defaultLocale = "en"
+
+var universalTranslator *ut.UniversalTranslator
+
+// customTranslations covers the validators registered in json.go, per locale.
+var customTranslations = map[string]map[string]string{
+	"en": {
+		"email_regex":       "{0} must be a valid email address",
+		"country":           "{0} must be an ISO 3166-1 country code or name",
+		"username":          "{0} must be 3 to 32 lowercase letters, digits or underscores, start with a letter and not be a reserved name",
+		"name":              "{0} may only contain letters, spaces, apostrophes and hyphens",
+		"password_length":   "{0} must be at least {1} characters long",
+		"password_lower":    "{0} must contain a lowercase letter",
+		"password_upper":    "{0} must contain an uppercase letter",
+		"password_digit":    "{0} must contain a digit",
+		"password_special":  "{0} must contain a special character",
+		"password_repeated": "{0} must not repeat a character more than {1} times in a row",
+		"password_common":   "{0} is too common, choose a less predictable one",
+		"password_required": "{0} does not meet the password requirements",
+		"limit":             "{0} must be at most {1} characters long",
+	},
+	"ru": {
+		"email_regex":       "{0} должен быть действительным email адресом",
+		"country":           "{0} должен быть кодом или названием страны по ISO 3166-1",
+		"username":          "{0} должен содержать от 3 до 32 строчных латинских букв, цифр или подчёркиваний, начинаться с буквы и не быть зарезервированным именем",
+		"name":              "{0} может содержать только буквы, пробелы, апострофы и дефисы",
+		"password_length":   "{0} должен содержать минимум {1} символов",
+		"password_lower":    "{0} должен содержать строчную букву",
+		"password_upper":    "{0} должен содержать заглавную букву",
+		"password_digit":    "{0} должен содержать цифру",
+		"password_special":  "{0} должен содержать специальный символ",
+		"password_repeated": "{0} не должен повторять символ более {1} раз подряд",
+		"password_common":   "{0} слишком распространён, выберите менее предсказуемый",
+		"password_required": "{0} не соответствует требованиям к паролю",
+		"limit":             "{0} должен содержать не более {1} символов",
+	},
+}
+
+// registerTranslations reports fields by their JSON name and installs English
+// and Russian messages for every built-in and custom validation tag.
+func registerTranslations(v *validator.Validate) error {
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	enLocale := en.New()
+	universalTranslator = ut.New(enLocale, enLocale, ru.New())
+
+	enTrans, _ := universalTranslator.GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		return err
+	}
+
+	ruTrans, _ := universalTranslator.GetTranslator("ru")
+	if err := ru_translations.RegisterDefaultTranslations(v, ruTrans); err != nil {
+		return err
+	}
+
+	for locale, messages := range customTranslations {
+		trans, _ := universalTranslator.GetTranslator(locale)
+
+		for key, message := range messages {
+			if err := trans.Add(key, message, false); err != nil {
+				return err
+			}
+		}
+
+		for _, tag := range []string{"email_regex", "name", "country", "username"} {
+			err := v.RegisterTranslation(tag, trans, noopRegister, func(t ut.Translator, fe validator.FieldError) string {
+				msg, _ := t.T(fe.Tag(), fe.Field())
+				return msg
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err := v.RegisterTranslation("limit", trans, noopRegister, func(t ut.Translator, fe validator.FieldError) string {
+			msg, _ := t.T("limit", fe.Field(), strconv.Itoa(store.Limits[fe.Param()].Max))
+			return msg
+		})
+		if err != nil {
+			return err
+		}
+
+		err = v.RegisterTranslation("password", trans, noopRegister, func(t ut.Translator, fe validator.FieldError) string {
+			value, _ := fe.Value().(string)
+
+			var msg string
+			switch key := passwordPolicy.Check(value); key {
+			case auth.PasswordRuleLength:
+				msg, _ = t.T(key, fe.Field(), strconv.Itoa(passwordPolicy.MinLength))
+			case auth.PasswordRuleRepeated:
+				msg, _ = t.T(key, fe.Field(), strconv.Itoa(passwordPolicy.MaxRepeatedChars))
+			case "":
+				msg, _ = t.T("password_required", fe.Field())
+			default:
+				msg, _ = t.T(key, fe.Field())
+			}
+			return msg
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func noopRegister(ut.Translator) error {
+	return nil
+}
+
+// translatorFor picks the translator for the request's locale, see
+// negotiateLocale, or English.
+func translatorFor(r *http.Request) ut.Translator {
+	if trans, found := universalTranslator.GetTranslator(requestLocale(r)); found {
+		return trans
+	}
+	trans, _ := universalTranslator.GetTranslator(defaultLocale)
+	return trans
+}
+
+// translateValidationErrors returns one human-readable message per invalid
+// field. ok is false when err is not a validation error.
+func translateValidationErrors(r *http.Request, err error) (map[string]string, bool) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil, false
+	}
+
+	trans := translatorFor(r)
+	fields := make(map[string]string, len(validationErrs))
+	for _, fe := range validationErrs {
+		if _, exists := fields[fe.Field()]; !exists {
+			fields[fe.Field()] = fe.Translate(trans)
+		}
+	}
+
+	return fields, true
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTranslateValidationErrors(t *testing.T) {
+	payload := RegisterUserPayload{
+		FirstName:            "Anna",
+		LastName:             "Ivanova",
+		Email:                "anna@example.com",
+		Phone:                "+77001234567",
+		Password:             "lowercase1!",
+		PasswordConfirmation: "lowercase1!",
+	}
+
+	err := Validate.Struct(payload)
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", "password must contain an uppercase letter"},
+		{"ru-RU,ru;q=0.9,en;q=0.8", "password должен содержать заглавную букву"},
+		{"de-DE", "password must contain an uppercase letter"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+
+		fields, ok := translateValidationErrors(r, err)
+		if !ok {
+			t.Fatalf("expected validation errors to be translated")
+		}
+
+		if got := fields["password"]; got != tt.want {
+			t.Errorf("Accept-Language %q: got %q, want %q", tt.acceptLanguage, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/pagination"
+)
+
+// apiVersion is a URL prefix the API is served under. Every version mounts
+// the same route groups and handlers; routeGroups checks the version for
+// the few routes that differ.
+type apiVersion struct {
+	name string
+	// deprecated is the deprecatedRoutes entry covering every route of the
+	// version, empty while the version is current
+	deprecated string
+}
+
+// apiVersions lists the served versions, oldest first.
+var apiVersions = []apiVersion{
+	{name: "v1", deprecated: "/v1/*"},
+	{name: "v2"},
+}
+
+// apiVersionHeader tells clients which version answered. The response
+// helpers read it back to pick the envelope.
+const apiVersionHeader = "API-Version"
+
+// middleware marks responses with the version and, for a deprecated
+// version, with its Deprecation and Sunset headers.
+func (v apiVersion) middleware(next http.Handler) http.Handler {
+	if v.deprecated != "" {
+		next = deprecations.middleware(v.deprecated)(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(apiVersionHeader, v.name)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// versionMeta is the meta block v2 adds to every successful response, with
+// the page fields for lists.
+type versionMeta struct {
+	APIVersion string `json:"api_version"`
+	*pagination.Meta
+}
+
+// hasMetaEnvelope reports whether the response is for a version whose
+// envelope always carries meta.
+func hasMetaEnvelope(w http.ResponseWriter) bool {
+	version := w.Header().Get(apiVersionHeader)
+	return version != "" && version != "v1"
+}
+
+// unversionedPath strips the version prefix, so "/v2/admin/read-only"
+// becomes "/admin/read-only".
+func unversionedPath(path string) string {
+	for _, version := range apiVersions {
+		if rest, ok := strings.CutPrefix(path, "/"+version.name); ok && (rest == "" || rest[0] == '/') {
+			return rest
+		}
+	}
+	return path
+}
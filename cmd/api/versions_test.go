@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIVersions(t *testing.T) {
+	mux := newTestApplication(t, config{}).mount()
+
+	var body struct {
+		Meta *versionMeta `json:"meta"`
+	}
+
+	t.Run("v1 keeps its envelope and is deprecated", func(t *testing.T) {
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v1/health", nil), mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if rr.Header().Get(apiVersionHeader) != "v1" || rr.Header().Get("Deprecation") == "" {
+			t.Errorf("unexpected headers %v", rr.Header())
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Meta != nil {
+			t.Errorf("unexpected meta %+v", body.Meta)
+		}
+	})
+
+	t.Run("v2 adds meta to the envelope", func(t *testing.T) {
+		rr := executeRequest(httptest.NewRequest(http.MethodGet, "/v2/health", nil), mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+		if rr.Header().Get(apiVersionHeader) != "v2" || rr.Header().Get("Deprecation") != "" {
+			t.Errorf("unexpected headers %v", rr.Header())
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Meta == nil || body.Meta.APIVersion != "v2" {
+			t.Errorf("unexpected meta %+v", body.Meta)
+		}
+	})
+}
+
+func TestUnversionedPath(t *testing.T) {
+	tests := map[string]string{
+		"/v1/admin/read-only": "/admin/read-only",
+		"/v2/health":          "/health",
+		"/v2":                 "",
+		"/v20/health":         "/v20/health",
+		"/swagger":            "/swagger",
+	}
+
+	for path, want := range tests {
+		if got := unversionedPath(path); got != want {
+			t.Errorf("unversionedPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
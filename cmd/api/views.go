@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+const (
+	defaultViewDays = 30
+	maxViewDays     = 90
+)
+
+type DashboardViews struct {
+	Days int `json:"days"`
+	// Profile is the views of the user's profile per day, oldest first,
+	// with days without views included
+	Profile      []store.DailyViews `json:"profile"`
+	ProfileViews int64              `json:"profile_views"`
+	// Listings is the views of the listings of the user's company, most
+	// viewed first; empty for users without a company
+	Listings []store.ListingViews `json:"listings"`
+}
+
+// recordView counts a view of a profile or listing by the requester, once
+// per viewer and day. Signed-in viewers are told apart by ID, others by IP.
+// Views are only counted with Redis enabled; failures are logged and never
+// block the request.
+func (app *application) recordView(r *http.Request, kind string, targetID int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	viewer := "ip:" + viewerIPHash(clientIP(r))
+	if user := getUserFromContext(r); user != nil {
+		viewer = "user:" + strconv.FormatInt(user.ID, 10)
+	}
+
+	if _, err := app.cacheStorage.Views.Record(r.Context(), kind, targetID, viewer); err != nil {
+		cacheErrors.Add(1)
+		app.logger.Warnw("could not record view", "kind", kind, "id", targetID, "error", err)
+	}
+}
+
+// viewerIPHash keeps anonymous viewers' addresses out of Redis.
+func viewerIPHash(ip string) string {
+	sum := sha256.Sum256([]byte(ip))
+	return hex.EncodeToString(sum[:16])
+}
+
+// runViewFlusher adds the views buffered in Redis to the database every
+// interval until ctx is cancelled.
+func (app *application) runViewFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.flushViews(ctx)
+		}
+	}
+}
+
+// flushViews moves the buffered view counts to the database, putting them
+// back in Redis for the next run when the database refuses them.
+func (app *application) flushViews(ctx context.Context) {
+	counts, err := app.cacheStorage.Views.Drain(ctx)
+	if err != nil {
+		app.logger.Errorw("could not drain view counts", "error", err)
+		return
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	if err := app.store.Views.Add(ctx, counts); err != nil {
+		app.logger.Errorw("could not store view counts, will retry", "error", err)
+		if err := app.cacheStorage.Views.Restore(ctx, counts); err != nil {
+			app.logger.Errorw("view counts lost", "counts", len(counts), "error", err)
+		}
+	}
+}
+
+// dashboardViewsHandler godoc
+//
+//	@Summary		Profile and listing views
+//	@Description	Views of the current user's profile per day and of their company's listings over the last days (default 30, max 90). Each viewer counts once a day and owners' own views are not counted. Counts are kept with Redis enabled and reach this endpoint every VIEWS_FLUSH_INTERVAL.
+//	@Tags			dashboard
+//	@Produce		json
+//	@Param			days	query		int	false	"Number of days"
+//	@Success		200		{object}	DashboardViews
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/dashboard/views [get]
+func (app *application) dashboardViewsHandler(r *http.Request, _ *noBody) (*DashboardViews, error) {
+	days := defaultViewDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxViewDays {
+			return nil, newHTTPError(http.StatusBadRequest, "days must be between 1 and 90")
+		}
+		days = n
+	}
+
+	user := getUserFromContext(r)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -days+1)
+
+	daily, err := app.store.Views.ProfileDaily(r.Context(), user.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]int64, len(daily))
+	for _, d := range daily {
+		byDate[d.Date] = d.Views
+	}
+
+	views := &DashboardViews{Days: days, Profile: make([]store.DailyViews, days), Listings: []store.ListingViews{}}
+	for i := range views.Profile {
+		date := since.AddDate(0, 0, i).Format(time.DateOnly)
+		views.Profile[i] = store.DailyViews{Date: date, Views: byDate[date]}
+		views.ProfileViews += byDate[date]
+	}
+
+	if user.CompanyID != nil {
+		if views.Listings, err = app.store.Views.CompanyListings(r.Context(), *user.CompanyID, since); err != nil {
+			return nil, err
+		}
+	}
+
+	return views, nil
+}
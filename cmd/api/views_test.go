@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/cache"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeViewCache dedups viewers per target and day in a map, like the Redis
+// store.
+type fakeViewCache struct {
+	seen    map[string]bool
+	pending map[store.ViewCount]int64
+}
+
+func (f *fakeViewCache) Record(ctx context.Context, kind string, targetID int64, viewer string) (bool, error) {
+	day := time.Now().UTC().Format(time.DateOnly)
+	key := fmt.Sprintf("%s-%d-%s-%s", kind, targetID, day, viewer)
+	if f.seen[key] {
+		return false, nil
+	}
+	f.seen[key] = true
+	f.pending[store.ViewCount{Kind: kind, TargetID: targetID, Day: day}]++
+	return true, nil
+}
+
+func (f *fakeViewCache) Drain(ctx context.Context) ([]store.ViewCount, error) {
+	var counts []store.ViewCount
+	for c, views := range f.pending {
+		c.Views = views
+		counts = append(counts, c)
+	}
+	f.pending = make(map[store.ViewCount]int64)
+	return counts, nil
+}
+
+func (f *fakeViewCache) Restore(ctx context.Context, counts []store.ViewCount) error {
+	for _, c := range counts {
+		views := c.Views
+		c.Views = 0
+		f.pending[c] += views
+	}
+	return nil
+}
+
+func TestViewCounts(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{redisCfg: redisConfig{enabled: true}})
+	app.cacheStorage.Views = &fakeViewCache{seen: map[string]bool{}, pending: map[store.ViewCount]int64{}}
+	users := app.cacheStorage.Users.(*cache.MockUserStore)
+	users.On("Get", mock.Anything).Return(nil, nil)
+	users.On("Set", mock.Anything).Return(nil)
+	ctx := context.Background()
+
+	companyID := int64(1)
+	owner := &store.User{Username: "owner", Email: "owner@example.com", IsActive: true, CompanyID: &companyID}
+	alice := &store.User{Username: "alice", Email: "alice@example.com", IsActive: true}
+	for _, u := range []*store.User{owner, alice} {
+		if err := app.store.Users.Create(ctx, nil, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listing := &store.Listing{CompanyID: companyID, Title: "Flat", DealType: "sale", Status: store.ListingStatusActive}
+	if err := app.store.Listings.Create(ctx, listing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := chi.NewRouter()
+	mux.Get("/v1/users/{userID}", app.getUserHandler)
+	mux.Get("/v1/listings/{listingID}", app.getListingHandler)
+	mux.Get("/v1/dashboard/views", handle(app, http.StatusOK, app.dashboardViewsHandler))
+
+	view := func(path string, user *store.User) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if user != nil {
+			req = req.WithContext(reqctx.WithUser(req.Context(), user))
+		}
+		checkResponseCode(t, http.StatusOK, executeRequest(req, mux).Code)
+	}
+
+	profile := fmt.Sprintf("/v1/users/%d", owner.ID)
+	listingPath := fmt.Sprintf("/v1/listings/%d", listing.ID)
+	for _, path := range []string{profile, listingPath} {
+		view(path, alice)
+		view(path, alice) // same viewer, same day
+		view(path, nil)
+		view(path, owner) // owners' own views are not counted
+	}
+	app.flushViews(ctx)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/dashboard/views?days=7", nil)
+	req = req.WithContext(reqctx.WithUser(req.Context(), owner))
+	resp := executeRequest(req, mux).Result()
+	checkResponseCode(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Data DashboardViews `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	views := body.Data
+	if views.ProfileViews != 2 || len(views.Profile) != 7 || views.Profile[6].Views != 2 {
+		t.Errorf("profile: got %d views over %d days, %+v", views.ProfileViews, len(views.Profile), views.Profile)
+	}
+	if len(views.Listings) != 1 || views.Listings[0].ListingID != listing.ID || views.Listings[0].Views != 2 {
+		t.Errorf("listings: got %+v", views.Listings)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/dashboard/views?days=365", nil)
+	req = req.WithContext(reqctx.WithUser(req.Context(), owner))
+	checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+}
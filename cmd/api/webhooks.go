@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	webhookBatchSize   = 20
+	webhookLease       = 5 * time.Minute
+	webhookMaxAttempts = outboxMaxAttempts
+	// webhookErrorBody caps how much of a failed response is kept in the log
+	webhookErrorBody = 512
+)
+
+var errPrivateAddress = errors.New("address is not public")
+
+type webhookConfig struct {
+	// interval is how often the relay polls for queued deliveries, 0 stops it
+	interval time.Duration
+	// timeout bounds a single delivery attempt
+	timeout time.Duration
+	// allowPrivate lets hooks reach loopback and private networks, for
+	// development only
+	allowPrivate bool
+}
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1"`
+	// Secret signs deliveries; one is generated when it is left out
+	Secret string `json:"secret" validate:"omitempty,min=16,max=128"`
+}
+
+// CreateWebhookResponse is the only time the secret is shown.
+type CreateWebhookResponse struct {
+	store.Webhook
+	Secret string `json:"secret"`
+}
+
+// webhookEnvelope is the body of every delivery.
+type webhookEnvelope struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// refusePrivateAddress is a net.Dialer Control that refuses to connect to
+// loopback, private and link-local addresses. It runs after DNS resolution,
+// so a public name pointing inside the network is caught too.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// newWebhookClient returns the client deliveries go through. Unless
+// allowPrivate is set it only connects to public addresses, see
+// refusePrivateAddress.
+func newWebhookClient(cfg webhookConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.timeout}
+	if !cfg.allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+
+	return &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, Proxy: nil},
+		// a redirect could lead anywhere; receivers must answer directly
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// signWebhook returns the X-Webhook-Signature value for body sent at t:
+// the hex HMAC-SHA256 of "<unix t>.<body>" keyed with the hook's secret.
+func signWebhook(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhooks queues the event for the hooks subscribed to it: admin
+// hooks and, when the event is about a company, that company's hooks. It is
+// subscribed to the event bus.
+func (app *application) enqueueWebhooks(ctx context.Context, e events.Event) error {
+	payload, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	return app.store.Webhooks.Enqueue(ctx, e.Type, e.CompanyID, payload)
+}
+
+// runWebhookRelay delivers queued webhook events until ctx is cancelled,
+// retrying failures like the email outbox.
+func (app *application) runWebhookRelay(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.relayWebhooks(ctx)
+		}
+	}
+}
+
+func (app *application) relayWebhooks(ctx context.Context) {
+	deliveries, err := app.store.Webhooks.ClaimPending(ctx, webhookBatchSize, webhookLease)
+	if err != nil {
+		app.logger.Errorw("could not claim webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		app.deliverWebhook(ctx, delivery)
+	}
+}
+
+// deliverWebhook POSTs one claimed delivery and records the outcome. Any 2xx
+// answer counts as delivered.
+func (app *application) deliverWebhook(ctx context.Context, delivery store.WebhookDelivery) {
+	ctx, span := tracing.Start(ctx, "webhook.deliver", tracing.KindClient,
+		tracing.Int("webhook.id", int(delivery.WebhookID)),
+		tracing.String("webhook.event", delivery.Event),
+	)
+	defer span.End()
+
+	status, err := app.postWebhook(ctx, delivery)
+	span.RecordError(err)
+
+	if err == nil {
+		if err := app.store.Webhooks.MarkDelivered(ctx, delivery.ID, status); err != nil {
+			app.logger.Errorw("could not mark webhook delivered", "id", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	var retryAt *time.Time
+	if attempts < webhookMaxAttempts {
+		next := time.Now().Add(outboxBackoff(attempts))
+		retryAt = &next
+		app.logger.Warnw("webhook delivery failed, will retry", "id", delivery.ID, "webhook", delivery.WebhookID, "attempts", attempts, "error", err)
+	} else {
+		app.logger.Errorw("webhook delivery failed, giving up", "id", delivery.ID, "webhook", delivery.WebhookID, "attempts", attempts, "error", err)
+	}
+
+	if err := app.store.Webhooks.MarkFailed(ctx, delivery.ID, status, err.Error(), retryAt); err != nil {
+		app.logger.Errorw("could not mark webhook failed", "id", delivery.ID, "error", err)
+	}
+}
+
+// postWebhook sends the delivery and returns the response status, 0 when
+// none came back.
+func (app *application) postWebhook(ctx context.Context, delivery store.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(webhookEnvelope{
+		ID:        delivery.ID,
+		Event:     delivery.Event,
+		CreatedAt: delivery.CreatedAt.UTC(),
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Valar-Morghulis-Webhooks/1")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(delivery.Secret, time.Now(), body))
+
+	resp, err := app.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBody))
+		return resp.StatusCode, fmt.Errorf("receiver answered %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookErrorBody))
+	return resp.StatusCode, nil
+}
+
+// createWebhook validates the payload and stores a hook for companyID, nil
+// for an admin hook.
+func (app *application) createWebhook(r *http.Request, companyID *int64, payload *CreateWebhookPayload) (*CreateWebhookResponse, error) {
+	u, err := url.Parse(payload.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, newHTTPError(http.StatusBadRequest, "url must be an http or https URL")
+	}
+	if app.config.env == "production" && u.Scheme != "https" {
+		return nil, newHTTPError(http.StatusBadRequest, "url must use https")
+	}
+
+	events := slices.Clone(payload.Events)
+	slices.Sort(events)
+	events = slices.Compact(events)
+	for _, event := range events {
+		if !slices.Contains(store.WebhookEvents, event) {
+			return nil, newHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown event %q", event))
+		}
+	}
+
+	secret := payload.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	user := getUserFromContext(r)
+	hook := &store.Webhook{
+		CreatedBy: &user.ID,
+		CompanyID: companyID,
+		URL:       u.String(),
+		Secret:    secret,
+		Events:    events,
+	}
+	if err := app.store.Webhooks.Create(r.Context(), hook); err != nil {
+		return nil, err
+	}
+
+	hook.Secret = ""
+	return &CreateWebhookResponse{Webhook: *hook, Secret: secret}, nil
+}
+
+// webhookFor loads the hook in the URL, answering 404 when it does not
+// belong to companyID (nil for admin hooks).
+func (app *application) webhookFor(r *http.Request, companyID *int64) (*store.Webhook, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid webhook ID")
+	}
+
+	hook, err := app.store.Webhooks.GetByID(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if (hook.CompanyID == nil) != (companyID == nil) || (companyID != nil && *hook.CompanyID != *companyID) {
+		return nil, store.ErrNotFound
+	}
+	return hook, nil
+}
+
+func (app *application) webhookDeliveries(r *http.Request, companyID *int64) (paged[store.WebhookDelivery], error) {
+	hook, err := app.webhookFor(r, companyID)
+	if err != nil {
+		return paged[store.WebhookDelivery]{}, err
+	}
+	params, err := parsePage(r, listPage)
+	if err != nil {
+		return paged[store.WebhookDelivery]{}, err
+	}
+
+	deliveries, err := app.store.Webhooks.ListDeliveries(r.Context(), hook.ID, storeQuery(params))
+	return newPage(params, deliveries), err
+}
+
+// webhookTeam returns the caller's company when their team role may manage
+// webhooks: owners and managers.
+func (app *application) webhookTeam(r *http.Request) (*int64, error) {
+	team, err := app.team(r)
+	if err != nil {
+		return nil, err
+	}
+	if team.Role != store.TeamRoleOwner && team.Role != store.TeamRoleManager {
+		return nil, newHTTPError(http.StatusForbidden, "only owners and managers manage webhooks")
+	}
+	return &team.CompanyID, nil
+}
+
+// adminListWebhooksHandler godoc
+//
+//	@Summary		List admin webhooks
+//	@Description	Webhooks receiving events from every company
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		store.Webhook
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/webhooks [get]
+func (app *application) adminListWebhooksHandler(r *http.Request, _ *noBody) ([]store.Webhook, error) {
+	return app.store.Webhooks.List(r.Context(), nil)
+}
+
+// adminCreateWebhookHandler godoc
+//
+//	@Summary		Create an admin webhook
+//	@Description	Registers a URL that receives the subscribed events for every company. The signing secret is returned only here.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateWebhookPayload	true	"Webhook"
+//	@Success		201		{object}	CreateWebhookResponse
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/webhooks [post]
+func (app *application) adminCreateWebhookHandler(r *http.Request, payload *CreateWebhookPayload) (*CreateWebhookResponse, error) {
+	resp, err := app.createWebhook(r, nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	app.logAdminAction(getUserFromContext(r), "create_webhook", "webhook", resp.ID, resp.URL)
+	return resp, nil
+}
+
+// adminDeleteWebhookHandler godoc
+//
+//	@Summary		Delete an admin webhook
+//	@Description	Removes the webhook and its delivery log
+//	@Tags			admin
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Success		200			{object}	store.Webhook
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/webhooks/{webhookID} [delete]
+func (app *application) adminDeleteWebhookHandler(r *http.Request, _ *noBody) (*store.Webhook, error) {
+	hook, err := app.webhookFor(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.Webhooks.Delete(r.Context(), hook.ID); err != nil {
+		return nil, err
+	}
+	app.logAdminAction(getUserFromContext(r), "delete_webhook", "webhook", hook.ID, hook.URL)
+	return hook, nil
+}
+
+// adminListWebhookDeliveriesHandler godoc
+//
+//	@Summary		List an admin webhook's deliveries
+//	@Description	Delivery log, newest first, with attempts, response status and last error
+//	@Tags			admin
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Param			limit		query		int	false	"Limit"
+//	@Param			offset		query		int	false	"Offset"
+//	@Success		200			{object}	paged[store.WebhookDelivery]
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/webhooks/{webhookID}/deliveries [get]
+func (app *application) adminListWebhookDeliveriesHandler(r *http.Request, _ *noBody) (paged[store.WebhookDelivery], error) {
+	return app.webhookDeliveries(r, nil)
+}
+
+// listTeamWebhooksHandler godoc
+//
+//	@Summary		List my company's webhooks
+//	@Description	Owners and managers only
+//	@Tags			teams
+//	@Produce		json
+//	@Success		200	{array}		store.Webhook
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/webhooks [get]
+func (app *application) listTeamWebhooksHandler(r *http.Request, _ *noBody) ([]store.Webhook, error) {
+	companyID, err := app.webhookTeam(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.store.Webhooks.List(r.Context(), companyID)
+}
+
+// createTeamWebhookHandler godoc
+//
+//	@Summary		Create a webhook for my company
+//	@Description	Registers a URL that receives the subscribed events about the caller's company. Owners and managers only; the signing secret is returned only here.
+//	@Tags			teams
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateWebhookPayload	true	"Webhook"
+//	@Success		201		{object}	CreateWebhookResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/webhooks [post]
+func (app *application) createTeamWebhookHandler(r *http.Request, payload *CreateWebhookPayload) (*CreateWebhookResponse, error) {
+	companyID, err := app.webhookTeam(r)
+	if err != nil {
+		return nil, err
+	}
+	return app.createWebhook(r, companyID, payload)
+}
+
+// deleteTeamWebhookHandler godoc
+//
+//	@Summary		Delete one of my company's webhooks
+//	@Description	Removes the webhook and its delivery log. Owners and managers only.
+//	@Tags			teams
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Success		200			{object}	store.Webhook
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/webhooks/{webhookID} [delete]
+func (app *application) deleteTeamWebhookHandler(r *http.Request, _ *noBody) (*store.Webhook, error) {
+	companyID, err := app.webhookTeam(r)
+	if err != nil {
+		return nil, err
+	}
+	hook, err := app.webhookFor(r, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return hook, app.store.Webhooks.Delete(r.Context(), hook.ID)
+}
+
+// listTeamWebhookDeliveriesHandler godoc
+//
+//	@Summary		List a company webhook's deliveries
+//	@Description	Delivery log, newest first. Owners and managers only.
+//	@Tags			teams
+//	@Produce		json
+//	@Param			webhookID	path		int	true	"Webhook ID"
+//	@Param			limit		query		int	false	"Limit"
+//	@Param			offset		query		int	false	"Offset"
+//	@Success		200			{object}	paged[store.WebhookDelivery]
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/team/webhooks/{webhookID}/deliveries [get]
+func (app *application) listTeamWebhookDeliveriesHandler(r *http.Request, _ *noBody) (paged[store.WebhookDelivery], error) {
+	companyID, err := app.webhookTeam(r)
+	if err != nil {
+		return paged[store.WebhookDelivery]{}, err
+	}
+	return app.webhookDeliveries(r, companyID)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestWebhooks(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{})
+	app.webhookClient = newWebhookClient(webhookConfig{timeout: 5 * time.Second, allowPrivate: true})
+	ctx := context.Background()
+
+	type received struct {
+		signature string
+		body      []byte
+	}
+	got := make(chan received, 10)
+	var fail atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Get("X-Webhook-Signature"), body}
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	company := &store.Company{Name: "Acme Realty", RegistrationNumber: "42", Email: "office@acme.example", Type: store.RoleAgency}
+	owner := &store.User{Username: "olga", Email: "office@acme.example", Role: store.Role{Name: store.RoleAgency}}
+	if err := app.store.Users.CreateCompanyAndUser(ctx, company, owner, "token", time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	owner, _ = app.store.Users.GetByID(ctx, owner.ID)
+
+	mux := chi.NewRouter()
+	mux.Post("/webhooks", handle(app, http.StatusCreated, app.createTeamWebhookHandler))
+	mux.Get("/webhooks/{webhookID}/deliveries", handle(app, http.StatusOK, app.listTeamWebhookDeliveriesHandler))
+
+	req, _ := http.NewRequest(http.MethodPost, "/webhooks",
+		strings.NewReader(`{"url":"`+receiver.URL+`","events":["listing.created"],"secret":"0123456789abcdef"}`))
+	rr := executeRequest(req.WithContext(reqctx.WithUser(ctx, owner)), mux)
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+	var created struct{ Data CreateWebhookResponse }
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if hook := created.Data; hook.Secret != "0123456789abcdef" || hook.CompanyID == nil || *hook.CompanyID != company.ID {
+		t.Fatalf("created %s", rr.Body)
+	}
+
+	// another company's listing and an unsubscribed event are not delivered
+	other := int64(999)
+	app.publish(ctx, events.ListingCreated, &other, map[string]int{"id": 1})
+	app.publish(ctx, events.UserRegistered, &company.ID, map[string]int{"id": 2})
+	app.publish(ctx, events.ListingCreated, &company.ID, map[string]int{"id": 3})
+	app.relayWebhooks(ctx)
+
+	select {
+	case r := <-got:
+		var envelope webhookEnvelope
+		if err := json.Unmarshal(r.body, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Event != events.ListingCreated || string(envelope.Data) != `{"id":3}` {
+			t.Fatalf("delivered %s", r.body)
+		}
+		ts := strings.TrimPrefix(strings.SplitN(r.signature, ",", 2)[0], "t=")
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := signWebhook("0123456789abcdef", time.Unix(unix, 0), r.body); r.signature != want {
+			t.Fatalf("signature %q, want %q", r.signature, want)
+		}
+	default:
+		t.Fatal("nothing was delivered")
+	}
+	if len(got) != 0 {
+		t.Fatalf("%d unexpected deliveries", len(got))
+	}
+
+	// a failed delivery is logged and scheduled again
+	fail.Store(true)
+	app.publish(ctx, events.ListingCreated, &company.ID, map[string]int{"id": 4})
+	app.relayWebhooks(ctx)
+	<-got
+
+	req, _ = http.NewRequest(http.MethodGet, "/webhooks/"+strconv.FormatInt(created.Data.ID, 10)+"/deliveries", nil)
+	rr = executeRequest(req.WithContext(reqctx.WithUser(ctx, owner)), mux)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var page struct{ Data []store.WebhookDelivery }
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if d := page.Data; len(d) != 2 || d[0].DeliveredAt != nil || d[0].NextAttemptAt == nil ||
+		d[0].ResponseStatus == nil || *d[0].ResponseStatus != http.StatusServiceUnavailable || d[1].DeliveredAt == nil {
+		t.Fatalf("deliveries %s", rr.Body)
+	}
+
+	// by default hooks cannot reach the local network
+	strict := newWebhookClient(webhookConfig{timeout: time.Second})
+	if _, err := strict.Post(receiver.URL, "application/json", nil); err == nil {
+		t.Fatal("loopback receiver was reached")
+	}
+}
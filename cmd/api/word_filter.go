@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/wordfilter"
+	"github.com/go-chi/chi/v5"
+)
+
+// The word filter keeps profanity out of usernames and, when
+// WORD_FILTER_CONTENT is set, out of listings and messages. It is built from
+// the embedded lists of internal/wordfilter, WORD_FILTER_WORDS and the words
+// admins add under /admin/banned-words. Unlike the content filter, which
+// holds content for a moderator, it answers right away: the text is refused
+// or masked.
+const (
+	wordFilterOff    = "off"
+	wordFilterReject = "reject"
+	wordFilterMask   = "mask"
+)
+
+type wordFilterConfig struct {
+	// locales is a comma separated list of the embedded lists to use,
+	// empty for all of them
+	locales string
+	// words is a comma separated list of more entries
+	words string
+	// usernames refuses usernames with a banned word at registration
+	usernames bool
+	// content is off, reject or mask for listings and messages
+	content string
+	// refresh is how often words added on other instances are picked up
+	refresh time.Duration
+}
+
+func (c wordFilterConfig) validate() error {
+	switch c.content {
+	case wordFilterOff, wordFilterReject, wordFilterMask:
+	default:
+		return fmt.Errorf("WORD_FILTER_CONTENT must be off, reject or mask, got %q", c.content)
+	}
+	_, err := wordfilter.New(wordfilter.Options{Locales: c.localeList()})
+	return err
+}
+
+func (c wordFilterConfig) localeList() []string {
+	var locales []string
+	for _, locale := range strings.Split(c.locales, ",") {
+		if locale = strings.ToLower(strings.TrimSpace(locale)); locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
+
+// loadWordFilter rebuilds app.words with the current banned_words. Words
+// added for a locale that is not loaded are left out.
+func (app *application) loadWordFilter(ctx context.Context) error {
+	cfg := app.config.wordFilter
+	locales := cfg.localeList()
+
+	words := strings.Split(cfg.words, ",")
+	added, err := app.store.BannedWords.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, w := range added {
+		if w.Locale == "" || len(locales) == 0 || slices.Contains(locales, w.Locale) {
+			words = append(words, w.Word)
+		}
+	}
+
+	filter, err := wordfilter.New(wordfilter.Options{
+		Locales:       locales,
+		Words:         words,
+		Transliterate: service.Transliterate,
+	})
+	if err != nil {
+		return err
+	}
+	app.words.Store(filter)
+	return nil
+}
+
+// runWordFilterRefresher reloads the filter every interval until ctx is
+// cancelled. A failed reload keeps the previous words.
+func (app *application) runWordFilterRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.loadWordFilter(ctx); err != nil {
+				app.logger.Warnw("could not reload banned words", "error", err)
+			}
+		}
+	}
+}
+
+// bannedUsername is the service.AuthOptions hook.
+func (app *application) bannedUsername(username string) bool {
+	filter := app.words.Load()
+	return filter != nil && app.config.wordFilter.usernames && filter.UsernameContains(username)
+}
+
+// filterWords applies WORD_FILTER_CONTENT to texts: it masks banned words in
+// place, or refuses the request with 422 naming the first one.
+func (app *application) filterWords(texts ...*string) error {
+	filter := app.words.Load()
+	mode := app.config.wordFilter.content
+	if filter == nil || mode == "" || mode == wordFilterOff {
+		return nil
+	}
+
+	for _, text := range texts {
+		if mode == wordFilterMask {
+			*text = filter.Mask(*text)
+			continue
+		}
+		if word := filter.Match(*text); word != "" {
+			return newHTTPError(http.StatusUnprocessableEntity, fmt.Sprintf("%q is not allowed", word))
+		}
+	}
+	return nil
+}
+
+type AddBannedWordPayload struct {
+	Word   string `json:"word" validate:"required,max=100"`
+	Locale string `json:"locale" validate:"max=8"`
+}
+
+// adminListBannedWordsHandler godoc
+//
+//	@Summary		List banned words
+//	@Description	The words admins added to the word filter, alphabetically. The embedded lists and WORD_FILTER_WORDS are not included.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		store.BannedWord
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/banned-words [get]
+func (app *application) adminListBannedWordsHandler(r *http.Request, _ *noBody) ([]store.BannedWord, error) {
+	return app.store.BannedWords.List(r.Context())
+}
+
+// adminAddBannedWordHandler godoc
+//
+//	@Summary		Ban a word
+//	@Description	Adds a word to the word filter; a trailing * bans every word it starts. It applies to new usernames and content right away on this instance and within WORD_FILTER_REFRESH on the others. A word that is already banned answers 409.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		AddBannedWordPayload	true	"Word"
+//	@Success		201		{object}	store.BannedWord
+//	@Failure		400		{object}	error
+//	@Failure		409		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/banned-words [post]
+func (app *application) adminAddBannedWordHandler(r *http.Request, payload *AddBannedWordPayload) (*store.BannedWord, error) {
+	word, prefix := wordfilter.Normalize(payload.Word)
+	if word == "" || strings.ContainsFunc(word, func(r rune) bool { return r == ' ' || r == ',' }) {
+		return nil, newHTTPError(http.StatusBadRequest, "word must be a single word with at least one letter")
+	}
+	if prefix {
+		word += "*"
+	}
+
+	locale := strings.ToLower(strings.TrimSpace(payload.Locale))
+	if locale != "" && !slices.Contains(wordfilter.Locales(), locale) {
+		return nil, newHTTPError(http.StatusBadRequest, fmt.Sprintf("locale must be one of %s", strings.Join(wordfilter.Locales(), ", ")))
+	}
+
+	admin := getUserFromContext(r)
+	banned := &store.BannedWord{Word: word, Locale: locale, CreatedBy: &admin.ID}
+	if err := app.store.BannedWords.Add(r.Context(), banned); err != nil {
+		return nil, err
+	}
+	app.reloadWordFilter(r.Context())
+
+	app.logAdminAction(admin, "ban_word", "banned_word", banned.ID, word)
+	return banned, nil
+}
+
+// adminDeleteBannedWordHandler godoc
+//
+//	@Summary		Unban a word
+//	@Description	Removes a word admins added. Words of the embedded lists cannot be removed.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			wordID	path		int	true	"Banned word ID"
+//	@Success		200		{object}	map[string]string
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/admin/banned-words/{wordID} [delete]
+func (app *application) adminDeleteBannedWordHandler(r *http.Request, _ *noBody) (map[string]string, error) {
+	wordID, err := strconv.ParseInt(chi.URLParam(r, "wordID"), 10, 64)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "invalid banned word ID")
+	}
+	if err := app.store.BannedWords.Delete(r.Context(), wordID); err != nil {
+		return nil, err
+	}
+	app.reloadWordFilter(r.Context())
+
+	app.logAdminAction(getUserFromContext(r), "unban_word", "banned_word", wordID, "")
+	return map[string]string{"message": "word unbanned"}, nil
+}
+
+// reloadWordFilter applies a change on this instance; the change is saved
+// already, so a failure only delays it until the next refresh.
+func (app *application) reloadWordFilter(ctx context.Context) {
+	if err := app.loadWordFilter(ctx); err != nil {
+		app.logger.Warnw("could not reload banned words", "error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/reqctx"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestWordFilter(t *testing.T) {
+	app, _ := newMemoryTestApplication(t, config{wordFilter: wordFilterConfig{locales: "en", words: "grifter", usernames: true, content: wordFilterReject}})
+	if err := app.loadWordFilter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !app.bannedUsername("grifter_99") || app.bannedUsername("alice") {
+		t.Error("WORD_FILTER_WORDS not applied to usernames")
+	}
+
+	text := "Cozy flat, no grifters"
+	if err := app.filterWords(&text); err != nil {
+		t.Errorf("whole words only: %v", err)
+	}
+	text = "No Gr1fter please"
+	if err := app.filterWords(&text); err == nil || !strings.Contains(err.Error(), "Gr1fter") {
+		t.Errorf("reject: err = %v", err)
+	}
+
+	app.config.wordFilter.content = wordFilterMask
+	if err := app.filterWords(&text); err != nil || text != "No ******* please" {
+		t.Errorf("mask: %q, %v", text, err)
+	}
+
+	admin := &store.User{ID: 1, Role: store.Role{Name: store.RoleAdmin}}
+	mux := chi.NewRouter()
+	mux.Post("/v1/admin/banned-words", handle(app, http.StatusCreated, app.adminAddBannedWordHandler))
+	mux.Delete("/v1/admin/banned-words/{wordID}", handle(app, http.StatusOK, app.adminDeleteBannedWordHandler))
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		return executeRequest(req.WithContext(reqctx.WithUser(req.Context(), admin)), mux).Result()
+	}
+
+	checkResponseCode(t, http.StatusCreated, do(http.MethodPost, "/v1/admin/banned-words", `{"word": "Swindl*"}`).StatusCode)
+	checkResponseCode(t, http.StatusConflict, do(http.MethodPost, "/v1/admin/banned-words", `{"word": "swindl*"}`).StatusCode)
+	checkResponseCode(t, http.StatusBadRequest, do(http.MethodPost, "/v1/admin/banned-words", `{"word": "1234"}`).StatusCode)
+	checkResponseCode(t, http.StatusBadRequest, do(http.MethodPost, "/v1/admin/banned-words", `{"word": "swine", "locale": "xx"}`).StatusCode)
+	if !app.bannedUsername("swindler") {
+		t.Error("added word not applied")
+	}
+
+	words, err := app.store.BannedWords.List(context.Background())
+	if err != nil || len(words) != 1 || words[0].Word != "swindl*" {
+		t.Fatalf("stored %+v, %v", words, err)
+	}
+	checkResponseCode(t, http.StatusOK, do(http.MethodDelete, "/v1/admin/banned-words/"+strconv.FormatInt(words[0].ID, 10), "").StatusCode)
+	checkResponseCode(t, http.StatusNotFound, do(http.MethodDelete, "/v1/admin/banned-words/"+strconv.FormatInt(words[0].ID, 10), "").StatusCode)
+	if app.bannedUsername("swindler") {
+		t.Error("removed word still applied")
+	}
+}
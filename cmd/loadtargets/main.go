@@ -0,0 +1,164 @@
+// Command loadtargets writes request targets for the listing feed and
+// sign-in, for vegeta or k6. Sign-ins use the accounts cmd/seed creates, so
+// seed the database first with the same --seed and --password:
+//
+//	go run ./cmd/loadtargets --format vegeta -n 10000 > targets.json
+//	vegeta attack -format=json -targets=targets.json -rate=200 -duration=60s | vegeta report
+//
+//	go run ./cmd/loadtargets --format k6 -n 10000 > load.js
+//	k6 run --vus 50 --duration 60s load.js
+//
+// Run the API with LOAD_TEST=true so sign-ins are not rate limited and no
+// mail or captcha provider is called.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// target is one request. It marshals to vegeta's JSON target format, whose
+// body is base64, as encoding/json writes []byte.
+type target struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Body   []byte              `json:"body,omitempty"`
+	Header map[string][]string `json:"header,omitempty"`
+}
+
+var (
+	cities     = []string{"Almaty", "Astana", "Shymkent", "Karaganda", "Aktobe"}
+	dealTypes  = []string{"sale", "rent"}
+	tags       = []string{"parking", "balcony", "pets", "furnished", "sea_view", "newbuild"}
+	priceSteps = []int64{10_000_000, 25_000_000, 50_000_000, 100_000_000}
+)
+
+func main() {
+	baseURL := flag.String("base-url", "http://localhost:8080/v1", "API base URL")
+	format := flag.String("format", "vegeta", "vegeta (JSON lines) or k6 (a script)")
+	n := flag.Int("n", 1000, "number of targets")
+	authShare := flag.Float64("auth-share", 0.1, "share of targets that sign in, the rest read the feed")
+	users := flag.Int("users", 100, "number of seeded users to sign in as, see cmd/seed --users")
+	seed := flag.Int64("seed", 1, "the cmd/seed seed whose accounts sign in; also seeds the target mix")
+	password := flag.String("password", "Seed-pass-2024!", "password of the seeded accounts")
+	flag.Parse()
+
+	if *format != "vegeta" && *format != "k6" {
+		fmt.Fprintf(os.Stderr, "unknown --format %q, want vegeta or k6\n", *format)
+		os.Exit(2)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	base := strings.TrimRight(*baseURL, "/")
+	targets := make([]target, 0, *n)
+	for i := 0; i < *n; i++ {
+		if *users > 0 && rng.Float64() < *authShare {
+			targets = append(targets, signIn(base, fmt.Sprintf("user%d.seed%d@example.com", rng.Intn(*users), *seed), *password))
+		} else {
+			targets = append(targets, feed(rng, base))
+		}
+	}
+
+	var err error
+	if *format == "k6" {
+		err = writeK6(os.Stdout, targets)
+	} else {
+		err = writeVegeta(os.Stdout, targets)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "write targets:", err)
+		os.Exit(1)
+	}
+}
+
+// feed is a listing search the way the frontend makes them: a city, often a
+// deal type and price band, sometimes a tag, mostly the first pages.
+func feed(rng *rand.Rand, base string) target {
+	q := url.Values{}
+	q.Set("limit", "20")
+	path := "/listings"
+	if rng.Intn(5) == 0 {
+		path = "/tags/" + tags[rng.Intn(len(tags))] + "/listings"
+	}
+	if rng.Intn(4) != 0 {
+		q.Set("city", cities[rng.Intn(len(cities))])
+	}
+	if rng.Intn(2) == 0 {
+		q.Set("deal_type", dealTypes[rng.Intn(len(dealTypes))])
+	}
+	if rng.Intn(3) == 0 {
+		step := rng.Intn(len(priceSteps) - 1)
+		q.Set("price_min", strconv.FormatInt(priceSteps[step], 10))
+		q.Set("price_max", strconv.FormatInt(priceSteps[step+1], 10))
+	}
+	if page := rng.Intn(10); page > 6 {
+		q.Set("offset", strconv.Itoa((page-6)*20))
+	}
+	return target{Method: "GET", URL: base + path + "?" + q.Encode()}
+}
+
+func signIn(base, email, password string) target {
+	body, _ := json.Marshal(map[string]string{"identifier": email, "password": password})
+	return target{
+		Method: "POST",
+		URL:    base + "/authentication/token",
+		Body:   body,
+		Header: map[string][]string{"Content-Type": {"application/json"}},
+	}
+}
+
+func writeVegeta(w io.Writer, targets []target) error {
+	enc := json.NewEncoder(w)
+	for _, t := range targets {
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeK6 writes a script that cycles through the targets, each virtual
+// user starting at a different one, and checks for a 2xx status.
+func writeK6(w io.Writer, targets []target) error {
+	type k6Target struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Body    string            `json:"body,omitempty"`
+		Headers map[string]string `json:"headers,omitempty"`
+	}
+	out := make([]k6Target, 0, len(targets))
+	for _, t := range targets {
+		kt := k6Target{Method: t.Method, URL: t.URL, Body: string(t.Body)}
+		for k, v := range t.Header {
+			if kt.Headers == nil {
+				kt.Headers = make(map[string]string)
+			}
+			kt.Headers[k] = v[0]
+		}
+		out = append(out, kt)
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, `import http from "k6/http";
+import { check } from "k6";
+
+const targets = %s;
+
+export default function () {
+  const t = targets[(__VU * 7919 + __ITER) %% targets.length];
+  const res = http.request(t.method, t.url, t.body || null, { headers: t.headers || {} });
+  check(res, { "status is 2xx": (r) => r.status >= 200 && r.status < 300 });
+}
+`, data)
+	return err
+}
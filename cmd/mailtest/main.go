@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/env"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/mailer"
@@ -13,43 +18,180 @@ func main() {
 	to := flag.String("to", "", "recipient email address")
 	username := flag.String("username", "Test User", "recipient display username")
 	activationURL := flag.String("activation-url", "http://localhost:5173/confirm/test-token", "activation URL to include in email")
+	templateFile := flag.String("template", mailer.UserWelcomeTemplate, "template file name, see --list-templates")
+	varsFile := flag.String("vars", "", "JSON file with template variables; overrides --username and --activation-url")
+	renderOnly := flag.Bool("render-only", false, "render the template instead of sending it")
+	out := flag.String("out", "", "file to write the rendered email to with --render-only (default stdout)")
+	listTemplates := flag.Bool("list-templates", false, "print the available templates and exit")
+	captureURL := flag.String("mailhog", "", "MailHog or Mailpit web URL, e.g. http://localhost:8025, to check that the message arrived")
+	mailWait := flag.Duration("mail-wait", 10*time.Second, "how long to wait for the message with --mailhog")
 	flag.Parse()
 
+	if *listTemplates {
+		templates, err := mailer.Templates()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "list templates:", err)
+			os.Exit(1)
+		}
+		for _, name := range templates {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	vars := map[string]any{
+		"Username":      *username,
+		"ActivationURL": *activationURL,
+	}
+	if *varsFile != "" {
+		data, err := os.ReadFile(*varsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "read vars:", err)
+			os.Exit(1)
+		}
+		if err := json.Unmarshal(data, &vars); err != nil {
+			fmt.Fprintln(os.Stderr, "parse vars:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *renderOnly {
+		if err := renderTemplate(*templateFile, vars, *out); err != nil {
+			fmt.Fprintln(os.Stderr, "render failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *to == "" {
 		fmt.Fprintln(os.Stderr, "missing required --to")
 		os.Exit(2)
 	}
 
+	preset := env.GetString("SMTP_PRESET", "")
+	defaults, ok := mailer.SMTPPreset(preset)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "SMTP config error: invalid SMTP_PRESET %q\n", preset)
+		os.Exit(1)
+	}
+
 	cfg := mailer.SMTPConfig{
-		Host:               env.GetString("SMTP_HOST", ""),
-		Port:               env.GetInt("SMTP_PORT", 587),
+		Host:               env.GetString("SMTP_HOST", defaults.Host),
+		Port:               env.GetInt("SMTP_PORT", defaults.Port),
 		Username:           env.GetString("SMTP_USERNAME", ""),
 		Password:           env.GetString("SMTP_PASSWORD", ""),
-		FromEmail:          env.GetString("FROM_EMAIL", ""),
+		AuthMethod:         env.GetString("SMTP_AUTH", defaults.AuthMethod),
+		Encryption:         env.GetString("SMTP_ENCRYPTION", defaults.Encryption),
+		CAFile:             env.GetString("SMTP_CA_FILE", ""),
+		FromEmail:          env.GetString("FROM_EMAIL", defaults.FromEmail),
 		UseTLS:             env.GetBool("SMTP_TLS", false),
 		InsecureSkipVerify: env.GetBool("SMTP_INSECURE_SKIP_VERIFY", false),
+		DialTimeout:        env.GetDuration("SMTP_DIAL_TIMEOUT", mailer.DefaultSMTPDialTimeout),
+		SendTimeout:        env.GetDuration("SMTP_SEND_TIMEOUT", mailer.DefaultSMTPSendTimeout),
+		FromName:           env.GetString("FROM_NAME", mailer.FromName),
+		ReplyTo:            env.GetString("MAIL_REPLY_TO", ""),
+		ReturnPath:         env.GetString("MAIL_RETURN_PATH", ""),
 	}
 
+	overrides, err := mailer.ParseSenderOverrides(env.GetString("MAIL_FROM_OVERRIDES", ""))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "SMTP config error:", err)
+		os.Exit(1)
+	}
+	cfg.FromOverrides = overrides
+
+	pins, err := mailer.ParseTLSPins(env.GetString("SMTP_TLS_PINS", ""))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "SMTP config error:", err)
+		os.Exit(1)
+	}
+	cfg.TLSPins = pins
+
 	client, err := mailer.NewSMTPClient(cfg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "SMTP config error:", err)
 		os.Exit(1)
 	}
 
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      *username,
-		ActivationURL: *activationURL,
+	ctx := context.Background()
+
+	// remember what was there before, so an older copy does not count
+	var capture *mailer.CaptureServer
+	var previousID string
+	if *captureURL != "" {
+		capture = mailer.NewCaptureServer(*captureURL)
+		previous, err := capture.Latest(ctx, *to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "capture server:", err)
+			os.Exit(1)
+		}
+		if previous != nil {
+			previousID = previous.ID
+		}
 	}
 
-	status, err := client.Send(mailer.UserWelcomeTemplate, *username, *to, vars, true)
+	result, err := client.Send(ctx, *templateFile, *username, *to, vars, true)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "send failed:", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("sent OK, status:", status)
+	fmt.Println("sent OK, message ID:", result.MessageID)
+
+	if capture != nil {
+		if err := verifyReceived(ctx, capture, *to, previousID, *mailWait, *templateFile, vars); err != nil {
+			fmt.Fprintln(os.Stderr, "not received:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// verifyReceived waits for the message on the capture server and compares
+// its subject with the rendered one.
+func verifyReceived(ctx context.Context, capture *mailer.CaptureServer, to, previousID string, wait time.Duration, templateFile string, vars map[string]any) error {
+	subject, _, err := mailer.Render(templateFile, vars)
+	if err != nil {
+		return err
+	}
+
+	msg, err := capture.WaitFor(ctx, to, previousID, wait)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(msg.Subject) != strings.TrimSpace(subject) {
+		return fmt.Errorf("newest message has subject %q, want %q", msg.Subject, subject)
+	}
+
+	fmt.Println("received OK:", msg.Subject)
+	return nil
 }
 
+// renderTemplate writes the subject as an HTML comment followed by the body,
+// so the output opens directly in a browser.
+func renderTemplate(templateFile string, vars map[string]any, out string) error {
+	subject, body, err := mailer.Render(templateFile, vars)
+	if err != nil {
+		return err
+	}
+
+	warnings, err := mailer.Lint(templateFile, vars)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "lint:", warning)
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	_, err = fmt.Fprintf(w, "<!-- Subject: %s -->\n%s", subject, body)
+	return err
+}
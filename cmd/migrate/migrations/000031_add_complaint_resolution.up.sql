@@ -0,0 +1,4 @@
+ALTER TABLE complaints
+  ADD COLUMN IF NOT EXISTS resolution varchar(20) CHECK (resolution IN ('dismissed', 'removed')),
+  ADD COLUMN IF NOT EXISTS resolved_by bigint REFERENCES users(id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS resolved_at timestamp(0) with time zone;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_muted boolean NOT NULL DEFAULT false;
+
+ALTER TABLE application_messages ADD COLUMN IF NOT EXISTS is_hidden boolean NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id bigserial PRIMARY KEY,
+    template varchar(255) NOT NULL,
+    username varchar(255) NOT NULL,
+    email text NOT NULL,
+    data text NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    last_error text,
+    next_attempt_at timestamp(0) with time zone DEFAULT NOW(),
+    sent_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_pending ON email_outbox (next_attempt_at)
+    WHERE sent_at IS NULL AND next_attempt_at IS NOT NULL;
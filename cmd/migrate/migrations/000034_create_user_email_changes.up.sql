@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_email_changes (
+    user_id bigint PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    new_email text NOT NULL,
+    new_email_hash varchar(64) NOT NULL,
+    old_token varchar(64) NOT NULL UNIQUE,
+    new_token varchar(64) NOT NULL UNIQUE,
+    old_confirmed_at timestamp(0) with time zone,
+    new_confirmed_at timestamp(0) with time zone,
+    expiry timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
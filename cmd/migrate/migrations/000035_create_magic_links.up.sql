@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS magic_links (
+    token varchar(64) PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_magic_links_user_id ON magic_links (user_id);
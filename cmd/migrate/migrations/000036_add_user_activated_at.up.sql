@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS activated_at timestamp(0) with time zone;
+
+-- accounts active before this column existed went through activation
+UPDATE users SET activated_at = created_at WHERE is_active = true AND activated_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE email_outbox
+    ADD COLUMN IF NOT EXISTS triggered_by_kind varchar(16) NOT NULL DEFAULT 'system',
+    ADD COLUMN IF NOT EXISTS triggered_by_id bigint;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS email_suppressions (
+    email citext PRIMARY KEY,
+    reason varchar(16) NOT NULL,
+    source varchar(32) NOT NULL,
+    detail text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
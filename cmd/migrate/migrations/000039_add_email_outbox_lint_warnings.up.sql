@@ -0,0 +1,2 @@
+ALTER TABLE email_outbox
+    ADD COLUMN IF NOT EXISTS lint_warnings text[] NOT NULL DEFAULT '{}';
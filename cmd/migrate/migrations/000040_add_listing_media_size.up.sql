@@ -0,0 +1,5 @@
+ALTER TABLE listing_media
+    ADD COLUMN IF NOT EXISTS size_bytes bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS uploaded_by bigint REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_listing_media_uploaded_by ON listing_media(uploaded_by);
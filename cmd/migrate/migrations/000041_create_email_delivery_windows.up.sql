@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS email_delivery_windows (
+    user_id bigint PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    timezone text NOT NULL,
+    start_hour smallint NOT NULL CHECK (start_hour BETWEEN 0 AND 23),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
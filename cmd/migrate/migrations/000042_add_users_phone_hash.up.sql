@@ -0,0 +1,5 @@
+-- phone is encrypted, so uniqueness is enforced on a hash of its digits.
+-- Existing rows keep a NULL hash until the phone is next saved.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_hash text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_hash_key ON users(phone_hash);
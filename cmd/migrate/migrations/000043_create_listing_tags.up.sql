@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS listing_tags (
+    listing_id bigint NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    tag varchar(50) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (listing_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_listing_tags_tag ON listing_tags (tag);
+CREATE INDEX IF NOT EXISTS idx_listing_tags_created_at ON listing_tags (created_at);
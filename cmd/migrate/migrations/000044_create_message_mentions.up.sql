@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS message_mentions (
+    message_id bigint NOT NULL REFERENCES application_messages(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions (user_id, created_at DESC);
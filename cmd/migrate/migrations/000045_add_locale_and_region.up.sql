@@ -0,0 +1,7 @@
+-- locale and region override what is derived from the user's country.
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS locale VARCHAR(8) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS region VARCHAR(2) NOT NULL DEFAULT '';
+
+-- ISO 3166-1 alpha-2 code; listings are ranked by their company's country.
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS country VARCHAR(2) NOT NULL DEFAULT '';
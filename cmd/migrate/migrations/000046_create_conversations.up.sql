@@ -0,0 +1,28 @@
+-- A conversation is between two users; user_a is always the smaller id so
+-- each pair has exactly one. last_read_* hold the id of the newest message
+-- each side has read.
+CREATE TABLE IF NOT EXISTS conversations (
+    id bigserial PRIMARY KEY,
+    user_a bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_b bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_a bigint NOT NULL DEFAULT 0,
+    last_read_b bigint NOT NULL DEFAULT 0,
+    last_message_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT conversations_user_order CHECK (user_a < user_b),
+    CONSTRAINT conversations_users_key UNIQUE (user_a, user_b)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_user_b ON conversations (user_b);
+
+-- Messages from muted users are stored hidden, as in application chats.
+CREATE TABLE IF NOT EXISTS direct_messages (
+    id bigserial PRIMARY KEY,
+    conversation_id bigint NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    sender_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body text NOT NULL,
+    is_hidden boolean NOT NULL DEFAULT false,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_direct_messages_conversation ON direct_messages (conversation_id, id DESC);
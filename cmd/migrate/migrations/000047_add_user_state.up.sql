@@ -0,0 +1,33 @@
+-- state replaces the is_active/activated_at pair as the source of truth for
+-- the account lifecycle. Accounts disabled by an admin become suspended.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS state varchar(16) NOT NULL DEFAULT 'pending';
+
+UPDATE users SET state = CASE
+    WHEN is_active THEN 'active'
+    WHEN activated_at IS NOT NULL THEN 'suspended'
+    ELSE 'pending'
+END;
+
+ALTER TABLE users ADD CONSTRAINT users_state_check
+    CHECK (state IN ('pending', 'active', 'suspended', 'deactivated', 'deleted'));
+
+-- is_active stays for the queries that only care about active accounts, but
+-- can no longer disagree with state.
+ALTER TABLE users DROP COLUMN is_active;
+ALTER TABLE users ADD COLUMN is_active boolean GENERATED ALWAYS AS (state = 'active') STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_state ON users (state);
+
+-- Every state change is recorded; actor_id is null for changes the system
+-- makes, such as activation.
+CREATE TABLE IF NOT EXISTS user_state_events (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_state varchar(16) NOT NULL,
+    to_state varchar(16) NOT NULL,
+    actor_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    reason text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_state_events_user ON user_state_events (user_id, id DESC);
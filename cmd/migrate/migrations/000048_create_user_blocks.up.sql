@@ -0,0 +1,12 @@
+-- A block hides blocker_id from blocked_id: the blocked user cannot see the
+-- blocker's profile or message them, and the two stop seeing each other's
+-- conversations.
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CONSTRAINT user_blocks_not_self CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks (blocked_id);
@@ -0,0 +1,3 @@
+-- Private profiles are only shown to their owner, staff and users they
+-- already share a conversation with.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_private boolean NOT NULL DEFAULT false;
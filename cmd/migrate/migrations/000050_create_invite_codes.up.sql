@@ -0,0 +1,26 @@
+-- Codes that let people register while AUTH_INVITE_ONLY is on. Admins mint
+-- codes with any number of uses; regular users get a few single-use codes
+-- for friends, counted by created_by where admin is false.
+CREATE TABLE IF NOT EXISTS invite_codes (
+    id bigserial PRIMARY KEY,
+    code varchar(32) NOT NULL UNIQUE,
+    created_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    admin boolean NOT NULL DEFAULT false,
+    max_uses int NOT NULL DEFAULT 1,
+    uses int NOT NULL DEFAULT 0,
+    expires_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT invite_codes_uses CHECK (uses >= 0 AND uses <= max_uses)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_codes_created_by ON invite_codes (created_by);
+
+-- Who registered with which code, and so who invited whom.
+CREATE TABLE IF NOT EXISTS invite_code_redemptions (
+    code_id bigint NOT NULL REFERENCES invite_codes(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (code_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_code_redemptions_user ON invite_code_redemptions (user_id);
@@ -0,0 +1,7 @@
+-- Coarse location and device of each login, used for new sign-in alerts and
+-- the sign-in history at /v1/users/me/sessions.
+ALTER TABLE user_login_events
+    ADD COLUMN IF NOT EXISTS country varchar(2) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS device text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS user_login_events_user_created_idx ON user_login_events (user_id, created_at DESC) WHERE success;
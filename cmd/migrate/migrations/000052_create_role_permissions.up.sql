@@ -0,0 +1,25 @@
+-- What each role may do. The admin role passes every permission check
+-- regardless, its rows only list the permissions for the admin UI.
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id bigint NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission varchar(64) NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+
+-- Grant what the hardcoded role checks allowed before.
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.permission
+FROM roles r
+JOIN (
+    VALUES
+        ('agency', 'listings.write'),
+        ('developer', 'listings.write'),
+        ('moderator', 'complaints.review'),
+        ('moderator', 'complaints.resolve'),
+        ('moderator', 'users.mute'),
+        ('admin', 'listings.write'),
+        ('admin', 'complaints.review'),
+        ('admin', 'complaints.resolve'),
+        ('admin', 'users.mute')
+) AS p (role, permission) ON p.role = r.name
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,16 @@
+-- A company is a team: every user with its company_id is a member and
+-- company_role is what they may do within it. The user who registered the
+-- company owns it.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS company_role varchar(16);
+
+UPDATE users SET company_role = 'owner' WHERE company_id IS NOT NULL AND company_role IS NULL;
+
+ALTER TABLE users ADD CONSTRAINT users_company_role
+    CHECK (company_role IN ('owner', 'manager', 'agent'));
+
+-- Team invites are registration invites with company_id set: the token
+-- lets the user with email join the company instead of registering one.
+ALTER TABLE registration_invites
+    ADD COLUMN IF NOT EXISTS company_id bigint REFERENCES companies(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS email citext,
+    ADD COLUMN IF NOT EXISTS company_role varchar(16);
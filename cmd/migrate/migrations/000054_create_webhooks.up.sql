@@ -0,0 +1,33 @@
+-- Outgoing webhooks. Admin hooks have no company_id and receive every
+-- event they subscribe to; company hooks only receive events about their
+-- company. secret is encrypted with ENCRYPTION_KEY.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial PRIMARY KEY,
+    created_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    company_id bigint REFERENCES companies(id) ON DELETE CASCADE,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text[] NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_company_id ON webhooks (company_id);
+
+-- One row per event and hook, delivered and retried by the webhook relay
+-- and kept as the delivery log.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    webhook_id bigint NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event varchar(64) NOT NULL,
+    payload text NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    response_status int,
+    last_error text,
+    next_attempt_at timestamp(0) with time zone DEFAULT NOW(),
+    delivered_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending
+    ON webhook_deliveries (next_attempt_at) WHERE delivered_at IS NULL AND next_attempt_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id DESC);
@@ -0,0 +1,2 @@
+-- The ranked feed counts favorites per listing.
+CREATE INDEX IF NOT EXISTS idx_favorites_listing_id ON favorites(listing_id);
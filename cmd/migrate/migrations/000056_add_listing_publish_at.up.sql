@@ -0,0 +1,9 @@
+-- Listings approved before their publish_at wait as 'scheduled' until the
+-- API's publisher makes them active.
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone;
+
+ALTER TABLE listings DROP CONSTRAINT IF EXISTS listings_status_check;
+ALTER TABLE listings ADD CONSTRAINT listings_status_check
+  CHECK (status IN ('draft', 'moderation', 'scheduled', 'active', 'rejected', 'archived'));
+
+CREATE INDEX IF NOT EXISTS idx_listings_scheduled ON listings(publish_at) WHERE status = 'scheduled';
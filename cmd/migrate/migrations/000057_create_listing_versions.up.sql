@@ -0,0 +1,27 @@
+-- version counts edits and guards against concurrent ones; every edit saves
+-- the content it replaces in listing_versions.
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS version int NOT NULL DEFAULT 1;
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS edited_at timestamp(0) with time zone;
+
+CREATE TABLE IF NOT EXISTS listing_versions (
+  listing_id bigint NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+  version int NOT NULL,
+  project_id bigint,
+  title text NOT NULL,
+  description text NOT NULL,
+  property_type varchar(50) NOT NULL,
+  deal_type varchar(10) NOT NULL,
+  price bigint NOT NULL,
+  city varchar(100) NOT NULL,
+  address text DEFAULT '',
+  rooms smallint,
+  area numeric(10,2),
+  floor smallint,
+  total_floors smallint,
+  latitude numeric(9,6),
+  longitude numeric(9,6),
+  publish_at timestamp(0) with time zone,
+  -- replaced_at is when the next version replaced this one
+  replaced_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (listing_id, version)
+);
@@ -0,0 +1,4 @@
+-- Companies pin a few listings to the top of their profile.
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS pinned_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_listings_pinned ON listings(company_id, pinned_at) WHERE pinned_at IS NOT NULL;
@@ -0,0 +1,20 @@
+-- Open Graph previews of the links in listing descriptions, keyed by URL and
+-- shared by every listing that links there. Rows are queued as pending when
+-- a listing is saved and filled in by the link preview fetcher; title and
+-- the rest stay NULL when the page had no metadata or could not be fetched.
+CREATE TABLE IF NOT EXISTS link_previews (
+    url text PRIMARY KEY,
+    status varchar(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    title text,
+    description text,
+    image_url text,
+    site_name text,
+    attempts int NOT NULL DEFAULT 0,
+    last_error text,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    fetched_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_previews_pending
+    ON link_previews (next_attempt_at) WHERE status = 'pending';
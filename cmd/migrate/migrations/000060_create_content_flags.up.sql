@@ -0,0 +1,17 @@
+-- Listings and application messages the content filter held for
+-- moderators, with the reasons it gave. Held messages are hidden until a
+-- moderator approves them.
+CREATE TABLE IF NOT EXISTS content_flags (
+    id bigserial PRIMARY KEY,
+    target_type varchar(16) NOT NULL CHECK (target_type IN ('listing', 'message')),
+    target_id bigint NOT NULL,
+    author_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    reasons text[] NOT NULL,
+    excerpt text NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'removed')),
+    resolved_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_flags_status ON content_flags (status, id DESC);
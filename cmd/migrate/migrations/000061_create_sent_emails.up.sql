@@ -0,0 +1,17 @@
+-- Messages the mail provider accepted, with its message ID, so support can
+-- tell whether an email went out. The recipients are encrypted like the
+-- outbox; email_hash finds the emails sent to an address.
+CREATE TABLE IF NOT EXISTS sent_emails (
+    id bigserial PRIMARY KEY,
+    outbox_id bigint REFERENCES email_outbox(id) ON DELETE SET NULL,
+    template varchar(255) NOT NULL,
+    username varchar(255) NOT NULL,
+    email text NOT NULL,
+    email_hash varchar(64) NOT NULL,
+    provider varchar(32) NOT NULL,
+    message_id text NOT NULL DEFAULT '',
+    accepted text NOT NULL,
+    sent_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sent_emails_email_hash ON sent_emails (email_hash, id DESC);
@@ -0,0 +1,20 @@
+-- Opens and clicks of tracked emails. A 'sent' row is written for every
+-- tracked email so the stats can compare opens and clicks against it.
+-- outbox_id identifies the email and has no foreign key: events outlive
+-- the outbox rows they count.
+CREATE TABLE IF NOT EXISTS email_tracking_events (
+    id bigserial PRIMARY KEY,
+    outbox_id bigint NOT NULL,
+    template varchar(255) NOT NULL,
+    kind varchar(8) NOT NULL CHECK (kind IN ('sent', 'open', 'click')),
+    url text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_tracking_events_created_at ON email_tracking_events (created_at);
+
+-- Users who opted out of tracking get their emails untouched.
+CREATE TABLE IF NOT EXISTS email_tracking_opt_outs (
+    user_id bigint PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,23 @@
+-- Announcements mailed to every active user of a segment. The API sends
+-- them in batches of users ordered by id; last_user_id is the last user a
+-- batch reached, so a broadcast resumes there after a restart or a pause.
+-- locked_until keeps two instances from sending the same batch.
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id bigserial PRIMARY KEY,
+    subject varchar(200) NOT NULL,
+    body text NOT NULL,
+    segment jsonb NOT NULL DEFAULT '{}',
+    status varchar(16) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'paused', 'completed')),
+    total int NOT NULL DEFAULT 0,
+    sent int NOT NULL DEFAULT 0,
+    failed int NOT NULL DEFAULT 0,
+    skipped int NOT NULL DEFAULT 0,
+    last_user_id bigint NOT NULL DEFAULT 0,
+    locked_until timestamp(0) with time zone,
+    created_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcasts_running ON broadcasts (id) WHERE status = 'running';
@@ -0,0 +1,2 @@
+-- usernames are unique regardless of case; the API stores them lowercased
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
@@ -0,0 +1,9 @@
+-- Daily views of profiles and listings, each viewer counted once a day.
+-- The API buffers them in Redis and adds them here periodically.
+CREATE TABLE IF NOT EXISTS view_counts (
+    kind varchar(16) NOT NULL CHECK (kind IN ('profile', 'listing')),
+    target_id bigint NOT NULL,
+    day date NOT NULL,
+    views bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (kind, target_id, day)
+);
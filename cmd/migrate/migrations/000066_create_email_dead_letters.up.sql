@@ -0,0 +1,30 @@
+-- Emails the outbox relay gave up on, moved out of the outbox with the
+-- rendered message so an admin can see what would have gone out and retry
+-- or discard it. Recipient, data and the rendered message are encrypted
+-- like the outbox.
+CREATE TABLE IF NOT EXISTS email_dead_letters (
+    id bigserial PRIMARY KEY,
+    outbox_id bigint NOT NULL,
+    template varchar(255) NOT NULL,
+    username varchar(255) NOT NULL,
+    email text NOT NULL,
+    data text NOT NULL,
+    subject text NOT NULL DEFAULT '',
+    body text NOT NULL DEFAULT '',
+    attempts int NOT NULL,
+    last_error text NOT NULL DEFAULT '',
+    triggered_by_kind varchar(16) NOT NULL DEFAULT 'system',
+    triggered_by_id bigint,
+    queued_at timestamp(0) with time zone NOT NULL,
+    failed_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- Emails already given up on move over without a rendered message.
+INSERT INTO email_dead_letters (outbox_id, template, username, email, data, attempts, last_error,
+    triggered_by_kind, triggered_by_id, queued_at)
+SELECT id, template, username, email, data, attempts, COALESCE(last_error, ''),
+    triggered_by_kind, triggered_by_id, created_at
+FROM email_outbox
+WHERE sent_at IS NULL AND next_attempt_at IS NULL AND attempts >= 8;
+
+DELETE FROM email_outbox WHERE sent_at IS NULL AND next_attempt_at IS NULL AND attempts >= 8;
@@ -0,0 +1,28 @@
+-- Communities hosted by one deployment. Every user and listing belongs to
+-- one; without TENANCY_ENABLED everything lives in the default tenant.
+CREATE TABLE IF NOT EXISTS tenants (
+    id bigserial PRIMARY KEY,
+    slug varchar(63) NOT NULL UNIQUE,
+    name varchar(255) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO tenants (id, slug, name) VALUES (1, 'default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval('tenants_id_seq', GREATEST((SELECT MAX(id) FROM tenants), 1));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+
+CREATE INDEX IF NOT EXISTS idx_listings_tenant_id ON listings (tenant_id);
+
+-- emails, usernames and phones are unique within a tenant
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_email_hash_key ON users (tenant_id, email_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_username_lower_key ON users (tenant_id, LOWER(username));
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_phone_hash_key ON users (tenant_id, phone_hash);
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_username_key;
+DROP INDEX IF EXISTS users_email_hash_key;
+DROP INDEX IF EXISTS idx_users_username_lower;
+DROP INDEX IF EXISTS users_phone_hash_key;
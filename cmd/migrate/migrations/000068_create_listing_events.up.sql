@@ -0,0 +1,18 @@
+-- Events at a listing, such as open house viewings, published in the
+-- calendar feeds. sequence grows with every edit so calendar apps update
+-- the event they already have.
+CREATE TABLE IF NOT EXISTS listing_events (
+    id bigserial PRIMARY KEY,
+    listing_id bigint NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    title varchar(255) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    location text NOT NULL DEFAULT '',
+    starts_at timestamp(0) with time zone NOT NULL,
+    ends_at timestamp(0) with time zone NOT NULL,
+    sequence int NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT listing_events_ends_after_start CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_listing_events_listing ON listing_events(listing_id, starts_at);
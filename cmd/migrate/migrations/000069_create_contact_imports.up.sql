@@ -0,0 +1,17 @@
+-- Address books and follow lists imported from other platforms. The
+-- uploaded entries are not kept, only the counts and the matched users.
+CREATE TABLE IF NOT EXISTS contact_imports (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source varchar(20) NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    total int NOT NULL DEFAULT 0,
+    invalid int NOT NULL DEFAULT 0,
+    unmatched int NOT NULL DEFAULT 0,
+    user_ids bigint[] NOT NULL DEFAULT '{}',
+    error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_contact_imports_user ON contact_imports(user_id, id);
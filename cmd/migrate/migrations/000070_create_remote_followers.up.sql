@@ -0,0 +1,11 @@
+-- Accounts on other ActivityPub servers following a company. New listings
+-- are delivered to their inbox; shared_inbox, when the server has one, gets
+-- a single copy for all its followers.
+CREATE TABLE IF NOT EXISTS remote_followers (
+    company_id bigint NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    actor_id text NOT NULL,
+    inbox text NOT NULL,
+    shared_inbox text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (company_id, actor_id)
+);
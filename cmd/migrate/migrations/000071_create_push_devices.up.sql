@@ -0,0 +1,34 @@
+-- Devices that receive push notifications. token is the FCM registration
+-- token, the APNs device token or the Web Push endpoint; p256dh and auth
+-- are the Web Push subscription keys. failures counts deliveries given up
+-- on in a row, and the device is dropped when it reaches the limit.
+CREATE TABLE IF NOT EXISTS push_devices (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    platform varchar(16) NOT NULL,
+    token text NOT NULL,
+    p256dh text NOT NULL DEFAULT '',
+    auth text NOT NULL DEFAULT '',
+    failures int NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    last_used_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (platform, token)
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_devices_user_id ON push_devices (user_id);
+
+-- One row per notification and device, sent and retried by the push relay.
+CREATE TABLE IF NOT EXISTS push_deliveries (
+    id bigserial PRIMARY KEY,
+    device_id bigint NOT NULL REFERENCES push_devices(id) ON DELETE CASCADE,
+    notification text NOT NULL,
+    attempts int NOT NULL DEFAULT 0,
+    last_error text,
+    next_attempt_at timestamp(0) with time zone DEFAULT NOW(),
+    delivered_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_deliveries_pending
+    ON push_deliveries (next_attempt_at) WHERE delivered_at IS NULL AND next_attempt_at IS NOT NULL;
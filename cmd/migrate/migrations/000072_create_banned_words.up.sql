@@ -0,0 +1,10 @@
+-- Words admins ban at runtime, on top of the lists embedded in the API.
+-- locale is informational, '' for words of no particular language.
+CREATE TABLE IF NOT EXISTS banned_words (
+    id bigserial PRIMARY KEY,
+    word varchar(100) NOT NULL,
+    locale varchar(8) NOT NULL DEFAULT '',
+    created_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (word)
+);
@@ -0,0 +1,5 @@
+-- Deleted listings are kept for an undelete window before they are purged
+-- with everything that cascades from them.
+ALTER TABLE listings ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_listings_deleted_at ON listings(deleted_at) WHERE deleted_at IS NOT NULL;
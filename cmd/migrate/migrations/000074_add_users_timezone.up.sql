@@ -0,0 +1,3 @@
+-- IANA timezone the user's mail is scheduled in, set from the country at
+-- registration; empty means derived from the country.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- Bulk moderation actions run in the background; each job records its
+-- targets, how far it got and why targets failed.
+CREATE TABLE IF NOT EXISTS moderation_jobs (
+    id bigserial PRIMARY KEY,
+    admin_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    action varchar(30) NOT NULL,
+    target_ids bigint[] NOT NULL,
+    reason text NOT NULL DEFAULT '',
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    done int NOT NULL DEFAULT 0,
+    failed int NOT NULL DEFAULT 0,
+    failures jsonb NOT NULL DEFAULT '[]',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone
+);
@@ -0,0 +1,19 @@
+-- Background jobs of internal/jobs. Workers claim queued jobs whose run_at
+-- has passed; unique_key keeps one job per schedule tick across instances.
+CREATE TABLE IF NOT EXISTS jobs (
+    id bigserial PRIMARY KEY,
+    kind varchar(50) NOT NULL,
+    payload jsonb NOT NULL DEFAULT 'null',
+    status varchar(20) NOT NULL DEFAULT 'queued',
+    attempts int NOT NULL DEFAULT 0,
+    max_attempts int NOT NULL,
+    last_error text NOT NULL DEFAULT '',
+    unique_key varchar(200) UNIQUE,
+    run_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    started_at timestamp(0) with time zone,
+    finished_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs (run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs (status, id DESC);
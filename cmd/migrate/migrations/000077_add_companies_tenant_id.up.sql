@@ -0,0 +1,16 @@
+-- Companies belong to a tenant like their users and listings; existing ones
+-- take the tenant of their members.
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+
+UPDATE companies SET tenant_id = users.tenant_id
+FROM users
+WHERE users.company_id = companies.id AND companies.tenant_id <> users.tenant_id;
+
+CREATE INDEX IF NOT EXISTS idx_companies_tenant_id ON companies (tenant_id);
+
+-- registration numbers and emails are unique within a tenant
+CREATE UNIQUE INDEX IF NOT EXISTS companies_tenant_registration_number_key ON companies (tenant_id, registration_number);
+CREATE UNIQUE INDEX IF NOT EXISTS companies_tenant_email_hash_key ON companies (tenant_id, email_hash);
+
+ALTER TABLE companies DROP CONSTRAINT IF EXISTS companies_registration_number_key;
+DROP INDEX IF EXISTS idx_companies_email_hash;
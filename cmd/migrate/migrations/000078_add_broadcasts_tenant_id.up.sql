@@ -0,0 +1,6 @@
+-- Broadcasts are mailed to the users of the tenant whose admin created them.
+-- Existing ones were created before tenants were told apart and belong to
+-- the default tenant.
+ALTER TABLE broadcasts ADD COLUMN IF NOT EXISTS tenant_id bigint NOT NULL DEFAULT 1 REFERENCES tenants (id);
+
+CREATE INDEX IF NOT EXISTS idx_broadcasts_tenant_id ON broadcasts (tenant_id);
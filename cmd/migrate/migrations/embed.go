@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations so the API can report which
+// ones it was built with and socialctl can apply them. The migrate CLI reads
+// the same files from disk.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
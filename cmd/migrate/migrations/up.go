@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// Up applies the embedded migrations newer than the database's version, in
+// order, and returns the files it applied. It keeps schema_migrations the
+// way the migrate CLI does, so both can be used on the same database: the
+// version is marked dirty while its file runs, and a dirty database is left
+// for an operator to fix.
+func Up(ctx context.Context, db *sql.DB) ([]string, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY, dirty boolean NOT NULL)`)
+	if err != nil {
+		return nil, err
+	}
+
+	var current int
+	var dirty bool
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&current, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("database is dirty at version %d, fix it and force the version with the migrate CLI", current)
+	}
+
+	files, err := fs.Glob(FS, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(file, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return applied, fmt.Errorf("migration %s: bad version", file)
+		}
+		if version <= current {
+			continue
+		}
+
+		sqlText, err := fs.ReadFile(FS, file)
+		if err != nil {
+			return applied, err
+		}
+		if err := setVersion(ctx, db, version, true); err != nil {
+			return applied, err
+		}
+		if _, err := db.ExecContext(ctx, string(sqlText)); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", file, err)
+		}
+		if err := setVersion(ctx, db, version, false); err != nil {
+			return applied, err
+		}
+		applied = append(applied, file)
+	}
+	return applied, nil
+}
+
+func setVersion(ctx context.Context, db *sql.DB, version int, dirty bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
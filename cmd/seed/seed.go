@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/service"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// counts is how much of each kind of data to create.
+type counts struct {
+	users        int
+	companies    int
+	listings     int
+	favorites    int
+	applications int
+	messages     int
+}
+
+var (
+	firstNames = []string{"Aigerim", "Arman", "Dana", "Daniyar", "Ella", "Erlan", "Gulnara", "Ivan", "Kamila", "Marat", "Nurlan", "Olga", "Ruslan", "Saule", "Timur", "Zarina"}
+	lastNames  = []string{"Abenov", "Akhmetova", "Baimukhanov", "Ivanova", "Kim", "Nurpeisova", "Omarov", "Petrov", "Sadykova", "Seitkali", "Tulegenov", "Zhunusova"}
+	cities     = []string{"Almaty", "Astana", "Shymkent", "Karaganda", "Aktobe"}
+	streets    = []string{"Abay Ave", "Satpayev St", "Kabanbay Batyr", "Dostyk Ave", "Tole Bi St", "Al-Farabi Ave", "Zhibek Zholy"}
+
+	propertyTypes = []string{"apartment", "house", "commercial"}
+	adjectives    = []string{"Bright", "Cozy", "Spacious", "Renovated", "Quiet", "Modern"}
+	features      = []string{"#parking", "#balcony", "#pets", "#furnished", "#sea_view", "#newbuild", "near the metro", "with a garden"}
+
+	messageBodies = []string{
+		"Hello! Is it still available?",
+		"Could we arrange a viewing this week?",
+		"Is the price negotiable?",
+		"Are utilities included?",
+		"Thank you, we will get back to you shortly.",
+		"The viewing is confirmed for Saturday at 11.",
+		"Please send a copy of your ID before the viewing.",
+	}
+)
+
+// generator creates the data set. Everything it picks comes from rng, so the
+// same seed always produces the same data.
+type generator struct {
+	store store.Storage
+	rng   *rand.Rand
+	seed  int64
+	// hashed carries the password every seeded user gets. Hashing is slow,
+	// so it is done once and copied.
+	hashed *store.User
+}
+
+func (g *generator) run(ctx context.Context, n counts) error {
+	agents, err := g.companies(ctx, n.companies)
+	if err != nil {
+		return err
+	}
+	users, err := g.users(ctx, n.users)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d companies and %d users\n", len(agents), len(users))
+
+	listings, err := g.listings(ctx, n.listings, agents)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d listings\n", len(listings))
+
+	favorites, err := g.favorites(ctx, n.favorites, users, listings)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d favorites\n", favorites)
+
+	applications, err := g.applications(ctx, n.applications, users, listings)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d applications\n", len(applications))
+
+	messages, err := g.messages(ctx, n.messages, applications, listings, agents)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d messages\n", messages)
+	return nil
+}
+
+// companies creates verified agencies and developers with an active owner
+// each. The owners are returned by company ID; they post the listings.
+func (g *generator) companies(ctx context.Context, n int) (map[int64]*store.User, error) {
+	agents := make(map[int64]*store.User, n)
+	for i := 0; i < n; i++ {
+		kind, suffix := store.RoleAgency, "Realty"
+		if i%3 == 2 {
+			kind, suffix = store.RoleDeveloper, "Construction"
+		}
+		company := &store.Company{
+			Name:               pick(g.rng, lastNames) + " " + suffix,
+			RegistrationNumber: fmt.Sprintf("SEED-%d-%04d", g.seed, i),
+			City:               pick(g.rng, cities),
+			Email:              fmt.Sprintf("office%d.seed%d@example.com", i, g.seed),
+			Phone:              g.phone(1, i),
+			Type:               kind,
+		}
+		owner := g.person(fmt.Sprintf("agent%d.seed%d@example.com", i, g.seed), g.phone(2, i), kind)
+
+		// The invitation is never used: the owner is activated directly.
+		if err := g.store.Users.CreateCompanyAndUser(ctx, company, owner, g.token("company", i), time.Hour, nil); err != nil {
+			return nil, fmt.Errorf("company %d: %w", i, err)
+		}
+		if err := g.store.Users.Transition(ctx, owner.ID, store.UserStateActive, nil, "seed data"); err != nil {
+			return nil, err
+		}
+		if err := g.store.Companies.UpdateVerificationStatus(ctx, company.ID, store.VerificationVerified); err != nil {
+			return nil, err
+		}
+		agents[company.ID] = owner
+	}
+	return agents, nil
+}
+
+func (g *generator) users(ctx context.Context, n int) ([]*store.User, error) {
+	users := make([]*store.User, 0, n)
+	for i := 0; i < n; i++ {
+		user := g.person(fmt.Sprintf("user%d.seed%d@example.com", i, g.seed), g.phone(3, i), store.RoleUser)
+		if err := g.store.Users.CreateActive(ctx, user); err != nil {
+			return nil, fmt.Errorf("user %d: %w", i, err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (g *generator) listings(ctx context.Context, n int, agents map[int64]*store.User) ([]*store.Listing, error) {
+	if len(agents) == 0 {
+		return nil, nil
+	}
+	companyIDs := sortedKeys(agents)
+
+	listings := make([]*store.Listing, 0, n)
+	for i := 0; i < n; i++ {
+		rooms := 1 + g.rng.Intn(5)
+		area := float64(25+rooms*18+g.rng.Intn(30)) + 0.5*float64(g.rng.Intn(2))
+		kind := pick(g.rng, propertyTypes)
+		city := pick(g.rng, cities)
+
+		listing := &store.Listing{
+			CompanyID:    companyIDs[g.rng.Intn(len(companyIDs))],
+			Title:        fmt.Sprintf("%s %d-room %s in %s", pick(g.rng, adjectives), rooms, kind, city),
+			Description:  fmt.Sprintf("%s, %s.", pick(g.rng, features), pick(g.rng, features)),
+			PropertyType: kind,
+			DealType:     "sale",
+			Price:        int64(rooms) * int64(15_000_000+g.rng.Intn(10_000_000)),
+			City:         city,
+			Address:      fmt.Sprintf("%s %d", pick(g.rng, streets), 1+g.rng.Intn(200)),
+			Rooms:        &rooms,
+			Area:         &area,
+			Status:       store.ListingStatusActive,
+		}
+		var rent *store.RentConstraints
+		if g.rng.Intn(3) == 0 {
+			listing.DealType = "rent"
+			listing.Price = int64(rooms) * int64(100_000+g.rng.Intn(80_000))
+			rent = &store.RentConstraints{AllowStudents: g.rng.Intn(2) == 0, MaxOccupants: rooms + 1, MinTermMonths: 3 * (1 + g.rng.Intn(4))}
+		}
+		if g.rng.Intn(10) == 0 {
+			listing.Status = store.ListingStatusModeration
+		}
+
+		if err := g.store.Listings.Create(ctx, listing, nil, rent); err != nil {
+			return nil, fmt.Errorf("listing %d: %w", i, err)
+		}
+		listings = append(listings, listing)
+	}
+	return listings, nil
+}
+
+// favorites saves up to n distinct user and listing pairs; there are fewer
+// when users times listings is smaller.
+func (g *generator) favorites(ctx context.Context, n int, users []*store.User, listings []*store.Listing) (int, error) {
+	pairs := g.pairs(n, len(users), len(listings))
+	for _, p := range pairs {
+		if err := g.store.Favorites.Add(ctx, users[p[0]].ID, listings[p[1]].ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(pairs), nil
+}
+
+// applications files up to n applications from distinct user and listing
+// pairs, since a user applies to a listing once.
+func (g *generator) applications(ctx context.Context, n int, users []*store.User, listings []*store.Listing) ([]*store.Application, error) {
+	statuses := []string{store.ApplicationStatusNew, store.ApplicationStatusReview, store.ApplicationStatusApproved, store.ApplicationStatusRejected}
+
+	var applications []*store.Application
+	for _, p := range g.pairs(n, len(users), len(listings)) {
+		user, listing := users[p[0]], listings[p[1]]
+		application := &store.Application{
+			ListingID:    listing.ID,
+			UserID:       user.ID,
+			FullName:     user.FirstName + " " + user.LastName,
+			Phone:        user.Phone,
+			Email:        user.Email,
+			Status:       statuses[g.rng.Intn(len(statuses))],
+			IsCompatible: true,
+			DealType:     listing.DealType,
+		}
+		if err := g.store.Applications.Create(ctx, application); err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+	return applications, nil
+}
+
+// messages spreads n messages over the applications, from the applicant or
+// the listing company's agent.
+func (g *generator) messages(ctx context.Context, n int, applications []*store.Application, listings []*store.Listing, agents map[int64]*store.User) (int, error) {
+	if len(applications) == 0 {
+		return 0, nil
+	}
+	companyOf := make(map[int64]int64, len(listings))
+	for _, l := range listings {
+		companyOf[l.ID] = l.CompanyID
+	}
+
+	for i := 0; i < n; i++ {
+		application := applications[g.rng.Intn(len(applications))]
+		sender := application.UserID
+		if agent, ok := agents[companyOf[application.ListingID]]; ok && g.rng.Intn(2) == 0 {
+			sender = agent.ID
+		}
+		msg := &store.ApplicationMessage{
+			ApplicationID: application.ID,
+			SenderUserID:  &sender,
+			Body:          pick(g.rng, messageBodies),
+		}
+		if err := g.store.Messages.Create(ctx, msg); err != nil {
+			return i, err
+		}
+	}
+	return n, nil
+}
+
+// person builds a user with a random name and the shared password.
+func (g *generator) person(email, phone, role string) *store.User {
+	first, last := pick(g.rng, firstNames), pick(g.rng, lastNames)
+	user := &store.User{
+		Username:  service.GenerateUsername(first, last, email),
+		FirstName: first,
+		LastName:  last,
+		Email:     email,
+		Phone:     phone,
+		Country:   "KZ",
+		Role:      store.Role{Name: role},
+	}
+	user.Password = g.hashed.Password
+	return user
+}
+
+// phone returns a number unique to the seed, the kind of account and i.
+func (g *generator) phone(kind, i int) string {
+	return fmt.Sprintf("+7%03d%d%06d", g.seed%1000, kind, i)
+}
+
+// token returns an invitation token hash unique to the seed.
+func (g *generator) token(kind string, i int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("seed %d %s %d", g.seed, kind, i)))
+	return hex.EncodeToString(sum[:])
+}
+
+// pairs returns up to n distinct index pairs (a, b) with a < na and b < nb.
+func (g *generator) pairs(n, na, nb int) [][2]int {
+	n = min(n, na*nb)
+	seen := make(map[[2]int]bool, n)
+	pairs := make([][2]int, 0, n)
+	for len(pairs) < n {
+		p := [2]int{g.rng.Intn(na), g.rng.Intn(nb)}
+		if !seen[p] {
+			seen[p] = true
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+// sortedKeys returns the company IDs in order, so picking one by index
+// does not depend on map iteration.
+func sortedKeys(agents map[int64]*store.User) []int64 {
+	ids := make([]int64, 0, len(agents))
+	for id := range agents {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func pick(rng *rand.Rand, values []string) string {
+	return values[rng.Intn(len(values))]
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestSeedIsDeterministic(t *testing.T) {
+	hashed := &store.User{}
+	if err := hashed.Password.Set("Seed-pass-2024!"); err != nil {
+		t.Fatal(err)
+	}
+	n := counts{users: 8, companies: 3, listings: 20, favorites: 15, applications: 10, messages: 25}
+
+	titles := func(seed int64) []string {
+		st := store.NewMemoryStorage()
+		g := &generator{store: st, rng: rand.New(rand.NewSource(seed)), seed: seed, hashed: hashed}
+		if err := g.run(context.Background(), n); err != nil {
+			t.Fatal(err)
+		}
+		listings, err := st.Listings.List(context.Background(), store.ListingFilter{Limit: 50})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, l := range listings {
+			titles = append(titles, l.Title)
+		}
+		return titles
+	}
+
+	first := titles(7)
+	if len(first) == 0 {
+		t.Fatal("no active listings were seeded")
+	}
+	if again := titles(7); !reflect.DeepEqual(first, again) {
+		t.Fatalf("seed 7 produced %q, then %q", first, again)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiClient calls the JSON API and unwraps its {"data": ...} envelope.
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL string) *apiClient {
+	return &apiClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// do sends body as JSON and decodes the response data into out, which may
+// be nil. A status other than want is an error carrying the response body.
+func (c *apiClient) do(ctx context.Context, method, path string, body any, want int, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != want {
+		return fmt.Errorf("%s %s: got %d, want %d: %s", method, path, resp.StatusCode, want, bytes.TrimSpace(data))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+
+	envelope := struct {
+		Data any `json:"data"`
+	}{Data: out}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
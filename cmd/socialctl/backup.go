@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/env"
+)
+
+// A backup is JSON Lines: a backupHeader, then one backupRecord per row,
+// table by table in backupTables order so a restore never inserts a row
+// before the rows it references. Rows are row_to_json of the table, so
+// columns the API encrypts stay encrypted with ENCRYPTION_KEY and a restore
+// needs the same key.
+//
+// With BACKUP_ENCRYPTION_KEY set the file is also encrypted as a whole, see
+// sealWriter; without it backup refuses to run unless --plain is given.
+const (
+	backupFormat  = "socialctl-backup"
+	backupVersion = 1
+)
+
+// backupTable is a table in the backup and the columns of its primary key,
+// which --on-conflict compares.
+type backupTable struct {
+	name string
+	key  []string
+}
+
+// backupTables are the accounts, listings and the relationships between
+// them, parents first. Queues, logs and caches the API rebuilds are left out.
+var backupTables = []backupTable{
+	{"tenants", []string{"id"}},
+	{"roles", []string{"id"}},
+	{"role_permissions", []string{"role_id", "permission"}},
+	{"companies", []string{"id"}},
+	{"users", []string{"id"}},
+	{"projects", []string{"id"}},
+	{"listings", []string{"id"}},
+	{"listing_media", []string{"id"}},
+	{"listing_rent_constraints", []string{"listing_id"}},
+	{"listing_tags", []string{"listing_id", "tag"}},
+	{"favorites", []string{"user_id", "listing_id"}},
+	{"user_blocks", []string{"blocker_id", "blocked_id"}},
+}
+
+type backupHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// SchemaVersion is the migration the database was at; a backup only
+	// restores into a database at the same one.
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Tables        []string  `json:"tables"`
+}
+
+type backupRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// Conflict strategies for restore, for rows whose key is already taken.
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictFail      = "fail"
+)
+
+func backup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("out", "", "file to write (required); - writes stdout")
+	plain := fs.Bool("plain", false, "write an unencrypted backup when BACKUP_ENCRYPTION_KEY is not set")
+	fs.Parse(args)
+
+	if *out == "" {
+		return errors.New("--out is required")
+	}
+	aead, err := backupKey()
+	if err != nil {
+		return err
+	}
+	if aead == nil && !*plain {
+		return errors.New("BACKUP_ENCRYPTION_KEY is not set; set it or pass --plain")
+	}
+
+	conn, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	w := os.Stdout
+	if *out != "-" {
+		// 0600: the backup holds password hashes even when it is encrypted
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	counts, err := writeSealedBackup(ctx, conn, w, aead)
+	if err != nil {
+		if *out != "-" {
+			os.Remove(*out)
+		}
+		return err
+	}
+
+	for _, t := range backupTables {
+		fmt.Fprintf(os.Stderr, "%-26s %d rows\n", t.name, counts[t.name])
+	}
+	return nil
+}
+
+// writeSealedBackup writes the backup to w, encrypted when aead is set.
+func writeSealedBackup(ctx context.Context, conn *sql.DB, w io.Writer, aead cipher.AEAD) (map[string]int, error) {
+	buf := bufio.NewWriter(w)
+	var sink io.Writer = buf
+	var sealer *sealWriter
+	if aead != nil {
+		var err error
+		if sealer, err = newSealWriter(buf, aead); err != nil {
+			return nil, err
+		}
+		sink = sealer
+	}
+
+	counts, err := writeBackup(ctx, conn, sink)
+	if err != nil {
+		return nil, err
+	}
+	if sealer != nil {
+		if err := sealer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, buf.Flush()
+}
+
+// writeBackup writes the header and every row of backupTables to w inside
+// one read-only transaction, so the backup is a consistent snapshot.
+func writeBackup(ctx context.Context, conn *sql.DB, w io.Writer) (map[string]int, error) {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(w)
+	header := backupHeader{Format: backupFormat, Version: backupVersion, SchemaVersion: version, CreatedAt: time.Now().UTC()}
+	for _, t := range backupTables {
+		header.Tables = append(header.Tables, t.name)
+	}
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, t := range backupTables {
+		// table and key names come from backupTables, never from input
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT row_to_json(t) FROM %s t ORDER BY %s`, t.name, strings.Join(t.key, ", ")))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+		for rows.Next() {
+			var row json.RawMessage
+			if err := rows.Scan(&row); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if err := enc.Encode(backupRecord{Table: t.name, Row: row}); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts[t.name]++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+	return counts, nil
+}
+
+func restore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("in", "", "backup file to read (required); - reads stdin")
+	onConflict := fs.String("on-conflict", conflictSkip, "rows whose key exists: skip keeps the existing row, overwrite replaces it, fail aborts the restore")
+	fs.Parse(args)
+
+	if *in == "" {
+		return errors.New("--in is required")
+	}
+	switch *onConflict {
+	case conflictSkip, conflictOverwrite, conflictFail:
+	default:
+		return fmt.Errorf("--on-conflict must be %s, %s or %s", conflictSkip, conflictOverwrite, conflictFail)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	r, err := openBackup(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+
+	conn, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	restored, skipped, err := readBackup(ctx, conn, r, *onConflict)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range backupTables {
+		fmt.Printf("%-26s %d restored, %d skipped\n", t.name, restored[t.name], skipped[t.name])
+	}
+	fmt.Println("restored; the API's cached users expire within a minute")
+	return nil
+}
+
+// openBackup returns the JSON Lines of a plain or encrypted backup.
+func openBackup(r *bufio.Reader) (io.Reader, error) {
+	magic, err := r.Peek(len(sealMagic))
+	if err != nil || string(magic) != sealMagic {
+		// a plain backup, or not a backup, which the header check reports
+		return r, nil
+	}
+
+	aead, err := backupKey()
+	if err != nil {
+		return nil, err
+	}
+	if aead == nil {
+		return nil, errors.New("the backup is encrypted; set BACKUP_ENCRYPTION_KEY")
+	}
+	return newOpenReader(r, aead)
+}
+
+// readBackup inserts the rows of the backup in one transaction, so a failed
+// restore changes nothing. It returns the rows restored and skipped per
+// table.
+func readBackup(ctx context.Context, conn *sql.DB, r io.Reader, onConflict string) (map[string]int, map[string]int, error) {
+	dec := json.NewDecoder(r)
+	var header backupHeader
+	if err := dec.Decode(&header); err != nil || header.Format != backupFormat {
+		return nil, nil, errors.New("not a socialctl backup, or the BACKUP_ENCRYPTION_KEY is wrong")
+	}
+	if header.Version != backupVersion {
+		return nil, nil, fmt.Errorf("backup format version %d is not supported", header.Version)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version != header.SchemaVersion {
+		return nil, nil, fmt.Errorf("the backup was taken at migration %d and the database is at %d; migrate it to %d first",
+			header.SchemaVersion, version, header.SchemaVersion)
+	}
+
+	inserts := make(map[string]string)
+	restored := make(map[string]int)
+	skipped := make(map[string]int)
+	for {
+		var rec backupRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		insert, ok := inserts[rec.Table]
+		if !ok {
+			table, ok := findBackupTable(rec.Table)
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown table %q in the backup", rec.Table)
+			}
+			if insert, err = restoreStatement(ctx, tx, table, onConflict); err != nil {
+				return nil, nil, err
+			}
+			inserts[rec.Table] = insert
+		}
+
+		res, err := tx.ExecContext(ctx, insert, string(rec.Row))
+		if err != nil {
+			if onConflict == conflictFail {
+				return nil, nil, fmt.Errorf("%s %s: %w", rec.Table, rec.Row, err)
+			}
+			return nil, nil, fmt.Errorf("%s: %w", rec.Table, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			skipped[rec.Table]++
+		} else {
+			restored[rec.Table]++
+		}
+	}
+
+	// new rows must not reuse the IDs that were restored
+	for _, t := range backupTables {
+		if len(t.key) == 1 && t.key[0] == "id" && restored[t.name] > 0 {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(
+				`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), GREATEST((SELECT MAX(id) FROM %[1]s), 1))`, t.name))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", t.name, err)
+			}
+		}
+	}
+
+	return restored, skipped, tx.Commit()
+}
+
+func findBackupTable(name string) (backupTable, bool) {
+	for _, t := range backupTables {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return backupTable{}, false
+}
+
+// restoreStatement builds the INSERT for a row of table, passed as JSON in
+// $1. Generated columns such as users.is_active are left out.
+func restoreStatement(ctx context.Context, tx *sql.Tx, table backupTable, onConflict string) (string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND is_generated = 'NEVER'
+		ORDER BY ordinal_position`, table.name)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var columns, updates []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return "", err
+		}
+		columns = append(columns, column)
+		if !slices.Contains(table.key, column) {
+			updates = append(updates, fmt.Sprintf("%[1]s = EXCLUDED.%[1]s", column))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	list := strings.Join(columns, ", ")
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM json_populate_record(NULL::%s, $1::json)`, table.name, list, list, table.name)
+	switch {
+	case onConflict == conflictSkip, onConflict == conflictOverwrite && len(updates) == 0:
+		insert += ` ON CONFLICT DO NOTHING`
+	case onConflict == conflictOverwrite:
+		insert += fmt.Sprintf(` ON CONFLICT (%s) DO UPDATE SET %s`, strings.Join(table.key, ", "), strings.Join(updates, ", "))
+	}
+	return insert, nil
+}
+
+// schemaVersion is the migration the database is at.
+func schemaVersion(ctx context.Context, tx *sql.Tx) (int, error) {
+	var version int
+	var dirty bool
+	err := tx.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return 0, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("database is dirty at version %d", version)
+	}
+	return version, nil
+}
+
+// backupKey returns the cipher for BACKUP_ENCRYPTION_KEY, nil if it is not
+// set. It is a base64-encoded 32-byte key like ENCRYPTION_KEY, and should
+// not be the same one so a stolen backup and database key are not enough.
+func backupKey() (cipher.AEAD, error) {
+	key := env.GetString("BACKUP_ENCRYPTION_KEY", "")
+	if key == "" {
+		return nil, nil
+	}
+	aead, err := crypto.NewAEADFromBase64Key(key)
+	if err != nil {
+		return nil, fmt.Errorf("BACKUP_ENCRYPTION_KEY: %w", err)
+	}
+	return aead, nil
+}
+
+// An encrypted backup is sealMagic, a random 4-byte nonce prefix and
+// AES-GCM chunks of up to sealChunkSize bytes. Each chunk is a 4-byte
+// big-endian length, whose top bit marks the last chunk, and the sealed
+// bytes. The nonce is the prefix and the chunk's number and the last-chunk
+// bit is authenticated, so reordered, dropped or truncated chunks fail to
+// open.
+const (
+	sealMagic     = "SCBK1\n"
+	sealChunkSize = 64 << 10
+	sealLastChunk = 1 << 31
+)
+
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  [4]byte
+	counter uint64
+	buf     []byte
+}
+
+func newSealWriter(w io.Writer, aead cipher.AEAD) (*sealWriter, error) {
+	s := &sealWriter{w: w, aead: aead, buf: make([]byte, 0, sealChunkSize)}
+	if _, err := rand.Read(s.prefix[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, sealMagic); err != nil {
+		return nil, err
+	}
+	_, err := w.Write(s.prefix[:])
+	return s, err
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		take := min(len(p), sealChunkSize-len(s.buf))
+		s.buf = append(s.buf, p[:take]...)
+		p = p[take:]
+		if len(s.buf) == sealChunkSize {
+			if err := s.seal(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last chunk, which may be empty. It does not close the
+// underlying writer.
+func (s *sealWriter) Close() error {
+	return s.seal(true)
+}
+
+func (s *sealWriter) seal(last bool) error {
+	sealed := s.aead.Seal(nil, sealNonce(s.prefix, s.counter), s.buf, sealAD(last))
+	s.counter++
+	s.buf = s.buf[:0]
+
+	length := uint32(len(sealed))
+	if last {
+		length |= sealLastChunk
+	}
+	if err := binary.Write(s.w, binary.BigEndian, length); err != nil {
+		return err
+	}
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+type openReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  [4]byte
+	counter uint64
+	plain   bytes.Reader
+	done    bool
+}
+
+func newOpenReader(r io.Reader, aead cipher.AEAD) (*openReader, error) {
+	o := &openReader{r: r, aead: aead}
+	if _, err := io.ReadFull(r, make([]byte, len(sealMagic))); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, o.prefix[:]); err != nil {
+		return nil, errors.New("the backup is truncated")
+	}
+	return o, nil
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for o.plain.Len() == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		if err := o.open(); err != nil {
+			return 0, err
+		}
+	}
+	return o.plain.Read(p)
+}
+
+func (o *openReader) open() error {
+	var length uint32
+	if err := binary.Read(o.r, binary.BigEndian, &length); err != nil {
+		return errors.New("the backup is truncated")
+	}
+	last := length&sealLastChunk != 0
+	length &^= sealLastChunk
+	if length > sealChunkSize+uint32(o.aead.Overhead()) {
+		return errors.New("the backup is corrupt")
+	}
+
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(o.r, sealed); err != nil {
+		return errors.New("the backup is truncated")
+	}
+	plain, err := o.aead.Open(nil, sealNonce(o.prefix, o.counter), sealed, sealAD(last))
+	if err != nil {
+		return errors.New("the backup is corrupt or BACKUP_ENCRYPTION_KEY is wrong")
+	}
+	o.counter++
+	o.plain.Reset(plain)
+
+	if last {
+		o.done = true
+		if n, _ := o.r.Read(make([]byte, 1)); n > 0 {
+			return errors.New("the backup has data after its last chunk")
+		}
+	}
+	return nil
+}
+
+func sealNonce(prefix [4]byte, counter uint64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix[:])
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func sealAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+)
+
+func TestSealedBackup(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	aead, err := crypto.NewAEADFromBase64Key(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more than two chunks, so the last one is partial
+	plain := []byte(strings.Repeat(`{"table":"users","row":{"id":1}}`+"\n", 5000))
+	var sealed bytes.Buffer
+	w, err := newSealWriter(&sealed, aead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed.Bytes(), []byte("users")) {
+		t.Fatal("the backup is not encrypted")
+	}
+
+	open := func(data []byte) ([]byte, error) {
+		r, err := newOpenReader(bytes.NewReader(data), aead)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	got, err := open(sealed.Bytes())
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("round trip: %v", err)
+	}
+
+	// dropping the last chunk leaves a stream that looks complete up to
+	// a chunk boundary, which must not pass for the whole backup
+	truncated := sealed.Bytes()[:len(sealMagic)+4+4+sealChunkSize+aead.Overhead()]
+	if _, err := open(truncated); err == nil {
+		t.Error("truncated backup opened")
+	}
+
+	tampered := bytes.Clone(sealed.Bytes())
+	tampered[len(tampered)-1] ^= 1
+	if _, err := open(tampered); err == nil {
+		t.Error("tampered backup opened")
+	}
+}
@@ -0,0 +1,132 @@
+// Package activitypub holds the pieces of ActivityPub the API federates
+// with: the vocabulary it sends and reads, and the HTTP Signatures
+// (draft-cavage-http-signatures-12, as Mastodon speaks them) that servers
+// authenticate deliveries with.
+package activitypub
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	// ContentType is what actors, activities and collections are served as.
+	ContentType = "application/activity+json"
+	// JRDContentType is the content type of WebFinger answers.
+	JRDContentType = "application/jrd+json"
+
+	ActivityStreams = "https://www.w3.org/ns/activitystreams"
+	Security        = "https://w3id.org/security/v1"
+	// Public addresses an activity to everyone.
+	Public = ActivityStreams + "#Public"
+)
+
+// Actor is the document an actor ID dereferences to.
+type Actor struct {
+	Context           []string  `json:"@context"`
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	PreferredUsername string    `json:"preferredUsername"`
+	Name              string    `json:"name"`
+	Summary           string    `json:"summary,omitempty"`
+	URL               string    `json:"url,omitempty"`
+	Inbox             string    `json:"inbox"`
+	Outbox            string    `json:"outbox"`
+	Followers         string    `json:"followers"`
+	PublicKey         PublicKey `json:"publicKey"`
+}
+
+// PublicKey is the key an actor signs its requests with.
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPEM string `json:"publicKeyPem"`
+}
+
+// RemoteActor is the part of another server's actor the API uses.
+type RemoteActor struct {
+	ID        string    `json:"id"`
+	Inbox     string    `json:"inbox"`
+	PublicKey PublicKey `json:"publicKey"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+}
+
+// Note is a post.
+type Note struct {
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Name         string   `json:"name,omitempty"`
+	Content      string   `json:"content"`
+	URL          string   `json:"url,omitempty"`
+	Published    string   `json:"published,omitempty"`
+	Updated      string   `json:"updated,omitempty"`
+	To           []string `json:"to"`
+	Cc           []string `json:"cc,omitempty"`
+}
+
+// Activity is an activity the API sends. Object is an ID or a document.
+type Activity struct {
+	Context   any      `json:"@context,omitempty"`
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Actor     string   `json:"actor"`
+	Object    any      `json:"object"`
+	Published string   `json:"published,omitempty"`
+	To        []string `json:"to,omitempty"`
+	Cc        []string `json:"cc,omitempty"`
+}
+
+// IncomingActivity is an activity delivered to an inbox. Object is kept
+// raw because it is an ID or a document depending on the sender.
+type IncomingActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// ObjectID returns the ID of an object given either as an ID or as a
+// document with one.
+func ObjectID(raw json.RawMessage) string {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id
+	}
+	var object struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(raw, &object)
+	return object.ID
+}
+
+// OrderedCollection is a collection such as an outbox or a followers list.
+type OrderedCollection struct {
+	Context      string `json:"@context"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	TotalItems   int    `json:"totalItems"`
+	OrderedItems []any  `json:"orderedItems,omitempty"`
+}
+
+// WebFinger is a JSON Resource Descriptor (RFC 7033).
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// IsActivityPub reports whether an Accept or Content-Type header asks for
+// ActivityStreams.
+func IsActivityPub(header string) bool {
+	return strings.Contains(header, ContentType) ||
+		strings.Contains(header, `application/ld+json; profile="`+ActivityStreams+`"`)
+}
@@ -0,0 +1,206 @@
+package activitypub
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxClockSkew is how far the Date of a signed request may be from now.
+const MaxClockSkew = time.Hour
+
+var (
+	ErrNotSigned        = errors.New("request is not signed")
+	ErrInvalidSignature = errors.New("signature does not match")
+	ErrStale            = errors.New("signed date is too far from now")
+)
+
+// signedHeaders are signed on every request the API sends. Deliveries
+// always have a body, so digest is among them.
+var signedHeaders = []string{"(request-target)", "host", "date", "digest"}
+
+// ParsePrivateKey reads an RSA key in PKCS #1 or PKCS #8 PEM.
+func ParsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA key")
+	}
+	return key, nil
+}
+
+// PublicKeyPEM encodes key the way actor documents publish it.
+func PublicKeyPEM(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// ParsePublicKey reads the PEM of an actor's publicKeyPem.
+func ParsePublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Digest is the Digest header value of body.
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Sign sets the Date, Digest and Signature headers of req, whose body is
+// body, signing with key under keyID (the actor's publicKey id).
+func Sign(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey, now time.Time) error {
+	req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	req.Header.Set("Digest", Digest(body))
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, signedHeaders)))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(signedHeaders, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// KeyID returns the keyId of the request's signature, so the caller can
+// fetch the key to Verify with.
+func KeyID(req *http.Request) (string, error) {
+	params, err := signatureParams(req)
+	if err != nil {
+		return "", err
+	}
+	return params["keyId"], nil
+}
+
+// Verify checks the signature of req, whose body is body, against key. The
+// signature must cover the request target, host, date and, with a body,
+// digest, and the date must be within MaxClockSkew of now.
+func Verify(req *http.Request, body []byte, key *rsa.PublicKey, now time.Time) error {
+	params, err := signatureParams(req)
+	if err != nil {
+		return err
+	}
+	if alg := params["algorithm"]; alg != "" && alg != "rsa-sha256" && alg != "hs2019" {
+		return fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	required := []string{"(request-target)", "host", "date"}
+	if len(body) > 0 {
+		required = append(required, "digest")
+	}
+	for _, h := range required {
+		if !slices.Contains(headers, h) {
+			return fmt.Errorf("signature does not cover %s", h)
+		}
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return ErrStale
+	}
+	if d := now.Sub(date); d > MaxClockSkew || d < -MaxClockSkew {
+		return ErrStale
+	}
+	if len(body) > 0 && req.Header.Get("Digest") != Digest(body) {
+		return ErrInvalidSignature
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	hashed := sha256.Sum256([]byte(signingString(req, headers)))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig) != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func signingString(req *http.Request, headers []string) string {
+	var b bytes.Buffer
+	for i, h := range headers {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(h + ": ")
+		switch h {
+		case "(request-target)":
+			b.WriteString(strings.ToLower(req.Method) + " " + req.URL.RequestURI())
+		case "host":
+			b.WriteString(req.Host)
+		default:
+			b.WriteString(strings.TrimSpace(req.Header.Get(h)))
+		}
+	}
+	return b.String()
+}
+
+// signatureParams parses the Signature header, or an Authorization header
+// of the Signature scheme.
+func signatureParams(req *http.Request) (map[string]string, error) {
+	header := req.Header.Get("Signature")
+	if header == "" {
+		header, _ = strings.CutPrefix(req.Header.Get("Authorization"), "Signature ")
+	}
+	if header == "" {
+		return nil, ErrNotSigned
+	}
+
+	params := map[string]string{}
+	for _, part := range strings.Split(header, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		params[name] = strings.Trim(value, `"`)
+	}
+	if params["keyId"] == "" || params["signature"] == "" {
+		return nil, ErrNotSigned
+	}
+	return params, nil
+}
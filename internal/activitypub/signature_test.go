@@ -0,0 +1,56 @@
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey, err := PublicKeyPEM(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParsePublicKey(pemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"type":"Follow"}`)
+	req, _ := http.NewRequest(http.MethodPost, "https://homes.example.com/v1/ap/companies/1/inbox", strings.NewReader(string(body)))
+	if err := Sign(req, body, "https://social.example/users/anna#main-key", key, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := KeyID(req); err != nil || id != "https://social.example/users/anna#main-key" {
+		t.Errorf("KeyID = %q, %v", id, err)
+	}
+	if err := Verify(req, body, public, now.Add(time.Minute)); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := Verify(req, []byte(`{"type":"Undo"}`), public, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("changed body: got %v", err)
+	}
+	if err := Verify(req, body, public, now.Add(2*time.Hour)); !errors.Is(err, ErrStale) {
+		t.Errorf("old request: got %v", err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if err := Verify(req, body, &other.PublicKey, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other key: got %v", err)
+	}
+
+	req.Header.Del("Signature")
+	if err := Verify(req, body, public, now); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("unsigned: got %v", err)
+	}
+}
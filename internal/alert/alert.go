@@ -0,0 +1,125 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Alert describes a failure that needs an operator. Key identifies the
+// condition; alerts with the same key are deduplicated and resolved together.
+type Alert struct {
+	Key     string
+	Summary string
+	Details string
+}
+
+// Notifier delivers alerts to one channel. resolved is true when the
+// condition behind a previously sent alert has cleared.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert, resolved bool) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface.
+type NotifierFunc func(ctx context.Context, a Alert, resolved bool) error
+
+func (f NotifierFunc) Notify(ctx context.Context, a Alert, resolved bool) error {
+	return f(ctx, a, resolved)
+}
+
+// Route sends alerts to Notifier once the condition has been firing for
+// After. A zero After notifies on the first Fire; a longer one escalates,
+// e.g. paging only when a Slack message was not enough.
+type Route struct {
+	Notifier Notifier
+	After    time.Duration
+}
+
+// Manager tracks firing alerts and routes them to notifiers. A firing alert
+// is repeated on a route at most once per repeat interval, so callers can
+// call Fire on every check without flooding the channels.
+type Manager struct {
+	routes []Route
+	repeat time.Duration
+	now    func() time.Time
+
+	mu     sync.Mutex
+	firing map[string]*firingAlert
+}
+
+type firingAlert struct {
+	since time.Time
+	// sent holds when each route was last notified, by route index
+	sent map[int]time.Time
+}
+
+// NewManager returns a Manager for routes. A zero repeat notifies each route
+// only once per incident.
+func NewManager(routes []Route, repeat time.Duration) *Manager {
+	return &Manager{
+		routes: routes,
+		repeat: repeat,
+		now:    time.Now,
+		firing: make(map[string]*firingAlert),
+	}
+}
+
+// Fire reports that the condition behind a is present. It notifies the
+// routes that are due and returns their errors joined.
+func (m *Manager) Fire(ctx context.Context, a Alert) error {
+	m.mu.Lock()
+	now := m.now()
+	state, ok := m.firing[a.Key]
+	if !ok {
+		state = &firingAlert{since: now, sent: make(map[int]time.Time)}
+		m.firing[a.Key] = state
+	}
+
+	var due []int
+	for i, route := range m.routes {
+		if now.Sub(state.since) < route.After {
+			continue
+		}
+		last, sent := state.sent[i]
+		if sent && (m.repeat <= 0 || now.Sub(last) < m.repeat) {
+			continue
+		}
+		state.sent[i] = now
+		due = append(due, i)
+	}
+	m.mu.Unlock()
+
+	return m.notify(ctx, due, a, false)
+}
+
+// Resolve reports that the condition behind a has cleared. Routes that
+// were notified of it get a resolved notice; nothing is sent if the alert
+// was not firing.
+func (m *Manager) Resolve(ctx context.Context, a Alert) error {
+	m.mu.Lock()
+	state, ok := m.firing[a.Key]
+	delete(m.firing, a.Key)
+	m.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var notified []int
+	for i := range m.routes {
+		if _, sent := state.sent[i]; sent {
+			notified = append(notified, i)
+		}
+	}
+	return m.notify(ctx, notified, a, true)
+}
+
+func (m *Manager) notify(ctx context.Context, routes []int, a Alert, resolved bool) error {
+	var errs []error
+	for _, i := range routes {
+		if err := m.routes[i].Notifier.Notify(ctx, a, resolved); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
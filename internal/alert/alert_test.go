@@ -0,0 +1,62 @@
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	fired, resolved int
+}
+
+func (r *recorder) Notify(ctx context.Context, a Alert, resolved bool) error {
+	if resolved {
+		r.resolved++
+	} else {
+		r.fired++
+	}
+	return nil
+}
+
+func TestManagerDedupAndEscalation(t *testing.T) {
+	var slack, pager recorder
+	m := NewManager([]Route{{Notifier: &slack}, {Notifier: &pager, After: 10 * time.Minute}}, time.Hour)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	db := Alert{Key: "database_unreachable", Summary: "Database unreachable"}
+
+	for i := 0; i < 3; i++ {
+		m.Fire(ctx, db)
+		now = now.Add(time.Minute)
+	}
+	if slack.fired != 1 || pager.fired != 0 {
+		t.Fatalf("after 3 minutes: slack %d, pager %d; want 1, 0", slack.fired, pager.fired)
+	}
+
+	now = now.Add(10 * time.Minute)
+	m.Fire(ctx, db)
+	if slack.fired != 1 || pager.fired != 1 {
+		t.Fatalf("after escalation: slack %d, pager %d; want 1, 1", slack.fired, pager.fired)
+	}
+
+	now = now.Add(time.Hour)
+	m.Fire(ctx, db)
+	if slack.fired != 2 || pager.fired != 2 {
+		t.Fatalf("after repeat interval: slack %d, pager %d; want 2, 2", slack.fired, pager.fired)
+	}
+
+	m.Resolve(ctx, db)
+	m.Resolve(ctx, db)
+	if slack.resolved != 1 || pager.resolved != 1 {
+		t.Fatalf("resolved: slack %d, pager %d; want 1, 1", slack.resolved, pager.resolved)
+	}
+
+	m.Fire(ctx, db)
+	m.Resolve(ctx, db)
+	if pager.fired != 2 || pager.resolved != 1 {
+		t.Errorf("a short incident should not page: fired %d, resolved %d", pager.fired, pager.resolved)
+	}
+}
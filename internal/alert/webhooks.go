@@ -0,0 +1,98 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// SlackNotifier posts alerts to a Slack incoming webhook.
+type SlackNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+func NewSlackNotifier(webhookURL string, timeout time.Duration) *SlackNotifier {
+	return &SlackNotifier{
+		client:     &http.Client{Timeout: timeout},
+		webhookURL: webhookURL,
+	}
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, a Alert, resolved bool) error {
+	text := ":rotating_light: *" + a.Summary + "*"
+	if resolved {
+		text = ":white_check_mark: Resolved: *" + a.Summary + "*"
+	} else if a.Details != "" {
+		text += "\n" + a.Details
+	}
+
+	return postJSON(ctx, n.client, n.webhookURL, map[string]string{"text": text})
+}
+
+// PagerDutyNotifier sends Events API v2 events. The alert key is the dedup
+// key, so PagerDuty keeps one incident per condition and resolves it.
+type PagerDutyNotifier struct {
+	client     *http.Client
+	url        string
+	routingKey string
+	source     string
+}
+
+func NewPagerDutyNotifier(routingKey, source string, timeout time.Duration) *PagerDutyNotifier {
+	return &PagerDutyNotifier{
+		client:     &http.Client{Timeout: timeout},
+		url:        pagerDutyEventsURL,
+		routingKey: routingKey,
+		source:     source,
+	}
+}
+
+func (n *PagerDutyNotifier) Notify(ctx context.Context, a Alert, resolved bool) error {
+	event := map[string]any{
+		"routing_key":  n.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    a.Key,
+	}
+	if resolved {
+		event["event_action"] = "resolve"
+	} else {
+		event["payload"] = map[string]any{
+			"summary":        a.Summary,
+			"source":         n.source,
+			"severity":       "critical",
+			"custom_details": map[string]string{"details": a.Details},
+		}
+	}
+
+	return postJSON(ctx, n.client, n.url, event)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -2,24 +2,44 @@ package auth
 
 import (
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenConfig is what tokens are signed and checked with.
+type TokenConfig struct {
+	// Secret signs JWTs
+	Secret string
+	// Key encrypts PASETO tokens and must be 32 bytes
+	Key []byte
+	// Issuer must be the iss of every token
+	Issuer string
+	// Audience lists the audiences tokens are issued for; a token is
+	// accepted when its aud names at least one of them
+	Audience []string
+	// Leeway tolerates that much clock skew on exp, nbf and iat
+	Leeway time.Duration
+}
+
+var (
+	errTokenAudience = fmt.Errorf("%w: token is not for this audience", jwt.ErrTokenInvalidAudience)
+	errTokenSubject  = fmt.Errorf("%w: token has no user ID", jwt.ErrTokenInvalidSubject)
+)
+
 type JWTAuthenticator struct {
-	secret string
-	aud    string
-	iss    string
+	cfg TokenConfig
 }
 
-func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
-	return &JWTAuthenticator{secret, iss, aud}
+func NewJWTAuthenticator(cfg TokenConfig) *JWTAuthenticator {
+	return &JWTAuthenticator{cfg: cfg}
 }
 
 func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenString, err := token.SignedString([]byte(a.secret))
+	tokenString, err := token.SignedString([]byte(a.cfg.Secret))
 	if err != nil {
 		return "", err
 	}
@@ -27,17 +47,47 @@ func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 	return tokenString, nil
 }
 
+// ValidateToken checks the signature, requires exp, iss and sub, and
+// rejects tokens used before nbf or iat, allowing for the leeway.
 func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
 		}
 
-		return []byte(a.secret), nil
+		return []byte(a.cfg.Secret), nil
 	},
 		jwt.WithExpirationRequired(),
-		jwt.WithAudience(a.aud),
-		jwt.WithIssuer(a.aud),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(a.cfg.Issuer),
+		jwt.WithLeeway(a.cfg.Leeway),
 		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := parsed.Claims.(jwt.MapClaims)
+	if err := checkAudienceAndSubject(claims, a.cfg.Audience); err != nil {
+		return nil, err
+	}
+
+	return parsed, nil
+}
+
+// checkAudienceAndSubject requires aud to name one of audiences, which
+// jwt.WithAudience cannot express, and sub to be a user ID.
+func checkAudienceAndSubject(claims jwt.MapClaims, audiences []string) error {
+	aud, err := claims.GetAudience()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(audiences, func(want string) bool { return slices.Contains(aud, want) }) {
+		return errTokenAudience
+	}
+
+	if _, ok := claims["sub"].(float64); !ok {
+		return errTokenSubject
+	}
+	return nil
 }
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTValidation(t *testing.T) {
+	a := NewJWTAuthenticator(TokenConfig{
+		Secret:   "secret",
+		Issuer:   "real-estate",
+		Audience: []string{"api", "admin"},
+		Leeway:   30 * time.Second,
+	})
+	now := time.Now()
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub": 1,
+			"exp": now.Add(time.Hour).Unix(),
+			"iat": now.Unix(),
+			"nbf": now.Unix(),
+			"iss": "real-estate",
+			"aud": []string{"admin"},
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	validate := func(c jwt.MapClaims) error {
+		token, err := a.GenerateToken(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = a.ValidateToken(token)
+		return err
+	}
+
+	if err := validate(claims(nil)); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	// within the leeway
+	if err := validate(claims(func(c jwt.MapClaims) {
+		c["nbf"] = now.Add(20 * time.Second).Unix()
+		c["exp"] = now.Add(-20 * time.Second).Unix()
+	})); err != nil {
+		t.Errorf("clock skew: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(jwt.MapClaims)
+		want error
+	}{
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "web" }, jwt.ErrTokenInvalidAudience},
+		{"no audience", func(c jwt.MapClaims) { delete(c, "aud") }, jwt.ErrTokenInvalidAudience},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "elsewhere" }, jwt.ErrTokenInvalidIssuer},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() }, jwt.ErrTokenExpired},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, jwt.ErrTokenRequiredClaimMissing},
+		{"not yet valid", func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() }, jwt.ErrTokenNotValidYet},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = now.Add(time.Minute).Unix() }, jwt.ErrTokenUsedBeforeIssued},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, jwt.ErrTokenInvalidSubject},
+	}
+	for _, tt := range tests {
+		if err := validate(claims(tt.edit)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	other := NewJWTAuthenticator(TokenConfig{Secret: "other", Issuer: "real-estate", Audience: []string{"api"}})
+	token, _ := other.GenerateToken(claims(nil))
+	if _, err := a.ValidateToken(token); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("other secret: got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Test vector 4-E-1 of the PASETO specification.
+func TestPASETOVector(t *testing.T) {
+	key, _ := hex.DecodeString("707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f")
+	nonce := make([]byte, 32)
+	message := []byte(`{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`)
+	want := "v4.local.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAQAr68PS4AXe7If_ZgesdkUMvSwscFlAl1pk5HC0e8kApeaqMfGo_7OpBnwJOAbY9V7WU6abu74MmcUE8YWAiaArVI8XJ5hOb_4v9RmDkneN0S92dx0OW4pgy7omxgf3S8c3LlQg"
+
+	if got := pasetoEncrypt(key, nonce, message); got != want {
+		t.Fatalf("got %s", got)
+	}
+	got, err := pasetoDecrypt(key, want)
+	if err != nil || !bytes.Equal(got, message) {
+		t.Fatalf("got %s, %v", got, err)
+	}
+}
+
+func TestPASETOValidation(t *testing.T) {
+	cfg := TokenConfig{
+		Key:      bytes.Repeat([]byte{7}, 32),
+		Issuer:   "real-estate",
+		Audience: []string{"api"},
+		Leeway:   30 * time.Second,
+	}
+	a, err := NewPASETOAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":  int64(42),
+		"exp":  now.Add(time.Hour).Unix(),
+		"iat":  now.Unix(),
+		"iss":  "real-estate",
+		"aud":  []string{"api"},
+		"role": "admin",
+	}
+
+	token, err := a.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "v4.local.") || strings.Contains(token, "admin") {
+		t.Fatalf("token %s", token)
+	}
+	parsed, err := a.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := parsed.Claims.(jwt.MapClaims)
+	if got["sub"] != float64(42) || got["role"] != "admin" || got["exp"] != float64(now.Add(time.Hour).Unix()) {
+		t.Errorf("claims %v", got)
+	}
+
+	// the last character only carries padding bits, so change one earlier
+	// to another base64url character
+	tampered := []byte(token)
+	if tampered[len(tampered)-5] == 'A' {
+		tampered[len(tampered)-5] = 'B'
+	} else {
+		tampered[len(tampered)-5] = 'A'
+	}
+	if _, err := a.ValidateToken(string(tampered)); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("tampered: got %v", err)
+	}
+
+	otherKey := cfg
+	otherKey.Key = bytes.Repeat([]byte{8}, 32)
+	other, _ := NewPASETOAuthenticator(otherKey)
+	if _, err := other.ValidateToken(token); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("other key: got %v", err)
+	}
+
+	expired := jwt.MapClaims{"sub": 1, "exp": now.Add(-time.Minute).Unix(), "iss": "real-estate", "aud": "api"}
+	token, _ = a.GenerateToken(expired)
+	if _, err := a.ValidateToken(token); !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("expired: got %v", err)
+	}
+
+	// a JWT is not a PASETO token
+	jwtToken, _ := NewJWTAuthenticator(TokenConfig{Secret: "secret"}).GenerateToken(claims)
+	if _, err := a.ValidateToken(jwtToken); !errors.Is(err, jwt.ErrTokenMalformed) {
+		t.Errorf("jwt: got %v", err)
+	}
+
+	if _, err := NewPASETOAuthenticator(TokenConfig{Key: []byte("short")}); err == nil {
+		t.Error("accepted a short key")
+	}
+}
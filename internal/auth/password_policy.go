@@ -0,0 +1,105 @@
+package auth
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// Password rule identifiers returned by PasswordPolicy.Check. They double as
+// translation keys for validation messages.
+const (
+	PasswordRuleLength   = "password_length"
+	PasswordRuleLower    = "password_lower"
+	PasswordRuleUpper    = "password_upper"
+	PasswordRuleDigit    = "password_digit"
+	PasswordRuleSpecial  = "password_special"
+	PasswordRuleRepeated = "password_repeated"
+	PasswordRuleCommon   = "password_common"
+)
+
+type PasswordPolicy struct {
+	MinLength          int  `json:"min_length"`
+	RequireLowercase   bool `json:"require_lowercase"`
+	RequireUppercase   bool `json:"require_uppercase"`
+	RequireDigit       bool `json:"require_digit"`
+	RequireSpecial     bool `json:"require_special"`
+	MaxRepeatedChars   int  `json:"max_repeated_chars"` // 0 disables the check
+	BanCommonPasswords bool `json:"ban_common_passwords"`
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:          8,
+		RequireLowercase:   true,
+		RequireUppercase:   true,
+		RequireDigit:       true,
+		RequireSpecial:     true,
+		BanCommonPasswords: true,
+	}
+}
+
+// Check returns the first rule the password breaks, or "" if it satisfies the policy.
+func (p PasswordPolicy) Check(password string) string {
+	var hasLower, hasUpper, hasDigit, hasSpecial bool
+	var prev rune
+	run, longestRun := 0, 0
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSpecial = true
+		}
+
+		if r == prev {
+			run++
+		} else {
+			run = 1
+		}
+		prev = r
+		longestRun = max(longestRun, run)
+	}
+
+	switch {
+	case len([]rune(password)) < p.MinLength:
+		return PasswordRuleLength
+	case p.RequireLowercase && !hasLower:
+		return PasswordRuleLower
+	case p.RequireUppercase && !hasUpper:
+		return PasswordRuleUpper
+	case p.RequireDigit && !hasDigit:
+		return PasswordRuleDigit
+	case p.RequireSpecial && !hasSpecial:
+		return PasswordRuleSpecial
+	case p.MaxRepeatedChars > 0 && longestRun > p.MaxRepeatedChars:
+		return PasswordRuleRepeated
+	case p.BanCommonPasswords && isCommonPassword(password):
+		return PasswordRuleCommon
+	}
+
+	return ""
+}
+
+func isCommonPassword(password string) bool {
+	_, found := commonPasswords[strings.ToLower(password)]
+	return found
+}
@@ -0,0 +1,92 @@
+package botcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProofOfWork(t *testing.T) {
+	pow, err := NewProofOfWork([]byte("secret"), 8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	c, err := pow.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := Solve(c)
+	if err := pow.Verify(ctx, token, ""); err != nil {
+		t.Fatalf("solution rejected: %v", err)
+	}
+	if err := pow.Verify(ctx, token, ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("replayed solution: got %v", err)
+	}
+
+	other, _ := NewProofOfWork([]byte("other"), 8, time.Minute)
+	c, _ = other.NewChallenge()
+	if err := pow.Verify(ctx, Solve(c), ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("challenge signed with another key: got %v", err)
+	}
+
+	expired, _ := NewProofOfWork([]byte("secret"), 8, -time.Minute)
+	c, _ = expired.NewChallenge()
+	if err := pow.Verify(ctx, Solve(c), ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("expired challenge: got %v", err)
+	}
+
+	// raising the difficulty in the challenge breaks the signature
+	c, _ = pow.NewChallenge()
+	forged := strings.Replace(c.Challenge, ".8.", ".1.", 1)
+	for _, token := range []string{"", c.Challenge, c.Challenge + ":", forged + ":0"} {
+		if err := pow.Verify(ctx, token, ""); !errors.Is(err, ErrFailed) {
+			t.Errorf("%q: got %v", token, err)
+		}
+	}
+}
+
+func TestSiteVerifier(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("secret") != "s3cret" || r.Form.Get("remoteip") != "192.0.2.1" {
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-secret"]}`))
+			return
+		}
+		switch r.Form.Get("response") {
+		case "good":
+			w.Write([]byte(`{"success": true}`))
+		case "bot":
+			w.Write([]byte(`{"success": true, "score": 0.1}`))
+		default:
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	defer srv.Close()
+
+	v, err := NewSiteVerifier(ProviderTurnstile, "s3cret", 0.5, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.url = srv.URL
+	ctx := context.Background()
+
+	if err := v.Verify(ctx, "good", "192.0.2.1"); err != nil {
+		t.Errorf("good token: %v", err)
+	}
+	for _, token := range []string{"", "bad", "bot"} {
+		if err := v.Verify(ctx, token, "192.0.2.1"); !errors.Is(err, ErrFailed) {
+			t.Errorf("%q: got %v, want ErrFailed", token, err)
+		}
+	}
+
+	v.secret = "wrong"
+	if err := v.Verify(ctx, "good", "192.0.2.1"); err == nil || errors.Is(err, ErrFailed) {
+		t.Errorf("bad secret: got %v, want a configuration error", err)
+	}
+}
@@ -0,0 +1,143 @@
+package botcheck
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Challenge is a proof-of-work puzzle: find a nonce such that the SHA-256
+// hash of Challenge + ":" + nonce starts with Difficulty zero bits, and send
+// Challenge + ":" + nonce as the token.
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ProofOfWork hands out signed challenges and verifies their solutions.
+// Challenges carry their own expiry and difficulty, so any instance sharing
+// the secret can verify them; each works once per instance.
+type ProofOfWork struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewProofOfWork returns a ProofOfWork signing with secret, or with a
+// random key when secret is empty, which only works with a single instance.
+func NewProofOfWork(secret []byte, difficulty int, ttl time.Duration) (*ProofOfWork, error) {
+	if difficulty < 1 || difficulty > 32 {
+		return nil, fmt.Errorf("proof-of-work difficulty %d: want 1 to 32 bits", difficulty)
+	}
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &ProofOfWork{secret: secret, difficulty: difficulty, ttl: ttl, used: make(map[string]time.Time)}, nil
+}
+
+// NewChallenge returns a challenge valid for the configured ttl.
+func (p *ProofOfWork) NewChallenge() (*Challenge, error) {
+	salt := make([]byte, 12)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(p.ttl).Truncate(time.Second)
+	payload := fmt.Sprintf("%d.%d.%s", expiresAt.Unix(), p.difficulty, base64.RawURLEncoding.EncodeToString(salt))
+	return &Challenge{
+		Challenge:  payload + "." + p.sign(payload),
+		Difficulty: p.difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+func (p *ProofOfWork) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a "challenge:nonce" token. remoteIP is not used.
+func (p *ProofOfWork) Verify(ctx context.Context, token, remoteIP string) error {
+	challenge, nonce, ok := strings.Cut(token, ":")
+	if !ok || nonce == "" || len(nonce) > 64 {
+		return ErrFailed
+	}
+
+	dot := strings.LastIndex(challenge, ".")
+	if dot < 0 || !hmac.Equal([]byte(p.sign(challenge[:dot])), []byte(challenge[dot+1:])) {
+		return ErrFailed
+	}
+	fields := strings.Split(challenge[:dot], ".")
+	if len(fields) != 3 {
+		return ErrFailed
+	}
+	expiry, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return ErrFailed
+	}
+	difficulty, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ErrFailed
+	}
+	expiresAt := time.Unix(expiry, 0)
+	if time.Now().After(expiresAt) {
+		return ErrFailed
+	}
+
+	if leadingZeroBits(sha256.Sum256([]byte(token))) < difficulty {
+		return ErrFailed
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.used[challenge]; ok {
+		return ErrFailed
+	}
+	now := time.Now()
+	for c, exp := range p.used {
+		if now.After(exp) {
+			delete(p.used, c)
+		}
+	}
+	p.used[challenge] = expiresAt
+	return nil
+}
+
+// Solve finds a nonce for c and returns the token, as clients do in
+// JavaScript.
+func Solve(c *Challenge) string {
+	for n := 0; ; n++ {
+		token := c.Challenge + ":" + strconv.Itoa(n)
+		if leadingZeroBits(sha256.Sum256([]byte(token))) >= c.Difficulty {
+			return token
+		}
+	}
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
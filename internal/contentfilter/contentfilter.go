@@ -0,0 +1,70 @@
+// Package contentfilter screens user content for spam and abuse before it
+// is published: a built-in Heuristic filter and an optional external
+// moderation API, combined with Chain. Flagged content is held for
+// moderators; the filters only give the verdict.
+package contentfilter
+
+import (
+	"context"
+	"errors"
+)
+
+// Kinds of content.
+const (
+	KindListing = "listing"
+	KindMessage = "message"
+)
+
+// Reasons a filter flags content for.
+const (
+	ReasonTooManyLinks = "too_many_links"
+	ReasonBannedWord   = "banned_word"
+	ReasonDuplicate    = "duplicate"
+	// External filters report their own categories prefixed with this
+	ReasonExternalPrefix = "external:"
+)
+
+// Content is one listing or message to check.
+type Content struct {
+	Kind string
+	// AuthorID is the user who wrote it, so repeated posts can be spotted
+	AuthorID int64
+	Text     string
+}
+
+// Verdict is a filter's decision. Content with no reasons passes.
+type Verdict struct {
+	Reasons []string
+}
+
+func (v Verdict) Flagged() bool {
+	return len(v.Reasons) > 0
+}
+
+// Filter checks content. An error means the check could not be made; the
+// caller decides whether to publish anyway.
+type Filter interface {
+	Check(ctx context.Context, c Content) (Verdict, error)
+}
+
+type chain []Filter
+
+// Chain runs every filter and flags content any of them flags. Filters that
+// fail do not stop the others; their errors are joined.
+func Chain(filters ...Filter) Filter {
+	return chain(filters)
+}
+
+func (fs chain) Check(ctx context.Context, c Content) (Verdict, error) {
+	var verdict Verdict
+	var errs []error
+	for _, f := range fs {
+		v, err := f.Check(ctx, c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		verdict.Reasons = append(verdict.Reasons, v.Reasons...)
+	}
+	return verdict, errors.Join(errs...)
+}
@@ -0,0 +1,94 @@
+package contentfilter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeuristic(t *testing.T) {
+	h := NewHeuristic(HeuristicOptions{
+		MaxLinks:        2,
+		BannedWords:     []string{"Scam"},
+		DuplicateLimit:  2,
+		DuplicateWindow: time.Minute,
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Bright two-room flat near the park", nil},
+		{"See https://a.example, http://b.example and www.c.example", []string{ReasonTooManyLinks}},
+		{"Not a SCAM, promise!", []string{ReasonBannedWord}},
+		{"Scammers beware: this word is only a prefix", nil},
+	}
+	for _, tt := range tests {
+		v, err := h.Check(ctx, Content{Kind: KindListing, AuthorID: 1, Text: tt.text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(v.Reasons, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got %v, want %v", tt.text, v.Reasons, tt.want)
+		}
+	}
+
+	// the third copy within the window is flagged, for that author only
+	msg := Content{Kind: KindMessage, AuthorID: 2, Text: "Call me now for a special offer"}
+	for i, want := range []bool{false, false, true} {
+		v, _ := h.Check(ctx, Content{Kind: msg.Kind, AuthorID: msg.AuthorID, Text: strings.ToUpper(msg.Text)})
+		if v.Flagged() != want {
+			t.Errorf("copy %d: flagged %v", i+1, v.Flagged())
+		}
+	}
+	if v, _ := h.Check(ctx, Content{Kind: msg.Kind, AuthorID: 3, Text: msg.Text}); v.Flagged() {
+		t.Errorf("another author was flagged: %v", v.Reasons)
+	}
+	if h.isDuplicate(msg, time.Now().Add(2*time.Minute)) {
+		t.Error("copies outside the window still count")
+	}
+}
+
+func TestChainWithAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer k3y" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body struct{ Kind, Text string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if strings.Contains(body.Text, "idiot") {
+			w.Write([]byte(`{"flagged": true, "categories": ["harassment"]}`))
+			return
+		}
+		w.Write([]byte(`{"flagged": false}`))
+	}))
+	defer srv.Close()
+
+	api, err := NewAPI(srv.URL, "k3y", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := Chain(NewHeuristic(HeuristicOptions{BannedWords: []string{"scam"}}), api)
+	ctx := context.Background()
+
+	v, err := f.Check(ctx, Content{Kind: KindMessage, Text: "what a scam, idiot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(v.Reasons, ","); got != "banned_word,external:harassment" {
+		t.Errorf("reasons %s", got)
+	}
+
+	// a failing API does not hide what the other filters found
+	broken, _ := NewAPI(srv.URL, "wrong", time.Second)
+	v, err = Chain(NewHeuristic(HeuristicOptions{BannedWords: []string{"scam"}}), broken).Check(ctx, Content{Text: "scam"})
+	if err == nil || !v.Flagged() {
+		t.Errorf("got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,81 @@
+package contentfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// API asks an external moderation service about content. It POSTs
+//
+//	{"kind": "listing", "text": "..."}
+//
+// with the key as a bearer token and expects
+//
+//	{"flagged": true, "categories": ["spam"]}
+//
+// back. Each category becomes a reason prefixed with ReasonExternalPrefix.
+type API struct {
+	client *http.Client
+	url    string
+	key    string
+}
+
+func NewAPI(url, key string, timeout time.Duration) (*API, error) {
+	if url == "" {
+		return nil, fmt.Errorf("moderation API needs a URL")
+	}
+	return &API{client: &http.Client{Timeout: timeout}, url: url, key: key}, nil
+}
+
+func (a *API) Check(ctx context.Context, c Content) (Verdict, error) {
+	body, err := json.Marshal(struct {
+		Kind string `json:"kind"`
+		Text string `json:"text"`
+	}{c.Kind, c.Text})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.key != "" {
+		req.Header.Set("Authorization", "Bearer "+a.key)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("moderation API: unexpected status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Flagged    bool     `json:"flagged"`
+		Categories []string `json:"categories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("moderation API: %w", err)
+	}
+
+	var v Verdict
+	if !result.Flagged {
+		return v, nil
+	}
+	for _, category := range result.Categories {
+		v.Reasons = append(v.Reasons, ReasonExternalPrefix+category)
+	}
+	if len(v.Reasons) == 0 {
+		v.Reasons = []string{ReasonExternalPrefix + "flagged"}
+	}
+	return v, nil
+}
@@ -0,0 +1,123 @@
+package contentfilter
+
+import (
+	"context"
+	"crypto/sha256"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minDuplicateLength keeps short replies like "ok, thanks" out of duplicate
+// detection.
+const minDuplicateLength = 20
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+type HeuristicOptions struct {
+	// MaxLinks flags content with more links; 0 allows any number
+	MaxLinks int
+	// BannedWords flags content containing any of them as a whole word,
+	// ignoring case
+	BannedWords []string
+	// DuplicateLimit is how many times an author may post the same text
+	// within DuplicateWindow before it is flagged; 0 turns detection off
+	DuplicateLimit  int
+	DuplicateWindow time.Duration
+}
+
+// Heuristic is the built-in filter. Duplicates are remembered in memory, so
+// with several instances each counts the posts it received.
+type Heuristic struct {
+	opts   HeuristicOptions
+	banned map[string]bool
+
+	mu     sync.Mutex
+	recent map[int64][]post
+}
+
+type post struct {
+	hash [sha256.Size]byte
+	at   time.Time
+}
+
+func NewHeuristic(opts HeuristicOptions) *Heuristic {
+	banned := make(map[string]bool)
+	for _, w := range opts.BannedWords {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			banned[w] = true
+		}
+	}
+	return &Heuristic{opts: opts, banned: banned, recent: make(map[int64][]post)}
+}
+
+func (h *Heuristic) Check(ctx context.Context, c Content) (Verdict, error) {
+	var v Verdict
+	if h.opts.MaxLinks > 0 && len(linkPattern.FindAllStringIndex(c.Text, -1)) > h.opts.MaxLinks {
+		v.Reasons = append(v.Reasons, ReasonTooManyLinks)
+	}
+	if h.hasBannedWord(c.Text) {
+		v.Reasons = append(v.Reasons, ReasonBannedWord)
+	}
+	if h.isDuplicate(c, time.Now()) {
+		v.Reasons = append(v.Reasons, ReasonDuplicate)
+	}
+	return v, nil
+}
+
+func (h *Heuristic) hasBannedWord(text string) bool {
+	if len(h.banned) == 0 {
+		return false
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, w := range words {
+		if h.banned[w] {
+			return true
+		}
+	}
+	return false
+}
+
+// isDuplicate records the post and reports whether the author already made
+// DuplicateLimit identical ones within the window. Case and whitespace do
+// not make posts different.
+func (h *Heuristic) isDuplicate(c Content, now time.Time) bool {
+	text := strings.Join(strings.Fields(strings.ToLower(c.Text)), " ")
+	if h.opts.DuplicateLimit <= 0 || c.AuthorID == 0 || utf8.RuneCountInString(text) < minDuplicateLength {
+		return false
+	}
+	hash := sha256.Sum256([]byte(c.Kind + "\x00" + text))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// forget posts that left the window, everyone's, so the map stays small
+	cutoff := now.Add(-h.opts.DuplicateWindow)
+	for author, posts := range h.recent {
+		kept := posts[:0]
+		for _, p := range posts {
+			if p.at.After(cutoff) {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h.recent, author)
+		} else {
+			h.recent[author] = kept
+		}
+	}
+
+	seen := 0
+	for _, p := range h.recent[c.AuthorID] {
+		if p.hash == hash {
+			seen++
+		}
+	}
+	h.recent[c.AuthorID] = append(h.recent[c.AuthorID], post{hash: hash, at: now})
+	return seen >= h.opts.DuplicateLimit
+}
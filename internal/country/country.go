@@ -0,0 +1,80 @@
+// Package country resolves the countries users type, either ISO 3166-1
+// alpha-2 codes or English names, against an embedded ISO 3166-1 list.
+package country
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// Country is an ISO 3166-1 country with its short English name.
+type Country struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+//go:embed countries.txt
+var countryList string
+
+var countries, byKey = func() ([]Country, map[string]string) {
+	var list []Country
+	keys := map[string]string{}
+	for _, line := range strings.Split(countryList, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		code := fields[0]
+		list = append(list, Country{Code: code, Name: fields[1]})
+		keys[code] = code
+		for _, name := range fields[1:] {
+			keys[key(name)] = code
+		}
+	}
+	return list, keys
+}()
+
+// key folds s so lookups ignore case and surrounding space. Codes stay two
+// letters, which no name is.
+func key(s string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(s), " "))
+}
+
+// All returns the countries ordered by code.
+func All() []Country {
+	return append([]Country(nil), countries...)
+}
+
+// Normalize returns the alpha-2 code of s, which may be a code or a name
+// in any case, and whether s names a country at all.
+func Normalize(s string) (string, bool) {
+	code, ok := byKey[key(s)]
+	return code, ok
+}
+
+// Valid reports whether code is an upper-case ISO 3166-1 alpha-2 code.
+func Valid(code string) bool {
+	normalized, ok := byKey[code]
+	return ok && normalized == code
+}
+
+//go:embed timezones.txt
+var timezoneList string
+
+var timezones = func() map[string]string {
+	zones := map[string]string{}
+	for _, line := range strings.Split(timezoneList, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		zones[fields[0]] = fields[1]
+	}
+	return zones
+}()
+
+// Timezone returns the default IANA timezone of the country code, "" for
+// unknown codes and the few uninhabited territories without one.
+func Timezone(code string) string {
+	return timezones[code]
+}
@@ -0,0 +1,90 @@
+package country
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{in: "KZ", want: "KZ"},
+		{in: " kz ", want: "KZ"},
+		{in: "Kazakhstan", want: "KZ"},
+		{in: "united  kingdom", want: "GB"},
+		{in: "UK", want: "GB"},
+		{in: "United States of America", want: "US"},
+		{in: "Côte d'Ivoire", want: "CI"},
+		{in: "Ivory Coast", want: "CI"},
+	}
+	for _, tt := range tests {
+		if got, ok := Normalize(tt.in); !ok || got != tt.want {
+			t.Errorf("Normalize(%q): got %q, %v, want %q", tt.in, got, ok, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "XX", "T1", "Narnia", "K"} {
+		if got, ok := Normalize(in); ok {
+			t.Errorf("Normalize(%q): got %q, want no country", in, got)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	if !Valid("KZ") || Valid("kz") || Valid("UK") || Valid("Kazakhstan") {
+		t.Error("Valid accepts only upper-case alpha-2 codes")
+	}
+}
+
+func TestList(t *testing.T) {
+	all := All()
+	if len(all) != 249 {
+		t.Errorf("got %d countries, want 249", len(all))
+	}
+
+	// every name and alias resolves to its own country
+	seen := map[string]string{}
+	for _, line := range strings.Split(countryList, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || len(fields[0]) != 2 || fields[0] != strings.ToUpper(fields[0]) {
+			t.Errorf("malformed line %q", line)
+			continue
+		}
+		for _, name := range fields {
+			if code, ok := seen[key(name)]; ok && code != fields[0] {
+				t.Errorf("%q names both %s and %s", name, code, fields[0])
+			}
+			seen[key(name)] = fields[0]
+		}
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Code >= all[i].Code {
+			t.Errorf("%s is listed before %s", all[i-1].Code, all[i].Code)
+		}
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	if got := Timezone("KZ"); got != "Asia/Almaty" {
+		t.Errorf("Timezone(KZ) = %q", got)
+	}
+	if got := Timezone("XX"); got != "" {
+		t.Errorf("Timezone(XX) = %q, want none", got)
+	}
+
+	for code, zone := range timezones {
+		if !Valid(code) {
+			t.Errorf("timezone for unknown country %q", code)
+		}
+		if _, err := time.LoadLocation(zone); err != nil {
+			t.Errorf("%s: %v", code, err)
+		}
+	}
+	if len(timezones) < len(countries)-2 {
+		t.Errorf("got %d timezones for %d countries", len(timezones), len(countries))
+	}
+}
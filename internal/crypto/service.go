@@ -21,6 +21,17 @@ type Service struct {
 }
 
 func NewServiceFromBase64Key(key string) (*Service, error) {
+	aead, err := NewAEADFromBase64Key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{aead: aead}, nil
+}
+
+// NewAEADFromBase64Key returns AES-256-GCM with a base64-encoded 32-byte
+// key, for data that is not a single string such as backups.
+func NewAEADFromBase64Key(key string) (cipher.AEAD, error) {
 	raw, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
 		return nil, ErrInvalidKey
@@ -34,12 +45,7 @@ func NewServiceFromBase64Key(key string) (*Service, error) {
 		return nil, err
 	}
 
-	aead, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	return &Service{aead: aead}, nil
+	return cipher.NewGCM(block)
 }
 
 func (s *Service) EncryptString(value string) (string, error) {
@@ -95,3 +101,19 @@ func HashEmail(email string) string {
 	hash := sha256.Sum256([]byte(normalized))
 	return hex.EncodeToString(hash[:])
 }
+
+// HashPhone returns a lookup hash of the digits of phone, so the same number
+// matches however it is formatted. It returns "" if phone has no digits.
+func HashPhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if digits == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(digits))
+	return hex.EncodeToString(hash[:])
+}
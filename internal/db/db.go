@@ -5,14 +5,15 @@ import (
 	"database/sql"
 	"time"
 
-	_ "github.com/lib/pq" // Postgres driver
+	"github.com/lib/pq"
 )
 
-func New(addr string, maxOpenConns, maxIdleConns int, maxIdleTime string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", addr)
+func New(addr string, maxOpenConns, maxIdleConns int, maxIdleTime, maxLifetime string) (*sql.DB, error) {
+	connector, err := pq.NewConnector(addr)
 	if err != nil {
 		return nil, err
 	}
+	db := sql.OpenDB(tracedConnector{connector})
 
 	db.SetMaxOpenConns(maxOpenConns)
 	db.SetMaxIdleConns(maxIdleConns)
@@ -23,6 +24,12 @@ func New(addr string, maxOpenConns, maxIdleConns int, maxIdleTime string) (*sql.
 	}
 	db.SetConnMaxIdleTime(duration)
 
+	lifetime, err := time.ParseDuration(maxLifetime)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxLifetime(lifetime)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
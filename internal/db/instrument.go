@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Query describes one statement sent to Postgres.
+type Query struct {
+	// Operation is the function that ran the statement, without its
+	// package, e.g. ListingStore.List.
+	Operation string
+	Statement string
+	// Args are the raw arguments; observers must redact them before they
+	// are logged.
+	Args     []any
+	Duration time.Duration
+	Err      error
+}
+
+// Repository is the type of Operation, e.g. ListingStore, or the package
+// for plain functions, e.g. main.
+func (q Query) Repository() string {
+	repo, _, _ := strings.Cut(q.Operation, ".")
+	return repo
+}
+
+// Observer receives every statement once it returned. It runs on the
+// query's goroutine and must be fast.
+type Observer func(ctx context.Context, q Query)
+
+var observer atomic.Pointer[Observer]
+
+// SetObserver installs fn for all connections opened by New; nil removes
+// it.
+func SetObserver(fn Observer) {
+	if fn == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&fn)
+}
+
+// observe times a statement for the installed observer. The returned
+// function is called with the statement's error.
+func observe(ctx context.Context, query string, args []driver.NamedValue) func(error) {
+	fn := observer.Load()
+	if fn == nil {
+		return func(error) {}
+	}
+
+	start := time.Now()
+	operation := caller()
+	return func(err error) {
+		values := make([]any, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		(*fn)(ctx, Query{
+			Operation: operation,
+			Statement: strings.Join(strings.Fields(query), " "),
+			Args:      values,
+			Duration:  time.Since(start),
+			Err:       err,
+		})
+	}
+}
+
+// operations caches caller names by program counter.
+var operations sync.Map
+
+// caller names the first function above database/sql and this package.
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	for _, pc := range pcs[:n] {
+		if name, ok := operations.Load(pc); ok {
+			if name == "" {
+				continue
+			}
+			return name.(string)
+		}
+
+		var name string
+		if fn := runtime.FuncForPC(pc - 1); fn != nil {
+			name = operationName(fn.Name())
+		}
+		operations.Store(pc, name)
+		if name != "" {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// operationName turns github.com/x/internal/store.(*ListingStore).Create.func1
+// into ListingStore.Create and main.checkSchemaVersion into itself. Frames
+// of database/sql, this package and the runtime give "".
+func operationName(name string) string {
+	if strings.HasPrefix(name, "database/sql.") || strings.HasPrefix(name, "runtime.") || strings.Contains(name, "/internal/db.") {
+		return ""
+	}
+
+	name = name[strings.LastIndex(name, "/")+1:]
+	if _, method, ok := strings.Cut(name, ".("); ok {
+		name = strings.NewReplacer("*", "", ")", "").Replace(method)
+	}
+	// closures, e.g. the body of a transaction, count for their function
+	for {
+		i := strings.LastIndex(name, ".func")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return name
+}
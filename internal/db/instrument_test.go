@@ -0,0 +1,20 @@
+package db
+
+import "testing"
+
+func TestOperationName(t *testing.T) {
+	tests := map[string]string{
+		"github.com/x/internal/store.(*ListingStore).Create.func1": "ListingStore.Create",
+		"github.com/x/internal/store.(*UserStore).GetByID":         "UserStore.GetByID",
+		"github.com/x/internal/store.(*UserStore).create.func2.1":  "UserStore.create",
+		"main.checkSchemaVersion":                                  "main.checkSchemaVersion",
+		"database/sql.(*DB).QueryContext":                          "",
+		"github.com/x/internal/db.(*tracedConn).QueryContext":      "",
+		"runtime.goexit": "",
+	}
+	for name, want := range tests {
+		if got := operationName(name); got != want {
+			t.Errorf("operationName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
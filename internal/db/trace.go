@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+)
+
+// tracedConnector wraps the Postgres connector so that statements run with
+// a traced context get a client span and are timed for the Observer. Spans
+// are only recorded while a tracer is installed, so the wrapper costs next
+// to nothing otherwise.
+type tracedConnector struct {
+	driver.Connector
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+// tracedConn forwards the optional driver interfaces lib/pq implements.
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	done := observe(ctx, query, args)
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	rows, err := queryer.QueryContext(ctx, query, args)
+	span.RecordError(err)
+	done(err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	done := observe(ctx, query, args)
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	res, err := execer.ExecContext(ctx, query, args)
+	span.RecordError(err)
+	done(err)
+	return res, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// startQuerySpan names the span after the statement's first keyword, e.g.
+// SELECT. The statement is recorded with its placeholders, never the
+// arguments.
+func startQuerySpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(statement, " ")
+	return tracing.StartChild(ctx, strings.ToUpper(operation), tracing.KindClient,
+		tracing.String("db.system", "postgresql"),
+		tracing.String("db.statement", statement),
+	)
+}
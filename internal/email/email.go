@@ -0,0 +1,206 @@
+// Package email normalizes the addresses users sign up with and rejects
+// those that cannot receive mail or belong to disposable-mail services.
+package email
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalid      = errors.New("invalid email address")
+	ErrDisposable   = errors.New("disposable email addresses are not allowed")
+	ErrNoMailServer = errors.New("email domain does not accept mail")
+)
+
+//go:embed disposable_domains.txt
+var disposableDomainList string
+
+var disposableDomains = func() map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, line := range strings.Split(disposableDomainList, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// Normalize trims address, converts an internationalized domain to its
+// ASCII (punycode) form and lowercases the domain. The local part keeps its
+// case, as mail servers may treat it case-sensitively.
+func Normalize(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 {
+		return "", ErrInvalid
+	}
+	local, domain := address[:at], strings.TrimSuffix(address[at+1:], ".")
+
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || domain == "" {
+		return "", ErrInvalid
+	}
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+// Resolver is the part of net.Resolver the MX check uses.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type Options struct {
+	// StripPlusTags drops +tags, so jo+shop@example.com and jo@example.com
+	// are the same account.
+	StripPlusTags bool
+	// BlockDisposable rejects domains on the embedded disposable list and
+	// their subdomains.
+	BlockDisposable bool
+	// CheckMX rejects domains without MX, A or AAAA records.
+	CheckMX bool
+	// MXCacheTTL is how long lookup results are reused.
+	MXCacheTTL time.Duration
+	// Resolver defaults to net.DefaultResolver.
+	Resolver Resolver
+}
+
+// Service applies Options to addresses; it is safe for concurrent use.
+type Service struct {
+	opts Options
+
+	mu sync.Mutex
+	mx map[string]mxResult
+}
+
+// maxCachedDomains bounds the MX cache; registrations from many distinct
+// domains evict expired entries first and then start over.
+const maxCachedDomains = 10_000
+
+type mxResult struct {
+	accepts bool
+	expires time.Time
+}
+
+func NewService(opts Options) *Service {
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	return &Service{opts: opts, mx: make(map[string]mxResult)}
+}
+
+// Normalize is the package Normalize plus the plus-tag option.
+func (s *Service) Normalize(address string) (string, error) {
+	address, err := Normalize(address)
+	if err != nil {
+		return "", err
+	}
+	if !s.opts.StripPlusTags {
+		return address, nil
+	}
+
+	at := strings.LastIndex(address, "@")
+	local, _, _ := strings.Cut(address[:at], "+")
+	if local == "" {
+		return "", ErrInvalid
+	}
+	return local + address[at:], nil
+}
+
+// Check normalizes address and applies the disposable and MX checks. DNS
+// failures other than a missing domain let the address through, so an
+// unreachable resolver does not stop registrations.
+func (s *Service) Check(ctx context.Context, address string) (string, error) {
+	address, err := s.Normalize(address)
+	if err != nil {
+		return "", err
+	}
+	domain := address[strings.LastIndex(address, "@")+1:]
+
+	if s.opts.BlockDisposable && isDisposable(domain) {
+		return "", ErrDisposable
+	}
+	if s.opts.CheckMX && !s.acceptsMail(ctx, domain) {
+		return "", ErrNoMailServer
+	}
+	return address, nil
+}
+
+// isDisposable reports whether domain or one of its parents is listed.
+func isDisposable(domain string) bool {
+	for {
+		if _, ok := disposableDomains[domain]; ok {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
+
+func (s *Service) acceptsMail(ctx context.Context, domain string) bool {
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.mx[domain]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.accepts
+	}
+
+	accepts, err := s.lookup(ctx, domain)
+	if err != nil {
+		// temporary failure: allow, and ask again next time
+		return true
+	}
+
+	s.mu.Lock()
+	if len(s.mx) >= maxCachedDomains {
+		for d, r := range s.mx {
+			if now.After(r.expires) {
+				delete(s.mx, d)
+			}
+		}
+		if len(s.mx) >= maxCachedDomains {
+			s.mx = make(map[string]mxResult)
+		}
+	}
+	s.mx[domain] = mxResult{accepts: accepts, expires: now.Add(s.opts.MXCacheTTL)}
+	s.mu.Unlock()
+	return accepts
+}
+
+// lookup follows RFC 5321: mail goes to the MX hosts, or to the domain's
+// own address when it has none. A single "." MX is a null MX (RFC 7505),
+// declaring the domain takes no mail.
+func (s *Service) lookup(ctx context.Context, domain string) (bool, error) {
+	records, err := s.opts.Resolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		return !(len(records) == 1 && records[0].Host == "."), nil
+	}
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+
+	hosts, err := s.opts.Resolver.LookupHost(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(hosts) > 0, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,113 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+		strip    bool
+	}{
+		{in: "  Jo.Doe@Example.COM ", want: "Jo.Doe@example.com"},
+		{in: "jo@example.com.", want: "jo@example.com"},
+		{in: "jo@bücher.de", want: "jo@xn--bcher-kva.de"},
+		{in: "jo+shop@example.com", want: "jo+shop@example.com"},
+		{in: "jo+shop+x@example.com", want: "jo@example.com", strip: true},
+	}
+	for _, tt := range tests {
+		got, err := NewService(Options{StripPlusTags: tt.strip}).Normalize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%q): got %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "jo", "@example.com", "jo@", "jo@exa mple.com"} {
+		if _, err := Normalize(in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Normalize(%q): expected ErrInvalid, got %v", in, err)
+		}
+	}
+	if _, err := NewService(Options{StripPlusTags: true}).Normalize("+tag@example.com"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for an empty local part, got %v", err)
+	}
+}
+
+func TestCheckDisposable(t *testing.T) {
+	s := NewService(Options{BlockDisposable: true})
+	for _, address := range []string{"jo@mailinator.com", "jo@eu.Mailinator.com"} {
+		if _, err := s.Check(context.Background(), address); !errors.Is(err, ErrDisposable) {
+			t.Errorf("%s: expected ErrDisposable, got %v", address, err)
+		}
+	}
+	if _, err := s.Check(context.Background(), "jo@example.com"); err != nil {
+		t.Errorf("example.com rejected: %v", err)
+	}
+}
+
+type fakeResolver struct {
+	mx      map[string][]*net.MX
+	hosts   map[string][]string
+	failing bool
+	lookups int
+}
+
+func (r *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	r.lookups++
+	if r.failing {
+		return nil, &net.DNSError{Err: "timeout", Name: name, IsTimeout: true}
+	}
+	if mx, ok := r.mx[name]; ok {
+		return mx, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if hosts, ok := r.hosts[host]; ok {
+		return hosts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestCheckMX(t *testing.T) {
+	resolver := &fakeResolver{
+		mx: map[string][]*net.MX{
+			"example.com": {{Host: "mx.example.com.", Pref: 10}},
+			"null.test":   {{Host: ".", Pref: 0}},
+		},
+		hosts: map[string][]string{"a-only.test": {"192.0.2.1"}},
+	}
+	s := NewService(Options{CheckMX: true, MXCacheTTL: time.Hour, Resolver: resolver})
+	ctx := context.Background()
+
+	tests := map[string]error{
+		"jo@example.com":  nil,
+		"jo@a-only.test":  nil,
+		"jo@null.test":    ErrNoMailServer,
+		"jo@nowhere.test": ErrNoMailServer,
+	}
+	for address, want := range tests {
+		if _, err := s.Check(ctx, address); !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %v", address, err, want)
+		}
+	}
+
+	lookups := resolver.lookups
+	s.Check(ctx, "other@nowhere.test")
+	if resolver.lookups != lookups {
+		t.Error("expected the negative result to be cached")
+	}
+
+	// resolver outages let addresses through and are not cached
+	resolver.failing = true
+	if _, err := s.Check(ctx, "jo@new.test"); err != nil {
+		t.Errorf("expected a DNS failure to allow the address, got %v", err)
+	}
+	if _, ok := s.mx["new.test"]; ok {
+		t.Error("temporary failure was cached")
+	}
+}
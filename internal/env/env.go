@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 func GetString(key, fallback string) string {
@@ -41,3 +42,31 @@ func GetBool(key string, fallback bool) bool {
 
 	return boolVal
 }
+
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		return fallback
+	}
+
+	return duration
+}
+
+func GetFloat(key string, fallback float64) float64 {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	floatVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return fallback
+	}
+
+	return floatVal
+}
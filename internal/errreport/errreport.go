@@ -0,0 +1,128 @@
+// Package errreport sends server errors, with their stack trace and the
+// request they happened in, to an error tracker such as Sentry.
+package errreport
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Frame is one call in a stack trace.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// Event is one server error. Stack is innermost call first.
+type Event struct {
+	// ID is the error_id returned to the client, so support can find the
+	// event from a user's report.
+	ID      string
+	Time    time.Time
+	Message string
+	Stack   []Frame
+	// Panic is set for recovered panics, as opposed to returned errors.
+	Panic bool
+
+	Method    string
+	Path      string
+	Route     string
+	RequestID string
+	TraceID   string
+	UserAgent string
+	// UserID is 0 for anonymous requests.
+	UserID int64
+}
+
+// Reporter delivers events to one error tracker.
+type Reporter interface {
+	Report(ctx context.Context, e Event) error
+}
+
+// ReporterFunc adapts a function to the Reporter interface.
+type ReporterFunc func(ctx context.Context, e Event) error
+
+func (f ReporterFunc) Report(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// Stack returns the caller's stack, skipping skip frames above the caller
+// of Stack.
+func Stack(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	return frames(pcs[:n])
+}
+
+// PanicStack returns the stack of the goroutine's current panic when called
+// from a deferred function, starting at the call that panicked.
+func PanicStack() []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(1, pcs)
+	stack := frames(pcs[:n])
+	for i, f := range stack {
+		if f.Function == "runtime.gopanic" {
+			return stack[i+1:]
+		}
+	}
+	return stack
+}
+
+func frames(pcs []uintptr) []Frame {
+	var stack []Frame
+	it := runtime.CallersFrames(pcs)
+	for {
+		f, more := it.Next()
+		if !strings.HasPrefix(f.Function, "runtime.goexit") {
+			stack = append(stack, Frame{Function: f.Function, File: f.File, Line: f.Line})
+		}
+		if !more {
+			return stack
+		}
+	}
+}
+
+const queueSize = 100
+
+type asyncReporter struct {
+	reporter Reporter
+	events   chan Event
+	timeout  time.Duration
+	onError  func(error)
+}
+
+// Async returns a Reporter that hands events to r in the background, so a
+// slow tracker never delays the response. Events beyond a small queue are
+// dropped. onError, if not nil, receives delivery failures.
+func Async(r Reporter, timeout time.Duration, onError func(error)) Reporter {
+	a := &asyncReporter{
+		reporter: r,
+		events:   make(chan Event, queueSize),
+		timeout:  timeout,
+		onError:  onError,
+	}
+	go a.run()
+	return a
+}
+
+func (a *asyncReporter) Report(_ context.Context, e Event) error {
+	select {
+	case a.events <- e:
+	default:
+	}
+	return nil
+}
+
+func (a *asyncReporter) run() {
+	for e := range a.events {
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+		err := a.reporter.Report(ctx, e)
+		cancel()
+		if err != nil && a.onError != nil {
+			a.onError(err)
+		}
+	}
+}
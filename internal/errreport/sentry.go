@@ -0,0 +1,140 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentry posts events to a Sentry project through its envelope endpoint,
+// which self-hosted Sentry and compatible trackers such as GlitchTip accept
+// too.
+type Sentry struct {
+	client      *http.Client
+	url         string
+	key         string
+	environment string
+	release     string
+	// modulePrefix marks frames of this module as in-app.
+	modulePrefix string
+}
+
+// NewSentry parses dsn, e.g. https://<key>@o1.ingest.sentry.io/<project>.
+func NewSentry(dsn, environment, release string, timeout time.Duration) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("errreport: invalid sentry DSN")
+	}
+	prefix, project := "", strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("errreport: sentry DSN has no project")
+	}
+
+	return &Sentry{
+		client:       &http.Client{Timeout: timeout},
+		url:          fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		key:          u.User.Username(),
+		environment:  environment,
+		release:      release,
+		modulePrefix: "github.com/Lelouchlamperougexd/Valar_Morghulis/",
+	}, nil
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+func (s *Sentry) Report(ctx context.Context, e Event) error {
+	eventID := newEventID()
+
+	// Sentry lists frames outermost first.
+	frames := make([]sentryFrame, len(e.Stack))
+	for i, f := range e.Stack {
+		frames[len(e.Stack)-1-i] = sentryFrame{
+			Function: f.Function,
+			Filename: f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(f.Function, s.modulePrefix),
+		}
+	}
+
+	kind := "error"
+	if e.Panic {
+		kind = "panic"
+	}
+	tags := map[string]string{"error_id": e.ID}
+	for key, value := range map[string]string{"request_id": e.RequestID, "route": e.Route, "trace_id": e.TraceID} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+
+	event := map[string]any{
+		"event_id":    eventID,
+		"timestamp":   e.Time.UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       "error",
+		"environment": s.environment,
+		"release":     s.release,
+		"exception": map[string]any{"values": []map[string]any{{
+			"type":       kind,
+			"value":      e.Message,
+			"stacktrace": map[string]any{"frames": frames},
+		}}},
+		"request": map[string]any{
+			"method":  e.Method,
+			"url":     e.Path,
+			"headers": map[string]string{"User-Agent": e.UserAgent},
+		},
+		"tags": tags,
+	}
+	if e.UserID != 0 {
+		event["user"] = map[string]string{"id": strconv.FormatInt(e.UserID, 10)}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", eventID, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=real-estate-api/1.0, sentry_key="+s.key)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry: %s", resp.Status)
+	}
+	return nil
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
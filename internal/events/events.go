@@ -0,0 +1,89 @@
+// Package events carries domain events from the API to the code that reacts
+// to them: in-process handlers such as webhooks, and other services through
+// a NATS publisher.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Event types. Listings are this API's posts.
+const (
+	UserRegistered            = "user.registered"
+	ListingCreated            = "listing.created"
+	ListingPublished          = "listing.published"
+	ListingUpdated            = "listing.updated"
+	ListingDeleted            = "listing.deleted"
+	ApplicationMessageCreated = "application_message.created"
+	EmailSent                 = "email.sent"
+)
+
+// All subscribes a handler to every event type.
+const All = "*"
+
+// Event is something that happened in the API.
+type Event struct {
+	// ID is random and lets consumers drop duplicates.
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// CompanyID is the company the event is about, nil when there is none.
+	CompanyID *int64 `json:"company_id,omitempty"`
+	Data      any    `json:"data"`
+}
+
+// New returns an event of eventType that happened now.
+func New(eventType string, companyID *int64, data any) Event {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Event{
+		ID:         hex.EncodeToString(id),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		CompanyID:  companyID,
+		Data:       data,
+	}
+}
+
+// Handler reacts to an event.
+type Handler func(ctx context.Context, e Event) error
+
+// Bus dispatches events in process. Handlers run synchronously in Publish,
+// in the order they subscribed, so slow consumers should queue the event
+// and return, as NATSPublisher does.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe calls h for every event of eventType, or every event for All.
+func (b *Bus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+// Publish hands e to its handlers. Every handler runs even when an earlier
+// one fails; the failures are returned joined.
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler{}, b.handlers[e.Type]...), b.handlers[All]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, h := range handlers {
+		if err := h(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
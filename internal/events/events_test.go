@@ -0,0 +1,123 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	var got []string
+	bus.Subscribe(UserRegistered, func(_ context.Context, e Event) error {
+		got = append(got, "user:"+e.Type)
+		return errors.New("webhook down")
+	})
+	bus.Subscribe(All, func(_ context.Context, e Event) error {
+		got = append(got, "all:"+e.Type)
+		return nil
+	})
+
+	if err := bus.Publish(context.Background(), New(UserRegistered, nil, nil)); err == nil {
+		t.Error("handler error was not returned")
+	}
+	if err := bus.Publish(context.Background(), New(ListingCreated, nil, nil)); err != nil {
+		t.Error(err)
+	}
+
+	want := "user:user.registered all:user.registered all:listing.created"
+	if strings.Join(got, " ") != want {
+		t.Errorf("handlers ran as %v, want %s", got, want)
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	type published struct {
+		subject string
+		connect map[string]any
+		event   Event
+	}
+	got := make(chan published, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, `INFO {"server_id":"test","max_payload":1048576}`+"\r\n")
+
+		var p published
+		line, _ := r.ReadString('\n')
+		json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &p.connect)
+		if line, _ = r.ReadString('\n'); strings.TrimSpace(line) == "PING" {
+			io.WriteString(conn, "PONG\r\n")
+		}
+
+		line, _ = r.ReadString('\n')
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "PUB" {
+			t.Errorf("got %q, want PUB", line)
+			return
+		}
+		size, _ := strconv.Atoi(fields[2])
+		body := make([]byte, size+2)
+		io.ReadFull(r, body)
+		p.subject = fields[1]
+		json.Unmarshal(body[:size], &p.event)
+		got <- p
+	}()
+
+	pub, err := NewNATSPublisher(NATSConfig{URL: "nats://app:secret@" + ln.Addr().String(), Subject: "valar", Name: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.OnError = func(err error) { t.Error(err) }
+
+	companyID := int64(7)
+	if err := pub.Handle(context.Background(), New(ListingCreated, &companyID, map[string]int{"id": 3})); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case p := <-got:
+		if p.subject != "valar.listing.created" {
+			t.Errorf("subject %q", p.subject)
+		}
+		if p.connect["user"] != "app" || p.connect["pass"] != "secret" || p.connect["name"] != "api" {
+			t.Errorf("CONNECT %v", p.connect)
+		}
+		if p.event.Type != ListingCreated || p.event.ID == "" || p.event.CompanyID == nil || *p.event.CompanyID != 7 {
+			t.Errorf("event %+v", p.event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was published")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pub.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNATSPublisherURL(t *testing.T) {
+	for _, u := range []string{"", "http://localhost:4222", "nats://"} {
+		if _, err := NewNATSPublisher(NATSConfig{URL: u}); err == nil {
+			t.Errorf("%q was accepted", u)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can
+// subscribe to. It covers what a read-only feed of events needs: escaped
+// text, folded lines and UTC times.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of a feed.
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets is the longest content line before it is folded.
+const maxLineOctets = 75
+
+// Calendar is a feed of events. Name and RefreshInterval are the widely
+// supported X-WR-CALNAME and REFRESH-INTERVAL hints.
+type Calendar struct {
+	ProductID       string
+	Name            string
+	Description     string
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+// Event is a VEVENT. UID must stay the same across edits and Sequence grow
+// with each, so subscribers update the event rather than add another.
+type Event struct {
+	UID          string
+	Sequence     int
+	Start        time.Time
+	End          time.Time
+	Created      time.Time
+	LastModified time.Time
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+}
+
+// Marshal renders the calendar. Times are written in UTC.
+func (c *Calendar) Marshal(now time.Time) []byte {
+	var b bytes.Buffer
+	line := func(name, value string) { writeLine(&b, name+":"+value) }
+	text := func(name, value string) {
+		if value != "" {
+			line(name, escape(value))
+		}
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	text("PRODID", c.ProductID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	text("X-WR-CALNAME", c.Name)
+	text("X-WR-CALDESC", c.Description)
+	if c.RefreshInterval > 0 {
+		interval := duration(c.RefreshInterval)
+		line("REFRESH-INTERVAL;VALUE=DURATION", interval)
+		line("X-PUBLISHED-TTL", interval)
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		text("UID", e.UID)
+		line("DTSTAMP", utc(now))
+		line("DTSTART", utc(e.Start))
+		line("DTEND", utc(e.End))
+		if !e.Created.IsZero() {
+			line("CREATED", utc(e.Created))
+		}
+		if !e.LastModified.IsZero() {
+			line("LAST-MODIFIED", utc(e.LastModified))
+		}
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+		text("SUMMARY", e.Summary)
+		text("DESCRIPTION", e.Description)
+		text("LOCATION", e.Location)
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return b.Bytes()
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// duration formats d as an RFC 5545 duration in whole minutes, at least one.
+func duration(d time.Duration) string {
+	minutes := max(int(d.Minutes()), 1)
+	if minutes%60 == 0 {
+		return fmt.Sprintf("PT%dH", minutes/60)
+	}
+	return fmt.Sprintf("PT%dM", minutes)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escape makes s a TEXT value.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeLine writes a content line, folded so no line is longer than 75
+// octets without splitting a UTF-8 character.
+func writeLine(b *bytes.Buffer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// the leading space of a continuation counts
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,59 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	start := time.Date(2026, 5, 2, 10, 0, 0, 0, time.FixedZone("ALMT", 5*3600))
+	c := Calendar{
+		ProductID:       "-//Real Estate//Listings//EN",
+		Name:            "Acme, open houses",
+		RefreshInterval: time.Hour,
+		Events: []Event{{
+			UID:         "listing-event-7@example.com",
+			Sequence:    2,
+			Start:       start,
+			End:         start.Add(2 * time.Hour),
+			Summary:     "Open house; bring ID",
+			Description: "Line one\nLine two with a backslash \\",
+			Location:    strings.Repeat("Абай ", 20),
+		}},
+	}
+
+	out := string(c.Marshal(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)))
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Acme\\, open houses\r\n",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H\r\n",
+		"DTSTAMP:20260501T000000Z\r\n",
+		"DTSTART:20260502T050000Z\r\nDTEND:20260502T070000Z\r\n",
+		"SEQUENCE:2\r\n",
+		"SUMMARY:Open house\\; bring ID\r\n",
+		"DESCRIPTION:Line one\\nLine two with a backslash \\\\\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	var location string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if strings.HasPrefix(line, "LOCATION:") {
+			location = line
+		} else if location != "" && strings.HasPrefix(line, " ") {
+			location += line[1:]
+		} else if location != "" {
+			break
+		}
+	}
+	if location != "LOCATION:"+strings.Repeat("Абай ", 20) {
+		t.Errorf("unfolded %q", location)
+	}
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron spec: five fields for the minute (0-59), hour
+// (0-23), day of the month (1-31), month (1-12) and day of the week (0-6,
+// Sunday is 0 or 7). A field is *, a value, a range a-b or a list of them,
+// each optionally stepped with /n. When both the day of the month and the
+// day of the week are restricted, a day matching either is a match, as in
+// Vixie cron. @hourly, @daily, @weekly and @monthly stand for their usual
+// specs.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// anyDay is set when the day of the month or of the week is *, so
+	// only the other one restricts days
+	anyDay bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func ParseCron(spec string) (*Cron, error) {
+	if alias, ok := cronAliases[strings.TrimSpace(spec)]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("jobs: cron spec %q must have 5 fields", spec)
+	}
+
+	var c Cron
+	var err error
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}}
+	for i, b := range bounds {
+		if *b.field, err = parseCronField(fields[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("jobs: cron spec %q: %w", spec, err)
+		}
+	}
+	// 7 is Sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDay = fields[2] == "*" || fields[4] == "*"
+	if c.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("jobs: cron spec %q never matches", spec)
+	}
+	return &c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			expr, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if expr != "*" {
+			from, to, isRange := strings.Cut(expr, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("bad range in %q", part)
+				}
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t the spec matches, to the minute, in
+// t's location.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// every spec matches within a few years; the bound guards against
+	// dates that never come, such as February 30
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
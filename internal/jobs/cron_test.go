@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// a Friday
+	from := time.Date(2026, 10, 16, 12, 34, 56, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 12, 35, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 12, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		// either day field matches when both are restricted
+		{"0 0 1 * 6", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "0 0 30 2 *", "@yearly"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+// Package jobs runs background work from a queue kept in the database, so
+// it survives restarts and is shared by every instance. A Pool claims due
+// jobs, runs them on a bounded number of workers and retries failures with
+// backoff; a job whose worker died is queued again once its lease runs out.
+// Schedules enqueue a job on a cron spec, once per tick across instances.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Statuses of a job.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var (
+	// ErrDuplicate is returned by Store.Enqueue when a job with the same
+	// UniqueKey exists.
+	ErrDuplicate = errors.New("jobs: a job with that key exists")
+	// ErrUnknownKind is returned when enqueueing a kind no handler was
+	// registered for.
+	ErrUnknownKind = errors.New("jobs: unknown kind")
+)
+
+// Job is one run of a handler, kept until it is pruned. Attempts counts
+// the runs started so far; LastError is the error of the latest failed one.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	// UniqueKey, when set, makes Enqueue refuse a second job with the same
+	// key, such as one tick of a schedule.
+	UniqueKey  string     `json:"unique_key,omitempty"`
+	RunAt      time.Time  `json:"run_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Store keeps the queue.
+type Store interface {
+	// Enqueue saves job as queued and sets its ID, status and CreatedAt.
+	Enqueue(ctx context.Context, job *Job) error
+	// Claim marks up to limit queued jobs of kinds whose RunAt has passed
+	// as running, counts an attempt and returns them.
+	Claim(ctx context.Context, kinds []string, limit int) ([]Job, error)
+	Succeed(ctx context.Context, id int64) error
+	// Fail records msg for the latest attempt. The job is queued again to
+	// run at retryAt, or failed for good when retryAt is nil.
+	Fail(ctx context.Context, id int64, msg string, retryAt *time.Time) error
+	// Requeue queues the jobs still running that started before
+	// startedBefore again, or fails those out of attempts, and returns how
+	// many there were.
+	Requeue(ctx context.Context, startedBefore time.Time) (int64, error)
+}
+
+// Handler runs one job. An error fails the attempt; wrap it with Permanent
+// when retrying cannot help.
+type Handler func(ctx context.Context, job Job) error
+
+// Kind is how the jobs of one kind run.
+type Kind struct {
+	Handler Handler
+	// MaxAttempts is how many times a job runs before it is failed for
+	// good. Defaults to 3.
+	MaxAttempts int
+	// Timeout bounds one attempt. Defaults to the pool's lease.
+	Timeout time.Duration
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one a retry would fail with again, such as a
+// payload that does not decode; the job fails without further attempts.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Config configures a Pool.
+type Config struct {
+	// Workers is how many jobs the pool runs at once. With 0 it only
+	// enqueues, and other instances run the jobs.
+	Workers int
+	// Poll is how often the queue is checked for due jobs; enqueueing on
+	// this pool checks right away. Defaults to a second.
+	Poll time.Duration
+	// Lease is how long a job may run before it is presumed abandoned by
+	// a worker that died and queued again. Defaults to 10 minutes.
+	Lease time.Duration
+	// Backoff is the wait before the first retry, doubled for each later
+	// one up to an hour. Defaults to 30 seconds.
+	Backoff time.Duration
+}
+
+const maxBackoff = time.Hour
+
+// Pool runs the jobs of the kinds registered with it. Register kinds and
+// schedules before Start.
+type Pool struct {
+	store     Store
+	cfg       Config
+	kinds     map[string]Kind
+	schedules []schedule
+	// OnError is called with store failures and failed attempts; it may be
+	// nil.
+	OnError func(error)
+	now     func() time.Time
+
+	// slots holds a token for every running job
+	slots chan struct{}
+	wake  chan struct{}
+	stop  chan struct{}
+	// loop is done when the claim loop stopped, running when every job has
+	// finished
+	loop    sync.WaitGroup
+	running sync.WaitGroup
+}
+
+type schedule struct {
+	kind string
+	spec *Cron
+	next time.Time
+}
+
+func New(store Store, cfg Config) *Pool {
+	if cfg.Poll <= 0 {
+		cfg.Poll = time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 10 * time.Minute
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 30 * time.Second
+	}
+	return &Pool{
+		store: store,
+		cfg:   cfg,
+		kinds: map[string]Kind{},
+		now:   time.Now,
+		slots: make(chan struct{}, max(cfg.Workers, 1)),
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+}
+
+// Register runs jobs of kind with k.
+func (p *Pool) Register(kind string, k Kind) {
+	if k.MaxAttempts <= 0 {
+		k.MaxAttempts = 3
+	}
+	if k.Timeout <= 0 {
+		k.Timeout = p.cfg.Lease
+	}
+	p.kinds[kind] = k
+}
+
+// Schedule enqueues a job of kind, with no payload, at every tick of the
+// cron spec in UTC. Ticks missed while no instance was running are skipped.
+func (p *Pool) Schedule(spec string, kind string) error {
+	if _, ok := p.kinds[kind]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	cron, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	p.schedules = append(p.schedules, schedule{kind: kind, spec: cron})
+	return nil
+}
+
+// Enqueue queues a job of kind with payload encoded as JSON, to run as
+// soon as a worker is free.
+func (p *Pool) Enqueue(ctx context.Context, kind string, payload any) (*Job, error) {
+	return p.EnqueueAt(ctx, kind, payload, p.now())
+}
+
+// EnqueueAt queues a job of kind to run once runAt has passed.
+func (p *Pool) EnqueueAt(ctx context.Context, kind string, payload any, runAt time.Time) (*Job, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{Kind: kind, Payload: body, RunAt: runAt}
+	if err := p.enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (p *Pool) enqueue(ctx context.Context, job *Job) error {
+	k, ok := p.kinds[job.Kind]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+	job.MaxAttempts = k.MaxAttempts
+	if err := p.store.Enqueue(ctx, job); err != nil {
+		return err
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start runs the claim loop and the schedules until Shutdown. Without
+// workers it only runs the schedules.
+func (p *Pool) Start() {
+	now := p.now().UTC()
+	for i := range p.schedules {
+		p.schedules[i].next = p.schedules[i].spec.Next(now)
+	}
+
+	p.loop.Add(1)
+	go p.run()
+}
+
+// Shutdown stops claiming jobs and waits for the running ones to finish.
+// Jobs still running when ctx ends are queued again after their lease.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	close(p.stop)
+	p.loop.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) run() {
+	defer p.loop.Done()
+
+	ticker := time.NewTicker(p.cfg.Poll)
+	defer ticker.Stop()
+
+	// stale jobs are looked for once per lease, not on every poll
+	var requeued time.Time
+	for {
+		now := p.now()
+		p.tick(now)
+		if p.cfg.Workers > 0 {
+			if now.Sub(requeued) >= p.cfg.Lease {
+				p.requeue(now)
+				requeued = now
+			}
+			p.claim()
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+// tick enqueues the schedules that are due. Every instance does, and the
+// unique key keeps one job per tick.
+func (p *Pool) tick(now time.Time) {
+	now = now.UTC()
+	for i := range p.schedules {
+		s := &p.schedules[i]
+		if now.Before(s.next) {
+			continue
+		}
+		job := &Job{Kind: s.kind, Payload: json.RawMessage("null"), RunAt: s.next, UniqueKey: "cron:" + s.kind + ":" + s.next.Format(time.RFC3339)}
+		if err := p.enqueue(context.Background(), job); err != nil && !errors.Is(err, ErrDuplicate) {
+			p.report(fmt.Errorf("jobs: schedule %s: %w", s.kind, err))
+		}
+		s.next = s.spec.Next(now)
+	}
+}
+
+func (p *Pool) requeue(now time.Time) {
+	n, err := p.store.Requeue(context.Background(), now.Add(-p.cfg.Lease))
+	if err != nil {
+		p.report(fmt.Errorf("jobs: requeue: %w", err))
+		return
+	}
+	if n > 0 {
+		p.report(fmt.Errorf("jobs: %d jobs outlived their lease and were queued again", n))
+	}
+}
+
+// claim starts as many due jobs as there are free workers.
+func (p *Pool) claim() {
+	free := p.cfg.Workers - len(p.slots)
+	if free <= 0 {
+		return
+	}
+
+	kinds := make([]string, 0, len(p.kinds))
+	for kind := range p.kinds {
+		kinds = append(kinds, kind)
+	}
+	claimed, err := p.store.Claim(context.Background(), kinds, free)
+	if err != nil {
+		p.report(fmt.Errorf("jobs: claim: %w", err))
+		return
+	}
+	for _, job := range claimed {
+		p.slots <- struct{}{}
+		p.running.Add(1)
+		go p.execute(job)
+	}
+}
+
+// execute runs one attempt of job and records how it went.
+func (p *Pool) execute(job Job) {
+	defer func() {
+		<-p.slots
+		p.running.Done()
+		// a worker is free
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}()
+
+	k := p.kinds[job.Kind]
+	ctx, cancel := context.WithTimeout(context.Background(), k.Timeout)
+	defer cancel()
+
+	err := p.call(ctx, k.Handler, job)
+	if err == nil {
+		if err := p.store.Succeed(context.Background(), job.ID); err != nil {
+			p.report(fmt.Errorf("jobs: %s %d: %w", job.Kind, job.ID, err))
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	var permanent permanentError
+	if job.Attempts < job.MaxAttempts && !errors.As(err, &permanent) {
+		at := p.now().Add(p.backoff(job.Attempts))
+		retryAt = &at
+	}
+	p.report(fmt.Errorf("jobs: %s %d attempt %d: %w", job.Kind, job.ID, job.Attempts, err))
+	if err := p.store.Fail(context.Background(), job.ID, err.Error(), retryAt); err != nil {
+		p.report(fmt.Errorf("jobs: %s %d: %w", job.Kind, job.ID, err))
+	}
+}
+
+// call runs h, turning a panic into an error so one bad job does not take
+// the instance down.
+func (p *Pool) call(ctx context.Context, h Handler, job Job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// backoff is the wait after the given attempt failed.
+func (p *Pool) backoff(attempt int) time.Duration {
+	d := p.cfg.Backoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+func (p *Pool) report(err error) {
+	if p.OnError != nil {
+		p.OnError(err)
+	}
+}
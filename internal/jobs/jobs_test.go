@@ -0,0 +1,135 @@
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestPool(t *testing.T) {
+	queue := store.NewMemoryStorage().Jobs
+	pool := jobs.New(queue, jobs.Config{Workers: 2, Poll: 10 * time.Millisecond, Backoff: time.Millisecond})
+
+	var mu sync.Mutex
+	var greeted []string
+	pool.Register("greet", jobs.Kind{Handler: func(ctx context.Context, job jobs.Job) error {
+		var name string
+		if err := json.Unmarshal(job.Payload, &name); err != nil {
+			return jobs.Permanent(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		greeted = append(greeted, name)
+		return nil
+	}})
+	pool.Register("flaky", jobs.Kind{Handler: func(ctx context.Context, job jobs.Job) error {
+		if job.Attempts < 2 {
+			return errors.New("try again")
+		}
+		return nil
+	}})
+	pool.Register("broken", jobs.Kind{MaxAttempts: 2, Handler: func(ctx context.Context, job jobs.Job) error {
+		panic("boom")
+	}})
+
+	if err := pool.Schedule("0 0 30 2 *", "greet"); err == nil {
+		t.Error("a spec that never matches should be refused")
+	}
+	if err := pool.Schedule("@daily", "missing"); !errors.Is(err, jobs.ErrUnknownKind) {
+		t.Errorf("scheduling an unknown kind: %v", err)
+	}
+	if _, err := pool.Enqueue(context.Background(), "missing", nil); !errors.Is(err, jobs.ErrUnknownKind) {
+		t.Errorf("enqueueing an unknown kind: %v", err)
+	}
+
+	pool.Start()
+	ctx := context.Background()
+	greet, _ := pool.Enqueue(ctx, "greet", "anna")
+	bad, _ := pool.Enqueue(ctx, "greet", 42)
+	flaky, _ := pool.Enqueue(ctx, "flaky", nil)
+	broken, _ := pool.Enqueue(ctx, "broken", nil)
+	later, _ := pool.EnqueueAt(ctx, "greet", "later", time.Now().Add(time.Hour))
+
+	wait := func(id int64, status string) jobs.Job {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			job, err := queue.GetByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status == status {
+				return *job
+			}
+		}
+		t.Fatalf("job %d never became %s", id, status)
+		return jobs.Job{}
+	}
+
+	if job := wait(greet.ID, jobs.StatusSucceeded); job.Attempts != 1 || job.FinishedAt == nil {
+		t.Errorf("greet job = %+v", job)
+	}
+	// a payload that does not decode is not retried
+	if job := wait(bad.ID, jobs.StatusFailed); job.Attempts != 1 || job.LastError == "" {
+		t.Errorf("bad payload job = %+v", job)
+	}
+	if job := wait(flaky.ID, jobs.StatusSucceeded); job.Attempts != 2 || job.LastError != "try again" {
+		t.Errorf("flaky job = %+v", job)
+	}
+	if job := wait(broken.ID, jobs.StatusFailed); job.Attempts != 2 || job.LastError != "panic: boom" {
+		t.Errorf("broken job = %+v", job)
+	}
+
+	if err := pool.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := queue.GetByID(ctx, later.ID); job.Status != jobs.StatusQueued {
+		t.Errorf("a job due later ran: %+v", job)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(greeted) != 1 || greeted[0] != "anna" {
+		t.Errorf("greeted %v", greeted)
+	}
+}
+
+func TestStoreQueue(t *testing.T) {
+	queue := store.NewMemoryStorage().Jobs
+	ctx := context.Background()
+
+	tick := &jobs.Job{Kind: "prune", MaxAttempts: 1, UniqueKey: "cron:prune:2026-10-16T03:00:00Z", RunAt: time.Now()}
+	if err := queue.Enqueue(ctx, tick); err != nil {
+		t.Fatal(err)
+	}
+	again := &jobs.Job{Kind: "prune", MaxAttempts: 1, UniqueKey: tick.UniqueKey, RunAt: time.Now()}
+	if err := queue.Enqueue(ctx, again); !errors.Is(err, jobs.ErrDuplicate) {
+		t.Errorf("a second job for one tick: %v", err)
+	}
+
+	// a job whose worker died is failed once it is out of attempts
+	if claimed, _ := queue.Claim(ctx, []string{"prune"}, 10); len(claimed) != 1 {
+		t.Fatalf("claimed %d jobs", len(claimed))
+	}
+	if n, _ := queue.Requeue(ctx, time.Now().Add(time.Second)); n != 1 {
+		t.Errorf("requeued %d jobs", n)
+	}
+	job, _ := queue.GetByID(ctx, tick.ID)
+	if job.Status != jobs.StatusFailed {
+		t.Errorf("abandoned job is %s", job.Status)
+	}
+
+	if _, err := queue.Retry(ctx, tick.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Retry(ctx, tick.ID); !errors.Is(err, store.ErrJobNotFailed) {
+		t.Errorf("retrying a queued job: %v", err)
+	}
+	if list, _ := queue.List(ctx, store.JobFilter{Status: jobs.StatusQueued}); len(list) != 1 || list[0].Attempts != 0 {
+		t.Errorf("queued jobs %+v", list)
+	}
+}
@@ -0,0 +1,121 @@
+// Package lru is a size-bounded, in-process cache that evicts the least
+// recently used entry and expires entries after a fixed time to live.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats counts lookups and evictions since the cache was created.
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Removals  int64 `json:"removals"`
+	Len       int   `json:"len"`
+}
+
+// Cache is safe for concurrent use. Values are returned as stored, so
+// callers that change them must store copies.
+type Cache[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[K]*list.Element
+	stats Stats
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// New returns a cache of at most size entries that each live for ttl.
+func New[K comparable, V any](size int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[K]*list.Element, size),
+		now:   time.Now,
+	}
+}
+
+// Get returns the value of key, if it is cached and has not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		if c.now().Before(e.expires) {
+			c.order.MoveToFront(el)
+			c.stats.Hits++
+			return e.value, true
+		}
+		c.remove(el)
+	}
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Add caches value under key for the cache's ttl, evicting the least
+// recently used entry when the cache is full.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Remove drops key, so the next Get misses. It reports whether key was
+// cached.
+func (c *Cache[K, V]) Remove(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if ok {
+		c.remove(el)
+		c.stats.Removals++
+	}
+	return ok
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Len = c.order.Len()
+	return stats
+}
+
+func (c *Cache[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,46 @@
+package lru
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := New[int, string](2, time.Minute)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Add(1, "one")
+	c.Add(2, "two")
+	if v, ok := c.Get(1); !ok || v != "one" {
+		t.Fatalf("Get(1) = %q, %v", v, ok)
+	}
+
+	// 2 is now the least recently used
+	c.Add(3, "three")
+	if _, ok := c.Get(2); ok {
+		t.Error("2 should have been evicted")
+	}
+	if _, ok := c.Get(1); !ok {
+		t.Error("1 was used and should have been kept")
+	}
+
+	c.Add(1, "uno")
+	if v, _ := c.Get(1); v != "uno" {
+		t.Errorf("Add did not replace the value, got %q", v)
+	}
+
+	if !c.Remove(3) || c.Remove(3) {
+		t.Error("Remove should report whether the key was cached")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get(1); ok {
+		t.Error("1 should have expired")
+	}
+
+	want := Stats{Hits: 3, Misses: 2, Evictions: 1, Removals: 1, Len: 0}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
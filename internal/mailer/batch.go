@@ -0,0 +1,178 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+// Recipient is one addressee of a batch. Data is rendered into the template
+// for this recipient only.
+type Recipient struct {
+	Username string
+	Email    string
+	Data     any
+}
+
+// BatchResult is the outcome for the recipient at the same index in the
+// batch. Status is -1 when the message was not accepted.
+type BatchResult struct {
+	Email  string
+	Status int
+	Err    error
+}
+
+// renderedMessage is a template rendered for one recipient. text is empty
+// unless the template defines the optional "text" block, unsubscribe unless
+// it defines the "unsubscribe" block.
+type renderedMessage struct {
+	subject     string
+	body        string
+	text        string
+	unsubscribe string
+}
+
+func render(tmpl *mailTemplate, data any) (renderedMessage, error) {
+	subject := new(bytes.Buffer)
+	if err := tmpl.subject.ExecuteTemplate(subject, "subject", data); err != nil {
+		return renderedMessage{}, err
+	}
+
+	body := new(bytes.Buffer)
+	if err := tmpl.body.ExecuteTemplate(body, "body", data); err != nil {
+		return renderedMessage{}, err
+	}
+
+	text := new(bytes.Buffer)
+	if tmpl.subject.Lookup("text") != nil {
+		if err := tmpl.subject.ExecuteTemplate(text, "text", data); err != nil {
+			return renderedMessage{}, err
+		}
+	}
+
+	unsubscribe := new(bytes.Buffer)
+	if tmpl.subject.Lookup("unsubscribe") != nil {
+		if err := tmpl.subject.ExecuteTemplate(unsubscribe, "unsubscribe", data); err != nil {
+			return renderedMessage{}, err
+		}
+	}
+
+	return renderedMessage{
+		subject:     subject.String(),
+		body:        body.String(),
+		text:        strings.TrimSpace(text.String()),
+		unsubscribe: strings.TrimSpace(unsubscribe.String()),
+	}, nil
+}
+
+// setBody adds the plain text part, when there is one, ahead of the HTML
+// part so that clients able to show HTML prefer it.
+func (msg renderedMessage) setBody(message *gomail.Message) {
+	if msg.text == "" {
+		message.SetBody("text/html", msg.body)
+		return
+	}
+	message.SetBody("text/plain", msg.text)
+	message.AddAlternative("text/html", msg.body)
+}
+
+// setUnsubscribe adds the List-Unsubscribe headers (RFC 2369 and RFC 8058
+// one-click) when the message has an unsubscribe link.
+func (msg renderedMessage) setUnsubscribe(message *gomail.Message) {
+	for key, value := range msg.unsubscribeHeaders() {
+		message.SetHeader(key, value)
+	}
+}
+
+func (msg renderedMessage) unsubscribeHeaders() map[string]string {
+	if msg.unsubscribe == "" {
+		return nil
+	}
+	return map[string]string{
+		"List-Unsubscribe":      "<" + msg.unsubscribe + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// renderBatch renders the template once per recipient. Recipients whose
+// data fails to render get an error result and a nil message.
+func renderBatch(templateFile string, recipients []Recipient) ([]*renderedMessage, []BatchResult, error) {
+	var tmpl *mailTemplate
+	err := timed(templateFile, false, func() error {
+		var err error
+		tmpl, err = parseTemplate(templateFile)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages := make([]*renderedMessage, len(recipients))
+	results := make([]BatchResult, len(recipients))
+	for i, recipient := range recipients {
+		results[i] = BatchResult{Email: recipient.Email, Status: -1}
+
+		var msg renderedMessage
+		err := timed(templateFile, false, func() error {
+			var err error
+			msg, err = render(tmpl, recipient.Data)
+			return err
+		})
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		messages[i] = &msg
+	}
+
+	return messages, results, nil
+}
+
+// sendBatchSMTP dials once and sends the messages one after another on the
+// same connection. A message rejected by the server does not stop the rest;
+// once ctx is done the remaining recipients get ctx.Err(). Each SMTP command
+// is bounded by the dialer timeout.
+func sendBatchSMTP(ctx context.Context, dialer *gomail.Dialer, sender Sender, templateFile string, recipients []Recipient) ([]BatchResult, error) {
+	messages, results, err := renderBatch(templateFile, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn, err := dialer.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	for i, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		message := gomail.NewMessage()
+		sender.setHeaders(message)
+		setTraceparent(ctx, message)
+		message.SetHeader("To", recipients[i].Email)
+		message.SetHeader("Subject", msg.subject)
+		msg.setUnsubscribe(message)
+		msg.setBody(message)
+
+		if err := sendTimed(templateFile, func() error { return gomail.Send(sender.envelope(conn), message) }); err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Status = 200
+	}
+
+	return results, nil
+}
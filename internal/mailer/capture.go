@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CapturedMessage is an email rendered by CaptureClient instead of being
+// delivered.
+type CapturedMessage struct {
+	Template    string    `json:"template"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	Subject     string    `json:"subject"`
+	Body        string    `json:"body"`
+	Text        string    `json:"text,omitempty"`
+	Unsubscribe string    `json:"unsubscribe,omitempty"`
+	MessageID   string    `json:"message_id"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+// CaptureClient renders every message and keeps the most recent ones in
+// memory. It is used by demo mode and tests where no mail provider exists.
+type CaptureClient struct {
+	mu       sync.Mutex
+	limit    int
+	messages []CapturedMessage
+}
+
+// NewCaptureClient keeps up to limit messages; older ones are dropped first.
+func NewCaptureClient(limit int) *CaptureClient {
+	return &CaptureClient{limit: limit}
+}
+
+func (c *CaptureClient) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	msg, err := renderTimed(templateFile, data)
+	if err != nil {
+		return SendResult{}, err
+	}
+	msg = msg.track(ctx)
+
+	captured := c.capture(templateFile, username, email, msg)
+	return SendResult{Provider: "capture", MessageID: captured.MessageID, Accepted: []string{email}, SentAt: captured.SentAt}, nil
+}
+
+func (c *CaptureClient) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	messages, results, err := renderBatch(templateFile, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		c.capture(templateFile, recipients[i].Username, recipients[i].Email, *msg)
+		results[i].Status = 200
+	}
+
+	return results, nil
+}
+
+func (c *CaptureClient) capture(templateFile, username, email string, msg renderedMessage) CapturedMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	captured := CapturedMessage{
+		Template:    templateFile,
+		Username:    username,
+		Email:       email,
+		Subject:     msg.subject,
+		Body:        msg.body,
+		Text:        msg.text,
+		Unsubscribe: msg.unsubscribe,
+		MessageID:   newMessageID("capture.localhost"),
+		SentAt:      time.Now(),
+	}
+	c.messages = append(c.messages, captured)
+	if c.limit > 0 && len(c.messages) > c.limit {
+		c.messages = c.messages[len(c.messages)-c.limit:]
+	}
+	return captured
+}
+
+// Messages returns the captured messages, newest first.
+func (c *CaptureClient) Messages() []CapturedMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := make([]CapturedMessage, len(c.messages))
+	for i, msg := range c.messages {
+		messages[len(c.messages)-1-i] = msg
+	}
+	return messages
+}
@@ -0,0 +1,189 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ReceivedMessage is an email as a capture server received it.
+type ReceivedMessage struct {
+	ID      string
+	Subject string
+	// Body holds every text part, decoded.
+	Body string
+}
+
+// CaptureServer reads the messages a local capture server received, through
+// the MailHog API, or the Mailpit API when the MailHog one is missing.
+type CaptureServer struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewCaptureServer(baseURL string) *CaptureServer {
+	return &CaptureServer{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// errNoMailHogAPI makes Latest fall back to the Mailpit API.
+var errNoMailHogAPI = errors.New("no MailHog API")
+
+// WaitFor polls until a message to address other than previousID arrives
+// or wait passes. Pass the ID from Latest before sending to skip older
+// messages, or "" to take any.
+func (s *CaptureServer) WaitFor(ctx context.Context, address, previousID string, wait time.Duration) (*ReceivedMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		msg, err := s.Latest(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil && msg.ID != previousID {
+			return msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("nothing sent to %s within %s", address, wait)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Latest returns the newest message to address, or nil when there is none.
+func (s *CaptureServer) Latest(ctx context.Context, address string) (*ReceivedMessage, error) {
+	msg, err := s.latestMailHog(ctx, address)
+	if errors.Is(err, errNoMailHogAPI) {
+		return s.latestMailpit(ctx, address)
+	}
+	return msg, err
+}
+
+type mailhogPart struct {
+	Headers map[string][]string `json:"Headers"`
+	Body    string              `json:"Body"`
+}
+
+// decoded returns the part's body with its transfer encoding removed.
+func (p mailhogPart) decoded() string {
+	for _, encoding := range p.Headers["Content-Transfer-Encoding"] {
+		if strings.EqualFold(encoding, "quoted-printable") {
+			decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(p.Body)))
+			if err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	return p.Body
+}
+
+func (s *CaptureServer) latestMailHog(ctx context.Context, address string) (*ReceivedMessage, error) {
+	var result struct {
+		Items []struct {
+			ID      string      `json:"ID"`
+			Content mailhogPart `json:"Content"`
+			// MIME is set for multipart messages, e.g. text with an HTML alternative
+			MIME *struct {
+				Parts []mailhogPart `json:"Parts"`
+			} `json:"MIME"`
+		} `json:"items"`
+	}
+	query := url.Values{"kind": {"to"}, "query": {address}, "limit": {"1"}}
+	if err := s.get(ctx, "/api/v2/search?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		return nil, nil
+	}
+
+	item := result.Items[0]
+	msg := &ReceivedMessage{ID: item.ID}
+	if subject := item.Content.Headers["Subject"]; len(subject) > 0 {
+		msg.Subject = decodeHeader(subject[0])
+	}
+	if item.MIME == nil || len(item.MIME.Parts) == 0 {
+		msg.Body = item.Content.decoded()
+		return msg, nil
+	}
+	var body strings.Builder
+	for _, part := range item.MIME.Parts {
+		body.WriteString(part.decoded())
+		body.WriteString("\n")
+	}
+	msg.Body = body.String()
+	return msg, nil
+}
+
+func (s *CaptureServer) latestMailpit(ctx context.Context, address string) (*ReceivedMessage, error) {
+	var result struct {
+		Messages []struct {
+			ID string `json:"ID"`
+		} `json:"messages"`
+	}
+	query := url.Values{"query": {`to:"` + address + `"`}, "limit": {"1"}}
+	if err := s.get(ctx, "/api/v1/search?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Messages) == 0 {
+		return nil, nil
+	}
+
+	var message struct {
+		ID      string `json:"ID"`
+		Subject string `json:"Subject"`
+		Text    string `json:"Text"`
+		HTML    string `json:"HTML"`
+	}
+	if err := s.get(ctx, "/api/v1/message/"+url.PathEscape(result.Messages[0].ID), &message); err != nil {
+		return nil, err
+	}
+	return &ReceivedMessage{ID: message.ID, Subject: message.Subject, Body: message.Text + "\n" + message.HTML}, nil
+}
+
+func (s *CaptureServer) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/api/v2/") {
+		return errNoMailHogAPI
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("capture server %s: status %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("capture server %s: %w", path, err)
+	}
+	return nil
+}
+
+// decodeHeader undoes RFC 2047 encoding, e.g. =?UTF-8?q?...?=.
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCaptureServerMailHog(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/search" || r.URL.Query().Get("query") != "jo@example.com" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"items":[{"ID":"m1",
+			"Content":{"Headers":{"Subject":["=?UTF-8?q?Welcome_jo?="]},"Body":"raw"},
+			"MIME":{"Parts":[{"Headers":{"Content-Transfer-Encoding":["quoted-printable"]},
+				"Body":"<a href=3D\"http://x/?token=3Dab=\r\ncd\">"}]}}]}`))
+	}))
+	defer srv.Close()
+
+	msg, err := NewCaptureServer(srv.URL).Latest(context.Background(), "jo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == nil || msg.ID != "m1" || msg.Subject != "Welcome jo" {
+		t.Fatalf("got %+v", msg)
+	}
+	if !strings.Contains(msg.Body, `href="http://x/?token=abcd"`) {
+		t.Errorf("body not decoded: %q", msg.Body)
+	}
+}
+
+func TestCaptureServerMailpit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/search":
+			if r.URL.Query().Get("query") != `to:"jo@example.com"` {
+				w.Write([]byte(`{"messages":[]}`))
+				return
+			}
+			w.Write([]byte(`{"messages":[{"ID":"p1"}]}`))
+		case "/api/v1/message/p1":
+			w.Write([]byte(`{"ID":"p1","Subject":"Welcome jo","Text":"token=abcd","HTML":""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	server := NewCaptureServer(srv.URL)
+	msg, err := server.Latest(context.Background(), "jo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == nil || msg.ID != "p1" || msg.Subject != "Welcome jo" || !strings.Contains(msg.Body, "token=abcd") {
+		t.Fatalf("got %+v", msg)
+	}
+
+	msg, err = server.Latest(context.Background(), "other@example.com")
+	if err != nil || msg != nil {
+		t.Fatalf("expected no message, got %+v, %v", msg, err)
+	}
+}
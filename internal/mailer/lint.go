@@ -0,0 +1,147 @@
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// lintMaxSubjectLength is where most clients start truncating subjects.
+	lintMaxSubjectLength = 78
+	// lintMinTextPerImage is the visible text, in characters, expected for
+	// each image; image-heavy mail is a common spam signal.
+	lintMinTextPerImage = 200
+)
+
+// LintWarning is a deliverability problem found in a rendered email. Code
+// is stable and meant for filtering; Message is for people.
+type LintWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (w LintWarning) String() string {
+	return w.Code + ": " + w.Message
+}
+
+// Lint renders templateFile with data and reports deliverability problems:
+// a missing or overlong subject, too little text for the number of images,
+// no plain text part and links that are empty, relative or were removed by
+// escaping. It does not prevent sending.
+func Lint(templateFile string, data any) ([]LintWarning, error) {
+	tmpl, err := parseTemplate(templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := render(tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+	return lintMessage(msg), nil
+}
+
+func lintMessage(msg renderedMessage) []LintWarning {
+	var warnings []LintWarning
+	warn := func(code, format string, args ...any) {
+		warnings = append(warnings, LintWarning{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	subject := strings.TrimSpace(msg.subject)
+	switch n := utf8.RuneCountInString(subject); {
+	case n == 0:
+		warn("subject_empty", "the subject is empty")
+	case n > lintMaxSubjectLength:
+		warn("subject_too_long", "the subject is %d characters, over %d", n, lintMaxSubjectLength)
+	}
+
+	if msg.text == "" {
+		warn("no_plain_text", `the template has no "text" block, so the email has no plain text part`)
+	}
+
+	text, images, links := scanHTML(msg.body)
+	if images > 0 && text < images*lintMinTextPerImage {
+		warn("image_heavy", "%d images with %d characters of text", images, text)
+	}
+
+	if msg.unsubscribe != "" {
+		links = append(links, msg.unsubscribe)
+	}
+	for _, link := range links {
+		if problem := checkLink(link); problem != "" {
+			warn("broken_link", "%q %s", link, problem)
+		}
+	}
+
+	return warnings
+}
+
+// scanHTML counts the visible text and images of an HTML body and collects
+// its link targets.
+func scanHTML(body string) (text, images int, links []string) {
+	z := html.NewTokenizer(strings.NewReader(body))
+	skip := 0
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return text, images, links
+		case html.TextToken:
+			if skip == 0 {
+				text += utf8.RuneCountInString(strings.TrimSpace(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "head", "style", "script":
+				skip++
+			case "img":
+				images++
+			case "a":
+				for _, attr := range tok.Attr {
+					if attr.Key == "href" {
+						links = append(links, attr.Val)
+					}
+				}
+			}
+		case html.EndTagToken:
+			switch z.Token().Data {
+			case "head", "style", "script":
+				if skip > 0 {
+					skip--
+				}
+			}
+		}
+	}
+}
+
+// checkLink returns why link is broken, or "" if it looks usable.
+func checkLink(link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" || link == "#" {
+		return "is empty"
+	}
+	// html/template replaces unsafe URLs with this value
+	if strings.Contains(link, "ZgotmplZ") {
+		return "was removed as unsafe"
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "does not parse"
+	}
+	switch u.Scheme {
+	case "mailto":
+		return ""
+	case "http", "https":
+		if u.Host == "" {
+			return "has no host"
+		}
+		return ""
+	}
+	return "is not an absolute http(s) or mailto link"
+}
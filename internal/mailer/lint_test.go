@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintBuiltInTemplates(t *testing.T) {
+	data := map[string]any{
+		"Username":       "jo",
+		"ActivationURL":  "https://example.com/confirm/abc",
+		"LoginURL":       "https://example.com/login/abc",
+		"ConfirmURL":     "https://example.com/email/abc",
+		"NewEmail":       "new@example.com",
+		"ExpiresIn":      "15 minutes",
+		"TargetName":     "Flat",
+		"Resolution":     "removed",
+		"UnsubscribeURL": "https://example.com/v1/unsubscribe/abc",
+		"SenderName":     "Sam",
+		"Excerpt":        "Can you check this one?",
+		"MessageURL":     "https://example.com/applications/1",
+		"Status":         "firing",
+		"Summary":        "Database unreachable",
+		"Details":        "ping failed",
+		"SecurityURL":    "https://example.com/settings/security",
+		"JoinURL":        "https://example.com/join/abc",
+		"CompanyName":    "Acme Realty",
+		"InviterName":    "Sam",
+		"TeamRole":       "agent",
+		"Subject":        "New search filters",
+		"Paragraphs":     []string{"You can now filter listings by floor.", "Have a look."},
+	}
+
+	files, err := Templates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		warnings, err := Lint(name, data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(warnings) > 0 {
+			t.Errorf("%s: unexpected warnings %v", name, warnings)
+		}
+	}
+}
+
+func TestLintMessage(t *testing.T) {
+	msg := renderedMessage{
+		subject: strings.Repeat("very long subject ", 6),
+		body: `<html><head><style>p { color: red }</style></head><body>` +
+			`<img src="a.png"><img src="b.png"><p>Hi</p>` +
+			`<a href="">empty</a><a href="#ZgotmplZ">unsafe</a><a href="/relative">rel</a>` +
+			`<a href="https://example.com">ok</a></body></html>`,
+	}
+
+	counts := make(map[string]int)
+	for _, warning := range lintMessage(msg) {
+		counts[warning.Code]++
+	}
+
+	want := map[string]int{"subject_too_long": 1, "no_plain_text": 1, "image_heavy": 1, "broken_link": 3}
+	for code, n := range want {
+		if counts[code] != n {
+			t.Errorf("%s: got %d warnings, want %d (all: %v)", code, counts[code], n, counts)
+		}
+	}
+}
@@ -1,16 +1,87 @@
 package mailer
 
-import "embed"
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"time"
+)
 
 const (
 	FromName            = "Real Estate"
 	maxRetires          = 3
 	UserWelcomeTemplate = "user_invitation.tmpl"
+
+	ComplaintResolvedTemplate = "complaint_resolved.tmpl"
+	EmailChangeTemplate       = "email_change_confirm.tmpl"
+	MagicLinkTemplate         = "magic_link.tmpl"
+	MentionTemplate           = "mention.tmpl"
+	// OperatorAlertTemplate is sent to ALERT_EMAIL, never to users.
+	OperatorAlertTemplate = "operator_alert.tmpl"
+	// AccountReadyTemplate greets users who registered while activation is
+	// turned off; it carries no activation link.
+	AccountReadyTemplate = "user_welcome.tmpl"
+	// RegistrationAttemptTemplate tells the owner of an address that someone
+	// tried to register with it, when AUTH_HIDE_EXISTING_ACCOUNTS is on.
+	RegistrationAttemptTemplate = "registration_attempt.tmpl"
+	// NewSignInTemplate warns about a login from a new country or device.
+	NewSignInTemplate = "new_sign_in.tmpl"
+	// TeamInvitationTemplate invites someone to join a company's team.
+	TeamInvitationTemplate = "team_invitation.tmpl"
+	// AnnouncementTemplate carries an admin broadcast to many users.
+	AnnouncementTemplate = "announcement.tmpl"
 )
 
 //go:embed "templates"
 var FS embed.FS
 
+// SendResult describes a message the provider accepted.
+type SendResult struct {
+	// Provider names the client that sent the message, e.g. "smtp".
+	Provider string
+	// MessageID finds the message in the provider's logs: the Message-ID
+	// header over SMTP, X-Message-Id for SendGrid. It is empty when the
+	// provider returned none.
+	MessageID string
+	// Accepted lists the recipients the provider took the message for.
+	Accepted []string
+	SentAt   time.Time
+}
+
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) (int, error)
+	// Send renders templateFile and sends it. It returns ctx.Err() if ctx is
+	// done before the message was handed to the provider.
+	Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error)
+	// SendBatch renders templateFile for each recipient and sends the
+	// messages over a single connection or provider request where possible.
+	// The error is set only when nothing could be sent; per-recipient
+	// failures are reported in the results.
+	SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error)
+}
+
+// Templates lists the template file names in use, as accepted by Send.
+func Templates() ([]string, error) {
+	return fs.Glob(activeTemplates().fsys, "*.tmpl")
+}
+
+// Render executes the "subject" and "body" blocks of templateFile with data
+// exactly as the clients do before sending.
+func Render(templateFile string, data any) (subject, body string, err error) {
+	tmpl, err := parseTemplate(templateFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	msg, err := render(tmpl, data)
+	if err != nil {
+		return "", "", err
+	}
+	return msg.subject, msg.body, nil
+}
+
+// CheckTemplates parses every template in use and makes sure it defines
+// both the "subject" and "body" blocks used by the clients.
+func CheckTemplates() error {
+	_, err := loadTemplateSet(activeTemplates().fsys)
+	return err
 }
@@ -1,61 +1,70 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
 	"errors"
 
-	"text/template"
-
 	gomail "gopkg.in/mail.v2"
 )
 
 type mailtrapClient struct {
-	fromEmail string
-	apiKey    string
+	senders Senders
+	apiKey  string
 }
 
-func NewMailTrapClient(apiKey, fromEmail string) (mailtrapClient, error) {
+func NewMailTrapClient(apiKey string, senders Senders) (mailtrapClient, error) {
 	if apiKey == "" {
 		return mailtrapClient{}, errors.New("api key is required")
 	}
+	if err := PreloadTemplates(); err != nil {
+		return mailtrapClient{}, err
+	}
 
 	return mailtrapClient{
-		fromEmail: fromEmail,
-		apiKey:    apiKey,
+		senders: senders,
+		apiKey:  apiKey,
 	}, nil
 }
 
-func (m mailtrapClient) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
+func (m mailtrapClient) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
 	// Template parsing and building
-	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
-	if err != nil {
-		return -1, err
-	}
-
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return -1, err
-	}
-
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
+	msg, err := renderTimed(templateFile, data)
 	if err != nil {
-		return -1, err
+		return SendResult{}, err
 	}
+	msg = msg.track(ctx)
 
+	sender := m.senders.For(templateFile)
 	message := gomail.NewMessage()
-	message.SetHeader("From", m.fromEmail)
+	sender.setHeaders(message)
+	setMessageID(message, sender)
+	setTraceparent(ctx, message)
 	message.SetHeader("To", email)
-	message.SetHeader("Subject", subject.String())
+	message.SetHeader("Subject", msg.subject)
+	msg.setUnsubscribe(message)
 
-	message.AddAlternative("text/html", body.String())
+	msg.setBody(message)
 
-	dialer := gomail.NewDialer("live.smtp.mailtrap.io", 587, "api", m.apiKey)
+	ctx, cancel := context.WithTimeout(ctx, DefaultSMTPSendTimeout)
+	defer cancel()
 
-	if err := dialer.DialAndSend(message); err != nil {
-		return -1, err
+	err = sendTimed(templateFile, func() error {
+		return withContext(ctx, func() error { return sender.dialAndSend(m.dialer(), message) })
+	})
+	if err != nil {
+		return SendResult{}, err
 	}
 
-	return 200, nil
+	return smtpResult("mailtrap", message, email), nil
+}
+
+// SendBatch sends every message over one SMTP connection.
+func (m mailtrapClient) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	return sendBatchSMTP(ctx, m.dialer(), m.senders.For(templateFile), templateFile, recipients)
+}
+
+func (m mailtrapClient) dialer() *gomail.Dialer {
+	dialer := gomail.NewDialer("live.smtp.mailtrap.io", 587, "api", m.apiKey)
+	dialer.Timeout = DefaultSMTPDialTimeout
+	return dialer
 }
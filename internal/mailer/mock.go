@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SentMessage is a Send or one SendBatch recipient recorded by MockClient.
+type SentMessage struct {
+	Template string
+	Username string
+	Email    string
+	Data     any
+}
+
+// MockClient records what handlers send without rendering templates, and
+// fails every send with the error given to Fail, for testing the paths
+// where the provider is down.
+type MockClient struct {
+	mu   sync.Mutex
+	sent []SentMessage
+	err  error
+}
+
+func NewMockClient() *MockClient {
+	return &MockClient{}
+}
+
+// Fail makes the following sends return err; nil makes them succeed again.
+func (c *MockClient) Fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *MockClient) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return SendResult{}, c.err
+	}
+	c.sent = append(c.sent, SentMessage{Template: templateFile, Username: username, Email: email, Data: data})
+	return SendResult{
+		Provider:  "mock",
+		MessageID: fmt.Sprintf("mock-%d", len(c.sent)),
+		Accepted:  []string{email},
+		SentAt:    time.Now(),
+	}, nil
+}
+
+func (c *MockClient) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	results := make([]BatchResult, len(recipients))
+	for i, r := range recipients {
+		c.sent = append(c.sent, SentMessage{Template: templateFile, Username: r.Username, Email: r.Email, Data: r.Data})
+		results[i] = BatchResult{Email: r.Email, Status: 200}
+	}
+	return results, nil
+}
+
+// Sent returns the recorded messages, oldest first.
+func (c *MockClient) Sent() []SentMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SentMessage(nil), c.sent...)
+}
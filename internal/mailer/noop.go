@@ -1,11 +1,24 @@
 package mailer
 
+import (
+	"context"
+	"time"
+)
+
 type NoopClient struct{}
 
 func NewNoopClient() NoopClient {
 	return NoopClient{}
 }
 
-func (NoopClient) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
-	return 200, nil
+func (NoopClient) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	return SendResult{Provider: "noop", Accepted: []string{email}, SentAt: time.Now()}, nil
+}
+
+func (NoopClient) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(recipients))
+	for i, recipient := range recipients {
+		results[i] = BatchResult{Email: recipient.Email, Status: 200}
+	}
+	return results, nil
 }
@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags are the elements kept by SanitizeHTML; all others are dropped
+// but their text is kept.
+var allowedTags = map[string]bool{
+	"a": true, "b": true, "blockquote": true, "br": true, "em": true,
+	"i": true, "li": true, "ol": true, "p": true, "strong": true,
+	"u": true, "ul": true,
+}
+
+// droppedTags are removed together with everything inside them.
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"embed": true, "noscript": true, "template": true, "title": true,
+}
+
+// allowedSchemes are the link targets kept on <a href>.
+var allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// SanitizeHTML reduces s to a small set of formatting tags so that rich
+// content, such as a listing description, can be placed in an email body
+// without being escaped. Attributes other than a safe href are removed.
+// Templates call it as {{sanitize .Description}}.
+func SanitizeHTML(s string) template.HTML {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return template.HTML(b.String())
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if droppedTags[tok.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			if skip == 0 && allowedTags[tok.Data] {
+				b.WriteString(startTag(tok))
+			}
+		case html.EndTagToken:
+			tok := z.Token()
+			if droppedTags[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if skip == 0 && allowedTags[tok.Data] && tok.Data != "br" {
+				b.WriteString("</" + tok.Data + ">")
+			}
+		}
+	}
+}
+
+func startTag(tok html.Token) string {
+	if tok.Data != "a" {
+		return "<" + tok.Data + ">"
+	}
+
+	for _, attr := range tok.Attr {
+		if attr.Key != "href" {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(attr.Val))
+		if err != nil || !allowedSchemes[strings.ToLower(u.Scheme)] {
+			break
+		}
+		return `<a href="` + html.EscapeString(u.String()) + `" rel="noopener noreferrer">`
+	}
+	return "<a>"
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderEscapesBody(t *testing.T) {
+	subject, body, err := Render(UserWelcomeTemplate, map[string]any{
+		"Username":      `<script>alert(1)</script>`,
+		"ActivationURL": "javascript:alert(1)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(body, "<script>") {
+		t.Errorf("username was not escaped:\n%s", body)
+	}
+	if strings.Contains(body, `href="javascript:`) {
+		t.Errorf("unsafe URL was not filtered:\n%s", body)
+	}
+	if strings.Contains(subject, "&lt;") || strings.Contains(subject, "&amp;") {
+		t.Errorf("subject should be plain text, got %q", subject)
+	}
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`<p>Hello <b>there</b></p>`, `<p>Hello <b>there</b></p>`},
+		{`<p onclick="x()">hi</p>`, `<p>hi</p>`},
+		{`a<script>alert(1)</script>b`, `ab`},
+		{`<div><img src=x onerror=y>text</div>`, `text`},
+		{`<a href="https://example.com/?a=1&b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2" rel="noopener noreferrer">x</a>`},
+		{`<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`1 < 2 & 3`, `1 &lt; 2 &amp; 3`},
+		{`line<br>break`, `line<br>break`},
+	}
+
+	for _, tt := range tests {
+		if got := string(SanitizeHTML(tt.in)); got != tt.want {
+			t.Errorf("SanitizeHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+// Sender is who an email comes from.
+type Sender struct {
+	// Name is the display name; FromName when empty.
+	Name    string
+	Email   string
+	ReplyTo string
+	// ReturnPath is the SMTP envelope sender, which receives bounces. It
+	// defaults to Email and is ignored by SendGrid, where the bounce address
+	// is an account setting.
+	ReturnPath string
+}
+
+// Senders holds the default sender and per-template overrides, e.g. a
+// "Security" sender for sign-in links.
+type Senders struct {
+	Default   Sender
+	Templates map[string]Sender
+}
+
+// For returns the sender of templateFile. Fields an override leaves empty
+// come from the default.
+func (s Senders) For(templateFile string) Sender {
+	sender := s.Default
+	if override, ok := s.Templates[templateFile]; ok {
+		if override.Name != "" {
+			sender.Name = override.Name
+		}
+		if override.Email != "" {
+			sender.Email = override.Email
+		}
+		if override.ReplyTo != "" {
+			sender.ReplyTo = override.ReplyTo
+		}
+		if override.ReturnPath != "" {
+			sender.ReturnPath = override.ReturnPath
+		}
+	}
+	if sender.Name == "" {
+		sender.Name = FromName
+	}
+	return sender
+}
+
+// ParseSenderOverrides parses per-template senders written as
+// "template=Name <address>" pairs separated by semicolons, for example
+// "magic_link.tmpl=Security <security@example.com>". The address may be
+// left out to change only the name.
+func ParseSenderOverrides(s string) (map[string]Sender, error) {
+	overrides := make(map[string]Sender)
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		templateFile, from, ok := strings.Cut(pair, "=")
+		templateFile, from = strings.TrimSpace(templateFile), strings.TrimSpace(from)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("sender override %q: want template=Name <address>", pair)
+		}
+		if !slices.Contains(knownTemplates, templateFile) {
+			return nil, fmt.Errorf("sender override: unknown template %q", templateFile)
+		}
+
+		if !strings.Contains(from, "@") {
+			overrides[templateFile] = Sender{Name: from}
+			continue
+		}
+		addr, err := mail.ParseAddress(from)
+		if err != nil {
+			return nil, fmt.Errorf("sender override for %s: %w", templateFile, err)
+		}
+		overrides[templateFile] = Sender{Name: addr.Name, Email: addr.Address}
+	}
+	return overrides, nil
+}
+
+// setHeaders sets From and, when configured, Reply-To.
+func (s Sender) setHeaders(message *gomail.Message) {
+	message.SetAddressHeader("From", s.Email, s.Name)
+	if s.ReplyTo != "" {
+		message.SetHeader("Reply-To", s.ReplyTo)
+	}
+}
+
+// envelope makes sender use the return path as the SMTP MAIL FROM address.
+func (s Sender) envelope(sender gomail.Sender) gomail.Sender {
+	if s.ReturnPath == "" {
+		return sender
+	}
+	return gomail.SendFunc(func(_ string, to []string, msg io.WriterTo) error {
+		return sender.Send(s.ReturnPath, to, msg)
+	})
+}
+
+// dialAndSend is gomail's DialAndSend with the sender's envelope address.
+func (s Sender) dialAndSend(dialer *gomail.Dialer, message *gomail.Message) error {
+	conn, err := dialer.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return gomail.Send(s.envelope(conn), message)
+}
+
+// setMessageID gives message a Message-ID in the sender's domain, which
+// SendResult reports so the message can be found in the server's logs.
+func setMessageID(message *gomail.Message, s Sender) {
+	_, domain, ok := strings.Cut(s.Email, "@")
+	if !ok || domain == "" {
+		domain = "localhost"
+	}
+	message.SetHeader("Message-ID", newMessageID(domain))
+}
+
+func newMessageID(domain string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// smtpResult is the SendResult of message once the server accepted it.
+func smtpResult(provider string, message *gomail.Message, email string) SendResult {
+	result := SendResult{Provider: provider, Accepted: []string{email}, SentAt: time.Now()}
+	if id := message.GetHeader("Message-ID"); len(id) > 0 {
+		result.MessageID = id[0]
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+func TestSenders(t *testing.T) {
+	overrides, err := ParseSenderOverrides("magic_link.tmpl=Security <security@example.com>; email_change_confirm.tmpl=Account Team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	senders := Senders{
+		Default:   Sender{Email: "hello@example.com", ReplyTo: "support@example.com", ReturnPath: "bounces@example.com"},
+		Templates: overrides,
+	}
+
+	tests := []struct {
+		template string
+		want     Sender
+	}{
+		{UserWelcomeTemplate, Sender{Name: FromName, Email: "hello@example.com", ReplyTo: "support@example.com", ReturnPath: "bounces@example.com"}},
+		{MagicLinkTemplate, Sender{Name: "Security", Email: "security@example.com", ReplyTo: "support@example.com", ReturnPath: "bounces@example.com"}},
+		{EmailChangeTemplate, Sender{Name: "Account Team", Email: "hello@example.com", ReplyTo: "support@example.com", ReturnPath: "bounces@example.com"}},
+	}
+	for _, tt := range tests {
+		if got := senders.For(tt.template); got != tt.want {
+			t.Errorf("For(%s) = %+v, want %+v", tt.template, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"unknown.tmpl=X <x@example.com>", "magic_link.tmpl", "magic_link.tmpl=<not an address@>"} {
+		if _, err := ParseSenderOverrides(bad); err == nil {
+			t.Errorf("ParseSenderOverrides(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSenderHeadersAndEnvelope(t *testing.T) {
+	sender := Sender{Name: "Security", Email: "security@example.com", ReplyTo: "support@example.com", ReturnPath: "bounces@example.com"}
+
+	message := gomail.NewMessage()
+	sender.setHeaders(message)
+	message.SetHeader("To", "jo@example.com")
+	message.SetBody("text/plain", "hi")
+
+	var from string
+	var raw bytes.Buffer
+	capture := gomail.SendFunc(func(f string, to []string, msg io.WriterTo) error {
+		from = f
+		_, err := msg.WriteTo(&raw)
+		return err
+	})
+	if err := gomail.Send(sender.envelope(capture), message); err != nil {
+		t.Fatal(err)
+	}
+
+	if from != "bounces@example.com" {
+		t.Errorf("envelope sender = %q, want the return path", from)
+	}
+	for _, header := range []string{`From: "Security" <security@example.com>`, "Reply-To: support@example.com"} {
+		if !strings.Contains(raw.String(), header) {
+			t.Errorf("missing %q in\n%s", header, raw.String())
+		}
+	}
+}
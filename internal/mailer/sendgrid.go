@@ -1,54 +1,54 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"text/template"
 	"time"
 
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
 type SendGridMailer struct {
-	fromEmail string
-	apiKey    string
-	client    *sendgrid.Client
+	senders Senders
+	apiKey  string
+	client  *sendgrid.Client
 }
 
-func NewSendgrid(apiKey, fromEmail string) *SendGridMailer {
+func NewSendgrid(apiKey string, senders Senders) *SendGridMailer {
 	client := sendgrid.NewSendClient(apiKey)
 
 	return &SendGridMailer{
-		fromEmail: fromEmail,
-		apiKey:    apiKey,
-		client:    client,
+		senders: senders,
+		apiKey:  apiKey,
+		client:  client,
 	}
 }
 
-func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
-	from := mail.NewEmail(FromName, m.fromEmail)
+func (m *SendGridMailer) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	sender := m.senders.For(templateFile)
+	from := mail.NewEmail(sender.Name, sender.Email)
 	to := mail.NewEmail(username, email)
 
 	// template parsing and building
-	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	msg, err := renderTimed(templateFile, data)
 	if err != nil {
-		return -1, err
+		return SendResult{}, err
 	}
+	msg = msg.track(ctx)
 
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return -1, err
+	message := mail.NewSingleEmail(from, msg.subject, to, msg.text, msg.body)
+	if sender.ReplyTo != "" {
+		message.SetReplyTo(mail.NewEmail("", sender.ReplyTo))
 	}
-
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
-	if err != nil {
-		return -1, err
+	for key, value := range msg.unsubscribeHeaders() {
+		message.SetHeader(key, value)
+	}
+	if v := tracing.Traceparent(ctx); v != "" {
+		message.SetHeader(tracing.TraceparentHeader, v)
 	}
-
-	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
 
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
@@ -58,15 +58,136 @@ func (m *SendGridMailer) Send(templateFile, username, email string, data any, is
 
 	var retryErr error
 	for i := 0; i < maxRetires; i++ {
-		response, retryErr := m.client.Send(message)
+		// each attempt is timed on its own, without the backoff
+		var response *rest.Response
+		retryErr = sendTimed(templateFile, func() error {
+			var err error
+			response, err = m.client.SendWithContext(ctx, message)
+			return err
+		})
 		if retryErr != nil {
 			// exponential backoff
-			time.Sleep(time.Second * time.Duration(i+1))
+			if err := sleepContext(ctx, time.Second*time.Duration(i+1)); err != nil {
+				return SendResult{}, err
+			}
 			continue
 		}
 
+		result := SendResult{Provider: "sendgrid", Accepted: []string{email}, SentAt: time.Now()}
+		if ids := response.Headers["X-Message-Id"]; len(ids) > 0 {
+			result.MessageID = ids[0]
+		}
+		return result, nil
+	}
+
+	return SendResult{}, fmt.Errorf("failed to send email after %d attempt, error: %v", maxRetires, retryErr)
+}
+
+// sendGridMaxPersonalizations is the API limit per request.
+const sendGridMaxPersonalizations = 1000
+
+// SendBatch groups recipients whose rendered message is identical and sends
+// each group as one request with a personalization per recipient, so
+// recipients do not see each other. Messages that differ per recipient are
+// sent in their own request.
+func (m *SendGridMailer) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	messages, results, err := renderBatch(templateFile, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	sender := m.senders.For(templateFile)
+	groups := make(map[renderedMessage][]int)
+	var order []renderedMessage
+	for i, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		if _, ok := groups[*msg]; !ok {
+			order = append(order, *msg)
+		}
+		groups[*msg] = append(groups[*msg], i)
+	}
+
+	for _, msg := range order {
+		indexes := groups[msg]
+		for start := 0; start < len(indexes); start += sendGridMaxPersonalizations {
+			end := min(start+sendGridMaxPersonalizations, len(indexes))
+			chunk := indexes[start:end]
+
+			message := mail.NewV3Mail()
+			message.SetFrom(mail.NewEmail(sender.Name, sender.Email))
+			if sender.ReplyTo != "" {
+				message.SetReplyTo(mail.NewEmail("", sender.ReplyTo))
+			}
+			message.Subject = msg.subject
+			if msg.text != "" {
+				message.AddContent(mail.NewContent("text/plain", msg.text))
+			}
+			message.AddContent(mail.NewContent("text/html", msg.body))
+			for key, value := range msg.unsubscribeHeaders() {
+				message.SetHeader(key, value)
+			}
+			if v := tracing.Traceparent(ctx); v != "" {
+				message.SetHeader(tracing.TraceparentHeader, v)
+			}
+			message.SetMailSettings(&mail.MailSettings{
+				SandboxMode: &mail.Setting{
+					Enable: &isSandbox,
+				},
+			})
+			for _, i := range chunk {
+				p := mail.NewPersonalization()
+				p.AddTos(mail.NewEmail(recipients[i].Username, recipients[i].Email))
+				message.AddPersonalizations(p)
+			}
+
+			status, err := m.sendWithRetry(ctx, templateFile, message)
+			for _, i := range chunk {
+				results[i].Status = status
+				results[i].Err = err
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func (m *SendGridMailer) sendWithRetry(ctx context.Context, templateFile string, message *mail.SGMailV3) (int, error) {
+	var err error
+	for i := 0; i < maxRetires; i++ {
+		var response *rest.Response
+		sendErr := sendTimed(templateFile, func() error {
+			var err error
+			response, err = m.client.SendWithContext(ctx, message)
+			return err
+		})
+		if sendErr != nil {
+			err = sendErr
+			if err := sleepContext(ctx, time.Second*time.Duration(i+1)); err != nil {
+				return -1, err
+			}
+			continue
+		}
+		if response.StatusCode >= 300 {
+			return response.StatusCode, fmt.Errorf("sendgrid returned %d: %s", response.StatusCode, response.Body)
+		}
+
 		return response.StatusCode, nil
 	}
 
-	return -1, fmt.Errorf("failed to send email after %d attempt, error: %v", maxRetires, retryErr)
+	return -1, fmt.Errorf("failed to send email after %d attempt, error: %v", maxRetires, err)
+}
+
+// sleepContext waits for d, returning early with ctx.Err() if ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -1,14 +1,48 @@
 package mailer
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
-	"text/template"
+	"net/smtp"
+	"time"
 
 	gomail "gopkg.in/mail.v2"
 )
 
+const (
+	// DefaultSMTPDialTimeout bounds connecting and each SMTP command.
+	DefaultSMTPDialTimeout = 10 * time.Second
+	// DefaultSMTPSendTimeout bounds a whole Send, from dial to QUIT.
+	DefaultSMTPSendTimeout = 30 * time.Second
+)
+
+// SMTP presets for local capture servers, which accept any mail on
+// localhost:1025 without TLS or authentication and show it in a web UI.
+const (
+	SMTPPresetMailHog = "mailhog"
+	SMTPPresetMailpit = "mailpit"
+)
+
+// SMTPPreset returns the defaults of a named SMTP setup, which explicit
+// settings override. "" is a regular provider; ok is false for unknown
+// names.
+func SMTPPreset(name string) (cfg SMTPConfig, ok bool) {
+	switch name {
+	case "":
+		return SMTPConfig{Port: 587}, true
+	case SMTPPresetMailHog, SMTPPresetMailpit:
+		return SMTPConfig{
+			Host:       "localhost",
+			Port:       1025,
+			AuthMethod: SMTPAuthNone,
+			Encryption: SMTPEncryptionNone,
+			FromEmail:  "noreply@localhost",
+		}, true
+	}
+	return SMTPConfig{}, false
+}
+
 type SMTPConfig struct {
 	Host               string
 	Port               int
@@ -17,16 +51,50 @@ type SMTPConfig struct {
 	FromEmail          string
 	UseTLS             bool
 	InsecureSkipVerify bool
+	// DialTimeout and SendTimeout fall back to the defaults when zero.
+	DialTimeout time.Duration
+	SendTimeout time.Duration
+	// FromName, ReplyTo and ReturnPath complete the default sender, see
+	// Sender; FromOverrides replaces it for some templates.
+	FromName      string
+	ReplyTo       string
+	ReturnPath    string
+	FromOverrides map[string]Sender
+	// AuthMethod is one of the SMTPAuth constants. Username and Password
+	// are required unless it is SMTPAuthNone, which ignores them.
+	AuthMethod string
+	// Encryption is one of the SMTPEncryption constants. TLSPins, from
+	// ParseTLSPins, and CAFile, a PEM bundle replacing the system roots,
+	// further restrict which server certificates are accepted.
+	Encryption string
+	TLSPins    [][]byte
+	CAFile     string
+}
+
+// Senders returns the senders described by the config.
+func (cfg SMTPConfig) Senders() Senders {
+	return Senders{
+		Default: Sender{
+			Name:       cfg.FromName,
+			Email:      cfg.FromEmail,
+			ReplyTo:    cfg.ReplyTo,
+			ReturnPath: cfg.ReturnPath,
+		},
+		Templates: cfg.FromOverrides,
+	}
 }
 
 type smtpClient struct {
-	host               string
-	port               int
-	username           string
-	password           string
-	fromEmail          string
-	useTLS             bool
-	insecureSkipVerify bool
+	host        string
+	port        int
+	username    string
+	password    string
+	auth        smtp.Auth
+	senders     Senders
+	encryption  string
+	tlsConfig   *tls.Config
+	dialTimeout time.Duration
+	sendTimeout time.Duration
 }
 
 func NewSMTPClient(cfg SMTPConfig) (smtpClient, error) {
@@ -36,62 +104,141 @@ func NewSMTPClient(cfg SMTPConfig) (smtpClient, error) {
 	if cfg.Port <= 0 {
 		return smtpClient{}, errors.New("SMTP port is required")
 	}
-	if cfg.Username == "" {
+	if cfg.AuthMethod == SMTPAuthNone {
+		// gomail only authenticates when a username is set
+		cfg.Username, cfg.Password = "", ""
+	} else if cfg.Username == "" {
 		return smtpClient{}, errors.New("SMTP username is required")
-	}
-	if cfg.Password == "" {
+	} else if cfg.Password == "" {
 		return smtpClient{}, errors.New("SMTP password is required")
 	}
 	if cfg.FromEmail == "" {
 		return smtpClient{}, errors.New("FROM_EMAIL is required")
 	}
+	auth, err := smtpAuth(cfg.AuthMethod, cfg.Username, cfg.Password, cfg.Host)
+	if err != nil {
+		return smtpClient{}, err
+	}
+	encryption, err := resolveEncryption(cfg)
+	if err != nil {
+		return smtpClient{}, err
+	}
+	tlsConfig, err := smtpTLSConfig(cfg.Host, cfg.CAFile, cfg.TLSPins, cfg.InsecureSkipVerify)
+	if err != nil {
+		return smtpClient{}, err
+	}
+	if err := PreloadTemplates(); err != nil {
+		return smtpClient{}, err
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultSMTPDialTimeout
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = DefaultSMTPSendTimeout
+	}
 
 	return smtpClient{
-		host:               cfg.Host,
-		port:               cfg.Port,
-		username:           cfg.Username,
-		password:           cfg.Password,
-		fromEmail:          cfg.FromEmail,
-		useTLS:             cfg.UseTLS,
-		insecureSkipVerify: cfg.InsecureSkipVerify,
+		host:        cfg.Host,
+		port:        cfg.Port,
+		username:    cfg.Username,
+		password:    cfg.Password,
+		auth:        auth,
+		senders:     cfg.Senders(),
+		encryption:  encryption,
+		tlsConfig:   tlsConfig,
+		dialTimeout: cfg.DialTimeout,
+		sendTimeout: cfg.SendTimeout,
 	}, nil
 }
 
-func (m smtpClient) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
-	// Template parsing and building
-	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+func (m smtpClient) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	sender, message, err := m.compose(ctx, templateFile, email, data)
 	if err != nil {
-		return -1, err
+		return SendResult{}, err
 	}
 
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return -1, err
+	if err := sendTimed(templateFile, func() error { return m.deliver(ctx, sender, message) }); err != nil {
+		return SendResult{}, err
 	}
 
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
+	return smtpResult("smtp", message, email), nil
+}
+
+// compose renders templateFile into the message Send delivers.
+func (m smtpClient) compose(ctx context.Context, templateFile, email string, data any) (Sender, *gomail.Message, error) {
+	// Template parsing and building
+	msg, err := renderTimed(templateFile, data)
 	if err != nil {
-		return -1, err
+		return Sender{}, nil, err
 	}
+	msg = msg.track(ctx)
 
+	sender := m.senders.For(templateFile)
 	message := gomail.NewMessage()
-	message.SetAddressHeader("From", m.fromEmail, FromName)
+	sender.setHeaders(message)
+	setMessageID(message, sender)
+	setTraceparent(ctx, message)
 	message.SetHeader("To", email)
-	message.SetHeader("Subject", subject.String())
-	message.AddAlternative("text/html", body.String())
+	message.SetHeader("Subject", msg.subject)
+	msg.setUnsubscribe(message)
+	msg.setBody(message)
+
+	return sender, message, nil
+}
+
+// deliver dials the server and sends message, within the send timeout.
+func (m smtpClient) deliver(ctx context.Context, sender Sender, message *gomail.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, m.sendTimeout)
+	defer cancel()
+
+	return withContext(ctx, func() error { return sender.dialAndSend(m.dialer(), message) })
+}
 
+// SendBatch sends every message over one SMTP connection.
+func (m smtpClient) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	return sendBatchSMTP(ctx, m.dialer(), m.senders.For(templateFile), templateFile, recipients)
+}
+
+// Ping connects and authenticates against the SMTP server without sending
+// anything, so configuration problems surface before the first registration.
+func (m smtpClient) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.sendTimeout)
+	defer cancel()
+
+	return withContext(ctx, func() error {
+		conn, err := m.dialer().Dial()
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+func (m smtpClient) dialer() *gomail.Dialer {
 	dialer := gomail.NewDialer(m.host, m.port, m.username, m.password)
-	dialer.SSL = m.useTLS || m.port == 465
-	dialer.TLSConfig = &tls.Config{
-		ServerName:         m.host,
-		InsecureSkipVerify: m.insecureSkipVerify,
-	}
+	dialer.Auth = m.auth
+	dialer.Timeout = m.dialTimeout
+	dialer.TLSConfig = m.tlsConfig
+	setEncryption(dialer, m.encryption)
+
+	return dialer
+}
 
-	if err := dialer.DialAndSend(message); err != nil {
-		return -1, err
+// withContext runs send and returns ctx.Err() as soon as ctx is done.
+// gomail has no context support, so an abandoned send keeps running in the
+// background until the dialer timeout closes it.
+func withContext(ctx context.Context, send func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	return 200, nil
+	done := make(chan error, 1)
+	go func() { done <- send() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SMTP authentication methods for SMTPConfig.AuthMethod.
+const (
+	// SMTPAuthAuto lets the server decide: CRAM-MD5 when offered, else
+	// PLAIN, or LOGIN for servers that only offer that.
+	SMTPAuthAuto = ""
+	// SMTPAuthNone sends without logging in, for capture servers and relays
+	// that trust the network.
+	SMTPAuthNone    = "none"
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+)
+
+// smtpAuth returns the smtp.Auth for method, or nil when gomail should pick
+// one or none is wanted.
+func smtpAuth(method, username, password, host string) (smtp.Auth, error) {
+	switch method {
+	case SMTPAuthAuto, SMTPAuthNone:
+		return nil, nil
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", username, password, host), nil
+	case SMTPAuthLogin:
+		return &loginAuth{username: username, password: password}, nil
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(username, password), nil
+	}
+	return nil, fmt.Errorf("unknown SMTP auth method %q", method)
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp lacks. Like
+// PLAIN it sends the password as is, so it refuses unencrypted connections.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("LOGIN auth needs an encrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); prompt {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
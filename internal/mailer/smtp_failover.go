@@ -0,0 +1,226 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSMTPFailoverCooldown is how long a server that failed is passed
+// over while another one works.
+const DefaultSMTPFailoverCooldown = time.Minute
+
+// SMTPFailover sends through an ordered list of SMTP servers: the first one
+// that has not failed recently, then the next when dialing or sending
+// fails. A failed server is skipped for the cooldown and tried again
+// afterwards; while every server is cooling down they are all tried in
+// order anyway rather than dropping the email.
+type SMTPFailover struct {
+	servers  []*smtpServer
+	cooldown time.Duration
+	now      func() time.Time
+}
+
+type smtpServer struct {
+	client smtpClient
+
+	mu       sync.Mutex
+	failedAt time.Time
+	lastErr  error
+}
+
+// SMTPServerStatus is the state of one server of an SMTPFailover.
+// FailedAt and LastError describe the last failure and are cleared by the
+// next successful send.
+type SMTPServerStatus struct {
+	Addr      string     `json:"addr"`
+	Healthy   bool       `json:"healthy"`
+	FailedAt  *time.Time `json:"failed_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// NewSMTPFailover builds a client for each config, in the order servers are
+// tried. A cooldown of zero uses DefaultSMTPFailoverCooldown.
+func NewSMTPFailover(cfgs []SMTPConfig, cooldown time.Duration) (*SMTPFailover, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("no SMTP servers configured")
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultSMTPFailoverCooldown
+	}
+
+	f := &SMTPFailover{cooldown: cooldown, now: time.Now}
+	for _, cfg := range cfgs {
+		client, err := NewSMTPClient(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("SMTP server %s: %w", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), err)
+		}
+		f.servers = append(f.servers, &smtpServer{client: client})
+	}
+	return f, nil
+}
+
+// ParseSMTPServers parses a comma separated list of host:port pairs, such
+// as SMTP_FAILOVER_HOSTS. Each server gets a copy of base with its own host
+// and port.
+func ParseSMTPServers(s string, base SMTPConfig) ([]SMTPConfig, error) {
+	var cfgs []SMTPConfig
+	for _, addr := range strings.Split(s, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("SMTP server %q: want host:port", addr)
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return nil, fmt.Errorf("SMTP server %q: invalid port", addr)
+		}
+
+		cfg := base
+		cfg.Host, cfg.Port = host, n
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs, nil
+}
+
+func (f *SMTPFailover) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	// every server shares the senders, so the message is rendered once
+	sender, message, err := f.servers[0].client.compose(ctx, templateFile, email, data)
+	if err != nil {
+		return SendResult{}, err
+	}
+
+	err = sendTimed(templateFile, func() error {
+		return f.try(ctx, func(c smtpClient) error {
+			return c.deliver(ctx, sender, message)
+		})
+	})
+	if err != nil {
+		return SendResult{}, err
+	}
+	return smtpResult("smtp", message, email), nil
+}
+
+// SendBatch sends the whole batch over the first server that accepts the
+// connection.
+func (f *SMTPFailover) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	// a broken template would fail on every server
+	if _, err := parseTemplate(templateFile); err != nil {
+		return nil, err
+	}
+
+	var results []BatchResult
+	err := f.try(ctx, func(c smtpClient) error {
+		var err error
+		results, err = c.SendBatch(ctx, templateFile, recipients, isSandbox)
+		return err
+	})
+	return results, err
+}
+
+// Ping checks every server, updating their health, and reports those that
+// cannot be reached.
+func (f *SMTPFailover) Ping(ctx context.Context) error {
+	var errs []error
+	for _, server := range f.servers {
+		err := server.client.Ping(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		server.record(err, f.now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server.addr(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Status reports each server in the order they are tried.
+func (f *SMTPFailover) Status() []SMTPServerStatus {
+	now := f.now()
+	status := make([]SMTPServerStatus, len(f.servers))
+	for i, server := range f.servers {
+		server.mu.Lock()
+		status[i] = SMTPServerStatus{
+			Addr:    server.addr(),
+			Healthy: !server.coolingDown(now, f.cooldown),
+		}
+		if server.lastErr != nil {
+			failedAt := server.failedAt
+			status[i].FailedAt = &failedAt
+			status[i].LastError = server.lastErr.Error()
+		}
+		server.mu.Unlock()
+	}
+	return status
+}
+
+// try runs send against the servers until one succeeds: healthy ones first,
+// in order, then those cooling down. It stops early when ctx is done or the
+// server rejected the message itself, which another server would too.
+func (f *SMTPFailover) try(ctx context.Context, send func(smtpClient) error) error {
+	now := f.now()
+	var healthy, cooling []*smtpServer
+	for _, server := range f.servers {
+		server.mu.Lock()
+		if server.coolingDown(now, f.cooldown) {
+			cooling = append(cooling, server)
+		} else {
+			healthy = append(healthy, server)
+		}
+		server.mu.Unlock()
+	}
+
+	var errs []error
+	for _, server := range append(healthy, cooling...) {
+		err := send(server.client)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if rejectedMessage(err) {
+			return err
+		}
+		server.record(err, f.now())
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", server.addr(), err))
+	}
+	return errors.Join(errs...)
+}
+
+// rejectedMessage reports whether the server refused the message or its
+// recipient for good, rather than failing to take mail at all.
+func rejectedMessage(err error) bool {
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 550 && smtpErr.Code <= 553
+}
+
+func (s *smtpServer) record(err error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.failedAt, s.lastErr = time.Time{}, nil
+		return
+	}
+	s.failedAt, s.lastErr = now, err
+}
+
+// coolingDown must be called with mu held.
+func (s *smtpServer) coolingDown(now time.Time, cooldown time.Duration) bool {
+	return s.lastErr != nil && now.Sub(s.failedAt) < cooldown
+}
+
+func (s *smtpServer) addr() string {
+	return net.JoinHostPort(s.client.host, strconv.Itoa(s.client.port))
+}
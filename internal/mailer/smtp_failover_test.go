@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPFailover(t *testing.T) {
+	// a port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	port, data := fakeSMTPServer(t)
+
+	base, _ := SMTPPreset(SMTPPresetMailHog)
+	cfgs, err := ParseSMTPServers("127.0.0.1:"+strconv.Itoa(downPort)+", 127.0.0.1:"+strconv.Itoa(port), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewSMTPFailover(cfgs, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	vars := map[string]any{"Username": "jo", "ActivationURL": "http://localhost/?token=abc"}
+	if _, err := f.Send(context.Background(), UserWelcomeTemplate, "jo", "jo@example.com", vars, true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-data:
+		if !strings.Contains(body, "To: jo@example.com") {
+			t.Errorf("message not addressed to jo:\n%s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the second server received nothing")
+	}
+
+	status := f.Status()
+	if status[0].Healthy || status[0].FailedAt == nil || status[0].LastError == "" || !status[1].Healthy {
+		t.Fatalf("status after failing over %+v", status)
+	}
+
+	now = now.Add(time.Minute)
+	if status := f.Status(); !status[0].Healthy || status[0].LastError == "" {
+		t.Errorf("status after the cooldown %+v", status)
+	}
+
+	if _, err := ParseSMTPServers("smtp.example.com", base); err == nil {
+		t.Error("expected an error without a port")
+	}
+}
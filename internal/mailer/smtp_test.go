@@ -0,0 +1,193 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPSendTimeout(t *testing.T) {
+	// a server that accepts connections but never sends its greeting
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client, err := NewSMTPClient(SMTPConfig{
+		Host:        "127.0.0.1",
+		Port:        ln.Addr().(*net.TCPAddr).Port,
+		Username:    "user",
+		Password:    "pass",
+		FromEmail:   "from@example.com",
+		SendTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = client.Send(context.Background(), UserWelcomeTemplate, "jo", "jo@example.com", map[string]any{}, true)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("send returned after %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Send(ctx, UserWelcomeTemplate, "jo", "jo@example.com", map[string]any{}, true); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+}
+
+// fakeSMTPServer accepts one message without TLS or AUTH, like MailHog, and
+// returns its DATA section.
+func fakeSMTPServer(t *testing.T) (port int, data <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 fake ESMTP\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				fmt.Fprint(conn, "250-fake\r\n250 8BITMIME\r\n")
+			case cmd == "DATA":
+				fmt.Fprint(conn, "354 go ahead\r\n")
+				var body strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					body.WriteString(line)
+				}
+				received <- body.String()
+				fmt.Fprint(conn, "250 queued\r\n")
+			case cmd == "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSMTPAuthNone(t *testing.T) {
+	port, data := fakeSMTPServer(t)
+
+	cfg, ok := SMTPPreset(SMTPPresetMailHog)
+	if !ok {
+		t.Fatal("mailhog preset missing")
+	}
+	cfg.Port = port
+
+	if _, err := NewSMTPClient(SMTPConfig{Host: cfg.Host, Port: port, FromEmail: cfg.FromEmail}); err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+
+	client, err := NewSMTPClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]any{"Username": "jo", "ActivationURL": "http://localhost/?token=abc"}
+	result, err := client.Send(context.Background(), UserWelcomeTemplate, "jo", "jo@example.com", vars, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(result.MessageID, "@localhost>") || len(result.Accepted) != 1 || result.Provider != "smtp" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	select {
+	case body := <-data:
+		if !strings.Contains(body, "To: jo@example.com") {
+			t.Errorf("message not addressed to jo:\n%s", body)
+		}
+		if !strings.Contains(body, "Message-ID: "+result.MessageID) {
+			t.Errorf("message sent without its ID:\n%s", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing received")
+	}
+}
+
+func TestSMTPAuthMethod(t *testing.T) {
+	base := SMTPConfig{Host: "smtp.example.com", Port: 587, FromEmail: "from@example.com"}
+
+	tests := []struct {
+		method    string
+		username  string
+		wantError bool
+	}{
+		{SMTPAuthAuto, "user", false},
+		{SMTPAuthPlain, "user", false},
+		{SMTPAuthLogin, "user", false},
+		{SMTPAuthCRAMMD5, "user", false},
+		{SMTPAuthNone, "", false},
+		{SMTPAuthLogin, "", true},
+		{"xoauth2", "user", true},
+	}
+	for _, tt := range tests {
+		cfg := base
+		cfg.AuthMethod, cfg.Username, cfg.Password = tt.method, tt.username, "pass"
+		if _, err := NewSMTPClient(cfg); (err != nil) != tt.wantError {
+			t.Errorf("%q with username %q: got error %v", tt.method, tt.username, err)
+		}
+	}
+}
+
+func TestLoginAuth(t *testing.T) {
+	a := &loginAuth{username: "user", password: "pass"}
+
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: false}); err == nil {
+		t.Error("expected LOGIN to refuse an unencrypted connection")
+	}
+	if mech, _, err := a.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true}); err != nil || mech != "LOGIN" {
+		t.Fatalf("got %q, %v", mech, err)
+	}
+
+	for challenge, want := range map[string]string{"Username:": "user", "password:": "pass"} {
+		got, err := a.Next([]byte(challenge), true)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v", challenge, got, err)
+		}
+	}
+	if _, err := a.Next([]byte("Token:"), true); err == nil {
+		t.Error("expected an error for an unknown challenge")
+	}
+}
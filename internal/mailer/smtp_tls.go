@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+// SMTP encryption modes for SMTPConfig.Encryption.
+const (
+	// SMTPEncryptionAuto is implicit TLS on port 465 or with UseTLS, and
+	// opportunistic STARTTLS otherwise.
+	SMTPEncryptionAuto = ""
+	// SMTPEncryptionNone sends in plain text even when the server offers
+	// STARTTLS.
+	SMTPEncryptionNone = "none"
+	// SMTPEncryptionStartTLS upgrades with STARTTLS when the server offers
+	// it and sends in plain text when it does not.
+	SMTPEncryptionStartTLS = "starttls-opportunistic"
+	// SMTPEncryptionStartTLSRequired fails when the server does not offer
+	// STARTTLS.
+	SMTPEncryptionStartTLSRequired = "starttls-required"
+	// SMTPEncryptionImplicitTLS speaks TLS from the first byte, usually on
+	// port 465.
+	SMTPEncryptionImplicitTLS = "implicit-tls"
+)
+
+// resolveEncryption turns SMTPEncryptionAuto into the mode it stands for
+// and rejects unknown modes.
+func resolveEncryption(cfg SMTPConfig) (string, error) {
+	switch cfg.Encryption {
+	case SMTPEncryptionAuto:
+		if cfg.UseTLS || cfg.Port == 465 {
+			return SMTPEncryptionImplicitTLS, nil
+		}
+		return SMTPEncryptionStartTLS, nil
+	case SMTPEncryptionNone, SMTPEncryptionStartTLS, SMTPEncryptionStartTLSRequired, SMTPEncryptionImplicitTLS:
+		return cfg.Encryption, nil
+	}
+	return "", fmt.Errorf("unknown SMTP encryption %q", cfg.Encryption)
+}
+
+// setEncryption configures dialer for mode.
+func setEncryption(dialer *gomail.Dialer, mode string) {
+	dialer.SSL = mode == SMTPEncryptionImplicitTLS
+	switch mode {
+	case SMTPEncryptionNone:
+		dialer.StartTLSPolicy = gomail.NoStartTLS
+	case SMTPEncryptionStartTLSRequired:
+		dialer.StartTLSPolicy = gomail.MandatoryStartTLS
+	default:
+		dialer.StartTLSPolicy = gomail.OpportunisticStartTLS
+	}
+}
+
+// ParseTLSPins parses a comma separated list of base64 SHA-256 hashes of
+// server public keys (SubjectPublicKeyInfo), optionally prefixed with
+// sha256/, as used by HPKP and curl's --pinnedpubkey.
+func ParseTLSPins(s string) ([][]byte, error) {
+	var pins [][]byte
+	for _, pin := range strings.Split(s, ",") {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+		if pin == "" {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid TLS pin %q: want a base64 SHA-256 hash", pin)
+		}
+		pins = append(pins, digest)
+	}
+	return pins, nil
+}
+
+// smtpTLSConfig verifies the server against the system roots, or those in
+// caFile, and with pins also requires one of them to match the public key
+// of the server's certificate. Pins still apply with insecureSkipVerify,
+// which makes pinning a self-signed certificate possible.
+func smtpTLSConfig(host, caFile string, pins [][]byte, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("SMTP CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("SMTP CA file %s: no certificates", caFile)
+		}
+		cfg.RootCAs = roots
+	}
+
+	if len(pins) > 0 {
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("SMTP server sent no certificate")
+			}
+			digest := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(pin, digest[:]) {
+					return nil
+				}
+			}
+			return fmt.Errorf("SMTP server key sha256/%s matches no pin", base64.StdEncoding.EncodeToString(digest[:]))
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+func TestResolveEncryption(t *testing.T) {
+	tests := []struct {
+		cfg  SMTPConfig
+		want string
+	}{
+		{SMTPConfig{Port: 587}, SMTPEncryptionStartTLS},
+		{SMTPConfig{Port: 465}, SMTPEncryptionImplicitTLS},
+		{SMTPConfig{Port: 2525, UseTLS: true}, SMTPEncryptionImplicitTLS},
+		{SMTPConfig{Port: 465, Encryption: SMTPEncryptionStartTLSRequired}, SMTPEncryptionStartTLSRequired},
+		{SMTPConfig{Port: 1025, Encryption: SMTPEncryptionNone}, SMTPEncryptionNone},
+	}
+	for _, tt := range tests {
+		got, err := resolveEncryption(tt.cfg)
+		if err != nil || got != tt.want {
+			t.Errorf("%+v: got %q, %v, want %q", tt.cfg, got, err, tt.want)
+		}
+	}
+
+	if _, err := resolveEncryption(SMTPConfig{Encryption: "ssl"}); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestSMTPStartTLSRequired(t *testing.T) {
+	// the fake server does not offer STARTTLS
+	port, _ := fakeSMTPServer(t)
+
+	client, err := NewSMTPClient(SMTPConfig{
+		Host:       "127.0.0.1",
+		Port:       port,
+		FromEmail:  "from@example.com",
+		AuthMethod: SMTPAuthNone,
+		Encryption: SMTPEncryptionStartTLSRequired,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var unsupported gomail.StartTLSUnsupportedError
+	if err := client.Ping(context.Background()); !errors.As(err, &unsupported) {
+		t.Fatalf("expected the missing STARTTLS to fail, got %v", err)
+	}
+}
+
+func TestSMTPTLSPins(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	cert := srv.Certificate()
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	pins, err := ParseTLSPins(" sha256/" + base64.StdEncoding.EncodeToString(digest[:]) + ",")
+	if err != nil || len(pins) != 1 {
+		t.Fatalf("got %d pins, %v", len(pins), err)
+	}
+	cfg, err := smtpTLSConfig("smtp.example.com", "", pins, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.VerifyConnection(state); err != nil {
+		t.Errorf("matching pin rejected: %v", err)
+	}
+
+	other := sha256.Sum256([]byte("another key"))
+	cfg, err = smtpTLSConfig("smtp.example.com", "", [][]byte{other[:]}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.VerifyConnection(state); err == nil {
+		t.Error("expected a mismatched pin to be rejected")
+	}
+
+	if _, err := ParseTLSPins("not-base64"); err == nil {
+		t.Error("expected an error for an invalid pin")
+	}
+}
@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSuppressed is returned for a recipient on the suppression list. The
+// message was not sent and must not be retried.
+var ErrSuppressed = errors.New("recipient is suppressed")
+
+// SuppressionList reports addresses that must not be emailed, because they
+// bounced, complained or unsubscribed. An unsubscribe only suppresses mail
+// that is not transactional.
+type SuppressionList interface {
+	IsSuppressed(ctx context.Context, email string, transactional bool) (bool, error)
+}
+
+type suppressingClient struct {
+	Client
+	list SuppressionList
+}
+
+// WithSuppression wraps client so that nothing is sent to an address on
+// list. If the list cannot be checked the send fails rather than risking
+// mail to a suppressed address.
+func WithSuppression(client Client, list SuppressionList) Client {
+	return &suppressingClient{Client: client, list: list}
+}
+
+func (c *suppressingClient) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	suppressed, err := c.list.IsSuppressed(ctx, email, IsTransactional(templateFile))
+	if err != nil {
+		return SendResult{}, err
+	}
+	if suppressed {
+		return SendResult{}, ErrSuppressed
+	}
+	return c.Client.Send(ctx, templateFile, username, email, data, isSandbox)
+}
+
+// SendBatch sends to the recipients that are not suppressed; the others get
+// ErrSuppressed in their result.
+func (c *suppressingClient) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	transactional := IsTransactional(templateFile)
+	results := make([]BatchResult, len(recipients))
+	var allowed []Recipient
+	var allowedIndex []int
+	for i, recipient := range recipients {
+		suppressed, err := c.list.IsSuppressed(ctx, recipient.Email, transactional)
+		if err != nil {
+			return nil, err
+		}
+		if suppressed {
+			results[i] = BatchResult{Email: recipient.Email, Status: -1, Err: ErrSuppressed}
+			continue
+		}
+		allowed = append(allowed, recipient)
+		allowedIndex = append(allowedIndex, i)
+	}
+
+	if len(allowed) == 0 {
+		return results, nil
+	}
+
+	sent, err := c.Client.SendBatch(ctx, templateFile, allowed, isSandbox)
+	if err != nil {
+		return nil, err
+	}
+	for j, result := range sent {
+		results[allowedIndex[j]] = result
+	}
+	return results, nil
+}
+
+// IsTransactional reports whether templateFile is transactional mail, such
+// as activation or sign-in links. Templates that define the "unsubscribe"
+// block are not, and are sent with List-Unsubscribe headers. A template that
+// cannot be parsed counts as transactional; sending it fails anyway.
+func IsTransactional(templateFile string) bool {
+	tmpl, err := parseTemplate(templateFile)
+	if err != nil {
+		return true
+	}
+	return tmpl.subject.Lookup("unsubscribe") == nil
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type suppressionSet map[string]bool
+
+func (s suppressionSet) IsSuppressed(ctx context.Context, email string, transactional bool) (bool, error) {
+	return s[strings.ToLower(email)], nil
+}
+
+func TestWithSuppression(t *testing.T) {
+	capture := NewCaptureClient(10)
+	client := WithSuppression(capture, suppressionSet{"bounced@example.com": true})
+	data := map[string]any{"Username": "x", "ActivationURL": "https://example.com/confirm"}
+
+	t.Run("skips a suppressed address", func(t *testing.T) {
+		if _, err := client.Send(context.Background(), UserWelcomeTemplate, "x", "Bounced@example.com", data, false); !errors.Is(err, ErrSuppressed) {
+			t.Fatalf("err = %v, want ErrSuppressed", err)
+		}
+		if n := len(capture.Messages()); n != 0 {
+			t.Fatalf("sent %d messages, want 0", n)
+		}
+	})
+
+	t.Run("filters batch recipients", func(t *testing.T) {
+		results, err := client.SendBatch(context.Background(), UserWelcomeTemplate, []Recipient{
+			{Username: "a", Email: "bounced@example.com", Data: data},
+			{Username: "b", Email: "ok@example.com", Data: data},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(results[0].Err, ErrSuppressed) || results[1].Err != nil || results[1].Email != "ok@example.com" {
+			t.Fatalf("unexpected results %+v", results)
+		}
+		messages := capture.Messages()
+		if len(messages) != 1 || messages[0].Email != "ok@example.com" {
+			t.Fatalf("unexpected messages %+v", messages)
+		}
+	})
+}
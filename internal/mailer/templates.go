@@ -0,0 +1,255 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// mailTemplate is one template file parsed twice: the "subject" block as
+// plain text and the "body" block as HTML, so values such as Username are
+// escaped for the context they appear in and cannot inject markup.
+type mailTemplate struct {
+	subject *texttemplate.Template
+	body    *htmltemplate.Template
+}
+
+// templateFuncs are available in every template. Rich content that is meant
+// to keep its formatting must go through sanitize; anything else is escaped.
+var templateFuncs = map[string]any{
+	"sanitize": SanitizeHTML,
+}
+
+func parseMailTemplate(fsys fs.FS, file string) (*mailTemplate, error) {
+	subject, err := texttemplate.New(file).Funcs(templateFuncs).ParseFS(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	body, err := htmltemplate.New(file).Funcs(templateFuncs).ParseFS(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, block := range []string{"subject", "body"} {
+		if subject.Lookup(block) == nil {
+			return nil, fmt.Errorf("missing %q block", block)
+		}
+	}
+
+	return &mailTemplate{subject: subject, body: body}, nil
+}
+
+// templateSet holds the parsed templates of one source. The active set is
+// swapped as a whole, so a broken edit on disk never replaces templates that
+// are already working.
+type templateSet struct {
+	fsys   fs.FS
+	parsed map[string]*mailTemplate
+	// complete is set once every template in fsys has been parsed and checked
+	complete bool
+}
+
+// knownTemplates are the templates the application sends; a template source
+// missing one of them is rejected.
+var knownTemplates = []string{
+	UserWelcomeTemplate,
+	AccountReadyTemplate,
+	ComplaintResolvedTemplate,
+	EmailChangeTemplate,
+	MagicLinkTemplate,
+	MentionTemplate,
+	OperatorAlertTemplate,
+	RegistrationAttemptTemplate,
+	NewSignInTemplate,
+	TeamInvitationTemplate,
+	AnnouncementTemplate,
+}
+
+var (
+	templatesMu sync.RWMutex
+	templates   = mustEmbeddedTemplates()
+)
+
+func mustEmbeddedTemplates() *templateSet {
+	fsys, err := fs.Sub(FS, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return &templateSet{fsys: fsys, parsed: make(map[string]*mailTemplate)}
+}
+
+// loadTemplateSet parses every template in fsys and checks that each defines
+// the "subject" and "body" blocks used by the clients.
+func loadTemplateSet(fsys fs.FS) (*templateSet, error) {
+	files, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates found")
+	}
+
+	set := &templateSet{fsys: fsys, parsed: make(map[string]*mailTemplate, len(files)), complete: true}
+	for _, file := range files {
+		tmpl, err := parseMailTemplate(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		set.parsed[file] = tmpl
+	}
+
+	for _, name := range knownTemplates {
+		if _, ok := set.parsed[name]; !ok {
+			return nil, fmt.Errorf("%s: template not found", name)
+		}
+	}
+
+	return set, nil
+}
+
+// PreloadTemplates parses and checks every template of the current source
+// once, so that a malformed template fails at startup rather than on the
+// first send. It is a no-op when the templates are already loaded.
+func PreloadTemplates() error {
+	set := activeTemplates()
+	if set.complete {
+		return nil
+	}
+
+	loaded, err := loadTemplateSet(set.fsys)
+	if err != nil {
+		return err
+	}
+
+	templatesMu.Lock()
+	if templates == set {
+		templates = loaded
+	}
+	templatesMu.Unlock()
+
+	return nil
+}
+
+func activeTemplates() *templateSet {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	return templates
+}
+
+// LocalizedTemplate returns the translation of templateFile for locale, such
+// as user_invitation.ru.tmpl, or templateFile when there is none.
+// Translations are optional and may cover only some templates.
+func LocalizedTemplate(templateFile, locale string) string {
+	if locale == "" {
+		return templateFile
+	}
+	localized := strings.TrimSuffix(templateFile, ".tmpl") + "." + locale + ".tmpl"
+	if _, err := fs.Stat(activeTemplates().fsys, localized); err != nil {
+		return templateFile
+	}
+	return localized
+}
+
+// parseTemplate returns the cached template, parsing it on first use if the
+// templates were not preloaded. A translation that is gone, because the
+// template directory changed after the email was queued, falls back to the
+// template it translates.
+func parseTemplate(templateFile string) (*mailTemplate, error) {
+	set := activeTemplates()
+
+	templatesMu.RLock()
+	tmpl, ok := set.parsed[templateFile]
+	templatesMu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	name := strings.TrimSuffix(templateFile, ".tmpl")
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		if _, err := fs.Stat(set.fsys, templateFile); errors.Is(err, fs.ErrNotExist) {
+			return parseTemplate(name[:i] + ".tmpl")
+		}
+	}
+
+	tmpl, err := parseMailTemplate(set.fsys, templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	templatesMu.Lock()
+	set.parsed[templateFile] = tmpl
+	templatesMu.Unlock()
+
+	return tmpl, nil
+}
+
+// LoadTemplateDir makes every client read templates from dir instead of the
+// embedded copies. All templates are parsed up front; on error the current
+// templates stay in use.
+func LoadTemplateDir(dir string) error {
+	set, err := loadTemplateSet(os.DirFS(dir))
+	if err != nil {
+		return fmt.Errorf("templates in %s: %w", dir, err)
+	}
+
+	templatesMu.Lock()
+	templates = set
+	templatesMu.Unlock()
+
+	return nil
+}
+
+// WatchTemplateDir reloads the templates in dir whenever a file is added,
+// removed or modified, checking every interval until ctx is done. onReload
+// is called after each attempt with the error, if any; a failed reload keeps
+// the previous templates.
+func WatchTemplateDir(ctx context.Context, dir string, interval time.Duration, onReload func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, _ := templateDirState(dir)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			state, err := templateDirState(dir)
+			if err != nil {
+				onReload(err)
+				continue
+			}
+			if state == last {
+				continue
+			}
+			last = state
+			onReload(LoadTemplateDir(dir))
+		}
+	}
+}
+
+// templateDirState summarises names, sizes and modification times of the
+// templates in dir so that any change yields a different value.
+func templateDirState(dir string) (string, error) {
+	entries, err := fs.Glob(os.DirFS(dir), "*.tmpl")
+	if err != nil {
+		return "", err
+	}
+
+	var state string
+	for _, name := range entries {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		state += fmt.Sprintf("%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return state, nil
+}
@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sends are timed in two phases per template: rendering, which parses and
+// executes the template, and sending, which hands the message to the
+// provider. A slow send can so be traced to the template or the mail
+// server. Batches are timed per rendered message and per provider request.
+
+// TimingBuckets are the upper bounds, in seconds, of the timing histograms.
+var TimingBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram counts durations into TimingBuckets.
+type Histogram struct {
+	// Counts holds the observations up to each bucket's bound, cumulative
+	// like a Prometheus histogram; Count includes the ones over the last
+	Counts []uint64
+	Count  uint64
+	// Sum is in seconds
+	Sum float64
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(TimingBuckets))
+	}
+	seconds := d.Seconds()
+	for i, bound := range TimingBuckets {
+		if seconds <= bound {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += seconds
+}
+
+// TemplateTimings are the phase timings of one template since start.
+// Failed phases are timed as well as counted.
+type TemplateTimings struct {
+	Template     string
+	Render       Histogram
+	Send         Histogram
+	RenderErrors uint64
+	SendErrors   uint64
+}
+
+var timings = struct {
+	sync.Mutex
+	byTemplate map[string]*TemplateTimings
+}{byTemplate: make(map[string]*TemplateTimings)}
+
+// Timings returns the timings of every template sent so far, by name.
+func Timings() []TemplateTimings {
+	timings.Lock()
+	defer timings.Unlock()
+
+	out := make([]TemplateTimings, 0, len(timings.byTemplate))
+	for _, t := range timings.byTemplate {
+		copied := *t
+		copied.Render.Counts = append([]uint64(nil), t.Render.Counts...)
+		copied.Send.Counts = append([]uint64(nil), t.Send.Counts...)
+		out = append(out, copied)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Template < out[j].Template })
+	return out
+}
+
+// timed runs phase of sending templateFile and records how long it took.
+func timed(templateFile string, send bool, phase func() error) error {
+	start := time.Now()
+	err := phase()
+	took := time.Since(start)
+
+	timings.Lock()
+	defer timings.Unlock()
+	t, ok := timings.byTemplate[templateFile]
+	if !ok {
+		t = &TemplateTimings{Template: templateFile}
+		timings.byTemplate[templateFile] = t
+	}
+	switch {
+	case send:
+		t.Send.observe(took)
+		if err != nil {
+			t.SendErrors++
+		}
+	default:
+		t.Render.observe(took)
+		if err != nil {
+			t.RenderErrors++
+		}
+	}
+	return err
+}
+
+// renderTimed parses and renders templateFile for one message.
+func renderTimed(templateFile string, data any) (renderedMessage, error) {
+	var msg renderedMessage
+	err := timed(templateFile, false, func() error {
+		tmpl, err := parseTemplate(templateFile)
+		if err != nil {
+			return err
+		}
+		msg, err = render(tmpl, data)
+		return err
+	})
+	return msg, err
+}
+
+// sendTimed hands a rendered message of templateFile to the provider.
+func sendTimed(templateFile string, send func() error) error {
+	return timed(templateFile, true, send)
+}
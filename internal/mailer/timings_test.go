@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// timingsDelta returns how much the timings of templateFile grew since
+// before; the timings are kept for the whole process.
+func timingsDelta(before []TemplateTimings, templateFile string) TemplateTimings {
+	find := func(all []TemplateTimings) TemplateTimings {
+		for _, t := range all {
+			if t.Template == templateFile {
+				return t
+			}
+		}
+		return TemplateTimings{Render: Histogram{Counts: make([]uint64, len(TimingBuckets))}, Send: Histogram{Counts: make([]uint64, len(TimingBuckets))}}
+	}
+	old, cur := find(before), find(Timings())
+	delta := func(old, cur Histogram) Histogram {
+		h := Histogram{Count: cur.Count - old.Count, Sum: cur.Sum - old.Sum}
+		for i := range cur.Counts {
+			var prev uint64
+			if i < len(old.Counts) {
+				prev = old.Counts[i]
+			}
+			h.Counts = append(h.Counts, cur.Counts[i]-prev)
+		}
+		return h
+	}
+	return TemplateTimings{
+		Template:     templateFile,
+		Render:       delta(old.Render, cur.Render),
+		Send:         delta(old.Send, cur.Send),
+		RenderErrors: cur.RenderErrors - old.RenderErrors,
+		SendErrors:   cur.SendErrors - old.SendErrors,
+	}
+}
+
+func TestTimings(t *testing.T) {
+	before := Timings()
+
+	client := NewCaptureClient(10)
+	if _, err := client.Send(context.Background(), UserWelcomeTemplate, "jo", "jo@example.com", map[string]any{"Username": "jo", "ActivationURL": "http://x"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Send(context.Background(), "missing.tmpl", "jo", "jo@example.com", nil, false); err == nil {
+		t.Fatal("missing template rendered")
+	}
+	if got := timingsDelta(before, UserWelcomeTemplate); got.Render.Count != 1 || got.RenderErrors != 0 || got.Send.Count != 0 {
+		t.Errorf("%s: %+v", UserWelcomeTemplate, got)
+	}
+	if got := timingsDelta(before, "missing.tmpl"); got.Render.Count != 1 || got.RenderErrors != 1 {
+		t.Errorf("missing.tmpl: %+v", got)
+	}
+
+	sendTimed("slow.tmpl", func() error { time.Sleep(3 * time.Millisecond); return nil })
+	sendTimed("slow.tmpl", func() error { return errors.New("421 try later") })
+	got := timingsDelta(before, "slow.tmpl")
+	if got.Send.Count != 2 || got.SendErrors != 1 || got.Send.Sum < 0.003 {
+		t.Fatalf("slow.tmpl: %+v", got)
+	}
+	// the failed attempt is in every bucket, the slow one from 0.005 on
+	if got.Send.Counts[0] != 1 || got.Send.Counts[1] != 1 || got.Send.Counts[len(TimingBuckets)-1] != 2 {
+		t.Errorf("buckets %v", got.Send.Counts)
+	}
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	gomail "gopkg.in/mail.v2"
+)
+
+type tracingClient struct {
+	Client
+	provider string
+}
+
+// WithTracing wraps client so that every send gets a client span named
+// after provider. The clients copy the span's trace context into the
+// Traceparent header of the messages they send.
+func WithTracing(client Client, provider string) Client {
+	return &tracingClient{Client: client, provider: provider}
+}
+
+func (c *tracingClient) Send(ctx context.Context, templateFile, username, email string, data any, isSandbox bool) (SendResult, error) {
+	ctx, span := tracing.Start(ctx, "mail.send", tracing.KindClient,
+		tracing.String("mail.provider", c.provider),
+		tracing.String("mail.template", templateFile),
+	)
+	defer span.End()
+
+	result, err := c.Client.Send(ctx, templateFile, username, email, data, isSandbox)
+	if result.MessageID != "" {
+		span.SetAttributes(tracing.String("mail.message_id", result.MessageID))
+	}
+	span.RecordError(err)
+	return result, err
+}
+
+func (c *tracingClient) SendBatch(ctx context.Context, templateFile string, recipients []Recipient, isSandbox bool) ([]BatchResult, error) {
+	ctx, span := tracing.Start(ctx, "mail.send_batch", tracing.KindClient,
+		tracing.String("mail.provider", c.provider),
+		tracing.String("mail.template", templateFile),
+		tracing.Int("mail.recipients", len(recipients)),
+	)
+	defer span.End()
+
+	results, err := c.Client.SendBatch(ctx, templateFile, recipients, isSandbox)
+	span.RecordError(err)
+	return results, err
+}
+
+// setTraceparent lets the receiving side, and provider webhooks that echo
+// headers, tie a message to the trace that sent it.
+func setTraceparent(ctx context.Context, message *gomail.Message) {
+	if v := tracing.Traceparent(ctx); v != "" {
+		message.SetHeader(tracing.TraceparentHeader, v)
+	}
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Tracking counts the opens and clicks of one message. The clients route
+// every http(s) link of the HTML body, except the unsubscribe link, through
+// ClickURL and load a 1x1 image from OpenURL at the end of the body. The
+// plain text part is left alone.
+type Tracking struct {
+	OpenURL  string
+	ClickURL func(link string) string
+}
+
+type trackingKey struct{}
+
+// WithTracking has the message sent with ctx tracked by t.
+func WithTracking(ctx context.Context, t Tracking) context.Context {
+	return context.WithValue(ctx, trackingKey{}, t)
+}
+
+func trackingFrom(ctx context.Context) (Tracking, bool) {
+	t, ok := ctx.Value(trackingKey{}).(Tracking)
+	return t, ok
+}
+
+var trackedLink = regexp.MustCompile(`(?i)(<a\s[^>]*?href\s*=\s*")(https?://[^"]+)(")`)
+
+// track rewrites the body for the tracking set on ctx, if any.
+func (msg renderedMessage) track(ctx context.Context) renderedMessage {
+	t, ok := trackingFrom(ctx)
+	if !ok {
+		return msg
+	}
+
+	if t.ClickURL != nil {
+		msg.body = trackedLink.ReplaceAllStringFunc(msg.body, func(a string) string {
+			m := trackedLink.FindStringSubmatch(a)
+			link := html.UnescapeString(m[2])
+			if link == msg.unsubscribe {
+				return a
+			}
+			return m[1] + html.EscapeString(t.ClickURL(link)) + m[3]
+		})
+	}
+
+	if t.OpenURL != "" {
+		pixel := `<img src="` + html.EscapeString(t.OpenURL) + `" width="1" height="1" alt="" style="display:none">`
+		if i := strings.LastIndex(strings.ToLower(msg.body), "</body>"); i >= 0 {
+			msg.body = msg.body[:i] + pixel + msg.body[i:]
+		} else {
+			msg.body += pixel
+		}
+	}
+	return msg
+}
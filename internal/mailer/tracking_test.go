@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTrack(t *testing.T) {
+	msg := renderedMessage{
+		body:        `<html><body><a class="btn" href="https://example.com/a?x=1&amp;y=2">A</a> <a href="mailto:jo@example.com">mail</a> <a href="https://example.com/unsub">Unsubscribe</a></BODY></html>`,
+		unsubscribe: "https://example.com/unsub",
+	}
+
+	if got := msg.track(context.Background()); got != msg {
+		t.Fatalf("untracked message changed: %q", got.body)
+	}
+
+	var clicked []string
+	ctx := WithTracking(context.Background(), Tracking{
+		OpenURL: "https://t.example.com/open/1",
+		ClickURL: func(link string) string {
+			clicked = append(clicked, link)
+			return "https://t.example.com/click/1?n=1&m=2"
+		},
+	})
+
+	want := `<html><body><a class="btn" href="https://t.example.com/click/1?n=1&amp;m=2">A</a> <a href="mailto:jo@example.com">mail</a> <a href="https://example.com/unsub">Unsubscribe</a>` +
+		`<img src="https://t.example.com/open/1" width="1" height="1" alt="" style="display:none"></BODY></html>`
+	if got := msg.track(ctx).body; got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if len(clicked) != 1 || clicked[0] != "https://example.com/a?x=1&y=2" {
+		t.Errorf("rewrote %q", clicked)
+	}
+}
@@ -0,0 +1,331 @@
+package mailer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Kinds of DeliveryEvent.
+const (
+	DeliveryBounce    = "bounce"
+	DeliveryComplaint = "complaint"
+)
+
+// ErrInvalidSignature is returned when a webhook payload is not signed by
+// the provider.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// DeliveryEvent is a permanent delivery failure or spam complaint reported
+// by a mail provider. Soft bounces and other events are not reported.
+type DeliveryEvent struct {
+	Email  string
+	Kind   string
+	Reason string
+}
+
+// ParseSendGridEvents verifies a SendGrid Event Webhook request signed with
+// the key pair whose base64 public key is publicKey, and returns its hard
+// bounces and spam reports.
+func ParseSendGridEvents(publicKey string, payload []byte, signature, timestamp string) ([]DeliveryEvent, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("sendgrid public key: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("sendgrid public key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("sendgrid public key: not an ECDSA key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	hash := sha256.Sum256(append([]byte(timestamp), payload...))
+	if !ecdsa.VerifyASN1(key, hash[:], sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	var events []struct {
+		Email  string `json:"email"`
+		Event  string `json:"event"`
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(payload, &events); err != nil {
+		return nil, err
+	}
+
+	var out []DeliveryEvent
+	for _, e := range events {
+		switch {
+		case e.Event == "bounce" && e.Type != "blocked":
+			out = append(out, DeliveryEvent{Email: e.Email, Kind: DeliveryBounce, Reason: e.Reason})
+		case e.Event == "spamreport":
+			out = append(out, DeliveryEvent{Email: e.Email, Kind: DeliveryComplaint})
+		}
+	}
+	return out, nil
+}
+
+// ParseMailgunEvent verifies a Mailgun webhook request with the account's
+// webhook signing key and returns the event if it is a permanent failure or
+// a complaint.
+func ParseMailgunEvent(signingKey string, payload []byte) ([]DeliveryEvent, error) {
+	var body struct {
+		Signature struct {
+			Timestamp string `json:"timestamp"`
+			Token     string `json:"token"`
+			Signature string `json:"signature"`
+		} `json:"signature"`
+		EventData struct {
+			Event          string `json:"event"`
+			Severity       string `json:"severity"`
+			Recipient      string `json:"recipient"`
+			Reason         string `json:"reason"`
+			DeliveryStatus struct {
+				Description string `json:"description"`
+			} `json:"delivery-status"`
+		} `json:"event-data"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(body.Signature.Timestamp + body.Signature.Token))
+	want := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(body.Signature.Signature)) {
+		return nil, ErrInvalidSignature
+	}
+
+	e := body.EventData
+	switch {
+	case e.Event == "failed" && e.Severity == "permanent":
+		reason := e.DeliveryStatus.Description
+		if reason == "" {
+			reason = e.Reason
+		}
+		return []DeliveryEvent{{Email: e.Recipient, Kind: DeliveryBounce, Reason: reason}}, nil
+	case e.Event == "complained":
+		return []DeliveryEvent{{Email: e.Recipient, Kind: DeliveryComplaint}}, nil
+	}
+	return nil, nil
+}
+
+// snsCertHost limits where SNS signing certificates and subscription
+// confirmations may be fetched from.
+var snsCertHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SNSVerifier checks Amazon SNS messages carrying SES notifications.
+// Signing certificates are fetched once per URL and cached.
+type SNSVerifier struct {
+	// TopicARN is the only topic whose messages are accepted.
+	TopicARN string
+	Client   *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+func NewSNSVerifier(topicARN string) *SNSVerifier {
+	return &SNSVerifier{
+		TopicARN: topicARN,
+		Client:   &http.Client{Timeout: 5 * time.Second},
+		certs:    make(map[string]*x509.Certificate),
+	}
+}
+
+type snsMessage struct {
+	Type             string
+	MessageId        string
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	SubscribeURL     string
+}
+
+// ParseSESEvents verifies an SNS message and returns the permanent bounces
+// and complaints of the SES notification it carries. Subscription
+// confirmations are confirmed and yield no events.
+func (v *SNSVerifier) ParseSESEvents(ctx context.Context, payload []byte) ([]DeliveryEvent, error) {
+	var msg snsMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+	if msg.TopicArn != v.TopicARN {
+		return nil, ErrInvalidSignature
+	}
+	if err := v.verify(ctx, &msg); err != nil {
+		return nil, err
+	}
+
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		return nil, v.get(ctx, msg.SubscribeURL, nil)
+	case "Notification":
+		return parseSESNotification(msg.Message)
+	}
+	return nil, nil
+}
+
+func (v *SNSVerifier) verify(ctx context.Context, msg *snsMessage) error {
+	var fields []string
+	switch msg.Type {
+	case "Notification":
+		fields = []string{"Message", msg.Message, "MessageId", msg.MessageId}
+		if msg.Subject != "" {
+			fields = append(fields, "Subject", msg.Subject)
+		}
+		fields = append(fields, "Timestamp", msg.Timestamp, "TopicArn", msg.TopicArn, "Type", msg.Type)
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = []string{"Message", msg.Message, "MessageId", msg.MessageId, "SubscribeURL", msg.SubscribeURL,
+			"Timestamp", msg.Timestamp, "Token", msg.Token, "TopicArn", msg.TopicArn, "Type", msg.Type}
+	default:
+		return ErrInvalidSignature
+	}
+
+	var signed []byte
+	for _, field := range fields {
+		signed = append(signed, field...)
+		signed = append(signed, '\n')
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch msg.SignatureVersion {
+	case "1":
+		algorithm = x509.SHA1WithRSA
+	case "2":
+		algorithm = x509.SHA256WithRSA
+	default:
+		return ErrInvalidSignature
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	cert, err := v.cert(ctx, msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(algorithm, signed, sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (v *SNSVerifier) cert(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	v.mu.Lock()
+	cert, ok := v.certs[certURL]
+	v.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	var data []byte
+	if err := v.get(ctx, certURL, &data); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("sns signing certificate: no PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("sns signing certificate: %w", err)
+	}
+
+	v.mu.Lock()
+	v.certs[certURL] = cert
+	v.mu.Unlock()
+	return cert, nil
+}
+
+// get requests rawURL, which must be an https URL on an SNS host, and
+// stores the body in out when out is not nil.
+func (v *SNSVerifier) get(ctx context.Context, rawURL string, out *[]byte) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || !snsCertHost.MatchString(u.Hostname()) {
+		return ErrInvalidSignature
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sns: GET %s returned %d", u.Host, resp.StatusCode)
+	}
+	if out != nil {
+		*out, err = io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	}
+	return err
+}
+
+func parseSESNotification(message string) ([]DeliveryEvent, error) {
+	var n struct {
+		NotificationType string `json:"notificationType"`
+		Bounce           struct {
+			BounceType        string `json:"bounceType"`
+			BouncedRecipients []struct {
+				EmailAddress   string `json:"emailAddress"`
+				DiagnosticCode string `json:"diagnosticCode"`
+			} `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplainedRecipients []struct {
+				EmailAddress string `json:"emailAddress"`
+			} `json:"complainedRecipients"`
+			ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		} `json:"complaint"`
+	}
+	if err := json.Unmarshal([]byte(message), &n); err != nil {
+		return nil, err
+	}
+
+	var out []DeliveryEvent
+	switch n.NotificationType {
+	case "Bounce":
+		if n.Bounce.BounceType != "Permanent" {
+			return nil, nil
+		}
+		for _, r := range n.Bounce.BouncedRecipients {
+			out = append(out, DeliveryEvent{Email: r.EmailAddress, Kind: DeliveryBounce, Reason: r.DiagnosticCode})
+		}
+	case "Complaint":
+		for _, r := range n.Complaint.ComplainedRecipients {
+			out = append(out, DeliveryEvent{Email: r.EmailAddress, Kind: DeliveryComplaint, Reason: n.Complaint.ComplaintFeedbackType})
+		}
+	}
+	return out, nil
+}
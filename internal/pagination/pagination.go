@@ -0,0 +1,155 @@
+// Package pagination parses page parameters from requests and describes the
+// resulting page with a meta block and RFC 5988 Link header.
+//
+// Offset pages use ?limit=&offset=. Cursor pages use ?limit=&cursor=, where
+// the cursor is an opaque value handed out as next_cursor.
+package pagination
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Options bound the parameters of one endpoint.
+type Options struct {
+	DefaultLimit int
+	MaxLimit     int
+	// Cursor switches the endpoint from offsets to cursors.
+	Cursor bool
+}
+
+// Params is a parsed page request. Offset is always 0 for cursor pages and
+// Cursor is always "" for offset pages.
+type Params struct {
+	Limit  int
+	Offset int
+	Cursor string
+
+	cursorMode bool
+}
+
+// Meta goes next to data in the response envelope. Total is only set by
+// endpoints that can count cheaply.
+type Meta struct {
+	Limit      int    `json:"limit"`
+	Offset     *int   `json:"offset,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Error is a bad page parameter; handlers answer it with 400.
+type Error struct {
+	msg string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Parse reads limit and offset or cursor from r.
+func Parse(r *http.Request, opts Options) (Params, error) {
+	qs := r.URL.Query()
+	p := Params{Limit: opts.DefaultLimit}
+
+	if v := qs.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > opts.MaxLimit {
+			return p, &Error{fmt.Sprintf("limit must be between 1 and %d", opts.MaxLimit)}
+		}
+		p.Limit = limit
+	}
+
+	if opts.Cursor {
+		p.Cursor = qs.Get("cursor")
+		p.cursorMode = true
+		return p, nil
+	}
+
+	if v := qs.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return p, &Error{"offset must be a non-negative number"}
+		}
+		p.Offset = offset
+	}
+	return p, nil
+}
+
+// Page describes one page of results.
+type Page struct {
+	Params Params
+	// Count is the number of items on this page.
+	Count int
+	// Total is the number of items across all pages, or -1 when unknown.
+	Total int
+	// NextCursor continues a cursor page; "" means it was the last one.
+	NextCursor string
+}
+
+// Meta returns the meta block for the page.
+func (pg Page) Meta() Meta {
+	m := Meta{Limit: pg.Params.Limit, NextCursor: pg.NextCursor}
+	if !pg.Params.cursorMode {
+		offset := pg.Params.Offset
+		m.Offset = &offset
+	}
+	if pg.Total >= 0 {
+		total := pg.Total
+		m.Total = &total
+	}
+	return m
+}
+
+// hasNext reports whether there is a page after this one. Without a total,
+// a full offset page is assumed to have a successor.
+func (pg Page) hasNext() bool {
+	switch {
+	case pg.Params.cursorMode:
+		return pg.NextCursor != ""
+	case pg.Total >= 0:
+		return pg.Params.Offset+pg.Count < pg.Total
+	}
+	return pg.Count == pg.Params.Limit
+}
+
+// Links returns the Link header value for the page, relative to u: next
+// when there is a following page and, for offset pages, first and prev when
+// this is not the first one. It returns "" when there are no links.
+func (pg Page) Links(u *url.URL) string {
+	var links []string
+	link := func(rel string, set map[string]string) {
+		q := u.Query()
+		for k, v := range set {
+			if v == "" {
+				q.Del(k)
+			} else {
+				q.Set(k, v)
+			}
+		}
+		target := url.URL{Path: u.Path, RawQuery: q.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, target.String(), rel))
+	}
+	limit := strconv.Itoa(pg.Params.Limit)
+
+	switch {
+	case !pg.hasNext():
+	case pg.Params.cursorMode:
+		link("next", map[string]string{"limit": limit, "cursor": pg.NextCursor, "offset": ""})
+	default:
+		link("next", map[string]string{"limit": limit, "offset": strconv.Itoa(pg.Params.Offset + pg.Params.Limit)})
+	}
+
+	if !pg.Params.cursorMode && pg.Params.Offset > 0 {
+		prev := pg.Params.Offset - pg.Params.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		link("prev", map[string]string{"limit": limit, "offset": strconv.Itoa(prev)})
+		link("first", map[string]string{"limit": limit, "offset": ""})
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,79 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseBounds(t *testing.T) {
+	opts := Options{DefaultLimit: 20, MaxLimit: 50}
+
+	for _, target := range []string{"/?limit=0", "/?limit=51", "/?limit=x", "/?offset=-1"} {
+		if _, err := Parse(httptest.NewRequest("GET", target, nil), opts); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+
+	p, err := Parse(httptest.NewRequest("GET", "/?offset=40", nil), opts)
+	if err != nil || p.Limit != 20 || p.Offset != 40 {
+		t.Errorf("got %+v, %v", p, err)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/admin/users?status=bob&limit=10&offset=10", nil)
+	p, err := Parse(r, Options{DefaultLimit: 20, MaxLimit: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := Page{Params: p, Count: 10, Total: 25}
+	want := `</v1/admin/users?limit=10&offset=20&status=bob>; rel="next", ` +
+		`</v1/admin/users?limit=10&offset=0&status=bob>; rel="prev", ` +
+		`</v1/admin/users?limit=10&status=bob>; rel="first"`
+	if got := page.Links(r.URL); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+	if m := page.Meta(); *m.Total != 25 || *m.Offset != 10 {
+		t.Errorf("unexpected meta %+v", m)
+	}
+
+	last := Page{Params: Params{Limit: 10, Offset: 20}, Count: 5, Total: 25}
+	if got := last.Links(r.URL); got != `</v1/admin/users?limit=10&offset=10&status=bob>; rel="prev", </v1/admin/users?limit=10&status=bob>; rel="first"` {
+		t.Errorf("last page links %s", got)
+	}
+
+	r = httptest.NewRequest("GET", "/v1/conversations/1/messages?cursor=9", nil)
+	p, _ = Parse(r, Options{DefaultLimit: 2, MaxLimit: 10, Cursor: true})
+	page = Page{Params: p, Count: 2, Total: -1, NextCursor: "7"}
+	if got := page.Links(r.URL); got != `</v1/conversations/1/messages?cursor=7&limit=2>; rel="next"` {
+		t.Errorf("cursor links %s", got)
+	}
+	if m := page.Meta(); m.Offset != nil || m.NextCursor != "7" {
+		t.Errorf("unexpected cursor meta %+v", m)
+	}
+	if got := (Page{Params: p, Count: 1, Total: -1}).Links(r.URL); got != "" {
+		t.Errorf("last cursor page links %s", got)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner([]byte("secret"))
+
+	cursor := signer.Sign("messages:1", "42", "2026-10-16")
+	keys, err := signer.Verify("messages:1", cursor)
+	if err != nil || len(keys) != 2 || keys[0] != "42" || keys[1] != "2026-10-16" {
+		t.Fatalf("got %v, %v", keys, err)
+	}
+
+	forged := NewSigner([]byte("other")).Sign("messages:1", "41")
+	for _, bad := range []string{"42", forged, cursor[:len(cursor)-2], "e30." + cursor[strings.Index(cursor, ".")+1:]} {
+		if _, err := signer.Verify("messages:1", bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, err := signer.Verify("messages:2", cursor); err == nil {
+		t.Error("expected the cursor to be bound to its scope")
+	}
+}
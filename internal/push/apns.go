@@ -0,0 +1,144 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	apnsProduction = "https://api.push.apple.com"
+	apnsSandbox    = "https://api.sandbox.push.apple.com"
+	// apnsTokenTTL is how long a provider token is reused; Apple refuses
+	// tokens older than an hour and throttles ones renewed more often than
+	// every 20 minutes
+	apnsTokenTTL = 40 * time.Minute
+)
+
+// APNsConfig is a token-based (.p8) APNs key and the app it sends for.
+type APNsConfig struct {
+	// Key is the .p8 key in PEM
+	Key    string
+	KeyID  string
+	TeamID string
+	// Topic is the app's bundle ID
+	Topic string
+	// Sandbox sends to development builds
+	Sandbox bool
+}
+
+// APNs sends through the Apple Push Notification service. The client must
+// speak HTTP/2.
+type APNs struct {
+	client *http.Client
+	cfg    APNsConfig
+	key    *ecdsa.PrivateKey
+	// Endpoint is the API origin, changed by tests
+	Endpoint string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewAPNs(client *http.Client, cfg APNsConfig) (*APNs, error) {
+	if cfg.KeyID == "" || cfg.TeamID == "" || cfg.Topic == "" {
+		return nil, errors.New("APNs needs a key ID, team ID and topic")
+	}
+	parsed, err := parsePKCS8(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("reading APNs key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("APNs key is not an EC key")
+	}
+
+	endpoint := apnsProduction
+	if cfg.Sandbox {
+		endpoint = apnsSandbox
+	}
+	return &APNs{client: client, cfg: cfg, key: key, Endpoint: endpoint}, nil
+}
+
+func (a *APNs) Send(ctx context.Context, device Device, n Notification) error {
+	token, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{
+		"aps": map[string]any{
+			"alert": map[string]string{"title": n.Title, "body": n.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+	if n.URL != "" {
+		payload["url"] = n.URL
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Endpoint+"/3/device/"+url.PathEscape(device.Token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", a.cfg.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var reason struct {
+		Reason string `json:"reason"`
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, errorBody))
+	json.Unmarshal(snippet, &reason)
+	if resp.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" || reason.Reason == "DeviceTokenNotForTopic" {
+		return ErrUnregistered
+	}
+	return fmt.Errorf("apns answered %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+}
+
+// providerToken returns the signed JWT APNs authenticates requests with.
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if a.token != "" && now.Before(a.expires) {
+		return a.token, nil
+	}
+
+	token, err := signJWT(
+		map[string]string{"alg": "ES256", "kid": a.cfg.KeyID},
+		map[string]any{"iss": a.cfg.TeamID, "iat": now.Unix()},
+		es256(a.key),
+	)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.expires = token, now.Add(apnsTokenTTL)
+	return token, nil
+}
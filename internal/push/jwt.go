@@ -0,0 +1,67 @@
+package push
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+)
+
+var b64 = base64.RawURLEncoding
+
+// signJWT encodes header and claims and appends the signature sign makes
+// of them.
+func signJWT(header, claims any, sign func(input []byte) ([]byte, error)) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	sig, err := sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64.EncodeToString(sig), nil
+}
+
+// es256 signs with key the way JWS wants it: r and s as 32 bytes each,
+// not ASN.1.
+func es256(key *ecdsa.PrivateKey) func([]byte) ([]byte, error) {
+	return func(input []byte) ([]byte, error) {
+		sum := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	}
+}
+
+func rs256(key *rsa.PrivateKey) func([]byte) ([]byte, error) {
+	return func(input []byte) ([]byte, error) {
+		sum := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(nil, key, crypto.SHA256, sum[:])
+	}
+}
+
+// parsePKCS8 reads the PEM private keys Google and Apple hand out.
+func parsePKCS8(data string) (any, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
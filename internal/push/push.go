@@ -0,0 +1,81 @@
+// Package push sends notifications to devices through Firebase Cloud
+// Messaging, the Apple Push Notification service and Web Push.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Platforms a device registers under.
+const (
+	PlatformFCM     = "fcm"
+	PlatformAPNs    = "apns"
+	PlatformWebPush = "webpush"
+)
+
+var (
+	// ErrUnregistered means the service no longer knows the device; its
+	// token should be dropped.
+	ErrUnregistered = errors.New("device is no longer registered")
+	// ErrPlatformDisabled means no sender is configured for the platform.
+	ErrPlatformDisabled = errors.New("push platform is not configured")
+)
+
+// Device is where a notification goes. Token is the FCM registration
+// token, the APNs device token or the Web Push endpoint URL; P256dh and
+// Auth are the subscription keys of a Web Push device.
+type Device struct {
+	Platform string
+	Token    string
+	P256dh   string
+	Auth     string
+}
+
+// Notification is what the device shows. URL is opened when it is tapped.
+type Notification struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	URL   string            `json:"url,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Sender delivers to the devices of one platform.
+type Sender interface {
+	Send(ctx context.Context, device Device, n Notification) error
+}
+
+// Dispatcher routes each device to the sender of its platform.
+type Dispatcher struct {
+	senders map[string]Sender
+}
+
+// NewDispatcher returns a dispatcher with no platforms; add them with
+// Register.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{senders: map[string]Sender{}}
+}
+
+func (d *Dispatcher) Register(platform string, s Sender) {
+	d.senders[platform] = s
+}
+
+// Enabled reports whether platform has a sender.
+func (d *Dispatcher) Enabled(platform string) bool {
+	_, ok := d.senders[platform]
+	return ok
+}
+
+// Empty reports whether no platform has a sender.
+func (d *Dispatcher) Empty() bool {
+	return len(d.senders) == 0
+}
+
+func (d *Dispatcher) Send(ctx context.Context, device Device, n Notification) error {
+	s, ok := d.senders[device.Platform]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPlatformDisabled, device.Platform)
+	}
+	return s.Send(ctx, device, n)
+}
@@ -0,0 +1,224 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebPush(t *testing.T) {
+	// the browser's subscription
+	browser, _ := ecdh.P256().GenerateKey(rand.Reader)
+	secret := make([]byte, 16)
+	rand.Read(secret)
+
+	vapid, _ := ecdh.P256().GenerateKey(rand.Reader)
+	sender, err := NewWebPush(http.DefaultClient, WebPushConfig{PrivateKey: b64.EncodeToString(vapid.Bytes()), Subject: "mailto:ops@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := http.StatusCreated
+	received := make(chan Notification, 1)
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "aes128gcm" {
+			t.Errorf("Content-Encoding = %q", r.Header.Get("Content-Encoding"))
+		}
+		checkVAPID(t, r.Header.Get("Authorization"), sender.PublicKey(), "http://"+r.Host)
+
+		body, _ := io.ReadAll(r.Body)
+		plaintext, err := decrypt(body, browser, secret)
+		if err != nil {
+			t.Errorf("decrypt: %v", err)
+		}
+		var n Notification
+		json.Unmarshal(plaintext, &n)
+		received <- n
+		w.WriteHeader(status)
+	}))
+	defer service.Close()
+
+	device := Device{
+		Platform: PlatformWebPush,
+		Token:    service.URL + "/push/abc",
+		P256dh:   b64.EncodeToString(browser.PublicKey().Bytes()),
+		Auth:     b64.EncodeToString(secret),
+	}
+	if err := sender.Send(context.Background(), device, Notification{Title: "Hi", Body: "New message", URL: "https://homes.example.com/m/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-received; n.Title != "Hi" || n.Body != "New message" || n.URL != "https://homes.example.com/m/1" {
+		t.Errorf("received %+v", n)
+	}
+
+	status = http.StatusGone
+	if err := sender.Send(context.Background(), device, Notification{Title: "Hi"}); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("expected ErrUnregistered, got %v", err)
+	}
+}
+
+func TestFCM(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	exchanges := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			exchanges++
+			r.ParseForm()
+			if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || strings.Count(r.Form.Get("assertion"), ".") != 2 {
+				t.Errorf("token request: %v", r.Form)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "ya29.token", "expires_in": 3600})
+		case "/v1/projects/homes/messages:send":
+			if r.Header.Get("Authorization") != "Bearer ya29.token" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			var body struct {
+				Message struct {
+					Token string `json:"token"`
+				} `json:"message"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Message.Token == "stale" {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`)
+				return
+			}
+			io.WriteString(w, `{"name":"projects/homes/messages/1"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	credentials, _ := json.Marshal(serviceAccount{
+		ProjectID:   "homes",
+		ClientEmail: "push@homes.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    server.URL + "/token",
+	})
+	sender, err := NewFCM(server.Client(), credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Endpoint = server.URL
+
+	ctx := context.Background()
+	if err := sender.Send(ctx, Device{Platform: PlatformFCM, Token: "fresh"}, Notification{Title: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(ctx, Device{Platform: PlatformFCM, Token: "stale"}, Notification{Title: "Hi"}); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("expected ErrUnregistered, got %v", err)
+	}
+	if exchanges != 1 {
+		t.Errorf("expected the access token to be reused, got %d exchanges", exchanges)
+	}
+}
+
+func TestAPNs(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apns-topic") != "com.example.homes" || !strings.HasPrefix(r.Header.Get("Authorization"), "bearer ") {
+			t.Errorf("headers: %v", r.Header)
+		}
+		if r.URL.Path == "/3/device/stale" {
+			w.WriteHeader(http.StatusGone)
+			io.WriteString(w, `{"reason":"Unregistered"}`)
+		}
+	}))
+	defer server.Close()
+
+	sender, err := NewAPNs(server.Client(), APNsConfig{
+		Key:    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		KeyID:  "ABC123",
+		TeamID: "TEAM42",
+		Topic:  "com.example.homes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.Endpoint = server.URL
+
+	ctx := context.Background()
+	if err := sender.Send(ctx, Device{Platform: PlatformAPNs, Token: "fresh"}, Notification{Title: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Send(ctx, Device{Platform: PlatformAPNs, Token: "stale"}, Notification{Title: "Hi"}); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("expected ErrUnregistered, got %v", err)
+	}
+}
+
+// checkVAPID verifies the JWT of a "vapid t=..., k=..." header.
+func checkVAPID(t *testing.T, header, publicKey, audience string) {
+	t.Helper()
+	token, k, ok := strings.Cut(strings.TrimPrefix(header, "vapid t="), ", k=")
+	if !ok || k != publicKey {
+		t.Fatalf("Authorization = %q", header)
+	}
+	parts := strings.Split(token, ".")
+	var claims struct {
+		Aud string `json:"aud"`
+		Sub string `json:"sub"`
+	}
+	payload, _ := b64.DecodeString(parts[1])
+	json.Unmarshal(payload, &claims)
+	if claims.Aud != audience || claims.Sub != "mailto:ops@example.com" {
+		t.Errorf("claims: %+v", claims)
+	}
+
+	raw, _ := b64.DecodeString(k)
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(raw[1:33]), Y: new(big.Int).SetBytes(raw[33:])}
+	sig, _ := b64.DecodeString(parts[2])
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(pub, sum[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Error("VAPID signature does not verify")
+	}
+}
+
+// decrypt is what the browser does with an aes128gcm body.
+func decrypt(body []byte, key *ecdh.PrivateKey, secret []byte) ([]byte, error) {
+	salt, idlen := body[:16], int(body[20])
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != webPushRecordSize {
+		return nil, errors.New("unexpected record size")
+	}
+	asPublic := body[21 : 21+idlen]
+	sender, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := key.ECDH(sender)
+	if err != nil {
+		return nil, err
+	}
+	gcm, nonce, err := contentCipher(shared, secret, salt, key.PublicKey().Bytes(), asPublic)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, body[21+idlen:], nil)
+	if err != nil {
+		return nil, err
+	}
+	if plaintext[len(plaintext)-1] != 2 {
+		return nil, errors.New("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
@@ -0,0 +1,235 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// webPushTTL is how long the push service keeps a message for an
+	// offline browser, in seconds
+	webPushTTL = 24 * 60 * 60
+	// webPushRecordSize is the rs of the aes128gcm header; the whole
+	// message fits in one record
+	webPushRecordSize = 4096
+	vapidTTL          = 12 * time.Hour
+)
+
+// WebPushConfig is the VAPID key pair the server identifies itself with.
+type WebPushConfig struct {
+	// PrivateKey is the raw P-256 private key in unpadded base64url, as
+	// printed by web-push generate-vapid-keys
+	PrivateKey string
+	// Subject is a mailto: or https: contact for the push services
+	Subject string
+}
+
+// WebPush sends to browser push subscriptions, encrypting with aes128gcm
+// (RFC 8291) and identifying with VAPID (RFC 8292).
+type WebPush struct {
+	client    *http.Client
+	subject   string
+	key       *ecdsa.PrivateKey
+	publicKey string
+}
+
+func NewWebPush(client *http.Client, cfg WebPushConfig) (*WebPush, error) {
+	raw, err := b64.DecodeString(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("reading VAPID key: %w", err)
+	}
+	private, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("reading VAPID key: %w", err)
+	}
+	if u, err := url.Parse(cfg.Subject); err != nil || u.Scheme != "mailto" && u.Scheme != "https" {
+		return nil, errors.New("VAPID subject must be a mailto: or https: URL")
+	}
+
+	public := private.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+	return &WebPush{client: client, subject: cfg.Subject, key: key, publicKey: b64.EncodeToString(public)}, nil
+}
+
+// PublicKey is the applicationServerKey browsers subscribe with.
+func (w *WebPush) PublicKey() string {
+	return w.publicKey
+}
+
+func (w *WebPush) Send(ctx context.Context, device Device, n Notification) error {
+	endpoint, err := url.Parse(device.Token)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	body, err := Encrypt(plaintext, device.P256dh, device.Auth)
+	if err != nil {
+		return err
+	}
+	auth, err := w.vapid(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(webPushTTL))
+	req.Header.Set("Authorization", auth)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, errorBody))
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrUnregistered
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, errorBody))
+	return fmt.Errorf("push service answered %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+}
+
+// vapid returns the Authorization header for the push service at
+// audience.
+func (w *WebPush) vapid(audience string) (string, error) {
+	token, err := signJWT(
+		map[string]string{"typ": "JWT", "alg": "ES256"},
+		map[string]any{"aud": audience, "exp": time.Now().Add(vapidTTL).Unix(), "sub": w.subject},
+		es256(w.key),
+	)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + w.publicKey, nil
+}
+
+// Encrypt seals plaintext for the subscription with public key p256dh and
+// secret auth, both unpadded base64url, as one aes128gcm record.
+func Encrypt(plaintext []byte, p256dh, auth string) ([]byte, error) {
+	uaPublic, err := decodeKey(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("reading p256dh: %w", err)
+	}
+	secret, err := decodeKey(auth)
+	if err != nil {
+		return nil, fmt.Errorf("reading auth: %w", err)
+	}
+	receiver, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("reading p256dh: %w", err)
+	}
+	if len(plaintext)+webPushOverhead > webPushRecordSize {
+		return nil, errors.New("notification is too large for web push")
+	}
+
+	local, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := local.ECDH(receiver)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	asPublic := local.PublicKey().Bytes()
+	gcm, nonce, err := contentCipher(shared, secret, salt, uaPublic, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// 0x02 pads and marks the last record
+	return gcm.Seal(header, nonce, append(slices.Clip(plaintext), 2), nil), nil
+}
+
+// webPushOverhead is the padding delimiter and GCM tag each record holds
+// besides the plaintext.
+const webPushOverhead = 1 + 16
+
+// contentCipher derives the content encryption key and nonce of RFC 8291
+// section 3.4 from the ECDH secret.
+func contentCipher(shared, auth, salt, uaPublic, asPublic []byte) (cipher.AEAD, []byte, error) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(auth, shared, keyInfo, 32)
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, nonce, nil
+}
+
+// hkdf is HKDF-SHA256 for outputs of at most one hash length, all RFC
+// 8291 needs.
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
+
+// decodeKey accepts subscription keys with or without base64 padding, as
+// browsers differ.
+func decodeKey(s string) ([]byte, error) {
+	if b, err := b64.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
@@ -0,0 +1,121 @@
+// Package reqctx stores request-scoped values on a context.Context behind
+// typed accessors, so handlers and middleware never type-assert
+// context.Value results themselves.
+package reqctx
+
+import (
+	"context"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type key int
+
+const (
+	userKey key = iota
+	roleKey
+	requestIDKey
+	localeKey
+	bodyLimitKey
+	impersonatorKey
+)
+
+// WithUser stores the authenticated user and their role, and records the
+// user as the principal of whatever the request changes.
+func WithUser(ctx context.Context, user *store.User) context.Context {
+	ctx = context.WithValue(ctx, userKey, user)
+	if user != nil {
+		ctx = WithRole(ctx, user.Role.Name)
+		ctx = store.WithPrincipal(ctx, store.Principal{Kind: store.PrincipalUser, ID: user.ID})
+	}
+	return ctx
+}
+
+// WithStaffAction marks the request as an admin or moderator acting on
+// other accounts, so side effects are attributed to the admin principal.
+func WithStaffAction(ctx context.Context) context.Context {
+	if user := User(ctx); user != nil {
+		ctx = store.WithPrincipal(ctx, store.Principal{Kind: store.PrincipalAdmin, ID: user.ID})
+	}
+	return ctx
+}
+
+// WithImpersonator marks the request as made by admin with a token acting
+// as the user, and attributes its side effects to the admin.
+func WithImpersonator(ctx context.Context, admin *store.User) context.Context {
+	ctx = context.WithValue(ctx, impersonatorKey, admin)
+	return store.WithPrincipal(ctx, store.Principal{Kind: store.PrincipalAdmin, ID: admin.ID})
+}
+
+// Impersonator returns the admin impersonating the user, or nil.
+func Impersonator(ctx context.Context) *store.User {
+	admin, _ := ctx.Value(impersonatorKey).(*store.User)
+	return admin
+}
+
+// Principal returns who the request acts as; see store.PrincipalFromContext.
+func Principal(ctx context.Context) store.Principal {
+	return store.PrincipalFromContext(ctx)
+}
+
+// User returns the authenticated user, or nil for anonymous requests.
+func User(ctx context.Context) *store.User {
+	user, _ := ctx.Value(userKey).(*store.User)
+	return user
+}
+
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey, role)
+}
+
+// Role returns the caller's role name, or "" for anonymous requests.
+func Role(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey).(string)
+	return role
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID set with WithRequestID, falling back to
+// the one assigned by chi's RequestID middleware.
+func RequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		return id
+	}
+	return middleware.GetReqID(ctx)
+}
+
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey, locale)
+}
+
+// Locale returns the negotiated locale, or "" when none was set.
+func Locale(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey).(string)
+	return locale
+}
+
+// WithTenant scopes the request, and the store queries it runs, to one
+// tenant; see store.WithTenant.
+func WithTenant(ctx context.Context, tenantID int64) context.Context {
+	return store.WithTenant(ctx, tenantID)
+}
+
+// Tenant returns the tenant the request is scoped to and whether one was set.
+func Tenant(ctx context.Context) (int64, bool) {
+	return store.TenantFromContext(ctx)
+}
+
+func WithBodyLimit(ctx context.Context, maxBytes int64) context.Context {
+	return context.WithValue(ctx, bodyLimitKey, maxBytes)
+}
+
+// BodyLimit returns the largest request body the route accepts and whether
+// the route sets one.
+func BodyLimit(ctx context.Context) (int64, bool) {
+	maxBytes, ok := ctx.Value(bodyLimitKey).(int64)
+	return maxBytes, ok
+}
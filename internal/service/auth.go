@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+)
+
+// AuthService registers accounts.
+type AuthService interface {
+	// RegisterUser creates a regular user. Taken emails and phones are the
+	// store's ErrDuplicateEmail and ErrDuplicatePhone, and so is a taken
+	// chosen username its ErrDuplicateUsername.
+	RegisterUser(ctx context.Context, in NewUser) (*Registration, error)
+	// RegisterCompany creates the company with in as its owner, whose role
+	// is the company type. Companies always need activation.
+	RegisterCompany(ctx context.Context, company *store.Company, in NewUser) (*Registration, error)
+	// CreateAdmin creates an active administrator. The API never creates
+	// admins; this is for operators bootstrapping an installation.
+	CreateAdmin(ctx context.Context, in NewUser) (*store.User, error)
+	// ResendActivation replaces the activation token of a pending user and
+	// emails the new one, returning it. Other users are the store's
+	// ErrNotPending.
+	ResendActivation(ctx context.Context, user *store.User) (string, error)
+}
+
+// NewUser is what a registration says about the person. Email is expected
+// to be normalized already. Username is the one the person chose, if any,
+// normalized with NormalizeUsername; otherwise one is generated.
+type NewUser struct {
+	Username  string
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Country   string
+	JobTitle  string
+	Password  string
+	// Locale and Timezone are stored as the user's own; empty leaves them
+	// derived from Country.
+	Locale   string
+	Timezone string
+}
+
+// Registration is a newly created account.
+type Registration struct {
+	User *store.User
+	// Token is the plain activation token, empty when the user was created
+	// active.
+	Token string
+}
+
+type AuthOptions struct {
+	Store store.Storage
+	// RequireActivation creates users pending until they follow the emailed
+	// link; otherwise they are active at once.
+	RequireActivation bool
+	// Tokens issues the activation tokens.
+	Tokens *tokens.Issuer
+	// ActivationEmail builds the email carrying token. It is called with the
+	// final username, after the store resolved collisions, and the email is
+	// queued in the same transaction as the user.
+	ActivationEmail func(user *store.User, token string) (*store.OutboxEmail, error)
+	// BannedUsername, if set, reports usernames with a banned word. A chosen
+	// one is refused with ErrUsernameBanned; a generated one is replaced by
+	// one made from no name at all.
+	BannedUsername func(username string) bool
+}
+
+// Auth is the AuthService backed by the store.
+type Auth struct {
+	opts AuthOptions
+}
+
+var _ AuthService = (*Auth)(nil)
+
+func NewAuth(opts AuthOptions) *Auth {
+	return &Auth{opts: opts}
+}
+
+func (s *Auth) RegisterUser(ctx context.Context, in NewUser) (*Registration, error) {
+	user, err := s.newUser(in, store.RoleUser)
+	if err != nil {
+		return nil, err
+	}
+
+	// the store suffixes taken usernames, which is only right for generated
+	// ones
+	if in.Username != "" {
+		taken, err := s.opts.Store.Users.TakenUsernames(ctx, []string{in.Username})
+		if err != nil {
+			return nil, err
+		}
+		if taken[in.Username] {
+			return nil, store.ErrDuplicateUsername
+		}
+	}
+
+	if !s.opts.RequireActivation {
+		if err := s.opts.Store.Users.CreateActive(ctx, user); err != nil {
+			return nil, err
+		}
+		return &Registration{User: user}, nil
+	}
+
+	token, err := s.opts.Tokens.Issue(tokens.Activation)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.opts.Store.Users.CreateAndInvite(ctx, user, token.Hash, s.opts.Tokens.TTL(tokens.Activation), s.activationEmail(token.Plain)); err != nil {
+		return nil, err
+	}
+	return &Registration{User: user, Token: token.Plain}, nil
+}
+
+func (s *Auth) RegisterCompany(ctx context.Context, company *store.Company, in NewUser) (*Registration, error) {
+	user, err := s.newUser(in, company.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.opts.Tokens.Issue(tokens.Activation)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.opts.Store.Users.CreateCompanyAndUser(ctx, company, user, token.Hash, s.opts.Tokens.TTL(tokens.Activation), s.activationEmail(token.Plain)); err != nil {
+		return nil, err
+	}
+	return &Registration{User: user, Token: token.Plain}, nil
+}
+
+func (s *Auth) CreateAdmin(ctx context.Context, in NewUser) (*store.User, error) {
+	user, err := s.newUser(in, store.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.opts.Store.Users.CreateActive(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Auth) ResendActivation(ctx context.Context, user *store.User) (string, error) {
+	token, err := s.opts.Tokens.Issue(tokens.Activation)
+	if err != nil {
+		return "", err
+	}
+	if err := s.opts.Store.Users.Reinvite(ctx, user, token.Hash, s.opts.Tokens.TTL(tokens.Activation), s.activationEmail(token.Plain)); err != nil {
+		return "", err
+	}
+	return token.Plain, nil
+}
+
+func (s *Auth) activationEmail(token string) func(*store.User) (*store.OutboxEmail, error) {
+	return func(u *store.User) (*store.OutboxEmail, error) {
+		return s.opts.ActivationEmail(u, token)
+	}
+}
+
+// newUser builds the user with the chosen or a generated username and the
+// hashed password.
+func (s *Auth) newUser(in NewUser, role string) (*store.User, error) {
+	username := in.Username
+	if username == "" {
+		username = GenerateUsername(in.FirstName, in.LastName, in.Email)
+		if s.bannedUsername(username) {
+			username = GenerateUsername("", "", "")
+		}
+	} else if s.bannedUsername(username) {
+		return nil, ErrUsernameBanned
+	}
+	if err := CheckUsername(username); err != nil {
+		return nil, err
+	}
+
+	user := &store.User{
+		Username:  username,
+		FirstName: in.FirstName,
+		LastName:  in.LastName,
+		Email:     in.Email,
+		Phone:     in.Phone,
+		Country:   in.Country,
+		JobTitle:  in.JobTitle,
+		Locale:    in.Locale,
+		Timezone:  in.Timezone,
+		Role:      store.Role{Name: role},
+	}
+	if err := user.Password.Set(in.Password); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Auth) bannedUsername(username string) bool {
+	return s.opts.BannedUsername != nil && s.opts.BannedUsername(username)
+}
+
+// ActivationURL is the frontend link that activates an account with token.
+func ActivationURL(frontendURL, env, token string) string {
+	base := strings.TrimRight(frontendURL, "/")
+	escapedToken := url.QueryEscape(token)
+
+	// In development we prefer query token, because static servers often do not
+	// support SPA deep links like /confirm/{token} without extra rewrite config.
+	if env != "production" {
+		return fmt.Sprintf("%s/?token=%s", base, escapedToken)
+	}
+
+	return fmt.Sprintf("%s/confirm/%s", base, escapedToken)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// ListingService creates listings, this API's posts.
+type ListingService interface {
+	// Create stores listing for the author's company and sends it to
+	// moderation, or keeps it as a draft when its status is
+	// store.ListingStatusDraft. Only agencies and developers of a verified company may
+	// create listings, in their own company's projects; anything else is
+	// ErrForbidden.
+	Create(ctx context.Context, author *store.User, listing *store.Listing, media []store.ListingMedia, rent *store.RentConstraints) error
+	// ReindexTags extracts the hashtags of every listing again, reporting
+	// to progress after every batch.
+	ReindexTags(ctx context.Context, progress func(status string, done int)) (int, error)
+}
+
+type ListingsOptions struct {
+	Store store.Storage
+	// Created runs after a listing is stored, for side effects that must not
+	// fail the creation such as tags and events; it may be nil.
+	Created func(ctx context.Context, listing *store.Listing)
+}
+
+// Listings is the ListingService backed by the store.
+type Listings struct {
+	opts ListingsOptions
+}
+
+var _ ListingService = (*Listings)(nil)
+
+func NewListings(opts ListingsOptions) *Listings {
+	return &Listings{opts: opts}
+}
+
+func (s *Listings) Create(ctx context.Context, author *store.User, listing *store.Listing, media []store.ListingMedia, rent *store.RentConstraints) error {
+	if err := s.canCreate(ctx, author); err != nil {
+		return err
+	}
+
+	if listing.ProjectID != nil {
+		project, err := s.opts.Store.Projects.GetByID(ctx, *listing.ProjectID)
+		if err != nil {
+			return err
+		}
+		if project.CompanyID != *author.CompanyID {
+			return ErrForbidden
+		}
+	}
+
+	if listing.DealType != "rent" {
+		rent = nil
+	}
+	listing.CompanyID = *author.CompanyID
+	if listing.Status != store.ListingStatusDraft {
+		listing.Status = store.ListingStatusModeration
+	}
+
+	if err := s.opts.Store.Listings.Create(ctx, listing, media, rent); err != nil {
+		return err
+	}
+	if s.opts.Created != nil {
+		s.opts.Created(ctx, listing)
+	}
+	return nil
+}
+
+func (s *Listings) canCreate(ctx context.Context, author *store.User) error {
+	if author.Role.Name != store.RoleAgency && author.Role.Name != store.RoleDeveloper {
+		return ErrForbidden
+	}
+	if author.CompanyID == nil {
+		return ErrForbidden
+	}
+
+	company, err := s.opts.Store.Companies.GetByID(ctx, *author.CompanyID)
+	if err != nil {
+		return err
+	}
+	if company.VerificationStatus != store.VerificationVerified {
+		return ErrForbidden
+	}
+	return nil
+}
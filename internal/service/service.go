@@ -0,0 +1,11 @@
+// Package service holds the business rules behind the HTTP handlers, so a
+// CLI, another transport or a unit test can register users, look them up
+// and create listings without going through HTTP. Handlers keep what is
+// about the request: decoding and validating the body, headers such as the
+// GeoIP country, and turning errors into status codes.
+package service
+
+import "errors"
+
+// ErrForbidden is returned when the caller may not do what they asked.
+var ErrForbidden = errors.New("not allowed")
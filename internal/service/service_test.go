@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+)
+
+func testTokens(t *testing.T) *tokens.Issuer {
+	t.Helper()
+	issuer, err := tokens.New(tokens.Policies{tokens.Activation: {TTL: time.Hour, Format: tokens.FormatRandom}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func TestRegisterUser(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStorage()
+	var emailedTo, emailedToken string
+	auth := NewAuth(AuthOptions{
+		Store:             st,
+		RequireActivation: true,
+		Tokens:            testTokens(t),
+		ActivationEmail: func(u *store.User, token string) (*store.OutboxEmail, error) {
+			emailedTo, emailedToken = u.Username, token
+			return &store.OutboxEmail{Template: "user_invitation.tmpl", Username: u.Username, Email: u.Email}, nil
+		},
+	})
+
+	reg, err := auth.RegisterUser(ctx, NewUser{FirstName: "Jo", LastName: "Doe", Email: "jo@example.com", Phone: "+1555", Password: "Secret-pass-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Token == "" || emailedToken != reg.Token || emailedTo != reg.User.Username {
+		t.Fatalf("token %q emailed as %q to %q", reg.Token, emailedToken, emailedTo)
+	}
+	if reg.User.State != store.UserStatePending || reg.User.Password.Compare("Secret-pass-1") != nil {
+		t.Fatalf("user %+v", reg.User)
+	}
+	if _, err := st.Users.Activate(ctx, tokens.Lookup(tokens.Activation, reg.Token)); err != nil {
+		t.Fatalf("activating with the emailed token: %v", err)
+	}
+
+	_, err = auth.RegisterUser(ctx, NewUser{FirstName: "Jo", LastName: "Other", Email: "jo@example.com", Phone: "+1666", Password: "Secret-pass-1"})
+	if !errors.Is(err, store.ErrDuplicateEmail) {
+		t.Fatalf("taken email: %v", err)
+	}
+
+	active := NewAuth(AuthOptions{Store: st})
+	reg, err = active.RegisterUser(ctx, NewUser{FirstName: "Al", LastName: "Lee", Email: "al@example.com", Phone: "+1777", Password: "Secret-pass-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Token != "" || reg.User.State != store.UserStateActive {
+		t.Fatalf("without activation: token %q, state %q", reg.Token, reg.User.State)
+	}
+}
+
+func TestResendActivation(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStorage()
+	var emailed []string
+	auth := NewAuth(AuthOptions{
+		Store:             st,
+		RequireActivation: true,
+		Tokens:            testTokens(t),
+		ActivationEmail: func(u *store.User, token string) (*store.OutboxEmail, error) {
+			emailed = append(emailed, token)
+			return &store.OutboxEmail{Template: "user_invitation.tmpl", Username: u.Username, Email: u.Email}, nil
+		},
+	})
+
+	reg, err := auth.RegisterUser(ctx, NewUser{FirstName: "Jo", LastName: "Doe", Email: "jo@example.com", Phone: "+1555", Password: "Secret-pass-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.ResendActivation(ctx, reg.User)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emailed) != 2 || emailed[1] != token || token == reg.Token {
+		t.Fatalf("emailed %q, resent %q", emailed, token)
+	}
+	if _, err := st.Users.Activate(ctx, tokens.Lookup(tokens.Activation, reg.Token)); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("the replaced token: %v", err)
+	}
+	if _, err := st.Users.Activate(ctx, tokens.Lookup(tokens.Activation, token)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ResendActivation(ctx, reg.User); !errors.Is(err, store.ErrNotPending) {
+		t.Fatalf("active user: %v", err)
+	}
+}
+
+func TestCreateListing(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStorage()
+	created := 0
+	listings := NewListings(ListingsOptions{Store: st, Created: func(context.Context, *store.Listing) { created++ }})
+
+	company := &store.Company{Name: "Acme", RegistrationNumber: "1", Email: "acme@example.com", Type: store.RoleAgency}
+	agent := &store.User{Username: "agent", Email: "acme@example.com", Role: store.Role{Name: store.RoleAgency}}
+	if err := st.Users.CreateCompanyAndUser(ctx, company, agent, "token", time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+	newListing := func() *store.Listing {
+		return &store.Listing{Title: "Flat", PropertyType: "apartment", DealType: "sale", Price: 100, City: "Astana"}
+	}
+
+	if err := listings.Create(ctx, agent, newListing(), nil, &store.RentConstraints{}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("unverified company: %v", err)
+	}
+	if err := listings.Create(ctx, &store.User{Role: store.Role{Name: store.RoleUser}}, newListing(), nil, nil); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("regular user: %v", err)
+	}
+
+	if err := st.Companies.UpdateVerificationStatus(ctx, company.ID, store.VerificationVerified); err != nil {
+		t.Fatal(err)
+	}
+	listing := newListing()
+	if err := listings.Create(ctx, agent, listing, nil, &store.RentConstraints{}); err != nil {
+		t.Fatal(err)
+	}
+	if listing.CompanyID != company.ID || listing.Status != store.ListingStatusModeration || created != 1 {
+		t.Fatalf("listing %+v, created hook ran %d times", listing, created)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+const (
+	maxListingTags = 10
+	maxTagLength   = 50
+)
+
+// hashtagPattern matches #tag at the start of the text or after a character
+// that cannot be part of a word, so URL fragments are not taken as tags.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_/&])#([\p{L}\p{N}_]+)`)
+
+// ExtractHashtags returns the distinct, normalized hashtags of text in the
+// order they first appear. Tags without a letter, such as "#5", are skipped
+// because they are usually flat or house numbers.
+func ExtractHashtags(text string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, m := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := NormalizeTag(m[1])
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxListingTags {
+			break
+		}
+	}
+	return tags
+}
+
+// NormalizeTag lowercases tag and drops a leading '#'. It returns "" for
+// tags that are too long or have no letter.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if utf8.RuneCountInString(tag) > maxTagLength || strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+		return ""
+	}
+	return tag
+}
+
+// ListingTags returns the hashtags of the listing's title and description.
+func ListingTags(listing *store.Listing) []string {
+	return ExtractHashtags(listing.Title + "\n" + listing.Description)
+}
+
+// ReindexTags extracts the tags of every listing again, in every status, and
+// returns how many listings it went through. Tags are otherwise only set
+// by the API's indexer when a listing is saved, so this is needed after the
+// extraction rules change or when the indexer dropped events. progress, if
+// not nil, is called after every batch with the status being indexed and
+// the listings done so far.
+func (s *Listings) ReindexTags(ctx context.Context, progress func(status string, done int)) (int, error) {
+	statuses := make([]string, 0, len(store.ListingStatuses))
+	for status := range store.ListingStatuses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+
+	const batch = 50
+	n := 0
+	for _, status := range statuses {
+		for offset := 0; ; offset += batch {
+			listings, err := s.opts.Store.Listings.List(ctx, store.ListingFilter{Status: status, Limit: batch, Offset: offset})
+			if err != nil {
+				return n, err
+			}
+			for i := range listings {
+				if err := s.opts.Store.Tags.Set(ctx, listings[i].ID, ListingTags(&listings[i])); err != nil {
+					return n, err
+				}
+				n++
+			}
+			if progress != nil {
+				progress(status, n)
+			}
+			if len(listings) < batch {
+				break
+			}
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"#Parking and #parking", []string{"parking"}},
+		{"Квартира #НоваяСтройка, flat #5", []string{"новаястройка"}},
+		{"see https://example.com/page#section or a&#39;b", []string{}},
+		{"(#sea_view)\n#pets", []string{"sea_view", "pets"}},
+	}
+
+	for _, tt := range tests {
+		if got := ExtractHashtags(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExtractHashtags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReindexTags(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStorage()
+	for _, status := range []string{store.ListingStatusActive, "draft"} {
+		listing := &store.Listing{Title: "Flat #parking", PropertyType: "apartment", DealType: "sale", Price: 100, City: "Astana", Status: status}
+		if err := st.Listings.Create(ctx, listing, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var reported int
+	n, err := NewListings(ListingsOptions{Store: st}).ReindexTags(ctx, func(_ string, done int) { reported = done })
+	if err != nil || n != 2 {
+		t.Fatalf("reindexed %d listings: %v", n, err)
+	}
+	if reported != n {
+		t.Errorf("last progress report = %d, want %d", reported, n)
+	}
+	for _, status := range []string{store.ListingStatusActive, "draft"} {
+		tagged, err := st.Listings.List(ctx, store.ListingFilter{Status: status, Tag: "parking"})
+		if err != nil || len(tagged) != 1 {
+			t.Fatalf("%s listings tagged parking: %d, %v", status, len(tagged), err)
+		}
+	}
+}
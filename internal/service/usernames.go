@@ -0,0 +1,144 @@
+package service
+
+import (
+	_ "embed"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	UsernameMinLength = 3
+	UsernameMaxLength = 32
+)
+
+var (
+	ErrUsernameInvalid  = errors.New("username must be 3 to 32 lowercase letters, digits or underscores and start with a letter")
+	ErrUsernameReserved = errors.New("username is reserved")
+	ErrUsernameBanned   = errors.New("username contains a banned word")
+)
+
+var (
+	usernameNonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+	usernamePattern  = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+//go:embed reserved_usernames.txt
+var reservedUsernameList string
+
+var reservedUsernames = func() map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, line := range strings.Split(reservedUsernameList, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// NormalizeUsername trims and lowercases username. Usernames are unique
+// regardless of case, so they are stored lowercased.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// CheckUsername returns ErrUsernameInvalid unless the normalized username
+// matches the username policy and ErrUsernameReserved when it is on the
+// embedded reserved list.
+func CheckUsername(username string) error {
+	if len(username) < UsernameMinLength || len(username) > UsernameMaxLength || !usernamePattern.MatchString(username) {
+		return ErrUsernameInvalid
+	}
+	if UsernameReserved(username) {
+		return ErrUsernameReserved
+	}
+	return nil
+}
+
+// UsernameReserved reports whether username, ignoring case and
+// underscores, is on the reserved list.
+func UsernameReserved(username string) bool {
+	_, ok := reservedUsernames[strings.ReplaceAll(strings.ToLower(username), "_", "")]
+	return ok
+}
+
+// GenerateUsername returns a username made from the user's name, or the
+// local part of their email, with a random suffix. The result passes
+// CheckUsername.
+func GenerateUsername(firstName, lastName, email string) string {
+	base := UsernameBase(firstName, lastName, email)
+	if base == "" {
+		base = "user"
+	}
+
+	return WithUsernameSuffix(base)
+}
+
+// UsernameBase derives the readable part of a username from the user's name,
+// transliterated to ASCII, falling back to the local part of the email. It
+// starts with a letter, as usernames must.
+func UsernameBase(firstName, lastName, email string) string {
+	base := Transliterate(strings.TrimSpace(strings.ToLower(firstName + "." + lastName)))
+	base = strings.TrimLeft(usernameNonAlnum.ReplaceAllString(base, ""), "0123456789")
+	if base == "" {
+		base = strings.ToLower(strings.Split(email, "@")[0])
+		base = strings.TrimLeft(usernameNonAlnum.ReplaceAllString(base, ""), "0123456789")
+	}
+
+	// keep it reasonably short
+	if len(base) > 20 {
+		base = base[:20]
+	}
+
+	return base
+}
+
+// transliterations spells out the letters that do not decompose into a
+// Latin letter and accents: Cyrillic as in Russian and Kazakh passports
+// ("Дмитрий" is "dmitriy") and a few Latin ligatures and letters.
+var transliterations = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+	// Kazakh and Ukrainian
+	'ә': "a", 'ғ': "g", 'қ': "q", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u", 'һ': "h",
+	'і': "i", 'є': "ye", 'ї': "yi", 'ґ': "g",
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th",
+	'ı': "i",
+}
+
+// Transliterate spells lowercase s in ASCII where it can: accents are
+// dropped ("josé" is "jose") and the letters in transliterations are
+// replaced. Other characters are kept.
+func Transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFC.String(s) {
+		// looked up before decomposing, so й is not taken for и
+		if latin, ok := transliterations[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+		for _, d := range norm.NFD.String(string(r)) {
+			if !unicode.Is(unicode.Mn, d) {
+				b.WriteRune(d)
+			}
+		}
+	}
+	return b.String()
+}
+
+// WithUsernameSuffix adds a small random suffix to reduce collisions,
+// drawing again in the unlikely case that the result is reserved.
+func WithUsernameSuffix(base string) string {
+	for {
+		if username := base + uuid.New().String()[:6]; !UsernameReserved(username) {
+			return username
+		}
+	}
+}
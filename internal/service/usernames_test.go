@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+func TestCheckUsername(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"jo_doe42", nil},
+		{"abc", nil},
+		{"ab", ErrUsernameInvalid},
+		{"a234567890123456789012345678901234", ErrUsernameInvalid},
+		{"42jo", ErrUsernameInvalid},
+		{"_jo", ErrUsernameInvalid},
+		{"Jo", ErrUsernameInvalid},
+		{"jo.doe", ErrUsernameInvalid},
+		{"jö", ErrUsernameInvalid},
+		{"admin", ErrUsernameReserved},
+		{"sup_port", ErrUsernameReserved},
+		{"admins", nil},
+	}
+	for _, tt := range tests {
+		if err := CheckUsername(tt.in); err != tt.want {
+			t.Errorf("CheckUsername(%q) = %v, want %v", tt.in, err, tt.want)
+		}
+	}
+	if !UsernameReserved("ADMIN") {
+		t.Error("reserved names should match in any case")
+	}
+}
+
+func TestGenerateUsername(t *testing.T) {
+	for _, in := range [][3]string{
+		{"Jo", "Doe", "jo@example.com"},
+		{"", "", "42admin@example.com"},
+		{"Жанна", "", "007@example.com"},
+		{"", "", ""},
+	} {
+		if got := GenerateUsername(in[0], in[1], in[2]); CheckUsername(got) != nil {
+			t.Errorf("GenerateUsername%q = %q, which breaks the policy", in, got)
+		}
+	}
+}
+
+func TestUsernameBase(t *testing.T) {
+	tests := []struct{ first, last, email, want string }{
+		{"Дмитрий", "Ёлкин", "d@example.com", "dmitriyelkin"},
+		{"José", "Müller", "j@example.com", "josemuller"},
+		{"Әсел", "Құрманғали", "a@example.com", "aselqurmangali"},
+		{"Søren", "Łukasz", "s@example.com", "sorenlukasz"},
+		{"李", "", "li.wei@example.com", "liwei"},
+	}
+	for _, tt := range tests {
+		if got := UsernameBase(tt.first, tt.last, tt.email); got != tt.want {
+			t.Errorf("UsernameBase(%q, %q, %q) = %q, want %q", tt.first, tt.last, tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterChosenUsername(t *testing.T) {
+	ctx := context.Background()
+	auth := NewAuth(AuthOptions{Store: store.NewMemoryStorage()})
+	in := NewUser{Username: "jo_doe", FirstName: "Jo", LastName: "Doe", Email: "jo@example.com", Phone: "+1555", Password: "Secret-pass-1"}
+
+	reg, err := auth.RegisterUser(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.User.Username != "jo_doe" {
+		t.Errorf("registered as %q", reg.User.Username)
+	}
+
+	in.Email, in.Phone = "jo2@example.com", "+1666"
+	if _, err := auth.RegisterUser(ctx, in); !errors.Is(err, store.ErrDuplicateUsername) {
+		t.Errorf("taken username: %v", err)
+	}
+	in.Username = "root"
+	if _, err := auth.RegisterUser(ctx, in); !errors.Is(err, ErrUsernameReserved) {
+		t.Errorf("reserved username: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// UserService reads users through the cache.
+type UserService interface {
+	// Get returns the user, from the cache when there is one.
+	Get(ctx context.Context, userID int64) (*store.User, error)
+	// Forget drops the cached copy, so a change to the user applies to
+	// their next request.
+	Forget(ctx context.Context, userID int64)
+}
+
+// UserCache is the cache in front of the users table.
+type UserCache interface {
+	Get(context.Context, int64) (*store.User, error)
+	Set(context.Context, *store.User) error
+	Delete(context.Context, int64)
+}
+
+type UsersOptions struct {
+	Store store.Storage
+	// Cache is nil when users are not cached.
+	Cache UserCache
+	// OnCacheError is told about cache failures, which are served from the
+	// database instead; it may be nil.
+	OnCacheError func(userID int64, err error)
+}
+
+// Users is the UserService backed by the store and cache.
+type Users struct {
+	opts UsersOptions
+}
+
+var _ UserService = (*Users)(nil)
+
+func NewUsers(opts UsersOptions) *Users {
+	return &Users{opts: opts}
+}
+
+func (s *Users) Get(ctx context.Context, userID int64) (*store.User, error) {
+	if s.opts.Cache == nil {
+		return s.opts.Store.Users.GetByID(ctx, userID)
+	}
+
+	// A cache outage falls back to the database instead of failing the request.
+	user, err := s.opts.Cache.Get(ctx, userID)
+	if err != nil {
+		s.cacheError(userID, err)
+		return s.opts.Store.Users.GetByID(ctx, userID)
+	}
+
+	// Entries cached before users had a state are reloaded.
+	if user == nil || user.State == "" {
+		// A lagging replica must not put a stale user in the cache.
+		user, err = s.opts.Store.Users.GetByID(store.WithPrimaryReads(ctx), userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.opts.Cache.Set(ctx, user); err != nil {
+			s.cacheError(userID, err)
+		}
+	}
+
+	return user, nil
+}
+
+func (s *Users) Forget(ctx context.Context, userID int64) {
+	if s.opts.Cache != nil {
+		s.opts.Cache.Delete(ctx, userID)
+	}
+}
+
+func (s *Users) cacheError(userID int64, err error) {
+	if s.opts.OnCacheError != nil {
+		s.opts.OnCacheError(userID, err)
+	}
+}
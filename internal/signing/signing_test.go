@@ -0,0 +1,44 @@
+package signing
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	s := New("secret")
+	now := time.Unix(1_700_000_000, 0)
+
+	signed := s.Sign("/v1/downloads/favorites/7.csv?name=mine", now.Add(time.Minute))
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("name") != "mine" {
+		t.Errorf("lost the query: %s", signed)
+	}
+	if err := s.Verify(u.Path, u.Query(), now); err != nil {
+		t.Fatalf("valid url: %v", err)
+	}
+
+	if err := s.Verify(u.Path, u.Query(), now.Add(2*time.Minute)); !errors.Is(err, ErrExpired) {
+		t.Errorf("expired: got %v", err)
+	}
+	if err := s.Verify("/v1/downloads/favorites/8.csv", u.Query(), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other path: got %v", err)
+	}
+
+	extended := u.Query()
+	extended.Set(ExpiresParam, "9999999999")
+	if err := s.Verify(u.Path, extended, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("extended expiry: got %v", err)
+	}
+	if err := New("other").Verify(u.Path, u.Query(), now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other secret: got %v", err)
+	}
+	if err := s.Verify(u.Path, url.Values{}, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unsigned: got %v", err)
+	}
+}
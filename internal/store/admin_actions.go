@@ -30,9 +30,9 @@ func (s *AdminActionStore) Create(ctx context.Context, action *AdminAction) erro
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return s.db.QueryRowContext(ctx, query,
+	return translateError(s.db.QueryRowContext(ctx, query,
 		action.AdminID, action.ActionType, action.TargetType, action.TargetID, action.Details,
-	).Scan(&action.ID, &action.CreatedAt)
+	).Scan(&action.ID, &action.CreatedAt))
 }
 
 func (s *AdminActionStore) List(ctx context.Context, fq PaginatedQuery) ([]AdminAction, error) {
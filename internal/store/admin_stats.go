@@ -33,14 +33,15 @@ func (s *AdminStatsStore) GetOverview(ctx context.Context) (*DashboardStats, err
 		dest  *int
 		query string
 	}{
-		{&stats.TotalUsers, "SELECT COUNT(*) FROM users"},
-		{&stats.TotalCompanies, "SELECT COUNT(*) FROM companies"},
-		{&stats.TotalListings, "SELECT COUNT(*) FROM listings"},
-		{&stats.OnModeration, "SELECT COUNT(*) FROM listings WHERE status = 'moderation'"},
+		{&stats.TotalUsers, "SELECT COUNT(*) FROM users WHERE ($1 = 0 OR tenant_id = $1)"},
+		{&stats.TotalCompanies, "SELECT COUNT(*) FROM companies WHERE ($1 = 0 OR tenant_id = $1)"},
+		{&stats.TotalListings, "SELECT COUNT(*) FROM listings WHERE deleted_at IS NULL AND ($1 = 0 OR tenant_id = $1)"},
+		{&stats.OnModeration, "SELECT COUNT(*) FROM listings WHERE status = 'moderation' AND deleted_at IS NULL AND ($1 = 0 OR tenant_id = $1)"},
 	}
 
+	scope := tenantScope(ctx)
 	for _, q := range queries {
-		if err := s.db.QueryRowContext(ctx, q.query).Scan(q.dest); err != nil {
+		if err := s.db.QueryRowContext(ctx, q.query, scope).Scan(q.dest); err != nil {
 			return nil, err
 		}
 	}
@@ -70,14 +71,14 @@ func (s *AdminStatsStore) GetActivityChart(ctx context.Context, days int) ([]Act
 			COUNT(DISTINCT c.id) AS new_companies,
 			COUNT(DISTINCT l.id) AS new_listings
 		FROM dates d
-		LEFT JOIN users u ON date_trunc('day', u.created_at) = d.d
-		LEFT JOIN companies c ON date_trunc('day', c.created_at) = d.d
-		LEFT JOIN listings l ON date_trunc('day', l.created_at) = d.d
+		LEFT JOIN users u ON date_trunc('day', u.created_at) = d.d AND ($2 = 0 OR u.tenant_id = $2)
+		LEFT JOIN companies c ON date_trunc('day', c.created_at) = d.d AND ($2 = 0 OR c.tenant_id = $2)
+		LEFT JOIN listings l ON date_trunc('day', l.created_at) = d.d AND l.deleted_at IS NULL AND ($2 = 0 OR l.tenant_id = $2)
 		GROUP BY d.d
 		ORDER BY d.d ASC
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, days)
+	rows, err := s.db.QueryContext(ctx, query, days, tenantScope(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +76,9 @@ func (s *ApplicationStore) Create(ctx context.Context, a *Application) error {
 	if _, ok := ListingDealTypes[a.DealType]; !ok {
 		return ErrInvalidDealType
 	}
+	if err := a.applyLimits(); err != nil {
+		return err
+	}
 
 	emailForDB := a.Email
 	if s.cryptor != nil {
@@ -153,7 +156,7 @@ func (s *ApplicationStore) Create(ctx context.Context, a *Application) error {
 		purchaseTerm,
 		comment,
 	).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
-	return err
+	return translateError(err)
 }
 
 func (s *ApplicationStore) UpdateStatus(ctx context.Context, id int64, status string) error {
@@ -168,7 +171,7 @@ func (s *ApplicationStore) UpdateStatus(ctx context.Context, id int64, status st
 
 	res, err := s.db.ExecContext(ctx, query, status, id)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
@@ -302,7 +305,7 @@ func (s *ApplicationStore) List(ctx context.Context, f ApplicationFilter) ([]App
                a.occupant_count, a.has_children, a.has_pets, a.is_student, a.stay_term_months, a.needs_mortgage, a.purchase_term, a.comment,
                a.created_at, a.updated_at
         FROM applications a
-        JOIN listings l ON a.listing_id = l.id
+        JOIN listings l ON a.listing_id = l.id AND l.deleted_at IS NULL
         WHERE %s
         ORDER BY a.created_at DESC
         LIMIT $%d OFFSET $%d
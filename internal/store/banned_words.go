@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// BannedWord is a word admins added to the word filter at runtime. Word is
+// in the filter's syntax: a trailing * bans every word it starts.
+type BannedWord struct {
+	ID        int64  `json:"id"`
+	Word      string `json:"word"`
+	Locale    string `json:"locale,omitempty"`
+	CreatedBy *int64 `json:"created_by,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type BannedWordStore struct {
+	db *sql.DB
+}
+
+// Add saves the word. A word that is already banned is ErrConflict.
+func (s *BannedWordStore) Add(ctx context.Context, w *BannedWord) error {
+	query := `
+		INSERT INTO banned_words (word, locale, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, w.Word, w.Locale, w.CreatedBy).Scan(&w.ID, &w.CreatedAt)
+	return translateError(err)
+}
+
+// List returns every word, alphabetically; the filter is built from all of
+// them, so they are not paged.
+func (s *BannedWordStore) List(ctx context.Context) ([]BannedWord, error) {
+	query := `SELECT id, word, locale, created_by, created_at FROM banned_words ORDER BY word`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []BannedWord{}
+	for rows.Next() {
+		var w BannedWord
+		if err := rows.Scan(&w.ID, &w.Word, &w.Locale, &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	return words, rows.Err()
+}
+
+func (s *BannedWordStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM banned_words WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// BlockedUser is a user the current user has blocked.
+type BlockedUser struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// notBlocked is a condition that holds when neither $1 nor the user whose id
+// is in column has blocked the other.
+func notBlocked(column string) string {
+	return `NOT EXISTS (SELECT 1 FROM user_blocks b
+		WHERE (b.blocker_id = $1 AND b.blocked_id = ` + column + `)
+		   OR (b.blocker_id = ` + column + ` AND b.blocked_id = $1))`
+}
+
+// Block makes blockerID block blockedID. Blocking twice is not an error.
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	query := `
+		INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, blockerID, blockedID)
+	if err = translateError(err); errors.Is(err, ErrForeignKeyUser) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Unblock lifts blockerID's block of blockedID, if there is one.
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+// Blocked reports whether blockerID has blocked blockedID.
+func (s *BlockStore) Blocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, blockerID, blockedID).Scan(&blocked)
+	return blocked, err
+}
+
+// Between reports whether either user has blocked the other.
+func (s *BlockStore) Between(ctx context.Context, userID, otherID int64) (bool, error) {
+	query := `SELECT NOT ` + notBlocked("$2")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+// List returns the users blockerID has blocked, most recent first.
+func (s *BlockStore) List(ctx context.Context, blockerID int64, fq PaginatedQuery) ([]BlockedUser, error) {
+	query := `
+		SELECT u.id, u.username, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC, u.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, blockerID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := []BlockedUser{}
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.UserID, &b.Username, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, b)
+	}
+	return blocked, rows.Err()
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/lib/pq"
+)
+
+const (
+	BroadcastRunning   = "running"
+	BroadcastPaused    = "paused"
+	BroadcastCompleted = "completed"
+)
+
+// BroadcastSegment narrows a broadcast to the active users from one of
+// Countries who signed up in [SignedUpAfter, SignedUpBefore). Empty fields
+// do not filter.
+type BroadcastSegment struct {
+	Countries      []string   `json:"countries,omitempty"`
+	SignedUpAfter  *time.Time `json:"signed_up_after,omitempty"`
+	SignedUpBefore *time.Time `json:"signed_up_before,omitempty"`
+}
+
+// Broadcast is an announcement mailed to a segment of the users of its
+// tenant. Total is the
+// number of users in the segment when it was created; Sent, Failed and
+// Skipped, for suppressed addresses, count the users reached so far.
+type Broadcast struct {
+	ID          int64            `json:"id"`
+	Subject     string           `json:"subject"`
+	Body        string           `json:"body"`
+	Segment     BroadcastSegment `json:"segment"`
+	Status      string           `json:"status"`
+	Total       int              `json:"total"`
+	Sent        int              `json:"sent"`
+	Failed      int              `json:"failed"`
+	Skipped     int              `json:"skipped"`
+	LastUserID  int64            `json:"-"`
+	CreatedBy   *int64           `json:"created_by,omitempty"`
+	TenantID    int64            `json:"tenant_id"`
+	CreatedAt   string           `json:"created_at"`
+	UpdatedAt   string           `json:"updated_at"`
+	CompletedAt *string          `json:"completed_at,omitempty"`
+}
+
+// BroadcastRecipient is a user a broadcast is mailed to.
+type BroadcastRecipient struct {
+	UserID   int64
+	Username string
+	Email    string
+}
+
+type BroadcastStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+// segmentFilter matches the users of the segment and tenant passed as $1
+// to $4.
+const segmentFilter = `
+	state = 'active'
+	AND (cardinality($1::text[]) = 0 OR country = ANY($1))
+	AND ($2::timestamptz IS NULL OR created_at >= $2)
+	AND ($3::timestamptz IS NULL OR created_at < $3)
+	AND tenant_id = $4
+`
+
+func segmentArgs(segment BroadcastSegment, tenantID int64) []any {
+	return []any{pq.Array(segment.Countries), segment.SignedUpAfter, segment.SignedUpBefore, tenantID}
+}
+
+const broadcastColumns = `id, subject, body, segment, status, total, sent, failed, skipped, last_user_id, created_by,
+	created_at, updated_at, completed_at, tenant_id`
+
+func scanBroadcast(row interface{ Scan(...any) error }) (*Broadcast, error) {
+	var b Broadcast
+	var segment []byte
+	err := row.Scan(&b.ID, &b.Subject, &b.Body, &segment, &b.Status, &b.Total, &b.Sent, &b.Failed, &b.Skipped,
+		&b.LastUserID, &b.CreatedBy, &b.CreatedAt, &b.UpdatedAt, &b.CompletedAt, &b.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(segment, &b.Segment); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Create stores a running broadcast in the tenant of ctx and counts the
+// users of its segment there.
+func (s *BroadcastStore) Create(ctx context.Context, b *Broadcast) error {
+	segment, err := json.Marshal(b.Segment)
+	if err != nil {
+		return err
+	}
+	b.TenantID = tenantOf(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+segmentFilter, segmentArgs(b.Segment, b.TenantID)...).Scan(&b.Total); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO broadcasts (subject, body, segment, total, created_by, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + broadcastColumns
+
+	created, err := scanBroadcast(s.db.QueryRowContext(ctx, query, b.Subject, b.Body, segment, b.Total, b.CreatedBy, b.TenantID))
+	if err != nil {
+		return err
+	}
+	*b = *created
+	return nil
+}
+
+func (s *BroadcastStore) GetByID(ctx context.Context, id int64) (*Broadcast, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	b, err := scanBroadcast(s.db.QueryRowContext(ctx, `SELECT `+broadcastColumns+` FROM broadcasts WHERE id = $1 AND ($2 = 0 OR tenant_id = $2)`, id, tenantScope(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// List returns the broadcasts, newest first.
+func (s *BroadcastStore) List(ctx context.Context, fq PaginatedQuery) ([]Broadcast, error) {
+	if fq.Limit <= 0 {
+		fq.Limit = 20
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT ` + broadcastColumns + ` FROM broadcasts WHERE ($3 = 0 OR tenant_id = $3) ORDER BY id DESC LIMIT $1 OFFSET $2`
+	rows, err := s.db.QueryContext(ctx, query, fq.Limit, fq.Offset, tenantScope(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	broadcasts := []Broadcast{}
+	for rows.Next() {
+		b, err := scanBroadcast(rows)
+		if err != nil {
+			return nil, err
+		}
+		broadcasts = append(broadcasts, *b)
+	}
+	return broadcasts, rows.Err()
+}
+
+// Claim locks the oldest running broadcast nobody else holds for lease,
+// or returns ErrNotFound when there is none.
+func (s *BroadcastStore) Claim(ctx context.Context, lease time.Duration) (*Broadcast, error) {
+	query := `
+		UPDATE broadcasts
+		SET locked_until = NOW() + $1 * interval '1 second'
+		WHERE id = (
+			SELECT id FROM broadcasts
+			WHERE status = 'running' AND (locked_until IS NULL OR locked_until <= NOW())
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + broadcastColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	b, err := scanBroadcast(s.db.QueryRowContext(ctx, query, lease.Seconds()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// Recipients returns the next users of the broadcast's segment in its
+// tenant after the last one it reached, in id order.
+func (s *BroadcastStore) Recipients(ctx context.Context, b *Broadcast, limit int) ([]BroadcastRecipient, error) {
+	query := `
+		SELECT id, username, email FROM users
+		WHERE ` + segmentFilter + ` AND id > $5
+		ORDER BY id
+		LIMIT $6
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, append(segmentArgs(b.Segment, b.TenantID), b.LastUserID, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []BroadcastRecipient
+	for rows.Next() {
+		var r BroadcastRecipient
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Email); err != nil {
+			return nil, err
+		}
+		if r.Email, err = s.cryptor.DecryptString(r.Email); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// Advance records a sent batch that reached lastUserID and releases the
+// lock. With done the broadcast is completed.
+func (s *BroadcastStore) Advance(ctx context.Context, id, lastUserID int64, sent, failed, skipped int, done bool) error {
+	query := `
+		UPDATE broadcasts
+		SET last_user_id = $2, sent = sent + $3, failed = failed + $4, skipped = skipped + $5,
+			status = CASE WHEN $6 THEN 'completed' ELSE status END,
+			completed_at = CASE WHEN $6 THEN NOW() END,
+			locked_until = NULL, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, lastUserID, sent, failed, skipped, done)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetStatus pauses or resumes a broadcast. It returns ErrNotFound for an
+// unknown broadcast and wraps ErrInvalidTransition unless it is in from.
+func (s *BroadcastStore) SetStatus(ctx context.Context, id int64, from, to string) error {
+	query := `
+		UPDATE broadcasts SET status = $3, updated_at = NOW()
+		WHERE id = $1 AND status = $2 AND ($4 = 0 OR tenant_id = $4)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, from, to, tenantScope(ctx))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var current string
+	err = s.db.QueryRowContext(ctx, `SELECT status FROM broadcasts WHERE id = $1 AND ($2 = 0 OR tenant_id = $2)`, id, tenantScope(ctx)).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, current, to)
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// FeedExpTime bounds how stale a cached feed page can be. Favorites and
+// applications change ranked scores without invalidating.
+const FeedExpTime = 30 * time.Second
+
+const feedGenerationKey = "feed-generation"
+
+// FeedStore caches listing feed pages. Pages are stored under the current
+// generation, so Invalidate drops all of them at once by moving to the next.
+type FeedStore struct {
+	rdb redis.UniversalClient
+}
+
+// Get returns the page cached under key, or nil, and the generation it was
+// looked up in. Pass that generation to Set, so a page read before an
+// invalidation is never stored after it.
+func (s *FeedStore) Get(ctx context.Context, key string) ([]store.Listing, int64, error) {
+	generation, err := s.rdb.Get(ctx, feedGenerationKey).Int64()
+	if err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+
+	data, err := s.rdb.Get(ctx, feedCacheKey(generation, key)).Bytes()
+	if err == redis.Nil {
+		return nil, generation, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	listings := []store.Listing{}
+	if err := json.Unmarshal(data, &listings); err != nil {
+		return nil, 0, err
+	}
+	return listings, generation, nil
+}
+
+func (s *FeedStore) Set(ctx context.Context, key string, generation int64, listings []store.Listing) error {
+	if listings == nil {
+		listings = []store.Listing{}
+	}
+	data, err := json.Marshal(listings)
+	if err != nil {
+		return err
+	}
+	return s.rdb.SetEX(ctx, feedCacheKey(generation, key), data, FeedExpTime).Err()
+}
+
+// Invalidate drops every cached page. The old ones expire on their own.
+func (s *FeedStore) Invalidate(ctx context.Context) error {
+	return s.rdb.Incr(ctx, feedGenerationKey).Err()
+}
+
+func feedCacheKey(generation int64, key string) string {
+	return fmt.Sprintf("feed-%d-%s", generation, key)
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	IdempotencyExpTime  = 24 * time.Hour
+	IdempotencyLockTime = time.Minute
+)
+
+// IdempotentResponse is the stored outcome of a request made with an
+// Idempotency-Key. Completed is false while the original request is running.
+type IdempotentResponse struct {
+	RequestHash string      `json:"request_hash"`
+	Completed   bool        `json:"completed"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body"`
+}
+
+type IdempotencyStore struct {
+	rdb redis.UniversalClient
+}
+
+func (s *IdempotencyStore) Get(ctx context.Context, key string) (*IdempotentResponse, error) {
+	data, err := s.rdb.Get(ctx, idempotencyCacheKey(key)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var resp IdempotentResponse
+	if err := json.Unmarshal([]byte(data), &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Reserve marks the key as in progress. It returns false when another request
+// already holds the key.
+func (s *IdempotencyStore) Reserve(ctx context.Context, key, requestHash string) (bool, error) {
+	data, err := json.Marshal(IdempotentResponse{RequestHash: requestHash})
+	if err != nil {
+		return false, err
+	}
+
+	return s.rdb.SetNX(ctx, idempotencyCacheKey(key), data, IdempotencyLockTime).Result()
+}
+
+func (s *IdempotencyStore) Set(ctx context.Context, key string, resp *IdempotentResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(ctx, idempotencyCacheKey(key), data, IdempotencyExpTime).Err()
+}
+
+func (s *IdempotencyStore) Delete(ctx context.Context, key string) {
+	s.rdb.Del(ctx, idempotencyCacheKey(key))
+}
+
+func idempotencyCacheKey(key string) string {
+	return "idempotency-" + key
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
 	"github.com/stretchr/testify/mock"
@@ -9,7 +10,12 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:       &MockUserStore{},
+		Idempotency: &MockIdempotencyStore{},
+		Usage:       &MockUsageStore{},
+		Feed:        &MockFeedStore{},
+		Views:       &MockViewStore{},
+		Revocations: &MockRevocationStore{},
 	}
 }
 
@@ -31,3 +37,67 @@ func (m *MockUserStore) Delete(ctx context.Context, userID int64) {
 	m.Called(userID)
 }
 
+
+type MockIdempotencyStore struct{}
+
+func (m *MockIdempotencyStore) Get(ctx context.Context, key string) (*IdempotentResponse, error) {
+	return nil, nil
+}
+
+func (m *MockIdempotencyStore) Reserve(ctx context.Context, key, requestHash string) (bool, error) {
+	return true, nil
+}
+
+func (m *MockIdempotencyStore) Set(ctx context.Context, key string, resp *IdempotentResponse) error {
+	return nil
+}
+
+func (m *MockIdempotencyStore) Delete(ctx context.Context, key string) {}
+
+type MockUsageStore struct{}
+
+func (m *MockUsageStore) Incr(ctx context.Context, userID int64, category string) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUsageStore) Daily(ctx context.Context, userID int64, days int) ([]DailyUsage, error) {
+	return nil, nil
+}
+
+type MockFeedStore struct{}
+
+func (m *MockFeedStore) Get(ctx context.Context, key string) ([]store.Listing, int64, error) {
+	return nil, 0, nil
+}
+
+func (m *MockFeedStore) Set(ctx context.Context, key string, generation int64, listings []store.Listing) error {
+	return nil
+}
+
+func (m *MockFeedStore) Invalidate(ctx context.Context) error {
+	return nil
+}
+
+type MockViewStore struct{}
+
+func (m *MockViewStore) Record(ctx context.Context, kind string, targetID int64, viewer string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockViewStore) Drain(ctx context.Context) ([]store.ViewCount, error) {
+	return nil, nil
+}
+
+func (m *MockViewStore) Restore(ctx context.Context, counts []store.ViewCount) error {
+	return nil
+}
+
+type MockRevocationStore struct{}
+
+func (m *MockRevocationStore) Revoke(ctx context.Context, jti string, until time.Time) error {
+	return nil
+}
+
+func (m *MockRevocationStore) Revoked(ctx context.Context, jti string) (bool, error) {
+	return false, nil
+}
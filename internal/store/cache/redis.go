@@ -1,11 +1,59 @@
 package cache
 
-import "github.com/go-redis/redis/v8"
-
-func NewRedisClient(addr, pw string, db int) *redis.Client {
-	return redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: pw,
-		DB:       db,
-	})
+import (
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
+// RedisConfig describes how to reach Redis. Addrs holds one node for
+// standalone mode, the sentinels for sentinel mode and the seed nodes for
+// cluster mode. DB is ignored in cluster mode.
+type RedisConfig struct {
+	Mode             string
+	Addrs            []string
+	Password         string
+	DB               int
+	MasterName       string
+	SentinelPassword string
+}
+
+// NewRedisClient returns a client for the configured topology. Sentinel and
+// cluster clients follow failovers on their own.
+func NewRedisClient(cfg RedisConfig) (redis.UniversalClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, fmt.Errorf("redis: no address configured")
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		MasterName:       cfg.MasterName,
+		SentinelPassword: cfg.SentinelPassword,
+	}
+
+	var client redis.UniversalClient
+	switch cfg.Mode {
+	case RedisModeStandalone, "":
+		client = redis.NewClient(opts.Simple())
+	case RedisModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis: sentinel mode requires a master name")
+		}
+		client = redis.NewFailoverClient(opts.Failover())
+	case RedisModeCluster:
+		client = redis.NewClusterClient(opts.Cluster())
+	default:
+		return nil, fmt.Errorf("redis: unknown mode %q", cfg.Mode)
+	}
+
+	client.AddHook(tracingHook{})
+	return client, nil
 }
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RevocationStore is the denylist of access tokens revoked before they
+// expire, by token ID (jti). An entry only has to outlive the token.
+type RevocationStore struct {
+	rdb redis.UniversalClient
+}
+
+// Revoke denies the token jti until it would have expired anyway.
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.rdb.Set(ctx, revocationCacheKey(jti), 1, ttl).Err()
+}
+
+func (s *RevocationStore) Revoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, revocationCacheKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func revocationCacheKey(jti string) string {
+	return "revoked-token-" + jti
+}
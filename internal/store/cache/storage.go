@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
@@ -13,11 +14,40 @@ type Storage struct {
 		Set(context.Context, *store.User) error
 		Delete(context.Context, int64)
 	}
+	Idempotency interface {
+		Get(ctx context.Context, key string) (*IdempotentResponse, error)
+		Reserve(ctx context.Context, key, requestHash string) (bool, error)
+		Set(ctx context.Context, key string, resp *IdempotentResponse) error
+		Delete(ctx context.Context, key string)
+	}
+	Usage interface {
+		Incr(ctx context.Context, userID int64, category string) (int64, error)
+		Daily(ctx context.Context, userID int64, days int) ([]DailyUsage, error)
+	}
+	Feed interface {
+		Get(ctx context.Context, key string) ([]store.Listing, int64, error)
+		Set(ctx context.Context, key string, generation int64, listings []store.Listing) error
+		Invalidate(ctx context.Context) error
+	}
+	Views interface {
+		Record(ctx context.Context, kind string, targetID int64, viewer string) (bool, error)
+		Drain(ctx context.Context) ([]store.ViewCount, error)
+		Restore(ctx context.Context, counts []store.ViewCount) error
+	}
+	Revocations interface {
+		Revoke(ctx context.Context, jti string, until time.Time) error
+		Revoked(ctx context.Context, jti string) (bool, error)
+	}
 }
 
-func NewRedisStorage(rbd *redis.Client) Storage {
+func NewRedisStorage(rbd redis.UniversalClient) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rbd},
+		Users:       &UserStore{rdb: rbd},
+		Idempotency: &IdempotencyStore{rdb: rbd},
+		Usage:       &UsageStore{rdb: rbd},
+		Feed:        &FeedStore{rdb: rbd},
+		Views:       &ViewStore{rdb: rbd},
+		Revocations: &RevocationStore{rdb: rbd},
 	}
 }
 
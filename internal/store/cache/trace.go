@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tracing"
+	"github.com/go-redis/redis/v8"
+)
+
+// tracingHook records a client span per Redis command or pipeline run with
+// a traced context. Keys and values are left out; only the command names
+// are recorded.
+type tracingHook struct{}
+
+type spanKey struct{}
+
+func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return startSpan(ctx, strings.ToUpper(cmd.Name()), cmd.Name())
+}
+
+func (tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endSpan(ctx, cmd.Err())
+	return nil
+}
+
+func (tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	return startSpan(ctx, "PIPELINE", strings.Join(names, " "))
+}
+
+func (tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			endSpan(ctx, err)
+			return nil
+		}
+	}
+	endSpan(ctx, nil)
+	return nil
+}
+
+func startSpan(ctx context.Context, name, command string) (context.Context, error) {
+	ctx, span := tracing.StartChild(ctx, name, tracing.KindClient,
+		tracing.String("db.system", "redis"),
+		tracing.String("db.operation", command),
+	)
+	if span == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, spanKey{}, span), nil
+}
+
+// endSpan ends the span started for the command. A cache miss is not an
+// error.
+func endSpan(ctx context.Context, err error) {
+	span, _ := ctx.Value(spanKey{}).(*tracing.Span)
+	if err != redis.Nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// UsageRetention is how long per-day request counters are kept.
+const UsageRetention = 31 * 24 * time.Hour
+
+// DailyUsage is the number of requests a user made on one UTC day, by
+// endpoint category.
+type DailyUsage struct {
+	Date     string           `json:"date"`
+	Requests map[string]int64 `json:"requests"`
+}
+
+type UsageStore struct {
+	rdb redis.UniversalClient
+}
+
+// Incr counts one request in category for the user on the current UTC day
+// and returns the user's requests that day in all categories.
+func (s *UsageStore) Incr(ctx context.Context, userID int64, category string) (int64, error) {
+	day := time.Now().UTC()
+	key := usageCacheKey(userID, day)
+	totalKey := usageTotalCacheKey(userID, day)
+
+	pipe := s.rdb.TxPipeline()
+	pipe.HIncrBy(ctx, key, category, 1)
+	pipe.Expire(ctx, key, UsageRetention)
+	total := pipe.Incr(ctx, totalKey)
+	pipe.Expire(ctx, totalKey, 48*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return total.Val(), nil
+}
+
+// Daily returns the counters for the last days days, oldest first. Days
+// without requests are included with an empty map.
+func (s *UsageStore) Daily(ctx context.Context, userID int64, days int) ([]DailyUsage, error) {
+	today := time.Now().UTC()
+
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, days)
+	dates := make([]string, days)
+	for i := 0; i < days; i++ {
+		day := today.AddDate(0, 0, i-days+1)
+		dates[i] = day.Format(time.DateOnly)
+		cmds[i] = pipe.HGetAll(ctx, usageCacheKey(userID, day))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	usage := make([]DailyUsage, days)
+	for i, cmd := range cmds {
+		usage[i] = DailyUsage{Date: dates[i], Requests: make(map[string]int64)}
+		for category, count := range cmd.Val() {
+			if n, err := strconv.ParseInt(count, 10, 64); err == nil {
+				usage[i].Requests[category] = n
+			}
+		}
+	}
+
+	return usage, nil
+}
+
+func usageCacheKey(userID int64, day time.Time) string {
+	return fmt.Sprintf("usage-%d-%s", userID, day.Format(time.DateOnly))
+}
+
+// usageTotalCacheKey counts the day's requests for the daily quota, which
+// only needs today's.
+func usageTotalCacheKey(userID int64, day time.Time) string {
+	return fmt.Sprintf("usage-total-%d-%s", userID, day.Format(time.DateOnly))
+}
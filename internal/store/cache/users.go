@@ -11,7 +11,7 @@ import (
 )
 
 type UserStore struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 }
 
 const UserExpTime = time.Minute
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// viewSeenRetention keeps the viewers of a day past its end, so views
+// shortly after midnight in a lagging clock are not counted twice.
+const viewSeenRetention = 48 * time.Hour
+
+// viewsPendingKey holds the counts not flushed to the store yet, one field
+// per kind, target and day.
+const viewsPendingKey = "views-pending"
+
+// ViewStore counts the distinct viewers of profiles and listings per UTC
+// day and buffers the counts until they are drained into the store.
+type ViewStore struct {
+	rdb redis.UniversalClient
+}
+
+// Record counts a view of the target by viewer unless viewer already saw
+// it today, and reports whether it was counted.
+func (s *ViewStore) Record(ctx context.Context, kind string, targetID int64, viewer string) (bool, error) {
+	day := time.Now().UTC().Format(time.DateOnly)
+	seenKey := fmt.Sprintf("views-seen-%s-%d-%s", kind, targetID, day)
+
+	pipe := s.rdb.TxPipeline()
+	added := pipe.SAdd(ctx, seenKey, viewer)
+	pipe.Expire(ctx, seenKey, viewSeenRetention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	if added.Val() == 0 {
+		return false, nil
+	}
+
+	return true, s.rdb.HIncrBy(ctx, viewsPendingKey, viewField(kind, targetID, day), 1).Err()
+}
+
+// Drain removes and returns the buffered counts. Pass them to Restore when
+// they cannot be stored.
+func (s *ViewStore) Drain(ctx context.Context) ([]store.ViewCount, error) {
+	pipe := s.rdb.TxPipeline()
+	all := pipe.HGetAll(ctx, viewsPendingKey)
+	pipe.Del(ctx, viewsPendingKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := make([]store.ViewCount, 0, len(all.Val()))
+	for field, value := range all.Val() {
+		kind, rest, _ := strings.Cut(field, ":")
+		id, day, _ := strings.Cut(rest, ":")
+		targetID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		views, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		counts = append(counts, store.ViewCount{Kind: kind, TargetID: targetID, Day: day, Views: views})
+	}
+	return counts, nil
+}
+
+// Restore puts drained counts back into the buffer.
+func (s *ViewStore) Restore(ctx context.Context, counts []store.ViewCount) error {
+	pipe := s.rdb.Pipeline()
+	for _, c := range counts {
+		pipe.HIncrBy(ctx, viewsPendingKey, viewField(c.Kind, c.TargetID, c.Day), c.Views)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func viewField(kind string, targetID int64, day string) string {
+	return fmt.Sprintf("%s:%d:%s", kind, targetID, day)
+}
@@ -11,8 +11,8 @@ import (
 )
 
 var (
-	ErrDuplicateRegistrationNumber = errors.New("a company with that registration number already exists")
-	ErrDuplicateCompanyEmail       = errors.New("a company with that email already exists")
+	ErrDuplicateRegistrationNumber = conflict("a company with that registration number already exists")
+	ErrDuplicateCompanyEmail       = conflict("a company with that email already exists")
 )
 
 type Company struct {
@@ -20,12 +20,15 @@ type Company struct {
 	Name               string `json:"name"`
 	RegistrationNumber string `json:"registration_number"`
 	City               string `json:"city"`
+	Country            string `json:"country,omitempty"` // ISO 3166-1 alpha-2
 	Email              string `json:"email"`
 	Phone              string `json:"phone"`
 	Type               string `json:"type"`                // "agency" | "developer"
 	VerificationStatus string `json:"verification_status"` // "pending" | "verified" | "rejected"
-	CreatedAt          string `json:"created_at"`
-	UpdatedAt          string `json:"updated_at"`
+	// TenantID is the community the company works in; see Tenant.
+	TenantID  int64  `json:"tenant_id"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
 }
 
 type CompanyStore struct {
@@ -50,11 +53,13 @@ func (s *CompanyStore) Create(ctx context.Context, tx *sql.Tx, company *Company)
 	emailHash := crypto.HashEmail(company.Email)
 
 	query := `
-		INSERT INTO companies (name, registration_number, city, email, email_hash, phone, type)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO companies (name, registration_number, city, country, email, email_hash, phone, type, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, verification_status, created_at, updated_at
 	`
 
+	company.TenantID = tenantOf(ctx)
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
@@ -64,10 +69,12 @@ func (s *CompanyStore) Create(ctx context.Context, tx *sql.Tx, company *Company)
 		company.Name,
 		company.RegistrationNumber,
 		company.City,
+		company.Country,
 		encryptedEmail,
 		emailHash,
 		encryptedPhone,
 		company.Type,
+		company.TenantID,
 	).Scan(
 		&company.ID,
 		&company.VerificationStatus,
@@ -75,14 +82,7 @@ func (s *CompanyStore) Create(ctx context.Context, tx *sql.Tx, company *Company)
 		&company.UpdatedAt,
 	)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "companies_registration_number_key"`:
-			return ErrDuplicateRegistrationNumber
-		case err.Error() == `pq: duplicate key value violates unique constraint "idx_companies_email_hash"`:
-			return ErrDuplicateCompanyEmail
-		default:
-			return err
-		}
+		return translateError(err)
 	}
 
 	return nil
@@ -94,9 +94,9 @@ func (s *CompanyStore) GetByID(ctx context.Context, id int64) (*Company, error)
 	}
 
 	query := `
-		SELECT id, name, registration_number, city, email, phone, type, verification_status, created_at, updated_at
+		SELECT id, name, registration_number, city, country, email, phone, type, verification_status, tenant_id, created_at, updated_at
 		FROM companies
-		WHERE id = $1
+		WHERE id = $1 AND ($2 = 0 OR tenant_id = $2)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -104,15 +104,17 @@ func (s *CompanyStore) GetByID(ctx context.Context, id int64) (*Company, error)
 
 	company := &Company{}
 	var encryptedEmail, encryptedPhone string
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	err := s.db.QueryRowContext(ctx, query, id, tenantScope(ctx)).Scan(
 		&company.ID,
 		&company.Name,
 		&company.RegistrationNumber,
 		&company.City,
+		&company.Country,
 		&encryptedEmail,
 		&encryptedPhone,
 		&company.Type,
 		&company.VerificationStatus,
+		&company.TenantID,
 		&company.CreatedAt,
 		&company.UpdatedAt,
 	)
@@ -143,9 +145,9 @@ func (s *CompanyStore) GetByRegistrationNumber(ctx context.Context, regNum strin
 	}
 
 	query := `
-		SELECT id, name, registration_number, city, email, phone, type, verification_status, created_at, updated_at
+		SELECT id, name, registration_number, city, country, email, phone, type, verification_status, tenant_id, created_at, updated_at
 		FROM companies
-		WHERE registration_number = $1
+		WHERE registration_number = $1 AND ($2 = 0 OR tenant_id = $2)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -153,15 +155,17 @@ func (s *CompanyStore) GetByRegistrationNumber(ctx context.Context, regNum strin
 
 	company := &Company{}
 	var encryptedEmail, encryptedPhone string
-	err := s.db.QueryRowContext(ctx, query, regNum).Scan(
+	err := s.db.QueryRowContext(ctx, query, regNum, tenantScope(ctx)).Scan(
 		&company.ID,
 		&company.Name,
 		&company.RegistrationNumber,
 		&company.City,
+		&company.Country,
 		&encryptedEmail,
 		&encryptedPhone,
 		&company.Type,
 		&company.VerificationStatus,
+		&company.TenantID,
 		&company.CreatedAt,
 		&company.UpdatedAt,
 	)
@@ -190,15 +194,15 @@ func (s *CompanyStore) UpdateVerificationStatus(ctx context.Context, id int64, s
 	query := `
 		UPDATE companies
 		SET verification_status = $1, updated_at = NOW()
-		WHERE id = $2
+		WHERE id = $2 AND ($3 = 0 OR tenant_id = $3)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	result, err := s.db.ExecContext(ctx, query, status, id)
+	result, err := s.db.ExecContext(ctx, query, status, id, tenantScope(ctx))
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	rows, err := result.RowsAffected()
@@ -220,6 +224,11 @@ func (s *CompanyStore) List(ctx context.Context, fq PaginatedFeedQuery) ([]Compa
 	var where []string
 	var args []any
 
+	if scope := tenantScope(ctx); scope != 0 {
+		where = append(where, fmt.Sprintf("tenant_id = $%d", len(args)+1))
+		args = append(args, scope)
+	}
+
 	if fq.Search != "" {
 		where = append(where, fmt.Sprintf("verification_status = $%d", len(args)+1))
 		args = append(args, fq.Search)
@@ -234,7 +243,7 @@ func (s *CompanyStore) List(ctx context.Context, fq PaginatedFeedQuery) ([]Compa
 	args = append(args, fq.Offset)
 
 	query := fmt.Sprintf(`
-		SELECT id, name, registration_number, city, email, phone, type, verification_status, created_at, updated_at
+		SELECT id, name, registration_number, city, country, email, phone, type, verification_status, tenant_id, created_at, updated_at
 		FROM companies
 		%s
 		ORDER BY created_at DESC
@@ -259,10 +268,12 @@ func (s *CompanyStore) List(ctx context.Context, fq PaginatedFeedQuery) ([]Compa
 			&c.Name,
 			&c.RegistrationNumber,
 			&c.City,
+			&c.Country,
 			&encryptedEmail,
 			&encryptedPhone,
 			&c.Type,
 			&c.VerificationStatus,
+			&c.TenantID,
 			&c.CreatedAt,
 			&c.UpdatedAt,
 		)
@@ -284,4 +295,3 @@ func (s *CompanyStore) List(ctx context.Context, fq PaginatedFeedQuery) ([]Compa
 
 	return companies, nil
 }
-
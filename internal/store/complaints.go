@@ -8,18 +8,23 @@ import (
 	"strings"
 )
 
+var ErrComplaintClosed = conflict("complaint is already closed")
+
 type Complaint struct {
-	ID          int64  `json:"id"`
-	Type        string `json:"type"`         // "incorrect_listing", "rule_violation", "fraud"
-	TargetType  string `json:"target_type"`  // "listing" | "company"
-	TargetID    int64  `json:"target_id"`
-	TargetName  string `json:"target_name"`  // joined from listings.title or companies.name
-	UserID      int64  `json:"user_id"`
-	AuthorName  string `json:"author_name"`  // joined from users.username
-	Description string `json:"description"`
-	Status      string `json:"status"`       // "new", "in_progress", "closed"
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
+	ID          int64   `json:"id"`
+	Type        string  `json:"type"`        // "incorrect_listing", "rule_violation", "fraud"
+	TargetType  string  `json:"target_type"` // "listing" | "company"
+	TargetID    int64   `json:"target_id"`
+	TargetName  string  `json:"target_name"` // joined from listings.title or companies.name
+	UserID      int64   `json:"user_id"`
+	AuthorName  string  `json:"author_name"` // joined from users.username
+	Description string  `json:"description"`
+	Status      string  `json:"status"`               // "new", "in_progress", "closed"
+	Resolution  string  `json:"resolution,omitempty"` // "dismissed" | "removed"
+	ResolvedBy  *int64  `json:"resolved_by,omitempty"`
+	ResolvedAt  *string `json:"resolved_at,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
 }
 
 type ComplaintFilter struct {
@@ -58,15 +63,16 @@ func (s *ComplaintStore) Create(ctx context.Context, c *Complaint) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return s.db.QueryRowContext(ctx, query,
+	return translateError(s.db.QueryRowContext(ctx, query,
 		c.Type, c.TargetType, c.TargetID, c.UserID, c.Description,
-	).Scan(&c.ID, &c.Status, &c.CreatedAt, &c.UpdatedAt)
+	).Scan(&c.ID, &c.Status, &c.CreatedAt, &c.UpdatedAt))
 }
 
 func (s *ComplaintStore) GetByID(ctx context.Context, id int64) (*Complaint, error) {
 	query := `
 		SELECT 
 			c.id, c.type, c.target_type, c.target_id, c.user_id, c.description, c.status, c.created_at, c.updated_at,
+			COALESCE(c.resolution, ''), c.resolved_by, c.resolved_at,
 			COALESCE(u.username, '') AS author_name,
 			CASE 
 				WHEN c.target_type = 'listing' THEN COALESCE(l.title, '')
@@ -77,17 +83,18 @@ func (s *ComplaintStore) GetByID(ctx context.Context, id int64) (*Complaint, err
 		LEFT JOIN users u ON c.user_id = u.id
 		LEFT JOIN listings l ON c.target_type = 'listing' AND c.target_id = l.id
 		LEFT JOIN companies co ON c.target_type = 'company' AND c.target_id = co.id
-		WHERE c.id = $1
+		WHERE c.id = $1 AND ($2 = 0 OR COALESCE(l.tenant_id, co.tenant_id) = $2)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	var comp Complaint
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	err := s.db.QueryRowContext(ctx, query, id, tenantScope(ctx)).Scan(
 		&comp.ID, &comp.Type, &comp.TargetType, &comp.TargetID,
 		&comp.UserID, &comp.Description, &comp.Status,
 		&comp.CreatedAt, &comp.UpdatedAt,
+		&comp.Resolution, &comp.ResolvedBy, &comp.ResolvedAt,
 		&comp.AuthorName, &comp.TargetName,
 	)
 	if err != nil {
@@ -111,6 +118,12 @@ func (s *ComplaintStore) List(ctx context.Context, filter ComplaintFilter) ([]Co
 		args = append(args, filter.Status)
 	}
 
+	// complaints belong to the tenant of what they report
+	if tenantID := tenantScope(ctx); tenantID != 0 {
+		args = append(args, tenantID)
+		where = append(where, fmt.Sprintf("COALESCE(l.tenant_id, co.tenant_id) = $%d", len(args)))
+	}
+
 	if len(where) == 0 {
 		where = append(where, "1=1")
 	}
@@ -121,6 +134,7 @@ func (s *ComplaintStore) List(ctx context.Context, filter ComplaintFilter) ([]Co
 	query := fmt.Sprintf(`
 		SELECT 
 			c.id, c.type, c.target_type, c.target_id, c.user_id, c.description, c.status, c.created_at, c.updated_at,
+			COALESCE(c.resolution, ''), c.resolved_by, c.resolved_at,
 			COALESCE(u.username, '') AS author_name,
 			CASE 
 				WHEN c.target_type = 'listing' THEN COALESCE(l.title, '')
@@ -152,6 +166,7 @@ func (s *ComplaintStore) List(ctx context.Context, filter ComplaintFilter) ([]Co
 			&comp.ID, &comp.Type, &comp.TargetType, &comp.TargetID,
 			&comp.UserID, &comp.Description, &comp.Status,
 			&comp.CreatedAt, &comp.UpdatedAt,
+			&comp.Resolution, &comp.ResolvedBy, &comp.ResolvedAt,
 			&comp.AuthorName, &comp.TargetName,
 		); err != nil {
 			return nil, err
@@ -167,15 +182,81 @@ func (s *ComplaintStore) List(ctx context.Context, filter ComplaintFilter) ([]Co
 }
 
 func (s *ComplaintStore) UpdateStatus(ctx context.Context, id int64, status string) error {
-	query := `UPDATE complaints SET status = $1, updated_at = NOW() WHERE id = $2`
+	query := `
+		UPDATE complaints c SET status = $1, updated_at = NOW()
+		WHERE id = $2 AND ($3 = 0 OR COALESCE(
+			(SELECT l.tenant_id FROM listings l WHERE c.target_type = 'listing' AND l.id = c.target_id),
+			(SELECT co.tenant_id FROM companies co WHERE c.target_type = 'company' AND co.id = c.target_id)
+		) = $3)
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	result, err := s.db.ExecContext(ctx, query, status, id)
+	result, err := s.db.ExecContext(ctx, query, status, id, tenantScope(ctx))
+	if err != nil {
+		return translateError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Resolve closes a complaint and records how and by whom it was resolved.
+// Only one of concurrent resolutions succeeds; the others get
+// ErrComplaintClosed.
+func (s *ComplaintStore) Resolve(ctx context.Context, id int64, resolution string, resolvedBy int64) error {
+	query := `
+		UPDATE complaints
+		SET status = 'closed', resolution = $1, resolved_by = $2, resolved_at = NOW(), updated_at = NOW()
+		WHERE id = $3 AND status <> 'closed'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, resolution, resolvedBy, id)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		if _, err := s.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrComplaintClosed
+	}
+
+	return nil
+}
+
+// Reopen undoes Resolve, putting a closed complaint back in status with no
+// resolution.
+func (s *ComplaintStore) Reopen(ctx context.Context, id int64, status string) error {
+	query := `
+		UPDATE complaints
+		SET status = $1, resolution = NULL, resolved_by = NULL, resolved_at = NULL, updated_at = NOW()
+		WHERE id = $2 AND status = 'closed'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, status, id)
+	if err != nil {
+		return translateError(err)
+	}
 
 	rows, err := result.RowsAffected()
 	if err != nil {
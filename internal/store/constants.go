@@ -9,6 +9,30 @@ const (
 	RoleModerator = "moderator"
 )
 
+// Permissions granted to roles; see Permissions for what each allows.
+const (
+	PermissionListingsWrite     = "listings.write"
+	PermissionComplaintsReview  = "complaints.review"
+	PermissionComplaintsResolve = "complaints.resolve"
+	PermissionUsersMute         = "users.mute"
+)
+
+// Team roles of company members
+const (
+	TeamRoleOwner   = "owner"
+	TeamRoleManager = "manager"
+	TeamRoleAgent   = "agent"
+)
+
+// User states
+const (
+	UserStatePending     = "pending"
+	UserStateActive      = "active"
+	UserStateSuspended   = "suspended"
+	UserStateDeactivated = "deactivated"
+	UserStateDeleted     = "deleted"
+)
+
 // Company verification statuses
 const (
 	VerificationPending  = "pending"
@@ -20,6 +44,7 @@ const (
 const (
 	ListingStatusDraft      = "draft"
 	ListingStatusModeration = "moderation"
+	ListingStatusScheduled  = "scheduled"
 	ListingStatusActive     = "active"
 	ListingStatusRejected   = "rejected"
 	ListingStatusArchived   = "archived"
@@ -46,3 +71,9 @@ const (
 	ComplaintStatusInProgress = "in_progress"
 	ComplaintStatusClosed     = "closed"
 )
+
+// Complaint resolutions
+const (
+	ComplaintResolutionDismissed = "dismissed"
+	ComplaintResolutionRemoved   = "removed"
+)
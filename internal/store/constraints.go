@@ -0,0 +1,119 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/lib/pq"
+)
+
+// Postgres error codes for constraint violations.
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqCheckViolation      = "23514"
+)
+
+// kindError is a sentinel that belongs to one of the general kinds
+// ErrConflict, ErrForeignKey or ErrCheckViolation, so errors.Is(err,
+// ErrConflict) holds for ErrDuplicateEmail and callers that only care about
+// the kind need not know every constraint.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func (e *kindError) Error() string { return e.msg }
+func (e *kindError) Unwrap() error { return e.kind }
+
+// conflict returns a sentinel for a unique constraint.
+func conflict(msg string) error { return &kindError{msg: msg, kind: ErrConflict} }
+
+// missingReference returns a sentinel for a foreign key to a missing row.
+func missingReference(msg string) error { return &kindError{msg: msg, kind: ErrForeignKey} }
+
+// ConstraintError is a constraint violation reported by Postgres. It
+// matches its sentinel, and through it the kind, with errors.Is, and wraps
+// the driver error so errors.As still finds the *pq.Error.
+type ConstraintError struct {
+	// Err is the sentinel for the constraint, e.g. ErrDuplicateEmail, or
+	// the kind when the constraint has none of its own.
+	Err error
+	// Constraint is the name of the violated constraint or unique index.
+	Constraint string
+	// Table is the table the statement wrote to.
+	Table string
+
+	cause *pq.Error
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Err == ErrCheckViolation {
+		return fmt.Sprintf("%s: %s", e.Err, e.Constraint)
+	}
+	return e.Err.Error()
+}
+
+func (e *ConstraintError) Unwrap() []error { return []error{e.Err, e.cause} }
+
+// constraintErrors maps constraint and unique index names to the error
+// returned when they are violated.
+var constraintErrors = map[string]error{
+	"users_tenant_email_hash_key":              ErrDuplicateEmail,
+	"users_tenant_username_lower_key":          ErrDuplicateUsername,
+	"users_tenant_phone_hash_key":              ErrDuplicatePhone,
+	"companies_tenant_registration_number_key": ErrDuplicateRegistrationNumber,
+	"companies_tenant_email_hash_key":          ErrDuplicateCompanyEmail,
+	"tenants_slug_key":                         ErrDuplicateTenantSlug,
+}
+
+// referencedErrors maps the table a foreign key points to to the error
+// returned when the referenced row is missing.
+var referencedErrors = map[string]error{
+	"users":    ErrForeignKeyUser,
+	"listings": ErrForeignKeyListing,
+}
+
+// inserts and updates report `Key (col)=(v) is not present in table "t".`;
+// deletes of a referenced row say `... is still referenced from table "t".`
+var (
+	notPresentDetail = regexp.MustCompile(`is not present in table "([^"]+)"\.$`)
+	referencedDetail = regexp.MustCompile(`is still referenced from table "([^"]+)"\.$`)
+)
+
+// translateError turns a constraint violation reported by Postgres into a
+// *ConstraintError so callers can use errors.Is instead of matching
+// messages. Named constraints map through constraintErrors; any other
+// unique violation is ErrConflict, a reference to a missing row is
+// ErrForeignKeyUser, ErrForeignKeyListing or else ErrForeignKey, deleting a
+// row that is still referenced is ErrReferenced and a failed CHECK is
+// ErrCheckViolation. Other errors are returned unchanged.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	sentinel, ok := constraintErrors[pqErr.Constraint]
+	if !ok {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			sentinel = ErrConflict
+		case pqForeignKeyViolation:
+			if m := notPresentDetail.FindStringSubmatch(pqErr.Detail); m != nil {
+				if sentinel, ok = referencedErrors[m[1]]; !ok {
+					sentinel = ErrForeignKey
+				}
+			} else if referencedDetail.MatchString(pqErr.Detail) {
+				sentinel = ErrReferenced
+			}
+		case pqCheckViolation:
+			sentinel = ErrCheckViolation
+		}
+	}
+	if sentinel == nil {
+		return err
+	}
+	return &ConstraintError{Err: sentinel, Constraint: pqErr.Constraint, Table: pqErr.Table, cause: pqErr}
+}
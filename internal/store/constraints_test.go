@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTranslateError(t *testing.T) {
+	other := errors.New("connection reset")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"named unique index", &pq.Error{Code: pqUniqueViolation, Constraint: "users_tenant_phone_hash_key"}, ErrDuplicatePhone},
+		{"other unique index", &pq.Error{Code: pqUniqueViolation, Constraint: "favorites_pkey"}, ErrConflict},
+		{"missing user", &pq.Error{Code: pqForeignKeyViolation, Constraint: "complaints_user_id_fkey",
+			Detail: `Key (user_id)=(7) is not present in table "users".`}, ErrForeignKeyUser},
+		{"missing listing", &pq.Error{Code: pqForeignKeyViolation, Constraint: "favorites_listing_id_fkey",
+			Detail: `Key (listing_id)=(7) is not present in table "listings".`}, ErrForeignKeyListing},
+		{"missing other row", &pq.Error{Code: pqForeignKeyViolation, Constraint: "users_company_id_fkey",
+			Detail: `Key (company_id)=(7) is not present in table "companies".`}, ErrForeignKey},
+		{"check", &pq.Error{Code: pqCheckViolation, Constraint: "complaints_status_check"}, ErrCheckViolation},
+		{"not a pq error", other, other},
+	}
+
+	for _, tt := range tests {
+		if got := translateError(tt.err); !errors.Is(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	referenced := &pq.Error{Code: pqForeignKeyViolation, Detail: `Key (id)=(7) is still referenced from table "favorites".`}
+	if got := translateError(referenced); !errors.Is(got, ErrReferenced) || !errors.Is(got, ErrConflict) {
+		t.Errorf("delete of a referenced row: got %v, want ErrReferenced", got)
+	}
+}
+
+func TestConstraintError(t *testing.T) {
+	cause := &pq.Error{Code: pqUniqueViolation, Constraint: "users_tenant_email_hash_key", Table: "users"}
+	err := fmt.Errorf("creating user: %w", translateError(cause))
+
+	var constraintErr *ConstraintError
+	if !errors.As(err, &constraintErr) {
+		t.Fatalf("got %T, want a *ConstraintError", err)
+	}
+	if constraintErr.Constraint != "users_tenant_email_hash_key" || constraintErr.Table != "users" {
+		t.Errorf("got constraint %q on %q", constraintErr.Constraint, constraintErr.Table)
+	}
+	if !errors.Is(err, ErrDuplicateEmail) || !errors.Is(err, ErrConflict) || errors.Is(err, ErrDuplicateUsername) {
+		t.Errorf("%v does not match its sentinel and kind only", err)
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr != cause {
+		t.Error("the driver error is not wrapped")
+	}
+	if constraintErr.Error() != ErrDuplicateEmail.Error() {
+		t.Errorf("message %q", constraintErr.Error())
+	}
+
+	// sentinels match their kind without a driver error, as the memory
+	// store returns them
+	for _, sentinel := range []error{ErrDuplicatePhone, ErrDuplicateCompanyEmail, ErrReferenced} {
+		if !errors.Is(sentinel, ErrConflict) {
+			t.Errorf("%v is not a conflict", sentinel)
+		}
+	}
+	if !errors.Is(ErrForeignKeyListing, ErrForeignKey) || errors.Is(ErrForeignKeyListing, ErrConflict) {
+		t.Error("ErrForeignKeyListing is not only a foreign key error")
+	}
+
+	check := translateError(&pq.Error{Code: pqCheckViolation, Constraint: "complaints_status_check"})
+	if check.Error() != "value is not allowed: complaints_status_check" {
+		t.Errorf("check message %q", check.Error())
+	}
+}
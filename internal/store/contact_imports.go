@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ContactImport is an address book or follow list uploaded from another
+// platform, matched against registered users in the background. Total
+// counts the entries read, of which Invalid could not be understood and
+// Unmatched belong to no one here; UserIDs are the users found.
+type ContactImport struct {
+	ID          int64   `json:"id"`
+	UserID      int64   `json:"user_id"`
+	Source      string  `json:"source"`
+	Status      string  `json:"status"`
+	Total       int     `json:"total"`
+	Invalid     int     `json:"invalid"`
+	Unmatched   int     `json:"unmatched"`
+	UserIDs     []int64 `json:"user_ids"`
+	Error       string  `json:"error,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	CompletedAt *string `json:"completed_at,omitempty"`
+}
+
+type ContactImportStore struct {
+	db *sql.DB
+}
+
+func (s *ContactImportStore) Create(ctx context.Context, imp *ContactImport) error {
+	query := `
+		INSERT INTO contact_imports (user_id, source, status)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if imp.Status == "" {
+		imp.Status = ImportPending
+	}
+	err := s.db.QueryRowContext(ctx, query, imp.UserID, imp.Source, imp.Status).Scan(&imp.ID, &imp.CreatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// Complete saves the outcome of a pending import, with the status and
+// counts of imp.
+func (s *ContactImportStore) Complete(ctx context.Context, imp *ContactImport) error {
+	query := `
+		UPDATE contact_imports
+		SET status = $2, total = $3, invalid = $4, unmatched = $5, user_ids = $6, error = $7, completed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING completed_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var completedAt string
+	err := s.db.QueryRowContext(ctx, query,
+		imp.ID, imp.Status, imp.Total, imp.Invalid, imp.Unmatched, pq.Array(imp.UserIDs), imp.Error,
+	).Scan(&completedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	imp.CompletedAt = &completedAt
+	return nil
+}
+
+// GetByID returns the import if it is userID's.
+func (s *ContactImportStore) GetByID(ctx context.Context, id, userID int64) (*ContactImport, error) {
+	query := `
+		SELECT id, user_id, source, status, total, invalid, unmatched, user_ids, error, created_at, completed_at
+		FROM contact_imports
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var imp ContactImport
+	var userIDs pq.Int64Array
+	err := s.db.QueryRowContext(ctx, query, id, userID).Scan(
+		&imp.ID, &imp.UserID, &imp.Source, &imp.Status, &imp.Total, &imp.Invalid, &imp.Unmatched,
+		&userIDs, &imp.Error, &imp.CreatedAt, &imp.CompletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	imp.UserIDs = []int64(userIDs)
+	return &imp, nil
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ContentFlagPending  = "pending"
+	ContentFlagApproved = "approved"
+	ContentFlagRemoved  = "removed"
+)
+
+// ContentFlag is a listing or application message the content filter held
+// for moderators.
+type ContentFlag struct {
+	ID         int64    `json:"id"`
+	TargetType string   `json:"target_type"` // "listing" | "message"
+	TargetID   int64    `json:"target_id"`
+	AuthorID   *int64   `json:"author_id,omitempty"`
+	Reasons    []string `json:"reasons"`
+	// Excerpt is the start of the content when it was flagged
+	Excerpt    string  `json:"excerpt"`
+	Status     string  `json:"status"`
+	ResolvedBy *int64  `json:"resolved_by,omitempty"`
+	ResolvedAt *string `json:"resolved_at,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+type ContentFlagStore struct {
+	db *sql.DB
+}
+
+func (s *ContentFlagStore) Create(ctx context.Context, flag *ContentFlag) error {
+	query := `
+		INSERT INTO content_flags (target_type, target_id, author_id, reasons, excerpt)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return translateError(s.db.QueryRowContext(ctx, query,
+		flag.TargetType, flag.TargetID, flag.AuthorID, pq.Array(flag.Reasons), flag.Excerpt,
+	).Scan(&flag.ID, &flag.Status, &flag.CreatedAt))
+}
+
+const contentFlagColumns = `id, target_type, target_id, author_id, reasons, excerpt, status, resolved_by, resolved_at, created_at`
+
+func scanContentFlag(row interface{ Scan(...any) error }) (ContentFlag, error) {
+	var f ContentFlag
+	var reasons pq.StringArray
+	err := row.Scan(&f.ID, &f.TargetType, &f.TargetID, &f.AuthorID, &reasons, &f.Excerpt, &f.Status, &f.ResolvedBy, &f.ResolvedAt, &f.CreatedAt)
+	f.Reasons = reasons
+	return f, err
+}
+
+func (s *ContentFlagStore) GetByID(ctx context.Context, id int64) (*ContentFlag, error) {
+	query := `SELECT ` + contentFlagColumns + ` FROM content_flags WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	f, err := scanContentFlag(s.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// List returns the flags in status, newest first; "" lists every status.
+func (s *ContentFlagStore) List(ctx context.Context, status string, fq PaginatedQuery) ([]ContentFlag, error) {
+	query := `
+		SELECT ` + contentFlagColumns + `
+		FROM content_flags
+		WHERE $1 = '' OR status = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, status, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []ContentFlag{}
+	for rows.Next() {
+		f, err := scanContentFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// Resolve closes a pending flag with status, approved or removed. A flag
+// that is already closed is ErrConflict.
+func (s *ContentFlagStore) Resolve(ctx context.Context, id int64, status string, moderatorID int64) error {
+	query := `
+		UPDATE content_flags
+		SET status = $2, resolved_by = $3, resolved_at = NOW()
+		WHERE id = $1 AND status = 'pending'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, status, moderatorID)
+	if err != nil {
+		return translateError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		if _, err := s.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Conversation is a direct message thread as seen by one of its two users;
+// UserID and Username are the other participant.
+type Conversation struct {
+	ID            int64   `json:"id"`
+	UserID        int64   `json:"user_id"`
+	Username      string  `json:"username"`
+	Unread        int     `json:"unread"`
+	LastMessageAt *string `json:"last_message_at,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+}
+
+type DirectMessage struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversation_id"`
+	SenderID       int64  `json:"sender_id"`
+	Body           string `json:"body"`
+	CreatedAt      string `json:"created_at"`
+	// Hidden is set by CreateMessage when the sender is muted; the
+	// recipient never sees the message
+	Hidden bool `json:"-"`
+}
+
+type ConversationStore struct {
+	db *sql.DB
+}
+
+// conversationPair orders two users the way conversations stores them.
+func conversationPair(userID, otherID int64) (int64, int64) {
+	if userID < otherID {
+		return userID, otherID
+	}
+	return otherID, userID
+}
+
+// conversationSummary selects conversations as seen by $1. Unread counts the
+// other user's visible messages after $1's read marker. Conversations with a
+// user either side has blocked are left out.
+var conversationSummary = `
+	SELECT c.id, u.id, u.username, c.last_message_at, c.created_at,
+	       (SELECT COUNT(*) FROM direct_messages m
+	        WHERE m.conversation_id = c.id AND m.sender_id <> $1 AND NOT m.is_hidden
+	          AND m.id > CASE WHEN c.user_a = $1 THEN c.last_read_a ELSE c.last_read_b END)
+	FROM conversations c
+	JOIN users u ON u.id = CASE WHEN c.user_a = $1 THEN c.user_b ELSE c.user_a END
+	WHERE (c.user_a = $1 OR c.user_b = $1) AND ` + notBlocked("u.id") + `
+`
+
+func scanConversation(row interface{ Scan(...any) error }) (Conversation, error) {
+	var c Conversation
+	var lastMessageAt sql.NullString
+	err := row.Scan(&c.ID, &c.UserID, &c.Username, &lastMessageAt, &c.CreatedAt, &c.Unread)
+	if lastMessageAt.Valid {
+		c.LastMessageAt = &lastMessageAt.String
+	}
+	return c, err
+}
+
+// Open returns the conversation between userID and otherID, starting it if
+// they have none.
+func (s *ConversationStore) Open(ctx context.Context, userID, otherID int64) (*Conversation, error) {
+	userA, userB := conversationPair(userID, otherID)
+	query := `
+		INSERT INTO conversations (user_a, user_b) VALUES ($1, $2)
+		ON CONFLICT (user_a, user_b) DO UPDATE SET user_a = EXCLUDED.user_a
+		RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var id int64
+	if err := s.db.QueryRowContext(ctx, query, userA, userB).Scan(&id); err != nil {
+		return nil, translateError(err)
+	}
+	return s.Get(ctx, id, userID)
+}
+
+// Get returns the conversation as seen by userID. It returns ErrNotFound
+// when userID is not part of it.
+func (s *ConversationStore) Get(ctx context.Context, id, userID int64) (*Conversation, error) {
+	query := conversationSummary + ` AND c.id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	c, err := scanConversation(s.db.QueryRowContext(ctx, query, userID, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// List returns userID's conversations, most recently active first.
+func (s *ConversationStore) List(ctx context.Context, userID int64, fq PaginatedQuery) ([]Conversation, error) {
+	query := conversationSummary + `
+		ORDER BY COALESCE(c.last_message_at, c.created_at) DESC, c.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// CreateMessage stores msg and marks it read for its sender. Messages from
+// muted senders are stored hidden and do not move the conversation up for
+// the other user.
+func (s *ConversationStore) CreateMessage(ctx context.Context, msg *DirectMessage) error {
+	if err := Limits.Apply(LimitMessage, &msg.Body); err != nil {
+		return err
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		insert := `
+			INSERT INTO direct_messages (conversation_id, sender_id, body, is_hidden)
+			VALUES ($1, $2, $3, COALESCE((SELECT is_muted FROM users WHERE id = $2), false))
+			RETURNING id, created_at, is_hidden
+		`
+		if err := tx.QueryRowContext(ctx, insert, msg.ConversationID, msg.SenderID, msg.Body).Scan(&msg.ID, &msg.CreatedAt, &msg.Hidden); err != nil {
+			return err
+		}
+
+		update := `
+			UPDATE conversations SET
+				last_message_at = CASE WHEN $3 THEN last_message_at ELSE NOW() END,
+				last_read_a = CASE WHEN user_a = $2 THEN $4 ELSE last_read_a END,
+				last_read_b = CASE WHEN user_b = $2 THEN $4 ELSE last_read_b END
+			WHERE id = $1
+		`
+		_, err := tx.ExecContext(ctx, update, msg.ConversationID, msg.SenderID, msg.Hidden, msg.ID)
+		return err
+	})
+}
+
+// ListMessages returns up to limit messages of the conversation older than
+// the message before, newest first; a zero before starts from the newest.
+// Hidden messages are only returned to their sender.
+func (s *ConversationStore) ListMessages(ctx context.Context, conversationID, viewerID, before int64, limit int) ([]DirectMessage, error) {
+	query := `
+		SELECT id, conversation_id, sender_id, body, created_at
+		FROM direct_messages
+		WHERE conversation_id = $1
+		  AND (NOT is_hidden OR sender_id = $2)
+		  AND ($3 = 0 OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, conversationID, viewerID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []DirectMessage{}
+	for rows.Next() {
+		var m DirectMessage
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// MarkRead moves userID's read marker up to messageID. It never moves it
+// back.
+func (s *ConversationStore) MarkRead(ctx context.Context, conversationID, userID, messageID int64) error {
+	query := `
+		UPDATE conversations SET
+			last_read_a = CASE WHEN user_a = $2 THEN GREATEST(last_read_a, $3) ELSE last_read_a END,
+			last_read_b = CASE WHEN user_b = $2 THEN GREATEST(last_read_b, $3) ELSE last_read_b END
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, conversationID, userID, messageID)
+	return err
+}
+
+// UnreadCount returns the number of unread messages across all of userID's
+// conversations, leaving out blocked ones as List does.
+func (s *ConversationStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM direct_messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE (c.user_a = $1 OR c.user_b = $1)
+		  AND m.sender_id <> $1 AND NOT m.is_hidden
+		  AND m.id > CASE WHEN c.user_a = $1 THEN c.last_read_a ELSE c.last_read_b END
+		  AND ` + notBlocked("m.sender_id") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// Exists reports whether the two users have a conversation, blocked or not.
+func (s *ConversationStore) Exists(ctx context.Context, userID, otherID int64) (bool, error) {
+	userA, userB := conversationPair(userID, otherID)
+	query := `SELECT EXISTS (SELECT 1 FROM conversations WHERE user_a = $1 AND user_b = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var exists bool
+	err := s.db.QueryRowContext(ctx, query, userA, userB).Scan(&exists)
+	return exists, err
+}
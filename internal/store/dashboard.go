@@ -42,7 +42,7 @@ func (s *DashboardStore) GetOverview(ctx context.Context, userID int64) (*Dashbo
 
 	// 1. Favorites count
 	err := s.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM favorites WHERE user_id = $1`, userID,
+		`SELECT COUNT(*) FROM favorites f JOIN listings l ON l.id = f.listing_id AND l.deleted_at IS NULL WHERE f.user_id = $1`, userID,
 	).Scan(&overview.FavoritesCount)
 	if err != nil {
 		return nil, err
@@ -50,7 +50,7 @@ func (s *DashboardStore) GetOverview(ctx context.Context, userID int64) (*Dashbo
 
 	// 2. Active applications count (status IN ('new', 'review'))
 	err = s.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM applications WHERE user_id = $1 AND status IN ('new', 'review')`, userID,
+		`SELECT COUNT(*) FROM applications a JOIN listings l ON l.id = a.listing_id AND l.deleted_at IS NULL WHERE a.user_id = $1 AND a.status IN ('new', 'review')`, userID,
 	).Scan(&overview.ActiveApplicationsCount)
 	if err != nil {
 		return nil, err
@@ -61,9 +61,11 @@ func (s *DashboardStore) GetOverview(ctx context.Context, userID int64) (*Dashbo
 		SELECT COUNT(*)
 		FROM application_messages am
 		JOIN applications a ON am.application_id = a.id
+		JOIN listings l ON l.id = a.listing_id AND l.deleted_at IS NULL
 		WHERE a.user_id = $1
 		  AND am.sender_user_id IS DISTINCT FROM $1
 		  AND am.is_read = false
+		  AND am.is_hidden = false
 	`, userID).Scan(&overview.UnreadMessagesCount)
 	if err != nil {
 		return nil, err
@@ -75,7 +77,7 @@ func (s *DashboardStore) GetOverview(ctx context.Context, userID int64) (*Dashbo
 		       COALESCE((SELECT url FROM listing_media WHERE listing_id = l.id ORDER BY position ASC, id ASC LIMIT 1), '') AS cover_url,
 		       f.created_at
 		FROM favorites f
-		JOIN listings l ON f.listing_id = l.id
+		JOIN listings l ON f.listing_id = l.id AND l.deleted_at IS NULL
 		WHERE f.user_id = $1
 		ORDER BY f.created_at DESC
 		LIMIT 5
@@ -107,7 +109,7 @@ func (s *DashboardStore) GetOverview(ctx context.Context, userID int64) (*Dashbo
 	recentAppsRows, err := s.db.QueryContext(ctx, `
 		SELECT a.id, l.title, c.name, a.status, a.updated_at
 		FROM applications a
-		JOIN listings l ON a.listing_id = l.id
+		JOIN listings l ON a.listing_id = l.id AND l.deleted_at IS NULL
 		JOIN companies c ON l.company_id = c.id
 		WHERE a.user_id = $1
 		ORDER BY a.updated_at DESC
@@ -148,14 +150,16 @@ func (s *DashboardStore) ListChats(ctx context.Context, userID int64) ([]ChatSum
 				WHERE um.application_id = a.id
 				  AND um.sender_user_id IS DISTINCT FROM $1
 				  AND um.is_read = false
+				  AND um.is_hidden = false
 			) AS is_unread
 		FROM applications a
-		JOIN listings l ON a.listing_id = l.id
+		JOIN listings l ON a.listing_id = l.id AND l.deleted_at IS NULL
 		JOIN companies c ON l.company_id = c.id
 		JOIN LATERAL (
 			SELECT body, created_at
 			FROM application_messages
 			WHERE application_id = a.id
+			  AND (is_hidden = false OR sender_user_id = $1)
 			ORDER BY created_at DESC, id DESC
 			LIMIT 1
 		) latest_msg ON true
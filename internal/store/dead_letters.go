@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+)
+
+// DeadLetter is an outbox email the relay gave up on, with the message it
+// would have sent. Lists leave out the recipient, data and message; GetByID
+// fills them in. Subject and Body are empty for emails given up on before
+// dead letters existed, or when the template could not be rendered.
+type DeadLetter struct {
+	ID       int64           `json:"id"`
+	OutboxID int64           `json:"outbox_id"`
+	Template string          `json:"template"`
+	Username string          `json:"username"`
+	Email    string          `json:"email,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Subject  string          `json:"subject,omitempty"`
+	Body     string          `json:"body,omitempty"`
+	Attempts int             `json:"attempts"`
+	// LastError is why the last attempt failed.
+	LastError   string    `json:"last_error"`
+	TriggeredBy Principal `json:"triggered_by"`
+	QueuedAt    string    `json:"queued_at"`
+	FailedAt    string    `json:"failed_at"`
+}
+
+type DeadLetterStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+// deadLetterEmail moves the unsent outbox email id to the dead letters in
+// tx, recording its last attempt and the rendered message.
+func deadLetterEmail(ctx context.Context, tx *sql.Tx, cryptor *crypto.Service, id int64, lastError, subject, body string) error {
+	encryptedSubject, err := cryptor.EncryptString(subject)
+	if err != nil {
+		return err
+	}
+	encryptedBody, err := cryptor.EncryptString(body)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO email_dead_letters (outbox_id, template, username, email, data, subject, body, attempts, last_error,
+			triggered_by_kind, triggered_by_id, queued_at)
+		SELECT id, template, username, email, data, $2, $3, attempts + 1, $4, triggered_by_kind, triggered_by_id, created_at
+		FROM email_outbox
+		WHERE id = $1 AND sent_at IS NULL
+	`
+
+	res, err := tx.ExecContext(ctx, query, id, encryptedSubject, encryptedBody, lastError)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM email_outbox WHERE id = $1`, id)
+	return err
+}
+
+// List returns the dead letters newest first, without their recipient,
+// data or message.
+func (s *DeadLetterStore) List(ctx context.Context, fq PaginatedQuery) ([]DeadLetter, error) {
+	query := `
+		SELECT id, outbox_id, template, username, attempts, last_error,
+			triggered_by_kind, COALESCE(triggered_by_id, 0), queued_at, failed_at
+		FROM email_dead_letters
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []DeadLetter{}
+	for rows.Next() {
+		var d DeadLetter
+		if err := rows.Scan(&d.ID, &d.OutboxID, &d.Template, &d.Username, &d.Attempts, &d.LastError,
+			&d.TriggeredBy.Kind, &d.TriggeredBy.ID, &d.QueuedAt, &d.FailedAt); err != nil {
+			return nil, err
+		}
+		letters = append(letters, d)
+	}
+	return letters, rows.Err()
+}
+
+// GetByID returns the dead letter with its recipient, data and message
+// decrypted.
+func (s *DeadLetterStore) GetByID(ctx context.Context, id int64) (*DeadLetter, error) {
+	query := `
+		SELECT id, outbox_id, template, username, email, data, subject, body, attempts, last_error,
+			triggered_by_kind, COALESCE(triggered_by_id, 0), queued_at, failed_at
+		FROM email_dead_letters
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var d DeadLetter
+	var data string
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&d.ID, &d.OutboxID, &d.Template, &d.Username, &d.Email, &data,
+		&d.Subject, &d.Body, &d.Attempts, &d.LastError, &d.TriggeredBy.Kind, &d.TriggeredBy.ID, &d.QueuedAt, &d.FailedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []*string{&d.Email, &data, &d.Subject, &d.Body} {
+		if *field == "" {
+			continue
+		}
+		if *field, err = s.cryptor.DecryptString(*field); err != nil {
+			return nil, err
+		}
+	}
+	d.Data = json.RawMessage(data)
+	return &d, nil
+}
+
+// Retry queues the dead letter's email again as a new outbox email, with
+// a fresh set of attempts, and removes the dead letter.
+func (s *DeadLetterStore) Retry(ctx context.Context, id int64) (*OutboxEmail, error) {
+	query := `
+		DELETE FROM email_dead_letters WHERE id = $1
+		RETURNING template, username, email, data
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var email OutboxEmail
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var data string
+		err := tx.QueryRowContext(ctx, query, id).Scan(&email.Template, &email.Username, &email.Email, &data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if email.Email, err = s.cryptor.DecryptString(email.Email); err != nil {
+			return err
+		}
+		if data, err = s.cryptor.DecryptString(data); err != nil {
+			return err
+		}
+		email.Data = json.RawMessage(data)
+		return enqueueEmail(ctx, tx, s.cryptor, &email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &email, nil
+}
+
+// Discard deletes the dead letter.
+func (s *DeadLetterStore) Discard(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM email_dead_letters WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Count returns the number of dead letters.
+func (s *DeadLetterStore) Count(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM email_dead_letters`).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// DeliveryWindow is the hour, in the user's timezone, in which notification
+// emails should arrive. Transactional emails ignore it.
+type DeliveryWindow struct {
+	Timezone  string `json:"timezone"`
+	StartHour int    `json:"start_hour"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type DeliveryWindowStore struct {
+	db *sql.DB
+}
+
+// Get returns the user's window, or ErrNotFound if they have not chosen one.
+func (s *DeliveryWindowStore) Get(ctx context.Context, userID int64) (*DeliveryWindow, error) {
+	query := `SELECT timezone, start_hour, updated_at FROM email_delivery_windows WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var window DeliveryWindow
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&window.Timezone, &window.StartHour, &window.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &window, nil
+}
+
+// Set creates or replaces the user's window.
+func (s *DeliveryWindowStore) Set(ctx context.Context, userID int64, window *DeliveryWindow) error {
+	query := `
+		INSERT INTO email_delivery_windows (user_id, timezone, start_hour)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET timezone = $2, start_hour = $3, updated_at = NOW()
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return translateError(s.db.QueryRowContext(ctx, query, userID, window.Timezone, window.StartHour).Scan(&window.UpdatedAt))
+}
+
+// Delete removes the user's window so emails are sent right away again.
+func (s *DeliveryWindowStore) Delete(ctx context.Context, userID int64) error {
+	query := `DELETE FROM email_delivery_windows WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/lib/pq"
+)
+
+// EmailChange is a pending email change. It is applied only after both the
+// current and the new address confirm it.
+type EmailChange struct {
+	UserID         int64      `json:"-"`
+	NewEmail       string     `json:"new_email"`
+	OldConfirmedAt *time.Time `json:"old_confirmed_at"`
+	NewConfirmedAt *time.Time `json:"new_confirmed_at"`
+	Expiry         time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Completed      bool       `json:"completed"`
+}
+
+type EmailChangeStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+// Create replaces any pending change for the user and queues the two
+// confirmation emails in the same transaction. oldToken and newToken are
+// stored as given, callers pass hashes.
+func (s *EmailChangeStore) Create(ctx context.Context, change *EmailChange, oldToken, newToken string, notifications []*OutboxEmail) error {
+	encryptedEmail, err := s.cryptor.EncryptString(change.NewEmail)
+	if err != nil {
+		return err
+	}
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		qctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var taken bool
+		// emails are unique within the user's tenant
+		err := tx.QueryRowContext(qctx, `
+			SELECT EXISTS (SELECT 1 FROM users WHERE email_hash = $1
+				AND tenant_id = (SELECT tenant_id FROM users WHERE id = $2))`,
+			crypto.HashEmail(change.NewEmail), change.UserID).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateEmail
+		}
+
+		query := `
+			INSERT INTO user_email_changes (user_id, new_email, new_email_hash, old_token, new_token, expiry)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id) DO UPDATE SET
+				new_email = EXCLUDED.new_email,
+				new_email_hash = EXCLUDED.new_email_hash,
+				old_token = EXCLUDED.old_token,
+				new_token = EXCLUDED.new_token,
+				old_confirmed_at = NULL,
+				new_confirmed_at = NULL,
+				expiry = EXCLUDED.expiry,
+				created_at = NOW()
+			RETURNING created_at
+		`
+
+		err = tx.QueryRowContext(
+			qctx,
+			query,
+			change.UserID,
+			encryptedEmail,
+			crypto.HashEmail(change.NewEmail),
+			oldToken,
+			newToken,
+			change.Expiry,
+		).Scan(&change.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, email := range notifications {
+			if err := enqueueEmail(ctx, tx, s.cryptor, email); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *EmailChangeStore) GetByUserID(ctx context.Context, userID int64) (*EmailChange, error) {
+	query := `
+		SELECT user_id, new_email, old_confirmed_at, new_confirmed_at, expiry, created_at
+		FROM user_email_changes
+		WHERE user_id = $1 AND expiry > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	change := &EmailChange{}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&change.UserID,
+		&change.NewEmail,
+		&change.OldConfirmedAt,
+		&change.NewConfirmedAt,
+		&change.Expiry,
+		&change.CreatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if change.NewEmail, err = s.cryptor.DecryptString(change.NewEmail); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// Confirm records the confirmation for whichever side the token stored
+// under one of hashes belongs to, see tokens.Lookup. Each side confirms
+// once; a token used already returns ErrNotFound. Once both sides are
+// confirmed the user's email is updated and the pending change removed; the
+// returned change has Completed set.
+func (s *EmailChangeStore) Confirm(ctx context.Context, hashes []string) (*EmailChange, error) {
+	if len(hashes) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var change *EmailChange
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE user_email_changes SET
+				old_confirmed_at = CASE WHEN old_token = ANY($1) THEN NOW() ELSE old_confirmed_at END,
+				new_confirmed_at = CASE WHEN new_token = ANY($1) THEN NOW() ELSE new_confirmed_at END
+			WHERE ((old_token = ANY($1) AND old_confirmed_at IS NULL) OR (new_token = ANY($1) AND new_confirmed_at IS NULL))
+				AND expiry > NOW()
+			RETURNING user_id, new_email, new_email_hash, old_confirmed_at, new_confirmed_at, expiry, created_at
+		`
+
+		qctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		change = &EmailChange{}
+		var emailHash string
+		err := tx.QueryRowContext(qctx, query, pq.Array(hashes)).Scan(
+			&change.UserID,
+			&change.NewEmail,
+			&emailHash,
+			&change.OldConfirmedAt,
+			&change.NewConfirmedAt,
+			&change.Expiry,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		encryptedEmail := change.NewEmail
+		if change.NewEmail, err = s.cryptor.DecryptString(encryptedEmail); err != nil {
+			return err
+		}
+
+		if change.OldConfirmedAt == nil || change.NewConfirmedAt == nil {
+			return nil
+		}
+
+		_, err = tx.ExecContext(qctx, `UPDATE users SET email = $1, email_hash = $2 WHERE id = $3`, encryptedEmail, emailHash, change.UserID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(qctx, `DELETE FROM user_email_changes WHERE user_id = $1`, change.UserID); err != nil {
+			return err
+		}
+
+		change.Completed = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+func (s *EmailChangeStore) Delete(ctx context.Context, userID int64) error {
+	query := `DELETE FROM user_email_changes WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
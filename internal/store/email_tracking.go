@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+)
+
+const (
+	TrackingEventSent  = "sent"
+	TrackingEventOpen  = "open"
+	TrackingEventClick = "click"
+)
+
+// TrackingEvent is a tracked email being sent, opened or clicked. URL is
+// the link followed by a click.
+type TrackingEvent struct {
+	ID        int64  `json:"id"`
+	OutboxID  int64  `json:"outbox_id"`
+	Template  string `json:"template"`
+	Kind      string `json:"kind"`
+	URL       string `json:"url,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// TrackingStats aggregates the events of one template. Opened and Clicked
+// count emails, Opens and Clicks every event, so a message opened twice
+// adds one to Opened and two to Opens.
+type TrackingStats struct {
+	Template string `json:"template"`
+	Sent     int    `json:"sent"`
+	Opened   int    `json:"opened"`
+	Clicked  int    `json:"clicked"`
+	Opens    int    `json:"opens"`
+	Clicks   int    `json:"clicks"`
+}
+
+type EmailTrackingStore struct {
+	db *sql.DB
+}
+
+func (s *EmailTrackingStore) Record(ctx context.Context, event *TrackingEvent) error {
+	query := `
+		INSERT INTO email_tracking_events (outbox_id, template, kind, url)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, event.OutboxID, event.Template, event.Kind, event.URL).Scan(&event.ID, &event.CreatedAt)
+}
+
+// Stats aggregates the events since the given time by template.
+func (s *EmailTrackingStore) Stats(ctx context.Context, since time.Time) ([]TrackingStats, error) {
+	query := `
+		SELECT template,
+			COUNT(DISTINCT outbox_id) FILTER (WHERE kind = 'sent'),
+			COUNT(DISTINCT outbox_id) FILTER (WHERE kind = 'open'),
+			COUNT(DISTINCT outbox_id) FILTER (WHERE kind = 'click'),
+			COUNT(*) FILTER (WHERE kind = 'open'),
+			COUNT(*) FILTER (WHERE kind = 'click')
+		FROM email_tracking_events
+		WHERE created_at >= $1
+		GROUP BY template
+		ORDER BY template
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []TrackingStats{}
+	for rows.Next() {
+		var st TrackingStats
+		if err := rows.Scan(&st.Template, &st.Sent, &st.Opened, &st.Clicked, &st.Opens, &st.Clicks); err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+func (s *EmailTrackingStore) SetOptOut(ctx context.Context, userID int64, optOut bool) error {
+	query := `DELETE FROM email_tracking_opt_outs WHERE user_id = $1`
+	if optOut {
+		query = `INSERT INTO email_tracking_opt_outs (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING`
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// OptedOut reports whether the user with this email opted out of tracking.
+// Addresses without an account are tracked.
+func (s *EmailTrackingStore) OptedOut(ctx context.Context, email string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM email_tracking_opt_outs o
+			JOIN users u ON u.id = o.user_id
+			WHERE u.email_hash = $1
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var optedOut bool
+	err := s.db.QueryRowContext(ctx, query, crypto.HashEmail(email)).Scan(&optedOut)
+	return optedOut, err
+}
@@ -3,6 +3,9 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
 )
 
 type FavoriteListing struct {
@@ -15,6 +18,13 @@ type FavoriteListing struct {
 	CreatedAt string   `json:"created_at"`
 }
 
+// FavoriteStats is how many users saved a listing and whether the user
+// asking is one of them.
+type FavoriteStats struct {
+	Count  int
+	ByUser bool
+}
+
 type FavoriteStore struct {
 	db *sql.DB
 }
@@ -26,14 +36,10 @@ func (s *FavoriteStore) Add(ctx context.Context, userID, listingID int64) error
 	defer cancel()
 
 	_, err := s.db.ExecContext(ctx, query, userID, listingID)
-	if err != nil {
-		if err.Error() == `pq: duplicate key value violates unique constraint "favorites_pkey"` {
-			return ErrConflict
-		}
-		return err
+	if err = translateError(err); errors.Is(err, ErrForeignKeyListing) {
+		return ErrNotFound
 	}
-
-	return nil
+	return err
 }
 
 func (s *FavoriteStore) Remove(ctx context.Context, userID, listingID int64) error {
@@ -58,27 +64,75 @@ func (s *FavoriteStore) Remove(ctx context.Context, userID, listingID int64) err
 	return nil
 }
 
+// Stats returns the favorite counts of the listings, keyed by listing ID.
+// Listings nobody saved are left out. userID 0 is an anonymous caller.
+func (s *FavoriteStore) Stats(ctx context.Context, userID int64, listingIDs []int64) (map[int64]FavoriteStats, error) {
+	query := `
+		SELECT listing_id, COUNT(*), BOOL_OR(user_id = $2)
+		FROM favorites
+		WHERE listing_id = ANY($1)
+		GROUP BY listing_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(listingIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[int64]FavoriteStats, len(listingIDs))
+	for rows.Next() {
+		var listingID int64
+		var st FavoriteStats
+		if err := rows.Scan(&listingID, &st.Count, &st.ByUser); err != nil {
+			return nil, err
+		}
+		stats[listingID] = st
+	}
+
+	return stats, rows.Err()
+}
+
 func (s *FavoriteStore) ListByUser(ctx context.Context, userID int64) ([]FavoriteListing, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var favorites []FavoriteListing
+	err := s.Each(ctx, userID, func(f FavoriteListing) error {
+		favorites = append(favorites, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return favorites, nil
+}
+
+// Each streams the user's favorites, newest first, calling fn for every row
+// without loading them all into memory. It stops at the first error from fn.
+// The caller's context bounds the query, so exports are not cut off by
+// QueryTimeoutDuration.
+func (s *FavoriteStore) Each(ctx context.Context, userID int64, fn func(FavoriteListing) error) error {
 	query := `
 		SELECT l.id, l.title, l.city, l.price, l.area,
 		       COALESCE((SELECT url FROM listing_media WHERE listing_id = l.id ORDER BY position ASC, id ASC LIMIT 1), '') AS cover_url,
 		       f.created_at
 		FROM favorites f
-		JOIN listings l ON f.listing_id = l.id
+		JOIN listings l ON f.listing_id = l.id AND l.deleted_at IS NULL
 		WHERE f.user_id = $1
 		ORDER BY f.created_at DESC
 	`
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
 	rows, err := s.db.QueryContext(ctx, query, userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var favorites []FavoriteListing
 	for rows.Next() {
 		var f FavoriteListing
 		var area sql.NullFloat64
@@ -91,23 +145,22 @@ func (s *FavoriteStore) ListByUser(ctx context.Context, userID int64) ([]Favorit
 			&f.CoverURL,
 			&f.CreatedAt,
 		); err != nil {
-			return nil, err
+			return err
 		}
 		if area.Valid {
 			f.Area = &area.Float64
 		}
-		favorites = append(favorites, f)
-	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+		if err := fn(f); err != nil {
+			return err
+		}
 	}
 
-	return favorites, nil
+	return rows.Err()
 }
 
 func (s *FavoriteStore) Count(ctx context.Context, userID int64) (int, error) {
-	query := `SELECT COUNT(*) FROM favorites WHERE user_id = $1`
+	query := `SELECT COUNT(*) FROM favorites f JOIN listings l ON l.id = f.listing_id AND l.deleted_at IS NULL WHERE f.user_id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrInviteQuota is returned when a user has created all the invite codes
+// they are allowed.
+var ErrInviteQuota = errors.New("no invite codes left")
+
+// InviteCode admits registrations while the deployment is invite-only.
+type InviteCode struct {
+	ID        int64      `json:"id"`
+	Code      string     `json:"code"`
+	CreatedBy *int64     `json:"created_by,omitempty"`
+	Admin     bool       `json:"admin"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type InviteCodeStore struct {
+	db *sql.DB
+}
+
+const inviteCodeColumns = `id, code, created_by, admin, max_uses, uses, expires_at, created_at`
+
+func scanInviteCode(row interface{ Scan(...any) error }, code *InviteCode) error {
+	return row.Scan(&code.ID, &code.Code, &code.CreatedBy, &code.Admin, &code.MaxUses, &code.Uses, &code.ExpiresAt, &code.CreatedAt)
+}
+
+// Create stores an admin code. A code that is taken returns ErrConflict.
+func (s *InviteCodeStore) Create(ctx context.Context, code *InviteCode) error {
+	query := `
+		INSERT INTO invite_codes (code, created_by, admin, max_uses, expires_at)
+		VALUES ($1, $2, true, $3, $4)
+		RETURNING ` + inviteCodeColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := scanInviteCode(s.db.QueryRowContext(ctx, query, code.Code, code.CreatedBy, code.MaxUses, code.ExpiresAt), code)
+	return translateError(err)
+}
+
+// CreateForUser stores a single-use code made by userID, unless the user
+// already made quota codes, in which case it returns ErrInviteQuota.
+func (s *InviteCodeStore) CreateForUser(ctx context.Context, userID int64, code *InviteCode, quota int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		// serialize concurrent requests of the same user
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+			return err
+		}
+
+		var made int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM invite_codes WHERE created_by = $1 AND NOT admin`, userID).Scan(&made)
+		if err != nil {
+			return err
+		}
+		if made >= quota {
+			return ErrInviteQuota
+		}
+
+		query := `
+			INSERT INTO invite_codes (code, created_by, admin, max_uses, expires_at)
+			VALUES ($1, $2, false, 1, $3)
+			RETURNING ` + inviteCodeColumns
+		return scanInviteCode(tx.QueryRowContext(ctx, query, code.Code, userID, code.ExpiresAt), code)
+	})
+}
+
+// Reserve takes one use of code for a registration in progress. Unknown,
+// expired and used up codes return ErrNotFound. The use is given back with
+// Release if the registration fails, or recorded with Redeem.
+func (s *InviteCodeStore) Reserve(ctx context.Context, code string) (*InviteCode, error) {
+	query := `
+		UPDATE invite_codes SET uses = uses + 1
+		WHERE code = $1 AND uses < max_uses AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING ` + inviteCodeColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	invite := &InviteCode{}
+	if err := scanInviteCode(s.db.QueryRowContext(ctx, query, code), invite); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return invite, nil
+}
+
+// Release gives back a use taken by Reserve.
+func (s *InviteCodeStore) Release(ctx context.Context, id int64) error {
+	query := `UPDATE invite_codes SET uses = uses - 1 WHERE id = $1 AND uses > 0`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Redeem records that userID registered with the code.
+func (s *InviteCodeStore) Redeem(ctx context.Context, id, userID int64) error {
+	query := `INSERT INTO invite_code_redemptions (code_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, userID)
+	return translateError(err)
+}
+
+// Revoke expires code now; it returns ErrNotFound for unknown codes.
+func (s *InviteCodeStore) Revoke(ctx context.Context, code string) (*InviteCode, error) {
+	query := `
+		UPDATE invite_codes SET expires_at = NOW()
+		WHERE code = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING ` + inviteCodeColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	invite := &InviteCode{}
+	err := scanInviteCode(s.db.QueryRowContext(ctx, query, code), invite)
+	if errors.Is(err, sql.ErrNoRows) {
+		// already expired codes are left as they are
+		err = scanInviteCode(s.db.QueryRowContext(ctx, `SELECT `+inviteCodeColumns+` FROM invite_codes WHERE code = $1`, code), invite)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// List returns all codes, newest first.
+func (s *InviteCodeStore) List(ctx context.Context, fq PaginatedQuery) ([]InviteCode, error) {
+	query := `SELECT ` + inviteCodeColumns + ` FROM invite_codes ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2`
+	return s.list(ctx, query, fq.Limit, fq.Offset)
+}
+
+// ListByCreator returns the codes userID made for friends, newest first.
+func (s *InviteCodeStore) ListByCreator(ctx context.Context, userID int64) ([]InviteCode, error) {
+	query := `SELECT ` + inviteCodeColumns + ` FROM invite_codes WHERE created_by = $1 AND NOT admin ORDER BY created_at DESC, id DESC`
+	return s.list(ctx, query, userID)
+}
+
+func (s *InviteCodeStore) list(ctx context.Context, query string, args ...any) ([]InviteCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []InviteCode{}
+	for rows.Next() {
+		var code InviteCode
+		if err := scanInviteCode(rows, &code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
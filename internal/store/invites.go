@@ -21,6 +21,12 @@ type RegistrationInvite struct {
 	ExpiresAt   time.Time  `json:"expires_at"`
 	UsedAt      *time.Time `json:"used_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
+
+	// CompanyID, Email and TeamRole are set for invites to join a company
+	// as a team member rather than register a new one.
+	CompanyID *int64 `json:"company_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	TeamRole  string `json:"team_role,omitempty"`
 }
 
 type InviteStore struct {
@@ -29,8 +35,8 @@ type InviteStore struct {
 
 func (s *InviteStore) Create(ctx context.Context, invite *RegistrationInvite) error {
 	query := `
-		INSERT INTO registration_invites (token, company_type, created_by, expires_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO registration_invites (token, company_type, company_id, email, company_role, created_by, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)
 		RETURNING id, created_at
 	`
 
@@ -42,6 +48,9 @@ func (s *InviteStore) Create(ctx context.Context, invite *RegistrationInvite) er
 		query,
 		invite.Token,
 		invite.CompanyType,
+		invite.CompanyID,
+		invite.Email,
+		invite.TeamRole,
 		invite.CreatedBy,
 		invite.ExpiresAt,
 	).Scan(
@@ -49,7 +58,7 @@ func (s *InviteStore) Create(ctx context.Context, invite *RegistrationInvite) er
 		&invite.CreatedAt,
 	)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	return nil
@@ -57,7 +66,7 @@ func (s *InviteStore) Create(ctx context.Context, invite *RegistrationInvite) er
 
 func (s *InviteStore) GetByToken(ctx context.Context, token string) (*RegistrationInvite, error) {
 	query := `
-		SELECT id, token, company_type, created_by, expires_at, used_at, created_at
+		SELECT id, token, company_type, company_id, COALESCE(email, ''), COALESCE(company_role, ''), created_by, expires_at, used_at, created_at
 		FROM registration_invites
 		WHERE token = $1
 	`
@@ -70,6 +79,9 @@ func (s *InviteStore) GetByToken(ctx context.Context, token string) (*Registrati
 		&invite.ID,
 		&invite.Token,
 		&invite.CompanyType,
+		&invite.CompanyID,
+		&invite.Email,
+		&invite.TeamRole,
 		&invite.CreatedBy,
 		&invite.ExpiresAt,
 		&invite.UsedAt,
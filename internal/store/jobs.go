@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
+	"github.com/lib/pq"
+)
+
+var ErrJobNotFailed = conflict("only failed jobs can be retried")
+
+// JobFilter narrows the jobs listed for admins; empty fields match every
+// job.
+type JobFilter struct {
+	PaginatedQuery
+	Status string
+	Kind   string
+}
+
+// JobStore keeps the queue of internal/jobs.
+type JobStore struct {
+	db *sql.DB
+}
+
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, last_error, COALESCE(unique_key, ''),
+	run_at, started_at, finished_at, created_at`
+
+func scanJob(row interface{ Scan(...any) error }, job *jobs.Job) error {
+	var payload []byte
+	err := row.Scan(&job.ID, &job.Kind, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.LastError, &job.UniqueKey,
+		&job.RunAt, &job.StartedAt, &job.FinishedAt, &job.CreatedAt)
+	job.Payload = payload
+	return err
+}
+
+func (s *JobStore) Enqueue(ctx context.Context, job *jobs.Job) error {
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts, unique_key, run_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (unique_key) DO NOTHING
+		RETURNING id, status, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, job.Kind, []byte(job.Payload), job.MaxAttempts, job.UniqueKey, job.RunAt).Scan(&job.ID, &job.Status, &job.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return jobs.ErrDuplicate
+	}
+	return err
+}
+
+// Claim locks the due rows it takes, so concurrent workers never run the
+// same job.
+func (s *JobStore) Claim(ctx context.Context, kinds []string, limit int) ([]jobs.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, started_at = NOW()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status = 'queued' AND run_at <= NOW() AND kind = ANY($1)
+			ORDER BY run_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(kinds), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []jobs.Job
+	for rows.Next() {
+		var job jobs.Job
+		if err := scanJob(rows, &job); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, job)
+	}
+	return claimed, rows.Err()
+}
+
+func (s *JobStore) Succeed(ctx context.Context, id int64) error {
+	query := `UPDATE jobs SET status = 'succeeded', finished_at = NOW() WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (s *JobStore) Fail(ctx context.Context, id int64, msg string, retryAt *time.Time) error {
+	query := `
+		UPDATE jobs
+		SET last_error = $2,
+		    status = CASE WHEN $3::timestamptz IS NULL THEN 'failed' ELSE 'queued' END,
+		    run_at = COALESCE($3, run_at),
+		    finished_at = CASE WHEN $3::timestamptz IS NULL THEN NOW() END
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, msg, retryAt)
+	return err
+}
+
+// requeueError is recorded on jobs whose worker stopped answering.
+const requeueError = "the worker stopped before the job finished"
+
+func (s *JobStore) Requeue(ctx context.Context, startedBefore time.Time) (int64, error) {
+	query := `
+		UPDATE jobs
+		SET last_error = $2,
+		    status = CASE WHEN attempts < max_attempts THEN 'queued' ELSE 'failed' END,
+		    finished_at = CASE WHEN attempts < max_attempts THEN NULL ELSE NOW() END
+		WHERE status = 'running' AND started_at < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, startedBefore, requeueError)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// List returns jobs newest first.
+func (s *JobStore) List(ctx context.Context, filter JobFilter) ([]jobs.Job, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, filter.Status, filter.Kind, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []jobs.Job{}
+	for rows.Next() {
+		var job jobs.Job
+		if err := scanJob(rows, &job); err != nil {
+			return nil, err
+		}
+		list = append(list, job)
+	}
+	return list, rows.Err()
+}
+
+func (s *JobStore) GetByID(ctx context.Context, id int64) (*jobs.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var job jobs.Job
+	if err := scanJob(s.db.QueryRowContext(ctx, query, id), &job); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Retry queues a failed job again with a fresh set of attempts.
+func (s *JobStore) Retry(ctx context.Context, id int64) (*jobs.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', attempts = 0, run_at = NOW(), started_at = NULL, finished_at = NULL
+		WHERE id = $1 AND status = 'failed'
+		RETURNING ` + jobColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var job jobs.Job
+	err := scanJob(s.db.QueryRowContext(ctx, query, id), &job)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := s.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotFailed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Prune deletes the succeeded and failed jobs that finished before, and
+// returns how many there were.
+func (s *JobStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM jobs WHERE status IN ('succeeded', 'failed') AND finished_at < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of user-written text with a length limit, see Limits.
+const (
+	LimitListingTitle       = "listing_title"
+	LimitListingDescription = "listing_description"
+	LimitApplicationComment = "application_comment"
+	LimitMessage            = "message"
+)
+
+// ContentLimit caps one kind of text, in characters.
+type ContentLimit struct {
+	Max int `json:"max"`
+	// Truncate shortens longer text, ending it with an ellipsis, instead
+	// of refusing it
+	Truncate bool `json:"truncate"`
+}
+
+type ContentLimits map[string]ContentLimit
+
+// DefaultContentLimits are the limits without configuration.
+var DefaultContentLimits = ContentLimits{
+	LimitListingTitle:       {Max: 255},
+	LimitListingDescription: {Max: 10000},
+	LimitApplicationComment: {Max: 2000},
+	LimitMessage:            {Max: 5000},
+}
+
+// Limits are enforced by every store when text is created or changed, so
+// imports and other paths that skip request validation keep to them too.
+// main sets them from CONTENT_MAX_*.
+var Limits = DefaultContentLimits
+
+// LengthError is text over its limit. It is an ErrCheckViolation.
+type LengthError struct {
+	Kind string
+	Max  int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("%s must be at most %d characters", strings.ReplaceAll(e.Kind, "_", " "), e.Max)
+}
+
+func (e *LengthError) Unwrap() error { return ErrCheckViolation }
+
+// Apply checks text against the limit of kind, shortening it in place when
+// the limit truncates. Kinds without a limit are not checked.
+func (l ContentLimits) Apply(kind string, text *string) error {
+	limit, ok := l[kind]
+	if !ok || limit.Max <= 0 || text == nil || utf8.RuneCountInString(*text) <= limit.Max {
+		return nil
+	}
+	if !limit.Truncate {
+		return &LengthError{Kind: kind, Max: limit.Max}
+	}
+	runes := []rune(*text)
+	*text = strings.TrimRight(string(runes[:limit.Max-1]), " \t\r\n") + "…"
+	return nil
+}
+
+func (l *Listing) applyLimits() error {
+	if err := Limits.Apply(LimitListingTitle, &l.Title); err != nil {
+		return err
+	}
+	return Limits.Apply(LimitListingDescription, &l.Description)
+}
+
+func (a *Application) applyLimits() error {
+	return Limits.Apply(LimitApplicationComment, a.Comment)
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestContentLimitsApply(t *testing.T) {
+	limits := ContentLimits{
+		LimitListingTitle:       {Max: 5},
+		LimitListingDescription: {Max: 6, Truncate: true},
+	}
+
+	title := "Flat"
+	if err := limits.Apply(LimitListingTitle, &title); err != nil || title != "Flat" {
+		t.Errorf("within the limit: %q, %v", title, err)
+	}
+
+	title = "Квартира"
+	var lengthErr *LengthError
+	err := limits.Apply(LimitListingTitle, &title)
+	if !errors.As(err, &lengthErr) || lengthErr.Max != 5 || !errors.Is(err, ErrCheckViolation) {
+		t.Errorf("over the limit: %v", err)
+	}
+	if title != "Квартира" {
+		t.Errorf("refused text changed to %q", title)
+	}
+
+	description := "Big flat in the centre"
+	if err := limits.Apply(LimitListingDescription, &description); err != nil || description != "Big f…" {
+		t.Errorf("truncated to %q, %v", description, err)
+	}
+
+	long := strings.Repeat("x", 100)
+	if err := limits.Apply(LimitMessage, &long); err != nil {
+		t.Errorf("kind without a limit: %v", err)
+	}
+	if err := limits.Apply(LimitListingTitle, nil); err != nil {
+		t.Errorf("nil text: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	LinkPreviewPending = "pending"
+	LinkPreviewReady   = "ready"
+	LinkPreviewFailed  = "failed"
+)
+
+// LinkPreview is the Open Graph metadata of a page linked from a listing
+// description. Only ready previews are shown; fields the page did not set
+// are empty.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// PendingLinkPreview is a link waiting for the preview fetcher.
+type PendingLinkPreview struct {
+	URL      string
+	Attempts int
+}
+
+type LinkPreviewStore struct {
+	db *sql.DB
+}
+
+// Queue adds the links that have no preview yet, and queues again those
+// whose preview was last fetched more than refreshAfter ago.
+func (s *LinkPreviewStore) Queue(ctx context.Context, urls []string, refreshAfter time.Duration) error {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO link_previews (url)
+		SELECT unnest($1::text[])
+		ON CONFLICT (url) DO UPDATE
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE link_previews.status <> 'pending'
+			AND link_previews.fetched_at < NOW() - $2 * interval '1 second'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, pq.Array(urls), refreshAfter.Seconds())
+	return err
+}
+
+// ClaimPending returns up to limit links that are due and pushes their next
+// attempt out by lease, like OutboxStore.ClaimPending.
+func (s *LinkPreviewStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PendingLinkPreview, error) {
+	query := `
+		UPDATE link_previews
+		SET next_attempt_at = NOW() + $2 * interval '1 second'
+		WHERE url IN (
+			SELECT url FROM link_previews
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING url, attempts`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []PendingLinkPreview
+	for rows.Next() {
+		var p PendingLinkPreview
+		if err := rows.Scan(&p.URL, &p.Attempts); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// Save stores a fetched preview and marks it ready.
+func (s *LinkPreviewStore) Save(ctx context.Context, preview *LinkPreview) error {
+	query := `
+		UPDATE link_previews
+		SET status = 'ready', title = NULLIF($2, ''), description = NULLIF($3, ''), image_url = NULLIF($4, ''),
+			site_name = NULLIF($5, ''), attempts = attempts + 1, last_error = NULL, fetched_at = NOW()
+		WHERE url = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, preview.URL, preview.Title, preview.Description, preview.ImageURL, preview.SiteName)
+	return err
+}
+
+// MarkFailed records a failed fetch. A nil retryAt gives up on the link
+// until Queue refreshes it.
+func (s *LinkPreviewStore) MarkFailed(ctx context.Context, url, lastError string, retryAt *time.Time) error {
+	query := `
+		UPDATE link_previews
+		SET attempts = attempts + 1, last_error = $2,
+			status = CASE WHEN $3::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			next_attempt_at = COALESCE($3, next_attempt_at),
+			fetched_at = CASE WHEN $3::timestamptz IS NULL THEN NOW() ELSE fetched_at END
+		WHERE url = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, url, lastError, retryAt)
+	return err
+}
+
+// Get returns the ready previews of urls by URL; links without one are
+// left out.
+func (s *LinkPreviewStore) Get(ctx context.Context, urls []string) (map[string]LinkPreview, error) {
+	previews := make(map[string]LinkPreview)
+	if len(urls) == 0 {
+		return previews, nil
+	}
+
+	query := `
+		SELECT url, COALESCE(title, ''), COALESCE(description, ''), COALESCE(image_url, ''), COALESCE(site_name, '')
+		FROM link_previews
+		WHERE url = ANY($1) AND status = 'ready'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(urls))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p LinkPreview
+		if err := rows.Scan(&p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName); err != nil {
+			return nil, err
+		}
+		previews[p.URL] = p
+	}
+	return previews, rows.Err()
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ListingEvent is something happening at a listing at a set time, such as
+// an open house viewing. Sequence starts at 0 and grows with every edit, as
+// calendar apps expect.
+type ListingEvent struct {
+	ID           int64  `json:"id"`
+	ListingID    int64  `json:"listing_id"`
+	CompanyID    int64  `json:"company_id"`
+	ListingTitle string `json:"listing_title"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Location     string `json:"location"`
+	StartsAt     string `json:"starts_at"`
+	EndsAt       string `json:"ends_at"`
+	Sequence     int    `json:"sequence"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// ListingEventFilter selects events; zero fields do not filter. Events are
+// returned by start time.
+type ListingEventFilter struct {
+	ListingID int64
+	CompanyID int64
+	// FavoritedBy keeps the events at listings the user favorited.
+	FavoritedBy int64
+	// ActiveOnly keeps the events at active listings.
+	ActiveOnly bool
+	// EndsAfter drops the events that were over by then.
+	EndsAfter time.Time
+	Limit     int
+}
+
+type ListingEventStore struct {
+	db *sql.DB
+}
+
+const listingEventColumns = `
+	e.id, e.listing_id, l.company_id, l.title, e.title, e.description, e.location,
+	e.starts_at, e.ends_at, e.sequence, e.created_at, e.updated_at`
+
+func scanListingEvent(row interface{ Scan(...any) error }) (ListingEvent, error) {
+	var e ListingEvent
+	err := row.Scan(&e.ID, &e.ListingID, &e.CompanyID, &e.ListingTitle, &e.Title, &e.Description, &e.Location,
+		&e.StartsAt, &e.EndsAt, &e.Sequence, &e.CreatedAt, &e.UpdatedAt)
+	return e, err
+}
+
+func (s *ListingEventStore) Create(ctx context.Context, event *ListingEvent) error {
+	query := `
+		INSERT INTO listing_events (listing_id, title, description, location, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, sequence, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query,
+		event.ListingID, event.Title, event.Description, event.Location, event.StartsAt, event.EndsAt,
+	).Scan(&event.ID, &event.Sequence, &event.CreatedAt, &event.UpdatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+func (s *ListingEventStore) GetByID(ctx context.Context, id int64) (*ListingEvent, error) {
+	query := `SELECT ` + listingEventColumns + `
+		FROM listing_events e JOIN listings l ON l.id = e.listing_id AND l.deleted_at IS NULL
+		WHERE e.id = $1 AND ($2 = 0 OR l.tenant_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	e, err := scanListingEvent(s.db.QueryRowContext(ctx, query, id, tenantScope(ctx)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Update saves the title, description, location and times of event and
+// moves its sequence on.
+func (s *ListingEventStore) Update(ctx context.Context, event *ListingEvent) error {
+	query := `
+		UPDATE listing_events
+		SET title = $2, description = $3, location = $4, starts_at = $5, ends_at = $6,
+			sequence = sequence + 1, updated_at = NOW()
+		WHERE id = $1
+		RETURNING sequence, updated_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query,
+		event.ID, event.Title, event.Description, event.Location, event.StartsAt, event.EndsAt,
+	).Scan(&event.Sequence, &event.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return translateError(err)
+	}
+	return nil
+}
+
+func (s *ListingEventStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM listing_events WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *ListingEventStore) List(ctx context.Context, filter ListingEventFilter) ([]ListingEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	query := `SELECT ` + listingEventColumns + `
+		FROM listing_events e JOIN listings l ON l.id = e.listing_id AND l.deleted_at IS NULL
+		WHERE ($1 = 0 OR e.listing_id = $1)
+			AND ($2 = 0 OR l.company_id = $2)
+			AND ($3 = 0 OR EXISTS (SELECT 1 FROM favorites f WHERE f.user_id = $3 AND f.listing_id = e.listing_id))
+			AND (NOT $4 OR l.status = 'active')
+			AND e.ends_at > $5
+			AND ($6 = 0 OR l.tenant_id = $6)
+		ORDER BY e.starts_at, e.id
+		LIMIT $7`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query,
+		filter.ListingID, filter.CompanyID, filter.FavoritedBy, filter.ActiveOnly, filter.EndsAfter,
+		tenantScope(ctx), filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ListingEvent{}
+	for rows.Next() {
+		e, err := scanListingEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
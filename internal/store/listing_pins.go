@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// MaxPinnedListings is how many listings a company may pin to its profile.
+const MaxPinnedListings = 3
+
+var (
+	ErrPinLimit  = errors.New("pinned listing limit reached")
+	ErrNotActive = errors.New("listing is not active")
+)
+
+// Pin pins an active listing to its company's profile. Pinning a pinned
+// listing changes nothing; a company already at MaxPinnedListings gets
+// ErrPinLimit.
+func (s *ListingStore) Pin(ctx context.Context, listingID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var companyID int64
+		var status string
+		var pinned bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT company_id, status, pinned_at IS NOT NULL FROM listings WHERE id = $1 AND deleted_at IS NULL`,
+			listingID,
+		).Scan(&companyID, &status, &pinned)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if status != ListingStatusActive {
+			return ErrNotActive
+		}
+		if pinned {
+			return nil
+		}
+
+		// The company row serializes pins, so two at once cannot both
+		// take the last slot.
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM companies WHERE id = $1 FOR UPDATE`, companyID); err != nil {
+			return err
+		}
+		var count int
+		err = tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM listings WHERE company_id = $1 AND pinned_at IS NOT NULL`,
+			companyID,
+		).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count >= MaxPinnedListings {
+			return ErrPinLimit
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE listings SET pinned_at = NOW() WHERE id = $1 AND pinned_at IS NULL`, listingID)
+		return err
+	})
+}
+
+// Unpin removes a listing's pin, if it has one.
+func (s *ListingStore) Unpin(ctx context.Context, listingID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `UPDATE listings SET pinned_at = NULL WHERE id = $1 AND deleted_at IS NULL`, listingID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	ListingSortNewest = "newest"
+	ListingSortRanked = "ranked"
+	// ListingSortTrending orders by engagement since the filter's
+	// EngagedSince, the newest first among equals.
+	ListingSortTrending = "trending"
+)
+
+// The ranked sort adds three terms. Recency halves every rankHalfLifeDays
+// from publication. Engagement counts favorites and, twice, applications.
+// Affinity counts the viewer's favorites of and applications to listings of
+// the same company. Counts are log-damped so a popular listing cannot bury
+// a new one for long.
+const (
+	rankRecencyWeight    = 3.0
+	rankEngagementWeight = 1.0
+	rankAffinityWeight   = 1.5
+	rankHalfLifeDays     = 7.0
+	rankApplicationBoost = 2
+)
+
+// rankScoreSQL is rankScore in SQL over listings l, with the affinity
+// count to fill in.
+var rankScoreSQL = fmt.Sprintf(`(
+            %[1]g * POWER(0.5, GREATEST(EXTRACT(EPOCH FROM NOW() - COALESCE(l.published_at, l.created_at)), 0) / 86400.0 / %[4]g)
+            + %[2]g * LN(1 + (SELECT COUNT(*) FROM favorites f WHERE f.listing_id = l.id)
+                + %[5]d * (SELECT COUNT(*) FROM applications a WHERE a.listing_id = l.id))
+            + %[3]g * LN(1 + %%s)
+        )`, rankRecencyWeight, rankEngagementWeight, rankAffinityWeight, rankHalfLifeDays, rankApplicationBoost)
+
+// rankAffinitySQL counts the interactions of the viewer, the numbered
+// argument, with listings of the company of listing l.
+const rankAffinitySQL = `(
+            (SELECT COUNT(*) FROM favorites vf JOIN listings vl ON vl.id = vf.listing_id AND vl.deleted_at IS NULL
+                WHERE vf.user_id = $%[1]d AND vl.company_id = l.company_id)
+            + (SELECT COUNT(*) FROM applications va JOIN listings vl ON vl.id = va.listing_id AND vl.deleted_at IS NULL
+                WHERE va.user_id = $%[1]d AND vl.company_id = l.company_id)
+        )`
+
+// rankScore is the ranked sort's score of a listing published age ago.
+func rankScore(age time.Duration, favorites, applications, affinity int) float64 {
+	recency := math.Pow(0.5, max(age.Hours(), 0)/24/rankHalfLifeDays)
+	engagement := math.Log1p(float64(favorites + rankApplicationBoost*applications))
+	return rankRecencyWeight*recency + rankEngagementWeight*engagement + rankAffinityWeight*math.Log1p(float64(affinity))
+}
+
+// The trending sort counts engagement within a window: favorites,
+// applications trendingApplicationBoost times and views at
+// trendingViewWeight each. Views are kept per day, so windows shorter than
+// a day count the whole of today's views.
+const (
+	trendingApplicationBoost = rankApplicationBoost
+	trendingViewWeight       = 0.1
+)
+
+// trendingScoreSQL is trendingScore in SQL over listings l, with the
+// argument number of the window start to fill in.
+var trendingScoreSQL = fmt.Sprintf(`(
+            (SELECT COUNT(*) FROM favorites f WHERE f.listing_id = l.id AND f.created_at >= $%%[1]d)
+            + %[1]d * (SELECT COUNT(*) FROM applications a WHERE a.listing_id = l.id AND a.created_at >= $%%[1]d)
+            + %[2]g * COALESCE((SELECT SUM(v.views) FROM view_counts v
+                WHERE v.kind = 'listing' AND v.target_id = l.id AND v.day >= $%%[1]d::date), 0)
+        )`, trendingApplicationBoost, trendingViewWeight)
+
+// trendingScore is the trending sort's score of a listing with the given
+// engagement in the window.
+func trendingScore(favorites, applications int, views int64) float64 {
+	return float64(favorites+trendingApplicationBoost*applications) + trendingViewWeight*float64(views)
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ListingVersion is the content a listing had before an edit replaced it.
+type ListingVersion struct {
+	ListingID    int64    `json:"listing_id"`
+	Version      int      `json:"version"`
+	ProjectID    *int64   `json:"project_id,omitempty"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	PropertyType string   `json:"property_type"`
+	DealType     string   `json:"deal_type"`
+	Price        int64    `json:"price"`
+	City         string   `json:"city"`
+	Address      string   `json:"address"`
+	Rooms        *int     `json:"rooms,omitempty"`
+	Area         *float64 `json:"area,omitempty"`
+	Floor        *int     `json:"floor,omitempty"`
+	TotalFloors  *int     `json:"total_floors,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`
+	Longitude    *float64 `json:"longitude,omitempty"`
+	PublishAt    *string  `json:"publish_at,omitempty"`
+	// ReplacedAt is when the next version replaced this one.
+	ReplacedAt string `json:"replaced_at"`
+}
+
+// saveListingVersionQuery copies the current content of listing $1 into
+// listing_versions, before an edit overwrites it.
+const saveListingVersionQuery = `
+    INSERT INTO listing_versions (
+        listing_id, version, project_id, title, description, property_type, deal_type, price, city, address, rooms, area, floor, total_floors, latitude, longitude, publish_at
+    )
+    SELECT id, version, project_id, title, description, property_type, deal_type, price, city, address, rooms, area, floor, total_floors, latitude, longitude, publish_at
+    FROM listings WHERE id = $1
+`
+
+// Versions returns the earlier versions of a listing, newest first. The
+// current content is the listing itself.
+func (s *ListingStore) Versions(ctx context.Context, listingID int64) ([]ListingVersion, error) {
+	query := `
+        SELECT listing_id, version, project_id, title, description, property_type, deal_type, price, city, COALESCE(address, ''), rooms, area, floor, total_floors, latitude, longitude, publish_at, replaced_at
+        FROM listing_versions
+        WHERE listing_id = $1
+        ORDER BY version DESC
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.reads.Reader(ctx).QueryContext(ctx, query, listingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []ListingVersion{}
+	for rows.Next() {
+		var v ListingVersion
+		var projectID sql.NullInt64
+		var rooms, floor, totalFloors sql.NullInt32
+		var area, latitude, longitude sql.NullFloat64
+		var publishAt sql.NullString
+		if err := rows.Scan(
+			&v.ListingID, &v.Version, &projectID, &v.Title, &v.Description, &v.PropertyType, &v.DealType, &v.Price, &v.City, &v.Address,
+			&rooms, &area, &floor, &totalFloors, &latitude, &longitude, &publishAt, &v.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if projectID.Valid {
+			v.ProjectID = &projectID.Int64
+		}
+		if rooms.Valid {
+			n := int(rooms.Int32)
+			v.Rooms = &n
+		}
+		if area.Valid {
+			v.Area = &area.Float64
+		}
+		if floor.Valid {
+			n := int(floor.Int32)
+			v.Floor = &n
+		}
+		if totalFloors.Valid {
+			n := int(totalFloors.Int32)
+			v.TotalFloors = &n
+		}
+		if latitude.Valid {
+			v.Latitude = &latitude.Float64
+		}
+		if longitude.Valid {
+			v.Longitude = &longitude.Float64
+		}
+		if publishAt.Valid {
+			v.PublishAt = &publishAt.String
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
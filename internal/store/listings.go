@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 var (
@@ -16,7 +17,7 @@ var (
 
 var (
 	ListingStatuses = map[string]struct{}{
-		"draft": {}, "moderation": {}, "active": {}, "rejected": {}, "archived": {},
+		"draft": {}, "moderation": {}, "scheduled": {}, "active": {}, "rejected": {}, "archived": {},
 	}
 	ListingDealTypes = map[string]struct{}{
 		"rent": {}, "sale": {},
@@ -45,9 +46,24 @@ type Listing struct {
 	Longitude       *float64         `json:"longitude,omitempty"`
 	Media           []ListingMedia   `json:"media,omitempty"`
 	RentConstraints *RentConstraints `json:"rent_constraints,omitempty"`
+	FavoritesCount  int              `json:"favorites_count"`
+	FavoritedByMe   *bool            `json:"favorited_by_me,omitempty"`
 	CreatedAt       string           `json:"created_at"`
 	UpdatedAt       string           `json:"updated_at"`
 	PublishedAt     *string          `json:"published_at,omitempty"`
+	// PublishAt is when an approved listing goes live; until then it is
+	// ListingStatusScheduled.
+	PublishAt *string `json:"publish_at,omitempty"`
+	// Version starts at 1 and grows with every edit; see ListingVersion.
+	Version  int     `json:"version"`
+	Edited   bool    `json:"edited"`
+	EditedAt *string `json:"edited_at,omitempty"`
+	// PinnedAt is set while the company pins the listing to its profile.
+	PinnedAt *string `json:"pinned_at,omitempty"`
+	// LinkPreviews describe the links in Description that have been fetched.
+	LinkPreviews []LinkPreview `json:"link_previews,omitempty"`
+	// TenantID is the community the listing is published in; see Tenant.
+	TenantID int64 `json:"tenant_id"`
 }
 
 type ListingMedia struct {
@@ -55,6 +71,9 @@ type ListingMedia struct {
 	ListingID int64  `json:"listing_id"`
 	URL       string `json:"url"`
 	Position  int    `json:"position"`
+	SizeBytes int64  `json:"size_bytes"`
+	// UploadedBy is the user whose media quota the file counts against.
+	UploadedBy int64 `json:"-"`
 }
 
 type RentConstraints struct {
@@ -80,6 +99,21 @@ type ListingFilter struct {
 	AreaMin      float64
 	AreaMax      float64
 	CompanyID    *int64
+	Tag          string
+	// Region ranks listings of companies in that country first; it does
+	// not filter.
+	Region string
+	// Sort is ListingSortNewest, the default, or ListingSortRanked.
+	Sort string
+	// EngagedSince starts the window the trending sort counts engagement
+	// in; it is required with ListingSortTrending.
+	EngagedSince time.Time
+	// ViewerID personalizes the ranked sort with the viewer's favorites
+	// and applications; 0 for anonymous viewers.
+	ViewerID int64
+	// PinnedFirst puts pinned listings first, the latest pin on top, as on
+	// a company's profile.
+	PinnedFirst bool
 }
 
 func (f *ListingFilter) normalize() error {
@@ -122,12 +156,25 @@ func (f *ListingFilter) normalize() error {
 	if f.AreaMax > 0 && f.AreaMin > f.AreaMax {
 		return ErrInvalidFilter
 	}
+	if f.Sort == "" {
+		f.Sort = ListingSortNewest
+	}
+	switch f.Sort {
+	case ListingSortNewest, ListingSortRanked:
+	case ListingSortTrending:
+		if f.EngagedSince.IsZero() {
+			return ErrInvalidFilter
+		}
+	default:
+		return ErrInvalidFilter
+	}
 	return nil
 }
 
 // ListingStore provides CRUD operations for listings.
 type ListingStore struct {
-	db *sql.DB
+	db    *sql.DB
+	reads *QueryerChooser
 }
 
 func (s *ListingStore) Create(ctx context.Context, listing *Listing, media []ListingMedia, rent *RentConstraints) error {
@@ -140,13 +187,18 @@ func (s *ListingStore) Create(ctx context.Context, listing *Listing, media []Lis
 	if _, ok := ListingStatuses[listing.Status]; !ok {
 		return ErrInvalidStatus
 	}
+	if err := listing.applyLimits(); err != nil {
+		return err
+	}
+
+	listing.TenantID = tenantOf(ctx)
 
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		insert := `
             INSERT INTO listings (
-                company_id, project_id, title, description, property_type, deal_type, status, price, city, address, rooms, area, floor, total_floors, latitude, longitude
-            ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)
-            RETURNING id, created_at, updated_at, published_at
+                company_id, project_id, title, description, property_type, deal_type, status, price, city, address, rooms, area, floor, total_floors, latitude, longitude, publish_at, tenant_id
+            ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)
+            RETURNING id, created_at, updated_at, published_at, version
         `
 
 		var projectID sql.NullInt64
@@ -207,7 +259,9 @@ func (s *ListingStore) Create(ctx context.Context, listing *Listing, media []Lis
 			totalFloors,
 			latitude,
 			longitude,
-		).Scan(&listing.ID, &listing.CreatedAt, &listing.UpdatedAt, &listing.PublishedAt)
+			listing.PublishAt,
+			listing.TenantID,
+		).Scan(&listing.ID, &listing.CreatedAt, &listing.UpdatedAt, &listing.PublishedAt, &listing.Version)
 		if err != nil {
 			return err
 		}
@@ -239,25 +293,25 @@ func (s *ListingStore) insertMedia(ctx context.Context, tx *sql.Tx, media *Listi
 
 func (s *ListingStore) CreateMedia(ctx context.Context, media *ListingMedia) error {
 	query := `
-        INSERT INTO listing_media (listing_id, url, position)
-        VALUES ($1, $2, COALESCE((SELECT MAX(position) + 1 FROM listing_media WHERE listing_id = $1), 0))
+        INSERT INTO listing_media (listing_id, url, size_bytes, uploaded_by, position)
+        VALUES ($1, $2, $3, NULLIF($4, 0), COALESCE((SELECT MAX(position) + 1 FROM listing_media WHERE listing_id = $1), 0))
         RETURNING id, position
     `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return s.db.QueryRowContext(ctx, query, media.ListingID, media.URL).Scan(&media.ID, &media.Position)
+	return translateError(s.db.QueryRowContext(ctx, query, media.ListingID, media.URL, media.SizeBytes, media.UploadedBy).Scan(&media.ID, &media.Position))
 }
 
 func (s *ListingStore) GetMediaByID(ctx context.Context, listingID, mediaID int64) (*ListingMedia, error) {
-	query := `SELECT id, listing_id, url, position FROM listing_media WHERE listing_id = $1 AND id = $2`
+	query := `SELECT id, listing_id, url, position, size_bytes FROM listing_media WHERE listing_id = $1 AND id = $2`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	var media ListingMedia
-	err := s.db.QueryRowContext(ctx, query, listingID, mediaID).Scan(&media.ID, &media.ListingID, &media.URL, &media.Position)
+	err := s.db.QueryRowContext(ctx, query, listingID, mediaID).Scan(&media.ID, &media.ListingID, &media.URL, &media.Position, &media.SizeBytes)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
@@ -310,13 +364,22 @@ func (s *ListingStore) UpdateStatus(ctx context.Context, id int64, status string
 		return ErrInvalidStatus
 	}
 
-	query := `UPDATE listings SET status = $1, updated_at = NOW(), published_at = CASE WHEN $1 = 'active' THEN NOW() ELSE published_at END WHERE id = $2`
+	// Approving a listing whose publish_at is ahead schedules it instead.
+	// Listings that stop being active lose their pin.
+	query := `
+        UPDATE listings
+        SET status = CASE WHEN $1::text = 'active' AND publish_at > NOW() THEN 'scheduled' ELSE $1::text END,
+            updated_at = NOW(),
+            published_at = CASE WHEN $1::text = 'active' AND (publish_at IS NULL OR publish_at <= NOW()) THEN NOW() ELSE published_at END,
+            pinned_at = CASE WHEN $1::text = 'active' THEN pinned_at END
+        WHERE id = $2 AND deleted_at IS NULL
+    `
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	res, err := s.db.ExecContext(ctx, query, status, id)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	rows, err := res.RowsAffected()
@@ -330,6 +393,37 @@ func (s *ListingStore) UpdateStatus(ctx context.Context, id int64, status string
 	return nil
 }
 
+// PublishDue makes the scheduled listings whose publish_at has passed
+// active and returns their IDs. Each listing is published by one caller
+// only, so several API instances can run it.
+func (s *ListingStore) PublishDue(ctx context.Context) ([]int64, error) {
+	query := `
+        UPDATE listings
+        SET status = 'active', published_at = NOW(), updated_at = NOW()
+        WHERE status = 'scheduled' AND (publish_at IS NULL OR publish_at <= NOW()) AND deleted_at IS NULL
+        RETURNING id
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (s *ListingStore) Update(ctx context.Context, listing *Listing) error {
 	if listing == nil {
 		return errors.New("listing is nil")
@@ -340,6 +434,9 @@ func (s *ListingStore) Update(ctx context.Context, listing *Listing) error {
 	if _, ok := ListingStatuses[listing.Status]; !ok {
 		return ErrInvalidStatus
 	}
+	if err := listing.applyLimits(); err != nil {
+		return err
+	}
 
 	query := `
         UPDATE listings
@@ -357,9 +454,12 @@ func (s *ListingStore) Update(ctx context.Context, listing *Listing) error {
             total_floors = $12,
             latitude = $13,
             longitude = $14,
+            publish_at = $15,
+            version = version + 1,
+            edited_at = NOW(),
             updated_at = NOW()
-        WHERE id = $15
-        RETURNING updated_at
+        WHERE id = $16
+        RETURNING updated_at, version, edited_at
     `
 
 	var projectID sql.NullInt64
@@ -402,40 +502,86 @@ func (s *ListingStore) Update(ctx context.Context, listing *Listing) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query,
-		projectID,
-		listing.Title,
-		listing.Description,
-		listing.PropertyType,
-		listing.DealType,
-		listing.Price,
-		listing.City,
-		listing.Address,
-		rooms,
-		area,
-		floor,
-		totalFloors,
-		latitude,
-		longitude,
-		listing.ID,
-	).Scan(&listing.UpdatedAt)
-	if err != nil {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var version int
+		err := tx.QueryRowContext(ctx, `SELECT version FROM listings WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, listing.ID).Scan(&version)
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if version != listing.Version {
+			return ErrConflict
+		}
+
+		if _, err := tx.ExecContext(ctx, saveListingVersionQuery, listing.ID); err != nil {
+			return err
+		}
+
+		var editedAt sql.NullString
+		err = tx.QueryRowContext(ctx, query,
+			projectID,
+			listing.Title,
+			listing.Description,
+			listing.PropertyType,
+			listing.DealType,
+			listing.Price,
+			listing.City,
+			listing.Address,
+			rooms,
+			area,
+			floor,
+			totalFloors,
+			latitude,
+			longitude,
+			listing.PublishAt,
+			listing.ID,
+		).Scan(&listing.UpdatedAt, &listing.Version, &editedAt)
+		if err != nil {
+			return err
 		}
+		listing.EditedAt, listing.Edited = &editedAt.String, true
+		return nil
+	})
+}
+
+// Delete soft-deletes the listing: it disappears from every query but
+// can be restored until PurgeDeleted removes it. A deleted listing loses
+// its pin.
+func (s *ListingStore) Delete(ctx context.Context, id int64) error {
+	query := `UPDATE listings SET deleted_at = NOW(), pinned_at = NULL WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
 		return err
 	}
 
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
-func (s *ListingStore) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM listings WHERE id = $1`
+// Restore undeletes a listing of companyID deleted after since. Listings
+// of other companies, or deleted earlier, are ErrNotFound.
+func (s *ListingStore) Restore(ctx context.Context, id, companyID int64, since time.Time) error {
+	query := `
+        UPDATE listings SET deleted_at = NULL, updated_at = NOW()
+        WHERE id = $1 AND company_id = $2 AND deleted_at > $3 AND ($4 = 0 OR tenant_id = $4)
+    `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, id)
+	res, err := s.db.ExecContext(ctx, query, id, companyID, since, tenantScope(ctx))
 	if err != nil {
 		return err
 	}
@@ -451,10 +597,24 @@ func (s *ListingStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+// PurgeDeleted removes the listings deleted before before, with their
+// favorites, applications and everything else that cascades, and returns
+// how many it removed.
+func (s *ListingStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM listings WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (s *ListingStore) GetByID(ctx context.Context, id int64) (*Listing, error) {
 	query := `
-        SELECT id, company_id, project_id, title, description, property_type, deal_type, status, price, city, address, rooms, area, floor, total_floors, latitude, longitude, created_at, updated_at, published_at
-        FROM listings WHERE id = $1
+        SELECT id, company_id, project_id, title, description, property_type, deal_type, status, price, city, address, rooms, area, floor, total_floors, latitude, longitude, created_at, updated_at, published_at, publish_at, version, edited_at, pinned_at, tenant_id
+        FROM listings WHERE id = $1 AND ($2 = 0 OR tenant_id = $2) AND deleted_at IS NULL
     `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -469,8 +629,14 @@ func (s *ListingStore) GetByID(ctx context.Context, id int64) (*Listing, error)
 	var latitude sql.NullFloat64
 	var longitude sql.NullFloat64
 	var publishedAt sql.NullString
-
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	var publishAt sql.NullString
+	var editedAt sql.NullString
+	var pinnedAt sql.NullString
+
+	// media and rent constraints come from the same connection, so they are
+	// never newer or older than the listing
+	q := s.reads.Reader(ctx)
+	err := q.QueryRowContext(ctx, query, id, tenantScope(ctx)).Scan(
 		&l.ID,
 		&l.CompanyID,
 		&projectID,
@@ -491,6 +657,11 @@ func (s *ListingStore) GetByID(ctx context.Context, id int64) (*Listing, error)
 		&l.CreatedAt,
 		&l.UpdatedAt,
 		&publishedAt,
+		&publishAt,
+		&l.Version,
+		&editedAt,
+		&pinnedAt,
+		&l.TenantID,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -530,22 +701,35 @@ func (s *ListingStore) GetByID(ctx context.Context, id int64) (*Listing, error)
 		v := publishedAt.String
 		l.PublishedAt = &v
 	}
+	if publishAt.Valid {
+		v := publishAt.String
+		l.PublishAt = &v
+	}
+	if editedAt.Valid {
+		v := editedAt.String
+		l.EditedAt = &v
+		l.Edited = true
+	}
+	if pinnedAt.Valid {
+		v := pinnedAt.String
+		l.PinnedAt = &v
+	}
 
-	if rent, err := s.getRentConstraints(ctx, l.ID); err == nil && rent != nil {
+	if rent, err := s.getRentConstraints(ctx, q, l.ID); err == nil && rent != nil {
 		l.RentConstraints = rent
 	}
-	l.Media, _ = s.getMedia(ctx, l.ID)
+	l.Media, _ = s.getMedia(ctx, q, l.ID)
 
 	return &l, nil
 }
 
-func (s *ListingStore) getMedia(ctx context.Context, listingID int64) ([]ListingMedia, error) {
-	query := `SELECT id, listing_id, url, position FROM listing_media WHERE listing_id = $1 ORDER BY position ASC, id ASC`
+func (s *ListingStore) getMedia(ctx context.Context, q Queryer, listingID int64) ([]ListingMedia, error) {
+	query := `SELECT id, listing_id, url, position, size_bytes FROM listing_media WHERE listing_id = $1 ORDER BY position ASC, id ASC`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, listingID)
+	rows, err := q.QueryContext(ctx, query, listingID)
 	if err != nil {
 		return nil, err
 	}
@@ -554,7 +738,7 @@ func (s *ListingStore) getMedia(ctx context.Context, listingID int64) ([]Listing
 	var media []ListingMedia
 	for rows.Next() {
 		var m ListingMedia
-		if err := rows.Scan(&m.ID, &m.ListingID, &m.URL, &m.Position); err != nil {
+		if err := rows.Scan(&m.ID, &m.ListingID, &m.URL, &m.Position, &m.SizeBytes); err != nil {
 			return nil, err
 		}
 		media = append(media, m)
@@ -562,7 +746,7 @@ func (s *ListingStore) getMedia(ctx context.Context, listingID int64) ([]Listing
 	return media, rows.Err()
 }
 
-func (s *ListingStore) getRentConstraints(ctx context.Context, listingID int64) (*RentConstraints, error) {
+func (s *ListingStore) getRentConstraints(ctx context.Context, q Queryer, listingID int64) (*RentConstraints, error) {
 	query := `
         SELECT listing_id, allow_children, allow_pets, allow_students, max_occupants, min_term_months
         FROM listing_rent_constraints WHERE listing_id = $1
@@ -572,7 +756,7 @@ func (s *ListingStore) getRentConstraints(ctx context.Context, listingID int64)
 	defer cancel()
 
 	var r RentConstraints
-	err := s.db.QueryRowContext(ctx, query, listingID).Scan(
+	err := q.QueryRowContext(ctx, query, listingID).Scan(
 		&r.ListingID, &r.AllowChildren, &r.AllowPets, &r.AllowStudents, &r.MaxOccupants, &r.MinTermMonths,
 	)
 	if err != nil {
@@ -592,9 +776,14 @@ func (s *ListingStore) List(ctx context.Context, filter ListingFilter) ([]Listin
 	var where []string
 	var args []any
 
-	where = append(where, "l.status = $1")
+	where = append(where, "l.status = $1", "l.deleted_at IS NULL")
 	args = append(args, filter.Status)
 
+	if tenantID := tenantScope(ctx); tenantID != 0 {
+		args = append(args, tenantID)
+		where = append(where, fmt.Sprintf("l.tenant_id = $%d", len(args)))
+	}
+
 	if filter.DealType != "" {
 		args = append(args, filter.DealType)
 		where = append(where, fmt.Sprintf("l.deal_type = $%d", len(args)))
@@ -635,24 +824,49 @@ func (s *ListingStore) List(ctx context.Context, filter ListingFilter) ([]Listin
 		args = append(args, *filter.CompanyID)
 		where = append(where, fmt.Sprintf("l.company_id = $%d", len(args)))
 	}
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		where = append(where, fmt.Sprintf("EXISTS (SELECT 1 FROM listing_tags t WHERE t.listing_id = l.id AND t.tag = $%d)", len(args)))
+	}
 
 	clause := strings.Join(where, " AND ")
+	order := "l.created_at DESC"
+	if filter.Sort == ListingSortRanked {
+		affinity := "0"
+		if filter.ViewerID != 0 {
+			args = append(args, filter.ViewerID)
+			affinity = fmt.Sprintf(rankAffinitySQL, len(args))
+		}
+		order = fmt.Sprintf(rankScoreSQL, affinity) + " DESC, " + order
+	}
+	if filter.Sort == ListingSortTrending {
+		args = append(args, filter.EngagedSince)
+		order = fmt.Sprintf(trendingScoreSQL, len(args)) + " DESC, " + order
+	}
+	if filter.PinnedFirst {
+		order = "l.pinned_at DESC NULLS LAST, " + order
+	}
+	if filter.Region != "" {
+		args = append(args, filter.Region)
+		order = fmt.Sprintf("(c.country = $%d) DESC, %s", len(args), order)
+	}
 	args = append(args, filter.Limit)
 	args = append(args, filter.Offset)
 
 	query := fmt.Sprintf(`
-        SELECT l.id, l.company_id, COALESCE(c.name, '') AS company_name, l.project_id, l.title, l.description, l.property_type, l.deal_type, l.status, l.price, l.city, l.address, l.rooms, l.area, l.floor, l.total_floors, l.latitude, l.longitude, l.created_at, l.updated_at, l.published_at
+        SELECT l.id, l.company_id, COALESCE(c.name, '') AS company_name, l.project_id, l.title, l.description, l.property_type, l.deal_type, l.status, l.price, l.city, l.address, l.rooms, l.area, l.floor, l.total_floors, l.latitude, l.longitude, l.created_at, l.updated_at, l.published_at, l.publish_at, l.version, l.edited_at, l.pinned_at, l.tenant_id
         FROM listings l
         LEFT JOIN companies c ON l.company_id = c.id
         WHERE %s
-        ORDER BY l.created_at DESC
+        ORDER BY %s
         LIMIT $%d OFFSET $%d
-    `, clause, len(args)-1, len(args))
+    `, clause, order, len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	q := s.reads.Reader(ctx)
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -669,6 +883,9 @@ func (s *ListingStore) List(ctx context.Context, filter ListingFilter) ([]Listin
 		var latitude sql.NullFloat64
 		var longitude sql.NullFloat64
 		var publishedAt sql.NullString
+		var publishAt sql.NullString
+		var editedAt sql.NullString
+		var pinnedAt sql.NullString
 
 		if err := rows.Scan(
 			&l.ID,
@@ -692,6 +909,11 @@ func (s *ListingStore) List(ctx context.Context, filter ListingFilter) ([]Listin
 			&l.CreatedAt,
 			&l.UpdatedAt,
 			&publishedAt,
+			&publishAt,
+			&l.Version,
+			&editedAt,
+			&pinnedAt,
+			&l.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -727,6 +949,19 @@ func (s *ListingStore) List(ctx context.Context, filter ListingFilter) ([]Listin
 			v := publishedAt.String
 			l.PublishedAt = &v
 		}
+		if publishAt.Valid {
+			v := publishAt.String
+			l.PublishAt = &v
+		}
+		if editedAt.Valid {
+			v := editedAt.String
+			l.EditedAt = &v
+			l.Edited = true
+		}
+		if pinnedAt.Valid {
+			v := pinnedAt.String
+			l.PinnedAt = &v
+		}
 
 		listings = append(listings, l)
 	}
@@ -735,14 +970,14 @@ func (s *ListingStore) List(ctx context.Context, filter ListingFilter) ([]Listin
 	}
 
 	// Load media and rent constraints in batch
-	if err := s.attachMediaAndRent(ctx, listings); err != nil {
+	if err := s.attachMediaAndRent(ctx, q, listings); err != nil {
 		return nil, err
 	}
 
 	return listings, nil
 }
 
-func (s *ListingStore) attachMediaAndRent(ctx context.Context, listings []Listing) error {
+func (s *ListingStore) attachMediaAndRent(ctx context.Context, q Queryer, listings []Listing) error {
 	if len(listings) == 0 {
 		return nil
 	}
@@ -751,11 +986,11 @@ func (s *ListingStore) attachMediaAndRent(ctx context.Context, listings []Listin
 		ids = append(ids, l.ID)
 	}
 
-	mediaMap, err := s.fetchMediaMap(ctx, ids)
+	mediaMap, err := s.fetchMediaMap(ctx, q, ids)
 	if err != nil {
 		return err
 	}
-	rentMap, err := s.fetchRentMap(ctx, ids)
+	rentMap, err := s.fetchRentMap(ctx, q, ids)
 	if err != nil {
 		return err
 	}
@@ -771,7 +1006,7 @@ func (s *ListingStore) attachMediaAndRent(ctx context.Context, listings []Listin
 	return nil
 }
 
-func (s *ListingStore) fetchMediaMap(ctx context.Context, ids []int64) (map[int64][]ListingMedia, error) {
+func (s *ListingStore) fetchMediaMap(ctx context.Context, q Queryer, ids []int64) (map[int64][]ListingMedia, error) {
 	placeholders := make([]string, len(ids))
 	args := make([]any, len(ids))
 	for i, id := range ids {
@@ -780,7 +1015,7 @@ func (s *ListingStore) fetchMediaMap(ctx context.Context, ids []int64) (map[int6
 	}
 
 	query := fmt.Sprintf(`
-        SELECT id, listing_id, url, position
+        SELECT id, listing_id, url, position, size_bytes
         FROM listing_media
         WHERE listing_id IN (%s)
         ORDER BY listing_id, position ASC, id ASC
@@ -789,7 +1024,7 @@ func (s *ListingStore) fetchMediaMap(ctx context.Context, ids []int64) (map[int6
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -798,7 +1033,7 @@ func (s *ListingStore) fetchMediaMap(ctx context.Context, ids []int64) (map[int6
 	result := make(map[int64][]ListingMedia)
 	for rows.Next() {
 		var m ListingMedia
-		if err := rows.Scan(&m.ID, &m.ListingID, &m.URL, &m.Position); err != nil {
+		if err := rows.Scan(&m.ID, &m.ListingID, &m.URL, &m.Position, &m.SizeBytes); err != nil {
 			return nil, err
 		}
 		result[m.ListingID] = append(result[m.ListingID], m)
@@ -806,7 +1041,7 @@ func (s *ListingStore) fetchMediaMap(ctx context.Context, ids []int64) (map[int6
 	return result, rows.Err()
 }
 
-func (s *ListingStore) fetchRentMap(ctx context.Context, ids []int64) (map[int64]*RentConstraints, error) {
+func (s *ListingStore) fetchRentMap(ctx context.Context, q Queryer, ids []int64) (map[int64]*RentConstraints, error) {
 	placeholders := make([]string, len(ids))
 	args := make([]any, len(ids))
 	for i, id := range ids {
@@ -823,7 +1058,7 @@ func (s *ListingStore) fetchRentMap(ctx context.Context, ids []int64) (map[int64
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
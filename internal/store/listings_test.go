@@ -1,6 +1,10 @@
 package store
 
-import "testing"
+import (
+	"context"
+	"reflect"
+	"testing"
+)
 
 func TestListingFilterNormalizeDefaults(t *testing.T) {
 	f := ListingFilter{}
@@ -35,3 +39,56 @@ func TestListingFilterNormalizePriceRange(t *testing.T) {
 		t.Fatalf("expected ErrInvalidFilter, got %v", err)
 	}
 }
+
+func TestListingFilterNormalizeInvalidSort(t *testing.T) {
+	f := ListingFilter{Sort: "popular"}
+	if err := f.normalize(); err != ErrInvalidFilter {
+		t.Fatalf("expected ErrInvalidFilter, got %v", err)
+	}
+}
+
+func TestMemoryListingsRankedSort(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+
+	// All three are new, so engagement and affinity decide the order.
+	var ids []int64
+	for _, companyID := range []int64{1, 1, 2} {
+		l := &Listing{CompanyID: companyID, Title: "Flat", DealType: "sale", Status: ListingStatusActive}
+		if err := s.Listings.Create(ctx, l, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, l.ID)
+	}
+	for _, userID := range []int64{10, 11} {
+		if err := s.Favorites.Add(ctx, userID, ids[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	order := func(filter ListingFilter) []int64 {
+		t.Helper()
+		listings, err := s.Listings.List(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, l := range listings {
+			got = append(got, l.ID)
+		}
+		return got
+	}
+
+	if got, want := order(ListingFilter{}), []int64{ids[2], ids[1], ids[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("newest: got %v, want %v", got, want)
+	}
+	if got, want := order(ListingFilter{Sort: ListingSortRanked}), []int64{ids[0], ids[2], ids[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranked: got %v, want %v", got, want)
+	}
+
+	// A viewer who saved a company-1 listing sees company 1's other
+	// listing ahead of company 2's.
+	if got, want := order(ListingFilter{Sort: ListingSortRanked, ViewerID: 10}), []int64{ids[0], ids[1], ids[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranked for viewer: got %v, want %v", got, want)
+	}
+}
@@ -11,18 +11,29 @@ type LoginEvent struct {
 	EmailHash string `json:"email_hash"`
 	IP        string `json:"ip"`
 	UserAgent string `json:"user_agent"`
+	// Country is the ISO code from the GeoIP proxy header, empty when unknown
+	Country string `json:"country"`
+	// Device is a coarse description such as "Firefox on Windows"
+	Device    string `json:"device"`
 	Success   bool   `json:"success"`
 	CreatedAt string `json:"created_at"`
 }
 
+// LoginHistory compares a login with a user's earlier successful ones.
+type LoginHistory struct {
+	Logins       int
+	KnownCountry bool
+	KnownDevice  bool
+}
+
 type LoginEventStore struct {
 	db *sql.DB
 }
 
 func (s *LoginEventStore) Create(ctx context.Context, event *LoginEvent) error {
 	query := `
-		INSERT INTO user_login_events (user_id, email_hash, ip, user_agent, success)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO user_login_events (user_id, email_hash, ip, user_agent, country, device, success)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at
 	`
 
@@ -36,9 +47,61 @@ func (s *LoginEventStore) Create(ctx context.Context, event *LoginEvent) error {
 		event.EmailHash,
 		event.IP,
 		event.UserAgent,
+		event.Country,
+		event.Device,
 		event.Success,
 	).Scan(
 		&event.ID,
 		&event.CreatedAt,
 	)
 }
+
+// History reports how many successful logins userID had and whether any of
+// them came from country or device.
+func (s *LoginEventStore) History(ctx context.Context, userID int64, country, device string) (*LoginHistory, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(bool_or(country = $2), false), COALESCE(bool_or(device = $3), false)
+		FROM user_login_events
+		WHERE user_id = $1 AND success
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	history := &LoginHistory{}
+	err := s.db.QueryRowContext(ctx, query, userID, country, device).Scan(&history.Logins, &history.KnownCountry, &history.KnownDevice)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// ListSuccessful returns the successful logins of userID, newest first.
+func (s *LoginEventStore) ListSuccessful(ctx context.Context, userID int64, fq PaginatedQuery) ([]LoginEvent, error) {
+	query := `
+		SELECT id, user_id, ip, user_agent, country, device, success, created_at
+		FROM user_login_events
+		WHERE user_id = $1 AND success
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []LoginEvent{}
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.IP, &e.UserAgent, &e.Country, &e.Device, &e.Success, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/lib/pq"
+)
+
+type MagicLinkStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+// Create stores a login token for the user and queues the email carrying it
+// in the same transaction. Earlier unused links for the user are dropped so
+// only the most recent one works. token is stored as given, callers pass a
+// hash.
+func (s *MagicLinkStore) Create(ctx context.Context, userID int64, token string, expiry time.Time, email *OutboxEmail) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		qctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(qctx, `DELETE FROM magic_links WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO magic_links (token, user_id, expiry) VALUES ($1, $2, $3)`
+		if _, err := tx.ExecContext(qctx, query, token, userID, expiry); err != nil {
+			return err
+		}
+
+		return enqueueEmail(ctx, tx, s.cryptor, email)
+	})
+}
+
+// Consume deletes the link stored under one of hashes, see tokens.Lookup,
+// and returns its user. A link works once; expired and unknown tokens return
+// ErrNotFound.
+func (s *MagicLinkStore) Consume(ctx context.Context, hashes []string) (int64, error) {
+	if len(hashes) == 0 {
+		return 0, ErrNotFound
+	}
+
+	query := `
+		DELETE FROM magic_links
+		WHERE token = ANY($1) AND expiry > NOW()
+		RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, pq.Array(hashes)).Scan(&userID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
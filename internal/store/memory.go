@@ -0,0 +1,4818 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+)
+
+// NewMemoryStorage returns a Storage kept entirely in process memory. It is
+// meant for demo mode and for tests that want real behaviour without
+// PostgreSQL: data is lost on exit, nothing is encrypted and search is
+// simplified. The *sql.Tx arguments of the interface are ignored.
+func NewMemoryStorage() Storage {
+	m := &memoryDB{
+		ids:             make(map[string]int64),
+		users:           make(map[int64]*memUser),
+		invitations:     make(map[string]memToken),
+		roles:           make(map[string]Role),
+		companies:       make(map[int64]*Company),
+		projects:        make(map[int64]*Project),
+		listings:        make(map[int64]*Listing),
+		deletedListings: make(map[int64]*memDeletedListing),
+		applications:    make(map[int64]*Application),
+		favorites:       make(map[int64]map[int64]string),
+		complaints:      make(map[int64]*Complaint),
+		invites:         make(map[int64]*RegistrationInvite),
+		emailChanges:    make(map[int64]*memEmailChange),
+		magicLinks:      make(map[string]memToken),
+		outboxByID:      make(map[int64]*memOutboxEmail),
+		loginEventsByID: make(map[int64]*LoginEvent),
+		suppressions:    make(map[string]*EmailSuppression),
+		trackingOptOuts: make(map[int64]bool),
+		broadcasts:      make(map[int64]*memBroadcast),
+		deliveryWindows: make(map[int64]DeliveryWindow),
+		views:           make(map[memViewKey]int64),
+		listingTags:     make(map[int64]map[string]time.Time),
+		listingVersions: make(map[int64][]ListingVersion),
+		conversations:   make(map[int64]*memConversation),
+		blocks:          make(map[memBlock]string),
+		inviteCodes:     make(map[string]*InviteCode),
+		rolePermissions: make(map[int64][]string),
+		webhooks:        make(map[int64]*Webhook),
+		linkPreviews:    make(map[string]*memLinkPreview),
+		contentFlags:    make(map[int64]*ContentFlag),
+		listingEvents:   make(map[int64]*ListingEvent),
+		contactImports:  make(map[int64]*ContactImport),
+		moderationJobs:  make(map[int64]*ModerationJob),
+		remoteFollowers: make(map[int64]map[string]*RemoteFollower),
+		pushDevices:     make(map[int64]*PushDevice),
+		bannedWords:     make(map[int64]*BannedWord),
+	}
+
+	moderation := []string{PermissionComplaintsResolve, PermissionComplaintsReview, PermissionUsersMute}
+	for _, role := range []Role{
+		{Name: RoleUser, Description: "Regular user", Level: 1},
+		{Name: RoleAgency, Description: "Real estate agency representative", Level: 1, Permissions: []string{PermissionListingsWrite}},
+		{Name: RoleDeveloper, Description: "Property developer representative", Level: 1, Permissions: []string{PermissionListingsWrite}},
+		{Name: RoleModerator, Description: "Moderator", Level: 2, Permissions: moderation},
+		{Name: RoleAdmin, Description: "Administrator", Level: 3, Permissions: append([]string{PermissionListingsWrite}, moderation...)},
+	} {
+		role.ID = m.nextID("roles")
+		m.rolePermissions[role.ID] = normalizePermissions(role.Permissions)
+		role.Permissions = nil
+		m.roles[role.Name] = role
+	}
+	m.tenants = []Tenant{{ID: m.nextID("tenants"), Slug: "default", Name: "Default", CreatedAt: memNow()}}
+
+	return Storage{
+		Users:        &memUserStore{m},
+		LoginEvents:  &memLoginEventStore{m},
+		Roles:        &memRoleStore{m},
+		Companies:    &memCompanyStore{m},
+		Projects:     &memProjectStore{m},
+		Listings:     &memListingStore{m},
+		Applications: &memApplicationStore{m},
+		Messages:     &memMessageStore{m},
+		Favorites:    &memFavoriteStore{m},
+		Dashboard:    &memDashboardStore{m},
+		Complaints:   &memComplaintStore{m},
+		AdminActions: &memAdminActionStore{m},
+		AdminStats:   &memAdminStatsStore{m},
+		Invites:      &memInviteStore{m},
+		EmailChanges: &memEmailChangeStore{m},
+		Usage:        &memUsageStore{m},
+		MagicLinks:   &memMagicLinkStore{m},
+		Outbox:       &memOutboxStore{m},
+		SentEmails:   &memSentEmailStore{m},
+		Suppressions: &memSuppressionStore{m},
+
+		EmailTracking:   &memEmailTrackingStore{m},
+		Broadcasts:      &memBroadcastStore{m},
+		DeliveryWindows: &memDeliveryWindowStore{m},
+		Views:           &memViewStore{m},
+		DeadLetters:     &memDeadLetterStore{m},
+		Tags:            &memTagStore{m},
+		Mentions:        &memMentionStore{m},
+		Conversations:   &memConversationStore{m},
+		Blocks:          &memBlockStore{m},
+		InviteCodes:     &memInviteCodeStore{m},
+		Teams:           &memTeamStore{m},
+		Webhooks:        &memWebhookStore{m},
+		LinkPreviews:    &memLinkPreviewStore{m},
+		ContentFlags:    &memContentFlagStore{m},
+		Tenants:         &memTenantStore{m},
+		ListingEvents:   &memListingEventStore{m},
+		ContactImports:  &memContactImportStore{m},
+		ModerationJobs:  &memModerationJobStore{m},
+		Jobs:            &memJobStore{m},
+		RemoteFollowers: &memRemoteFollowerStore{m},
+		PushDevices:     &memPushDeviceStore{m},
+		BannedWords:     &memBannedWordStore{m},
+	}
+}
+
+type memUser struct {
+	User
+	muted bool
+	// teamRole is users.company_role, set for members of a company
+	teamRole string
+}
+
+type memToken struct {
+	userID int64
+	expiry time.Time
+}
+
+type memMessage struct {
+	ApplicationMessage
+	hidden bool
+	read   bool
+}
+
+type memEmailChange struct {
+	EmailChange
+	oldToken string
+	newToken string
+}
+
+type memDeletedListing struct {
+	*Listing
+	deletedAt time.Time
+}
+
+type memOutboxEmail struct {
+	OutboxEmail
+	nextAttemptAt *time.Time
+	sentAt        *time.Time
+}
+
+// memoryDB holds every table behind one lock. Stores hand out copies so
+// callers cannot modify stored rows without going through a method.
+type memoryDB struct {
+	mu sync.Mutex
+
+	ids             map[string]int64
+	users           map[int64]*memUser
+	invitations     map[string]memToken
+	roles           map[string]Role
+	rolePermissions map[int64][]string
+	webhooks        map[int64]*Webhook
+	deliveries      []*WebhookDelivery
+	linkPreviews    map[string]*memLinkPreview
+	contentFlags    map[int64]*ContentFlag
+	companies       map[int64]*Company
+	projects        map[int64]*Project
+	listings        map[int64]*Listing
+	// deletedListings are soft-deleted; keeping them out of listings
+	// keeps them out of every query
+	deletedListings map[int64]*memDeletedListing
+	applications    map[int64]*Application
+	messages        []*memMessage
+	favorites       map[int64]map[int64]string
+	complaints      map[int64]*Complaint
+	adminActions    []AdminAction
+	invites         map[int64]*RegistrationInvite
+	emailChanges    map[int64]*memEmailChange
+	magicLinks      map[string]memToken
+	outbox          []*memOutboxEmail
+	outboxByID      map[int64]*memOutboxEmail
+	loginEventsByID map[int64]*LoginEvent
+	suppressions    map[string]*EmailSuppression
+	sentEmails      []SentEmail
+	trackingEvents  []memTrackingEvent
+	trackingOptOuts map[int64]bool
+	broadcasts      map[int64]*memBroadcast
+	deliveryWindows map[int64]DeliveryWindow
+	views           map[memViewKey]int64
+	deadLetters     []*DeadLetter
+	listingTags     map[int64]map[string]time.Time
+	listingVersions map[int64][]ListingVersion
+	mentions        []memMention
+	conversations   map[int64]*memConversation
+	directMessages  []*memDirectMessage
+	userStates      []UserStateEvent
+	blocks          map[memBlock]string
+	inviteCodes     map[string]*InviteCode
+	redemptions     []memRedemption
+	tenants         []Tenant
+	listingEvents   map[int64]*ListingEvent
+	contactImports  map[int64]*ContactImport
+	moderationJobs  map[int64]*ModerationJob
+	// jobQueue is in ID order
+	jobQueue        []*jobs.Job
+	remoteFollowers map[int64]map[string]*RemoteFollower
+	pushDevices     map[int64]*PushDevice
+	pushDeliveries  []*memPushDelivery
+	bannedWords     map[int64]*BannedWord
+}
+
+func (m *memoryDB) nextID(table string) int64 {
+	m.ids[table]++
+	return m.ids[table]
+}
+
+func memNow() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// memTokenFor returns the token stored under one of hashes.
+func memTokenFor(stored map[string]memToken, hashes []string) (memToken, bool) {
+	for hash, token := range stored {
+		if tokens.Match(hash, hashes) {
+			return token, true
+		}
+	}
+	return memToken{}, false
+}
+
+// paginate returns the bounds of the page in a slice of length n.
+func paginate(n, limit, offset int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit > 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// userByEmail returns the user of tenantID with email.
+func (m *memoryDB) userByEmail(tenantID int64, email string) *memUser {
+	hash := crypto.HashEmail(email)
+	for _, u := range m.users {
+		if u.TenantID == tenantID && crypto.HashEmail(u.Email) == hash {
+			return u
+		}
+	}
+	return nil
+}
+
+// phoneTaken reports whether a user of tenantID other than exceptID has
+// phone, compared the way the users_tenant_phone_hash_key index does.
+func (m *memoryDB) phoneTaken(tenantID int64, phone string, exceptID int64) bool {
+	hash := crypto.HashPhone(phone)
+	if hash == "" {
+		return false
+	}
+	for id, u := range m.users {
+		if id != exceptID && u.TenantID == tenantID && crypto.HashPhone(u.Phone) == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// usernameTaken mirrors the case-insensitive unique index on usernames
+// within a tenant.
+func (m *memoryDB) usernameTaken(tenantID int64, username string, exceptID int64) bool {
+	for id, u := range m.users {
+		if id != exceptID && u.TenantID == tenantID && strings.EqualFold(u.Username, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// userTenant returns the tenant of the user, the default one if it is
+// unknown.
+func (m *memoryDB) userTenant(userID int64) int64 {
+	if u, ok := m.users[userID]; ok {
+		return u.TenantID
+	}
+	return DefaultTenantID
+}
+
+// companyCountry returns the country of the company, "" if it is unknown.
+func (m *memoryDB) companyCountry(id int64) string {
+	if c, ok := m.companies[id]; ok {
+		return c.Country
+	}
+	return ""
+}
+
+func (m *memoryDB) enqueue(ctx context.Context, email *OutboxEmail) {
+	if email == nil {
+		return
+	}
+	triggeredBy(ctx, email)
+	row := &memOutboxEmail{OutboxEmail: *email}
+	row.ID = m.nextID("outbox")
+	row.CreatedAt = memNow()
+	now := time.Now()
+	if email.SendAfter != nil {
+		now = *email.SendAfter
+	}
+	row.nextAttemptAt = &now
+	email.ID, email.CreatedAt = row.ID, row.CreatedAt
+	m.outbox = append(m.outbox, row)
+	m.outboxByID[row.ID] = row
+}
+
+// Users
+
+type memUserStore struct{ m *memoryDB }
+
+func (s *memUserStore) lookup(ctx context.Context, match func(*memUser) bool) (*User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, u := range s.m.users {
+		if match(u) && u.CanSignIn() && inTenant(ctx, u.TenantID) {
+			user := u.User
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memUserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
+	return s.lookup(ctx, func(u *memUser) bool { return u.ID == userID })
+}
+
+func (s *memUserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	hash := crypto.HashEmail(email)
+	return s.lookup(ctx, func(u *memUser) bool { return crypto.HashEmail(u.Email) == hash })
+}
+
+func (s *memUserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	username = strings.ToLower(username)
+	return s.lookup(ctx, func(u *memUser) bool { return u.Username == username })
+}
+
+func (s *memUserStore) GetByIdentifier(ctx context.Context, identifier string) (*User, error) {
+	if strings.Contains(identifier, "@") {
+		return s.GetByEmail(ctx, identifier)
+	}
+	return s.GetByUsername(ctx, identifier)
+}
+
+func (s *memUserStore) Create(ctx context.Context, _ *sql.Tx, user *User) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.create(ctx, user)
+}
+
+func (s *memUserStore) create(ctx context.Context, user *User) error {
+	user.TenantID = tenantOf(ctx)
+	if s.m.userByEmail(user.TenantID, user.Email) != nil {
+		return ErrDuplicateEmail
+	}
+	if s.m.usernameTaken(user.TenantID, user.Username, 0) {
+		return ErrDuplicateUsername
+	}
+	if s.m.phoneTaken(user.TenantID, user.Phone, 0) {
+		return ErrDuplicatePhone
+	}
+
+	roleName := user.Role.Name
+	if roleName == "" {
+		roleName = RoleUser
+	}
+	role, ok := s.m.roles[roleName]
+	if !ok {
+		return ErrNotFound
+	}
+
+	// Tests create users directly as active; the database always starts
+	// them pending.
+	if user.State == "" {
+		user.State = UserStatePending
+		if user.IsActive {
+			user.State = UserStateActive
+		}
+	}
+	user.IsActive = user.State == UserStateActive
+
+	user.ID = s.m.nextID("users")
+	user.CreatedAt = memNow()
+	user.Role = role
+	user.RoleID = role.ID
+	s.m.users[user.ID] = &memUser{User: *user}
+	return nil
+}
+
+// transition mirrors UserStore.transition. The caller holds s.m.mu.
+func (s *memUserStore) transition(userID int64, to string, actorID *int64, reason string) error {
+	u, ok := s.m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	from := u.State
+	if !CanTransitionUser(from, to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	u.State = to
+	u.IsActive = to == UserStateActive
+	if u.IsActive && u.ActivatedAt == nil {
+		now := time.Now()
+		u.ActivatedAt = &now
+	}
+	s.m.userStates = append(s.m.userStates, UserStateEvent{
+		ID:        s.m.nextID("user_state_events"),
+		UserID:    userID,
+		FromState: from,
+		ToState:   to,
+		ActorID:   actorID,
+		Reason:    reason,
+		CreatedAt: memNow(),
+	})
+	return nil
+}
+
+// createWithUniqueUsername mirrors UserStore: on a collision it retries
+// with a numeric suffix.
+func (s *memUserStore) createWithUniqueUsername(ctx context.Context, user *User) error {
+	base := user.Username
+	for attempt := 1; ; attempt++ {
+		err := s.create(ctx, user)
+		if !errors.Is(err, ErrDuplicateUsername) || attempt == maxUsernameAttempts {
+			return err
+		}
+		user.Username = fmt.Sprintf("%s%d", base, attempt+1)
+	}
+}
+
+// invite stores the activation token and queues the welcome email. Like
+// the transaction in UserStore, a failure removes the user again.
+func (s *memUserStore) invite(ctx context.Context, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
+	s.m.invitations[token] = memToken{userID: user.ID, expiry: time.Now().Add(exp)}
+
+	if welcome != nil {
+		email, err := welcome(user)
+		if err != nil {
+			delete(s.m.invitations, token)
+			delete(s.m.users, user.ID)
+			return err
+		}
+		s.m.enqueue(ctx, email)
+	}
+	return nil
+}
+
+func (s *memUserStore) CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if err := s.createWithUniqueUsername(ctx, user); err != nil {
+		return err
+	}
+	return s.invite(ctx, user, token, exp, welcome)
+}
+
+func (s *memUserStore) CreateActive(ctx context.Context, user *User) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	user.State = UserStatePending
+	user.IsActive = false
+	if err := s.createWithUniqueUsername(ctx, user); err != nil {
+		return err
+	}
+	if err := s.transition(user.ID, UserStateActive, nil, "activation disabled"); err != nil {
+		return err
+	}
+	user.State = UserStateActive
+	user.IsActive = true
+	user.ActivatedAt = s.m.users[user.ID].ActivatedAt
+	return nil
+}
+
+func (s *memUserStore) CreateCompanyAndUser(ctx context.Context, company *Company, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if err := (&memCompanyStore{s.m}).create(ctx, company); err != nil {
+		return err
+	}
+
+	user.CompanyID = &company.ID
+	if err := s.createWithUniqueUsername(ctx, user); err != nil {
+		delete(s.m.companies, company.ID)
+		return err
+	}
+	s.m.users[user.ID].teamRole = TeamRoleOwner
+	if err := s.invite(ctx, user, token, exp, welcome); err != nil {
+		delete(s.m.companies, company.ID)
+		return err
+	}
+	return nil
+}
+
+func (s *memUserStore) Reinvite(ctx context.Context, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if u.State != UserStatePending {
+		return ErrNotPending
+	}
+
+	var email *OutboxEmail
+	if welcome != nil {
+		var err error
+		if email, err = welcome(user); err != nil {
+			return err
+		}
+	}
+
+	for t, inv := range s.m.invitations {
+		if inv.userID == user.ID {
+			delete(s.m.invitations, t)
+		}
+	}
+	s.m.invitations[token] = memToken{userID: user.ID, expiry: time.Now().Add(exp)}
+	if email != nil {
+		s.m.enqueue(ctx, email)
+	}
+	return nil
+}
+
+func (s *memUserStore) Activate(ctx context.Context, hashes []string) (*User, error) {
+	userID, err := s.activate(hashes)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, userID)
+}
+
+func (s *memUserStore) activate(hashes []string) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	invitation, ok := memTokenFor(s.m.invitations, hashes)
+	if !ok || time.Now().After(invitation.expiry) {
+		return 0, ErrNotFound
+	}
+
+	u, ok := s.m.users[invitation.userID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	switch u.State {
+	case UserStatePending:
+		if err := s.transition(u.ID, UserStateActive, nil, "activated"); err != nil {
+			return 0, err
+		}
+	case UserStateActive:
+	default:
+		return 0, ErrNotFound
+	}
+
+	for t, inv := range s.m.invitations {
+		if inv.userID == u.ID {
+			delete(s.m.invitations, t)
+		}
+	}
+	return u.ID, nil
+}
+
+func (s *memUserStore) Delete(ctx context.Context, userID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.users, userID)
+	return nil
+}
+
+func (s *memUserStore) update(userID int64, fn func(*memUser)) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(u)
+	return nil
+}
+
+func (s *memUserStore) UpdateProfile(ctx context.Context, userID int64, firstName, lastName, phone string) error {
+	s.m.mu.Lock()
+	taken := s.m.phoneTaken(s.m.userTenant(userID), phone, userID)
+	s.m.mu.Unlock()
+	if taken {
+		return ErrDuplicatePhone
+	}
+
+	return s.update(userID, func(u *memUser) {
+		u.FirstName, u.LastName, u.Phone = firstName, lastName, phone
+	})
+}
+
+func (s *memUserStore) UpdateLocalization(ctx context.Context, userID int64, locale, region, timezone *string) error {
+	return s.update(userID, func(u *memUser) {
+		if locale != nil {
+			u.Locale = *locale
+		}
+		if region != nil {
+			u.Region = *region
+		}
+		if timezone != nil {
+			u.Timezone = *timezone
+		}
+	})
+}
+
+func (s *memUserStore) UpdateUsername(ctx context.Context, userID int64, username string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.m.usernameTaken(u.TenantID, username, userID) {
+		return ErrDuplicateUsername
+	}
+	u.Username = username
+	return nil
+}
+
+func (s *memUserStore) SetPrivate(ctx context.Context, userID int64, private bool) error {
+	return s.update(userID, func(u *memUser) { u.Private = private })
+}
+
+func (s *memUserStore) UpdatePassword(ctx context.Context, userID int64, hashedPassword []byte) error {
+	return s.update(userID, func(u *memUser) {
+		u.Password = password{hash: hashedPassword}
+	})
+}
+
+func (s *memUserStore) List(ctx context.Context, fq PaginatedQuery) ([]User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	users := s.matching(ctx, fq)
+	sort.Slice(users, func(i, j int) bool { return users[i].ID > users[j].ID })
+
+	limit := fq.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	start, end := paginate(len(users), limit, fq.Offset)
+	return users[start:end], nil
+}
+
+func (s *memUserStore) Count(ctx context.Context, fq PaginatedQuery) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return len(s.matching(ctx, fq)), nil
+}
+
+func (s *memUserStore) matching(ctx context.Context, fq PaginatedQuery) []User {
+	search := strings.ToLower(fq.Search)
+	var users []User
+	for _, u := range s.m.users {
+		if !inTenant(ctx, u.TenantID) {
+			continue
+		}
+		if search != "" && !strings.Contains(u.Username, search) && !strings.EqualFold(u.Email, fq.Search) {
+			continue
+		}
+		users = append(users, u.User)
+	}
+	return users
+}
+
+func (s *memUserStore) Transition(ctx context.Context, userID int64, to string, actorID *int64, reason string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.transition(userID, to, actorID, reason)
+}
+
+func (s *memUserStore) StateHistory(ctx context.Context, userID int64) ([]UserStateEvent, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	events := []UserStateEvent{}
+	for i := len(s.m.userStates) - 1; i >= 0; i-- {
+		if s.m.userStates[i].UserID == userID {
+			events = append(events, s.m.userStates[i])
+		}
+	}
+	return events, nil
+}
+
+func (s *memUserStore) UpdateRole(ctx context.Context, userID int64, roleID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, role := range s.m.roles {
+		if role.ID == roleID {
+			u.Role = role
+			u.RoleID = role.ID
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memUserStore) SetMuted(ctx context.Context, userID int64, muted bool) error {
+	return s.update(userID, func(u *memUser) { u.muted = muted })
+}
+
+func (s *memUserStore) HideMessages(ctx context.Context, userID int64) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var hidden int64
+	for _, msg := range s.m.directMessages {
+		if msg.SenderID == userID && !msg.hidden {
+			msg.hidden = true
+			hidden++
+		}
+	}
+	for _, msg := range s.m.messages {
+		if msg.SenderUserID != nil && *msg.SenderUserID == userID && !msg.hidden {
+			msg.hidden = true
+			hidden++
+		}
+	}
+	return hidden, nil
+}
+
+func (s *memUserStore) NormalizeCountries(ctx context.Context, normalize func(string) (string, bool)) (int64, []string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var updated int64
+	var unknown []string
+	for _, u := range s.m.users {
+		if u.Country == "" {
+			continue
+		}
+		code, ok := normalize(u.Country)
+		switch {
+		case !ok:
+			if !slices.Contains(unknown, u.Country) {
+				unknown = append(unknown, u.Country)
+			}
+		case code != u.Country:
+			u.Country = code
+			updated++
+		}
+	}
+	sort.Strings(unknown)
+	return updated, unknown, nil
+}
+
+func (s *memUserStore) TakenUsernames(ctx context.Context, candidates []string) (map[string]bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	taken := make(map[string]bool, len(candidates))
+	for _, u := range s.m.users {
+		if !inTenant(ctx, u.TenantID) {
+			continue
+		}
+		for _, candidate := range candidates {
+			if u.Username == candidate {
+				taken[candidate] = true
+			}
+		}
+	}
+	return taken, nil
+}
+
+func (s *memUserStore) MatchEmailHashes(ctx context.Context, hashes []string, excludeUserID int64) ([]ContactMatch, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		wanted[hash] = true
+	}
+
+	var matches []ContactMatch
+	for _, u := range s.m.users {
+		hash := crypto.HashEmail(u.Email)
+		if !u.IsActive || u.Private || u.ID == excludeUserID || !wanted[hash] || !inTenant(ctx, u.TenantID) {
+			continue
+		}
+		matches = append(matches, ContactMatch{
+			Hash:      hash,
+			UserID:    u.ID,
+			Username:  u.Username,
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Role:      u.Role.Name,
+			CompanyID: u.CompanyID,
+		})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Username < matches[j].Username })
+	return matches, nil
+}
+
+func (s *memUserStore) MatchUsernames(ctx context.Context, usernames []string, excludeUserID int64) ([]ContactMatch, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		wanted[username] = true
+	}
+
+	var matches []ContactMatch
+	for _, u := range s.m.users {
+		if !u.IsActive || u.Private || u.ID == excludeUserID || !wanted[u.Username] || !inTenant(ctx, u.TenantID) {
+			continue
+		}
+		matches = append(matches, ContactMatch{
+			UserID:    u.ID,
+			Username:  u.Username,
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Role:      u.Role.Name,
+			CompanyID: u.CompanyID,
+		})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Username < matches[j].Username })
+	return matches, nil
+}
+
+func (s *memUserStore) PublicProfiles(ctx context.Context, ids []int64, viewerID int64, staff bool) ([]PublicProfile, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	known := func(userID int64) bool {
+		userA, userB := conversationPair(userID, viewerID)
+		for _, c := range s.m.conversations {
+			if c.userA == userA && c.userB == userB {
+				return true
+			}
+		}
+		return false
+	}
+
+	profiles := []PublicProfile{}
+	for _, u := range s.m.users {
+		if !wanted[u.ID] || !u.CanSignIn() || !inTenant(ctx, u.TenantID) {
+			continue
+		}
+		if _, blocked := s.m.blocks[memBlock{u.ID, viewerID}]; blocked {
+			continue
+		}
+		if u.Private && u.ID != viewerID && !staff && !known(u.ID) {
+			continue
+		}
+		profiles = append(profiles, PublicProfile{
+			ID:        u.ID,
+			Username:  u.Username,
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Role:      u.Role.Name,
+			CompanyID: u.CompanyID,
+			JobTitle:  u.JobTitle,
+			CreatedAt: u.CreatedAt,
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].ID < profiles[j].ID })
+	return profiles, nil
+}
+
+// Login events
+
+type memLoginEventStore struct{ m *memoryDB }
+
+func (s *memLoginEventStore) Create(ctx context.Context, event *LoginEvent) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	event.ID = s.m.nextID("login_events")
+	event.CreatedAt = memNow()
+	e := *event
+	s.m.loginEventsByID[e.ID] = &e
+	return nil
+}
+
+// successfulLogins returns userID's successful logins, newest first. The
+// caller holds the lock.
+func (m *memoryDB) successfulLogins(userID int64) []LoginEvent {
+	events := []LoginEvent{}
+	for _, e := range m.loginEventsByID {
+		if e.Success && e.UserID != nil && *e.UserID == userID {
+			events = append(events, *e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID > events[j].ID })
+	return events
+}
+
+func (s *memLoginEventStore) History(ctx context.Context, userID int64, country, device string) (*LoginHistory, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	history := &LoginHistory{}
+	for _, e := range s.m.successfulLogins(userID) {
+		history.Logins++
+		history.KnownCountry = history.KnownCountry || e.Country == country
+		history.KnownDevice = history.KnownDevice || e.Device == device
+	}
+	return history, nil
+}
+
+func (s *memLoginEventStore) ListSuccessful(ctx context.Context, userID int64, fq PaginatedQuery) ([]LoginEvent, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	events := s.m.successfulLogins(userID)
+	start, end := paginate(len(events), fq.Limit, fq.Offset)
+	return events[start:end], nil
+}
+
+// Roles
+
+type memRoleStore struct{ m *memoryDB }
+
+func (s *memRoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	role, ok := s.m.roles[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &role, nil
+}
+
+func (s *memRoleStore) List(ctx context.Context) ([]Role, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	roles := make([]Role, 0, len(s.m.roles))
+	for _, role := range s.m.roles {
+		role.Permissions = append([]string{}, s.m.rolePermissions[role.ID]...)
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].Level != roles[j].Level {
+			return roles[i].Level < roles[j].Level
+		}
+		return roles[i].ID < roles[j].ID
+	})
+	return roles, nil
+}
+
+func (s *memRoleStore) Create(ctx context.Context, role *Role) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.roles[role.Name]; ok {
+		return ErrConflict
+	}
+	role.ID = s.m.nextID("roles")
+	role.Permissions = normalizePermissions(role.Permissions)
+	s.m.rolePermissions[role.ID] = role.Permissions
+
+	stored := *role
+	stored.Permissions = nil
+	s.m.roles[role.Name] = stored
+	return nil
+}
+
+func (s *memRoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, role := range s.m.roles {
+		if role.ID == roleID {
+			s.m.rolePermissions[roleID] = normalizePermissions(permissions)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memRoleStore) PermissionsByRole(ctx context.Context) (map[string][]string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	byRole := make(map[string][]string, len(s.m.roles))
+	for _, role := range s.m.roles {
+		if permissions := s.m.rolePermissions[role.ID]; len(permissions) > 0 {
+			byRole[role.Name] = append([]string{}, permissions...)
+		}
+	}
+	return byRole, nil
+}
+
+// Companies
+
+type memCompanyStore struct{ m *memoryDB }
+
+func (s *memCompanyStore) create(ctx context.Context, company *Company) error {
+	company.TenantID = tenantOf(ctx)
+	for _, c := range s.m.companies {
+		if c.TenantID != company.TenantID {
+			continue
+		}
+		if c.RegistrationNumber == company.RegistrationNumber {
+			return ErrDuplicateRegistrationNumber
+		}
+		if strings.EqualFold(c.Email, company.Email) {
+			return ErrDuplicateCompanyEmail
+		}
+	}
+
+	company.ID = s.m.nextID("companies")
+	company.CreatedAt = memNow()
+	company.UpdatedAt = company.CreatedAt
+	if company.VerificationStatus == "" {
+		company.VerificationStatus = VerificationPending
+	}
+	c := *company
+	s.m.companies[c.ID] = &c
+	return nil
+}
+
+func (s *memCompanyStore) Create(ctx context.Context, _ *sql.Tx, company *Company) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.create(ctx, company)
+}
+
+func (s *memCompanyStore) GetByID(ctx context.Context, id int64) (*Company, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.companies[id]
+	if !ok || !inTenant(ctx, c.TenantID) {
+		return nil, ErrNotFound
+	}
+	company := *c
+	return &company, nil
+}
+
+func (s *memCompanyStore) GetByRegistrationNumber(ctx context.Context, number string) (*Company, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, c := range s.m.companies {
+		if c.RegistrationNumber == number && inTenant(ctx, c.TenantID) {
+			company := *c
+			return &company, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memCompanyStore) UpdateVerificationStatus(ctx context.Context, id int64, status string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.companies[id]
+	if !ok || !inTenant(ctx, c.TenantID) {
+		return ErrNotFound
+	}
+	c.VerificationStatus = status
+	c.UpdatedAt = memNow()
+	return nil
+}
+
+func (s *memCompanyStore) List(ctx context.Context, fq PaginatedFeedQuery) ([]Company, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var companies []Company
+	for _, c := range s.m.companies {
+		if !inTenant(ctx, c.TenantID) || (fq.Search != "" && c.VerificationStatus != fq.Search) {
+			continue
+		}
+		companies = append(companies, *c)
+	}
+	sort.Slice(companies, func(i, j int) bool { return companies[i].ID > companies[j].ID })
+
+	start, end := paginate(len(companies), fq.Limit, fq.Offset)
+	return companies[start:end], nil
+}
+
+// Projects
+
+type memProjectStore struct{ m *memoryDB }
+
+func (s *memProjectStore) Create(ctx context.Context, project *Project) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	project.ID = s.m.nextID("projects")
+	project.CreatedAt = memNow()
+	project.UpdatedAt = project.CreatedAt
+	p := *project
+	s.m.projects[p.ID] = &p
+	return nil
+}
+
+func (s *memProjectStore) ListByCompany(ctx context.Context, companyID int64) ([]Project, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var projects []Project
+	for _, p := range s.m.projects {
+		if p.CompanyID == companyID {
+			projects = append(projects, *p)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID > projects[j].ID })
+	return projects, nil
+}
+
+func (s *memProjectStore) GetByID(ctx context.Context, id int64) (*Project, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.projects[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	project := *p
+	return &project, nil
+}
+
+func (s *memProjectStore) Update(ctx context.Context, project *Project) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.projects[project.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	p.Name, p.Description, p.City = project.Name, project.Description, project.City
+	p.UpdatedAt = memNow()
+	project.UpdatedAt = p.UpdatedAt
+	return nil
+}
+
+func (s *memProjectStore) Delete(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.projects[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.projects, id)
+	return nil
+}
+
+// Listings
+
+type memListingStore struct{ m *memoryDB }
+
+func (s *memListingStore) copyListing(l *Listing) Listing {
+	listing := *l
+	listing.Media = append([]ListingMedia(nil), l.Media...)
+	if l.RentConstraints != nil {
+		rent := *l.RentConstraints
+		listing.RentConstraints = &rent
+	}
+	if c, ok := s.m.companies[l.CompanyID]; ok {
+		listing.CompanyName = c.Name
+	}
+	return listing
+}
+
+func (s *memListingStore) Create(ctx context.Context, listing *Listing, media []ListingMedia, rent *RentConstraints) error {
+	if _, ok := ListingDealTypes[listing.DealType]; !ok {
+		return ErrInvalidDealType
+	}
+	if _, ok := ListingStatuses[listing.Status]; !ok {
+		return ErrInvalidStatus
+	}
+	if err := listing.applyLimits(); err != nil {
+		return err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	listing.ID = s.m.nextID("listings")
+	listing.TenantID = tenantOf(ctx)
+	listing.CreatedAt = memNow()
+	listing.UpdatedAt = listing.CreatedAt
+	listing.Version = 1
+	if listing.Status == ListingStatusActive {
+		published := listing.CreatedAt
+		listing.PublishedAt = &published
+	}
+
+	listing.Media = nil
+	for i := range media {
+		media[i].ID = s.m.nextID("listing_media")
+		media[i].ListingID = listing.ID
+		listing.Media = append(listing.Media, media[i])
+	}
+	if rent != nil && listing.DealType == "rent" {
+		rent.ListingID = listing.ID
+		r := *rent
+		listing.RentConstraints = &r
+	}
+
+	l := *listing
+	l.Media = append([]ListingMedia(nil), listing.Media...)
+	s.m.listings[l.ID] = &l
+	return nil
+}
+
+func (s *memListingStore) CreateMedia(ctx context.Context, media *ListingMedia) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.listings[media.ListingID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	media.ID = s.m.nextID("listing_media")
+	media.Position = 0
+	for _, existing := range l.Media {
+		if existing.Position >= media.Position {
+			media.Position = existing.Position + 1
+		}
+	}
+	l.Media = append(l.Media, *media)
+	return nil
+}
+
+func (s *memListingStore) GetMediaByID(ctx context.Context, listingID, mediaID int64) (*ListingMedia, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if l, ok := s.m.listings[listingID]; ok {
+		for _, media := range l.Media {
+			if media.ID == mediaID {
+				return &media, nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memListingStore) DeleteMedia(ctx context.Context, listingID, mediaID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if l, ok := s.m.listings[listingID]; ok {
+		for i, media := range l.Media {
+			if media.ID == mediaID {
+				l.Media = append(l.Media[:i], l.Media[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memListingStore) UpdateStatus(ctx context.Context, id int64, status string) error {
+	if _, ok := ListingStatuses[status]; !ok {
+		return ErrInvalidStatus
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.listings[id]
+	if !ok {
+		return ErrNotFound
+	}
+	l.Status = status
+	l.UpdatedAt = memNow()
+	if status != ListingStatusActive {
+		l.PinnedAt = nil
+	}
+	if status == ListingStatusActive {
+		if memPublishDue(l, time.Now()) {
+			published := l.UpdatedAt
+			l.PublishedAt = &published
+		} else {
+			l.Status = ListingStatusScheduled
+		}
+	}
+	return nil
+}
+
+func (s *memListingStore) PublishDue(ctx context.Context) ([]int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var ids []int64
+	for _, l := range s.m.listings {
+		if l.Status != ListingStatusScheduled || !memPublishDue(l, now) {
+			continue
+		}
+		l.Status = ListingStatusActive
+		l.UpdatedAt = memNow()
+		published := l.UpdatedAt
+		l.PublishedAt = &published
+		ids = append(ids, l.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// memPublishDue reports whether l has no publish_at or it has passed.
+func memPublishDue(l *Listing, now time.Time) bool {
+	if l.PublishAt == nil {
+		return true
+	}
+	at, err := time.Parse(time.RFC3339, *l.PublishAt)
+	return err != nil || !at.After(now)
+}
+
+func (s *memListingStore) Update(ctx context.Context, listing *Listing) error {
+	if err := listing.applyLimits(); err != nil {
+		return err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.listings[listing.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if l.Version != listing.Version {
+		return ErrConflict
+	}
+
+	now := memNow()
+	s.m.listingVersions[l.ID] = append(s.m.listingVersions[l.ID], ListingVersion{
+		ListingID:    l.ID,
+		Version:      l.Version,
+		ProjectID:    l.ProjectID,
+		Title:        l.Title,
+		Description:  l.Description,
+		PropertyType: l.PropertyType,
+		DealType:     l.DealType,
+		Price:        l.Price,
+		City:         l.City,
+		Address:      l.Address,
+		Rooms:        l.Rooms,
+		Area:         l.Area,
+		Floor:        l.Floor,
+		TotalFloors:  l.TotalFloors,
+		Latitude:     l.Latitude,
+		Longitude:    l.Longitude,
+		PublishAt:    l.PublishAt,
+		ReplacedAt:   now,
+	})
+
+	media, rent, createdAt, publishedAt, status := l.Media, l.RentConstraints, l.CreatedAt, l.PublishedAt, l.Status
+	*l = *listing
+	l.Media, l.RentConstraints, l.CreatedAt, l.PublishedAt, l.Status = media, rent, createdAt, publishedAt, status
+	l.Version++
+	l.UpdatedAt, l.EditedAt, l.Edited = now, &now, true
+	listing.UpdatedAt, listing.Version, listing.EditedAt, listing.Edited = l.UpdatedAt, l.Version, l.EditedAt, true
+	return nil
+}
+
+func (s *memListingStore) Pin(ctx context.Context, listingID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.listings[listingID]
+	if !ok {
+		return ErrNotFound
+	}
+	if l.Status != ListingStatusActive {
+		return ErrNotActive
+	}
+	if l.PinnedAt != nil {
+		return nil
+	}
+	var count int
+	for _, other := range s.m.listings {
+		if other.CompanyID == l.CompanyID && other.PinnedAt != nil {
+			count++
+		}
+	}
+	if count >= MaxPinnedListings {
+		return ErrPinLimit
+	}
+	now := memNow()
+	l.PinnedAt = &now
+	return nil
+}
+
+func (s *memListingStore) Unpin(ctx context.Context, listingID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.listings[listingID]
+	if !ok {
+		return ErrNotFound
+	}
+	l.PinnedAt = nil
+	return nil
+}
+
+func (s *memListingStore) Versions(ctx context.Context, listingID int64) ([]ListingVersion, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	versions := []ListingVersion{}
+	saved := s.m.listingVersions[listingID]
+	for i := len(saved) - 1; i >= 0; i-- {
+		versions = append(versions, saved[i])
+	}
+	return versions, nil
+}
+
+func (s *memListingStore) Delete(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.listings[id]
+	if !ok {
+		return ErrNotFound
+	}
+	l.PinnedAt = nil
+	delete(s.m.listings, id)
+	s.m.deletedListings[id] = &memDeletedListing{Listing: l, deletedAt: time.Now()}
+	return nil
+}
+
+func (s *memListingStore) Restore(ctx context.Context, id, companyID int64, since time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d, ok := s.m.deletedListings[id]
+	if !ok || d.CompanyID != companyID || !d.deletedAt.After(since) || !inTenant(ctx, d.TenantID) {
+		return ErrNotFound
+	}
+	delete(s.m.deletedListings, id)
+	d.UpdatedAt = memNow()
+	s.m.listings[id] = d.Listing
+	return nil
+}
+
+func (s *memListingStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var purged int64
+	for id, d := range s.m.deletedListings {
+		if d.deletedAt.Before(before) {
+			s.m.purgeListing(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purgeListing removes a deleted listing and what cascades from it.
+func (m *memoryDB) purgeListing(id int64) {
+	delete(m.deletedListings, id)
+	delete(m.listingTags, id)
+	delete(m.listingVersions, id)
+	for _, favorites := range m.favorites {
+		delete(favorites, id)
+	}
+	for eventID, event := range m.listingEvents {
+		if event.ListingID == id {
+			delete(m.listingEvents, eventID)
+		}
+	}
+}
+
+func (s *memListingStore) GetByID(ctx context.Context, id int64) (*Listing, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.listings[id]
+	if !ok || !inTenant(ctx, l.TenantID) {
+		return nil, ErrNotFound
+	}
+	listing := s.copyListing(l)
+	return &listing, nil
+}
+
+func (s *memListingStore) List(ctx context.Context, filter ListingFilter) ([]Listing, error) {
+	if err := filter.normalize(); err != nil {
+		return nil, err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var listings []Listing
+	for _, l := range s.m.listings {
+		switch {
+		case l.Status != filter.Status,
+			!inTenant(ctx, l.TenantID),
+			filter.DealType != "" && l.DealType != filter.DealType,
+			filter.City != "" && !strings.EqualFold(l.City, filter.City),
+			filter.PropertyType != "" && l.PropertyType != filter.PropertyType,
+			filter.PriceMin > 0 && l.Price < filter.PriceMin,
+			filter.PriceMax > 0 && l.Price > filter.PriceMax,
+			filter.RoomsMin > 0 && (l.Rooms == nil || *l.Rooms < filter.RoomsMin),
+			filter.RoomsMax > 0 && (l.Rooms == nil || *l.Rooms > filter.RoomsMax),
+			filter.AreaMin > 0 && (l.Area == nil || *l.Area < filter.AreaMin),
+			filter.AreaMax > 0 && (l.Area == nil || *l.Area > filter.AreaMax),
+			filter.CompanyID != nil && l.CompanyID != *filter.CompanyID,
+			filter.Tag != "" && s.m.listingTags[l.ID][filter.Tag].IsZero():
+			continue
+		}
+		listings = append(listings, s.copyListing(l))
+	}
+	var scores map[int64]float64
+	switch filter.Sort {
+	case ListingSortRanked:
+		scores = s.rankScores(listings, filter.ViewerID)
+	case ListingSortTrending:
+		scores = s.trendingScores(filter.EngagedSince)
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		if filter.Region != "" {
+			iLocal, jLocal := s.m.companyCountry(listings[i].CompanyID) == filter.Region, s.m.companyCountry(listings[j].CompanyID) == filter.Region
+			if iLocal != jLocal {
+				return iLocal
+			}
+		}
+		if filter.PinnedFirst {
+			iPinned, jPinned := listings[i].PinnedAt, listings[j].PinnedAt
+			if (iPinned != nil) != (jPinned != nil) {
+				return iPinned != nil
+			}
+			if iPinned != nil && *iPinned != *jPinned {
+				return *iPinned > *jPinned
+			}
+		}
+		if si, sj := scores[listings[i].ID], scores[listings[j].ID]; si != sj {
+			return si > sj
+		}
+		return listings[i].ID > listings[j].ID
+	})
+
+	start, end := paginate(len(listings), filter.Limit, filter.Offset)
+	return listings[start:end], nil
+}
+
+// rankScores scores the listings for the ranked sort, as the SQL does.
+func (s *memListingStore) rankScores(listings []Listing, viewerID int64) map[int64]float64 {
+	favorites := make(map[int64]int)
+	applications := make(map[int64]int)
+	affinity := make(map[int64]int)
+	for userID, saved := range s.m.favorites {
+		for listingID := range saved {
+			favorites[listingID]++
+			if userID == viewerID {
+				if l, ok := s.m.listings[listingID]; ok {
+					affinity[l.CompanyID]++
+				}
+			}
+		}
+	}
+	for _, a := range s.m.applications {
+		applications[a.ListingID]++
+		if a.UserID == viewerID {
+			if l, ok := s.m.listings[a.ListingID]; ok {
+				affinity[l.CompanyID]++
+			}
+		}
+	}
+
+	now := time.Now()
+	scores := make(map[int64]float64, len(listings))
+	for _, l := range listings {
+		published := l.CreatedAt
+		if l.PublishedAt != nil {
+			published = *l.PublishedAt
+		}
+		var age time.Duration
+		if t, err := time.Parse(time.RFC3339, published); err == nil {
+			age = now.Sub(t)
+		}
+		var viewerAffinity int
+		if viewerID != 0 {
+			viewerAffinity = affinity[l.CompanyID]
+		}
+		scores[l.ID] = rankScore(age, favorites[l.ID], applications[l.ID], viewerAffinity)
+	}
+	return scores
+}
+
+// trendingScores scores the listings engaged with since since for the
+// trending sort, as the SQL does; others score zero.
+func (s *memListingStore) trendingScores(since time.Time) map[int64]float64 {
+	from := since.UTC().Format(time.RFC3339)
+	day := since.UTC().Format(time.DateOnly)
+
+	favorites := make(map[int64]int)
+	applications := make(map[int64]int)
+	views := make(map[int64]int64)
+	for _, saved := range s.m.favorites {
+		for listingID, at := range saved {
+			if at >= from {
+				favorites[listingID]++
+			}
+		}
+	}
+	for _, a := range s.m.applications {
+		if a.CreatedAt >= from {
+			applications[a.ListingID]++
+		}
+	}
+	for key, n := range s.m.views {
+		if key.kind == ViewListing && key.day >= day {
+			views[key.targetID] += n
+		}
+	}
+
+	scores := make(map[int64]float64)
+	for id := range s.m.listings {
+		scores[id] = trendingScore(favorites[id], applications[id], views[id])
+	}
+	return scores
+}
+
+// Applications
+
+type memApplicationStore struct{ m *memoryDB }
+
+func (s *memApplicationStore) Create(ctx context.Context, a *Application) error {
+	if _, ok := ListingDealTypes[a.DealType]; !ok {
+		return ErrInvalidDealType
+	}
+	if err := a.applyLimits(); err != nil {
+		return err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, existing := range s.m.applications {
+		if existing.ListingID == a.ListingID && existing.UserID == a.UserID {
+			return ErrConflict
+		}
+	}
+
+	a.ID = s.m.nextID("applications")
+	if a.Status == "" {
+		a.Status = ApplicationStatusNew
+	}
+	a.CreatedAt = memNow()
+	a.UpdatedAt = a.CreatedAt
+	application := *a
+	s.m.applications[a.ID] = &application
+	return nil
+}
+
+func (s *memApplicationStore) UpdateStatus(ctx context.Context, id int64, status string) error {
+	if _, ok := ApplicationStatuses[status]; !ok {
+		return ErrInvalidStatus
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	a, ok := s.m.applications[id]
+	if !ok {
+		return ErrNotFound
+	}
+	a.Status = status
+	a.UpdatedAt = memNow()
+	return nil
+}
+
+func (s *memApplicationStore) GetByID(ctx context.Context, id int64) (*Application, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	a, ok := s.m.applications[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	application := *a
+	return &application, nil
+}
+
+func (s *memApplicationStore) List(ctx context.Context, filter ApplicationFilter) ([]Application, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var applications []Application
+	for _, a := range s.m.applications {
+		if filter.Status != "" && a.Status != filter.Status {
+			continue
+		}
+		if filter.UserID != nil && a.UserID != *filter.UserID {
+			continue
+		}
+		if filter.CompanyID != nil {
+			l, ok := s.m.listings[a.ListingID]
+			if !ok || l.CompanyID != *filter.CompanyID {
+				continue
+			}
+		}
+		applications = append(applications, *a)
+	}
+	sort.Slice(applications, func(i, j int) bool { return applications[i].ID > applications[j].ID })
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	start, end := paginate(len(applications), limit, filter.Offset)
+	return applications[start:end], nil
+}
+
+func (s *memApplicationStore) GetByListingAndUser(ctx context.Context, listingID, userID int64) (*Application, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, a := range s.m.applications {
+		if a.ListingID == listingID && a.UserID == userID {
+			application := *a
+			return &application, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Messages
+
+type memMessageStore struct{ m *memoryDB }
+
+func (s *memMessageStore) Create(ctx context.Context, msg *ApplicationMessage) error {
+	if err := Limits.Apply(LimitMessage, &msg.Body); err != nil {
+		return err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	msg.ID = s.m.nextID("application_messages")
+	msg.CreatedAt = memNow()
+
+	row := &memMessage{ApplicationMessage: *msg, hidden: msg.Held}
+	if msg.SenderUserID != nil {
+		if u, ok := s.m.users[*msg.SenderUserID]; ok {
+			row.hidden = row.hidden || u.muted
+		}
+	}
+	s.m.messages = append(s.m.messages, row)
+	return nil
+}
+
+func (s *memMessageStore) List(ctx context.Context, applicationID, viewerID int64, limit, offset int) ([]ApplicationMessage, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var messages []ApplicationMessage
+	for _, msg := range s.m.messages {
+		if msg.ApplicationID != applicationID {
+			continue
+		}
+		if msg.hidden && (msg.SenderUserID == nil || *msg.SenderUserID != viewerID) {
+			continue
+		}
+		messages = append(messages, msg.ApplicationMessage)
+	}
+
+	start, end := paginate(len(messages), limit, offset)
+	return messages[start:end], nil
+}
+
+func (s *memMessageStore) Release(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, msg := range s.m.messages {
+		if msg.ID != id {
+			continue
+		}
+		msg.hidden = false
+		if msg.SenderUserID != nil {
+			if u, ok := s.m.users[*msg.SenderUserID]; ok {
+				msg.hidden = u.muted
+			}
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+// Favorites
+
+type memFavoriteStore struct{ m *memoryDB }
+
+func (s *memFavoriteStore) Add(ctx context.Context, userID, listingID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.listings[listingID]; !ok {
+		return ErrNotFound
+	}
+	favorites, ok := s.m.favorites[userID]
+	if !ok {
+		favorites = make(map[int64]string)
+		s.m.favorites[userID] = favorites
+	}
+	if _, exists := favorites[listingID]; exists {
+		return ErrConflict
+	}
+	favorites[listingID] = memNow()
+	return nil
+}
+
+func (s *memFavoriteStore) Remove(ctx context.Context, userID, listingID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.favorites[userID][listingID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.favorites[userID], listingID)
+	return nil
+}
+
+func (s *memFavoriteStore) ListByUser(ctx context.Context, userID int64) ([]FavoriteListing, error) {
+	favorites := []FavoriteListing{}
+	err := s.Each(ctx, userID, func(f FavoriteListing) error {
+		favorites = append(favorites, f)
+		return nil
+	})
+	return favorites, err
+}
+
+func (s *memFavoriteStore) Each(ctx context.Context, userID int64, fn func(FavoriteListing) error) error {
+	s.m.mu.Lock()
+	var favorites []FavoriteListing
+	for listingID, createdAt := range s.m.favorites[userID] {
+		l, ok := s.m.listings[listingID]
+		if !ok {
+			continue
+		}
+		f := FavoriteListing{
+			ListingID: l.ID,
+			Title:     l.Title,
+			City:      l.City,
+			Price:     l.Price,
+			Area:      l.Area,
+			CreatedAt: createdAt,
+		}
+		if len(l.Media) > 0 {
+			f.CoverURL = l.Media[0].URL
+		}
+		favorites = append(favorites, f)
+	}
+	s.m.mu.Unlock()
+
+	sort.Slice(favorites, func(i, j int) bool { return favorites[i].CreatedAt > favorites[j].CreatedAt })
+
+	for _, f := range favorites {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memFavoriteStore) Count(ctx context.Context, userID int64) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	count := 0
+	for listingID := range s.m.favorites[userID] {
+		if _, ok := s.m.listings[listingID]; ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memFavoriteStore) Stats(ctx context.Context, userID int64, listingIDs []int64) (map[int64]FavoriteStats, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stats := make(map[int64]FavoriteStats, len(listingIDs))
+	for _, listingID := range listingIDs {
+		var st FavoriteStats
+		for user, favorites := range s.m.favorites {
+			if _, ok := favorites[listingID]; ok {
+				st.Count++
+				st.ByUser = st.ByUser || user == userID
+			}
+		}
+		if st.Count > 0 {
+			stats[listingID] = st
+		}
+	}
+	return stats, nil
+}
+
+// Dashboard
+
+type memDashboardStore struct{ m *memoryDB }
+
+func (s *memDashboardStore) GetOverview(ctx context.Context, userID int64) (*DashboardOverview, error) {
+	favorites, err := (&memFavoriteStore{s.m}).ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	chats, err := s.ListChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	overview := &DashboardOverview{
+		FavoritesCount:     len(favorites),
+		RecentListings:     favorites,
+		RecentApplications: []ApplicationSummary{},
+	}
+	if len(overview.RecentListings) > 5 {
+		overview.RecentListings = overview.RecentListings[:5]
+	}
+	for _, chat := range chats {
+		if chat.IsUnread {
+			overview.UnreadMessagesCount++
+		}
+	}
+
+	var applications []*Application
+	for _, a := range s.m.applications {
+		if a.UserID != userID {
+			continue
+		}
+		if a.Status == ApplicationStatusNew || a.Status == ApplicationStatusReview {
+			overview.ActiveApplicationsCount++
+		}
+		applications = append(applications, a)
+	}
+	sort.Slice(applications, func(i, j int) bool { return applications[i].ID > applications[j].ID })
+	for i, a := range applications {
+		if i == 5 {
+			break
+		}
+		summary := ApplicationSummary{ID: a.ID, Status: a.Status, UpdatedAt: a.UpdatedAt}
+		if l, ok := s.m.listings[a.ListingID]; ok {
+			summary.ListingTitle = l.Title
+			if c, ok := s.m.companies[l.CompanyID]; ok {
+				summary.CompanyName = c.Name
+			}
+		}
+		overview.RecentApplications = append(overview.RecentApplications, summary)
+	}
+
+	return overview, nil
+}
+
+func (s *memDashboardStore) ListChats(ctx context.Context, userID int64) ([]ChatSummary, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var chats []ChatSummary
+	for _, a := range s.m.applications {
+		if a.UserID != userID {
+			continue
+		}
+
+		var last *memMessage
+		unread := false
+		for _, msg := range s.m.messages {
+			if msg.ApplicationID != a.ID {
+				continue
+			}
+			own := msg.SenderUserID != nil && *msg.SenderUserID == userID
+			if msg.hidden && !own {
+				continue
+			}
+			last = msg
+			if !own && !msg.read {
+				unread = true
+			}
+		}
+		if last == nil {
+			continue
+		}
+
+		chat := ChatSummary{
+			ApplicationID: a.ID,
+			LastMessage:   last.Body,
+			LastMessageAt: last.CreatedAt,
+			IsUnread:      unread,
+		}
+		if l, ok := s.m.listings[a.ListingID]; ok {
+			chat.ListingTitle = l.Title
+			if c, ok := s.m.companies[l.CompanyID]; ok {
+				chat.CompanyName = c.Name
+			}
+		}
+		chats = append(chats, chat)
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i].LastMessageAt > chats[j].LastMessageAt })
+
+	return chats, nil
+}
+
+// Complaints
+
+type memComplaintStore struct{ m *memoryDB }
+
+func (s *memComplaintStore) withNames(c *Complaint) Complaint {
+	complaint := *c
+	if u, ok := s.m.users[c.UserID]; ok {
+		complaint.AuthorName = u.Username
+	}
+	switch c.TargetType {
+	case "listing":
+		if l, ok := s.m.listings[c.TargetID]; ok {
+			complaint.TargetName = l.Title
+		}
+	case "company":
+		if co, ok := s.m.companies[c.TargetID]; ok {
+			complaint.TargetName = co.Name
+		}
+	}
+	return complaint
+}
+
+// inTenant reports whether the target of c is visible in ctx.
+func (s *memComplaintStore) inTenant(ctx context.Context, c *Complaint) bool {
+	switch c.TargetType {
+	case "listing":
+		if l, ok := s.m.listings[c.TargetID]; ok {
+			return inTenant(ctx, l.TenantID)
+		}
+	case "company":
+		if co, ok := s.m.companies[c.TargetID]; ok {
+			return inTenant(ctx, co.TenantID)
+		}
+	}
+	return tenantScope(ctx) == 0
+}
+
+func (s *memComplaintStore) Create(ctx context.Context, c *Complaint) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c.ID = s.m.nextID("complaints")
+	if c.Status == "" {
+		c.Status = ComplaintStatusNew
+	}
+	c.CreatedAt = memNow()
+	c.UpdatedAt = c.CreatedAt
+	complaint := *c
+	s.m.complaints[c.ID] = &complaint
+	return nil
+}
+
+func (s *memComplaintStore) GetByID(ctx context.Context, id int64) (*Complaint, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.complaints[id]
+	if !ok || !s.inTenant(ctx, c) {
+		return nil, ErrNotFound
+	}
+	complaint := s.withNames(c)
+	return &complaint, nil
+}
+
+func (s *memComplaintStore) List(ctx context.Context, filter ComplaintFilter) ([]Complaint, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var complaints []Complaint
+	for _, c := range s.m.complaints {
+		if (filter.Status != "" && c.Status != filter.Status) || !s.inTenant(ctx, c) {
+			continue
+		}
+		complaints = append(complaints, s.withNames(c))
+	}
+	sort.Slice(complaints, func(i, j int) bool { return complaints[i].ID > complaints[j].ID })
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	start, end := paginate(len(complaints), limit, filter.Offset)
+	return complaints[start:end], nil
+}
+
+func (s *memComplaintStore) UpdateStatus(ctx context.Context, id int64, status string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.complaints[id]
+	if !ok || !s.inTenant(ctx, c) {
+		return ErrNotFound
+	}
+	c.Status = status
+	c.UpdatedAt = memNow()
+	return nil
+}
+
+func (s *memComplaintStore) Resolve(ctx context.Context, id int64, resolution string, resolvedBy int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.complaints[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if c.Status == ComplaintStatusClosed {
+		return ErrComplaintClosed
+	}
+	now := memNow()
+	c.Status = ComplaintStatusClosed
+	c.Resolution = resolution
+	c.ResolvedBy = &resolvedBy
+	c.ResolvedAt = &now
+	c.UpdatedAt = now
+	return nil
+}
+
+func (s *memComplaintStore) Reopen(ctx context.Context, id int64, status string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.complaints[id]
+	if !ok || c.Status != ComplaintStatusClosed {
+		return ErrNotFound
+	}
+	c.Status = status
+	c.Resolution = ""
+	c.ResolvedBy = nil
+	c.ResolvedAt = nil
+	c.UpdatedAt = memNow()
+	return nil
+}
+
+// Admin actions
+
+type memAdminActionStore struct{ m *memoryDB }
+
+func (s *memAdminActionStore) Create(ctx context.Context, action *AdminAction) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	action.ID = s.m.nextID("admin_actions")
+	action.CreatedAt = memNow()
+	s.m.adminActions = append(s.m.adminActions, *action)
+	return nil
+}
+
+func (s *memAdminActionStore) List(ctx context.Context, fq PaginatedQuery) ([]AdminAction, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	actions := make([]AdminAction, 0, len(s.m.adminActions))
+	for i := len(s.m.adminActions) - 1; i >= 0; i-- {
+		action := s.m.adminActions[i]
+		if u, ok := s.m.users[action.AdminID]; ok {
+			action.AdminName = u.Username
+			action.AdminRole = u.Role.Name
+		}
+		actions = append(actions, action)
+	}
+
+	start, end := paginate(len(actions), fq.Limit, fq.Offset)
+	return actions[start:end], nil
+}
+
+// Admin stats
+
+type memAdminStatsStore struct{ m *memoryDB }
+
+func (s *memAdminStatsStore) GetOverview(ctx context.Context) (*DashboardStats, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stats := &DashboardStats{}
+	for _, u := range s.m.users {
+		if inTenant(ctx, u.TenantID) {
+			stats.TotalUsers++
+		}
+	}
+	for _, c := range s.m.companies {
+		if inTenant(ctx, c.TenantID) {
+			stats.TotalCompanies++
+		}
+	}
+	for _, l := range s.m.listings {
+		if !inTenant(ctx, l.TenantID) {
+			continue
+		}
+		stats.TotalListings++
+		if l.Status == ListingStatusModeration {
+			stats.OnModeration++
+		}
+	}
+	return stats, nil
+}
+
+func (s *memAdminStatsStore) GetActivityChart(ctx context.Context, days int) ([]ActivityChartData, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	chart := make([]ActivityChartData, days)
+	index := make(map[string]int, days)
+	today := time.Now().UTC()
+	for i := 0; i < days; i++ {
+		date := today.AddDate(0, 0, i-days+1).Format(time.DateOnly)
+		chart[i].Date = date
+		index[date] = i
+	}
+
+	day := func(createdAt string) (int, bool) {
+		i, ok := index[strings.SplitN(createdAt, "T", 2)[0]]
+		return i, ok
+	}
+	for _, u := range s.m.users {
+		if i, ok := day(u.CreatedAt); ok && inTenant(ctx, u.TenantID) {
+			chart[i].NewUsers++
+		}
+	}
+	for _, c := range s.m.companies {
+		if i, ok := day(c.CreatedAt); ok && inTenant(ctx, c.TenantID) {
+			chart[i].NewCompanies++
+		}
+	}
+	for _, l := range s.m.listings {
+		if i, ok := day(l.CreatedAt); ok && inTenant(ctx, l.TenantID) {
+			chart[i].NewListings++
+		}
+	}
+
+	return chart, nil
+}
+
+// Registration invites
+
+type memInviteStore struct{ m *memoryDB }
+
+func (s *memInviteStore) Create(ctx context.Context, invite *RegistrationInvite) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	invite.ID = s.m.nextID("registration_invites")
+	invite.CreatedAt = time.Now()
+	i := *invite
+	s.m.invites[i.ID] = &i
+	return nil
+}
+
+func (s *memInviteStore) GetByToken(ctx context.Context, token string) (*RegistrationInvite, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, i := range s.m.invites {
+		if i.Token == token {
+			invite := *i
+			return &invite, nil
+		}
+	}
+	return nil, ErrInviteNotFound
+}
+
+func (s *memInviteStore) MarkUsed(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	i, ok := s.m.invites[id]
+	if !ok {
+		return ErrInviteNotFound
+	}
+	if i.UsedAt != nil {
+		return ErrInviteAlreadyUsed
+	}
+	now := time.Now()
+	i.UsedAt = &now
+	return nil
+}
+
+// Email changes
+
+type memEmailChangeStore struct{ m *memoryDB }
+
+func (s *memEmailChangeStore) Create(ctx context.Context, change *EmailChange, oldToken, newToken string, notifications []*OutboxEmail) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.userByEmail(s.m.userTenant(change.UserID), change.NewEmail) != nil {
+		return ErrDuplicateEmail
+	}
+
+	change.CreatedAt = time.Now()
+	s.m.emailChanges[change.UserID] = &memEmailChange{EmailChange: *change, oldToken: oldToken, newToken: newToken}
+	for _, email := range notifications {
+		s.m.enqueue(ctx, email)
+	}
+	return nil
+}
+
+func (s *memEmailChangeStore) GetByUserID(ctx context.Context, userID int64) (*EmailChange, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.emailChanges[userID]
+	if !ok || time.Now().After(c.Expiry) {
+		return nil, ErrNotFound
+	}
+	change := c.EmailChange
+	return &change, nil
+}
+
+func (s *memEmailChangeStore) Confirm(ctx context.Context, hashes []string) (*EmailChange, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for userID, c := range s.m.emailChanges {
+		if time.Now().After(c.Expiry) {
+			continue
+		}
+
+		now := time.Now()
+		switch {
+		case tokens.Match(c.oldToken, hashes) && c.OldConfirmedAt == nil:
+			c.OldConfirmedAt = &now
+		case tokens.Match(c.newToken, hashes) && c.NewConfirmedAt == nil:
+			c.NewConfirmedAt = &now
+		default:
+			continue
+		}
+
+		change := c.EmailChange
+		if c.OldConfirmedAt == nil || c.NewConfirmedAt == nil {
+			return &change, nil
+		}
+
+		if existing := s.m.userByEmail(s.m.userTenant(userID), c.NewEmail); existing != nil && existing.ID != userID {
+			return nil, ErrDuplicateEmail
+		}
+		if u, ok := s.m.users[userID]; ok {
+			u.Email = c.NewEmail
+		}
+		delete(s.m.emailChanges, userID)
+		change.Completed = true
+		return &change, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memEmailChangeStore) Delete(ctx context.Context, userID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.emailChanges[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.emailChanges, userID)
+	return nil
+}
+
+// Usage
+
+type memUsageStore struct{ m *memoryDB }
+
+func (s *memUsageStore) GetAccountUsage(ctx context.Context, userID int64, since time.Time) (*AccountUsage, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	usage := &AccountUsage{EmailsReceived: make(map[string]int)}
+
+	u, ok := s.m.users[userID]
+	if !ok {
+		return usage, nil
+	}
+
+	if u.CompanyID != nil {
+		for _, l := range s.m.listings {
+			if l.CompanyID == *u.CompanyID {
+				usage.MediaFiles += len(l.Media)
+			}
+		}
+	}
+	usage.MediaBytes = s.mediaBytes(userID)
+
+	for _, email := range s.m.outbox {
+		if email.Username == u.Username && email.sentAt != nil && !email.sentAt.Before(since) {
+			usage.EmailsReceived[email.Template]++
+		}
+	}
+
+	return usage, nil
+}
+
+func (s *memUsageStore) MediaBytes(ctx context.Context, userID int64) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.mediaBytes(userID), nil
+}
+
+func (s *memUsageStore) mediaBytes(userID int64) int64 {
+	var total int64
+	for _, l := range s.m.listings {
+		for _, media := range l.Media {
+			if media.UploadedBy == userID {
+				total += media.SizeBytes
+			}
+		}
+	}
+	return total
+}
+
+// Magic links
+
+type memMagicLinkStore struct{ m *memoryDB }
+
+func (s *memMagicLinkStore) Create(ctx context.Context, userID int64, token string, expiry time.Time, email *OutboxEmail) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for t, link := range s.m.magicLinks {
+		if link.userID == userID {
+			delete(s.m.magicLinks, t)
+		}
+	}
+	s.m.magicLinks[token] = memToken{userID: userID, expiry: expiry}
+	s.m.enqueue(ctx, email)
+	return nil
+}
+
+func (s *memMagicLinkStore) Consume(ctx context.Context, hashes []string) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for hash, link := range s.m.magicLinks {
+		if !tokens.Match(hash, hashes) {
+			continue
+		}
+		delete(s.m.magicLinks, hash)
+		if time.Now().After(link.expiry) {
+			return 0, ErrNotFound
+		}
+		return link.userID, nil
+	}
+	return 0, ErrNotFound
+}
+
+// Outbox
+
+type memOutboxStore struct{ m *memoryDB }
+
+func (s *memOutboxStore) Enqueue(ctx context.Context, email *OutboxEmail) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.enqueue(ctx, email)
+	return nil
+}
+
+func (s *memOutboxStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]OutboxEmail, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var claimed []OutboxEmail
+	for _, email := range s.m.outbox {
+		if len(claimed) == limit {
+			break
+		}
+		if email.sentAt != nil || email.nextAttemptAt == nil || email.nextAttemptAt.After(now) {
+			continue
+		}
+		next := now.Add(lease)
+		email.nextAttemptAt = &next
+		claimed = append(claimed, email.OutboxEmail)
+	}
+	return claimed, nil
+}
+
+func (s *memOutboxStore) MarkSent(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	email, ok := s.m.outboxByID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	email.sentAt = &now
+	email.Attempts++
+	email.LastError = ""
+	return nil
+}
+
+func (s *memOutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	email, ok := s.m.outboxByID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	email.Attempts++
+	email.LastError = lastError
+	email.nextAttemptAt = retryAt
+	return nil
+}
+
+func (s *memOutboxStore) CountAbandoned(ctx context.Context, minAttempts int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	count := 0
+	for _, email := range s.m.outbox {
+		if email.sentAt == nil && email.nextAttemptAt == nil && email.Attempts >= minAttempts {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memOutboxStore) SetLintWarnings(ctx context.Context, id int64, warnings []string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	email, ok := s.m.outboxByID[id]
+	if !ok {
+		return ErrNotFound
+	}
+	email.LintWarnings = append([]string(nil), warnings...)
+	return nil
+}
+
+func (s *memOutboxStore) Stats(ctx context.Context, since time.Time) (*OutboxStats, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stats := &OutboxStats{DeadLetters: len(s.m.deadLetters), Templates: []OutboxTemplateStats{}}
+	byTemplate := make(map[string]*OutboxTemplateStats)
+	from := since.UTC().Format(time.RFC3339)
+	count := func(template, queuedAt string, attempts int, sent, dead bool) {
+		if queuedAt < from {
+			return
+		}
+		t, ok := byTemplate[template]
+		if !ok {
+			t = &OutboxTemplateStats{Template: template}
+			byTemplate[template] = t
+		}
+		t.Emails++
+		t.Attempts += attempts
+		t.FailedAttempts += attempts
+		if sent {
+			t.Sent++
+			t.FailedAttempts--
+		}
+		if dead {
+			t.DeadLetters++
+		}
+	}
+
+	now := time.Now()
+	for _, email := range s.m.outbox {
+		if email.sentAt == nil && email.nextAttemptAt != nil {
+			stats.Pending++
+			if email.Attempts > 0 {
+				stats.Retrying++
+			}
+			if created, err := time.Parse(time.RFC3339, email.CreatedAt); err == nil {
+				stats.OldestPendingSeconds = max(stats.OldestPendingSeconds, now.Sub(created).Seconds())
+			}
+		}
+		count(email.Template, email.CreatedAt, email.Attempts, email.sentAt != nil, false)
+	}
+	for _, d := range s.m.deadLetters {
+		count(d.Template, d.QueuedAt, d.Attempts, false, true)
+	}
+
+	for _, t := range byTemplate {
+		stats.Templates = append(stats.Templates, *t)
+	}
+	sort.Slice(stats.Templates, func(i, j int) bool { return stats.Templates[i].Template < stats.Templates[j].Template })
+	return stats, nil
+}
+
+func (s *memOutboxStore) DeadLetter(ctx context.Context, id int64, lastError, subject, body string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	email, ok := s.m.outboxByID[id]
+	if !ok || email.sentAt != nil {
+		return ErrNotFound
+	}
+	s.m.deadLetters = append(s.m.deadLetters, &DeadLetter{
+		ID:          s.m.nextID("dead_letters"),
+		OutboxID:    email.ID,
+		Template:    email.Template,
+		Username:    email.Username,
+		Email:       email.Email,
+		Data:        email.Data,
+		Subject:     subject,
+		Body:        body,
+		Attempts:    email.Attempts + 1,
+		LastError:   lastError,
+		TriggeredBy: email.TriggeredBy,
+		QueuedAt:    email.CreatedAt,
+		FailedAt:    memNow(),
+	})
+
+	delete(s.m.outboxByID, id)
+	s.m.outbox = slices.DeleteFunc(s.m.outbox, func(e *memOutboxEmail) bool { return e.ID == id })
+	return nil
+}
+
+type memDeadLetterStore struct{ m *memoryDB }
+
+func (s *memDeadLetterStore) List(ctx context.Context, fq PaginatedQuery) ([]DeadLetter, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	letters := []DeadLetter{}
+	for i := len(s.m.deadLetters) - 1; i >= 0; i-- {
+		d := *s.m.deadLetters[i]
+		d.Email, d.Data, d.Subject, d.Body = "", nil, "", ""
+		letters = append(letters, d)
+	}
+	start, end := paginate(len(letters), fq.Limit, fq.Offset)
+	return letters[start:end], nil
+}
+
+func (s *memDeadLetterStore) GetByID(ctx context.Context, id int64) (*DeadLetter, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, d := range s.m.deadLetters {
+		if d.ID == id {
+			letter := *d
+			return &letter, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memDeadLetterStore) Retry(ctx context.Context, id int64) (*OutboxEmail, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i, d := range s.m.deadLetters {
+		if d.ID == id {
+			email := &OutboxEmail{Template: d.Template, Username: d.Username, Email: d.Email, Data: d.Data}
+			s.m.enqueue(ctx, email)
+			s.m.deadLetters = slices.Delete(s.m.deadLetters, i, i+1)
+			return email, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memDeadLetterStore) Discard(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for i, d := range s.m.deadLetters {
+		if d.ID == id {
+			s.m.deadLetters = slices.Delete(s.m.deadLetters, i, i+1)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memDeadLetterStore) Count(ctx context.Context) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return len(s.m.deadLetters), nil
+}
+
+type memSentEmailStore struct{ m *memoryDB }
+
+func (s *memSentEmailStore) Create(ctx context.Context, sent *SentEmail) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sent.ID = s.m.nextID("sent_emails")
+	sent.SentAt = memNow()
+	stored := *sent
+	stored.Accepted = append([]string(nil), sent.Accepted...)
+	s.m.sentEmails = append(s.m.sentEmails, stored)
+	return nil
+}
+
+func (s *memSentEmailStore) ListByEmail(ctx context.Context, email string, fq PaginatedQuery) ([]SentEmail, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sent := []SentEmail{}
+	for i := len(s.m.sentEmails) - 1; i >= 0; i-- {
+		if strings.EqualFold(s.m.sentEmails[i].Email, strings.TrimSpace(email)) {
+			sent = append(sent, s.m.sentEmails[i])
+		}
+	}
+
+	limit := fq.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	start, end := paginate(len(sent), limit, fq.Offset)
+	return sent[start:end], nil
+}
+
+type memTrackingEvent struct {
+	TrackingEvent
+	at time.Time
+}
+
+type memEmailTrackingStore struct{ m *memoryDB }
+
+func (s *memEmailTrackingStore) Record(ctx context.Context, event *TrackingEvent) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	event.ID = s.m.nextID("email_tracking_events")
+	event.CreatedAt = memNow()
+	s.m.trackingEvents = append(s.m.trackingEvents, memTrackingEvent{TrackingEvent: *event, at: time.Now()})
+	return nil
+}
+
+func (s *memEmailTrackingStore) Stats(ctx context.Context, since time.Time) ([]TrackingStats, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	type emailKind struct {
+		outboxID int64
+		kind     string
+	}
+	byTemplate := make(map[string]*TrackingStats)
+	seen := make(map[emailKind]bool)
+	for _, event := range s.m.trackingEvents {
+		if event.at.Before(since) {
+			continue
+		}
+		st, ok := byTemplate[event.Template]
+		if !ok {
+			st = &TrackingStats{Template: event.Template}
+			byTemplate[event.Template] = st
+		}
+
+		first := !seen[emailKind{event.OutboxID, event.Kind}]
+		seen[emailKind{event.OutboxID, event.Kind}] = true
+		switch event.Kind {
+		case TrackingEventSent:
+			if first {
+				st.Sent++
+			}
+		case TrackingEventOpen:
+			st.Opens++
+			if first {
+				st.Opened++
+			}
+		case TrackingEventClick:
+			st.Clicks++
+			if first {
+				st.Clicked++
+			}
+		}
+	}
+
+	stats := []TrackingStats{}
+	for _, st := range byTemplate {
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Template < stats[j].Template })
+	return stats, nil
+}
+
+func (s *memEmailTrackingStore) SetOptOut(ctx context.Context, userID int64, optOut bool) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if optOut {
+		s.m.trackingOptOuts[userID] = true
+	} else {
+		delete(s.m.trackingOptOuts, userID)
+	}
+	return nil
+}
+
+func (s *memEmailTrackingStore) OptedOut(ctx context.Context, email string) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	hash := crypto.HashEmail(email)
+	for _, u := range s.m.users {
+		if crypto.HashEmail(u.Email) == hash && s.m.trackingOptOuts[u.ID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memBroadcast struct {
+	Broadcast
+	lockedUntil time.Time
+}
+
+type memBroadcastStore struct{ m *memoryDB }
+
+// inSegment must be called with mu held.
+func (m *memoryDB) inSegment(u *memUser, b *Broadcast) bool {
+	segment := b.Segment
+	if u.State != UserStateActive || u.TenantID != b.TenantID {
+		return false
+	}
+	if len(segment.Countries) > 0 && !slices.Contains(segment.Countries, u.Country) {
+		return false
+	}
+	created, _ := time.Parse(time.RFC3339, u.CreatedAt)
+	if segment.SignedUpAfter != nil && created.Before(*segment.SignedUpAfter) {
+		return false
+	}
+	return segment.SignedUpBefore == nil || created.Before(*segment.SignedUpBefore)
+}
+
+func (s *memBroadcastStore) Create(ctx context.Context, b *Broadcast) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	b.TenantID = tenantOf(ctx)
+	b.Total = 0
+	for _, u := range s.m.users {
+		if s.m.inSegment(u, b) {
+			b.Total++
+		}
+	}
+	b.ID = s.m.nextID("broadcasts")
+	b.Status = BroadcastRunning
+	b.Sent, b.Failed, b.Skipped, b.LastUserID = 0, 0, 0, 0
+	b.CreatedAt = memNow()
+	b.UpdatedAt = b.CreatedAt
+	b.CompletedAt = nil
+	s.m.broadcasts[b.ID] = &memBroadcast{Broadcast: *b}
+	return nil
+}
+
+func (s *memBroadcastStore) GetByID(ctx context.Context, id int64) (*Broadcast, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	b, ok := s.m.broadcasts[id]
+	if !ok || !inTenant(ctx, b.TenantID) {
+		return nil, ErrNotFound
+	}
+	found := b.Broadcast
+	return &found, nil
+}
+
+func (s *memBroadcastStore) List(ctx context.Context, fq PaginatedQuery) ([]Broadcast, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	broadcasts := []Broadcast{}
+	for _, b := range s.m.broadcasts {
+		if inTenant(ctx, b.TenantID) {
+			broadcasts = append(broadcasts, b.Broadcast)
+		}
+	}
+	sort.Slice(broadcasts, func(i, j int) bool { return broadcasts[i].ID > broadcasts[j].ID })
+
+	limit := fq.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	start, end := paginate(len(broadcasts), limit, fq.Offset)
+	return broadcasts[start:end], nil
+}
+
+func (s *memBroadcastStore) Claim(ctx context.Context, lease time.Duration) (*Broadcast, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var claimed *memBroadcast
+	now := time.Now()
+	for _, b := range s.m.broadcasts {
+		if b.Status != BroadcastRunning || b.lockedUntil.After(now) {
+			continue
+		}
+		if claimed == nil || b.ID < claimed.ID {
+			claimed = b
+		}
+	}
+	if claimed == nil {
+		return nil, ErrNotFound
+	}
+	claimed.lockedUntil = now.Add(lease)
+	found := claimed.Broadcast
+	return &found, nil
+}
+
+func (s *memBroadcastStore) Recipients(ctx context.Context, b *Broadcast, limit int) ([]BroadcastRecipient, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var recipients []BroadcastRecipient
+	for _, u := range s.m.users {
+		if u.ID > b.LastUserID && s.m.inSegment(u, b) {
+			recipients = append(recipients, BroadcastRecipient{UserID: u.ID, Username: u.Username, Email: u.Email})
+		}
+	}
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i].UserID < recipients[j].UserID })
+	if len(recipients) > limit {
+		recipients = recipients[:limit]
+	}
+	return recipients, nil
+}
+
+func (s *memBroadcastStore) Advance(ctx context.Context, id, lastUserID int64, sent, failed, skipped int, done bool) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	b, ok := s.m.broadcasts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	b.LastUserID = lastUserID
+	b.Sent += sent
+	b.Failed += failed
+	b.Skipped += skipped
+	b.lockedUntil = time.Time{}
+	b.UpdatedAt = memNow()
+	if done {
+		b.Status = BroadcastCompleted
+		b.CompletedAt = &b.UpdatedAt
+	}
+	return nil
+}
+
+func (s *memBroadcastStore) SetStatus(ctx context.Context, id int64, from, to string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	b, ok := s.m.broadcasts[id]
+	if !ok || !inTenant(ctx, b.TenantID) {
+		return ErrNotFound
+	}
+	if b.Status != from {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, b.Status, to)
+	}
+	b.Status = to
+	b.UpdatedAt = memNow()
+	return nil
+}
+
+type memSuppressionStore struct{ m *memoryDB }
+
+func (s *memSuppressionStore) Add(ctx context.Context, suppression *EmailSuppression) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	key := strings.ToLower(suppression.Email)
+	if _, ok := s.m.suppressions[key]; ok {
+		return nil
+	}
+	suppression.CreatedAt = memNow()
+	stored := *suppression
+	s.m.suppressions[key] = &stored
+	return nil
+}
+
+func (s *memSuppressionStore) IsSuppressed(ctx context.Context, email string, transactional bool) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	suppression, ok := s.m.suppressions[strings.ToLower(email)]
+	if !ok {
+		return false, nil
+	}
+	return !transactional || suppression.Reason != SuppressionUnsubscribe, nil
+}
+
+func (s *memSuppressionStore) List(ctx context.Context, fq PaginatedQuery) ([]EmailSuppression, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	suppressions := []EmailSuppression{}
+	for _, e := range s.m.suppressions {
+		if fq.Search != "" && e.Reason != fq.Search {
+			continue
+		}
+		suppressions = append(suppressions, *e)
+	}
+	sort.Slice(suppressions, func(i, j int) bool {
+		if suppressions[i].CreatedAt != suppressions[j].CreatedAt {
+			return suppressions[i].CreatedAt > suppressions[j].CreatedAt
+		}
+		return suppressions[i].Email < suppressions[j].Email
+	})
+
+	limit := fq.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	start, end := paginate(len(suppressions), limit, fq.Offset)
+	return suppressions[start:end], nil
+}
+
+func (s *memSuppressionStore) Delete(ctx context.Context, email string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	key := strings.ToLower(email)
+	if _, ok := s.m.suppressions[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.suppressions, key)
+	return nil
+}
+
+// Delivery windows
+
+type memDeliveryWindowStore struct{ m *memoryDB }
+
+func (s *memDeliveryWindowStore) Get(ctx context.Context, userID int64) (*DeliveryWindow, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	window, ok := s.m.deliveryWindows[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &window, nil
+}
+
+func (s *memDeliveryWindowStore) Set(ctx context.Context, userID int64, window *DeliveryWindow) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	window.UpdatedAt = memNow()
+	s.m.deliveryWindows[userID] = *window
+	return nil
+}
+
+func (s *memDeliveryWindowStore) Delete(ctx context.Context, userID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.deliveryWindows[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.deliveryWindows, userID)
+	return nil
+}
+
+// Tags
+
+type memTagStore struct{ m *memoryDB }
+
+func (s *memTagStore) Set(ctx context.Context, listingID int64, tags []string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.listings[listingID]; !ok {
+		return ErrForeignKeyListing
+	}
+	old := s.m.listingTags[listingID]
+	updated := make(map[string]time.Time, len(tags))
+	for _, tag := range tags {
+		if at, ok := old[tag]; ok {
+			updated[tag] = at
+		} else {
+			updated[tag] = time.Now()
+		}
+	}
+	s.m.listingTags[listingID] = updated
+	return nil
+}
+
+func (s *memTagStore) Trending(ctx context.Context, since time.Time, region string, limit int) ([]TagCount, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	counts := make(map[string]int)
+	for listingID, tags := range s.m.listingTags {
+		l, ok := s.m.listings[listingID]
+		if !ok || l.Status != ListingStatusActive || region != "" && s.m.companyCountry(l.CompanyID) != region {
+			continue
+		}
+		for tag, at := range tags {
+			if !at.Before(since) {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := []TagCount{}
+	for tag, n := range counts {
+		tags = append(tags, TagCount{Tag: tag, Listings: n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Listings != tags[j].Listings {
+			return tags[i].Listings > tags[j].Listings
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+// Mentions
+
+type memMention struct {
+	messageID int64
+	userID    int64
+	createdAt string
+}
+
+type memMentionStore struct{ m *memoryDB }
+
+func (s *memMentionStore) Create(ctx context.Context, messageID int64, userIDs []int64) ([]int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var msg *memMessage
+	for _, m := range s.m.messages {
+		if m.ID == messageID {
+			msg = m
+		}
+	}
+	if msg == nil || msg.hidden {
+		return nil, nil
+	}
+
+	var recorded []int64
+	for _, userID := range userIDs {
+		if _, ok := s.m.users[userID]; !ok {
+			return nil, ErrForeignKeyUser
+		}
+		exists := false
+		for _, mention := range s.m.mentions {
+			exists = exists || mention.messageID == messageID && mention.userID == userID
+		}
+		if !exists {
+			s.m.mentions = append(s.m.mentions, memMention{messageID: messageID, userID: userID, createdAt: memNow()})
+			recorded = append(recorded, userID)
+		}
+	}
+	return recorded, nil
+}
+
+func (s *memMentionStore) ListByUser(ctx context.Context, userID int64, fq PaginatedQuery) ([]Mention, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	mentions := []Mention{}
+	for i := len(s.m.mentions) - 1; i >= 0; i-- {
+		mention := s.m.mentions[i]
+		if mention.userID != userID {
+			continue
+		}
+		for _, msg := range s.m.messages {
+			if msg.ID != mention.messageID {
+				continue
+			}
+			m := Mention{MessageID: msg.ID, ApplicationID: msg.ApplicationID, Body: msg.Body, CreatedAt: mention.createdAt}
+			if msg.SenderUserID != nil {
+				if sender, ok := s.m.users[*msg.SenderUserID]; ok {
+					m.SenderUsername = sender.Username
+				}
+			}
+			mentions = append(mentions, m)
+		}
+	}
+
+	start, end := paginate(len(mentions), fq.Limit, fq.Offset)
+	return mentions[start:end], nil
+}
+
+// Conversations
+
+type memConversation struct {
+	id            int64
+	userA, userB  int64
+	lastRead      map[int64]int64
+	lastMessageAt *string
+	createdAt     string
+}
+
+type memDirectMessage struct {
+	DirectMessage
+	hidden bool
+}
+
+type memConversationStore struct{ m *memoryDB }
+
+func (s *memConversationStore) Open(ctx context.Context, userID, otherID int64) (*Conversation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.blockedBetween(userID, otherID) {
+		return nil, ErrNotFound
+	}
+
+	userA, userB := conversationPair(userID, otherID)
+	for _, c := range s.m.conversations {
+		if c.userA == userA && c.userB == userB {
+			return s.view(c, userID), nil
+		}
+	}
+	if _, ok := s.m.users[otherID]; !ok {
+		return nil, ErrForeignKeyUser
+	}
+
+	c := &memConversation{
+		id:        s.m.nextID("conversations"),
+		userA:     userA,
+		userB:     userB,
+		lastRead:  make(map[int64]int64),
+		createdAt: memNow(),
+	}
+	s.m.conversations[c.id] = c
+	return s.view(c, userID), nil
+}
+
+// visible reports whether userID takes part in c and neither side has
+// blocked the other. The caller holds the lock.
+func (s *memConversationStore) visible(c *memConversation, userID int64) bool {
+	switch userID {
+	case c.userA:
+		return !s.m.blockedBetween(userID, c.userB)
+	case c.userB:
+		return !s.m.blockedBetween(userID, c.userA)
+	}
+	return false
+}
+
+// view returns c as seen by userID. The caller holds the lock.
+func (s *memConversationStore) view(c *memConversation, userID int64) *Conversation {
+	other := c.userA
+	if other == userID {
+		other = c.userB
+	}
+	conversation := &Conversation{ID: c.id, UserID: other, LastMessageAt: c.lastMessageAt, CreatedAt: c.createdAt}
+	if u, ok := s.m.users[other]; ok {
+		conversation.Username = u.Username
+	}
+	for _, msg := range s.m.directMessages {
+		if msg.ConversationID == c.id && msg.SenderID != userID && !msg.hidden && msg.ID > c.lastRead[userID] {
+			conversation.Unread++
+		}
+	}
+	return conversation
+}
+
+func (s *memConversationStore) Get(ctx context.Context, id, userID int64) (*Conversation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.conversations[id]
+	if !ok || !s.visible(c, userID) {
+		return nil, ErrNotFound
+	}
+	return s.view(c, userID), nil
+}
+
+func (s *memConversationStore) List(ctx context.Context, userID int64, fq PaginatedQuery) ([]Conversation, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	conversations := []Conversation{}
+	for _, c := range s.m.conversations {
+		if s.visible(c, userID) {
+			conversations = append(conversations, *s.view(c, userID))
+		}
+	}
+	activity := func(c Conversation) string {
+		if c.LastMessageAt != nil {
+			return *c.LastMessageAt
+		}
+		return c.CreatedAt
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		if a, b := activity(conversations[i]), activity(conversations[j]); a != b {
+			return a > b
+		}
+		return conversations[i].ID > conversations[j].ID
+	})
+
+	start, end := paginate(len(conversations), fq.Limit, fq.Offset)
+	return conversations[start:end], nil
+}
+
+func (s *memConversationStore) CreateMessage(ctx context.Context, msg *DirectMessage) error {
+	if err := Limits.Apply(LimitMessage, &msg.Body); err != nil {
+		return err
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.conversations[msg.ConversationID]
+	if !ok {
+		return ErrNotFound
+	}
+	msg.ID = s.m.nextID("direct_messages")
+	msg.CreatedAt = memNow()
+
+	if u, ok := s.m.users[msg.SenderID]; ok {
+		msg.Hidden = u.muted
+	}
+	row := &memDirectMessage{DirectMessage: *msg, hidden: msg.Hidden}
+	s.m.directMessages = append(s.m.directMessages, row)
+
+	if !row.hidden {
+		at := msg.CreatedAt
+		c.lastMessageAt = &at
+	}
+	c.lastRead[msg.SenderID] = msg.ID
+	return nil
+}
+
+func (s *memConversationStore) ListMessages(ctx context.Context, conversationID, viewerID, before int64, limit int) ([]DirectMessage, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	messages := []DirectMessage{}
+	for i := len(s.m.directMessages) - 1; i >= 0 && len(messages) < limit; i-- {
+		msg := s.m.directMessages[i]
+		if msg.ConversationID != conversationID || msg.hidden && msg.SenderID != viewerID || before > 0 && msg.ID >= before {
+			continue
+		}
+		messages = append(messages, msg.DirectMessage)
+	}
+	return messages, nil
+}
+
+func (s *memConversationStore) MarkRead(ctx context.Context, conversationID, userID, messageID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if c, ok := s.m.conversations[conversationID]; ok && messageID > c.lastRead[userID] {
+		c.lastRead[userID] = messageID
+	}
+	return nil
+}
+
+func (s *memConversationStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	count := 0
+	for _, c := range s.m.conversations {
+		if s.visible(c, userID) {
+			count += s.view(c, userID).Unread
+		}
+	}
+	return count, nil
+}
+
+func (s *memConversationStore) Exists(ctx context.Context, userID, otherID int64) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	userA, userB := conversationPair(userID, otherID)
+	for _, c := range s.m.conversations {
+		if c.userA == userA && c.userB == userB {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Blocks
+
+type memBlock struct{ blocker, blocked int64 }
+
+// blockedBetween reports whether either user has blocked the other. The
+// caller holds the lock.
+func (m *memoryDB) blockedBetween(userID, otherID int64) bool {
+	_, a := m.blocks[memBlock{userID, otherID}]
+	_, b := m.blocks[memBlock{otherID, userID}]
+	return a || b
+}
+
+type memBlockStore struct{ m *memoryDB }
+
+func (s *memBlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if blockerID == blockedID {
+		return ErrCheckViolation
+	}
+	if _, ok := s.m.users[blockedID]; !ok {
+		return ErrNotFound
+	}
+	key := memBlock{blockerID, blockedID}
+	if _, ok := s.m.blocks[key]; !ok {
+		s.m.blocks[key] = memNow()
+	}
+	return nil
+}
+
+func (s *memBlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.blocks, memBlock{blockerID, blockedID})
+	return nil
+}
+
+func (s *memBlockStore) Blocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	_, ok := s.m.blocks[memBlock{blockerID, blockedID}]
+	return ok, nil
+}
+
+func (s *memBlockStore) Between(ctx context.Context, userID, otherID int64) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.blockedBetween(userID, otherID), nil
+}
+
+func (s *memBlockStore) List(ctx context.Context, blockerID int64, fq PaginatedQuery) ([]BlockedUser, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	blocked := []BlockedUser{}
+	for key, createdAt := range s.m.blocks {
+		if key.blocker != blockerID {
+			continue
+		}
+		b := BlockedUser{UserID: key.blocked, CreatedAt: createdAt}
+		if u, ok := s.m.users[key.blocked]; ok {
+			b.Username = u.Username
+		}
+		blocked = append(blocked, b)
+	}
+	sort.Slice(blocked, func(i, j int) bool {
+		if blocked[i].CreatedAt != blocked[j].CreatedAt {
+			return blocked[i].CreatedAt > blocked[j].CreatedAt
+		}
+		return blocked[i].UserID > blocked[j].UserID
+	})
+
+	start, end := paginate(len(blocked), fq.Limit, fq.Offset)
+	return blocked[start:end], nil
+}
+
+type memRedemption struct{ codeID, userID int64 }
+
+type memInviteCodeStore struct{ m *memoryDB }
+
+// inviteUsable reports whether c can take another registration.
+func inviteUsable(c *InviteCode, now time.Time) bool {
+	return c.Uses < c.MaxUses && (c.ExpiresAt == nil || c.ExpiresAt.After(now))
+}
+
+func (s *memInviteCodeStore) insert(code *InviteCode) error {
+	if _, ok := s.m.inviteCodes[code.Code]; ok {
+		return ErrConflict
+	}
+	code.ID = s.m.nextID("invite_codes")
+	code.CreatedAt = time.Now()
+	stored := *code
+	s.m.inviteCodes[code.Code] = &stored
+	return nil
+}
+
+func (s *memInviteCodeStore) Create(ctx context.Context, code *InviteCode) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	code.Admin = true
+	return s.insert(code)
+}
+
+func (s *memInviteCodeStore) CreateForUser(ctx context.Context, userID int64, code *InviteCode, quota int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	made := 0
+	for _, c := range s.m.inviteCodes {
+		if !c.Admin && c.CreatedBy != nil && *c.CreatedBy == userID {
+			made++
+		}
+	}
+	if made >= quota {
+		return ErrInviteQuota
+	}
+
+	code.CreatedBy, code.Admin, code.MaxUses = &userID, false, 1
+	return s.insert(code)
+}
+
+func (s *memInviteCodeStore) Reserve(ctx context.Context, code string) (*InviteCode, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.inviteCodes[code]
+	if !ok || !inviteUsable(c, time.Now()) {
+		return nil, ErrNotFound
+	}
+	c.Uses++
+	reserved := *c
+	return &reserved, nil
+}
+
+func (s *memInviteCodeStore) Release(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, c := range s.m.inviteCodes {
+		if c.ID == id && c.Uses > 0 {
+			c.Uses--
+		}
+	}
+	return nil
+}
+
+func (s *memInviteCodeStore) Redeem(ctx context.Context, id, userID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, r := range s.m.redemptions {
+		if r == (memRedemption{id, userID}) {
+			return nil
+		}
+	}
+	s.m.redemptions = append(s.m.redemptions, memRedemption{id, userID})
+	return nil
+}
+
+func (s *memInviteCodeStore) Revoke(ctx context.Context, code string) (*InviteCode, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	c, ok := s.m.inviteCodes[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if now := time.Now(); c.ExpiresAt == nil || c.ExpiresAt.After(now) {
+		c.ExpiresAt = &now
+	}
+	revoked := *c
+	return &revoked, nil
+}
+
+func (s *memInviteCodeStore) list(keep func(*InviteCode) bool) []InviteCode {
+	codes := []InviteCode{}
+	for _, c := range s.m.inviteCodes {
+		if keep(c) {
+			codes = append(codes, *c)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].ID > codes[j].ID })
+	return codes
+}
+
+func (s *memInviteCodeStore) List(ctx context.Context, fq PaginatedQuery) ([]InviteCode, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	codes := s.list(func(*InviteCode) bool { return true })
+	start, end := paginate(len(codes), fq.Limit, fq.Offset)
+	return codes[start:end], nil
+}
+
+func (s *memInviteCodeStore) ListByCreator(ctx context.Context, userID int64) ([]InviteCode, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.list(func(c *InviteCode) bool {
+		return !c.Admin && c.CreatedBy != nil && *c.CreatedBy == userID
+	}), nil
+}
+
+// Teams
+
+type memTeamStore struct{ m *memoryDB }
+
+func (s *memTeamStore) Invite(ctx context.Context, invite *RegistrationInvite, email *OutboxEmail) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	invite.ID = s.m.nextID("registration_invites")
+	invite.CreatedAt = time.Now()
+	i := *invite
+	s.m.invites[i.ID] = &i
+	s.m.enqueue(ctx, email)
+	return nil
+}
+
+func (s *memTeamStore) Join(ctx context.Context, invite *RegistrationInvite, userID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.invites[invite.ID]
+	if !ok || stored.CompanyID == nil {
+		return ErrInviteNotFound
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return ErrInviteAlreadyUsed
+	}
+	u, ok := s.m.users[userID]
+	if !ok || u.CompanyID != nil || u.Role.Name != RoleUser {
+		return ErrNotJoinable
+	}
+	role, ok := s.m.roles[stored.CompanyType]
+	if !ok {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	stored.UsedAt = &now
+	companyID := *stored.CompanyID
+	u.CompanyID = &companyID
+	u.Role, u.RoleID = role, role.ID
+	u.teamRole = stored.TeamRole
+	return nil
+}
+
+func (s *memTeamStore) member(companyID, userID int64) (*memUser, bool) {
+	u, ok := s.m.users[userID]
+	if !ok || u.CompanyID == nil || *u.CompanyID != companyID || u.teamRole == "" {
+		return nil, false
+	}
+	return u, true
+}
+
+func (s *memTeamStore) Members(ctx context.Context, companyID int64) ([]TeamMember, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	rank := map[string]int{TeamRoleOwner: 0, TeamRoleManager: 1, TeamRoleAgent: 2}
+	members := []TeamMember{}
+	for id := range s.m.users {
+		u, ok := s.member(companyID, id)
+		if !ok || (u.State != UserStatePending && u.State != UserStateActive) {
+			continue
+		}
+		members = append(members, TeamMember{
+			UserID:    u.ID,
+			Username:  u.Username,
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Email:     u.Email,
+			JobTitle:  u.JobTitle,
+			Role:      u.teamRole,
+		})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if rank[members[i].Role] != rank[members[j].Role] {
+			return rank[members[i].Role] < rank[members[j].Role]
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+func (s *memTeamStore) Role(ctx context.Context, companyID, userID int64) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.member(companyID, userID)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return u.teamRole, nil
+}
+
+func (s *memTeamStore) SetRole(ctx context.Context, companyID, userID int64, role string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.member(companyID, userID)
+	if !ok {
+		return ErrNotFound
+	}
+	switch role {
+	case TeamRoleOwner, TeamRoleManager, TeamRoleAgent:
+	default:
+		return ErrCheckViolation
+	}
+	u.teamRole = role
+	return nil
+}
+
+func (s *memTeamStore) Remove(ctx context.Context, companyID, userID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.member(companyID, userID)
+	if !ok {
+		return ErrNotFound
+	}
+	role := s.m.roles[RoleUser]
+	u.CompanyID = nil
+	u.Role, u.RoleID = role, role.ID
+	u.teamRole = ""
+	return nil
+}
+
+// Webhooks
+
+type memWebhookStore struct{ m *memoryDB }
+
+func (s *memWebhookStore) Create(ctx context.Context, hook *Webhook) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	hook.ID = s.m.nextID("webhooks")
+	hook.CreatedAt = memNow()
+	h := *hook
+	h.Events = append([]string{}, hook.Events...)
+	s.m.webhooks[h.ID] = &h
+	return nil
+}
+
+func (s *memWebhookStore) GetByID(ctx context.Context, id int64) (*Webhook, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	h, ok := s.m.webhooks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	hook := *h
+	hook.Secret = ""
+	return &hook, nil
+}
+
+func (s *memWebhookStore) List(ctx context.Context, companyID *int64) ([]Webhook, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	hooks := []Webhook{}
+	for _, h := range s.m.webhooks {
+		if (h.CompanyID == nil) != (companyID == nil) || (companyID != nil && *h.CompanyID != *companyID) {
+			continue
+		}
+		hook := *h
+		hook.Secret = ""
+		hooks = append(hooks, hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+	return hooks, nil
+}
+
+func (s *memWebhookStore) Delete(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.webhooks, id)
+	kept := s.m.deliveries[:0]
+	for _, d := range s.m.deliveries {
+		if d.WebhookID != id {
+			kept = append(kept, d)
+		}
+	}
+	s.m.deliveries = kept
+	return nil
+}
+
+func (s *memWebhookStore) Enqueue(ctx context.Context, event string, companyID *int64, payload json.RawMessage) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	ids := make([]int64, 0, len(s.m.webhooks))
+	for id := range s.m.webhooks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		h := s.m.webhooks[id]
+		if h.CompanyID != nil && (companyID == nil || *h.CompanyID != *companyID) {
+			continue
+		}
+		subscribed := false
+		for _, e := range h.Events {
+			subscribed = subscribed || e == event
+		}
+		if !subscribed {
+			continue
+		}
+		now := time.Now()
+		s.m.deliveries = append(s.m.deliveries, &WebhookDelivery{
+			ID:            s.m.nextID("webhook_deliveries"),
+			WebhookID:     h.ID,
+			Event:         event,
+			Payload:       append(json.RawMessage{}, payload...),
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+		})
+	}
+	return nil
+}
+
+func (s *memWebhookStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var claimed []WebhookDelivery
+	for _, d := range s.m.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if d.DeliveredAt != nil || d.NextAttemptAt == nil || d.NextAttemptAt.After(now) {
+			continue
+		}
+		next := now.Add(lease)
+		d.NextAttemptAt = &next
+		delivery := *d
+		delivery.URL, delivery.Secret = s.m.webhooks[d.WebhookID].URL, s.m.webhooks[d.WebhookID].Secret
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (s *memWebhookStore) delivery(id int64) (*WebhookDelivery, error) {
+	for _, d := range s.m.deliveries {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memWebhookStore) MarkDelivered(ctx context.Context, id int64, status int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d, err := s.delivery(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	d.DeliveredAt, d.NextAttemptAt = &now, nil
+	d.Attempts++
+	d.ResponseStatus, d.LastError = &status, ""
+	return nil
+}
+
+func (s *memWebhookStore) MarkFailed(ctx context.Context, id int64, status int, lastError string, retryAt *time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d, err := s.delivery(id)
+	if err != nil {
+		return err
+	}
+	d.Attempts++
+	d.ResponseStatus = nil
+	if status != 0 {
+		d.ResponseStatus = &status
+	}
+	d.LastError, d.NextAttemptAt = lastError, retryAt
+	return nil
+}
+
+func (s *memWebhookStore) ListDeliveries(ctx context.Context, webhookID int64, fq PaginatedQuery) ([]WebhookDelivery, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	deliveries := []WebhookDelivery{}
+	for i := len(s.m.deliveries) - 1; i >= 0; i-- {
+		if d := s.m.deliveries[i]; d.WebhookID == webhookID {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	start, end := paginate(len(deliveries), fq.Limit, fq.Offset)
+	return deliveries[start:end], nil
+}
+
+// Link previews
+
+type memLinkPreview struct {
+	LinkPreview
+	status        string
+	attempts      int
+	nextAttemptAt time.Time
+	fetchedAt     time.Time
+}
+
+type memLinkPreviewStore struct{ m *memoryDB }
+
+func (s *memLinkPreviewStore) Queue(ctx context.Context, urls []string, refreshAfter time.Duration) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	for _, url := range urls {
+		p, ok := s.m.linkPreviews[url]
+		if !ok {
+			s.m.linkPreviews[url] = &memLinkPreview{LinkPreview: LinkPreview{URL: url}, status: LinkPreviewPending, nextAttemptAt: now}
+			continue
+		}
+		if p.status != LinkPreviewPending && p.fetchedAt.Before(now.Add(-refreshAfter)) {
+			p.status, p.attempts, p.nextAttemptAt = LinkPreviewPending, 0, now
+		}
+	}
+	return nil
+}
+
+func (s *memLinkPreviewStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PendingLinkPreview, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var due []*memLinkPreview
+	for _, p := range s.m.linkPreviews {
+		if p.status == LinkPreviewPending && !p.nextAttemptAt.After(now) {
+			due = append(due, p)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].nextAttemptAt.Before(due[j].nextAttemptAt) })
+
+	var claimed []PendingLinkPreview
+	for _, p := range due {
+		if len(claimed) == limit {
+			break
+		}
+		p.nextAttemptAt = now.Add(lease)
+		claimed = append(claimed, PendingLinkPreview{URL: p.URL, Attempts: p.attempts})
+	}
+	return claimed, nil
+}
+
+func (s *memLinkPreviewStore) Save(ctx context.Context, preview *LinkPreview) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.linkPreviews[preview.URL]
+	if !ok {
+		return nil
+	}
+	p.LinkPreview = *preview
+	p.status, p.fetchedAt = LinkPreviewReady, time.Now()
+	p.attempts++
+	return nil
+}
+
+func (s *memLinkPreviewStore) MarkFailed(ctx context.Context, url, lastError string, retryAt *time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.linkPreviews[url]
+	if !ok {
+		return nil
+	}
+	p.attempts++
+	if retryAt == nil {
+		p.status, p.fetchedAt = LinkPreviewFailed, time.Now()
+	} else {
+		p.nextAttemptAt = *retryAt
+	}
+	return nil
+}
+
+func (s *memLinkPreviewStore) Get(ctx context.Context, urls []string) (map[string]LinkPreview, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	previews := make(map[string]LinkPreview)
+	for _, url := range urls {
+		if p, ok := s.m.linkPreviews[url]; ok && p.status == LinkPreviewReady {
+			previews[url] = p.LinkPreview
+		}
+	}
+	return previews, nil
+}
+
+// Content flags
+
+type memContentFlagStore struct{ m *memoryDB }
+
+func (s *memContentFlagStore) Create(ctx context.Context, flag *ContentFlag) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	flag.ID = s.m.nextID("content_flags")
+	flag.Status, flag.CreatedAt = ContentFlagPending, memNow()
+	f := *flag
+	f.Reasons = append([]string(nil), flag.Reasons...)
+	s.m.contentFlags[f.ID] = &f
+	return nil
+}
+
+func (s *memContentFlagStore) GetByID(ctx context.Context, id int64) (*ContentFlag, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	f, ok := s.m.contentFlags[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	flag := *f
+	return &flag, nil
+}
+
+func (s *memContentFlagStore) List(ctx context.Context, status string, fq PaginatedQuery) ([]ContentFlag, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	flags := []ContentFlag{}
+	for _, f := range s.m.contentFlags {
+		if status == "" || f.Status == status {
+			flags = append(flags, *f)
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].ID > flags[j].ID })
+	start, end := paginate(len(flags), fq.Limit, fq.Offset)
+	return flags[start:end], nil
+}
+
+func (s *memContentFlagStore) Resolve(ctx context.Context, id int64, status string, moderatorID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	f, ok := s.m.contentFlags[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if f.Status != ContentFlagPending {
+		return ErrConflict
+	}
+	now := memNow()
+	f.Status, f.ResolvedBy, f.ResolvedAt = status, &moderatorID, &now
+	return nil
+}
+
+// Tenants
+
+type memTenantStore struct{ m *memoryDB }
+
+func (s *memTenantStore) Create(ctx context.Context, tenant *Tenant) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, t := range s.m.tenants {
+		if t.Slug == tenant.Slug {
+			return ErrDuplicateTenantSlug
+		}
+	}
+	tenant.ID, tenant.CreatedAt = s.m.nextID("tenants"), memNow()
+	s.m.tenants = append(s.m.tenants, *tenant)
+	return nil
+}
+
+func (s *memTenantStore) GetBySlug(ctx context.Context, slug string) (*Tenant, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, t := range s.m.tenants {
+		if t.Slug == slug {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTenantStore) List(ctx context.Context) ([]Tenant, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return slices.Clone(s.m.tenants), nil
+}
+
+type memViewKey struct {
+	kind     string
+	targetID int64
+	day      string
+}
+
+type memViewStore struct{ m *memoryDB }
+
+func (s *memViewStore) Add(ctx context.Context, counts []ViewCount) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, c := range counts {
+		s.m.views[memViewKey{c.Kind, c.TargetID, c.Day}] += c.Views
+	}
+	return nil
+}
+
+func (s *memViewStore) ProfileDaily(ctx context.Context, userID int64, since time.Time) ([]DailyViews, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	from := since.UTC().Format(time.DateOnly)
+	days := []DailyViews{}
+	for key, views := range s.m.views {
+		if key.kind == ViewProfile && key.targetID == userID && key.day >= from {
+			days = append(days, DailyViews{Date: key.day, Views: views})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, nil
+}
+
+func (s *memViewStore) CompanyListings(ctx context.Context, companyID int64, since time.Time) ([]ListingViews, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	from := since.UTC().Format(time.DateOnly)
+	totals := map[int64]int64{}
+	for key, views := range s.m.views {
+		if key.kind != ViewListing || key.day < from {
+			continue
+		}
+		if l, ok := s.m.listings[key.targetID]; ok && l.CompanyID == companyID {
+			totals[key.targetID] += views
+		}
+	}
+
+	listings := []ListingViews{}
+	for id, views := range totals {
+		listings = append(listings, ListingViews{ListingID: id, Title: s.m.listings[id].Title, Views: views})
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		if listings[i].Views != listings[j].Views {
+			return listings[i].Views > listings[j].Views
+		}
+		return listings[i].ListingID < listings[j].ListingID
+	})
+	return listings, nil
+}
+
+type memListingEventStore struct{ m *memoryDB }
+
+// withListing fills in the listing fields of a copy of e; the caller holds
+// the lock.
+func (s *memListingEventStore) withListing(e *ListingEvent) ListingEvent {
+	event := *e
+	if l, ok := s.m.listings[e.ListingID]; ok {
+		event.CompanyID, event.ListingTitle = l.CompanyID, l.Title
+	}
+	return event
+}
+
+func (s *memListingEventStore) Create(ctx context.Context, event *ListingEvent) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.listings[event.ListingID]; !ok {
+		return ErrForeignKeyListing
+	}
+	if event.EndsAt <= event.StartsAt {
+		return ErrCheckViolation
+	}
+	event.ID = s.m.nextID("listing_events")
+	event.Sequence = 0
+	event.CreatedAt = memNow()
+	event.UpdatedAt = event.CreatedAt
+	stored := *event
+	s.m.listingEvents[event.ID] = &stored
+	*event = s.withListing(&stored)
+	return nil
+}
+
+func (s *memListingEventStore) GetByID(ctx context.Context, id int64) (*ListingEvent, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	e, ok := s.m.listingEvents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if l, ok := s.m.listings[e.ListingID]; !ok || !inTenant(ctx, l.TenantID) {
+		return nil, ErrNotFound
+	}
+	event := s.withListing(e)
+	return &event, nil
+}
+
+func (s *memListingEventStore) Update(ctx context.Context, event *ListingEvent) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	e, ok := s.m.listingEvents[event.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if event.EndsAt <= event.StartsAt {
+		return ErrCheckViolation
+	}
+	e.Title, e.Description, e.Location = event.Title, event.Description, event.Location
+	e.StartsAt, e.EndsAt = event.StartsAt, event.EndsAt
+	e.Sequence++
+	e.UpdatedAt = memNow()
+	event.Sequence, event.UpdatedAt = e.Sequence, e.UpdatedAt
+	return nil
+}
+
+func (s *memListingEventStore) Delete(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.listingEvents[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.listingEvents, id)
+	return nil
+}
+
+func (s *memListingEventStore) List(ctx context.Context, filter ListingEventFilter) ([]ListingEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	after := filter.EndsAfter.UTC().Format(time.RFC3339)
+	events := []ListingEvent{}
+	for _, e := range s.m.listingEvents {
+		l, ok := s.m.listings[e.ListingID]
+		switch {
+		case !ok, !inTenant(ctx, l.TenantID),
+			filter.ListingID != 0 && e.ListingID != filter.ListingID,
+			filter.CompanyID != 0 && l.CompanyID != filter.CompanyID,
+			filter.ActiveOnly && l.Status != ListingStatusActive,
+			e.EndsAt <= after:
+			continue
+		}
+		if filter.FavoritedBy != 0 {
+			if _, ok := s.m.favorites[filter.FavoritedBy][e.ListingID]; !ok {
+				continue
+			}
+		}
+		events = append(events, s.withListing(e))
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].StartsAt != events[j].StartsAt {
+			return events[i].StartsAt < events[j].StartsAt
+		}
+		return events[i].ID < events[j].ID
+	})
+	if len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+type memContactImportStore struct{ m *memoryDB }
+
+func (s *memContactImportStore) Create(ctx context.Context, imp *ContactImport) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[imp.UserID]; !ok {
+		return ErrForeignKeyUser
+	}
+	if imp.Status == "" {
+		imp.Status = ImportPending
+	}
+	imp.ID = s.m.nextID("contact_imports")
+	imp.CreatedAt = memNow()
+	stored := *imp
+	s.m.contactImports[imp.ID] = &stored
+	return nil
+}
+
+func (s *memContactImportStore) Complete(ctx context.Context, imp *ContactImport) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.contactImports[imp.ID]
+	if !ok || stored.Status != ImportPending {
+		return ErrNotFound
+	}
+	completedAt := memNow()
+	stored.Status, stored.Total, stored.Invalid, stored.Unmatched = imp.Status, imp.Total, imp.Invalid, imp.Unmatched
+	stored.UserIDs = append([]int64(nil), imp.UserIDs...)
+	stored.Error, stored.CompletedAt = imp.Error, &completedAt
+	imp.CompletedAt = &completedAt
+	return nil
+}
+
+func (s *memContactImportStore) GetByID(ctx context.Context, id, userID int64) (*ContactImport, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.contactImports[id]
+	if !ok || stored.UserID != userID {
+		return nil, ErrNotFound
+	}
+	imp := *stored
+	imp.UserIDs = append([]int64{}, stored.UserIDs...)
+	return &imp, nil
+}
+
+type memModerationJobStore struct{ m *memoryDB }
+
+func (s *memModerationJobStore) Create(ctx context.Context, job *ModerationJob) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[job.AdminID]; !ok {
+		return ErrForeignKeyUser
+	}
+	job.ID = s.m.nextID("moderation_jobs")
+	job.Status = ModerationJobPending
+	job.CreatedAt = memNow()
+	if job.Failures == nil {
+		job.Failures = []ModerationFailure{}
+	}
+	s.m.moderationJobs[job.ID] = cloneModerationJob(job)
+	return nil
+}
+
+func (s *memModerationJobStore) Progress(ctx context.Context, job *ModerationJob) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.moderationJobs[job.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	job.CompletedAt = nil
+	if job.Status == ModerationJobCompleted {
+		completedAt := memNow()
+		job.CompletedAt = &completedAt
+	}
+	stored.Status, stored.Done, stored.Failed, stored.CompletedAt = job.Status, job.Done, job.Failed, job.CompletedAt
+	stored.Failures = append([]ModerationFailure{}, job.Failures...)
+	return nil
+}
+
+func (s *memModerationJobStore) GetByID(ctx context.Context, id int64) (*ModerationJob, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.moderationJobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneModerationJob(stored), nil
+}
+
+func cloneModerationJob(job *ModerationJob) *ModerationJob {
+	clone := *job
+	clone.TargetIDs = append([]int64{}, job.TargetIDs...)
+	clone.Failures = append([]ModerationFailure{}, job.Failures...)
+	return &clone
+}
+
+type memJobStore struct{ m *memoryDB }
+
+func (s *memJobStore) Enqueue(ctx context.Context, job *jobs.Job) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if job.UniqueKey != "" {
+		for _, j := range s.m.jobQueue {
+			if j.UniqueKey == job.UniqueKey {
+				return jobs.ErrDuplicate
+			}
+		}
+	}
+	job.ID = s.m.nextID("jobs")
+	job.Status = jobs.StatusQueued
+	job.CreatedAt = time.Now()
+	stored := *job
+	s.m.jobQueue = append(s.m.jobQueue, &stored)
+	return nil
+}
+
+func (s *memJobStore) Claim(ctx context.Context, kinds []string, limit int) ([]jobs.Job, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var due []*jobs.Job
+	for _, j := range s.m.jobQueue {
+		if j.Status == jobs.StatusQueued && !j.RunAt.After(now) && slices.Contains(kinds, j.Kind) {
+			due = append(due, j)
+		}
+	}
+	sort.SliceStable(due, func(a, b int) bool { return due[a].RunAt.Before(due[b].RunAt) })
+
+	var claimed []jobs.Job
+	for _, j := range due {
+		if len(claimed) == limit {
+			break
+		}
+		j.Status = jobs.StatusRunning
+		j.Attempts++
+		j.StartedAt = &now
+		claimed = append(claimed, *j)
+	}
+	return claimed, nil
+}
+
+func (s *memJobStore) find(id int64) *jobs.Job {
+	for _, j := range s.m.jobQueue {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (s *memJobStore) Succeed(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if j := s.find(id); j != nil {
+		now := time.Now()
+		j.Status, j.FinishedAt = jobs.StatusSucceeded, &now
+	}
+	return nil
+}
+
+func (s *memJobStore) Fail(ctx context.Context, id int64, msg string, retryAt *time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	j := s.find(id)
+	if j == nil {
+		return nil
+	}
+	j.LastError = msg
+	if retryAt != nil {
+		j.Status, j.RunAt = jobs.StatusQueued, *retryAt
+		return nil
+	}
+	now := time.Now()
+	j.Status, j.FinishedAt = jobs.StatusFailed, &now
+	return nil
+}
+
+func (s *memJobStore) Requeue(ctx context.Context, startedBefore time.Time) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var n int64
+	for _, j := range s.m.jobQueue {
+		if j.Status != jobs.StatusRunning || !j.StartedAt.Before(startedBefore) {
+			continue
+		}
+		n++
+		j.LastError = requeueError
+		if j.Attempts < j.MaxAttempts {
+			j.Status = jobs.StatusQueued
+			continue
+		}
+		now := time.Now()
+		j.Status, j.FinishedAt = jobs.StatusFailed, &now
+	}
+	return n, nil
+}
+
+func (s *memJobStore) List(ctx context.Context, filter JobFilter) ([]jobs.Job, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var matched []jobs.Job
+	for i := len(s.m.jobQueue) - 1; i >= 0; i-- {
+		j := s.m.jobQueue[i]
+		if (filter.Status == "" || j.Status == filter.Status) && (filter.Kind == "" || j.Kind == filter.Kind) {
+			matched = append(matched, *j)
+		}
+	}
+	start, end := paginate(len(matched), filter.Limit, filter.Offset)
+	return append([]jobs.Job{}, matched[start:end]...), nil
+}
+
+func (s *memJobStore) GetByID(ctx context.Context, id int64) (*jobs.Job, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	j := s.find(id)
+	if j == nil {
+		return nil, ErrNotFound
+	}
+	job := *j
+	return &job, nil
+}
+
+func (s *memJobStore) Retry(ctx context.Context, id int64) (*jobs.Job, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	j := s.find(id)
+	if j == nil {
+		return nil, ErrNotFound
+	}
+	if j.Status != jobs.StatusFailed {
+		return nil, ErrJobNotFailed
+	}
+	j.Status, j.Attempts, j.RunAt, j.StartedAt, j.FinishedAt = jobs.StatusQueued, 0, time.Now(), nil, nil
+	job := *j
+	return &job, nil
+}
+
+func (s *memJobStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	kept := s.m.jobQueue[:0]
+	for _, j := range s.m.jobQueue {
+		if (j.Status == jobs.StatusSucceeded || j.Status == jobs.StatusFailed) && j.FinishedAt.Before(before) {
+			continue
+		}
+		kept = append(kept, j)
+	}
+	pruned := int64(len(s.m.jobQueue) - len(kept))
+	s.m.jobQueue = kept
+	return pruned, nil
+}
+
+type memRemoteFollowerStore struct{ m *memoryDB }
+
+func (s *memRemoteFollowerStore) Add(ctx context.Context, f *RemoteFollower) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.companies[f.CompanyID]; !ok {
+		return ErrForeignKey
+	}
+	followers := s.m.remoteFollowers[f.CompanyID]
+	if followers == nil {
+		followers = make(map[string]*RemoteFollower)
+		s.m.remoteFollowers[f.CompanyID] = followers
+	}
+	if existing, ok := followers[f.ActorID]; ok {
+		existing.Inbox, existing.SharedInbox = f.Inbox, f.SharedInbox
+		f.CreatedAt = existing.CreatedAt
+		return nil
+	}
+	f.CreatedAt = memNow()
+	stored := *f
+	followers[f.ActorID] = &stored
+	return nil
+}
+
+func (s *memRemoteFollowerStore) Remove(ctx context.Context, companyID int64, actorID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.remoteFollowers[companyID], actorID)
+	return nil
+}
+
+func (s *memRemoteFollowerStore) Count(ctx context.Context, companyID int64) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return len(s.m.remoteFollowers[companyID]), nil
+}
+
+func (s *memRemoteFollowerStore) Inboxes(ctx context.Context, companyID int64) ([]string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	seen := map[string]bool{}
+	inboxes := []string{}
+	for _, f := range s.m.remoteFollowers[companyID] {
+		inbox := f.SharedInbox
+		if inbox == "" {
+			inbox = f.Inbox
+		}
+		if !seen[inbox] {
+			seen[inbox] = true
+			inboxes = append(inboxes, inbox)
+		}
+	}
+	sort.Strings(inboxes)
+	return inboxes, nil
+}
+
+type memPushDelivery struct {
+	PushDelivery
+	next      *time.Time
+	delivered bool
+}
+
+type memPushDeviceStore struct{ m *memoryDB }
+
+func (s *memPushDeviceStore) Register(ctx context.Context, d *PushDevice) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[d.UserID]; !ok {
+		return ErrForeignKey
+	}
+	for _, existing := range s.m.pushDevices {
+		if existing.Platform == d.Platform && existing.Token == d.Token {
+			existing.UserID, existing.P256dh, existing.Auth = d.UserID, d.P256dh, d.Auth
+			existing.Failures, existing.LastError = 0, ""
+			*d = *existing
+			return nil
+		}
+	}
+	d.ID = s.m.nextID("push_devices")
+	d.Failures, d.LastError, d.LastUsedAt = 0, "", nil
+	d.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	stored := *d
+	s.m.pushDevices[d.ID] = &stored
+	return nil
+}
+
+func (s *memPushDeviceStore) List(ctx context.Context, userID int64) ([]PushDevice, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	devices := []PushDevice{}
+	for _, d := range s.m.pushDevices {
+		if d.UserID == userID {
+			devices = append(devices, *d)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices, nil
+}
+
+func (s *memPushDeviceStore) Delete(ctx context.Context, id, userID int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if d, ok := s.m.pushDevices[id]; !ok || d.UserID != userID {
+		return ErrNotFound
+	}
+	s.prune(id)
+	return nil
+}
+
+func (s *memPushDeviceStore) Prune(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.prune(id)
+	return nil
+}
+
+// prune drops the device and, like the foreign key, its deliveries.
+func (s *memPushDeviceStore) prune(id int64) {
+	delete(s.m.pushDevices, id)
+	s.m.pushDeliveries = slices.DeleteFunc(s.m.pushDeliveries, func(d *memPushDelivery) bool { return d.DeviceID == id })
+}
+
+func (s *memPushDeviceStore) Enqueue(ctx context.Context, userID int64, notification []byte) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	for _, d := range s.m.pushDevices {
+		if d.UserID != userID {
+			continue
+		}
+		s.m.pushDeliveries = append(s.m.pushDeliveries, &memPushDelivery{
+			PushDelivery: PushDelivery{
+				ID:           s.m.nextID("push_deliveries"),
+				DeviceID:     d.ID,
+				Notification: append(json.RawMessage{}, notification...),
+				CreatedAt:    now,
+			},
+			next: &now,
+		})
+	}
+	return nil
+}
+
+func (s *memPushDeviceStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := time.Now()
+	var claimed []PushDelivery
+	for _, d := range s.m.pushDeliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if d.delivered || d.next == nil || d.next.After(now) {
+			continue
+		}
+		next := now.Add(lease)
+		d.next = &next
+		delivery := d.PushDelivery
+		delivery.Device = *s.m.pushDevices[d.DeviceID]
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (s *memPushDeviceStore) delivery(id int64) *memPushDelivery {
+	for _, d := range s.m.pushDeliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *memPushDeviceStore) MarkDelivered(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d := s.delivery(id)
+	if d == nil {
+		return nil
+	}
+	d.delivered, d.next = true, nil
+	d.Attempts++
+	now := time.Now()
+	device := s.m.pushDevices[d.DeviceID]
+	device.Failures, device.LastError, device.LastUsedAt = 0, "", &now
+	return nil
+}
+
+func (s *memPushDeviceStore) MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	d := s.delivery(id)
+	if d == nil {
+		return nil
+	}
+	d.Attempts++
+	d.next = retryAt
+	if retryAt == nil {
+		device := s.m.pushDevices[d.DeviceID]
+		device.Failures++
+		device.LastError = lastError
+	}
+	return nil
+}
+
+// Banned words
+
+type memBannedWordStore struct{ m *memoryDB }
+
+func (s *memBannedWordStore) Add(ctx context.Context, w *BannedWord) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, existing := range s.m.bannedWords {
+		if existing.Word == w.Word {
+			return ErrConflict
+		}
+	}
+	w.ID = s.m.nextID("banned_words")
+	w.CreatedAt = memNow()
+	stored := *w
+	s.m.bannedWords[w.ID] = &stored
+	return nil
+}
+
+func (s *memBannedWordStore) List(ctx context.Context) ([]BannedWord, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	words := []BannedWord{}
+	for _, w := range s.m.bannedWords {
+		words = append(words, *w)
+	}
+	sort.Slice(words, func(i, j int) bool { return words[i].Word < words[j].Word })
+	return words, nil
+}
+
+func (s *memBannedWordStore) Delete(ctx context.Context, id int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.bannedWords[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.bannedWords, id)
+	return nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Mention is an application message that mentions the user.
+type Mention struct {
+	MessageID      int64  `json:"message_id"`
+	ApplicationID  int64  `json:"application_id"`
+	SenderUsername string `json:"sender_username"`
+	Body           string `json:"body"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type MentionStore struct {
+	db *sql.DB
+}
+
+// Create records that the message mentions userIDs and returns the users
+// that were recorded. Hidden messages from muted senders record no one, so
+// they never notify anybody.
+func (s *MentionStore) Create(ctx context.Context, messageID int64, userIDs []int64) ([]int64, error) {
+	query := `
+		INSERT INTO message_mentions (message_id, user_id)
+		SELECT m.id, u.id
+		FROM application_messages m, unnest($2::bigint[]) AS u(id)
+		WHERE m.id = $1 AND NOT m.is_hidden
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, messageID, pq.Array(userIDs))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	var recorded []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, id)
+	}
+	return recorded, rows.Err()
+}
+
+// ListByUser returns the messages mentioning userID, newest first.
+func (s *MentionStore) ListByUser(ctx context.Context, userID int64, fq PaginatedQuery) ([]Mention, error) {
+	query := `
+		SELECT m.id, m.application_id, COALESCE(u.username, ''), m.body, mm.created_at
+		FROM message_mentions mm
+		JOIN application_messages m ON m.id = mm.message_id
+		LEFT JOIN users u ON u.id = m.sender_user_id
+		WHERE mm.user_id = $1
+		ORDER BY mm.created_at DESC, m.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []Mention{}
+	for rows.Next() {
+		var m Mention
+		if err := rows.Scan(&m.MessageID, &m.ApplicationID, &m.SenderUsername, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
@@ -12,16 +12,27 @@ type ApplicationMessage struct {
 	SenderUserID  *int64 `json:"sender_user_id,omitempty"`
 	Body          string `json:"body"`
 	CreatedAt     string `json:"created_at"`
+	// Mentions are the usernames notified about the message.
+	Mentions []string `json:"mentions,omitempty"`
+	// Held stores the message hidden for moderators, like one from a muted
+	// sender.
+	Held bool `json:"-"`
 }
 
 type MessageStore struct {
 	db *sql.DB
 }
 
+// Create stores a message. Held messages and those from muted senders are
+// stored hidden so only the sender keeps seeing them.
 func (s *MessageStore) Create(ctx context.Context, msg *ApplicationMessage) error {
+	if err := Limits.Apply(LimitMessage, &msg.Body); err != nil {
+		return err
+	}
+
 	query := `
-        INSERT INTO application_messages (application_id, sender_user_id, body)
-        VALUES ($1, $2, $3)
+        INSERT INTO application_messages (application_id, sender_user_id, body, is_hidden)
+        VALUES ($1, $2, $3, $4 OR COALESCE((SELECT is_muted FROM users WHERE id = $2), false))
         RETURNING id, created_at
     `
 
@@ -34,10 +45,12 @@ func (s *MessageStore) Create(ctx context.Context, msg *ApplicationMessage) erro
 		sender.Int64 = *msg.SenderUserID
 	}
 
-	return s.db.QueryRowContext(ctx, query, msg.ApplicationID, sender, msg.Body).Scan(&msg.ID, &msg.CreatedAt)
+	return translateError(s.db.QueryRowContext(ctx, query, msg.ApplicationID, sender, msg.Body, msg.Held).Scan(&msg.ID, &msg.CreatedAt))
 }
 
-func (s *MessageStore) List(ctx context.Context, applicationID int64, limit, offset int) ([]ApplicationMessage, error) {
+// List returns the visible messages of an application for viewerID; hidden
+// messages are only returned to their own sender.
+func (s *MessageStore) List(ctx context.Context, applicationID, viewerID int64, limit, offset int) ([]ApplicationMessage, error) {
 	if limit == 0 {
 		limit = 50
 	}
@@ -52,14 +65,15 @@ func (s *MessageStore) List(ctx context.Context, applicationID int64, limit, off
         SELECT id, application_id, sender_user_id, body, created_at
         FROM application_messages
         WHERE application_id = $1
+          AND (is_hidden = false OR sender_user_id = $2)
         ORDER BY created_at ASC, id ASC
-        LIMIT $2 OFFSET $3
+        LIMIT $3 OFFSET $4
     `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, applicationID, limit, offset)
+	rows, err := s.db.QueryContext(ctx, query, applicationID, viewerID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -84,3 +98,26 @@ func (s *MessageStore) List(ctx context.Context, applicationID int64, limit, off
 
 	return messages, nil
 }
+
+// Release makes a held message visible, unless its sender is muted.
+func (s *MessageStore) Release(ctx context.Context, id int64) error {
+	query := `
+        UPDATE application_messages m
+        SET is_hidden = COALESCE((SELECT is_muted FROM users WHERE id = m.sender_user_id), false)
+        WHERE id = $1
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -3,7 +3,10 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
 )
 
 func NewMockStore() Storage {
@@ -22,6 +25,35 @@ func NewMockStore() Storage {
 		AdminActions: &MockAdminActionStore{},
 		AdminStats:   &MockAdminStatsStore{},
 		Invites:      &MockInviteStore{},
+		EmailChanges: &MockEmailChangeStore{},
+		Outbox:       &MockOutboxStore{},
+		SentEmails:   &MockSentEmailStore{},
+		MagicLinks:   &MockMagicLinkStore{},
+		Usage:        &MockUsageStore{},
+		Suppressions: &MockSuppressionStore{},
+
+		EmailTracking:   &MockEmailTrackingStore{},
+		Broadcasts:      &MockBroadcastStore{},
+		Views:           &MockViewStore{},
+		DeadLetters:     &MockDeadLetterStore{},
+		DeliveryWindows: &MockDeliveryWindowStore{},
+		Tags:            &MockTagStore{},
+		Mentions:        &MockMentionStore{},
+		Conversations:   &MockConversationStore{},
+		Blocks:          &MockBlockStore{},
+		InviteCodes:     &MockInviteCodeStore{},
+		Teams:           &MockTeamStore{},
+		Webhooks:        &MockWebhookStore{},
+		LinkPreviews:    &MockLinkPreviewStore{},
+		ContentFlags:    &MockContentFlagStore{},
+		Tenants:         &MockTenantStore{},
+		ListingEvents:   &MockListingEventStore{},
+		ContactImports:  &MockContactImportStore{},
+		ModerationJobs:  &MockModerationJobStore{},
+		Jobs:            &MockJobStore{},
+		RemoteFollowers: &MockRemoteFollowerStore{},
+		PushDevices:     &MockPushDeviceStore{},
+		BannedWords:     &MockBannedWordStore{},
 	}
 }
 
@@ -32,25 +64,41 @@ func (m *MockUserStore) Create(ctx context.Context, tx *sql.Tx, u *User) error {
 }
 
 func (m *MockUserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
-	return &User{ID: userID}, nil
+	return &User{ID: userID, IsActive: true, State: UserStateActive}, nil
 }
 
 func (m *MockUserStore) GetByEmail(context.Context, string) (*User, error) {
 	return &User{}, nil
 }
 
-func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error {
+func (m *MockUserStore) GetByUsername(context.Context, string) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) GetByIdentifier(context.Context, string) (*User, error) {
+	return &User{}, nil
+}
+
+func (m *MockUserStore) CreateActive(ctx context.Context, user *User) error {
 	return nil
 }
 
-func (m *MockUserStore) CreateCompanyAndUser(ctx context.Context, company *Company, user *User, token string, exp time.Duration) error {
+func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
 	return nil
 }
 
-func (m *MockUserStore) Activate(ctx context.Context, t string) error {
+func (m *MockUserStore) Reinvite(ctx context.Context, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
 	return nil
 }
 
+func (m *MockUserStore) CreateCompanyAndUser(ctx context.Context, company *Company, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
+	return nil
+}
+
+func (m *MockUserStore) Activate(ctx context.Context, hashes []string) (*User, error) {
+	return &User{}, nil
+}
+
 func (m *MockUserStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
@@ -59,6 +107,18 @@ func (m *MockUserStore) UpdateProfile(ctx context.Context, userID int64, firstNa
 	return nil
 }
 
+func (m *MockUserStore) UpdateLocalization(ctx context.Context, userID int64, locale, region, timezone *string) error {
+	return nil
+}
+
+func (m *MockUserStore) UpdateUsername(ctx context.Context, userID int64, username string) error {
+	return nil
+}
+
+func (m *MockUserStore) SetPrivate(ctx context.Context, userID int64, private bool) error {
+	return nil
+}
+
 func (m *MockUserStore) UpdatePassword(ctx context.Context, userID int64, hashedPassword []byte) error {
 	return nil
 }
@@ -67,20 +127,64 @@ func (m *MockUserStore) List(ctx context.Context, fq PaginatedQuery) ([]User, er
 	return []User{}, nil
 }
 
-func (m *MockUserStore) UpdateStatus(ctx context.Context, userID int64, isActive bool) error {
+func (m *MockUserStore) Count(ctx context.Context, fq PaginatedQuery) (int, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) Transition(ctx context.Context, userID int64, to string, actorID *int64, reason string) error {
 	return nil
 }
 
+func (m *MockUserStore) StateHistory(ctx context.Context, userID int64) ([]UserStateEvent, error) {
+	return []UserStateEvent{}, nil
+}
+
 func (m *MockUserStore) UpdateRole(ctx context.Context, userID int64, roleID int64) error {
 	return nil
 }
 
+func (m *MockUserStore) SetMuted(ctx context.Context, userID int64, muted bool) error {
+	return nil
+}
+
+func (m *MockUserStore) HideMessages(ctx context.Context, userID int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) TakenUsernames(ctx context.Context, candidates []string) (map[string]bool, error) {
+	return map[string]bool{}, nil
+}
+
+func (m *MockUserStore) NormalizeCountries(ctx context.Context, normalize func(string) (string, bool)) (int64, []string, error) {
+	return 0, nil, nil
+}
+
+func (m *MockUserStore) MatchEmailHashes(ctx context.Context, hashes []string, excludeUserID int64) ([]ContactMatch, error) {
+	return nil, nil
+}
+
+func (m *MockUserStore) MatchUsernames(ctx context.Context, usernames []string, excludeUserID int64) ([]ContactMatch, error) {
+	return nil, nil
+}
+
+func (m *MockUserStore) PublicProfiles(ctx context.Context, ids []int64, viewerID int64, staff bool) ([]PublicProfile, error) {
+	return []PublicProfile{}, nil
+}
+
 type MockLoginEventStore struct{}
 
 func (m *MockLoginEventStore) Create(ctx context.Context, event *LoginEvent) error {
 	return nil
 }
 
+func (m *MockLoginEventStore) History(ctx context.Context, userID int64, country, device string) (*LoginHistory, error) {
+	return &LoginHistory{}, nil
+}
+
+func (m *MockLoginEventStore) ListSuccessful(ctx context.Context, userID int64, fq PaginatedQuery) ([]LoginEvent, error) {
+	return []LoginEvent{}, nil
+}
+
 type MockCompanyStore struct{}
 
 func (m *MockCompanyStore) Create(ctx context.Context, tx *sql.Tx, c *Company) error {
@@ -109,6 +213,26 @@ func (m *MockRoleStore) GetByName(ctx context.Context, name string) (*Role, erro
 	return &Role{Name: name}, nil
 }
 
+func (m *MockRoleStore) List(ctx context.Context) ([]Role, error) {
+	return []Role{}, nil
+}
+
+func (m *MockRoleStore) Create(ctx context.Context, role *Role) error {
+	return nil
+}
+
+func (m *MockRoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return nil
+}
+
+func (m *MockRoleStore) PermissionsByRole(ctx context.Context) (map[string][]string, error) {
+	return map[string][]string{
+		RoleAgency:    {PermissionListingsWrite},
+		RoleDeveloper: {PermissionListingsWrite},
+		RoleModerator: {PermissionComplaintsReview, PermissionComplaintsResolve, PermissionUsersMute},
+	}, nil
+}
+
 type MockProjectStore struct{}
 
 func (m *MockProjectStore) Create(ctx context.Context, project *Project) error {
@@ -155,6 +279,22 @@ func (m *MockListingStore) UpdateStatus(ctx context.Context, id int64, status st
 	return nil
 }
 
+func (m *MockListingStore) PublishDue(ctx context.Context) ([]int64, error) {
+	return nil, nil
+}
+
+func (m *MockListingStore) Pin(ctx context.Context, listingID int64) error {
+	return nil
+}
+
+func (m *MockListingStore) Unpin(ctx context.Context, listingID int64) error {
+	return nil
+}
+
+func (m *MockListingStore) Versions(ctx context.Context, listingID int64) ([]ListingVersion, error) {
+	return []ListingVersion{}, nil
+}
+
 func (m *MockListingStore) Update(ctx context.Context, listing *Listing) error {
 	return nil
 }
@@ -163,6 +303,14 @@ func (m *MockListingStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+func (m *MockListingStore) Restore(ctx context.Context, id, companyID int64, since time.Time) error {
+	return nil
+}
+
+func (m *MockListingStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
 func (m *MockListingStore) GetByID(ctx context.Context, id int64) (*Listing, error) {
 	return &Listing{ID: id}, nil
 }
@@ -199,10 +347,14 @@ func (m *MockMessageStore) Create(ctx context.Context, msg *ApplicationMessage)
 	return nil
 }
 
-func (m *MockMessageStore) List(ctx context.Context, applicationID int64, limit, offset int) ([]ApplicationMessage, error) {
+func (m *MockMessageStore) List(ctx context.Context, applicationID, viewerID int64, limit, offset int) ([]ApplicationMessage, error) {
 	return []ApplicationMessage{}, nil
 }
 
+func (m *MockMessageStore) Release(ctx context.Context, id int64) error {
+	return nil
+}
+
 type MockInviteStore struct{}
 
 func (m *MockInviteStore) Create(ctx context.Context, invite *RegistrationInvite) error {
@@ -251,10 +403,18 @@ func (m *MockFavoriteStore) ListByUser(ctx context.Context, userID int64) ([]Fav
 	return []FavoriteListing{}, nil
 }
 
+func (m *MockFavoriteStore) Each(ctx context.Context, userID int64, fn func(FavoriteListing) error) error {
+	return nil
+}
+
 func (m *MockFavoriteStore) Count(ctx context.Context, userID int64) (int, error) {
 	return 0, nil
 }
 
+func (m *MockFavoriteStore) Stats(ctx context.Context, userID int64, listingIDs []int64) (map[int64]FavoriteStats, error) {
+	return map[int64]FavoriteStats{}, nil
+}
+
 type MockDashboardStore struct{}
 
 func (m *MockDashboardStore) GetOverview(ctx context.Context, userID int64) (*DashboardOverview, error) {
@@ -285,3 +445,591 @@ func (m *MockComplaintStore) List(ctx context.Context, filter ComplaintFilter) (
 func (m *MockComplaintStore) UpdateStatus(ctx context.Context, id int64, status string) error {
 	return nil
 }
+
+func (m *MockComplaintStore) Resolve(ctx context.Context, id int64, resolution string, resolvedBy int64) error {
+	return nil
+}
+
+func (m *MockComplaintStore) Reopen(ctx context.Context, id int64, status string) error {
+	return nil
+}
+
+type MockOutboxStore struct{}
+
+func (m *MockOutboxStore) Enqueue(ctx context.Context, email *OutboxEmail) error {
+	return nil
+}
+
+func (m *MockOutboxStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]OutboxEmail, error) {
+	return nil, nil
+}
+
+func (m *MockOutboxStore) MarkSent(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockOutboxStore) SetLintWarnings(ctx context.Context, id int64, warnings []string) error {
+	return nil
+}
+
+func (m *MockOutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	return nil
+}
+
+func (m *MockOutboxStore) CountAbandoned(ctx context.Context, minAttempts int) (int, error) {
+	return 0, nil
+}
+
+func (m *MockOutboxStore) Stats(ctx context.Context, since time.Time) (*OutboxStats, error) {
+	return &OutboxStats{Templates: []OutboxTemplateStats{}}, nil
+}
+
+func (m *MockOutboxStore) DeadLetter(ctx context.Context, id int64, lastError, subject, body string) error {
+	return nil
+}
+
+type MockDeadLetterStore struct{}
+
+func (m *MockDeadLetterStore) List(ctx context.Context, fq PaginatedQuery) ([]DeadLetter, error) {
+	return []DeadLetter{}, nil
+}
+
+func (m *MockDeadLetterStore) GetByID(ctx context.Context, id int64) (*DeadLetter, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockDeadLetterStore) Retry(ctx context.Context, id int64) (*OutboxEmail, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockDeadLetterStore) Discard(ctx context.Context, id int64) error {
+	return ErrNotFound
+}
+
+func (m *MockDeadLetterStore) Count(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+type MockEmailChangeStore struct{}
+
+func (m *MockEmailChangeStore) Create(ctx context.Context, change *EmailChange, oldToken, newToken string, notifications []*OutboxEmail) error {
+	return nil
+}
+
+func (m *MockEmailChangeStore) GetByUserID(ctx context.Context, userID int64) (*EmailChange, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockEmailChangeStore) Confirm(ctx context.Context, hashes []string) (*EmailChange, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockEmailChangeStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockMagicLinkStore struct{}
+
+func (m *MockMagicLinkStore) Create(ctx context.Context, userID int64, token string, expiry time.Time, email *OutboxEmail) error {
+	return nil
+}
+
+func (m *MockMagicLinkStore) Consume(ctx context.Context, hashes []string) (int64, error) {
+	return 0, ErrNotFound
+}
+
+type MockUsageStore struct{}
+
+func (m *MockUsageStore) GetAccountUsage(ctx context.Context, userID int64, since time.Time) (*AccountUsage, error) {
+	return &AccountUsage{EmailsReceived: map[string]int{}}, nil
+}
+
+func (m *MockUsageStore) MediaBytes(ctx context.Context, userID int64) (int64, error) {
+	return 0, nil
+}
+
+type MockEmailTrackingStore struct{}
+
+func (m *MockEmailTrackingStore) Record(ctx context.Context, event *TrackingEvent) error {
+	return nil
+}
+
+func (m *MockEmailTrackingStore) Stats(ctx context.Context, since time.Time) ([]TrackingStats, error) {
+	return []TrackingStats{}, nil
+}
+
+func (m *MockEmailTrackingStore) SetOptOut(ctx context.Context, userID int64, optOut bool) error {
+	return nil
+}
+
+func (m *MockEmailTrackingStore) OptedOut(ctx context.Context, email string) (bool, error) {
+	return false, nil
+}
+
+type MockBroadcastStore struct{}
+
+func (m *MockBroadcastStore) Create(ctx context.Context, b *Broadcast) error {
+	return nil
+}
+
+func (m *MockBroadcastStore) GetByID(ctx context.Context, id int64) (*Broadcast, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockBroadcastStore) List(ctx context.Context, fq PaginatedQuery) ([]Broadcast, error) {
+	return []Broadcast{}, nil
+}
+
+func (m *MockBroadcastStore) Claim(ctx context.Context, lease time.Duration) (*Broadcast, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockBroadcastStore) Recipients(ctx context.Context, b *Broadcast, limit int) ([]BroadcastRecipient, error) {
+	return nil, nil
+}
+
+func (m *MockBroadcastStore) Advance(ctx context.Context, id, lastUserID int64, sent, failed, skipped int, done bool) error {
+	return nil
+}
+
+func (m *MockBroadcastStore) SetStatus(ctx context.Context, id int64, from, to string) error {
+	return ErrNotFound
+}
+
+type MockSentEmailStore struct{}
+
+func (m *MockSentEmailStore) Create(ctx context.Context, sent *SentEmail) error {
+	return nil
+}
+
+func (m *MockSentEmailStore) ListByEmail(ctx context.Context, email string, fq PaginatedQuery) ([]SentEmail, error) {
+	return []SentEmail{}, nil
+}
+
+type MockSuppressionStore struct{}
+
+func (m *MockSuppressionStore) Add(ctx context.Context, suppression *EmailSuppression) error {
+	return nil
+}
+
+func (m *MockSuppressionStore) IsSuppressed(ctx context.Context, email string, transactional bool) (bool, error) {
+	return false, nil
+}
+
+func (m *MockSuppressionStore) List(ctx context.Context, fq PaginatedQuery) ([]EmailSuppression, error) {
+	return []EmailSuppression{}, nil
+}
+
+func (m *MockSuppressionStore) Delete(ctx context.Context, email string) error {
+	return nil
+}
+
+type MockDeliveryWindowStore struct{}
+
+func (m *MockDeliveryWindowStore) Get(ctx context.Context, userID int64) (*DeliveryWindow, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockDeliveryWindowStore) Set(ctx context.Context, userID int64, window *DeliveryWindow) error {
+	return nil
+}
+
+func (m *MockDeliveryWindowStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type MockTagStore struct{}
+
+func (m *MockTagStore) Set(ctx context.Context, listingID int64, tags []string) error {
+	return nil
+}
+
+func (m *MockTagStore) Trending(ctx context.Context, since time.Time, region string, limit int) ([]TagCount, error) {
+	return []TagCount{}, nil
+}
+
+type MockMentionStore struct{}
+
+func (m *MockMentionStore) Create(ctx context.Context, messageID int64, userIDs []int64) ([]int64, error) {
+	return userIDs, nil
+}
+
+func (m *MockMentionStore) ListByUser(ctx context.Context, userID int64, fq PaginatedQuery) ([]Mention, error) {
+	return []Mention{}, nil
+}
+
+type MockConversationStore struct{}
+
+func (m *MockConversationStore) Open(ctx context.Context, userID, otherID int64) (*Conversation, error) {
+	return &Conversation{UserID: otherID}, nil
+}
+
+func (m *MockConversationStore) Get(ctx context.Context, id, userID int64) (*Conversation, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockConversationStore) List(ctx context.Context, userID int64, fq PaginatedQuery) ([]Conversation, error) {
+	return []Conversation{}, nil
+}
+
+func (m *MockConversationStore) CreateMessage(ctx context.Context, msg *DirectMessage) error {
+	return nil
+}
+
+func (m *MockConversationStore) ListMessages(ctx context.Context, conversationID, viewerID, before int64, limit int) ([]DirectMessage, error) {
+	return []DirectMessage{}, nil
+}
+
+func (m *MockConversationStore) MarkRead(ctx context.Context, conversationID, userID, messageID int64) error {
+	return nil
+}
+
+func (m *MockConversationStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	return 0, nil
+}
+
+func (m *MockConversationStore) Exists(ctx context.Context, userID, otherID int64) (bool, error) {
+	return false, nil
+}
+
+type MockBlockStore struct{}
+
+func (m *MockBlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (m *MockBlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (m *MockBlockStore) Blocked(ctx context.Context, blockerID, blockedID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockBlockStore) Between(ctx context.Context, userID, otherID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *MockBlockStore) List(ctx context.Context, blockerID int64, fq PaginatedQuery) ([]BlockedUser, error) {
+	return []BlockedUser{}, nil
+}
+
+type MockInviteCodeStore struct{}
+
+func (m *MockInviteCodeStore) Create(ctx context.Context, code *InviteCode) error {
+	return nil
+}
+
+func (m *MockInviteCodeStore) CreateForUser(ctx context.Context, userID int64, code *InviteCode, quota int) error {
+	return nil
+}
+
+func (m *MockInviteCodeStore) Reserve(ctx context.Context, code string) (*InviteCode, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockInviteCodeStore) Release(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockInviteCodeStore) Redeem(ctx context.Context, id, userID int64) error {
+	return nil
+}
+
+func (m *MockInviteCodeStore) Revoke(ctx context.Context, code string) (*InviteCode, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockInviteCodeStore) List(ctx context.Context, fq PaginatedQuery) ([]InviteCode, error) {
+	return []InviteCode{}, nil
+}
+
+func (m *MockInviteCodeStore) ListByCreator(ctx context.Context, userID int64) ([]InviteCode, error) {
+	return []InviteCode{}, nil
+}
+
+type MockTeamStore struct{}
+
+func (m *MockTeamStore) Invite(ctx context.Context, invite *RegistrationInvite, email *OutboxEmail) error {
+	return nil
+}
+
+func (m *MockTeamStore) Join(ctx context.Context, invite *RegistrationInvite, userID int64) error {
+	return nil
+}
+
+func (m *MockTeamStore) Members(ctx context.Context, companyID int64) ([]TeamMember, error) {
+	return []TeamMember{}, nil
+}
+
+func (m *MockTeamStore) Role(ctx context.Context, companyID, userID int64) (string, error) {
+	return TeamRoleOwner, nil
+}
+
+func (m *MockTeamStore) SetRole(ctx context.Context, companyID, userID int64, role string) error {
+	return nil
+}
+
+func (m *MockTeamStore) Remove(ctx context.Context, companyID, userID int64) error {
+	return nil
+}
+
+type MockWebhookStore struct{}
+
+func (m *MockWebhookStore) Create(ctx context.Context, hook *Webhook) error {
+	return nil
+}
+
+func (m *MockWebhookStore) GetByID(ctx context.Context, id int64) (*Webhook, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockWebhookStore) List(ctx context.Context, companyID *int64) ([]Webhook, error) {
+	return []Webhook{}, nil
+}
+
+func (m *MockWebhookStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockWebhookStore) Enqueue(ctx context.Context, event string, companyID *int64, payload json.RawMessage) error {
+	return nil
+}
+
+func (m *MockWebhookStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *MockWebhookStore) MarkDelivered(ctx context.Context, id int64, status int) error {
+	return nil
+}
+
+func (m *MockWebhookStore) MarkFailed(ctx context.Context, id int64, status int, lastError string, retryAt *time.Time) error {
+	return nil
+}
+
+func (m *MockWebhookStore) ListDeliveries(ctx context.Context, webhookID int64, fq PaginatedQuery) ([]WebhookDelivery, error) {
+	return []WebhookDelivery{}, nil
+}
+
+type MockLinkPreviewStore struct{}
+
+func (m *MockLinkPreviewStore) Queue(ctx context.Context, urls []string, refreshAfter time.Duration) error {
+	return nil
+}
+
+func (m *MockLinkPreviewStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PendingLinkPreview, error) {
+	return nil, nil
+}
+
+func (m *MockLinkPreviewStore) Save(ctx context.Context, preview *LinkPreview) error {
+	return nil
+}
+
+func (m *MockLinkPreviewStore) MarkFailed(ctx context.Context, url, lastError string, retryAt *time.Time) error {
+	return nil
+}
+
+func (m *MockLinkPreviewStore) Get(ctx context.Context, urls []string) (map[string]LinkPreview, error) {
+	return map[string]LinkPreview{}, nil
+}
+
+type MockContentFlagStore struct{}
+
+func (m *MockContentFlagStore) Create(ctx context.Context, flag *ContentFlag) error {
+	return nil
+}
+
+func (m *MockContentFlagStore) GetByID(ctx context.Context, id int64) (*ContentFlag, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockContentFlagStore) List(ctx context.Context, status string, fq PaginatedQuery) ([]ContentFlag, error) {
+	return []ContentFlag{}, nil
+}
+
+func (m *MockContentFlagStore) Resolve(ctx context.Context, id int64, status string, moderatorID int64) error {
+	return nil
+}
+
+type MockViewStore struct{}
+
+func (m *MockViewStore) Add(ctx context.Context, counts []ViewCount) error {
+	return nil
+}
+
+func (m *MockViewStore) ProfileDaily(ctx context.Context, userID int64, since time.Time) ([]DailyViews, error) {
+	return []DailyViews{}, nil
+}
+
+func (m *MockViewStore) CompanyListings(ctx context.Context, companyID int64, since time.Time) ([]ListingViews, error) {
+	return []ListingViews{}, nil
+}
+
+type MockTenantStore struct{}
+
+func (m *MockTenantStore) Create(ctx context.Context, tenant *Tenant) error {
+	return nil
+}
+
+func (m *MockTenantStore) GetBySlug(ctx context.Context, slug string) (*Tenant, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockTenantStore) List(ctx context.Context) ([]Tenant, error) {
+	return nil, nil
+}
+
+type MockListingEventStore struct{}
+
+func (m *MockListingEventStore) Create(ctx context.Context, event *ListingEvent) error {
+	return nil
+}
+
+func (m *MockListingEventStore) GetByID(ctx context.Context, id int64) (*ListingEvent, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockListingEventStore) Update(ctx context.Context, event *ListingEvent) error {
+	return nil
+}
+
+func (m *MockListingEventStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockListingEventStore) List(ctx context.Context, filter ListingEventFilter) ([]ListingEvent, error) {
+	return []ListingEvent{}, nil
+}
+
+type MockContactImportStore struct{}
+
+func (m *MockContactImportStore) Create(ctx context.Context, imp *ContactImport) error {
+	return nil
+}
+
+func (m *MockContactImportStore) Complete(ctx context.Context, imp *ContactImport) error {
+	return nil
+}
+
+func (m *MockContactImportStore) GetByID(ctx context.Context, id, userID int64) (*ContactImport, error) {
+	return nil, ErrNotFound
+}
+
+type MockModerationJobStore struct{}
+
+func (m *MockModerationJobStore) Create(ctx context.Context, job *ModerationJob) error {
+	return nil
+}
+
+func (m *MockModerationJobStore) Progress(ctx context.Context, job *ModerationJob) error {
+	return nil
+}
+
+func (m *MockModerationJobStore) GetByID(ctx context.Context, id int64) (*ModerationJob, error) {
+	return nil, ErrNotFound
+}
+
+type MockJobStore struct{}
+
+func (m *MockJobStore) Enqueue(ctx context.Context, job *jobs.Job) error {
+	return nil
+}
+
+func (m *MockJobStore) Claim(ctx context.Context, kinds []string, limit int) ([]jobs.Job, error) {
+	return nil, nil
+}
+
+func (m *MockJobStore) Succeed(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockJobStore) Fail(ctx context.Context, id int64, msg string, retryAt *time.Time) error {
+	return nil
+}
+
+func (m *MockJobStore) Requeue(ctx context.Context, startedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockJobStore) List(ctx context.Context, filter JobFilter) ([]jobs.Job, error) {
+	return []jobs.Job{}, nil
+}
+
+func (m *MockJobStore) GetByID(ctx context.Context, id int64) (*jobs.Job, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockJobStore) Retry(ctx context.Context, id int64) (*jobs.Job, error) {
+	return nil, ErrNotFound
+}
+
+func (m *MockJobStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+type MockRemoteFollowerStore struct{}
+
+func (m *MockRemoteFollowerStore) Add(ctx context.Context, f *RemoteFollower) error {
+	return nil
+}
+
+func (m *MockRemoteFollowerStore) Remove(ctx context.Context, companyID int64, actorID string) error {
+	return nil
+}
+
+func (m *MockRemoteFollowerStore) Count(ctx context.Context, companyID int64) (int, error) {
+	return 0, nil
+}
+
+func (m *MockRemoteFollowerStore) Inboxes(ctx context.Context, companyID int64) ([]string, error) {
+	return []string{}, nil
+}
+
+type MockPushDeviceStore struct{}
+
+func (m *MockPushDeviceStore) Register(ctx context.Context, d *PushDevice) error {
+	return nil
+}
+
+func (m *MockPushDeviceStore) List(ctx context.Context, userID int64) ([]PushDevice, error) {
+	return []PushDevice{}, nil
+}
+
+func (m *MockPushDeviceStore) Delete(ctx context.Context, id, userID int64) error {
+	return ErrNotFound
+}
+
+func (m *MockPushDeviceStore) Prune(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockPushDeviceStore) Enqueue(ctx context.Context, userID int64, notification []byte) error {
+	return nil
+}
+
+func (m *MockPushDeviceStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error) {
+	return nil, nil
+}
+
+func (m *MockPushDeviceStore) MarkDelivered(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockPushDeviceStore) MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	return nil
+}
+
+type MockBannedWordStore struct{}
+
+func (m *MockBannedWordStore) Add(ctx context.Context, w *BannedWord) error {
+	return nil
+}
+
+func (m *MockBannedWordStore) List(ctx context.Context) ([]BannedWord, error) {
+	return []BannedWord{}, nil
+}
+
+func (m *MockBannedWordStore) Delete(ctx context.Context, id int64) error {
+	return ErrNotFound
+}
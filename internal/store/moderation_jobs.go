@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ModerationDeleteListings = "delete_listings"
+	ModerationBanUsers       = "ban_users"
+	ModerationPurgeUsers     = "purge_users"
+)
+
+const (
+	ModerationJobPending   = "pending"
+	ModerationJobRunning   = "running"
+	ModerationJobCompleted = "completed"
+)
+
+// ModerationJob is one bulk moderation action an admin started, run in
+// the background. Done counts the targets handled so far, Failed those that
+// could not be, with the reason in Failures.
+type ModerationJob struct {
+	ID          int64               `json:"id"`
+	AdminID     int64               `json:"admin_id"`
+	Action      string              `json:"action"`
+	TargetIDs   []int64             `json:"target_ids"`
+	Reason      string              `json:"reason,omitempty"`
+	Status      string              `json:"status"`
+	Done        int                 `json:"done"`
+	Failed      int                 `json:"failed"`
+	Failures    []ModerationFailure `json:"failures"`
+	CreatedAt   string              `json:"created_at"`
+	CompletedAt *string             `json:"completed_at,omitempty"`
+}
+
+type ModerationFailure struct {
+	TargetID int64  `json:"target_id"`
+	Error    string `json:"error"`
+}
+
+type ModerationJobStore struct {
+	db *sql.DB
+}
+
+func (s *ModerationJobStore) Create(ctx context.Context, job *ModerationJob) error {
+	query := `
+		INSERT INTO moderation_jobs (admin_id, action, target_ids, reason, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	job.Status = ModerationJobPending
+	if job.Failures == nil {
+		job.Failures = []ModerationFailure{}
+	}
+	err := s.db.QueryRowContext(ctx, query, job.AdminID, job.Action, pq.Array(job.TargetIDs), job.Reason, job.Status).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// Progress saves the status, counts and failures of job; a completed job
+// also gets its completed_at.
+func (s *ModerationJobStore) Progress(ctx context.Context, job *ModerationJob) error {
+	query := `
+		UPDATE moderation_jobs
+		SET status = $2, done = $3, failed = $4, failures = $5,
+		    completed_at = CASE WHEN $2 = 'completed' THEN NOW() END
+		WHERE id = $1
+		RETURNING completed_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	failures, err := json.Marshal(job.Failures)
+	if err != nil {
+		return err
+	}
+	err = s.db.QueryRowContext(ctx, query, job.ID, job.Status, job.Done, job.Failed, failures).Scan(&job.CompletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ModerationJobStore) GetByID(ctx context.Context, id int64) (*ModerationJob, error) {
+	query := `
+		SELECT id, admin_id, action, target_ids, reason, status, done, failed, failures, created_at, completed_at
+		FROM moderation_jobs
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var job ModerationJob
+	var targetIDs pq.Int64Array
+	var failures []byte
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&job.ID, &job.AdminID, &job.Action, &targetIDs, &job.Reason, &job.Status,
+		&job.Done, &job.Failed, &failures, &job.CreatedAt, &job.CompletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	job.TargetIDs = []int64(targetIDs)
+	if err := json.Unmarshal(failures, &job.Failures); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
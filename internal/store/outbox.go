@@ -0,0 +1,269 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/lib/pq"
+)
+
+// OutboxEmail is an email written in the same transaction as the change that
+// triggers it and delivered later by the relay. Email and Data are stored
+// encrypted.
+type OutboxEmail struct {
+	ID        int64           `json:"id"`
+	Template  string          `json:"template"`
+	Username  string          `json:"username"`
+	Email     string          `json:"-"`
+	Data      json.RawMessage `json:"-"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt string          `json:"created_at"`
+	// TriggeredBy defaults to the principal on the context passed to the
+	// store, so support can tell user requests from admin actions and jobs.
+	TriggeredBy Principal `json:"triggered_by"`
+	// LintWarnings are deliverability problems found before sending, see
+	// MAIL_LINT.
+	LintWarnings []string `json:"lint_warnings,omitempty"`
+	// SendAfter holds the email back until the recipient's delivery window.
+	// Nil sends it on the relay's next run.
+	SendAfter *time.Time `json:"-"`
+}
+
+// triggeredBy returns the principal recorded for email.
+func triggeredBy(ctx context.Context, email *OutboxEmail) Principal {
+	if email.TriggeredBy.Kind == "" {
+		email.TriggeredBy = PrincipalFromContext(ctx)
+	}
+	return email.TriggeredBy
+}
+
+type OutboxStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+func enqueueEmail(ctx context.Context, tx *sql.Tx, cryptor *crypto.Service, email *OutboxEmail) error {
+	encryptedEmail, err := cryptor.EncryptString(email.Email)
+	if err != nil {
+		return err
+	}
+
+	encryptedData, err := cryptor.EncryptString(string(email.Data))
+	if err != nil {
+		return err
+	}
+
+	principal := triggeredBy(ctx, email)
+	var principalID *int64
+	if principal.ID != 0 {
+		principalID = &principal.ID
+	}
+
+	query := `
+		INSERT INTO email_outbox (template, username, email, data, triggered_by_kind, triggered_by_id, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7, NOW()))
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(ctx, query, email.Template, email.Username, encryptedEmail, encryptedData, principal.Kind, principalID, email.SendAfter).Scan(
+		&email.ID,
+		&email.CreatedAt,
+	)
+}
+
+// Enqueue queues an email on its own, for changes that do not need the email
+// to be written atomically with them.
+func (s *OutboxStore) Enqueue(ctx context.Context, email *OutboxEmail) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return enqueueEmail(ctx, tx, s.cryptor, email)
+	})
+}
+
+// ClaimPending returns up to limit emails that are due and pushes their next
+// attempt out by lease, so concurrent relays do not pick up the same rows.
+func (s *OutboxStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET next_attempt_at = NOW() + $2 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE sent_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, template, username, email, data, attempts, COALESCE(last_error, ''), created_at,
+			triggered_by_kind, COALESCE(triggered_by_id, 0)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []OutboxEmail
+	for rows.Next() {
+		var e OutboxEmail
+		var data string
+		if err := rows.Scan(&e.ID, &e.Template, &e.Username, &e.Email, &data, &e.Attempts, &e.LastError, &e.CreatedAt,
+			&e.TriggeredBy.Kind, &e.TriggeredBy.ID); err != nil {
+			return nil, err
+		}
+
+		if e.Email, err = s.cryptor.DecryptString(e.Email); err != nil {
+			return nil, err
+		}
+		if data, err = s.cryptor.DecryptString(data); err != nil {
+			return nil, err
+		}
+		e.Data = json.RawMessage(data)
+
+		emails = append(emails, e)
+	}
+
+	return emails, rows.Err()
+}
+
+func (s *OutboxStore) MarkSent(ctx context.Context, id int64) error {
+	query := `UPDATE email_outbox SET sent_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// SetLintWarnings records the problems found when the email was linted.
+func (s *OutboxStore) SetLintWarnings(ctx context.Context, id int64, warnings []string) error {
+	query := `UPDATE email_outbox SET lint_warnings = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, pq.Array(warnings))
+	return err
+}
+
+// CountAbandoned counts the unsent emails the relay gave up on after at
+// least minAttempts attempts. Suppressed emails are given up on after one
+// attempt, so a minAttempts above one leaves them out.
+func (s *OutboxStore) CountAbandoned(ctx context.Context, minAttempts int) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM email_outbox
+		WHERE sent_at IS NULL AND next_attempt_at IS NULL AND attempts >= $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, minAttempts).Scan(&count)
+	return count, err
+}
+
+// MarkFailed records a failed attempt. A nil retryAt gives up on the email;
+// it stays in the table for inspection. Use DeadLetter for emails that
+// failed every attempt.
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	query := `UPDATE email_outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, lastError, retryAt)
+	return err
+}
+
+// OutboxStats describes the queue: the unsent emails the relay still
+// tries, the dead letters it gave up on, and per template the outcome of
+// the emails queued since a given time, dead letters included.
+type OutboxStats struct {
+	Pending              int                   `json:"pending"`
+	Retrying             int                   `json:"retrying"`
+	OldestPendingSeconds float64               `json:"oldest_pending_seconds"`
+	DeadLetters          int                   `json:"dead_letters"`
+	Templates            []OutboxTemplateStats `json:"templates"`
+}
+
+type OutboxTemplateStats struct {
+	Template       string `json:"template"`
+	Emails         int    `json:"emails"`
+	Sent           int    `json:"sent"`
+	DeadLetters    int    `json:"dead_letters"`
+	Attempts       int    `json:"attempts"`
+	FailedAttempts int    `json:"failed_attempts"`
+}
+
+// Stats counts the queue.
+func (s *OutboxStore) Stats(ctx context.Context, since time.Time) (*OutboxStats, error) {
+	queue := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE attempts > 0),
+			COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(created_at)), 0),
+			(SELECT COUNT(*) FROM email_dead_letters)
+		FROM email_outbox
+		WHERE sent_at IS NULL AND next_attempt_at IS NOT NULL
+	`
+	templates := `
+		SELECT template, COUNT(*), COUNT(sent_at), COUNT(*) FILTER (WHERE dead),
+			COALESCE(SUM(attempts), 0),
+			COALESCE(SUM(attempts), 0) - COUNT(sent_at)
+		FROM (
+			SELECT template, sent_at, attempts, false AS dead FROM email_outbox WHERE created_at >= $1
+			UNION ALL
+			SELECT template, NULL, attempts, true FROM email_dead_letters WHERE queued_at >= $1
+		) e
+		GROUP BY template
+		ORDER BY template
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	stats := &OutboxStats{Templates: []OutboxTemplateStats{}}
+	if err := s.db.QueryRowContext(ctx, queue).Scan(
+		&stats.Pending, &stats.Retrying, &stats.OldestPendingSeconds, &stats.DeadLetters,
+	); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, templates, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t OutboxTemplateStats
+		if err := rows.Scan(&t.Template, &t.Emails, &t.Sent, &t.DeadLetters, &t.Attempts, &t.FailedAttempts); err != nil {
+			return nil, err
+		}
+		stats.Templates = append(stats.Templates, t)
+	}
+	return stats, rows.Err()
+}
+
+// DeadLetter records the last failed attempt of an email the relay gives
+// up on and moves it to the dead letters with the message it would have
+// sent.
+func (s *OutboxStore) DeadLetter(ctx context.Context, id int64, lastError, subject, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return deadLetterEmail(ctx, tx, s.cryptor, id, lastError, subject, body)
+	})
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"strconv"
+)
+
+// Principal kinds recorded on outbox emails.
+const (
+	PrincipalUser   = "user"
+	PrincipalAdmin  = "admin"
+	PrincipalSystem = "system"
+)
+
+// Principal is whoever caused a change: a user acting for themselves, an
+// admin or moderator acting on someone else, or a background job. It lives
+// in store rather than reqctx because stores read it from the context.
+type Principal struct {
+	Kind string `json:"kind"`
+	ID   int64  `json:"id,omitempty"`
+}
+
+func (p Principal) String() string {
+	if p.ID == 0 {
+		return p.Kind
+	}
+	return p.Kind + ":" + strconv.FormatInt(p.ID, 10)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal set with WithPrincipal, or the
+// system principal when there is none.
+func PrincipalFromContext(ctx context.Context) Principal {
+	if p, ok := ctx.Value(principalKey{}).(Principal); ok {
+		return p
+	}
+	return Principal{Kind: PrincipalSystem}
+}
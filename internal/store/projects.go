@@ -35,7 +35,7 @@ func (s *ProjectStore) Create(ctx context.Context, p *Project) error {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	return s.db.QueryRowContext(ctx, query, p.CompanyID, p.Name, p.Description, p.City).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+	return translateError(s.db.QueryRowContext(ctx, query, p.CompanyID, p.Name, p.Description, p.City).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt))
 }
 
 func (s *ProjectStore) ListByCompany(ctx context.Context, companyID int64) ([]Project, error) {
@@ -108,7 +108,7 @@ func (s *ProjectStore) Update(ctx context.Context, p *Project) error {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrNotFound
 		}
-		return err
+		return translateError(err)
 	}
 
 	return nil
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// PushDevice is a phone or browser a user receives push notifications on.
+type PushDevice struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"-"`
+	Platform string `json:"platform"`
+	// Token is the FCM or APNs token, or the Web Push endpoint
+	Token string `json:"token"`
+	// P256dh and Auth are the Web Push subscription keys
+	P256dh string `json:"-"`
+	Auth   string `json:"-"`
+	// Failures counts deliveries given up on since the last one that
+	// went through
+	Failures   int        `json:"failures"`
+	LastError  string     `json:"last_error,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// PushDelivery is one notification queued for one device.
+type PushDelivery struct {
+	ID           int64
+	DeviceID     int64
+	Notification json.RawMessage
+	Attempts     int
+	CreatedAt    time.Time
+	// Device is filled in by ClaimPending
+	Device PushDevice
+}
+
+type PushDeviceStore struct {
+	db *sql.DB
+}
+
+// Register saves the device. A token already registered, possibly by
+// another account signed in on the same device, moves to d.UserID and
+// starts over without failures.
+func (s *PushDeviceStore) Register(ctx context.Context, d *PushDevice) error {
+	query := `
+		INSERT INTO push_devices (user_id, platform, token, p256dh, auth)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (platform, token) DO UPDATE
+		SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth, failures = 0, last_error = ''
+		RETURNING id, failures, last_error, last_used_at, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, d.UserID, d.Platform, d.Token, d.P256dh, d.Auth).
+		Scan(&d.ID, &d.Failures, &d.LastError, &d.LastUsedAt, &d.CreatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// List returns the user's devices, oldest first.
+func (s *PushDeviceStore) List(ctx context.Context, userID int64) ([]PushDevice, error) {
+	query := `
+		SELECT id, user_id, platform, token, p256dh, auth, failures, last_error, last_used_at, created_at
+		FROM push_devices
+		WHERE user_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []PushDevice{}
+	for rows.Next() {
+		var d PushDevice
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Platform, &d.Token, &d.P256dh, &d.Auth, &d.Failures, &d.LastError, &d.LastUsedAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// Delete removes one of the user's devices and its queued deliveries.
+func (s *PushDeviceStore) Delete(ctx context.Context, id, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM push_devices WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Prune removes a device the push service no longer knows or that keeps
+// failing.
+func (s *PushDeviceStore) Prune(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM push_devices WHERE id = $1`, id)
+	return err
+}
+
+// Enqueue queues notification, in JSON, for each of the user's devices.
+func (s *PushDeviceStore) Enqueue(ctx context.Context, userID int64, notification []byte) error {
+	query := `
+		INSERT INTO push_deliveries (device_id, notification)
+		SELECT id, $2 FROM push_devices WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, string(notification))
+	return err
+}
+
+// ClaimPending returns up to limit deliveries that are due and pushes their
+// next attempt out by lease, like WebhookStore.ClaimPending.
+func (s *PushDeviceStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE push_deliveries
+			SET next_attempt_at = NOW() + $2 * interval '1 second'
+			WHERE id IN (
+				SELECT id FROM push_deliveries
+				WHERE delivered_at IS NULL AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, device_id, notification, attempts, created_at
+		)
+		SELECT c.id, c.device_id, c.notification, c.attempts, c.created_at,
+			d.user_id, d.platform, d.token, d.p256dh, d.auth, d.failures
+		FROM claimed c
+		JOIN push_devices d ON d.id = c.device_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []PushDelivery
+	for rows.Next() {
+		var d PushDelivery
+		var notification string
+		if err := rows.Scan(&d.ID, &d.DeviceID, &notification, &d.Attempts, &d.CreatedAt,
+			&d.Device.UserID, &d.Device.Platform, &d.Device.Token, &d.Device.P256dh, &d.Device.Auth, &d.Device.Failures); err != nil {
+			return nil, err
+		}
+		d.Device.ID = d.DeviceID
+		d.Notification = json.RawMessage(notification)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered records the successful attempt and clears the device's
+// failures.
+func (s *PushDeviceStore) MarkDelivered(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var deviceID int64
+		err := tx.QueryRowContext(ctx, `
+			UPDATE push_deliveries
+			SET delivered_at = NOW(), attempts = attempts + 1, last_error = NULL, next_attempt_at = NULL
+			WHERE id = $1
+			RETURNING device_id`, id).Scan(&deviceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the device was deleted while this was in flight
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE push_devices SET failures = 0, last_error = '', last_used_at = NOW() WHERE id = $1`, deviceID)
+		return err
+	})
+}
+
+// MarkFailed records a failed attempt. A nil retryAt gives up on the
+// delivery and counts a failure against the device.
+func (s *PushDeviceStore) MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var deviceID int64
+		err := tx.QueryRowContext(ctx, `
+			UPDATE push_deliveries
+			SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+			WHERE id = $1
+			RETURNING device_id`, id, lastError, retryAt).Scan(&deviceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil || retryAt != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE push_devices SET failures = failures + 1, last_error = $2 WHERE id = $1`, deviceID, lastError)
+		return err
+	})
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// RemoteFollower is an account on another ActivityPub server that follows
+// a company.
+type RemoteFollower struct {
+	CompanyID   int64  `json:"company_id"`
+	ActorID     string `json:"actor_id"`
+	Inbox       string `json:"inbox"`
+	SharedInbox string `json:"shared_inbox,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type RemoteFollowerStore struct {
+	db *sql.DB
+}
+
+// Add saves the follower, or updates its inboxes when it already follows.
+func (s *RemoteFollowerStore) Add(ctx context.Context, f *RemoteFollower) error {
+	query := `
+		INSERT INTO remote_followers (company_id, actor_id, inbox, shared_inbox)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (company_id, actor_id) DO UPDATE
+		SET inbox = EXCLUDED.inbox, shared_inbox = EXCLUDED.shared_inbox
+		RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, f.CompanyID, f.ActorID, f.Inbox, f.SharedInbox).Scan(&f.CreatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// Remove drops the follower, if it follows.
+func (s *RemoteFollowerStore) Remove(ctx context.Context, companyID int64, actorID string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM remote_followers WHERE company_id = $1 AND actor_id = $2`, companyID, actorID)
+	return err
+}
+
+// Count returns how many remote accounts follow the company.
+func (s *RemoteFollowerStore) Count(ctx context.Context, companyID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM remote_followers WHERE company_id = $1`, companyID).Scan(&n)
+	return n, err
+}
+
+// Inboxes returns where to deliver the company's activities: each
+// follower's shared inbox if it has one, else its own, without duplicates.
+func (s *RemoteFollowerStore) Inboxes(ctx context.Context, companyID int64) ([]string, error) {
+	query := `
+		SELECT DISTINCT COALESCE(NULLIF(shared_inbox, ''), inbox)
+		FROM remote_followers
+		WHERE company_id = $1
+		ORDER BY 1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inboxes := []string{}
+	for rows.Next() {
+		var inbox string
+		if err := rows.Scan(&inbox); err != nil {
+			return nil, err
+		}
+		inboxes = append(inboxes, inbox)
+	}
+	return inboxes, rows.Err()
+}
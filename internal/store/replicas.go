@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// Queryer is the read side shared by *sql.DB and *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type replicaReadsKey struct{}
+
+// WithReplicaReads marks ctx as tolerating replication lag, so reads that
+// support it may run on a replica. Everything else reads from the primary,
+// which keeps writes immediately visible to the request that made them.
+func WithReplicaReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaReadsKey{}, true)
+}
+
+// WithPrimaryReads undoes WithReplicaReads for reads whose result outlives
+// the request, e.g. values that are cached.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaReadsKey{}, false)
+}
+
+func replicaReadsAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(replicaReadsKey{}).(bool)
+	return allowed
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+	// lag is the replay delay seen by the last check, -1 when it failed
+	lag atomic.Int64
+}
+
+// ReplicaStatus is the state of one replica as of the last lag check.
+// LagMs is -1 when the replica could not be checked.
+type ReplicaStatus struct {
+	Healthy bool  `json:"healthy"`
+	LagMs   int64 `json:"lag_ms"`
+}
+
+// QueryerChooser picks the connection a read runs on: the primary, or for
+// contexts marked with WithReplicaReads one of the replicas, round robin.
+// Replicas start out of rotation and are only used once a check has seen
+// them reachable and at most maxLag behind the primary.
+type QueryerChooser struct {
+	primary  *sql.DB
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+func NewQueryerChooser(primary *sql.DB, replicas []*sql.DB, maxLag time.Duration) *QueryerChooser {
+	c := &QueryerChooser{primary: primary, maxLag: maxLag}
+	for _, db := range replicas {
+		r := &replica{db: db}
+		r.lag.Store(-1)
+		c.replicas = append(c.replicas, r)
+	}
+	return c
+}
+
+// Primary returns the connection for writes and consistent reads.
+func (c *QueryerChooser) Primary() *sql.DB {
+	return c.primary
+}
+
+// Reader returns the connection a read in ctx should use, falling back to
+// the primary when replica reads are not allowed or no replica is healthy.
+func (c *QueryerChooser) Reader(ctx context.Context) Queryer {
+	if len(c.replicas) == 0 || !replicaReadsAllowed(ctx) {
+		return c.primary
+	}
+
+	start := c.next.Add(1)
+	for i := range c.replicas {
+		r := c.replicas[(start+uint64(i))%uint64(len(c.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return c.primary
+}
+
+// replicationLagQuery is 0 on a replica that has replayed everything it
+// received, so an idle primary does not make its replicas look stale.
+const replicationLagQuery = `
+	SELECT CASE
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END
+`
+
+// CheckLag measures every replica and takes those that are unreachable or
+// more than maxLag behind out of rotation until a later check passes.
+func (c *QueryerChooser) CheckLag(ctx context.Context) {
+	for _, r := range c.replicas {
+		qctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		var seconds float64
+		err := r.db.QueryRowContext(qctx, replicationLagQuery).Scan(&seconds)
+		cancel()
+
+		if err != nil {
+			r.lag.Store(-1)
+			r.healthy.Store(false)
+			continue
+		}
+		lag := time.Duration(seconds * float64(time.Second))
+		r.lag.Store(int64(lag))
+		r.healthy.Store(lag <= c.maxLag)
+	}
+}
+
+// Run checks the replicas right away and then every interval until ctx is
+// cancelled.
+func (c *QueryerChooser) Run(ctx context.Context, interval time.Duration) {
+	c.CheckLag(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.CheckLag(ctx)
+		}
+	}
+}
+
+// Status reports each replica in configuration order.
+func (c *QueryerChooser) Status() []ReplicaStatus {
+	status := make([]ReplicaStatus, len(c.replicas))
+	for i, r := range c.replicas {
+		status[i] = ReplicaStatus{Healthy: r.healthy.Load(), LagMs: -1}
+		if lag := time.Duration(r.lag.Load()); lag >= 0 {
+			status[i].LagMs = lag.Milliseconds()
+		}
+	}
+	return status
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestQueryerChooser(t *testing.T) {
+	primary, a, b := new(sql.DB), new(sql.DB), new(sql.DB)
+	c := NewQueryerChooser(primary, []*sql.DB{a, b}, time.Second)
+	replicaCtx := WithReplicaReads(context.Background())
+
+	if c.Reader(replicaCtx) != primary {
+		t.Error("replicas should stay out of rotation until checked")
+	}
+
+	c.replicas[0].healthy.Store(true)
+	c.replicas[1].healthy.Store(true)
+	seen := map[Queryer]bool{}
+	for range 4 {
+		seen[c.Reader(replicaCtx)] = true
+	}
+	if !seen[a] || !seen[b] || seen[primary] {
+		t.Errorf("reads should alternate between healthy replicas, got %v", seen)
+	}
+
+	if c.Reader(context.Background()) != primary {
+		t.Error("unmarked reads should use the primary")
+	}
+	if c.Reader(WithPrimaryReads(replicaCtx)) != primary {
+		t.Error("WithPrimaryReads should force the primary")
+	}
+
+	c.replicas[0].healthy.Store(false)
+	for range 3 {
+		if got := c.Reader(replicaCtx); got != b {
+			t.Fatal("lagging replica should be skipped")
+		}
+	}
+
+	c.replicas[1].healthy.Store(false)
+	if c.Reader(replicaCtx) != primary {
+		t.Error("should fall back to the primary when no replica is healthy")
+	}
+}
@@ -3,6 +3,9 @@ package store
 import (
 	"context"
 	"database/sql"
+	"sort"
+
+	"github.com/lib/pq"
 )
 
 type Role struct {
@@ -10,6 +13,32 @@ type Role struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Level       int    `json:"level"`
+	// Permissions is only loaded by List and Create
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// Permission describes one of Permissions for the admin UI.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions lists every permission a role can be granted.
+var Permissions = []Permission{
+	{PermissionListingsWrite, "Create, edit and delete the company's listings"},
+	{PermissionComplaintsReview, "See the moderation queue"},
+	{PermissionComplaintsResolve, "Dismiss complaints and take down reported content"},
+	{PermissionUsersMute, "Mute and unmute users"},
+}
+
+// IsPermission reports whether name is one of Permissions.
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 type RoleStore struct {
@@ -19,6 +48,9 @@ type RoleStore struct {
 func (s *RoleStore) GetByName(ctx context.Context, slug string) (*Role, error) {
 	query := `SELECT id, name, description, level FROM roles WHERE name = $1`
 
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
 	role := &Role{}
 	err := s.db.QueryRowContext(ctx, query, slug).Scan(&role.ID, &role.Name, &role.Description, &role.Level)
 	if err != nil {
@@ -27,3 +59,124 @@ func (s *RoleStore) GetByName(ctx context.Context, slug string) (*Role, error) {
 
 	return role, nil
 }
+
+// List returns every role with its permissions, lowest level first.
+func (s *RoleStore) List(ctx context.Context) ([]Role, error) {
+	query := `
+		SELECT r.id, r.name, COALESCE(r.description, ''), r.level,
+			COALESCE(array_agg(p.permission ORDER BY p.permission) FILTER (WHERE p.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions p ON p.role_id = r.id
+		GROUP BY r.id
+		ORDER BY r.level, r.id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		var permissions pq.StringArray
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Level, &permissions); err != nil {
+			return nil, err
+		}
+		role.Permissions = permissions
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// Create adds a role with role.Permissions. A taken name is ErrConflict.
+func (s *RoleStore) Create(ctx context.Context, role *Role) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO roles (name, description, level) VALUES ($1, $2, $3) RETURNING id`
+		if err := tx.QueryRowContext(ctx, query, role.Name, role.Description, role.Level).Scan(&role.ID); err != nil {
+			return err
+		}
+		role.Permissions = normalizePermissions(role.Permissions)
+		return insertRolePermissions(ctx, tx, role.ID, role.Permissions)
+	})
+}
+
+// SetPermissions replaces the permissions of the role.
+func (s *RoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var id int64
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM roles WHERE id = $1 FOR UPDATE`, roleID).Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+			return err
+		}
+		return insertRolePermissions(ctx, tx, roleID, normalizePermissions(permissions))
+	})
+}
+
+// PermissionsByRole maps role names to their permissions.
+func (s *RoleStore) PermissionsByRole(ctx context.Context) (map[string][]string, error) {
+	query := `
+		SELECT r.name, p.permission
+		FROM role_permissions p
+		JOIN roles r ON r.id = p.role_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byRole := map[string][]string{}
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, err
+		}
+		byRole[role] = append(byRole[role], permission)
+	}
+
+	return byRole, rows.Err()
+}
+
+func insertRolePermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO role_permissions (role_id, permission)
+		SELECT $1, unnest($2::varchar[])`
+	_, err := tx.ExecContext(ctx, query, roleID, pq.Array(permissions))
+	return err
+}
+
+// normalizePermissions sorts permissions and drops duplicates.
+func normalizePermissions(permissions []string) []string {
+	seen := make(map[string]bool, len(permissions))
+	out := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
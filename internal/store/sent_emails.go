@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+)
+
+// SentEmail is a message the mail provider accepted, so support can answer
+// whether an email actually went out and look it up in the provider's logs
+// by MessageID.
+type SentEmail struct {
+	ID int64 `json:"id"`
+	// OutboxID is the outbox email that was sent, nil for emails sent
+	// without the outbox or whose outbox row is gone
+	OutboxID  *int64 `json:"outbox_id,omitempty"`
+	Template  string `json:"template"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Provider  string `json:"provider"`
+	MessageID string `json:"message_id,omitempty"`
+	// Accepted lists the recipients the provider took the message for
+	Accepted []string `json:"accepted"`
+	SentAt   string   `json:"sent_at"`
+}
+
+type SentEmailStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+func (s *SentEmailStore) Create(ctx context.Context, sent *SentEmail) error {
+	encryptedEmail, err := s.cryptor.EncryptString(sent.Email)
+	if err != nil {
+		return err
+	}
+	accepted, err := json.Marshal(sent.Accepted)
+	if err != nil {
+		return err
+	}
+	encryptedAccepted, err := s.cryptor.EncryptString(string(accepted))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO sent_emails (outbox_id, template, username, email, email_hash, provider, message_id, accepted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, sent_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, sent.OutboxID, sent.Template, sent.Username, encryptedEmail,
+		crypto.HashEmail(sent.Email), sent.Provider, sent.MessageID, encryptedAccepted).Scan(&sent.ID, &sent.SentAt)
+}
+
+// ListByEmail returns the emails sent to email, newest first.
+func (s *SentEmailStore) ListByEmail(ctx context.Context, email string, fq PaginatedQuery) ([]SentEmail, error) {
+	if fq.Limit <= 0 {
+		fq.Limit = 20
+	}
+	if fq.Offset < 0 {
+		fq.Offset = 0
+	}
+
+	query := `
+		SELECT id, outbox_id, template, username, email, provider, message_id, accepted, sent_at
+		FROM sent_emails
+		WHERE email_hash = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, crypto.HashEmail(email), fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sent := []SentEmail{}
+	for rows.Next() {
+		var e SentEmail
+		var accepted string
+		if err := rows.Scan(&e.ID, &e.OutboxID, &e.Template, &e.Username, &e.Email, &e.Provider, &e.MessageID, &accepted, &e.SentAt); err != nil {
+			return nil, err
+		}
+
+		if e.Email, err = s.cryptor.DecryptString(e.Email); err != nil {
+			return nil, err
+		}
+		if accepted, err = s.cryptor.DecryptString(accepted); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(accepted), &e.Accepted); err != nil {
+			return nil, err
+		}
+
+		sent = append(sent, e)
+	}
+
+	return sent, rows.Err()
+}
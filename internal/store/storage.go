@@ -3,15 +3,22 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/jobs"
 )
 
 var (
 	ErrNotFound          = errors.New("resource not found")
 	ErrConflict          = errors.New("resource already exists")
+	ErrForeignKey        = errors.New("referenced resource does not exist")
+	ErrForeignKeyUser    = missingReference("referenced user does not exist")
+	ErrForeignKeyListing = missingReference("referenced listing does not exist")
+	ErrReferenced        = conflict("resource is still referenced")
+	ErrCheckViolation    = errors.New("value is not allowed")
 	QueryTimeoutDuration = time.Second * 5
 )
 
@@ -19,22 +26,44 @@ type Storage struct {
 	Users interface {
 		GetByID(context.Context, int64) (*User, error)
 		GetByEmail(context.Context, string) (*User, error)
+		GetByUsername(context.Context, string) (*User, error)
+		GetByIdentifier(context.Context, string) (*User, error)
 		Create(context.Context, *sql.Tx, *User) error
-		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error
-		CreateCompanyAndUser(ctx context.Context, company *Company, user *User, token string, exp time.Duration) error
-		Activate(context.Context, string) error
+		CreateActive(context.Context, *User) error
+		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error
+		CreateCompanyAndUser(ctx context.Context, company *Company, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error
+		Reinvite(ctx context.Context, user *User, token string, exp time.Duration, welcome func(*User) (*OutboxEmail, error)) error
+		Activate(ctx context.Context, hashes []string) (*User, error)
 		Delete(context.Context, int64) error
 		UpdateProfile(ctx context.Context, userID int64, firstName, lastName, phone string) error
+		UpdateLocalization(ctx context.Context, userID int64, locale, region, timezone *string) error
+		UpdateUsername(ctx context.Context, userID int64, username string) error
+		SetPrivate(ctx context.Context, userID int64, private bool) error
 		UpdatePassword(ctx context.Context, userID int64, hashedPassword []byte) error
 		List(ctx context.Context, fq PaginatedQuery) ([]User, error)
-		UpdateStatus(ctx context.Context, userID int64, isActive bool) error
+		Count(ctx context.Context, fq PaginatedQuery) (int, error)
+		Transition(ctx context.Context, userID int64, to string, actorID *int64, reason string) error
+		StateHistory(ctx context.Context, userID int64) ([]UserStateEvent, error)
 		UpdateRole(ctx context.Context, userID int64, roleID int64) error
+		SetMuted(ctx context.Context, userID int64, muted bool) error
+		HideMessages(ctx context.Context, userID int64) (int64, error)
+		TakenUsernames(ctx context.Context, candidates []string) (map[string]bool, error)
+		NormalizeCountries(ctx context.Context, normalize func(string) (string, bool)) (updated int64, unknown []string, err error)
+		MatchEmailHashes(ctx context.Context, hashes []string, excludeUserID int64) ([]ContactMatch, error)
+		MatchUsernames(ctx context.Context, usernames []string, excludeUserID int64) ([]ContactMatch, error)
+		PublicProfiles(ctx context.Context, ids []int64, viewerID int64, staff bool) ([]PublicProfile, error)
 	}
 	LoginEvents interface {
 		Create(ctx context.Context, event *LoginEvent) error
+		History(ctx context.Context, userID int64, country, device string) (*LoginHistory, error)
+		ListSuccessful(ctx context.Context, userID int64, fq PaginatedQuery) ([]LoginEvent, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
+		List(context.Context) ([]Role, error)
+		Create(context.Context, *Role) error
+		SetPermissions(ctx context.Context, roleID int64, permissions []string) error
+		PermissionsByRole(context.Context) (map[string][]string, error)
 	}
 	Companies interface {
 		Create(context.Context, *sql.Tx, *Company) error
@@ -56,10 +85,16 @@ type Storage struct {
 		GetMediaByID(ctx context.Context, listingID, mediaID int64) (*ListingMedia, error)
 		DeleteMedia(ctx context.Context, listingID, mediaID int64) error
 		UpdateStatus(ctx context.Context, id int64, status string) error
+		PublishDue(ctx context.Context) ([]int64, error)
 		Update(ctx context.Context, listing *Listing) error
 		Delete(ctx context.Context, id int64) error
+		Restore(ctx context.Context, id, companyID int64, since time.Time) error
+		PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 		GetByID(ctx context.Context, id int64) (*Listing, error)
 		List(ctx context.Context, filter ListingFilter) ([]Listing, error)
+		Versions(ctx context.Context, listingID int64) ([]ListingVersion, error)
+		Pin(ctx context.Context, listingID int64) error
+		Unpin(ctx context.Context, listingID int64) error
 	}
 	Applications interface {
 		Create(ctx context.Context, app *Application) error
@@ -70,13 +105,16 @@ type Storage struct {
 	}
 	Messages interface {
 		Create(ctx context.Context, msg *ApplicationMessage) error
-		List(ctx context.Context, applicationID int64, limit, offset int) ([]ApplicationMessage, error)
+		List(ctx context.Context, applicationID, viewerID int64, limit, offset int) ([]ApplicationMessage, error)
+		Release(ctx context.Context, id int64) error
 	}
 	Favorites interface {
 		Add(ctx context.Context, userID, listingID int64) error
 		Remove(ctx context.Context, userID, listingID int64) error
 		ListByUser(ctx context.Context, userID int64) ([]FavoriteListing, error)
+		Each(ctx context.Context, userID int64, fn func(FavoriteListing) error) error
 		Count(ctx context.Context, userID int64) (int, error)
+		Stats(ctx context.Context, userID int64, listingIDs []int64) (map[int64]FavoriteStats, error)
 	}
 	Dashboard interface {
 		GetOverview(ctx context.Context, userID int64) (*DashboardOverview, error)
@@ -87,6 +125,8 @@ type Storage struct {
 		GetByID(ctx context.Context, id int64) (*Complaint, error)
 		List(ctx context.Context, filter ComplaintFilter) ([]Complaint, error)
 		UpdateStatus(ctx context.Context, id int64, status string) error
+		Resolve(ctx context.Context, id int64, resolution string, resolvedBy int64) error
+		Reopen(ctx context.Context, id int64, status string) error
 	}
 	AdminActions interface {
 		Create(ctx context.Context, action *AdminAction) error
@@ -101,16 +141,211 @@ type Storage struct {
 		GetByToken(ctx context.Context, token string) (*RegistrationInvite, error)
 		MarkUsed(ctx context.Context, id int64) error
 	}
+	InviteCodes interface {
+		Create(ctx context.Context, code *InviteCode) error
+		CreateForUser(ctx context.Context, userID int64, code *InviteCode, quota int) error
+		Reserve(ctx context.Context, code string) (*InviteCode, error)
+		Release(ctx context.Context, id int64) error
+		Redeem(ctx context.Context, id, userID int64) error
+		Revoke(ctx context.Context, code string) (*InviteCode, error)
+		List(ctx context.Context, fq PaginatedQuery) ([]InviteCode, error)
+		ListByCreator(ctx context.Context, userID int64) ([]InviteCode, error)
+	}
+	Teams interface {
+		Invite(ctx context.Context, invite *RegistrationInvite, email *OutboxEmail) error
+		Join(ctx context.Context, invite *RegistrationInvite, userID int64) error
+		Members(ctx context.Context, companyID int64) ([]TeamMember, error)
+		Role(ctx context.Context, companyID, userID int64) (string, error)
+		SetRole(ctx context.Context, companyID, userID int64, role string) error
+		Remove(ctx context.Context, companyID, userID int64) error
+	}
+	Webhooks interface {
+		Create(ctx context.Context, hook *Webhook) error
+		GetByID(ctx context.Context, id int64) (*Webhook, error)
+		List(ctx context.Context, companyID *int64) ([]Webhook, error)
+		Delete(ctx context.Context, id int64) error
+		Enqueue(ctx context.Context, event string, companyID *int64, payload json.RawMessage) error
+		ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error)
+		MarkDelivered(ctx context.Context, id int64, status int) error
+		MarkFailed(ctx context.Context, id int64, status int, lastError string, retryAt *time.Time) error
+		ListDeliveries(ctx context.Context, webhookID int64, fq PaginatedQuery) ([]WebhookDelivery, error)
+	}
+	LinkPreviews interface {
+		Queue(ctx context.Context, urls []string, refreshAfter time.Duration) error
+		ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PendingLinkPreview, error)
+		Save(ctx context.Context, preview *LinkPreview) error
+		MarkFailed(ctx context.Context, url, lastError string, retryAt *time.Time) error
+		Get(ctx context.Context, urls []string) (map[string]LinkPreview, error)
+	}
+	Tenants interface {
+		Create(ctx context.Context, tenant *Tenant) error
+		GetBySlug(ctx context.Context, slug string) (*Tenant, error)
+		List(ctx context.Context) ([]Tenant, error)
+	}
+	ContentFlags interface {
+		Create(ctx context.Context, flag *ContentFlag) error
+		GetByID(ctx context.Context, id int64) (*ContentFlag, error)
+		List(ctx context.Context, status string, fq PaginatedQuery) ([]ContentFlag, error)
+		Resolve(ctx context.Context, id int64, status string, moderatorID int64) error
+	}
+	EmailChanges interface {
+		Create(ctx context.Context, change *EmailChange, oldToken, newToken string, notifications []*OutboxEmail) error
+		GetByUserID(ctx context.Context, userID int64) (*EmailChange, error)
+		Confirm(ctx context.Context, hashes []string) (*EmailChange, error)
+		Delete(ctx context.Context, userID int64) error
+	}
+	Usage interface {
+		GetAccountUsage(ctx context.Context, userID int64, since time.Time) (*AccountUsage, error)
+		MediaBytes(ctx context.Context, userID int64) (int64, error)
+	}
+	MagicLinks interface {
+		Create(ctx context.Context, userID int64, token string, expiry time.Time, email *OutboxEmail) error
+		Consume(ctx context.Context, hashes []string) (int64, error)
+	}
+	Outbox interface {
+		Enqueue(ctx context.Context, email *OutboxEmail) error
+		ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]OutboxEmail, error)
+		MarkSent(ctx context.Context, id int64) error
+		MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error
+		SetLintWarnings(ctx context.Context, id int64, warnings []string) error
+		CountAbandoned(ctx context.Context, minAttempts int) (int, error)
+		Stats(ctx context.Context, since time.Time) (*OutboxStats, error)
+		DeadLetter(ctx context.Context, id int64, lastError, subject, body string) error
+	}
+	DeadLetters interface {
+		List(ctx context.Context, fq PaginatedQuery) ([]DeadLetter, error)
+		GetByID(ctx context.Context, id int64) (*DeadLetter, error)
+		Retry(ctx context.Context, id int64) (*OutboxEmail, error)
+		Discard(ctx context.Context, id int64) error
+		Count(ctx context.Context) (int, error)
+	}
+	SentEmails interface {
+		Create(ctx context.Context, sent *SentEmail) error
+		ListByEmail(ctx context.Context, email string, fq PaginatedQuery) ([]SentEmail, error)
+	}
+	EmailTracking interface {
+		Record(ctx context.Context, event *TrackingEvent) error
+		Stats(ctx context.Context, since time.Time) ([]TrackingStats, error)
+		SetOptOut(ctx context.Context, userID int64, optOut bool) error
+		OptedOut(ctx context.Context, email string) (bool, error)
+	}
+	Broadcasts interface {
+		Create(ctx context.Context, b *Broadcast) error
+		GetByID(ctx context.Context, id int64) (*Broadcast, error)
+		List(ctx context.Context, fq PaginatedQuery) ([]Broadcast, error)
+		Claim(ctx context.Context, lease time.Duration) (*Broadcast, error)
+		Recipients(ctx context.Context, b *Broadcast, limit int) ([]BroadcastRecipient, error)
+		Advance(ctx context.Context, id, lastUserID int64, sent, failed, skipped int, done bool) error
+		SetStatus(ctx context.Context, id int64, from, to string) error
+	}
+	Suppressions interface {
+		Add(ctx context.Context, suppression *EmailSuppression) error
+		IsSuppressed(ctx context.Context, email string, transactional bool) (bool, error)
+		List(ctx context.Context, fq PaginatedQuery) ([]EmailSuppression, error)
+		Delete(ctx context.Context, email string) error
+	}
+	Conversations interface {
+		Open(ctx context.Context, userID, otherID int64) (*Conversation, error)
+		Get(ctx context.Context, id, userID int64) (*Conversation, error)
+		List(ctx context.Context, userID int64, fq PaginatedQuery) ([]Conversation, error)
+		CreateMessage(ctx context.Context, msg *DirectMessage) error
+		ListMessages(ctx context.Context, conversationID, viewerID, before int64, limit int) ([]DirectMessage, error)
+		MarkRead(ctx context.Context, conversationID, userID, messageID int64) error
+		UnreadCount(ctx context.Context, userID int64) (int, error)
+		Exists(ctx context.Context, userID, otherID int64) (bool, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID, blockedID int64) error
+		Unblock(ctx context.Context, blockerID, blockedID int64) error
+		Blocked(ctx context.Context, blockerID, blockedID int64) (bool, error)
+		Between(ctx context.Context, userID, otherID int64) (bool, error)
+		List(ctx context.Context, blockerID int64, fq PaginatedQuery) ([]BlockedUser, error)
+	}
+	Mentions interface {
+		Create(ctx context.Context, messageID int64, userIDs []int64) ([]int64, error)
+		ListByUser(ctx context.Context, userID int64, fq PaginatedQuery) ([]Mention, error)
+	}
+	Tags interface {
+		Set(ctx context.Context, listingID int64, tags []string) error
+		Trending(ctx context.Context, since time.Time, region string, limit int) ([]TagCount, error)
+	}
+	DeliveryWindows interface {
+		Get(ctx context.Context, userID int64) (*DeliveryWindow, error)
+		Set(ctx context.Context, userID int64, window *DeliveryWindow) error
+		Delete(ctx context.Context, userID int64) error
+	}
+	Views interface {
+		Add(ctx context.Context, counts []ViewCount) error
+		ProfileDaily(ctx context.Context, userID int64, since time.Time) ([]DailyViews, error)
+		CompanyListings(ctx context.Context, companyID int64, since time.Time) ([]ListingViews, error)
+	}
+	ListingEvents interface {
+		Create(ctx context.Context, event *ListingEvent) error
+		GetByID(ctx context.Context, id int64) (*ListingEvent, error)
+		Update(ctx context.Context, event *ListingEvent) error
+		Delete(ctx context.Context, id int64) error
+		List(ctx context.Context, filter ListingEventFilter) ([]ListingEvent, error)
+	}
+	ContactImports interface {
+		Create(ctx context.Context, imp *ContactImport) error
+		Complete(ctx context.Context, imp *ContactImport) error
+		GetByID(ctx context.Context, id, userID int64) (*ContactImport, error)
+	}
+	ModerationJobs interface {
+		Create(ctx context.Context, job *ModerationJob) error
+		Progress(ctx context.Context, job *ModerationJob) error
+		GetByID(ctx context.Context, id int64) (*ModerationJob, error)
+	}
+	// Jobs is the queue of internal/jobs; it satisfies jobs.Store.
+	Jobs interface {
+		Enqueue(ctx context.Context, job *jobs.Job) error
+		Claim(ctx context.Context, kinds []string, limit int) ([]jobs.Job, error)
+		Succeed(ctx context.Context, id int64) error
+		Fail(ctx context.Context, id int64, msg string, retryAt *time.Time) error
+		Requeue(ctx context.Context, startedBefore time.Time) (int64, error)
+		List(ctx context.Context, filter JobFilter) ([]jobs.Job, error)
+		GetByID(ctx context.Context, id int64) (*jobs.Job, error)
+		Retry(ctx context.Context, id int64) (*jobs.Job, error)
+		Prune(ctx context.Context, before time.Time) (int64, error)
+	}
+	RemoteFollowers interface {
+		Add(ctx context.Context, f *RemoteFollower) error
+		Remove(ctx context.Context, companyID int64, actorID string) error
+		Count(ctx context.Context, companyID int64) (int, error)
+		Inboxes(ctx context.Context, companyID int64) ([]string, error)
+	}
+	PushDevices interface {
+		Register(ctx context.Context, d *PushDevice) error
+		List(ctx context.Context, userID int64) ([]PushDevice, error)
+		Delete(ctx context.Context, id, userID int64) error
+		Prune(ctx context.Context, id int64) error
+		Enqueue(ctx context.Context, userID int64, notification []byte) error
+		ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]PushDelivery, error)
+		MarkDelivered(ctx context.Context, id int64) error
+		MarkFailed(ctx context.Context, id int64, lastError string, retryAt *time.Time) error
+	}
+	BannedWords interface {
+		Add(ctx context.Context, w *BannedWord) error
+		List(ctx context.Context) ([]BannedWord, error)
+		Delete(ctx context.Context, id int64) error
+	}
 }
 
 func NewStorage(db *sql.DB, cryptor *crypto.Service) Storage {
+	return NewReplicatedStorage(NewQueryerChooser(db, nil, 0), cryptor)
+}
+
+// NewReplicatedStorage is NewStorage with listing search and profile reads
+// routed through reads, see WithReplicaReads.
+func NewReplicatedStorage(reads *QueryerChooser, cryptor *crypto.Service) Storage {
+	db := reads.Primary()
 	return Storage{
-		Users:        &UserStore{db: db, cryptor: cryptor},
+		Users:        &UserStore{db: db, reads: reads, cryptor: cryptor},
 		LoginEvents:  &LoginEventStore{db: db},
 		Roles:        &RoleStore{db},
 		Companies:    &CompanyStore{db: db, cryptor: cryptor},
 		Projects:     &ProjectStore{db: db},
-		Listings:     &ListingStore{db: db},
+		Listings:     &ListingStore{db: db, reads: reads},
 		Applications: &ApplicationStore{db: db, cryptor: cryptor},
 		Messages:     &MessageStore{db: db},
 		Favorites:    &FavoriteStore{db: db},
@@ -119,6 +354,35 @@ func NewStorage(db *sql.DB, cryptor *crypto.Service) Storage {
 		AdminActions: &AdminActionStore{db: db},
 		AdminStats:   &AdminStatsStore{db: db},
 		Invites:      &InviteStore{db: db},
+		EmailChanges: &EmailChangeStore{db: db, cryptor: cryptor},
+		Outbox:       &OutboxStore{db: db, cryptor: cryptor},
+		SentEmails:   &SentEmailStore{db: db, cryptor: cryptor},
+		MagicLinks:   &MagicLinkStore{db: db, cryptor: cryptor},
+		Usage:        &UsageStore{db: db},
+		Suppressions: &SuppressionStore{db: db},
+
+		EmailTracking:   &EmailTrackingStore{db: db},
+		Broadcasts:      &BroadcastStore{db: db, cryptor: cryptor},
+		DeliveryWindows: &DeliveryWindowStore{db: db},
+		Views:           &ViewStore{db: db},
+		DeadLetters:     &DeadLetterStore{db: db, cryptor: cryptor},
+		Tags:            &TagStore{db: db, reads: reads},
+		Mentions:        &MentionStore{db: db},
+		Conversations:   &ConversationStore{db: db},
+		Blocks:          &BlockStore{db: db},
+		InviteCodes:     &InviteCodeStore{db: db},
+		Teams:           &TeamStore{db: db, cryptor: cryptor},
+		Webhooks:        &WebhookStore{db: db, cryptor: cryptor},
+		LinkPreviews:    &LinkPreviewStore{db: db},
+		ContentFlags:    &ContentFlagStore{db: db},
+		Tenants:         &TenantStore{db: db},
+		ListingEvents:   &ListingEventStore{db: db},
+		ContactImports:  &ContactImportStore{db: db},
+		ModerationJobs:  &ModerationJobStore{db: db},
+		Jobs:            &JobStore{db: db},
+		RemoteFollowers: &RemoteFollowerStore{db: db},
+		PushDevices:     &PushDeviceStore{db: db},
+		BannedWords:     &BannedWordStore{db: db},
 	}
 }
 
@@ -130,7 +394,7 @@ func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
 
 	if err := fn(tx); err != nil {
 		_ = tx.Rollback()
-		return err
+		return translateError(err)
 	}
 
 	return tx.Commit()
@@ -0,0 +1,126 @@
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+)
+
+// Password is the password of every user the Factory creates.
+const Password = "Factory-pass-1!"
+
+// Factory creates valid rows through the store, with unique emails, phones
+// and names, so tests only spell out the fields they care about. Options
+// run before the row is inserted. Any error fails the test.
+type Factory struct {
+	t     testing.TB
+	store store.Storage
+	seq   atomic.Int64
+}
+
+func (f *Factory) next() int64 {
+	return f.seq.Add(1)
+}
+
+// User creates an active user with the "user" role.
+func (f *Factory) User(opts ...func(*store.User)) *store.User {
+	f.t.Helper()
+
+	n := f.next()
+	user := &store.User{
+		Username:  fmt.Sprintf("user%d", n),
+		FirstName: "Test",
+		LastName:  fmt.Sprintf("User %d", n),
+		Email:     fmt.Sprintf("user%d@example.com", n),
+		Phone:     fmt.Sprintf("+7700%07d", n),
+		Country:   "KZ",
+	}
+	if err := user.Password.Set(Password); err != nil {
+		f.t.Fatal(err)
+	}
+	for _, opt := range opts {
+		opt(user)
+	}
+
+	if err := f.store.Users.CreateActive(context.Background(), user); err != nil {
+		f.t.Fatalf("storetest: create user: %v", err)
+	}
+	return user
+}
+
+// Company creates an agency together with its first agent, who is
+// returned as well and stays pending like after a real registration.
+func (f *Factory) Company(opts ...func(*store.Company)) (*store.Company, *store.User) {
+	f.t.Helper()
+
+	n := f.next()
+	company := &store.Company{
+		Name:               fmt.Sprintf("Agency %d", n),
+		RegistrationNumber: fmt.Sprintf("REG-%06d", n),
+		City:               "Almaty",
+		Country:            "KZ",
+		Email:              fmt.Sprintf("agency%d@example.com", n),
+		Phone:              fmt.Sprintf("+7701%07d", n),
+		Type:               "agency",
+	}
+	for _, opt := range opts {
+		opt(company)
+	}
+
+	agent := &store.User{
+		Username:  fmt.Sprintf("agent%d", n),
+		FirstName: "Agent",
+		LastName:  fmt.Sprintf("%d", n),
+		Email:     fmt.Sprintf("agent%d@example.com", n),
+		Phone:     fmt.Sprintf("+7702%07d", n),
+		Country:   "KZ",
+		Role:      store.Role{Name: "agency"},
+	}
+	if err := agent.Password.Set(Password); err != nil {
+		f.t.Fatal(err)
+	}
+
+	token := fmt.Sprintf("invite-%d", n)
+	if err := f.store.Users.CreateCompanyAndUser(context.Background(), company, agent, token, 0, nil); err != nil {
+		f.t.Fatalf("storetest: create company: %v", err)
+	}
+	return company, agent
+}
+
+// Listing creates an active apartment for sale by companyID.
+func (f *Factory) Listing(companyID int64, opts ...func(*store.Listing)) *store.Listing {
+	f.t.Helper()
+
+	n := f.next()
+	listing := &store.Listing{
+		CompanyID:    companyID,
+		Title:        fmt.Sprintf("Apartment %d", n),
+		Description:  "Bright apartment close to the park",
+		PropertyType: "apartment",
+		DealType:     "sale",
+		Status:       store.ListingStatusActive,
+		Price:        50_000_000 + n,
+		City:         "Almaty",
+		Address:      fmt.Sprintf("%d Abay Ave", n),
+	}
+	for _, opt := range opts {
+		opt(listing)
+	}
+
+	if err := f.store.Listings.Create(context.Background(), listing, nil, nil); err != nil {
+		f.t.Fatalf("storetest: create listing: %v", err)
+	}
+	return listing
+}
+
+// Block makes blocker block blocked.
+func (f *Factory) Block(blocker, blocked *store.User) {
+	f.t.Helper()
+
+	if err := f.store.Blocks.Block(context.Background(), blocker.ID, blocked.ID); err != nil {
+		f.t.Fatalf("storetest: block: %v", err)
+	}
+}
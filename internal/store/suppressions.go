@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Reasons an address is suppressed.
+const (
+	SuppressionBounce      = "bounce"
+	SuppressionComplaint   = "complaint"
+	SuppressionUnsubscribe = "unsubscribe"
+	SuppressionManual      = "manual"
+)
+
+// EmailSuppression marks an address that must not be emailed again, for
+// example after a permanent bounce reported by the mail provider.
+type EmailSuppression struct {
+	Email     string `json:"email"`
+	Reason    string `json:"reason"`
+	Source    string `json:"source"`
+	Detail    string `json:"detail,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type SuppressionStore struct {
+	db *sql.DB
+}
+
+// Add records the suppression. An address that is already suppressed keeps
+// its original entry.
+func (s *SuppressionStore) Add(ctx context.Context, suppression *EmailSuppression) error {
+	query := `
+		INSERT INTO email_suppressions (email, reason, source, detail)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (email) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, suppression.Email, suppression.Reason, suppression.Source, suppression.Detail)
+	return err
+}
+
+// IsSuppressed reports whether email must not be sent mail. Unsubscribes do
+// not suppress transactional mail.
+func (s *SuppressionStore) IsSuppressed(ctx context.Context, email string, transactional bool) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM email_suppressions
+			WHERE email = $1 AND (NOT $2 OR reason <> $3)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var suppressed bool
+	err := s.db.QueryRowContext(ctx, query, email, transactional, SuppressionUnsubscribe).Scan(&suppressed)
+	return suppressed, err
+}
+
+// List returns suppressions, newest first. A non-empty fq.Search limits the
+// result to that reason.
+func (s *SuppressionStore) List(ctx context.Context, fq PaginatedQuery) ([]EmailSuppression, error) {
+	if fq.Limit <= 0 {
+		fq.Limit = 20
+	}
+	if fq.Offset < 0 {
+		fq.Offset = 0
+	}
+
+	query := `
+		SELECT email, reason, source, detail, created_at
+		FROM email_suppressions
+		WHERE ($1 = '' OR reason = $1)
+		ORDER BY created_at DESC, email
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, fq.Search, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppressions := []EmailSuppression{}
+	for rows.Next() {
+		var e EmailSuppression
+		if err := rows.Scan(&e.Email, &e.Reason, &e.Source, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		suppressions = append(suppressions, e)
+	}
+
+	return suppressions, rows.Err()
+}
+
+// Delete removes the suppression for email so that it can be mailed again.
+func (s *SuppressionStore) Delete(ctx context.Context, email string) error {
+	query := `DELETE FROM email_suppressions WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, email)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TagCount is a hashtag and the number of active listings that used it in
+// the requested period.
+type TagCount struct {
+	Tag      string `json:"tag"`
+	Listings int    `json:"listings"`
+}
+
+type TagStore struct {
+	db    *sql.DB
+	reads *QueryerChooser
+}
+
+// Set replaces the hashtags of a listing. Tags the listing already had keep
+// their original time, so editing a listing does not make its tags trend.
+func (s *TagStore) Set(ctx context.Context, listingID int64, tags []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM listing_tags WHERE listing_id = $1 AND NOT (tag = ANY($2))`, listingID, pq.Array(tags))
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO listing_tags (listing_id, tag)
+			SELECT $1, unnest($2::text[])
+			ON CONFLICT (listing_id, tag) DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, listingID, pq.Array(tags))
+		return err
+	})
+}
+
+// Trending returns the tags added to the most active listings since the
+// given time, most used first. A non-empty region counts only listings of
+// companies in that country.
+func (s *TagStore) Trending(ctx context.Context, since time.Time, region string, limit int) ([]TagCount, error) {
+	query := `
+		SELECT t.tag, COUNT(*)
+		FROM listing_tags t
+		JOIN listings l ON l.id = t.listing_id AND l.deleted_at IS NULL
+		JOIN companies c ON c.id = l.company_id
+		WHERE t.created_at >= $1 AND l.status = $2 AND ($3 = '' OR c.country = $3)
+		GROUP BY t.tag
+		ORDER BY COUNT(*) DESC, t.tag
+		LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.reads.Reader(ctx).QueryContext(ctx, query, since, ListingStatusActive, region, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Listings); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tc)
+	}
+	return tags, rows.Err()
+}
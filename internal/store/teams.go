@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+)
+
+// ErrNotJoinable is returned when the user cannot join a team: they are
+// already in a company or hold a role other than user.
+var ErrNotJoinable = errors.New("only users outside a company can join a team")
+
+// TeamMember is a user of a company with their role in its team.
+type TeamMember struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	JobTitle  string `json:"job_title,omitempty"`
+	Role      string `json:"role"`
+}
+
+// TeamStore manages the members of companies. Membership is users.company_id;
+// team invites are registration invites with a company_id.
+type TeamStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+// Invite stores the invite and queues the email carrying its token in the
+// same transaction.
+func (s *TeamStore) Invite(ctx context.Context, invite *RegistrationInvite, email *OutboxEmail) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO registration_invites (token, company_type, company_id, email, company_role, created_by, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at`
+
+		qctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(qctx, query, invite.Token, invite.CompanyType, invite.CompanyID,
+			invite.Email, invite.TeamRole, invite.CreatedBy, invite.ExpiresAt,
+		).Scan(&invite.ID, &invite.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return enqueueEmail(ctx, tx, s.cryptor, email)
+	})
+}
+
+// Join uses the team invite and makes the user a member of its company with
+// the company type as their role. A used or expired invite is
+// ErrInviteAlreadyUsed.
+func (s *TeamStore) Join(ctx context.Context, invite *RegistrationInvite, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		qctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(qctx, `
+			UPDATE registration_invites SET used_at = NOW()
+			WHERE id = $1 AND used_at IS NULL AND expires_at > NOW()`, invite.ID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrInviteAlreadyUsed
+		}
+
+		res, err = tx.ExecContext(qctx, `
+			UPDATE users
+			SET company_id = $1, company_role = $2, role_id = (SELECT id FROM roles WHERE name = $3)
+			WHERE id = $4 AND company_id IS NULL
+				AND role_id = (SELECT id FROM roles WHERE name = 'user')`,
+			invite.CompanyID, invite.TeamRole, invite.CompanyType, userID)
+		if err != nil {
+			return err
+		}
+		rows, err = res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotJoinable
+		}
+		return nil
+	})
+}
+
+// Members returns the company's users, owners first.
+func (s *TeamStore) Members(ctx context.Context, companyID int64) ([]TeamMember, error) {
+	query := `
+		SELECT id, username, first_name, last_name, email, COALESCE(job_title, ''), company_role
+		FROM users
+		WHERE company_id = $1 AND company_role IS NOT NULL AND state IN ('pending', 'active')
+		ORDER BY CASE company_role WHEN 'owner' THEN 0 WHEN 'manager' THEN 1 ELSE 2 END, id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []TeamMember{}
+	for rows.Next() {
+		var m TeamMember
+		var firstName, lastName, email string
+		if err := rows.Scan(&m.UserID, &m.Username, &firstName, &lastName, &email, &m.JobTitle, &m.Role); err != nil {
+			return nil, err
+		}
+		m.FirstName, _ = s.cryptor.DecryptString(firstName)
+		m.LastName, _ = s.cryptor.DecryptString(lastName)
+		m.Email, _ = s.cryptor.DecryptString(email)
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// Role returns the user's role in the company's team, ErrNotFound when they
+// are not a member.
+func (s *TeamStore) Role(ctx context.Context, companyID, userID int64) (string, error) {
+	query := `SELECT company_role FROM users WHERE id = $1 AND company_id = $2 AND company_role IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var role string
+	err := s.db.QueryRowContext(ctx, query, userID, companyID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return role, err
+}
+
+// SetRole changes a member's team role.
+func (s *TeamStore) SetRole(ctx context.Context, companyID, userID int64, role string) error {
+	query := `UPDATE users SET company_role = $1 WHERE id = $2 AND company_id = $3 AND company_role IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, role, userID, companyID)
+	if err != nil {
+		return translateError(err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Remove takes the user out of the company, back to the user role.
+func (s *TeamStore) Remove(ctx context.Context, companyID, userID int64) error {
+	query := `
+		UPDATE users
+		SET company_id = NULL, company_role = NULL, role_id = (SELECT id FROM roles WHERE name = 'user')
+		WHERE id = $1 AND company_id = $2 AND company_role IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, companyID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// DefaultTenantID is the tenant migration 67 creates. Rows written without
+// a tenant in the context, and every row of a deployment that does not
+// enable multi-tenant mode, belong to it.
+const DefaultTenantID int64 = 1
+
+var ErrDuplicateTenantSlug = conflict("a tenant with that slug already exists")
+
+// Tenant is one community hosted by the deployment. Users and listings
+// belong to exactly one, and emails and usernames are unique per tenant.
+type Tenant struct {
+	ID        int64  `json:"id"`
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+type tenantKey struct{}
+
+// WithTenant scopes the user and listing queries run with ctx to one
+// tenant. It lives in store rather than reqctx because stores read it.
+func WithTenant(ctx context.Context, tenantID int64) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set with WithTenant and whether one
+// was set. Contexts without one, such as background jobs, see every tenant.
+func TenantFromContext(ctx context.Context) (int64, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(int64)
+	return tenantID, ok
+}
+
+// tenantScope is the tenant_id queries filter on, 0 for none. Queries
+// compare it with "($n = 0 OR tenant_id = $n)".
+func tenantScope(ctx context.Context) int64 {
+	tenantID, _ := TenantFromContext(ctx)
+	return tenantID
+}
+
+// tenantOf is the tenant new rows are created in.
+func tenantOf(ctx context.Context) int64 {
+	if tenantID, ok := TenantFromContext(ctx); ok {
+		return tenantID
+	}
+	return DefaultTenantID
+}
+
+// inTenant reports whether a row of tenantID is visible in ctx.
+func inTenant(ctx context.Context, tenantID int64) bool {
+	scope := tenantScope(ctx)
+	return scope == 0 || scope == tenantID
+}
+
+type TenantStore struct {
+	db *sql.DB
+}
+
+func (s *TenantStore) Create(ctx context.Context, tenant *Tenant) error {
+	query := `INSERT INTO tenants (slug, name) VALUES ($1, $2) RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, tenant.Slug, tenant.Name).Scan(&tenant.ID, &tenant.CreatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+func (s *TenantStore) GetBySlug(ctx context.Context, slug string) (*Tenant, error) {
+	query := `SELECT id, slug, name, created_at FROM tenants WHERE slug = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var t Tenant
+	err := s.db.QueryRowContext(ctx, query, slug).Scan(&t.ID, &t.Slug, &t.Name, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *TenantStore) List(ctx context.Context) ([]Tenant, error) {
+	query := `SELECT id, slug, name, created_at FROM tenants ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []Tenant
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
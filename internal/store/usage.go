@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AccountUsage is what a user's account holds and has received, as opposed
+// to the request counters kept in the cache.
+type AccountUsage struct {
+	// MediaFiles counts photos on listings of the user's company.
+	MediaFiles int `json:"media_files"`
+	// MediaBytes is the size of the photos the user uploaded, which is
+	// what the media quota limits.
+	MediaBytes int64 `json:"media_bytes"`
+	// EmailsReceived counts delivered emails per template since the
+	// requested time.
+	EmailsReceived map[string]int `json:"emails_received"`
+}
+
+type UsageStore struct {
+	db *sql.DB
+}
+
+func (s *UsageStore) GetAccountUsage(ctx context.Context, userID int64, since time.Time) (*AccountUsage, error) {
+	usage := &AccountUsage{EmailsReceived: make(map[string]int)}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(lm.id)
+		FROM users u
+		JOIN listings l ON l.company_id = u.company_id
+		JOIN listing_media lm ON lm.listing_id = l.id
+		WHERE u.id = $1
+	`, userID).Scan(&usage.MediaFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	usage.MediaBytes, err = s.MediaBytes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT o.template, COUNT(*)
+		FROM email_outbox o
+		JOIN users u ON u.username = o.username
+		WHERE u.id = $1 AND o.sent_at IS NOT NULL AND o.sent_at >= $2
+		GROUP BY o.template
+	`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var template string
+		var count int
+		if err := rows.Scan(&template, &count); err != nil {
+			return nil, err
+		}
+		usage.EmailsReceived[template] = count
+	}
+
+	return usage, rows.Err()
+}
+
+// MediaBytes returns the total size of the media uploaded by the user.
+func (s *UsageStore) MediaBytes(ctx context.Context, userID int64) (int64, error) {
+	query := `SELECT COALESCE(SUM(size_bytes), 0) FROM listing_media WHERE uploaded_by = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var total int64
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&total)
+	return total, err
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// userTransitions lists the states each user state may move to. Deleted is
+// final; the row is kept so that references and the audit trail survive.
+var userTransitions = map[string][]string{
+	UserStatePending:     {UserStateActive, UserStateSuspended, UserStateDeleted},
+	UserStateActive:      {UserStateSuspended, UserStateDeactivated, UserStateDeleted},
+	UserStateSuspended:   {UserStateActive, UserStateDeactivated, UserStateDeleted},
+	UserStateDeactivated: {UserStateActive, UserStateDeleted},
+	UserStateDeleted:     {},
+}
+
+// CanTransitionUser reports whether a user in state from may move to state to.
+func CanTransitionUser(from, to string) bool {
+	for _, next := range userTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUserState reports whether state is a known user state.
+func IsUserState(state string) bool {
+	_, ok := userTransitions[state]
+	return ok
+}
+
+// UserStateEvent is one entry of a user's state history. ActorID is nil for
+// changes the system made, such as activation.
+type UserStateEvent struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	FromState string `json:"from_state"`
+	ToState   string `json:"to_state"`
+	ActorID   *int64 `json:"actor_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Transition moves the user to state to and records the change. It returns
+// ErrNotFound for unknown users and wraps ErrInvalidTransition when the
+// current state does not allow the move.
+func (s *UserStore) Transition(ctx context.Context, userID int64, to string, actorID *int64, reason string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.transition(ctx, tx, userID, to, actorID, reason)
+	})
+}
+
+func (s *UserStore) transition(ctx context.Context, tx *sql.Tx, userID int64, to string, actorID *int64, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var from string
+	err := tx.QueryRowContext(ctx, `SELECT state FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&from)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if !CanTransitionUser(from, to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	update := `
+		UPDATE users SET state = $1,
+			activated_at = CASE WHEN $1 = 'active' THEN COALESCE(activated_at, NOW()) ELSE activated_at END
+		WHERE id = $2
+	`
+	if _, err := tx.ExecContext(ctx, update, to, userID); err != nil {
+		return err
+	}
+
+	insert := `
+		INSERT INTO user_state_events (user_id, from_state, to_state, actor_id, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.ExecContext(ctx, insert, userID, from, to, actorID, reason)
+	return err
+}
+
+// StateHistory returns the user's state changes, newest first.
+func (s *UserStore) StateHistory(ctx context.Context, userID int64) ([]UserStateEvent, error) {
+	query := `
+		SELECT id, user_id, from_state, to_state, actor_id, reason, created_at
+		FROM user_state_events
+		WHERE user_id = $1
+		ORDER BY id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []UserStateEvent{}
+	for rows.Next() {
+		var e UserStateEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.FromState, &e.ToState, &e.ActorID, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -2,9 +2,7 @@ package store
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"strconv"
@@ -12,12 +10,15 @@ import (
 	"time"
 
 	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	ErrDuplicateEmail    = errors.New("a user with that email already exists")
-	ErrDuplicateUsername = errors.New("a user with that username already exists")
+	ErrDuplicateEmail    = conflict("a user with that email already exists")
+	ErrDuplicateUsername = conflict("a user with that username already exists")
+	ErrDuplicatePhone    = conflict("a user with that phone number already exists")
+	ErrNotPending        = errors.New("the user is not pending activation")
 )
 
 type User struct {
@@ -32,10 +33,38 @@ type User struct {
 	Password  password `json:"-"`
 	CreatedAt string   `json:"created_at"`
 	IsActive  bool     `json:"is_active"`
-	RoleID    int64    `json:"role_id"`
-	Role      Role     `json:"role"`
-	CompanyID *int64   `json:"company_id,omitempty"`
-	JobTitle  string   `json:"job_title,omitempty"`
+	// ActivatedAt is nil until the user first becomes active.
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	RoleID      int64      `json:"role_id"`
+	Role        Role       `json:"role"`
+	CompanyID   *int64     `json:"company_id,omitempty"`
+	JobTitle    string     `json:"job_title,omitempty"`
+	// Locale and Region override the defaults derived from Country; empty
+	// means no override. Timezone is the IANA zone mail is scheduled in.
+	// Registration fills Locale and Timezone in from Country.
+	Locale   string `json:"locale,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	// State is the account lifecycle state, one of the UserState constants.
+	// IsActive is true exactly when it is UserStateActive.
+	State string `json:"state"`
+	// Private profiles are hidden from users who have no conversation with
+	// the owner.
+	Private bool `json:"private"`
+	// TenantID is the community the user belongs to; see Tenant.
+	TenantID int64 `json:"tenant_id"`
+}
+
+// PendingActivation reports whether the user registered but has not followed
+// the activation link yet.
+func (u *User) PendingActivation() bool {
+	return u.State == UserStatePending
+}
+
+// CanSignIn reports whether the account may authenticate. Pending accounts
+// can, so that they can be asked to activate.
+func (u *User) CanSignIn() bool {
+	return u.State == UserStateActive || u.State == UserStatePending
 }
 
 type password struct {
@@ -65,6 +94,7 @@ func (p *password) GetHash() []byte {
 
 type UserStore struct {
 	db      *sql.DB
+	reads   *QueryerChooser
 	cryptor *crypto.Service
 }
 
@@ -97,9 +127,9 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	emailHash := crypto.HashEmail(user.Email)
 
 	query := `
-		INSERT INTO users (username, first_name, last_name, country, password, email, phone, push_opt_in, email_hash, role_id, company_id, job_title) VALUES
-		($1, $2, $3, $4, $5, $6, $7, $8, $9, (SELECT id FROM roles WHERE name = $10), $11, $12)
-    RETURNING id, created_at
+		INSERT INTO users (username, first_name, last_name, country, password, email, phone, push_opt_in, email_hash, role_id, company_id, job_title, phone_hash, tenant_id, locale, timezone) VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, (SELECT id FROM roles WHERE name = $10), $11, $12, NULLIF($13, ''), $14, $15, $16)
+    RETURNING id, created_at, state, is_active
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -109,6 +139,7 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	if role == "" {
 		role = "user"
 	}
+	user.TenantID = tenantOf(ctx)
 
 	err = tx.QueryRowContext(
 		ctx,
@@ -125,19 +156,18 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 		role,
 		user.CompanyID,
 		user.JobTitle,
+		crypto.HashPhone(user.Phone),
+		user.TenantID,
+		user.Locale,
+		user.Timezone,
 	).Scan(
 		&user.ID,
 		&user.CreatedAt,
+		&user.State,
+		&user.IsActive,
 	)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_hash_key"`:
-			return ErrDuplicateEmail
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
-			return ErrDuplicateUsername
-		default:
-			return err
-		}
+		return translateError(err)
 	}
 
 	return nil
@@ -149,12 +179,12 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	}
 
 	query := `
-		SELECT users.id, username, first_name, last_name, country, email, phone, push_opt_in, password, created_at, is_active,
-		       company_id, job_title,
+		SELECT users.id, username, first_name, last_name, country, locale, region, timezone, email, phone, push_opt_in, password, created_at, is_active, activated_at, state, is_private,
+		       company_id, job_title, users.tenant_id,
 		       roles.id, roles.name, roles.level, roles.description
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
-		WHERE users.id = $1 AND is_active = true
+		WHERE users.id = $1 AND state IN ('pending', 'active') AND ($2 = 0 OR users.tenant_id = $2)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -163,24 +193,32 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	user := &User{}
 	var encryptedEmail, encryptedFirstName, encryptedLastName, encryptedPhone, encryptedPushOptIn string
 	var jobTitle sql.NullString
-	err := s.db.QueryRowContext(
+	err := s.reads.Reader(ctx).QueryRowContext(
 		ctx,
 		query,
 		userID,
+		tenantScope(ctx),
 	).Scan(
 		&user.ID,
 		&user.Username,
 		&encryptedFirstName,
 		&encryptedLastName,
 		&user.Country,
+		&user.Locale,
+		&user.Region,
+		&user.Timezone,
 		&encryptedEmail,
 		&encryptedPhone,
 		&encryptedPushOptIn,
 		&user.Password.hash,
 		&user.CreatedAt,
 		&user.IsActive,
+		&user.ActivatedAt,
+		&user.State,
+		&user.Private,
 		&user.CompanyID,
 		&jobTitle,
+		&user.TenantID,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
@@ -213,9 +251,46 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	return user, nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// maxUsernameAttempts bounds how many suffixed variants createWithUniqueUsername
+// tries before giving up with ErrDuplicateUsername.
+const maxUsernameAttempts = 5
+
+// createWithUniqueUsername inserts the user under a savepoint so that a
+// username collision does not abort the surrounding transaction. On a
+// collision it retries with a numeric suffix (jdoe, jdoe2, jdoe3, ...);
+// user.Username holds the name that was actually stored.
+func (s *UserStore) createWithUniqueUsername(ctx context.Context, tx *sql.Tx, user *User) error {
+	base := user.Username
+
+	for attempt := 1; ; attempt++ {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT create_user`); err != nil {
+			return err
+		}
+
+		err := s.Create(ctx, tx, user)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT create_user`)
+			return err
+		}
+
+		if !errors.Is(err, ErrDuplicateUsername) || attempt == maxUsernameAttempts {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT create_user`); err != nil {
+			return err
+		}
+
+		user.Username = fmt.Sprintf("%s%d", base, attempt+1)
+	}
+}
+
+// CreateAndInvite creates the user and its activation token and queues the
+// welcome email in the same transaction. The username is made unique by
+// createWithUniqueUsername, so welcome is called with the final user.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
-		if err := s.Create(ctx, tx, user); err != nil {
+		if err := s.createWithUniqueUsername(ctx, tx, user); err != nil {
 			return err
 		}
 
@@ -223,11 +298,36 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 			return err
 		}
 
+		return s.enqueueWelcome(ctx, tx, user, welcome)
+	})
+}
+
+// CreateActive creates a user that can sign in right away, without an
+// activation token. It is used when activation is turned off.
+func (s *UserStore) CreateActive(ctx context.Context, user *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.createWithUniqueUsername(ctx, tx, user); err != nil {
+			return err
+		}
+
+		if err := s.transition(ctx, tx, user.ID, UserStateActive, nil, "activation disabled"); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if err := tx.QueryRowContext(ctx, `SELECT activated_at FROM users WHERE id = $1`, user.ID).Scan(&user.ActivatedAt); err != nil {
+			return err
+		}
+		user.State = UserStateActive
+		user.IsActive = true
+
 		return nil
 	})
 }
 
-func (s *UserStore) CreateCompanyAndUser(ctx context.Context, company *Company, user *User, token string, invitationExp time.Duration) error {
+func (s *UserStore) CreateCompanyAndUser(ctx context.Context, company *Company, user *User, token string, invitationExp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
 	companyStore := &CompanyStore{db: s.db, cryptor: s.cryptor}
 
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
@@ -236,9 +336,12 @@ func (s *UserStore) CreateCompanyAndUser(ctx context.Context, company *Company,
 			return err
 		}
 
-		// 2. Link user to company and create user
+		// 2. Link user to company and create user as the team owner
 		user.CompanyID = &company.ID
-		if err := s.Create(ctx, tx, user); err != nil {
+		if err := s.createWithUniqueUsername(ctx, tx, user); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET company_role = $1 WHERE id = $2`, TeamRoleOwner, user.ID); err != nil {
 			return err
 		}
 
@@ -247,23 +350,82 @@ func (s *UserStore) CreateCompanyAndUser(ctx context.Context, company *Company,
 			return err
 		}
 
-		return nil
+		// 4. Queue the welcome email
+		return s.enqueueWelcome(ctx, tx, user, welcome)
 	})
 }
 
-func (s *UserStore) Activate(ctx context.Context, token string) error {
+// Reinvite replaces the activation tokens of a pending user with token and
+// queues the welcome email again. Users in any other state are
+// ErrNotPending.
+func (s *UserStore) Reinvite(ctx context.Context, user *User, token string, invitationExp time.Duration, welcome func(*User) (*OutboxEmail, error)) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
-		// 1. find the user that this token belongs to
-		user, err := s.getUserFromInvitation(ctx, tx, token)
+		lockCtx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var state string
+		err := tx.QueryRowContext(lockCtx, `SELECT state FROM users WHERE id = $1 FOR UPDATE`, user.ID).Scan(&state)
 		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
 			return err
 		}
+		if state != UserStatePending {
+			return ErrNotPending
+		}
 
-		// 2. update the user
-		user.IsActive = true
-		if err := s.update(ctx, tx, user); err != nil {
+		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
+			return err
+		}
+
+		return s.enqueueWelcome(ctx, tx, user, welcome)
+	})
+}
+
+func (s *UserStore) enqueueWelcome(ctx context.Context, tx *sql.Tx, user *User, welcome func(*User) (*OutboxEmail, error)) error {
+	if welcome == nil {
+		return nil
+	}
+
+	email, err := welcome(user)
+	if err != nil {
+		return err
+	}
+
+	return enqueueEmail(ctx, tx, s.cryptor, email)
+}
+
+// Activate activates the user an invitation token was issued to, deletes
+// their invitations and returns the activated user.
+func (s *UserStore) Activate(ctx context.Context, hashes []string) (*User, error) {
+	if len(hashes) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var userID int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// 1. find the user that this token belongs to
+		user, err := s.getUserFromInvitation(ctx, tx, hashes)
+		if err != nil {
 			return err
 		}
+		userID = user.ID
+
+		// 2. activate the user; a token left over from before a suspension
+		// must not lift it
+		switch user.State {
+		case UserStatePending:
+			if err := s.transition(ctx, tx, user.ID, UserStateActive, nil, "activated"); err != nil {
+				return err
+			}
+		case UserStateActive:
+		default:
+			return ErrNotFound
+		}
 
 		// 3. clean the invitations
 		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
@@ -272,29 +434,32 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, userID)
 }
 
-func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, hashes []string) (*User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.created_at, u.is_active
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active, u.state
 		FROM users u
 		JOIN user_invitations ui ON u.id = ui.user_id
-		WHERE ui.token = $1 AND ui.expiry > $2
+		WHERE ui.token = ANY($1) AND ui.expiry > $2
 	`
 
-	hash := sha256.Sum256([]byte(token))
-	hashToken := hex.EncodeToString(hash[:])
-
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	user := &User{}
-	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+	err := tx.QueryRowContext(ctx, query, pq.Array(hashes), time.Now()).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.CreatedAt,
 		&user.IsActive,
+		&user.State,
 	)
 	if err != nil {
 		switch err {
@@ -322,20 +487,6 @@ func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token
 	return nil
 }
 
-func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
-	query := `UPDATE users SET username = $1, email = $2, is_active = $3 WHERE id = $4`
-
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID int64) error {
 	query := `DELETE FROM user_invitations WHERE user_id = $1`
 
@@ -379,18 +530,36 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, id int64) error {
 }
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return s.getActiveBy(ctx, "email_hash", crypto.HashEmail(email))
+}
+
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return s.getActiveBy(ctx, "username", strings.ToLower(username))
+}
+
+// GetByIdentifier looks up an active user by email when identifier contains
+// an @ and by username otherwise. Usernames never contain @.
+func (s *UserStore) GetByIdentifier(ctx context.Context, identifier string) (*User, error) {
+	if strings.Contains(identifier, "@") {
+		return s.GetByEmail(ctx, identifier)
+	}
+	return s.GetByUsername(ctx, identifier)
+}
+
+// getActiveBy loads an active user by a unique column. column is never user
+// input.
+func (s *UserStore) getActiveBy(ctx context.Context, column string, value string) (*User, error) {
 	if s.cryptor == nil {
 		return nil, errors.New("encryption service not configured")
 	}
 
-	emailHash := crypto.HashEmail(email)
 	query := `
-		SELECT users.id, username, email, first_name, last_name, country, phone, push_opt_in, password, users.created_at, users.is_active,
-		       company_id, job_title,
+		SELECT users.id, username, email, first_name, last_name, country, locale, region, timezone, phone, push_opt_in, password, users.created_at, users.is_active, activated_at, state, is_private,
+		       company_id, job_title, users.tenant_id,
 		       roles.id, roles.name, roles.level, roles.description
 		FROM users
 		JOIN roles ON (users.role_id = roles.id)
-		WHERE email_hash = $1 AND is_active = true
+		WHERE users.` + column + ` = $1 AND state IN ('pending', 'active') AND ($2 = 0 OR users.tenant_id = $2)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -399,20 +568,27 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	user := &User{}
 	var encryptedEmail, encryptedFirstName, encryptedLastName, encryptedPhone, encryptedPushOptIn string
 	var jobTitle sql.NullString
-	err := s.db.QueryRowContext(ctx, query, emailHash).Scan(
+	err := s.reads.Reader(ctx).QueryRowContext(ctx, query, value, tenantScope(ctx)).Scan(
 		&user.ID,
 		&user.Username,
 		&encryptedEmail,
 		&encryptedFirstName,
 		&encryptedLastName,
 		&user.Country,
+		&user.Locale,
+		&user.Region,
+		&user.Timezone,
 		&encryptedPhone,
 		&encryptedPushOptIn,
 		&user.Password.hash,
 		&user.CreatedAt,
 		&user.IsActive,
+		&user.ActivatedAt,
+		&user.State,
+		&user.Private,
 		&user.CompanyID,
 		&jobTitle,
+		&user.TenantID,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
@@ -498,27 +674,12 @@ func (s *UserStore) List(ctx context.Context, fq PaginatedQuery) ([]User, error)
 		fq.Offset = 0
 	}
 
-	var where []string
-	var args []any
-
-	if fq.Search != "" {
-		// We can partial match username, or exact match email_hash
-		searchTerm := "%" + fq.Search + "%"
-		emailHash := crypto.HashEmail(fq.Search)
-		where = append(where, fmt.Sprintf("(u.username ILIKE $%d OR u.email_hash = $%d)", len(args)+1, len(args)+2))
-		args = append(args, searchTerm, emailHash)
-	}
-
-	whereClause := ""
-	if len(where) > 0 {
-		whereClause = "WHERE " + strings.Join(where, " AND ")
-	}
-
+	whereClause, args := userListFilter(ctx, fq)
 	args = append(args, fq.Limit, fq.Offset)
 
 	query := fmt.Sprintf(`
 		SELECT
-			u.id, u.username, u.first_name, u.last_name, u.email, u.is_active, u.created_at,
+			u.id, u.username, u.first_name, u.last_name, u.email, u.is_active, u.state, u.created_at,
 			r.name as role_name
 		FROM users u
 		JOIN roles r ON u.role_id = r.id
@@ -542,7 +703,7 @@ func (s *UserStore) List(ctx context.Context, fq PaginatedQuery) ([]User, error)
 		var encryptedFirstName, encryptedLastName, encryptedEmail string
 		if err := rows.Scan(
 			&u.ID, &u.Username, &encryptedFirstName, &encryptedLastName, &encryptedEmail,
-			&u.IsActive, &u.CreatedAt, &u.Role.Name,
+			&u.IsActive, &u.State, &u.CreatedAt, &u.Role.Name,
 		); err != nil {
 			return nil, err
 		}
@@ -557,23 +718,41 @@ func (s *UserStore) List(ctx context.Context, fq PaginatedQuery) ([]User, error)
 	return users, nil
 }
 
-func (s *UserStore) UpdateStatus(ctx context.Context, userID int64, isActive bool) error {
-	query := `UPDATE users SET is_active = $1 WHERE id = $2`
+// Count returns the number of users List would page through for fq.
+func (s *UserStore) Count(ctx context.Context, fq PaginatedQuery) (int, error) {
+	whereClause, args := userListFilter(ctx, fq)
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM users u %s`, whereClause)
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, isActive, userID)
-	if err != nil {
-		return err
+	var count int
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// userListFilter builds the WHERE clause shared by List and Count.
+func userListFilter(ctx context.Context, fq PaginatedQuery) (string, []any) {
+	var where []string
+	var args []any
+
+	if tenantID := tenantScope(ctx); tenantID != 0 {
+		args = append(args, tenantID)
+		where = append(where, fmt.Sprintf("u.tenant_id = $%d", len(args)))
 	}
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return err
+
+	if fq.Search != "" {
+		// We can partial match username, or exact match email_hash
+		searchTerm := "%" + fq.Search + "%"
+		emailHash := crypto.HashEmail(fq.Search)
+		where = append(where, fmt.Sprintf("(u.username ILIKE $%d OR u.email_hash = $%d)", len(args)+1, len(args)+2))
+		args = append(args, searchTerm, emailHash)
 	}
-	if rows == 0 {
-		return ErrNotFound
+
+	if len(where) == 0 {
+		return "", args
 	}
-	return nil
+	return "WHERE " + strings.Join(where, " AND "), args
 }
 
 func (s *UserStore) UpdateRole(ctx context.Context, userID int64, roleID int64) error {
@@ -583,7 +762,7 @@ func (s *UserStore) UpdateRole(ctx context.Context, userID int64, roleID int64)
 
 	res, err := s.db.ExecContext(ctx, query, roleID, userID)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
@@ -629,9 +808,9 @@ func (s *UserStore) UpdateProfile(ctx context.Context, userID int64, firstName,
 		if err != nil {
 			return err
 		}
-		setClauses = append(setClauses, "phone = $"+strconv.Itoa(argIdx))
-		args = append(args, encrypted)
-		argIdx++
+		setClauses = append(setClauses, "phone = $"+strconv.Itoa(argIdx), "phone_hash = NULLIF($"+strconv.Itoa(argIdx+1)+", '')")
+		args = append(args, encrypted, crypto.HashPhone(phone))
+		argIdx += 2
 	}
 
 	if len(setClauses) == 0 {
@@ -645,6 +824,81 @@ func (s *UserStore) UpdateProfile(ctx context.Context, userID int64, firstName,
 	defer cancel()
 
 	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateLocalization sets the user's locale, region and timezone
+// overrides. A nil value is left unchanged and an empty one clears the
+// override.
+func (s *UserStore) UpdateLocalization(ctx context.Context, userID int64, locale, region, timezone *string) error {
+	query := `
+		UPDATE users SET locale = COALESCE($2, locale), region = COALESCE($3, region), timezone = COALESCE($4, timezone)
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, locale, region, timezone)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateUsername renames the user. A username taken in any case is
+// ErrDuplicateUsername.
+func (s *UserStore) UpdateUsername(ctx context.Context, userID int64, username string) error {
+	query := `UPDATE users SET username = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, username)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SetPrivate makes the user's profile private or public.
+func (s *UserStore) SetPrivate(ctx context.Context, userID int64, private bool) error {
+	query := `UPDATE users SET is_private = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID, private)
 	if err != nil {
 		return err
 	}
@@ -682,3 +936,272 @@ func (s *UserStore) UpdatePassword(ctx context.Context, userID int64, hashedPass
 	return nil
 }
 
+// SetMuted toggles the shadow mute flag. Content a muted user creates from
+// now on is only visible to themselves.
+func (s *UserStore) SetMuted(ctx context.Context, userID int64, muted bool) error {
+	query := `UPDATE users SET is_muted = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, muted, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// HideMessages hides every direct and application message userID sent, as
+// if they had been muted when sending them, and returns how many were
+// hidden.
+func (s *UserStore) HideMessages(ctx context.Context, userID int64) (int64, error) {
+	var hidden int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		for _, query := range []string{
+			`UPDATE direct_messages SET is_hidden = true WHERE sender_id = $1 AND NOT is_hidden`,
+			`UPDATE application_messages SET is_hidden = true WHERE sender_user_id = $1 AND NOT is_hidden`,
+		} {
+			res, err := tx.ExecContext(ctx, query, userID)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			hidden += n
+		}
+		return nil
+	})
+	return hidden, err
+}
+
+// TakenUsernames returns the subset of candidates that already belong to a user.
+func (s *UserStore) TakenUsernames(ctx context.Context, candidates []string) (map[string]bool, error) {
+	query := `SELECT username FROM users WHERE username = ANY($1) AND ($2 = 0 OR tenant_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(candidates), tenantScope(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		taken[username] = true
+	}
+
+	return taken, rows.Err()
+}
+
+// NormalizeCountries rewrites the country of every user to what normalize
+// returns for it. Values normalize does not know are left alone and
+// returned in unknown.
+func (s *UserStore) NormalizeCountries(ctx context.Context, normalize func(string) (string, bool)) (int64, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT country FROM users WHERE country <> '' ORDER BY country`)
+	if err != nil {
+		return 0, nil, err
+	}
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		values = append(values, value)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	var updated int64
+	var unknown []string
+	for _, value := range values {
+		code, ok := normalize(value)
+		if !ok {
+			unknown = append(unknown, value)
+			continue
+		}
+		if code == value {
+			continue
+		}
+		res, err := s.db.ExecContext(ctx, `UPDATE users SET country = $2 WHERE country = $1`, value, code)
+		if err != nil {
+			return updated, unknown, err
+		}
+		n, _ := res.RowsAffected()
+		updated += n
+	}
+	return updated, unknown, nil
+}
+
+// ContactMatch is a registered user whose email hash was found among the
+// hashes uploaded from an address book.
+type ContactMatch struct {
+	Hash      string `json:"hash"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+	CompanyID *int64 `json:"company_id,omitempty"`
+}
+
+// MatchEmailHashes returns the active users whose email hash, as computed by
+// crypto.HashEmail, is in hashes. excludeUserID is left out of the result.
+func (s *UserStore) MatchEmailHashes(ctx context.Context, hashes []string, excludeUserID int64) ([]ContactMatch, error) {
+	query := `
+		SELECT email_hash, users.id, username, first_name, last_name, roles.name, company_id
+		FROM users
+		JOIN roles ON (users.role_id = roles.id)
+		WHERE email_hash = ANY($1) AND is_active = true AND NOT is_private AND users.id <> $2
+			AND ($3 = 0 OR users.tenant_id = $3)
+		ORDER BY username
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(hashes), excludeUserID, tenantScope(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []ContactMatch
+	for rows.Next() {
+		var m ContactMatch
+		if err := rows.Scan(&m.Hash, &m.UserID, &m.Username, &m.FirstName, &m.LastName, &m.Role, &m.CompanyID); err != nil {
+			return nil, err
+		}
+		if m.FirstName, err = s.cryptor.DecryptString(m.FirstName); err != nil {
+			return nil, err
+		}
+		if m.LastName, err = s.cryptor.DecryptString(m.LastName); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+
+	return matches, rows.Err()
+}
+
+// MatchUsernames returns the active users whose username is in usernames,
+// which are lowercase. Hash is left empty. excludeUserID is left out of
+// the result.
+func (s *UserStore) MatchUsernames(ctx context.Context, usernames []string, excludeUserID int64) ([]ContactMatch, error) {
+	query := `
+		SELECT users.id, username, first_name, last_name, roles.name, company_id
+		FROM users
+		JOIN roles ON (users.role_id = roles.id)
+		WHERE username = ANY($1) AND is_active = true AND NOT is_private AND users.id <> $2
+			AND ($3 = 0 OR users.tenant_id = $3)
+		ORDER BY username
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(usernames), excludeUserID, tenantScope(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []ContactMatch
+	for rows.Next() {
+		var m ContactMatch
+		if err := rows.Scan(&m.UserID, &m.Username, &m.FirstName, &m.LastName, &m.Role, &m.CompanyID); err != nil {
+			return nil, err
+		}
+		if m.FirstName, err = s.cryptor.DecryptString(m.FirstName); err != nil {
+			return nil, err
+		}
+		if m.LastName, err = s.cryptor.DecryptString(m.LastName); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+
+	return matches, rows.Err()
+}
+
+// PublicProfile is the part of a user shown to other users, without contact
+// details.
+type PublicProfile struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+	CompanyID *int64 `json:"company_id,omitempty"`
+	JobTitle  string `json:"job_title,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// PublicProfiles returns the profiles of the users in ids that viewerID may
+// see, by id: users who blocked the viewer are left out, and so are private
+// profiles of users the viewer has no conversation with unless staff is
+// set. Unknown ids are left out too.
+func (s *UserStore) PublicProfiles(ctx context.Context, ids []int64, viewerID int64, staff bool) ([]PublicProfile, error) {
+	query := `
+		SELECT users.id, username, first_name, last_name, roles.name, company_id, COALESCE(job_title, ''), users.created_at
+		FROM users
+		JOIN roles ON (users.role_id = roles.id)
+		WHERE users.id = ANY($1) AND state IN ('pending', 'active')
+			AND ($4 = 0 OR users.tenant_id = $4)
+			AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = users.id AND b.blocked_id = $2)
+			AND (users.id = $2 OR NOT is_private OR $3 OR EXISTS (
+				SELECT 1 FROM conversations c
+				WHERE c.user_a = LEAST(users.id, $2) AND c.user_b = GREATEST(users.id, $2)))
+		ORDER BY users.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.reads.Reader(ctx).QueryContext(ctx, query, pq.Array(ids), viewerID, staff, tenantScope(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []PublicProfile{}
+	for rows.Next() {
+		var p PublicProfile
+		if err := rows.Scan(&p.ID, &p.Username, &p.FirstName, &p.LastName, &p.Role, &p.CompanyID, &p.JobTitle, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		if p.FirstName, err = s.cryptor.DecryptString(p.FirstName); err != nil {
+			return nil, err
+		}
+		if p.LastName, err = s.cryptor.DecryptString(p.LastName); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+
+	return profiles, rows.Err()
+}
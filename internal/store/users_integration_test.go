@@ -0,0 +1,148 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/store/storetest"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/tokens"
+)
+
+func newInvitee(t *testing.T, username, email, phone string) *store.User {
+	t.Helper()
+
+	user := &store.User{Username: username, FirstName: "Jo", LastName: "Doe", Email: email, Phone: phone, Country: "KZ"}
+	if err := user.Password.Set(storetest.Password); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func welcome(user *store.User) (*store.OutboxEmail, error) {
+	return &store.OutboxEmail{Template: "user_invitation", Username: user.Username, Email: user.Email, Data: []byte(`{}`)}, nil
+}
+
+func TestUserStoreCreateAndInvite(t *testing.T) {
+	s, f := storetest.New(t)
+	ctx := context.Background()
+
+	user := newInvitee(t, "jodoe", "jo@example.com", "+77001112233")
+	if err := s.Users.CreateAndInvite(ctx, user, tokens.Hash(tokens.Activation, "invite-1"), time.Hour, welcome); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.State != store.UserStatePending {
+		t.Fatalf("unexpected user after invite: %+v", user)
+	}
+
+	queued, err := s.Outbox.ClaimPending(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].Email != "jo@example.com" {
+		t.Errorf("expected the welcome email in the outbox, got %+v", queued)
+	}
+
+	if _, err := s.Users.Activate(ctx, tokens.Lookup(tokens.Activation, "invite-1")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Users.GetByEmail(ctx, "jo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != store.UserStateActive || got.Phone != "+77001112233" {
+		t.Errorf("unexpected user after activation: %+v", got)
+	}
+
+	t.Run("duplicate email rolls back", func(t *testing.T) {
+		dup := newInvitee(t, "other", "jo@example.com", "+77009998877")
+		err := s.Users.CreateAndInvite(ctx, dup, tokens.Hash(tokens.Activation, "invite-2"), time.Hour, welcome)
+		if !errors.Is(err, store.ErrDuplicateEmail) {
+			t.Fatalf("got %v, want ErrDuplicateEmail", err)
+		}
+		if _, err := s.Users.Activate(ctx, tokens.Lookup(tokens.Activation, "invite-2")); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("invitation of the rejected user survived: %v", err)
+		}
+		if queued, _ := s.Outbox.ClaimPending(ctx, 10, time.Minute); len(queued) != 0 {
+			t.Errorf("welcome email of the rejected user was queued: %+v", queued)
+		}
+	})
+
+	t.Run("username collision gets a suffix", func(t *testing.T) {
+		taken := f.User()
+		user := newInvitee(t, taken.Username, "new@example.com", "+77005556677")
+		if err := s.Users.CreateAndInvite(ctx, user, tokens.Hash(tokens.Activation, "invite-3"), time.Hour, nil); err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != taken.Username+"2" {
+			t.Errorf("username %q, want %q", user.Username, taken.Username+"2")
+		}
+	})
+
+	t.Run("welcome failure rolls back", func(t *testing.T) {
+		user := newInvitee(t, "nomail", "nomail@example.com", "+77004443322")
+		boom := errors.New("template broken")
+		err := s.Users.CreateAndInvite(ctx, user, tokens.Hash(tokens.Activation, "invite-4"), time.Hour, func(*store.User) (*store.OutboxEmail, error) {
+			return nil, boom
+		})
+		if !errors.Is(err, boom) {
+			t.Fatalf("got %v, want %v", err, boom)
+		}
+		if _, err := s.Users.GetByEmail(ctx, "nomail@example.com"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("user of the failed registration exists: %v", err)
+		}
+	})
+}
+
+func TestUserStoreDelete(t *testing.T) {
+	s, _ := storetest.New(t)
+	ctx := context.Background()
+
+	user := newInvitee(t, "gone", "gone@example.com", "+77001234567")
+	if err := s.Users.CreateAndInvite(ctx, user, tokens.Hash(tokens.Activation, "invite"), time.Hour, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Users.Delete(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Users.GetByID(ctx, user.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByID after delete: %v", err)
+	}
+	if _, err := s.Users.Activate(ctx, tokens.Lookup(tokens.Activation, "invite")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("invitation survived the delete: %v", err)
+	}
+
+	// the email is free again
+	again := newInvitee(t, "gone", "gone@example.com", "+77001234567")
+	if err := s.Users.CreateAndInvite(ctx, again, tokens.Hash(tokens.Activation, "invite-again"), time.Hour, nil); err != nil {
+		t.Errorf("re-register after delete: %v", err)
+	}
+}
+
+func TestListingStoreWithFactory(t *testing.T) {
+	s, f := storetest.New(t)
+	ctx := context.Background()
+
+	company, _ := f.Company()
+	listing := f.Listing(company.ID)
+	f.Listing(company.ID, func(l *store.Listing) { l.Status = "draft" })
+
+	got, err := s.Listings.GetByID(ctx, listing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != listing.Title || got.CompanyID != company.ID {
+		t.Errorf("unexpected listing %+v", got)
+	}
+
+	active, err := s.Listings.List(ctx, store.ListingFilter{Status: store.ListingStatusActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].ID != listing.ID {
+		t.Errorf("expected only the active listing, got %+v", active)
+	}
+}
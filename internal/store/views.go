@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	ViewProfile = "profile"
+	ViewListing = "listing"
+)
+
+// ViewCount is the number of distinct viewers of a profile or listing on
+// Day, a UTC date formatted as YYYY-MM-DD.
+type ViewCount struct {
+	Kind     string
+	TargetID int64
+	Day      string
+	Views    int64
+}
+
+// DailyViews is the number of views on one UTC day.
+type DailyViews struct {
+	Date  string `json:"date"`
+	Views int64  `json:"views"`
+}
+
+// ListingViews is the number of views of a listing over a period.
+type ListingViews struct {
+	ListingID int64  `json:"listing_id"`
+	Title     string `json:"title"`
+	Views     int64  `json:"views"`
+}
+
+type ViewStore struct {
+	db *sql.DB
+}
+
+// Add adds counts to the stored daily totals in one transaction, so a
+// failed flush can be retried with the same counts.
+func (s *ViewStore) Add(ctx context.Context, counts []ViewCount) error {
+	query := `
+		INSERT INTO view_counts (kind, target_id, day, views)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (kind, target_id, day) DO UPDATE SET views = view_counts.views + EXCLUDED.views
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		for _, c := range counts {
+			if _, err := tx.ExecContext(ctx, query, c.Kind, c.TargetID, c.Day, c.Views); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ProfileDaily returns the views of the user's profile per day since since,
+// oldest first. Days without views are left out.
+func (s *ViewStore) ProfileDaily(ctx context.Context, userID int64, since time.Time) ([]DailyViews, error) {
+	query := `
+		SELECT to_char(day, 'YYYY-MM-DD'), views FROM view_counts
+		WHERE kind = 'profile' AND target_id = $1 AND day >= $2::date
+		ORDER BY day
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since.UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []DailyViews{}
+	for rows.Next() {
+		var d DailyViews
+		if err := rows.Scan(&d.Date, &d.Views); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// CompanyListings returns the views since since of the company's listings
+// that had any, most viewed first.
+func (s *ViewStore) CompanyListings(ctx context.Context, companyID int64, since time.Time) ([]ListingViews, error) {
+	query := `
+		SELECT l.id, l.title, SUM(v.views) AS total
+		FROM view_counts v
+		JOIN listings l ON l.id = v.target_id AND l.deleted_at IS NULL
+		WHERE v.kind = 'listing' AND l.company_id = $1 AND v.day >= $2::date
+		GROUP BY l.id, l.title
+		ORDER BY total DESC, l.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, companyID, since.UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	listings := []ListingViews{}
+	for rows.Next() {
+		var l ListingViews
+		if err := rows.Scan(&l.ListingID, &l.Title, &l.Views); err != nil {
+			return nil, err
+		}
+		listings = append(listings, l)
+	}
+	return listings, rows.Err()
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/crypto"
+	"github.com/Lelouchlamperougexd/Valar_Morghulis/internal/events"
+	"github.com/lib/pq"
+)
+
+// WebhookEvents lists the events a webhook can subscribe to.
+var WebhookEvents = []string{events.UserRegistered, events.ListingCreated, events.ListingPublished, events.ApplicationMessageCreated}
+
+// Webhook receives signed POSTs for the events it subscribes to. A nil
+// CompanyID is an admin hook that receives events about everything.
+type Webhook struct {
+	ID        int64    `json:"id"`
+	CreatedBy *int64   `json:"created_by,omitempty"`
+	CompanyID *int64   `json:"company_id,omitempty"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent to one webhook, and its log entry.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+
+	// URL and Secret are the hook's, filled in by ClaimPending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookStore struct {
+	db      *sql.DB
+	cryptor *crypto.Service
+}
+
+func (s *WebhookStore) Create(ctx context.Context, hook *Webhook) error {
+	secret, err := s.cryptor.EncryptString(hook.Secret)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhooks (created_by, company_id, url, secret, events)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, hook.CreatedBy, hook.CompanyID, hook.URL, secret, pq.Array(hook.Events)).
+		Scan(&hook.ID, &hook.CreatedAt)
+}
+
+// GetByID returns the hook without its secret.
+func (s *WebhookStore) GetByID(ctx context.Context, id int64) (*Webhook, error) {
+	query := `SELECT id, created_by, company_id, url, events, created_at FROM webhooks WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	hook := &Webhook{}
+	var events pq.StringArray
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&hook.ID, &hook.CreatedBy, &hook.CompanyID, &hook.URL, &events, &hook.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	hook.Events = events
+	return hook, nil
+}
+
+// List returns the company's hooks, or the admin hooks for a nil companyID.
+func (s *WebhookStore) List(ctx context.Context, companyID *int64) ([]Webhook, error) {
+	query := `
+		SELECT id, created_by, company_id, url, events, created_at
+		FROM webhooks
+		WHERE company_id IS NOT DISTINCT FROM $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var hook Webhook
+		var events pq.StringArray
+		if err := rows.Scan(&hook.ID, &hook.CreatedBy, &hook.CompanyID, &hook.URL, &events, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hook.Events = events
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// Delete removes the hook and its delivery log.
+func (s *WebhookStore) Delete(ctx context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Enqueue queues payload for every hook subscribed to event: admin hooks
+// and, when companyID is set, that company's hooks.
+func (s *WebhookStore) Enqueue(ctx context.Context, event string, companyID *int64, payload json.RawMessage) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1, $3 FROM webhooks
+		WHERE $1 = ANY(events) AND (company_id IS NULL OR company_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, event, companyID, string(payload))
+	return err
+}
+
+// ClaimPending returns up to limit deliveries that are due and pushes their
+// next attempt out by lease, like OutboxStore.ClaimPending.
+func (s *WebhookStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = NOW() + $2 * interval '1 second'
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE delivered_at IS NULL AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, webhook_id, event, payload, attempts, created_at
+		)
+		SELECT c.id, c.webhook_id, c.event, c.payload, c.attempts, c.created_at, w.url, w.secret
+		FROM claimed c
+		JOIN webhooks w ON w.id = c.webhook_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		if d.Secret, err = s.cryptor.DecryptString(d.Secret); err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered records the successful attempt.
+func (s *WebhookStore) MarkDelivered(ctx context.Context, id int64, status int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET delivered_at = NOW(), attempts = attempts + 1, response_status = $2, last_error = NULL, next_attempt_at = NULL
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, status)
+	return err
+}
+
+// MarkFailed records a failed attempt; status is 0 when no response came
+// back. A nil retryAt gives up on the delivery.
+func (s *WebhookStore) MarkFailed(ctx context.Context, id int64, status int, lastError string, retryAt *time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, response_status = NULLIF($2, 0), last_error = $3, next_attempt_at = $4
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, status, lastError, retryAt)
+	return err
+}
+
+// ListDeliveries returns the hook's delivery log, newest first.
+func (s *WebhookStore) ListDeliveries(ctx context.Context, webhookID int64, fq PaginatedQuery) ([]WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event, payload, attempts, response_status, COALESCE(last_error, ''),
+			next_attempt_at, delivered_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, webhookID, fq.Limit, fq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Attempts, &d.ResponseStatus, &d.LastError,
+			&d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
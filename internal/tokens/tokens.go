@@ -0,0 +1,160 @@
+// Package tokens issues the secrets sent in emailed links: account
+// activation, sign-in links and email change confirmations. Only a hash of
+// a token is stored, so a leaked table cannot be replayed.
+//
+// Hashes are scoped to the purpose, so a token cannot be used for another
+// purpose even where tables are shared. Every purpose is single-use: the
+// stores delete or mark a token when it is redeemed. A token is looked up
+// by its hash, so how long a lookup takes tells nothing about the secret,
+// and Match compares hashes in constant time where they are held in memory.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Purpose string
+
+const (
+	Activation  Purpose = "activation"
+	MagicLink   Purpose = "magic_link"
+	EmailChange Purpose = "email_change"
+)
+
+// Purposes lists every purpose, for configuration.
+var Purposes = []Purpose{Activation, MagicLink, EmailChange}
+
+// Formats of the plain token.
+const (
+	// FormatUUID is a random UUID, 36 characters
+	FormatUUID = "uuid"
+	// FormatRandom is 32 random bytes in unpadded base64url, 43 characters
+	FormatRandom = "random"
+)
+
+// maxLength bounds the tokens Lookup hashes; longer ones are not ours.
+const maxLength = 128
+
+// Policy is how the tokens of a purpose are made.
+type Policy struct {
+	TTL    time.Duration
+	Format string
+}
+
+// Policies holds a Policy per purpose.
+type Policies map[Purpose]Policy
+
+// DefaultPolicies are the lifetimes the API used before they were
+// configurable.
+var DefaultPolicies = Policies{
+	Activation:  {TTL: 3 * 24 * time.Hour, Format: FormatUUID},
+	MagicLink:   {TTL: 15 * time.Minute, Format: FormatUUID},
+	EmailChange: {TTL: 24 * time.Hour, Format: FormatUUID},
+}
+
+// Token is an issued token. Plain goes into the link, Hash into the
+// database.
+type Token struct {
+	Purpose   Purpose
+	Plain     string
+	Hash      string
+	ExpiresAt time.Time
+}
+
+// Issuer issues tokens by the policies it was built with. It is safe for
+// concurrent use.
+type Issuer struct {
+	policies Policies
+	now      func() time.Time
+}
+
+// New returns an issuer for policies. Purposes missing from policies use
+// DefaultPolicies; a policy without a positive TTL or with an unknown
+// format is an error.
+func New(policies Policies) (*Issuer, error) {
+	merged := make(Policies, len(DefaultPolicies))
+	for _, purpose := range Purposes {
+		policy, ok := policies[purpose]
+		if !ok {
+			policy = DefaultPolicies[purpose]
+		}
+		if policy.TTL <= 0 {
+			return nil, fmt.Errorf("%s tokens need a positive TTL, got %s", purpose, policy.TTL)
+		}
+		switch policy.Format {
+		case FormatUUID, FormatRandom:
+		default:
+			return nil, fmt.Errorf("%s token format must be %s or %s, got %q", purpose, FormatUUID, FormatRandom, policy.Format)
+		}
+		merged[purpose] = policy
+	}
+	return &Issuer{policies: merged, now: time.Now}, nil
+}
+
+// TTL returns how long tokens of purpose stay valid.
+func (i *Issuer) TTL(purpose Purpose) time.Duration {
+	return i.policies[purpose].TTL
+}
+
+// Issue returns a new token for purpose.
+func (i *Issuer) Issue(purpose Purpose) (Token, error) {
+	policy, ok := i.policies[purpose]
+	if !ok {
+		return Token{}, fmt.Errorf("unknown token purpose %q", purpose)
+	}
+
+	var plain string
+	switch policy.Format {
+	case FormatRandom:
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return Token{}, err
+		}
+		plain = base64.RawURLEncoding.EncodeToString(b)
+	default:
+		plain = uuid.NewString()
+	}
+
+	return Token{
+		Purpose:   purpose,
+		Plain:     plain,
+		Hash:      Hash(purpose, plain),
+		ExpiresAt: i.now().Add(policy.TTL),
+	}, nil
+}
+
+// Hash returns the stored form of a plain token of purpose.
+func Hash(purpose Purpose, plain string) string {
+	sum := sha256.Sum256([]byte(string(purpose) + ":" + plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the hashes a stored token for plain may have, or nil when
+// plain cannot be a token, so that callers answer not found without a
+// query. Besides the scoped hash it returns the unscoped one that tokens
+// issued before scoping were stored with.
+func Lookup(purpose Purpose, plain string) []string {
+	if plain == "" || len(plain) > maxLength {
+		return nil
+	}
+	legacy := sha256.Sum256([]byte(plain))
+	return []string{Hash(purpose, plain), hex.EncodeToString(legacy[:])}
+}
+
+// Match reports whether stored is one of hashes, comparing in constant
+// time.
+func Match(stored string, hashes []string) bool {
+	found := 0
+	for _, hash := range hashes {
+		found |= subtle.ConstantTimeCompare([]byte(stored), []byte(hash))
+	}
+	return found == 1
+}
@@ -0,0 +1,70 @@
+package tokens
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	issuer, err := New(Policies{MagicLink: {TTL: time.Minute, Format: FormatRandom}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	issuer.now = func() time.Time { return now }
+
+	token, err := issuer.Issue(MagicLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token.Plain) != 43 || strings.ContainsAny(token.Plain, "+/=") {
+		t.Errorf("random token %q", token.Plain)
+	}
+	if !token.ExpiresAt.Equal(now.Add(time.Minute)) || token.Hash != Hash(MagicLink, token.Plain) {
+		t.Errorf("token %+v", token)
+	}
+	if issuer.TTL(Activation) != DefaultPolicies[Activation].TTL {
+		t.Errorf("activation TTL %s, want the default", issuer.TTL(Activation))
+	}
+
+	activation, err := issuer.Issue(Activation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activation.Plain) != 36 {
+		t.Errorf("uuid token %q", activation.Plain)
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	for name, policies := range map[string]Policies{
+		"no ttl":         {Activation: {Format: FormatUUID}},
+		"unknown format": {EmailChange: {TTL: time.Hour, Format: "hex"}},
+	} {
+		if _, err := New(policies); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	hash := Hash(EmailChange, "abc")
+	if Match(hash, Lookup(MagicLink, "abc")) {
+		t.Error("a token matched for another purpose")
+	}
+	if !Match(hash, Lookup(EmailChange, "abc")) {
+		t.Error("scoped hash not matched")
+	}
+
+	legacy := sha256.Sum256([]byte("abc"))
+	if !Match(hex.EncodeToString(legacy[:]), Lookup(EmailChange, "abc")) {
+		t.Error("hash from before scoping not matched")
+	}
+
+	if Lookup(Activation, "") != nil || Lookup(Activation, strings.Repeat("a", maxLength+1)) != nil {
+		t.Error("malformed tokens are looked up")
+	}
+}
@@ -0,0 +1,275 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExporterConfig configures the OTLP/HTTP exporter. The fields mirror the
+// standard OTEL_* environment variables.
+type ExporterConfig struct {
+	// Endpoint is the collector base URL, e.g. http://localhost:4318; spans
+	// are posted to Endpoint + "/v1/traces".
+	Endpoint string
+	// Headers are sent with every export, e.g. for collector authentication.
+	Headers     map[string]string
+	ServiceName string
+	Version     string
+	// Interval is the longest a span waits before it is exported.
+	Interval time.Duration
+}
+
+const (
+	maxQueuedSpans = 2048
+	maxBatchSpans  = 512
+)
+
+// Exporter batches ended spans and posts them as OTLP JSON. Spans that do
+// not fit in the queue are dropped rather than slowing down requests.
+type Exporter struct {
+	cfg    ExporterConfig
+	url    string
+	client *http.Client
+	queue  chan *Span
+	flush  chan chan struct{}
+	// OnError is called with export failures; it may be nil.
+	OnError func(error)
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewExporter starts the export loop; Shutdown stops it.
+func NewExporter(cfg ExporterConfig) *Exporter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	e := &Exporter{
+		cfg:    cfg,
+		url:    strings.TrimRight(cfg.Endpoint, "/") + "/v1/traces",
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *Span, maxQueuedSpans),
+		flush:  make(chan chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// ParseHeaders reads OTEL_EXPORTER_OTLP_HEADERS, comma-separated key=value
+// pairs. Values are used as they are; percent-encoding is not decoded.
+func ParseHeaders(v string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+func (e *Exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// Dropped returns the number of spans lost to a full queue.
+func (e *Exporter) Dropped() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// Shutdown exports the queued spans and stops the exporter. Spans ended
+// afterwards are dropped.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case e.flush <- ack:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Exporter) run() {
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSpans {
+				e.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.export(batch)
+			batch = nil
+		case ack := <-e.flush:
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			e.export(batch)
+			close(ack)
+			return
+		}
+	}
+}
+
+func (e *Exporter) export(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := e.post(batch); err != nil && e.OnError != nil {
+		e.OnError(err)
+	}
+}
+
+func (e *Exporter) post(batch []*Span) error {
+	body, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp export: %s", resp.Status)
+	}
+	return nil
+}
+
+// The types below are the OTLP JSON encoding of ExportTraceServiceRequest.
+// Ids are hex strings and 64-bit integers are decimal strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	// Code is 0 for unset and 2 for error.
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func (e *Exporter) encode(batch []*Span) otlpRequest {
+	resource := []otlpAttr{attr(String("service.name", e.cfg.ServiceName))}
+	if e.cfg.Version != "" {
+		resource = append(resource, attr(String("service.version", e.cfg.Version)))
+	}
+
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != (SpanID{}) {
+			span.ParentSpanID = s.parent.String()
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, attr(a))
+		}
+		if s.errMsg != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+		spans = append(spans, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/Lelouchlamperougexd/Valar_Morghulis"}, Spans: spans}},
+	}}}
+}
+
+func attr(a Attr) otlpAttr {
+	var value map[string]any
+	switch v := a.Value.(type) {
+	case bool:
+		value = map[string]any{"boolValue": v}
+	case int64:
+		value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		value = map[string]any{"doubleValue": v}
+	default:
+		value = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+	return otlpAttr{Key: a.Key, Value: value}
+}
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header.
+const TraceparentHeader = "Traceparent"
+
+// Traceparent formats the current span of ctx as a traceparent value, or
+// returns "" when there is none.
+func Traceparent(ctx context.Context) string {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// Inject sets the traceparent header for the current span of ctx.
+func Inject(ctx context.Context, h http.Header) {
+	if v := Traceparent(ctx); v != "" {
+		h.Set(TraceparentHeader, v)
+	}
+}
+
+// Extract returns ctx with the remote parent from h, if h carries a valid
+// traceparent header.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := parseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+func parseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
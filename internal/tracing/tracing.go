@@ -0,0 +1,243 @@
+// Package tracing records spans in the OpenTelemetry data model and exports
+// them over OTLP/HTTP, without depending on the OpenTelemetry SDK.
+//
+// Spans are started with Start and nest through the context. Until a Tracer
+// is installed with SetTracer, Start returns a nil *Span, whose methods do
+// nothing, so instrumented code never has to check whether tracing is on.
+// Trace context crosses process boundaries in the W3C traceparent header,
+// see Inject and Extract.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both ids are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// SpanKind follows the OTLP enumeration.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attr is a span attribute. Value is a string, bool, int64 or float64.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr    { return Attr{Key: key, Value: value} }
+func Int(key string, value int) Attr   { return Attr{Key: key, Value: int64(value)} }
+func Bool(key string, value bool) Attr { return Attr{Key: key, Value: value} }
+
+// Span is one timed operation. A nil *Span is valid and records nothing.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   SpanKind
+	sc     SpanContext
+	parent SpanID
+	start  time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []Attr
+	errMsg string
+	ended  bool
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// SetName replaces the name given to Start, e.g. once the route is known.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// RecordError marks the span as failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMsg = err.Error()
+}
+
+// End finishes the span and hands it to the exporter. Only the first call
+// has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s)
+}
+
+// SpanContext returns the span's ids; the zero value for a nil span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// Tracer creates spans and queues ended ones for export.
+type Tracer struct {
+	exporter *Exporter
+	// threshold samples new traces whose id, read as a number, is below it.
+	threshold uint64
+	sampleAll bool
+}
+
+// NewTracer samples new traces with probability ratio; spans continuing a
+// trace follow the caller's decision.
+func NewTracer(exporter *Exporter, ratio float64) *Tracer {
+	t := &Tracer{exporter: exporter}
+	switch {
+	case ratio >= 1:
+		t.sampleAll = true
+	case ratio > 0:
+		t.threshold = uint64(ratio * math.MaxUint64)
+	}
+	return t
+}
+
+var global atomic.Pointer[Tracer]
+
+// SetTracer installs t for Start; nil turns tracing off.
+func SetTracer(t *Tracer) {
+	global.Store(t)
+}
+
+// Enabled reports whether a tracer is installed.
+func Enabled() bool {
+	return global.Load() != nil
+}
+
+type ctxKey struct{}
+
+var spanContextKey ctxKey
+
+// ContextWithSpanContext returns ctx carrying sc as the current span, e.g.
+// a remote parent read by Extract.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey, sc)
+}
+
+// SpanContextFromContext returns the current span's ids, if any.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey).(SpanContext)
+	return sc
+}
+
+// Start begins a span named name as a child of the span in ctx. The
+// returned context carries the new span; End must be called on it.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	t := global.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = t.sample(sc.TraceID)
+	}
+	ctx = ContextWithSpanContext(ctx, sc)
+	if !sc.Sampled {
+		return ctx, nil
+	}
+
+	return ctx, &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		sc:     sc,
+		parent: parent.SpanID,
+		start:  time.Now(),
+		attrs:  attrs,
+	}
+}
+
+// StartChild is Start for low-level operations such as queries: without a
+// span in ctx it records nothing, so background polling does not start a
+// trace per query.
+func StartChild(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	if !SpanContextFromContext(ctx).IsValid() {
+		return ctx, nil
+	}
+	return Start(ctx, name, kind, attrs...)
+}
+
+func (t *Tracer) sample(id TraceID) bool {
+	return t.sampleAll || binary.BigEndian.Uint64(id[8:]) < t.threshold
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
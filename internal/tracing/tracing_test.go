@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPropagation(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc := SpanContextFromContext(Extract(context.Background(), h))
+	if !sc.IsValid() || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+
+	for _, bad := range []string{"", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "00-xyz-00f067aa0ba902b7-01"} {
+		h.Set(TraceparentHeader, bad)
+		if SpanContextFromContext(Extract(context.Background(), h)).IsValid() {
+			t.Errorf("%q: should be ignored", bad)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	var got otlpRequest
+	received := make(chan struct{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Api-Key") != "secret" {
+			t.Errorf("unexpected export %s %v", r.URL.Path, r.Header)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		close(received)
+	}))
+	defer collector.Close()
+
+	exporter := NewExporter(ExporterConfig{
+		Endpoint:    collector.URL,
+		Headers:     ParseHeaders("Api-Key=secret"),
+		ServiceName: "api",
+		Interval:    time.Hour,
+	})
+	SetTracer(NewTracer(exporter, 1))
+	defer SetTracer(nil)
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, server := Start(Extract(context.Background(), h), "GET /users/{id}", KindServer)
+	_, query := StartChild(ctx, "SELECT", KindClient, String("db.system", "postgresql"))
+	query.RecordError(errors.New("boom"))
+	query.End()
+	server.End()
+
+	if _, span := StartChild(context.Background(), "SELECT", KindClient); span != nil {
+		t.Error("StartChild without a parent should not record")
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get(TraceparentHeader) != Traceparent(ctx) || Traceparent(ctx) == "" {
+		t.Errorf("inject wrote %q", out.Get(TraceparentHeader))
+	}
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	q, s := spans[0], spans[1]
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != "00f067aa0ba902b7" || s.Kind != KindServer {
+		t.Errorf("unexpected server span %+v", s)
+	}
+	if q.TraceID != s.TraceID || q.ParentSpanID != s.SpanID || q.Status.Code != 2 || q.Attributes[0].Value["stringValue"] != "postgresql" {
+		t.Errorf("unexpected query span %+v", q)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	SetTracer(NewTracer(NewExporter(ExporterConfig{Endpoint: "http://127.0.0.1:0"}), 0))
+	defer SetTracer(nil)
+
+	ctx, span := Start(context.Background(), "GET /", KindServer)
+	if span != nil {
+		t.Fatal("ratio 0 should not record new traces")
+	}
+	if sc := SpanContextFromContext(ctx); !sc.IsValid() || sc.Sampled {
+		t.Errorf("unsampled span context should still propagate, got %+v", sc)
+	}
+}
@@ -0,0 +1,252 @@
+// Package wordfilter finds banned words in usernames and user content. The
+// words come from embedded per-locale lists, extended by the caller.
+//
+// Matching ignores case, treats ё as е and reads common digit and symbol
+// substitutions ("sh1t", "$hit") as letters. An entry matches a whole word,
+// or with a trailing * every word it starts, so "fuck*" also catches
+// "fucking" while "ass" alone would not catch "class".
+package wordfilter
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// minUsernameInfix is the shortest entry that is also looked for inside a
+// username, where words run together without spaces. Shorter ones would
+// catch too many innocent names, and so would transliterated ones, which
+// are only matched as parts of a username.
+const minUsernameInfix = 4
+
+//go:embed words/*.txt
+var lists embed.FS
+
+// substitutions are the characters written in place of letters.
+var substitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's', 'ё': 'е',
+}
+
+type Options struct {
+	// Locales are the embedded lists to load, see Locales; empty loads
+	// all of them
+	Locales []string
+	// Words are more entries, in the syntax of the lists
+	Words []string
+	// Transliterate, if set, spells an entry in ASCII so it is found in
+	// usernames, which only have ASCII letters
+	Transliterate func(string) string
+}
+
+// Filter is safe for concurrent use; build a new one to change the words.
+type Filter struct {
+	words    map[string]bool
+	prefixes []string
+	// usernameWords are the entries in ASCII
+	usernameWords    map[string]bool
+	usernamePrefixes []string
+	// usernameInfixes are also found inside a username, see
+	// minUsernameInfix
+	usernameInfixes []string
+}
+
+// Locales returns the locales with an embedded list.
+func Locales() []string {
+	entries, _ := lists.ReadDir("words")
+	locales := make([]string, 0, len(entries))
+	for _, e := range entries {
+		locales = append(locales, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	return locales
+}
+
+// New returns a filter with the lists of opts.Locales and opts.Words. An
+// unknown locale is an error.
+func New(opts Options) (*Filter, error) {
+	locales := opts.Locales
+	if len(locales) == 0 {
+		locales = Locales()
+	}
+
+	entries := slices.Clone(opts.Words)
+	for _, locale := range locales {
+		data, err := lists.ReadFile(path.Join("words", strings.ToLower(strings.TrimSpace(locale))+".txt"))
+		if err != nil {
+			return nil, fmt.Errorf("no banned word list for locale %q", locale)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+	}
+
+	f := &Filter{words: map[string]bool{}, usernameWords: map[string]bool{}}
+	for _, entry := range entries {
+		word, prefix := Normalize(entry)
+		if word == "" {
+			continue
+		}
+		addEntry(f.words, &f.prefixes, word, prefix)
+		if ascii(word) && len(word) >= minUsernameInfix {
+			f.usernameInfixes = append(f.usernameInfixes, word)
+		}
+		if opts.Transliterate != nil {
+			word = opts.Transliterate(word)
+		}
+		if ascii(word) {
+			addEntry(f.usernameWords, &f.usernamePrefixes, word, prefix)
+		}
+	}
+	return f, nil
+}
+
+func addEntry(words map[string]bool, prefixes *[]string, word string, prefix bool) {
+	if prefix {
+		*prefixes = append(*prefixes, word)
+	} else {
+		words[word] = true
+	}
+}
+
+// Normalize returns an entry in the form it is matched in, and whether it
+// is a prefix. It returns "" for entries without a letter.
+func Normalize(entry string) (string, bool) {
+	entry = strings.TrimSpace(entry)
+	prefix := strings.HasSuffix(entry, "*")
+	word := normalizeWord(strings.TrimSuffix(entry, "*"))
+	if strings.IndexFunc(word, unicode.IsLetter) < 0 {
+		return "", false
+	}
+	return word, prefix
+}
+
+// Match returns the first banned word of text as written, "" when there is
+// none.
+func (f *Filter) Match(text string) string {
+	for _, span := range wordSpans(text) {
+		if f.banned(normalizeWord(text[span[0]:span[1]])) {
+			return text[span[0]:span[1]]
+		}
+	}
+	return ""
+}
+
+func (f *Filter) Contains(text string) bool {
+	return f.Match(text) != ""
+}
+
+// Mask returns text with the letters of every banned word replaced by *.
+func (f *Filter) Mask(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range wordSpans(text) {
+		if !f.banned(normalizeWord(text[span[0]:span[1]])) {
+			continue
+		}
+		b.WriteString(text[last:span[0]])
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[span[0]:span[1]])))
+		last = span[1]
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// UsernameContains reports whether username has a banned word: as one of
+// the parts between underscores, or run together with other letters for
+// the usernameInfixes.
+func (f *Filter) UsernameContains(username string) bool {
+	username = normalizeWord(username)
+	for _, part := range strings.Split(username, "_") {
+		if part != "" && f.usernameBanned(part) {
+			return true
+		}
+	}
+
+	joined := strings.ReplaceAll(username, "_", "")
+	for _, infix := range f.usernameInfixes {
+		if strings.Contains(joined, infix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) banned(word string) bool {
+	if f.words[word] {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) usernameBanned(word string) bool {
+	if f.usernameWords[word] {
+		return true
+	}
+	for _, prefix := range f.usernamePrefixes {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// wordSpans returns the byte ranges of the words of text: runs of letters,
+// digits and the substitution symbols.
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		_, sub := substitutions[r]
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || sub || unicode.Is(unicode.Mn, r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// normalizeWord lowercases word and replaces substitutions. Words that are
+// only digits, such as prices, are left alone.
+func normalizeWord(word string) string {
+	word = strings.ToLower(norm.NFC.String(word))
+	if strings.IndexFunc(word, unicode.IsLetter) < 0 {
+		return word
+	}
+	return strings.Map(func(r rune) rune {
+		if sub, ok := substitutions[r]; ok {
+			return sub
+		}
+		return r
+	}, word)
+}
+
+func ascii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package wordfilter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := New(Options{Words: []string{"spamword", "scam*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for text, want := range map[string]string{
+		"a nice flat":               "",
+		"classic assessment":        "",
+		"what the FUCK":             "FUCK",
+		"absolutely fucking great":  "fucking",
+		"this is sh1t":              "sh1t",
+		"$hit happens":              "$hit",
+		"это пиздец":                "пиздец",
+		"ну и хуёвый ремонт":        "хуёвый",
+		"no spamword here":          "spamword",
+		"scammers everywhere":       "scammers",
+		"price 5000, 3 rooms":       "",
+		"contact me@example.com ok": "",
+	} {
+		if got := f.Match(text); got != want {
+			t.Errorf("Match(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	if got := f.Mask("Fucking great, no shit!"); got != "******* great, no ****!" {
+		t.Errorf("Mask = %q", got)
+	}
+	if got := f.Mask("nothing to hide"); got != "nothing to hide" {
+		t.Errorf("Mask of clean text = %q", got)
+	}
+}
+
+func TestUsernameContains(t *testing.T) {
+	f, err := New(Options{Locales: []string{"en", "ru"}, Transliterate: func(s string) string {
+		return strings.NewReplacer("п", "p", "и", "i", "з", "z", "д", "d", "е", "e", "б", "b", "а", "a", "н", "n").Replace(s)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for username, want := range map[string]bool{
+		"john_smith":   false,
+		"classic_fan":  false,
+		"lebanon_news": false,
+		"fuck_you":     true,
+		"xxfuckxx":     true,
+		"shit2024":     true,
+		"pizdec":       true,
+		"big_pizda":    true,
+		"sh1thead":     true,
+	} {
+		if got := f.UsernameContains(username); got != want {
+			t.Errorf("UsernameContains(%q) = %v, want %v", username, got, want)
+		}
+	}
+}
+
+func TestLocales(t *testing.T) {
+	if locales := Locales(); len(locales) < 2 {
+		t.Errorf("Locales() = %v", locales)
+	}
+	if _, err := New(Options{Locales: []string{"xx"}}); err == nil {
+		t.Error("unknown locale should fail")
+	}
+	// only the lists asked for are loaded
+	f, err := New(Options{Locales: []string{"en"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Contains("пиздец") {
+		t.Error("the ru list was loaded for en only")
+	}
+}